@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// runAccess crawls the target as the primary identity and replays every page
+// and GET API endpoint as the other identities and with no credentials,
+// reporting URLs that hand the primary identity's data to someone else
+func runAccess(args []string) error {
+	fs := newFlagSet("access", "access -url <url> -identity <name:Header: value> [flags]",
+		"Compare two logged-in users", "fuzzer access -url http://example.com/ -cookie session=alice -identity \"bob:Cookie: session=bob\"",
+		"Compare two API tokens", "fuzzer access -url http://example.com/api/ -H \"Authorization: Bearer alice\" -identity \"bob:Authorization: Bearer bob\"",
+	)
+	target := addTargetFlags(fs)
+	var identities stringSlice
+	fs.Var(&identities, "identity", "Other user as name:Header: value, replacing the -H, -cookie and OAuth2 credentials (repeatable)")
+	maxPages := fs.Int("max-pages", 100, "Maximum number of pages to crawl")
+	maxWorkers := fs.Int("max-workers", 20, "Maximum number of concurrent crawler workers")
+
+	parseFlags(fs, args)
+	config := target.config()
+	requireURL(fs, target)
+	var err error
+	if config.Identities, err = fuzzer.ParseIdentities(identities); err != nil {
+		exitf("%v", err)
+	}
+	config.MaxPages = *maxPages
+	config.MaxWorkers = *maxWorkers
+
+	tester, err := fuzzer.NewAccessTester(config)
+	if err != nil {
+		exitf("%v", err)
+	}
+	if err := tester.Run(); err != nil {
+		return err
+	}
+	return finishRun(config)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// runAPI fuzzes the operations declared in an OpenAPI or Swagger document
+func runAPI(args []string) error {
+	fs := newFlagSet("api", "api -spec <file> [-url <base url>] [flags]",
+		"Fuzz the servers the spec names", "fuzzer api -spec openapi.yaml",
+		"Fuzz a staging deployment of the same API", "fuzzer api -spec swagger.json -url http://staging.example.com/",
+		"Also check whether write operations accept privileged fields", "fuzzer api -spec openapi.yaml -mass-assignment",
+	)
+	target := addTargetFlags(fs)
+	spec := fs.String("spec", "", "OpenAPI 3 or Swagger 2 document, JSON or YAML")
+	dryRun := fs.Bool("dry-run", false, "Write the requests that would be sent to planned-requests.txt in the output directory instead of sending them")
+	apiSchema := fs.Bool("api-schema", true, "Infer the JSON schema of responses for operations the spec gives no body for")
+	massAssignment := fs.Bool("mass-assignment", false, "Add privileged fields such as is_admin, role or price to valid request bodies and report those the API accepts")
+	contentTypes := fs.Bool("content-types", false, "Resend valid request bodies as XML, form and multipart data and with mismatched Content-Types, and report those the API parses")
+	xxe := fs.Bool("xxe", false, "Send external entity payloads to endpoints that declare XML or parse it in place of JSON")
+	nosqlInjection := fs.Bool("nosql-injection", false, "Inject MongoDB operators and $where JavaScript into request body fields, confirmed by response diffing")
+	pagination := fs.Bool("pagination", false, "Send huge page sizes, negative pages and SQL-breaking or unlisted sort columns to pagination and sorting parameters such as limit, page and sort")
+	rateLimits := fs.Bool("rate-limits", false, "Send each endpoint up to 100 requests in a row to map its rate limit, then try spoofed client address headers, path variations and HTTP/2 bursts against it; needs -allow-dos")
+	stress := fs.Bool("stress", false, "Send deeply nested JSON, multi-megabyte fields, gzip bombs and thousands of multipart parts to endpoints and report those that slow down or fail; needs -allow-dos")
+	allowDoS := fs.Bool("allow-dos", false, "Allow probes that may degrade or take down the target, such as -stress and -rate-limits")
+	callbackURL := fs.String("callback-url", "", "Out-of-band interaction server for blind probes such as -xxe; requests to it show up in its own logs")
+	compareURL := fs.String("compare-url", "", "Second deployment of the API, e.g. the next release, sent every fuzzed request too and diffed against it")
+
+	parseFlags(fs, args)
+	config := target.config()
+	if *spec == "" {
+		exitf("-spec is required")
+	}
+	if *stress && !*allowDoS {
+		exitf("-stress may take down the target and needs -allow-dos")
+	}
+	if *rateLimits && !*allowDoS {
+		exitf("-rate-limits sends bursts that load the target and needs -allow-dos")
+	}
+	if *compareURL != "" {
+		var err error
+		if config.Differ, err = fuzzer.NewDiffer(*compareURL); err != nil {
+			exitf("%v", err)
+		}
+	}
+	config.APISpec = *spec
+	config.APIFuzzing = true
+	config.APISchema = *apiSchema
+	config.MassAssignment = *massAssignment
+	config.ContentTypeConfusion = *contentTypes
+	config.XXE = *xxe
+	config.NoSQLInjection = *nosqlInjection
+	config.PaginationAbuse = *pagination
+	config.RateLimitMapping = *rateLimits
+	config.ResourceExhaustion = *stress
+	config.AllowDoS = *allowDoS
+	config.CallbackURL = *callbackURL
+	if *dryRun {
+		if err := startDryRun(config); err != nil {
+			return err
+		}
+	}
+
+	f, err := fuzzer.NewAPISpecFuzzer(config)
+	if err != nil {
+		return err
+	}
+	if err := f.Run(); err != nil {
+		return err
+	}
+	return finishRun(config)
+}
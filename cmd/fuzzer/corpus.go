@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// runCorpus runs a corpus subcommand; only min exists so far
+func runCorpus(args []string) error {
+	if len(args) == 0 || args[0] != "min" {
+		exitf("usage: fuzzer corpus min -url <url> -in <corpus> -out <file>")
+	}
+
+	fs := newFlagSet("corpus min", "corpus min -url <url> -in <corpus> -out <file> [flags]",
+		"Keep only the inputs that reach new behavior", "fuzzer corpus min -url http://example.com/ -in corpus.txt -out min.txt",
+	)
+	target := addTargetFlags(fs)
+	in := fs.String("in", "", "Corpus file to minimize, one input per line")
+	out := fs.String("out", "", "File to write the minimized corpus to (default overwrite -in)")
+
+	parseFlags(fs, args[1:])
+	config := target.config()
+	requireURL(fs, target)
+	if *in == "" {
+		exitf("-in is required")
+	}
+	if *out == "" {
+		*out = *in
+	}
+
+	inputs, err := fuzzer.LoadCorpus(*in)
+	if err != nil {
+		return err
+	}
+	kept, err := fuzzer.MinimizeCorpus(config, inputs)
+	if err != nil {
+		return fmt.Errorf("failed to minimize corpus: %v", err)
+	}
+	if err := fuzzer.SaveCorpus(*out, kept); err != nil {
+		return err
+	}
+	slog.Info("corpus saved", "output", *out)
+	exportTraffic(config)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// runCrawl discovers the attack surface of the target without sending any
+// attack payloads. The site map is saved as sitemap.json in the output
+// directory and listed on stdout.
+func runCrawl(args []string) error {
+	fs := newFlagSet("crawl", "crawl -url <url> [flags]",
+		"List everything reachable from the start page", "fuzzer crawl -url http://example.com/",
+		"Crawl a larger site and print the site map as JSON", "fuzzer crawl -url http://example.com/ -max-pages 1000 -format json",
+	)
+	target := addTargetFlags(fs)
+	maxPages := fs.Int("max-pages", 100, "Maximum number of pages to crawl")
+	maxWorkers := fs.Int("max-workers", 20, "Maximum number of concurrent crawler workers")
+	crawlWildcard := fs.Bool("crawl-wildcard-params", false, "Count crawled URLs that differ only in query values, e.g. ?id=1 and ?id=2, as one page")
+	respectRobots := fs.Bool("respect-robots", false, "Do not follow links robots meta tags, X-Robots-Tag and rel=nofollow ask crawlers not to; by default they are followed and the pages visited against them recorded")
+	crawlIdle := fs.Duration("crawl-idle-timeout", 0, "Stop crawling once no page has been visited for this long (0 = never)")
+	crawlMaxDuration := fs.Duration("crawl-max-duration", 0, "Stop crawling after this long, the crawl stage budget (0 = no limit)")
+	crawlFormTimeout := fs.Duration("crawl-form-timeout", 0, "Stop crawling once no new form has been found for this long (0 = never)")
+	format := fs.String("format", "text", "Output format on stdout: text or json")
+	apiProbe := fs.Bool("api-probe", false, "Also request common API roots and spec documents such as /api/v1 and /openapi.json and list every operation a spec declares")
+
+	parseFlags(fs, args)
+	config := target.config()
+	requireURL(fs, target)
+	if *format != "text" && *format != "json" {
+		exitf("unknown output format %q", *format)
+	}
+	config.MaxPages = *maxPages
+	config.MaxWorkers = *maxWorkers
+	config.CrawlWildcardParams = *crawlWildcard
+	config.CrawlRespectRobots = *respectRobots
+	config.CrawlIdleTimeout = *crawlIdle
+	if *crawlMaxDuration > 0 {
+		config.StageBudgets = map[string]time.Duration{fuzzer.StageCrawl: *crawlMaxDuration}
+	}
+	config.CrawlFormTimeout = *crawlFormTimeout
+	config.APIProbe = *apiProbe
+
+	orchestrator, err := fuzzer.NewOrchestrator(config)
+	if err != nil {
+		return err
+	}
+	siteMap, err := orchestrator.DiscoverSiteMap()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(config.OutputDir, "sitemap.json")
+	if err := siteMap.Save(path); err != nil {
+		return err
+	}
+	slog.Info("site map saved", "pages", len(siteMap.Pages), "forms", len(siteMap.Forms),
+		"apis", len(siteMap.APIEndpoints), "assets", len(siteMap.Assets), "output", path)
+	exportTraffic(config)
+
+	if *format == "json" {
+		return siteMap.Write(os.Stdout)
+	}
+	return printSiteMap(siteMap)
+}
+
+// printSiteMap lists the site map as a table of kind, URL and details: the
+// query parameters of pages, form methods, actions and fields, API methods
+// and the robots directives pages were visited against
+func printSiteMap(siteMap *fuzzer.SiteMap) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, page := range siteMap.Pages {
+		fmt.Fprintf(w, "page\t%s\t%s\n", page.URL, strings.Join(page.Params, ","))
+	}
+	for _, form := range siteMap.Forms {
+		names := make([]string, 0, len(form.Fields))
+		for _, field := range form.Fields {
+			names = append(names, field.Name)
+		}
+		fmt.Fprintf(w, "form\t%s\t%s %s %s\n", form.URL, form.Method, form.Action, strings.Join(names, ","))
+	}
+	for _, endpoint := range siteMap.APIEndpoints {
+		fmt.Fprintf(w, "api\t%s\t%s\n", endpoint.URL, endpoint.Method)
+	}
+	for _, endpoint := range siteMap.Parameters {
+		params := make([]string, 0, len(endpoint.Params))
+		for _, param := range endpoint.Params {
+			params = append(params, param.Name+":"+param.Type)
+		}
+		fmt.Fprintf(w, "params\t%s\t%s\n", endpoint.URL, strings.Join(params, ","))
+	}
+	for _, asset := range siteMap.Assets {
+		fmt.Fprintf(w, "asset\t%s\t\n", asset)
+	}
+	for _, override := range siteMap.RobotsOverrides {
+		fmt.Fprintf(w, "robots\t%s\t%s on %s\n", override.URL, override.Rule, override.Source)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// runFuzz fuzzes the target with the fuzzer the flags select
+func runFuzz(args []string) error {
+	fs := newFlagSet("fuzz", "[fuzz] -url <url> [flags]",
+		"Basic fuzzing", "fuzzer -url http://example.com/api/",
+		"Grammar-coverage-guided fuzzing with custom wordlist", "fuzzer fuzz -url http://example.com/api/ -w wordlists/web-attacks.txt -c 20 --grammar-coverage",
+		"Systematic coverage-guided fuzzing", "fuzzer fuzz -url http://example.com/api/ --systematic --duplicate-contexts",
+		"Basic coverage-guided fuzzing", "fuzzer fuzz -url http://example.com/api/ --coverage --no-grammar-coverage",
+		"Raw request template fuzzing (FUZZ marks injection points)", "fuzzer fuzz -url http://example.com/ -request req.txt -w wordlists/web-attacks.txt",
+		"Clusterbomb over two injection points (FUZZ and FUZZ2)", "fuzzer fuzz -url http://example.com/ -request login.txt -attack-mode clusterbomb -pw users.txt -pw passwords.txt",
+		"Only report non-404 responses larger than 1 KB", "fuzzer fuzz -url http://example.com/ -request req.txt -filter status:404 -match size:>1024",
+		"Crawl the site and fuzz everything discovered", "fuzzer fuzz -url http://example.com/ -crawl -n 5000",
+		"Full automatic testing with a shorter crawl", "fuzzer fuzz -url http://example.com/ -full-auto -stage-budget crawl=30s",
+		"Full automatic testing including a second user's access", "fuzzer fuzz -url http://example.com/ -full-auto -cookie session=alice -identity \"bob:Cookie: session=bob\"",
+		"Crawl up to 500 pages, configured through the environment", "GOFUZZ_MAX_PAGES=500 GOFUZZ_API_SCHEMA=true fuzzer fuzz -url http://example.com/ -crawl",
+		"Check whether neighbouring record IDs are readable, then fuzz", "fuzzer fuzz -url http://example.com/api/users/42 -enumerate-ids",
+		"Intensive fuzzing with more requests", "fuzzer fuzz -url http://example.com/api/ -n 5000 -t 15s",
+		"Fuzz for 30 minutes, reporting progress every 5", "fuzzer fuzz -url http://example.com/ -duration 30m -checkpoint-interval 5m",
+		"Review what a crawl-and-fuzz run would send", "fuzzer fuzz -url http://example.com/ -crawl -dry-run",
+		"Crawl and fuzz several sites, at most 20 requests a second each", "fuzzer fuzz -targets targets.txt -crawl -rate 20",
+		"Compare production with staging on every fuzzed request", "fuzzer fuzz -url https://example.com/ -crawl -compare-url https://staging.example.com/",
+	)
+
+	// Basic settings
+	target := addTargetFlags(fs)
+	numRequests := fs.Int("n", 1000, "Number of requests to send (unlimited with -duration unless given)")
+	duration := fs.Duration("duration", 0, "Time budget for the run, e.g. 30m; the run stops when it or -n runs out")
+	checkpointInterval := fs.Duration("checkpoint-interval", time.Minute, "How often a -duration run logs progress and saves its findings and corpus")
+	wordlist := fs.String("w", "", "Path to wordlist file")
+	rules := fs.String("rules", "", "Hashcat-style mangling rules for -w and -pw words: built-in sets backup, case, params, years, or rule files, comma-separated")
+	showVersion := fs.Bool("version", false, "Print version and exit")
+	fingerprint := fs.Bool("fingerprint", true, "Identify the target's server, language and frameworks first, and skip payloads aimed at other stacks")
+	calibrate := fs.Bool("calibrate", true, "Health-check the target first and tune -t and -c to its latency unless given; refuse to start if it does not answer")
+	dryRun := fs.Bool("dry-run", false, "Write the requests that would be sent to planned-requests.txt in the output directory instead of sending them")
+
+	targetsFile := fs.String("targets", "", "File of target URLs, one per line, fuzzed in turn with their results in separate output directories")
+	compareURL := fs.String("compare-url", "", "Second deployment of the target, e.g. staging or the next release, sent every fuzzed request too and diffed against it")
+
+	// Discovery settings
+	crawl := fs.Bool("crawl", false, "Crawl the target first, then fuzz every form, API endpoint and parameterized URL found")
+	fullAuto := fs.Bool("full-auto", false, "Run every stage in turn: crawl, access, API, forms, parameters, SQLi/XSS probes, then write report.json")
+	var identities stringSlice
+	fs.Var(&identities, "identity", "Other user for the full-auto access stage as name:Header: value (repeatable)")
+	var stageBudgets stringSlice
+	fs.Var(&stageBudgets, "stage-budget", "Time limit for a full-auto stage as stage=duration, e.g. crawl=30s (repeatable)")
+	maxPages := fs.Int("max-pages", 100, "Maximum number of pages to crawl")
+	maxWorkers := fs.Int("max-workers", 20, "Maximum number of concurrent crawler workers")
+	crawlWildcard := fs.Bool("crawl-wildcard-params", false, "Count crawled URLs that differ only in query values, e.g. ?id=1 and ?id=2, as one page")
+	respectRobots := fs.Bool("respect-robots", false, "Do not follow links robots meta tags, X-Robots-Tag and rel=nofollow ask crawlers not to; by default they are followed and the pages visited against them recorded")
+	crawlIdle := fs.Duration("crawl-idle-timeout", 0, "Stop crawling once no page has been visited for this long (0 = never)")
+	crawlMaxDuration := fs.Duration("crawl-max-duration", 0, "Stop crawling after this long, the same as -stage-budget crawl= (0 = no limit)")
+	crawlFormTimeout := fs.Duration("crawl-form-timeout", 0, "Stop crawling once no new form has been found for this long (0 = never)")
+
+	// API settings
+	apiFuzzing := fs.Bool("api-fuzzing", false, "Fuzz the target as an API endpoint, or fuzz APIs found while crawling")
+	apiProbe := fs.Bool("api-probe", false, "With -crawl, first request common API roots and spec documents such as /api/v1 and /openapi.json and fuzz every operation a spec declares")
+	apiSchema := fs.Bool("api-schema", false, "Infer the JSON schema of API responses and generate request bodies from it")
+	massAssignment := fs.Bool("mass-assignment", false, "Add privileged fields such as is_admin, role or price to valid API request bodies and report those the API accepts")
+	contentTypes := fs.Bool("content-types", false, "Resend valid API request bodies as XML, form and multipart data and with mismatched Content-Types, and report those the API parses")
+	xxe := fs.Bool("xxe", false, "Send external entity payloads to API endpoints that declare XML or parse it in place of JSON")
+	pagination := fs.Bool("pagination", false, "Send huge page sizes, negative pages and SQL-breaking or unlisted sort columns to API pagination and sorting parameters such as limit, page and sort")
+	rateLimits := fs.Bool("rate-limits", false, "Send each API endpoint up to 100 requests in a row to map its rate limit, then try spoofed client address headers, path variations and HTTP/2 bursts against it; needs -allow-dos")
+	stress := fs.Bool("stress", false, "Send deeply nested JSON, multi-megabyte fields, gzip bombs and thousands of multipart parts to API endpoints and report those that slow down or fail; needs -allow-dos")
+	allowDoS := fs.Bool("allow-dos", false, "Allow probes that may degrade or take down the target, such as -stress and -rate-limits")
+	callbackURL := fs.String("callback-url", "", "Out-of-band interaction server for blind probes such as -xxe; requests to it show up in its own logs")
+
+	// Attack settings
+	sqlInjection := fs.Bool("sql-injection", false, "Probe every query parameter of the target for SQL injection before fuzzing")
+	cmdInjection := fs.Bool("cmd-injection", false, "Probe every query parameter of the target for OS command injection with echo and sleep commands before fuzzing")
+	nosqlInjection := fs.Bool("nosql-injection", false, "Inject MongoDB operators and $where JavaScript into every query parameter before fuzzing and into API request bodies, confirmed by response diffing")
+	ldapInjection := fs.Bool("ldap-injection", false, "Probe every query parameter of the target for LDAP filter injection before fuzzing")
+	xpathInjection := fs.Bool("xpath-injection", false, "Probe every query parameter of the target for XPath injection before fuzzing")
+	elInjection := fs.Bool("el-injection", false, "Probe every query parameter of the target for expression language and template injection before fuzzing")
+	hpp := fs.Bool("hpp", false, "Send every query parameter of the target duplicated with conflicting values before fuzzing and report which value the server honors")
+	normalization := fs.Bool("unicode-normalization", false, "Send zero-width, fullwidth, look-alike and overlong UTF-8 spellings of every query parameter value and the last path segment before fuzzing")
+	boundaries := fs.Bool("boundaries", false, "Send values a step outside the min, max, step and length limits of form fields, one field at a time, before fuzzing")
+	preserveDefaults := fs.Bool("preserve-defaults", false, "Fuzz one form field at a time, keeping hidden and other fields at the values the page fills in")
+	redos := fs.Bool("redos", false, "Time catastrophic-backtracking inputs against form fields with a pattern attribute or server-side regex errors")
+	lockout := fs.Bool("lockout", false, "Send 25 failed logins for one account to login forms and report when none is throttled; needs -allow-brute-force")
+	allowBruteForce := fs.Bool("allow-brute-force", false, "Allow probes that send repeated failed logins or account submissions and may lock or create accounts or send email, such as -lockout and -user-enum")
+	loginUser := fs.String("login-user", "", "Account -lockout fails logins for (default a made-up account)")
+	loginPassword := fs.String("login-password", "", "Password of -login-user, checked to still log in after the failed logins")
+	userEnum := fs.Bool("user-enum", false, "Submit an existing and made-up accounts to password reset and registration forms and report answers or timings that tell them apart; needs -allow-brute-force")
+	knownAccount := fs.String("known-account", "", "Existing account -user-enum submits (default -login-user, else common names like admin)")
+	smuggling := fs.Bool("smuggling", false, "Probe for CL.TE/TE.CL request smuggling before fuzzing")
+	wafEvasion := fs.Bool("waf-evasion", false, "Resend payloads the WAF blocks with varied header casing, order, spacing and chunking, reporting variations that get through")
+	cacheProbes := fs.Bool("cache", false, "Probe the target for web cache poisoning through unkeyed headers and for cache deception through static-looking path suffixes before fuzzing")
+	clickjacking := fs.Bool("clickjacking", false, "Check X-Frame-Options and CSP frame-ancestors of the target and load it in an iframe of a local page in a headless browser before fuzzing")
+	backupFiles := fs.Bool("backup-files", false, "Look for backup copies of the target's file (.bak, ~, .swp, .orig) and archives of its directories and the site before fuzzing")
+	vcsMetadata := fs.Bool("vcs", false, "Look for exposed .git, .svn and .hg directories in the target's directories, verified by fetching their files, before fuzzing")
+	vcsListing := fs.Bool("vcs-listing", false, "List the working copy files exposed version control metadata names (Git index, Mercurial dirstate, Subversion entries) in its finding")
+	adminPanels := fs.Bool("admin-panels", false, "Look for known admin panels and debug endpoints (Spring Boot Actuator, pprof, phpMyAdmin, Jenkins, Grafana, Kibana, ...) with their versions before fuzzing")
+	enumerateIDs := fs.Bool("enumerate-ids", false, "Try neighbouring values of numeric and UUID identifiers in the target URL before fuzzing")
+
+	// Coverage settings
+	useCoverage := fs.Bool("coverage", true, "Use coverage-guided fuzzing")
+	useGrammarCoverage := fs.Bool("grammar-coverage", true, "Use grammar-coverage-guided fuzzing")
+	useSystematicCoverage := fs.Bool("systematic", false, "Use systematic coverage-guided fuzzing")
+	maxCorpus := fs.Int("max-corpus", 1000, "Maximum size of interesting inputs corpus (0 = unlimited)")
+	exploitRatio := fs.Float64("exploit-ratio", 0, "Share of coverage-guided requests sending payloads to the parameters found instead of exploring (0 = explore only)")
+	adaptiveSplit := fs.Bool("adaptive-split", false, "Move the -exploit-ratio share toward the side yielding more findings and coverage per request")
+
+	// Grammar settings
+	maxDepth := fs.Int("max-depth", 10, "Maximum depth for grammar derivation trees")
+	grammarFile := fs.String("grammar", "", "BNF/EBNF grammar file driving grammar-based generation")
+	samplesFile := fs.String("samples", "", "File of field=value lines with valid values to learn field formats from")
+	duplicateContexts := fs.Bool("duplicate-contexts", false, "Duplicate grammar rules for context-specific coverage")
+
+	// Mutation settings
+	useMutation := fs.Bool("mutation-coverage", false, "Use coverage-guided mutation fuzzing of the seed inputs")
+	var seedInputs stringSlice
+	fs.Var(&seedInputs, "seed-input", "Seed input for mutation fuzzing, default the target URL (repeatable)")
+	minMutations := fs.Int("min-mutations", 2, "Minimum mutations per input")
+	mutationRate := fs.Float64("mutation-rate", 0.7, "Probability of mutating vs generating new (0.0-1.0)")
+	maxMutations := fs.Int("max-mutations", 5, "Maximum mutations per input")
+	spliceRate := fs.Float64("splice-rate", 0, "Probability a mutated input is first spliced with another corpus entry (0.0-1.0)")
+	powerSchedule := fs.String("power-schedule", "exploit", "How coverage-guided mutation shares mutations among seeds: exploit, explore, fast or decay")
+
+	// Payload position settings
+	payloadPosition := fs.String("payload-position", "", "Where payloads go: path (appended segment), query, fragment, marker (FUZZ in -url), params (each query parameter in turn), body (POST) or header (default marker when -url has FUZZ, else path)")
+	payloadParam := fs.String("payload-param", "", "Query or body parameter, or header, payloads go in (default the target's first query parameter, else q; User-Agent for headers)")
+
+	// Template settings
+	requestTemplate := fs.String("request", "", "Raw HTTP request file with FUZZ markers to substitute payloads into")
+	payloadSource := fs.String("payload-source", fuzzer.PayloadSourceWordlist, "Payload source for -request: wordlist or grammar")
+	attackMode := fs.String("attack-mode", fuzzer.AttackBatteringRam, "How FUZZ, FUZZ2, ... markers are combined: batteringram, pitchfork or clusterbomb")
+	var positionWordlists stringSlice
+	fs.Var(&positionWordlists, "pw", "Wordlist for the next marker position in pitchfork/clusterbomb mode (repeatable)")
+
+	// Sticky parameter settings
+	var stickyParams stringSlice
+	fs.Var(&stickyParams, "sticky", "Parameter fetched fresh from the page before every form or -request submission, besides detected CSRF tokens, view state and nonces (repeatable)")
+	stickySource := fs.String("sticky-source", "", "Page -request submissions take sticky parameters from (default the target URL)")
+
+	// Result settings
+	var matchRules, filterRules stringSlice
+	fs.Var(&matchRules, "match", "Only report results matching kind:value, e.g. status:200,301 size:>1000 words:<50 lines:1-5 regex:admin latency:>2s (repeatable)")
+	fs.Var(&filterRules, "filter", "Hide results matching kind:value, same syntax as -match (repeatable)")
+
+	parseFlags(fs, args)
+	if *showVersion {
+		fmt.Println(fuzzer.Version)
+		os.Exit(0)
+	}
+	config := target.config()
+	if *targetsFile == "" {
+		requireURL(fs, target)
+	}
+	if *stress && !*allowDoS {
+		exitf("-stress may take down the target and needs -allow-dos")
+	}
+	if *rateLimits && !*allowDoS {
+		exitf("-rate-limits sends bursts that load the target and needs -allow-dos")
+	}
+	if *lockout && !*allowBruteForce {
+		exitf("-lockout may lock the account and needs -allow-brute-force")
+	}
+	if *userEnum && !*allowBruteForce {
+		exitf("-user-enum may mail or create accounts and needs -allow-brute-force")
+	}
+	if *loginPassword != "" && *loginUser == "" {
+		exitf("-login-password needs -login-user")
+	}
+
+	resultFilter, err := fuzzer.ParseResultFilter(matchRules, filterRules)
+	if err != nil {
+		exitf("%v", err)
+	}
+	budgets, err := fuzzer.ParseStageBudgets(stageBudgets)
+	if err != nil {
+		exitf("%v", err)
+	}
+	if *crawlMaxDuration > 0 {
+		if _, ok := budgets[fuzzer.StageCrawl]; ok {
+			exitf("-crawl-max-duration and -stage-budget crawl= set the same limit; give one")
+		}
+		budgets[fuzzer.StageCrawl] = *crawlMaxDuration
+	}
+	parsedIdentities, err := fuzzer.ParseIdentities(identities)
+	if err != nil {
+		exitf("%v", err)
+	}
+	if *targetsFile != "" {
+		// -sni and -host apply to every target, not only -url
+		urls, err := fuzzer.LoadTargets(*targetsFile)
+		if err != nil {
+			exitf("%v", err)
+		}
+		if config.ServerNames, err = fuzzer.TargetServerNames(append(urls, *target.url), *target.sni, *target.host); err != nil {
+			exitf("%v", err)
+		}
+	}
+	if *targetsFile != "" && *target.healthURL == "" && config.Breaker != nil {
+		// Each target's breaker probes that target, not -url
+		config.Breaker = fuzzer.NewCircuitBreaker("")
+	}
+	if *compareURL != "" {
+		if *targetsFile != "" {
+			exitf("-compare-url cannot be combined with -targets")
+		}
+		if config.Differ, err = fuzzer.NewDiffer(*compareURL); err != nil {
+			exitf("%v", err)
+		}
+	}
+
+	// Seed format learning with user-provided samples; crawled pages and API
+	// responses add more during the run
+	if *samplesFile != "" {
+		if err := config.Learner.LoadSamples(*samplesFile); err != nil {
+			exitf("%v", err)
+		}
+	}
+
+	// Basic settings
+	config.NumRequests = *numRequests
+	config.WordlistPath = *wordlist
+	if *rules != "" {
+		if config.WordlistRules, err = fuzzer.LoadMangleRules(*rules); err != nil {
+			exitf("%v", err)
+		}
+	}
+
+	// A time-boxed run is limited by requests only when -n is given
+	config.Duration = *duration
+	config.CheckpointInterval = *checkpointInterval
+	if *duration > 0 && !flagGiven(fs, "n") {
+		config.NumRequests = 0
+	}
+
+	// Discovery settings
+	config.Crawl = *crawl
+	config.FullAuto = *fullAuto
+	config.StageBudgets = budgets
+	config.Identities = parsedIdentities
+	config.MaxPages = *maxPages
+	config.MaxWorkers = *maxWorkers
+	config.CrawlWildcardParams = *crawlWildcard
+	config.CrawlRespectRobots = *respectRobots
+	config.CrawlIdleTimeout = *crawlIdle
+	config.CrawlFormTimeout = *crawlFormTimeout
+
+	// API settings
+	config.APIFuzzing = *apiFuzzing
+	config.APISchema = *apiSchema
+	config.APIProbe = *apiProbe
+	config.MassAssignment = *massAssignment
+	config.ContentTypeConfusion = *contentTypes
+	config.XXE = *xxe
+	config.PaginationAbuse = *pagination
+	config.RateLimitMapping = *rateLimits
+	config.ResourceExhaustion = *stress
+	config.AllowDoS = *allowDoS
+	config.CallbackURL = *callbackURL
+
+	// Attack settings
+	config.SQLInjection = *sqlInjection
+	config.CommandInjection = *cmdInjection
+	config.NoSQLInjection = *nosqlInjection
+	config.LDAPInjection = *ldapInjection
+	config.XPathInjection = *xpathInjection
+	config.ELInjection = *elInjection
+	config.PollutionProbes = *hpp
+	config.Normalization = *normalization
+	config.ReDoS = *redos
+	config.BoundaryValues = *boundaries
+	config.PreserveDefaults = *preserveDefaults
+	config.LoginLockout = *lockout
+	config.AllowBruteForce = *allowBruteForce
+	config.LoginUser = *loginUser
+	config.LoginPassword = *loginPassword
+	config.UserEnumeration = *userEnum
+	config.KnownAccount = *knownAccount
+	config.SmugglingProbes = *smuggling
+	config.WAFEvasion = *wafEvasion
+	config.EnumerateIDs = *enumerateIDs
+	config.CacheProbes = *cacheProbes
+	config.Clickjacking = *clickjacking
+	config.BackupFiles = *backupFiles
+	config.VCSMetadata = *vcsMetadata
+	config.VCSListing = *vcsListing
+	config.AdminPanels = *adminPanels
+
+	// Coverage settings
+	config.UseCoverage = *useCoverage
+	config.UseGrammarCoverage = *useGrammarCoverage
+	config.UseSystematic = *useSystematicCoverage
+	config.MaxCorpus = *maxCorpus
+	config.ExploitRatio = *exploitRatio
+	config.AdaptiveSplit = *adaptiveSplit
+
+	// Grammar settings
+	config.MaxDepth = *maxDepth
+	config.DuplicateContexts = *duplicateContexts
+	config.GrammarFile = *grammarFile
+
+	// Mutation settings
+	config.UseMutation = *useMutation
+	config.SeedInputs = seedInputs
+	config.MinMutations = *minMutations
+	config.MutationRate = *mutationRate
+	config.MaxMutations = *maxMutations
+	config.PowerSchedule = *powerSchedule
+	config.SpliceRate = *spliceRate
+
+	// Template settings
+	config.RequestTemplate = *requestTemplate
+	config.PayloadPosition = *payloadPosition
+	config.PayloadParam = *payloadParam
+	config.PayloadSource = *payloadSource
+	config.AttackMode = *attackMode
+	config.PositionWordlists = positionWordlists
+	config.StickyParams = stickyParams
+	config.StickySource = *stickySource
+
+	// Results
+	config.ResultFilter = resultFilter
+
+	// A dry run sends no load, so there is nothing to calibrate for
+	steps := runSteps{
+		dryRun:          *dryRun,
+		fingerprint:     *fingerprint,
+		calibrate:       *calibrate && !*dryRun,
+		tuneTimeout:     !flagGiven(fs, "t"),
+		tuneConcurrency: !flagGiven(fs, "c"),
+	}
+	if *targetsFile != "" {
+		return fuzzTargets(config, *targetsFile, steps)
+	}
+	return fuzzTarget(config, steps)
+}
+
+// runSteps selects what fuzzTarget does before fuzzing
+type runSteps struct {
+	dryRun          bool
+	fingerprint     bool
+	calibrate       bool
+	tuneTimeout     bool // Whether calibration may change the timeout, -t not given
+	tuneConcurrency bool // Whether calibration may lower the concurrency, -c not given
+}
+
+// fuzzTarget runs the probes and the fuzzer the configuration selects
+// against its target and saves what they found
+func fuzzTarget(config *fuzzer.Config, steps runSteps) error {
+	if steps.dryRun {
+		if err := startDryRun(config); err != nil {
+			return err
+		}
+	}
+
+	// Calibration first, so the fuzzers are built with the tuned settings
+	if steps.calibrate {
+		if err := calibrateTarget(config, steps); err != nil {
+			return err
+		}
+	}
+
+	// The fingerprinted stack picks the payloads the fuzzers are created with
+	if steps.fingerprint {
+		stack, err := fuzzer.FingerprintTarget(config)
+		if err != nil {
+			slog.Warn("fingerprinting failed, sending all payloads", "error", err)
+		} else {
+			config.Stack = stack
+		}
+	}
+
+	// Create and run fuzzer
+	f, err := fuzzer.New(config)
+	if err != nil {
+		return fmt.Errorf("failed to initialize fuzzer: %v", err)
+	}
+
+	// Request smuggling probes run before fuzzing so desyncs are not masked.
+	// They write to raw connections, so a dry run cannot record them.
+	if config.SmugglingProbes && config.DryRun != nil {
+		slog.Warn("dry run: skipping smuggling probes")
+	} else if config.SmugglingProbes {
+		prober, err := fuzzer.NewSmugglingProber(config)
+		if err != nil {
+			return fmt.Errorf("failed to initialize smuggling prober: %v", err)
+		}
+		if err := prober.Run(); err != nil {
+			slog.Error("smuggling probes failed", "error", err)
+		}
+	}
+
+	// WAF evasion probes also write raw requests, formatted in ways the
+	// client would not send
+	if config.WAFEvasion && config.DryRun != nil {
+		slog.Warn("dry run: skipping WAF evasion probes")
+	} else if config.WAFEvasion {
+		prober, err := fuzzer.NewWAFEvasionProber(config)
+		if err != nil {
+			return fmt.Errorf("failed to initialize WAF evasion prober: %v", err)
+		}
+		if err := prober.Run(); err != nil {
+			slog.Error("WAF evasion probes failed", "error", err)
+		}
+	}
+
+	// Full-auto runs its own injection stage against every parameter found
+	if (config.SQLInjection || config.CommandInjection || config.NoSQLInjection ||
+		config.LDAPInjection || config.XPathInjection || config.ELInjection ||
+		config.PollutionProbes || config.Normalization) && !config.FullAuto {
+		prober, err := fuzzer.NewInjectionProber(config)
+		if err != nil {
+			return fmt.Errorf("failed to initialize injection prober: %v", err)
+		}
+		prober.SetSQLInjection(config.SQLInjection)
+		prober.SetCommandInjection(config.CommandInjection)
+		prober.SetNoSQLInjection(config.NoSQLInjection)
+		prober.SetLDAPInjection(config.LDAPInjection)
+		prober.SetXPathInjection(config.XPathInjection)
+		prober.SetELInjection(config.ELInjection)
+		prober.SetParameterPollution(config.PollutionProbes)
+		prober.SetNormalization(config.Normalization)
+		if err := prober.Run(); err != nil {
+			slog.Error("injection probes failed", "error", err)
+		}
+	}
+
+	// Full-auto runs these against every crawled URL in stages of its own
+	if !config.FullAuto {
+		for _, probe := range urlProbes {
+			if !probe.enabled(config) {
+				continue
+			}
+			tester, err := probe.create(config)
+			if err != nil {
+				return fmt.Errorf("failed to initialize %s: %v", probe.name, err)
+			}
+			if err := tester.Run(); err != nil {
+				slog.Error(probe.name+" failed", "error", err)
+			}
+		}
+	}
+
+	if err := f.Run(); err != nil {
+		return fmt.Errorf("fuzzer run failed: %v", err)
+	}
+	return finishRun(config)
+}
+
+// runner is a tester run before fuzzing
+type runner interface{ Run() error }
+
+// urlProbes are the testers fuzzTarget runs before fuzzing, in order, when
+// enabled outside full-auto
+var urlProbes = []struct {
+	name    string
+	enabled func(*fuzzer.Config) bool
+	create  func(*fuzzer.Config) (runner, error)
+}{
+	{"identifier enumeration", func(c *fuzzer.Config) bool { return c.EnumerateIDs }, newRunner(fuzzer.NewEnumerationTester)},
+	{"cache probes", func(c *fuzzer.Config) bool { return c.CacheProbes }, newRunner(fuzzer.NewCacheTester)},
+	{"clickjacking check", func(c *fuzzer.Config) bool { return c.Clickjacking }, newRunner(fuzzer.NewFrameTester)},
+	{"backup file discovery", func(c *fuzzer.Config) bool { return c.BackupFiles }, newRunner(fuzzer.NewBackupTester)},
+	{"version control metadata discovery", func(c *fuzzer.Config) bool { return c.VCSMetadata }, newRunner(fuzzer.NewVCSTester)},
+	{"admin panel discovery", func(c *fuzzer.Config) bool { return c.AdminPanels }, newRunner(fuzzer.NewAdminTester)},
+}
+
+// newRunner adapts a tester constructor to urlProbes
+func newRunner[T runner](create func(*fuzzer.Config) (T, error)) func(*fuzzer.Config) (runner, error) {
+	return func(config *fuzzer.Config) (runner, error) {
+		return create(config)
+	}
+}
+
+// fuzzTargets fuzzes the URL given with -url, if any, and every URL in the
+// targets file in turn. Each target gets its own output directory, findings,
+// sessions and rate limit; targets.json in the output directory sums up how
+// each went.
+func fuzzTargets(config *fuzzer.Config, targetsFile string, steps runSteps) error {
+	urls, err := fuzzer.LoadTargets(targetsFile)
+	if err != nil {
+		return err
+	}
+	if config.TargetURL != "" {
+		urls = append([]string{config.TargetURL}, urls...)
+	}
+
+	var summaries []fuzzer.TargetSummary
+	failed := 0
+	for i, url := range urls {
+		slog.Info("fuzzing target", "target", i+1, "of", len(urls), "url", url)
+		targetConfig := fuzzer.TargetConfig(config, i, url)
+		err := fuzzTarget(targetConfig, steps)
+		if err != nil {
+			slog.Error("target failed", "url", url, "error", err)
+			failed++
+		}
+		summaries = append(summaries, fuzzer.SummarizeTarget(targetConfig, err))
+	}
+
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	summaryPath := filepath.Join(config.OutputDir, "targets.json")
+	if err := fuzzer.SaveTargetSummaries(summaryPath, summaries); err != nil {
+		return err
+	}
+	slog.Info("all targets complete", "targets", len(urls), "failed", failed, "summary", summaryPath)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(urls))
+	}
+	return nil
+}
+
+// calibrateTarget health-checks the target and tunes the configuration to
+// the latency measured. A target that does not answer at all stops the run.
+func calibrateTarget(config *fuzzer.Config, steps runSteps) error {
+	cal, err := fuzzer.CalibrateTarget(config)
+	if err != nil {
+		return fmt.Errorf("%v (run with -calibrate=false to fuzz anyway)", err)
+	}
+	if cal.Failures > 0 {
+		slog.Warn("target failed some health checks, expect errors", "failed", cal.Failures, "of", cal.Requests)
+	}
+
+	config.Breaker.SetBaseline(cal.Median)
+	if steps.tuneTimeout {
+		config.Timeout = cal.Timeout
+	}
+	if steps.tuneConcurrency {
+		config.Concurrency = cal.Concurrency
+	}
+	slog.Info("target calibrated", "median", cal.Median.Round(time.Millisecond), "p95", cal.P95.Round(time.Millisecond),
+		"max", cal.Max.Round(time.Millisecond), "timeout", config.Timeout, "concurrency", config.Concurrency)
+	return nil
+}
@@ -3,110 +3,613 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
-	"fuzzer/internal/fuzzer"
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands in the order usage shows them
+var commands = []command{
+	{"fuzz", "Fuzz the target (the default when no command is given)", runFuzz},
+	{"crawl", "Crawl the target without attacking it and save a site map", runCrawl},
+	{"api", "Fuzz every operation of an OpenAPI or Swagger document", runAPI},
+	{"access", "Find broken access control by comparing what each identity can read", runAccess},
+	{"report", "Summarize the findings of an earlier run", runReport},
+	{"replay", "Re-send saved findings or corpus entries and check what still reproduces", runReplay},
+	{"corpus", "Manage corpus files (corpus min: minimize a corpus)", runCorpus},
+	{"version", "Print the version", runVersion},
+}
+
+// hookScript is the -hook script the command started, if any; it is closed
+// once the command returns
+var hookScript *fuzzer.HookScript
+
 func main() {
-	// Parse command line flags
-	config := parseFlags()
+	// Flags without a command keep working as they always have: they fuzz
+	name, args := "fuzz", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage()
+		return
+	}
 
-	// Create and run fuzzer
-	f, err := fuzzer.New(config)
-	if err != nil {
-		log.Fatalf("Error initializing fuzzer: %v", err)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		err := cmd.run(args)
+		if err := hookScript.Close(); err != nil {
+			slog.Warn("hook script exited with an error", "error", err)
+		}
+		if err != nil {
+			slog.Error(name+" failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", name)
+	usage()
+	os.Exit(1)
+}
+
+// usage lists the commands
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "A web application fuzzer with coverage-guided fuzzing capabilities.")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// runVersion prints the version
+func runVersion(args []string) error {
+	fmt.Println(fuzzer.Version)
+	return nil
+}
+
+// newFlagSet creates the flag set of a command. Examples are given as
+// description, command line pairs and printed after the flags.
+func newFlagSet(name, synopsis string, examples ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\n", filepath.Base(os.Args[0]), synopsis)
+		fmt.Fprintln(os.Stderr, "Flags (each can also be set as GOFUZZ_<NAME>, e.g. GOFUZZ_MAX_PAGES for -max-pages):")
+		fs.PrintDefaults()
+		if len(examples) > 0 {
+			fmt.Fprintln(os.Stderr, "\nExamples:")
+			for i := 0; i+1 < len(examples); i += 2 {
+				fmt.Fprintf(os.Stderr, "  %s:\n    %s\n", examples[i], examples[i+1])
+			}
+		}
+	}
+	return fs
+}
+
+// parseFlags parses a command's arguments, falling back to the environment
+// for flags not given
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if err := applyEnvironment(fs); err != nil {
+		exitf("%v", err)
+	}
+}
+
+// flagGiven reports whether a flag was set on the command line or from the
+// environment
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// exitf reports a problem with the command line and exits
+func exitf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// stringSlice is a flag that may be repeated, collecting every value in order
+type stringSlice []string
+
+// String implements flag.Value
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements flag.Value
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// envPrefix namespaces the environment variables standing in for flags
+const envPrefix = "GOFUZZ_"
+
+// envName returns the environment variable for a flag, e.g. GOFUZZ_MAX_PAGES
+// for -max-pages
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnvironment sets each flag not given on the command line from its
+// environment variable, if set. Repeatable flags take a single value.
+func applyEnvironment(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || err != nil {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// logFlags configure logging; every command has them
+type logFlags struct {
+	verbose *bool
+	level   *string
+	format  *string
+}
+
+// addLogFlags registers the logging flags
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		verbose: fs.Bool("v", false, "Enable verbose logging"),
+		level:   fs.String("log-level", "", "Log level: debug, info, warn, error (default info, debug with -v)"),
+		format:  fs.String("log-format", "text", "Log output format: text or json"),
 	}
+}
 
-	if err := f.Run(); err != nil {
-		log.Fatalf("Error running fuzzer: %v", err)
+// setup configures logging before anything else can emit records. Records
+// go to stderr and to each of files.
+func (l *logFlags) setup(files ...io.Writer) {
+	level := *l.level
+	if level == "" && *l.verbose {
+		level = "debug"
+	}
+	if *l.format != "text" && *l.format != "json" {
+		exitf("unknown log format %q", *l.format)
 	}
+	if err := logging.Setup(io.MultiWriter(append([]io.Writer{os.Stderr}, files...)...), logging.Options{Level: level, JSON: *l.format == "json"}); err != nil {
+		exitf("%v", err)
+	}
+}
+
+// targetFlags configure the target and how requests reach it; every command
+// that sends requests has them
+type targetFlags struct {
+	*logFlags
+	url              *string
+	concurrency      *int
+	timeout          *time.Duration
+	output           *string
+	seed             *int64
+	maxBodySize      *int64
+	maxFingerprints  *int
+	preserveSessions *bool
+	sessionMode      *string
+	loginRequest     *string
+	httpProtocol     *string
+	maxIdlePerHost   *int
+	noKeepAlive      *bool
+	noCompression    *bool
+	dnsCacheTTL      *time.Duration
+	rate             *float64
+	hostDelay        *time.Duration
+	hostParallel     *int
+	retries          *int
+	retryBackoff     *time.Duration
+	circuitBreaker   *bool
+	healthURL        *string
+	resolve          stringSlice
+	host             *string
+	headers          stringSlice
+	cookies          stringSlice
+	browser          *string
+	userAgents       *string
+
+	// TLS settings
+	clientCert *string
+	clientKey  *string
+	caCert     *string
+	tlsMin     *string
+	insecure   *bool
+	sni        *string
+
+	// OAuth2 settings
+	oauth2TokenURL     *string
+	oauth2ClientID     *string
+	oauth2ClientSecret *string
+	oauth2RefreshToken *string
+	oauth2Scopes       stringSlice
+
+	// Request signing
+	signers    stringSlice
+	signSecret *string
+
+	// Response scanning
+	scanLeaks *bool
+	leakRules *string
+
+	// Traffic export
+	export    *string
+	exportMax *int
+
+	// Plugins and hooks
+	plugins    stringSlice
+	hook       *string
+	hookEvents *string
 }
 
-func parseFlags() *fuzzer.Config {
-	// Basic settings
-	targetURL := flag.String("url", "", "Target URL to fuzz")
-	concurrency := flag.Int("c", 10, "Number of concurrent workers")
-	numRequests := flag.Int("n", 1000, "Number of requests to send")
-	timeout := flag.Duration("t", 10*time.Second, "Timeout per request")
-	wordlist := flag.String("w", "", "Path to wordlist file")
-	output := flag.String("o", "./results", "Output directory for results")
-	verbose := flag.Bool("v", false, "Enable verbose logging")
+// addTargetFlags registers the target, connection and logging flags
+func addTargetFlags(fs *flag.FlagSet) *targetFlags {
+	t := &targetFlags{
+		logFlags:         addLogFlags(fs),
+		url:              fs.String("url", "", "Target URL"),
+		concurrency:      fs.Int("c", 10, "Number of concurrent workers"),
+		timeout:          fs.Duration("t", 10*time.Second, "Timeout per request"),
+		output:           fs.String("o", "./results", "Output directory for results"),
+		seed:             fs.Int64("seed", 0, "Seed for random choices, reuse a logged seed with -c 1 to replay a run (0 = random)"),
+		maxBodySize:      fs.Int64("max-body-size", 10<<20, "Maximum response body bytes held in memory, the rest is hashed and discarded"),
+		maxFingerprints:  fs.Int("max-fingerprints", 10000, "Maximum response fingerprints kept for similarity dedup"),
+		preserveSessions: fs.Bool("preserve-sessions", true, "Maintain session cookies across requests"),
+		sessionMode:      fs.String("session-mode", fuzzer.SessionShared, "How workers keep sessions: shared (one cookie jar) or per-worker (a jar and login each)"),
+		loginRequest:     fs.String("login-request", "", "Raw HTTP request file sent to log each session in, e.g. a captured login POST"),
+
+		// Protocol and connection settings
+		httpProtocol:   fs.String("http-protocol", fuzzer.ProtocolAuto, "HTTP protocol: auto, http1.0, http1.1, h2, h2c"),
+		maxIdlePerHost: fs.Int("max-idle-per-host", 0, "Idle connections kept per host (0 = one per worker)"),
+		noKeepAlive:    fs.Bool("no-keepalive", false, "Open a new connection for every request"),
+		noCompression:  fs.Bool("no-compression", false, "Do not request gzip-compressed responses"),
+		dnsCacheTTL:    fs.Duration("dns-cache-ttl", time.Minute, "How long resolved addresses are reused (0 disables caching)"),
+		rate:           fs.Float64("rate", 0, "Maximum requests per second to each target (0 = unlimited)"),
+		hostDelay:      fs.Duration("host-delay", 0, "Minimum delay between requests to the same host, whatever the concurrency (0 = none)"),
+		hostParallel:   fs.Int("host-parallel", 0, "Maximum requests in flight to the same host at once, whatever the concurrency (0 = unlimited)"),
+		retries:        fs.Int("retries", 2, "Retries of a request failing with a reset, timeout, 429, 502, 503 or 504 (0 = none)"),
+		retryBackoff:   fs.Duration("retry-backoff", 500*time.Millisecond, "Wait before the first retry, doubled with jitter for each further one"),
+		circuitBreaker: fs.Bool("circuit-breaker", true, "Pause while the target fails or slows down, resuming once health probes succeed"),
+		healthURL:      fs.String("health-url", "", "URL probed while paused by the circuit breaker (default the target URL)"),
+	}
+
+	fs.Var(&t.resolve, "resolve", "Dial a host name at a fixed address as host:ip, e.g. staging without /etc/hosts edits (repeatable)")
+
+	// TLS settings
+	t.clientCert = fs.String("cert", "", "PEM client certificate for servers requiring mutual TLS")
+	t.clientKey = fs.String("key", "", "PEM private key of the -cert client certificate")
+	t.caCert = fs.String("cacert", "", "PEM bundle of CAs to trust besides the system roots, e.g. an internal PKI")
+	t.tlsMin = fs.String("tls-min", "", "Lowest TLS version to negotiate: 1.0, 1.1, 1.2 or 1.3 (default Go's)")
+	t.insecure = fs.Bool("k", false, "Accept any server certificate, e.g. self-signed staging hosts")
+	t.sni = fs.String("sni", "", "TLS server name sent to the target and verified against its certificate (default the URL's host, or -host's for IP-literal URLs)")
+
+	// Request settings
+	t.host = fs.String("host", "", "Host header sent instead of the target URL's host, for virtual hosts behind a load balancer")
+	fs.Var(&t.headers, "H", "Header sent with every request as \"Name: value\", e.g. an API key (repeatable)")
+	fs.Var(&t.cookies, "cookie", "Cookies sent with every request as \"name=value; other=value\" (repeatable)")
+	t.browser = fs.String("browser", "", "Send the User-Agent and navigation headers of a browser: chrome, edge, firefox, safari, or rotate for each in turn")
+	t.userAgents = fs.String("user-agents", "", "File of User-Agents, one per line, sent in turn instead of Go's or -browser's")
 
-	// Coverage settings
-	useCoverage := flag.Bool("coverage", true, "Use coverage-guided fuzzing")
-	useGrammarCoverage := flag.Bool("grammar-coverage", true, "Use grammar-coverage-guided fuzzing")
-	useSystematicCoverage := flag.Bool("systematic", false, "Use systematic coverage-guided fuzzing")
-	maxCorpus := flag.Int("max-corpus", 1000, "Maximum size of interesting inputs corpus (0 = unlimited)")
+	// OAuth2 settings
+	t.oauth2TokenURL = fs.String("oauth2-token-url", "", "OAuth2 token endpoint; a Bearer token is fetched at startup and refreshed before it expires")
+	t.oauth2ClientID = fs.String("oauth2-client-id", "", "OAuth2 client ID")
+	t.oauth2ClientSecret = fs.String("oauth2-client-secret", "", "OAuth2 client secret, best passed as GOFUZZ_OAUTH2_CLIENT_SECRET")
+	t.oauth2RefreshToken = fs.String("oauth2-refresh-token", "", "Use the refresh-token grant with this token instead of client credentials")
+	fs.Var(&t.oauth2Scopes, "oauth2-scope", "OAuth2 scope to request (repeatable)")
 
-	// Grammar settings
-	maxDepth := flag.Int("max-depth", 10, "Maximum depth for grammar derivation trees")
-	duplicateContexts := flag.Bool("duplicate-contexts", false, "Duplicate grammar rules for context-specific coverage")
+	// Request signing
+	fs.Var(&t.signers, "sign", "Sign requests: aws:<region>:<service> with the AWS_* credentials, or hmac:<header>[:<hash>[:<encoding>[:<prefix>]]]; append @<host> to sign another host than the target (repeatable)")
+	t.signSecret = fs.String("sign-secret", "", "Secret of hmac signers, best passed as GOFUZZ_SIGN_SECRET")
 
-	// Mutation settings
-	mutationRate := flag.Float64("mutation-rate", 0.7, "Probability of mutating vs generating new (0.0-1.0)")
-	maxMutations := flag.Int("max-mutations", 5, "Maximum mutations per input")
-	preserveSessions := flag.Bool("preserve-sessions", true, "Maintain session cookies across requests")
+	// Response scanning
+	t.scanLeaks = fs.Bool("scan-leaks", true, "Report keys, tokens, email addresses, internal IPs and stack traces found in responses")
+	t.leakRules = fs.String("leak-rules", "", "File of name=regex lines adding to or replacing the leak scanning rules (name= alone drops a rule)")
 
-	// Parse flags
-	flag.Parse()
+	// Traffic export
+	t.export = fs.String("export", "", "Export in-scope traffic and findings for manual testing: burp (traffic.xml), har (traffic.har, for ZAP) or burp,har")
+	t.exportMax = fs.Int("export-max", 5000, "Maximum exchanges recorded for -export")
 
-	// Validate required flags
-	if *targetURL == "" {
+	// Plugins and hooks
+	fs.Var(&t.plugins, "plugin", "Go plugin (.so) adding custom detectors, mutators and hooks (repeatable)")
+	t.hook = fs.String("hook", "", "Script run as hooks, e.g. \"python3 sign.py\", exchanging JSON lines on stdin and stdout")
+	t.hookEvents = fs.String("hook-events", "request,response,finding", "Events sent to the -hook script: request, response and finding")
+	return t
+}
+
+// config sets up logging, to stderr and to fuzzer.log in the output
+// directory, and returns a configuration holding the target settings, with
+// defaults for everything else
+func (t *targetFlags) config() *fuzzer.Config {
+	if err := os.MkdirAll(*t.output, 0755); err != nil {
+		exitf("failed to create output directory: %v", err)
+	}
+	logFile, err := os.Create(filepath.Join(*t.output, logFileName))
+	if err != nil {
+		exitf("failed to create log file: %v", err)
+	}
+	t.setup(logFile)
+
+	config := fuzzer.DefaultConfig(*t.url)
+	config.Concurrency = *t.concurrency
+	config.Timeout = *t.timeout
+	config.OutputDir = *t.output
+	config.Verbose = *t.verbose
+	config.Seed = *t.seed
+	config.MaxBodySize = *t.maxBodySize
+	config.MaxFingerprints = *t.maxFingerprints
+	config.PreserveSessions = *t.preserveSessions
+	config.SessionMode = *t.sessionMode
+	config.LoginRequest = *t.loginRequest
+	config.HTTPProtocol = *t.httpProtocol
+	config.MaxIdleConnsPerHost = *t.maxIdlePerHost
+	config.DisableKeepAlives = *t.noKeepAlive
+	config.DisableCompression = *t.noCompression
+	config.DNSCacheTTL = *t.dnsCacheTTL
+	if *t.rate < 0 {
+		exitf("rate must not be negative")
+	} else if *t.rate > 0 {
+		config.RateLimit = fuzzer.NewRateLimiter(*t.rate)
+	}
+	if *t.hostDelay < 0 || *t.hostParallel < 0 {
+		exitf("host delay and host parallelism must not be negative")
+	}
+	config.Politeness = nil
+	if *t.hostDelay > 0 || *t.hostParallel > 0 {
+		config.Politeness = fuzzer.NewPoliteness(*t.hostDelay, *t.hostParallel)
+	}
+	if *t.retries < 0 || *t.retryBackoff < 0 {
+		exitf("retries and retry backoff must not be negative")
+	}
+	config.Retry = nil
+	if *t.retries > 0 {
+		config.Retry = fuzzer.NewRetryPolicy(*t.retries, *t.retryBackoff)
+	}
+	config.Breaker = nil
+	if *t.circuitBreaker {
+		healthURL := *t.healthURL
+		if healthURL == "" {
+			healthURL = *t.url
+		}
+		config.Breaker = fuzzer.NewCircuitBreaker(healthURL)
+	}
+
+	if config.Headers, err = fuzzer.ParseHeaders(t.headers); err != nil {
+		exitf("%v", err)
+	}
+	if config.Cookies, err = fuzzer.ParseCookies(t.cookies); err != nil {
+		exitf("%v", err)
+	}
+	if *t.host != "" {
+		config.Headers["Host"] = *t.host
+	}
+	if *t.browser != "" || *t.userAgents != "" {
+		var userAgents []string
+		if *t.userAgents != "" {
+			if userAgents, err = fuzzer.LoadUserAgents(*t.userAgents); err != nil {
+				exitf("%v", err)
+			}
+		}
+		if config.Impersonation, err = fuzzer.NewImpersonation(*t.browser, userAgents); err != nil {
+			exitf("%v", err)
+		}
+	}
+	if config.Resolve, err = fuzzer.ParseResolve(t.resolve); err != nil {
+		exitf("%v", err)
+	}
+
+	config.ClientCert = *t.clientCert
+	config.ClientKey = *t.clientKey
+	config.CACert = *t.caCert
+	config.InsecureSkipVerify = *t.insecure
+	if config.TLSMinVersion, err = fuzzer.ParseTLSVersion(*t.tlsMin); err != nil {
+		exitf("%v", err)
+	}
+	if *t.url != "" {
+		if config.ServerNames, err = fuzzer.TargetServerNames([]string{*t.url}, *t.sni, *t.host); err != nil {
+			exitf("%v", err)
+		}
+	}
+	// Load the certificates now, so a bad path fails before any crawling
+	if _, err := fuzzer.TLSConfig(config); err != nil {
+		exitf("%v", err)
+	}
+
+	if *t.oauth2TokenURL != "" {
+		config.OAuth2, err = fuzzer.NewTokenSource(fuzzer.OAuth2Config{
+			TokenURL:     *t.oauth2TokenURL,
+			ClientID:     *t.oauth2ClientID,
+			ClientSecret: *t.oauth2ClientSecret,
+			Scopes:       t.oauth2Scopes,
+			RefreshToken: *t.oauth2RefreshToken,
+		}, config)
+		if err != nil {
+			exitf("%v", err)
+		}
+	}
+
+	if len(t.signers) > 0 {
+		credentials := fuzzer.AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		config.Signers = make(map[string]fuzzer.Signer)
+		for _, spec := range t.signers {
+			host := ""
+			if at := strings.LastIndex(spec, "@"); at >= 0 {
+				spec, host = spec[:at], strings.ToLower(spec[at+1:])
+			}
+			if config.Signers[host] != nil {
+				exitf("more than one -sign for host %q (empty for the target)", host)
+			}
+			signer, err := fuzzer.ParseSigner(spec, credentials, []byte(*t.signSecret))
+			if err != nil {
+				exitf("%v", err)
+			}
+			config.Signers[host] = signer
+		}
+	}
+
+	if *t.export != "" {
+		for _, format := range strings.Split(*t.export, ",") {
+			format = strings.TrimSpace(format)
+			if format != fuzzer.ExportBurp && format != fuzzer.ExportHAR {
+				exitf("unknown export format %q (want %s or %s)", format, fuzzer.ExportBurp, fuzzer.ExportHAR)
+			}
+			config.ExportFormats = append(config.ExportFormats, format)
+		}
+		config.Traffic = fuzzer.NewTraffic(*t.exportMax)
+	}
+
+	if len(t.plugins) > 0 {
+		for _, path := range t.plugins {
+			if err := fuzzer.LoadPlugin(path); err != nil {
+				exitf("%v", err)
+			}
+		}
+		config.Detectors = fuzzer.RegisteredDetectors()
+		config.Mutators = fuzzer.RegisteredMutators()
+		config.Hooks = fuzzer.RegisteredHooks()
+		slog.Info("plugins loaded", "detectors", len(config.Detectors), "mutators", len(config.Mutators), "hooks", len(config.Hooks))
+	}
+	if *t.hook != "" {
+		script, err := fuzzer.NewHookScript(*t.hook, strings.Split(*t.hookEvents, ","))
+		if err != nil {
+			exitf("%v", err)
+		}
+		config.Hooks = append(config.Hooks, script)
+		hookScript = script
+	}
+	config.Findings.SetHooks(config.Hooks)
+
+	if !*t.scanLeaks {
+		config.Leaks = nil
+	} else if *t.leakRules != "" {
+		if err := config.Leaks.LoadRules(*t.leakRules); err != nil {
+			exitf("%v", err)
+		}
+	}
+	return config
+}
+
+// requireURL exits with the command's usage when no target URL was given
+func requireURL(fs *flag.FlagSet, t *targetFlags) {
+	if *t.url == "" {
 		fmt.Fprintln(os.Stderr, "Error: target URL is required")
-		flag.Usage()
+		fs.Usage()
 		os.Exit(1)
 	}
+}
+
+// plannedRequestsFile holds the requests a dry run would have sent, in the
+// output directory
+const plannedRequestsFile = "planned-requests.txt"
+
+// logFileName holds the log records of a run, in the output directory
+const logFileName = "fuzzer.log"
+
+// outagesFile holds the periods the circuit breaker paused the run for, in
+// the output directory
+const outagesFile = "outages.json"
 
-	// Create config with parsed values
-	return &fuzzer.Config{
-		// Basic settings
-		TargetURL:    *targetURL,
-		Concurrency:  *concurrency,
-		NumRequests:  *numRequests,
-		Timeout:      *timeout,
-		WordlistPath: *wordlist,
-		OutputDir:    *output,
-		Verbose:      *verbose,
-
-		// Coverage settings
-		UseCoverage:        *useCoverage,
-		UseGrammarCoverage: *useGrammarCoverage,
-		MaxCorpus:          *maxCorpus,
-
-		// Grammar settings
-		MaxDepth:          *maxDepth,
-		UseSystematic:     *useSystematicCoverage,
-		DuplicateContexts: *duplicateContexts,
-
-		// Mutation settings
-		MutationRate:     *mutationRate,
-		MaxMutations:     *maxMutations,
-		PreserveSessions: *preserveSessions,
-	}
-}
-
-func init() {
-	// Customize usage output
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [flags] \n\n", os.Args[0])
-		fmt.Fprintln(os.Stderr, "A web application fuzzer with coverage-guided fuzzing capabilities.")
-		fmt.Fprintln(os.Stderr, "\nFlags:")
-		flag.PrintDefaults()
-		fmt.Fprintln(os.Stderr, "\nExamples:")
-		fmt.Fprintln(os.Stderr, "  Basic fuzzing:")
-		fmt.Fprintln(os.Stderr, "    fuzzer -url http://example.com/api/")
-		fmt.Fprintln(os.Stderr, "\n  Grammar-coverage-guided fuzzing with custom wordlist:")
-		fmt.Fprintln(os.Stderr, "    fuzzer -url http://example.com/api/ -w wordlists/web-attacks.txt -c 20 --grammar-coverage")
-
-		fmt.Fprintln(os.Stderr, "\n  Systematic coverage-guided fuzzing:")
-		fmt.Fprintln(os.Stderr, "    fuzzer -url http://example.com/api/ --systematic --duplicate-contexts")
-
-		fmt.Fprintln(os.Stderr, "\n  Basic coverage-guided fuzzing:")
-		fmt.Fprintln(os.Stderr, "    fuzzer -url http://example.com/api/ --coverage --no-grammar-coverage")
-		fmt.Fprintln(os.Stderr, "\n  Intensive fuzzing with more requests:")
-		fmt.Fprintln(os.Stderr, "    fuzzer -url http://example.com/api/ -n 5000 -t 15s")
+// startDryRun makes the run record its requests instead of sending them
+func startDryRun(config *fuzzer.Config) error {
+	dryRun, err := fuzzer.NewDryRun(filepath.Join(config.OutputDir, plannedRequestsFile))
+	if err != nil {
+		return err
+	}
+	config.DryRun = dryRun
+	slog.Info("dry run: requests are recorded, not sent", "output", filepath.Join(config.OutputDir, plannedRequestsFile))
+	return nil
+}
+
+// finishRun saves the findings of a run, or the planned requests of a dry
+// run, whose findings come from placeholder responses and are dropped
+func finishRun(config *fuzzer.Config) error {
+	if config.DryRun == nil {
+		return saveFindings(config)
+	}
+	if err := config.DryRun.Close(); err != nil {
+		return err
+	}
+	slog.Info("dry run complete", "requests", config.DryRun.Count(),
+		"output", filepath.Join(config.OutputDir, plannedRequestsFile))
+	return nil
+}
+
+// saveFindings persists the findings reported by all detectors, with raw
+// exchanges alongside
+func saveFindings(config *fuzzer.Config) error {
+	if err := config.Findings.WriteCaptures(filepath.Join(config.OutputDir, "captures")); err != nil {
+		slog.Error("failed to save request captures", "error", err)
+	}
+	findingsPath := filepath.Join(config.OutputDir, "findings.jsonl")
+	if err := config.Findings.Save(findingsPath); err != nil {
+		return fmt.Errorf("failed to save findings: %v", err)
+	}
+	exportTraffic(config)
+	if outages := config.Breaker.Outages(); len(outages) > 0 {
+		outagesPath := filepath.Join(config.OutputDir, outagesFile)
+		if err := fuzzer.SaveOutages(outagesPath, outages); err != nil {
+			slog.Error("failed to save outages", "error", err)
+		}
+		slog.Warn("target was unstable during the run, findings from then may need verifying",
+			"outages", len(outages), "output", outagesPath)
+	}
+	if dead := config.Retry.DeadEndpoints(); len(dead) > 0 {
+		slog.Warn("endpoints unreachable after retries", "count", len(dead), "endpoints", dead)
+	}
+	slog.Info("run complete", "findings", config.Findings.Count(), "output", findingsPath)
+	return nil
+}
+
+// exportTraffic writes the recorded traffic, with the findings noted on it,
+// in every requested export format
+func exportTraffic(config *fuzzer.Config) {
+	if len(config.ExportFormats) == 0 {
+		return
+	}
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		slog.Error("failed to create output directory", "error", err)
+		return
+	}
+	for _, format := range config.ExportFormats {
+		path := filepath.Join(config.OutputDir, fuzzer.ExportFile(format))
+		if err := config.Traffic.Export(path, format, config.Findings.Findings()); err != nil {
+			slog.Error("failed to export traffic", "format", format, "error", err)
+			continue
+		}
+		slog.Info("traffic exported", "format", format, "exchanges", config.Traffic.Count(), "output", path)
 	}
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// runReplay re-sends the requests of saved findings or corpus entries and
+// reports which findings still reproduce
+func runReplay(args []string) error {
+	fs := newFlagSet("replay", "replay -input <findings.jsonl | corpus> [flags]",
+		"Check whether the findings of a run still reproduce", "fuzzer replay -input results/findings.jsonl",
+		"Verify a fix on staging", "fuzzer replay -input results/findings.jsonl -url https://staging.example.com",
+		"Replay a corpus against a target", "fuzzer replay -input corpus.txt -url http://example.com/",
+	)
+	target := addTargetFlags(fs)
+	input := fs.String("input", "", "Findings file (findings.jsonl) or corpus file, one input per line, to replay")
+	format := fs.String("format", "text", "Result format: text or json")
+
+	parseFlags(fs, args)
+	config := target.config()
+	if *input == "" {
+		exitf("-input is required")
+	}
+	if *format != "text" && *format != "json" {
+		exitf("unknown result format %q", *format)
+	}
+	// The results of a replay must not overwrite the run they replay
+	if !flagGiven(fs, "o") {
+		config.OutputDir = "./replay"
+	}
+	if absPath(filepath.Join(config.OutputDir, "findings.jsonl")) == absPath(*input) {
+		exitf("-o must differ from the directory of -input, whose findings would be overwritten")
+	}
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", *input, err)
+	}
+	var results []fuzzer.ReplayResult
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		findings, err := fuzzer.LoadFindings(*input)
+		if err != nil {
+			return err
+		}
+		results, err = fuzzer.ReplayFindings(config, findings)
+		if err != nil {
+			return err
+		}
+	} else {
+		requireURL(fs, target)
+		inputs, err := fuzzer.LoadCorpus(*input)
+		if err != nil {
+			return err
+		}
+		results, err = fuzzer.ReplayCorpus(config, inputs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := finishRun(config); err != nil {
+		return err
+	}
+	if err := printReplay(results, *format); err != nil {
+		return err
+	}
+
+	// Exit non-zero while anything reproduces, so a fix can be checked in CI
+	reproduced := 0
+	for _, r := range results {
+		if r.Outcome == fuzzer.ReplayReproduced {
+			reproduced++
+		}
+	}
+	if reproduced > 0 {
+		return fmt.Errorf("%d of %d findings still reproduce", reproduced, len(results))
+	}
+	return nil
+}
+
+// printReplay writes the replay results to stdout
+func printReplay(results []fuzzer.ReplayResult, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "OUTCOME\tSTATUS\tRECORDED\tTYPE\tMETHOD\tURL\tDETAIL")
+	for _, r := range results {
+		counts[r.Outcome]++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Outcome, statusText(r.Status), statusText(r.RecordedStatus), r.Type, r.Method, r.URL, r.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d replayed", len(results))
+	for _, outcome := range []string{fuzzer.ReplayReproduced, fuzzer.ReplayChanged, fuzzer.ReplaySent, fuzzer.ReplayFailed, fuzzer.ReplaySkipped} {
+		if counts[outcome] > 0 {
+			fmt.Printf(", %d %s", counts[outcome], outcome)
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// statusText formats a status code, or a dash for none
+func statusText(status int) string {
+	if status == 0 {
+		return "-"
+	}
+	return fmt.Sprint(status)
+}
+
+// absPath returns the absolute form of path, or path itself if it has none
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
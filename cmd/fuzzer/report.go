@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// reportSeverities orders severities from most to least serious
+var reportSeverities = []fuzzer.Severity{
+	fuzzer.SeverityCritical,
+	fuzzer.SeverityHigh,
+	fuzzer.SeverityMedium,
+	fuzzer.SeverityLow,
+	fuzzer.SeverityInfo,
+}
+
+// runReport prints the findings saved by an earlier run
+func runReport(args []string) error {
+	fs := newFlagSet("report", "report [-o <dir> | -findings <file>] [flags]",
+		"Summarize the last run", "fuzzer report",
+		"Only medium and above, as JSON", "fuzzer report -o ./results -min-severity medium -format json",
+	)
+	logs := addLogFlags(fs)
+	output := fs.String("o", "./results", "Output directory of the run to report on")
+	findingsPath := fs.String("findings", "", "Findings file to read (default <o>/findings.jsonl)")
+	minSeverity := fs.String("min-severity", string(fuzzer.SeverityInfo), "Only report findings at least this severe: info, low, medium, high, critical")
+	format := fs.String("format", "text", "Report format: text or json")
+
+	parseFlags(fs, args)
+	logs.setup()
+	threshold, err := fuzzer.ParseSeverity(*minSeverity)
+	if err != nil {
+		exitf("%v", err)
+	}
+	if *format != "text" && *format != "json" {
+		exitf("unknown report format %q", *format)
+	}
+	if *findingsPath == "" {
+		*findingsPath = filepath.Join(*output, "findings.jsonl")
+	}
+
+	all, err := fuzzer.LoadFindings(*findingsPath)
+	if err != nil {
+		return err
+	}
+	findings := make([]*fuzzer.Finding, 0, len(all))
+	for _, finding := range all {
+		if finding.Severity.AtLeast(threshold) {
+			findings = append(findings, finding)
+		}
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(findings)
+	}
+
+	// Most serious first, keeping the recorded order within a severity
+	counts := make(map[fuzzer.Severity]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tCONFIDENCE\tTYPE\tMETHOD\tURL\tPARAMETER")
+	for _, severity := range reportSeverities {
+		for _, f := range findings {
+			if f.Severity != severity {
+				continue
+			}
+			counts[severity]++
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Severity, f.Confidence, f.Type, f.Method, f.URL, f.Parameter)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d findings", len(findings))
+	for _, severity := range reportSeverities {
+		if counts[severity] > 0 {
+			fmt.Printf(", %d %s", counts[severity], severity)
+		}
+	}
+	fmt.Println()
+	printUnstable(filepath.Join(filepath.Dir(*findingsPath), outagesFile), findings)
+	return nil
+}
+
+// printUnstable lists the findings first reported while the target was
+// unstable, from the outages saved next to the findings, if any
+func printUnstable(outagesPath string, findings []*fuzzer.Finding) {
+	outages, err := fuzzer.LoadOutages(outagesPath)
+	if err != nil {
+		return // No outages were recorded
+	}
+	var unstable []*fuzzer.Finding
+	for _, f := range findings {
+		for _, outage := range outages {
+			if outage.Covers(f.Timestamp) {
+				unstable = append(unstable, f)
+				break
+			}
+		}
+	}
+
+	fmt.Printf("\nThe target was unstable and fuzzing paused:\n")
+	for _, outage := range outages {
+		end := "end of run"
+		if !outage.End.IsZero() {
+			end = outage.End.Format(time.TimeOnly)
+		}
+		fmt.Printf("  %s - %s: %s\n", outage.Start.Format(time.TimeOnly), end, outage.Reason)
+	}
+	if len(unstable) == 0 {
+		return
+	}
+	fmt.Printf("%d findings were first reported then and should be verified again:\n", len(unstable))
+	for _, f := range unstable {
+		fmt.Printf("  %s %s %s\n", f.Type, f.Method, f.URL)
+	}
+}
@@ -0,0 +1,44 @@
+// Package crawl exposes the web crawler and the form detectors used for
+// attack-surface discovery.
+package crawl
+
+import (
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// Crawler implements web application crawling
+type Crawler = fuzzer.WebCrawler
+
+// WebCrawler is the original name of Crawler.
+//
+// Deprecated: Use Crawler instead.
+type WebCrawler = fuzzer.WebCrawler
+
+// Form is an HTML form: where it submits, how, and its fields
+type Form = fuzzer.Form
+
+// FormField represents an HTML form field
+type FormField = fuzzer.FormField
+
+// JSFormDetector implements detection of JavaScript-rendered forms
+type JSFormDetector = fuzzer.JSFormDetector
+
+// New creates a new crawler rooted at baseURL, visiting at most maxPages
+// pages (0 = no limit)
+func New(baseURL string, maxPages int, concurrent bool, config *fuzzer.Config) (*Crawler, error) {
+	return fuzzer.NewWebCrawler(baseURL, maxPages, concurrent, config)
+}
+
+// NewWebCrawler creates a new crawler rooted at baseURL.
+//
+// Deprecated: Use New instead.
+func NewWebCrawler(baseURL string, maxPages int, concurrent bool, config *fuzzer.Config) (*Crawler, error) {
+	return New(baseURL, maxPages, concurrent, config)
+}
+
+// NewJSFormDetector creates a new JavaScript form detector
+func NewJSFormDetector(url string, timeout time.Duration) *JSFormDetector {
+	return fuzzer.NewJSFormDetector(url, timeout)
+}
@@ -0,0 +1,47 @@
+// Package detect exposes the passive detectors: API endpoint detection and
+// security protection (WAF, rate limit, challenge page) detection.
+package detect
+
+import (
+	"net/http"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// APIEndpoint represents a detected API endpoint
+type APIEndpoint = fuzzer.APIEndpoint
+
+// ParamType represents the type and constraints of an API parameter
+type ParamType = fuzzer.ParamType
+
+// APIDetector implements detection of API endpoints
+type APIDetector = fuzzer.APIDetector
+
+// SecurityBlock represents a detected security protection
+type SecurityBlock = fuzzer.SecurityBlock
+
+// Detector is a custom check run on every fuzzed exchange
+type Detector = fuzzer.Detector
+
+// RegisterDetector adds a detector to every Config created afterwards, e.g.
+// from the init function of a plugin
+func RegisterDetector(d Detector) {
+	fuzzer.RegisterDetector(d)
+}
+
+// NewAPIDetector creates a new API detector
+func NewAPIDetector(config *fuzzer.Config) *APIDetector {
+	return fuzzer.NewAPIDetector(config)
+}
+
+// SecurityProtection checks if a response indicates security protection
+func SecurityProtection(resp *http.Response) (*SecurityBlock, error) {
+	return fuzzer.DetectSecurityProtection(resp)
+}
+
+// DetectSecurityProtection checks if a response indicates security protection.
+//
+// Deprecated: Use SecurityProtection instead.
+func DetectSecurityProtection(resp *http.Response) (*SecurityBlock, error) {
+	return SecurityProtection(resp)
+}
@@ -0,0 +1,566 @@
+// Package fuzz is the public entry point to the fuzzing engine. It exposes the
+// configuration, the fuzzer implementations and the grammar machinery that
+// drive them.
+package fuzz
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// Version is the semantic version of this module
+const Version = fuzzer.Version
+
+// Config holds the fuzzer configuration
+type Config = fuzzer.Config
+
+// Runner defines the common interface for all fuzzer implementations
+type Runner = fuzzer.Runner
+
+// FuzzerInterface is the original name of Runner.
+//
+// Deprecated: Use Runner instead.
+type FuzzerInterface = fuzzer.Runner
+
+// Result represents a fuzzing test result
+type Result = fuzzer.Result
+
+// ResultFilter decides which results are reported from match/filter rules
+type ResultFilter = fuzzer.ResultFilter
+
+// Grammar represents a context-free grammar
+type Grammar = fuzzer.Grammar
+
+// GrammarLearner induces grammars for fields from observed valid values
+type GrammarLearner = fuzzer.GrammarLearner
+
+// DerivationTree represents a node in the grammar derivation tree
+type DerivationTree = fuzzer.DerivationTree
+
+// Coverage tracks which parts of the application have been tested
+type Coverage = fuzzer.Coverage
+
+// GrammarCoverage tracks coverage of grammar expansions
+type GrammarCoverage = fuzzer.GrammarCoverage
+
+// Fuzzer implementations
+type (
+	CoverageFuzzer           = fuzzer.CoverageFuzzer
+	GrammarCoverageFuzzer    = fuzzer.GrammarCoverageFuzzer
+	SystematicCoverageFuzzer = fuzzer.SystematicCoverageFuzzer
+	MutationFuzzer           = fuzzer.MutationFuzzer
+	MutationCoverageFuzzer   = fuzzer.MutationCoverageFuzzer
+	WebFormFuzzer            = fuzzer.WebFormFuzzer
+	SQLInjectionFuzzer       = fuzzer.SQLInjectionFuzzer
+	APIFuzzer                = fuzzer.APIFuzzer
+)
+
+// Orchestrator crawls a target and fuzzes every form, API endpoint and
+// parameterized URL it finds
+type Orchestrator = fuzzer.Orchestrator
+
+// Target is an attack surface found while crawling
+type Target = fuzzer.Target
+
+// SiteMap is the machine-readable result of a discovery crawl
+type SiteMap = fuzzer.SiteMap
+
+// OAuth2Config describes how a TokenSource obtains access tokens
+type OAuth2Config = fuzzer.OAuth2Config
+
+// TokenSource fetches OAuth2 access tokens for Config.OAuth2 and refreshes
+// them before they expire
+type TokenSource = fuzzer.TokenSource
+
+// Identity is a user whose access is compared with the configured
+// credentials
+type Identity = fuzzer.Identity
+
+// AccessTester finds broken access control by replaying crawled requests as
+// other identities and without credentials
+type AccessTester = fuzzer.AccessTester
+
+// EnumerationTester finds resources reachable by guessing neighbouring
+// numeric or UUID identifiers
+type EnumerationTester = fuzzer.EnumerationTester
+
+// BackupTester finds backup copies of files and archives of directories
+type BackupTester = fuzzer.BackupTester
+
+// VCSTester finds Git, Subversion and Mercurial metadata served by a site
+type VCSTester = fuzzer.VCSTester
+
+// AdminTester finds known admin panels and debug endpoints
+type AdminTester = fuzzer.AdminTester
+
+// LeakRule recognizes one kind of secret or personal data in a response
+type LeakRule = fuzzer.LeakRule
+
+// LeakScanner reports secrets and personal data found in response bodies
+type LeakScanner = fuzzer.LeakScanner
+
+// Technology is one component of the target's stack
+type Technology = fuzzer.Technology
+
+// TechStack is what fingerprinting learned about the target, and picks the
+// payloads worth sending
+type TechStack = fuzzer.TechStack
+
+// RateLimiter paces the requests sent to one target
+type RateLimiter = fuzzer.RateLimiter
+
+// Politeness spaces and caps the requests in flight to each host
+type Politeness = fuzzer.Politeness
+
+// Impersonation sends requests with a browser's User-Agent and headers
+type Impersonation = fuzzer.Impersonation
+
+// RetryPolicy retries requests that fail transiently, with exponential backoff
+type RetryPolicy = fuzzer.RetryPolicy
+
+// CircuitBreaker pauses fuzzing while the target is unstable
+type CircuitBreaker = fuzzer.CircuitBreaker
+
+// Differ resends fuzzed requests to a second deployment and reports differences
+type Differ = fuzzer.Differ
+
+// Mutator is a custom mutation strategy the mutation and coverage fuzzers
+// choose next to their built-in ones
+type Mutator = fuzzer.Mutator
+
+// Hooks are called before each request is sent, on each fuzzed response and
+// on each new finding
+type Hooks = fuzzer.Hooks
+
+// Signer signs requests just before they are sent
+type Signer = fuzzer.Signer
+
+// AWSCredentials are the keys requests are signed with for AWS SigV4
+type AWSCredentials = fuzzer.AWSCredentials
+
+// AWSSigner signs requests with AWS Signature Version 4
+type AWSSigner = fuzzer.AWSSigner
+
+// HMACSigner sets a header to an HMAC of the request body
+type HMACSigner = fuzzer.HMACSigner
+
+// HookScript runs an external script as hooks, exchanging JSON lines
+type HookScript = fuzzer.HookScript
+
+// Traffic records the exchanges with the target for export to Burp or ZAP
+type Traffic = fuzzer.Traffic
+
+// ReplayResult is what replaying one saved finding or corpus input showed
+type ReplayResult = fuzzer.ReplayResult
+
+// RetryError is returned when a request still failed after all its attempts
+type RetryError = fuzzer.RetryError
+
+// TargetSummary records how one target of a multi-target run went
+type TargetSummary = fuzzer.TargetSummary
+
+// Technology categories
+const (
+	TechWebServer  = fuzzer.TechWebServer
+	TechLanguage   = fuzzer.TechLanguage
+	TechFramework  = fuzzer.TechFramework
+	TechCMS        = fuzzer.TechCMS
+	TechJavaScript = fuzzer.TechJavaScript
+	TechCDN        = fuzzer.TechCDN
+	TechOS         = fuzzer.TechOS
+)
+
+// Target kinds
+const (
+	TargetForm   = fuzzer.TargetForm
+	TargetAPI    = fuzzer.TargetAPI
+	TargetParams = fuzzer.TargetParams
+)
+
+// Session modes
+const (
+	SessionShared    = fuzzer.SessionShared
+	SessionPerWorker = fuzzer.SessionPerWorker
+)
+
+// Power schedules
+const (
+	ScheduleExploit = fuzzer.ScheduleExploit
+	ScheduleExplore = fuzzer.ScheduleExplore
+	ScheduleFast    = fuzzer.ScheduleFast
+	ScheduleDecay   = fuzzer.ScheduleDecay
+)
+
+// Traffic export formats
+const (
+	ExportBurp = fuzzer.ExportBurp
+	ExportHAR  = fuzzer.ExportHAR
+)
+
+// Replay outcomes
+const (
+	ReplayReproduced = fuzzer.ReplayReproduced
+	ReplayChanged    = fuzzer.ReplayChanged
+	ReplaySent       = fuzzer.ReplaySent
+	ReplayFailed     = fuzzer.ReplayFailed
+	ReplaySkipped    = fuzzer.ReplaySkipped
+)
+
+// FullAuto runs crawling, API, form and parameter fuzzing and injection
+// probes in stages with per-stage time budgets
+type FullAuto = fuzzer.FullAuto
+
+// FullAutoReport is the combined report of a full-auto run
+type FullAutoReport = fuzzer.FullAutoReport
+
+// StageResult records how one full-auto stage went
+type StageResult = fuzzer.StageResult
+
+// APISpecFuzzer fuzzes every operation declared in an OpenAPI or Swagger document
+type APISpecFuzzer = fuzzer.APISpecFuzzer
+
+// APIEndpoint describes an API operation and its parameters
+type APIEndpoint = fuzzer.APIEndpoint
+
+// InventoryEndpoint is a crawled page and the query parameters seen on it
+type InventoryEndpoint = fuzzer.InventoryEndpoint
+
+// InventoryParam is a query parameter seen while crawling, with its inferred type
+type InventoryParam = fuzzer.InventoryParam
+
+// Full-auto stages, in the order they run
+const (
+	StageCrawl     = fuzzer.StageCrawl
+	StageAccess    = fuzzer.StageAccess
+	StageIDs       = fuzzer.StageIDs
+	StageBackups   = fuzzer.StageBackups
+	StageVCS       = fuzzer.StageVCS
+	StageAdmin     = fuzzer.StageAdmin
+	StageAPI       = fuzzer.StageAPI
+	StageForms     = fuzzer.StageForms
+	StageParams    = fuzzer.StageParams
+	StageInjection = fuzzer.StageInjection
+)
+
+// DefaultConfig returns a Config with sensible defaults
+func DefaultConfig(targetURL string) *Config {
+	return fuzzer.DefaultConfig(targetURL)
+}
+
+// New creates the fuzzer selected by the configuration
+func New(config *Config) (Runner, error) {
+	return fuzzer.New(config)
+}
+
+// ParseResultFilter builds a ResultFilter from kind:value match and filter rules
+func ParseResultFilter(match, filter []string) (*ResultFilter, error) {
+	return fuzzer.ParseResultFilter(match, filter)
+}
+
+// NewGrammarLearner creates an empty GrammarLearner
+func NewGrammarLearner() *GrammarLearner {
+	return fuzzer.NewGrammarLearner()
+}
+
+// NewLeakScanner creates a leak scanner with the default rules
+func NewLeakScanner() *LeakScanner {
+	return fuzzer.NewLeakScanner()
+}
+
+// DefaultLeakRules returns the rules a LeakScanner starts with
+func DefaultLeakRules() []*LeakRule {
+	return fuzzer.DefaultLeakRules()
+}
+
+// FingerprintTarget identifies the technologies the target page reveals
+func FingerprintTarget(config *Config) (*TechStack, error) {
+	return fuzzer.FingerprintTarget(config)
+}
+
+// NewRateLimiter creates a limiter allowing perSecond requests per second
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	return fuzzer.NewRateLimiter(perSecond)
+}
+
+// NewPoliteness creates a policy starting requests to the same host at
+// least delay apart, with at most parallel in flight to it at once
+func NewPoliteness(delay time.Duration, parallel int) *Politeness {
+	return fuzzer.NewPoliteness(delay, parallel)
+}
+
+// NewImpersonation creates an impersonation of the named browser, or of
+// each in turn with "rotate", sending userAgents in turn when any are given
+func NewImpersonation(browser string, userAgents []string) (*Impersonation, error) {
+	return fuzzer.NewImpersonation(browser, userAgents)
+}
+
+// NewCircuitBreaker creates a breaker that probes healthURL while open
+func NewCircuitBreaker(healthURL string) *CircuitBreaker {
+	return fuzzer.NewCircuitBreaker(healthURL)
+}
+
+// NewDiffer creates a differ comparing the target with the deployment at
+// secondaryURL
+func NewDiffer(secondaryURL string) (*Differ, error) {
+	return fuzzer.NewDiffer(secondaryURL)
+}
+
+// NewRetryPolicy creates a policy retrying up to maxRetries times, waiting
+// backoff before the first retry
+func NewRetryPolicy(maxRetries int, backoff time.Duration) *RetryPolicy {
+	return fuzzer.NewRetryPolicy(maxRetries, backoff)
+}
+
+// LoadTargets reads target URLs for a multi-target run, one per line
+func LoadTargets(path string) ([]string, error) {
+	return fuzzer.LoadTargets(path)
+}
+
+// TargetConfig derives the configuration of one target of a multi-target run
+func TargetConfig(base *Config, index int, targetURL string) *Config {
+	return fuzzer.TargetConfig(base, index, targetURL)
+}
+
+// SummarizeTarget records the outcome of a target's run
+func SummarizeTarget(config *Config, runErr error) TargetSummary {
+	return fuzzer.SummarizeTarget(config, runErr)
+}
+
+// SaveTargetSummaries writes the summaries of a multi-target run as JSON
+func SaveTargetSummaries(path string, summaries []TargetSummary) error {
+	return fuzzer.SaveTargetSummaries(path, summaries)
+}
+
+// NewCoverage creates a new Coverage tracker
+func NewCoverage() *Coverage {
+	return fuzzer.NewCoverage()
+}
+
+// NewGrammarCoverage creates a new grammar coverage tracker
+func NewGrammarCoverage(grammar Grammar) *GrammarCoverage {
+	return fuzzer.NewGrammarCoverage(grammar)
+}
+
+// NewDerivationTree creates a new derivation tree node
+func NewDerivationTree(symbol string) *DerivationTree {
+	return fuzzer.NewDerivationTree(symbol)
+}
+
+// NewCoverageFuzzer creates a new coverage-guided fuzzer
+func NewCoverageFuzzer(config *Config) (*CoverageFuzzer, error) {
+	return fuzzer.NewCoverageFuzzer(config)
+}
+
+// NewGrammarCoverageFuzzer creates a new grammar-coverage-guided fuzzer
+func NewGrammarCoverageFuzzer(config *Config) (*GrammarCoverageFuzzer, error) {
+	return fuzzer.NewGrammarCoverageFuzzer(config)
+}
+
+// NewSystematicCoverageFuzzer creates a new systematic coverage-guided fuzzer
+func NewSystematicCoverageFuzzer(config *Config) (*SystematicCoverageFuzzer, error) {
+	return fuzzer.NewSystematicCoverageFuzzer(config)
+}
+
+// NewMutationFuzzer creates a new mutation-based fuzzer
+func NewMutationFuzzer(config *Config) (*MutationFuzzer, error) {
+	return fuzzer.NewMutationFuzzer(config)
+}
+
+// NewMutationCoverageFuzzer creates a new coverage-guided mutation fuzzer
+func NewMutationCoverageFuzzer(config *Config) (*MutationCoverageFuzzer, error) {
+	return fuzzer.NewMutationCoverageFuzzer(config)
+}
+
+// NewOrchestrator creates an orchestrator for the configured target
+func NewOrchestrator(config *Config) (*Orchestrator, error) {
+	return fuzzer.NewOrchestrator(config)
+}
+
+// NewFullAuto creates a full-auto run for the configured target
+func NewFullAuto(config *Config) (*FullAuto, error) {
+	return fuzzer.NewFullAuto(config)
+}
+
+// ParseStageBudgets parses stage=duration overrides of the full-auto stage budgets
+func ParseStageBudgets(specs []string) (map[string]time.Duration, error) {
+	return fuzzer.ParseStageBudgets(specs)
+}
+
+// NewAPISpecFuzzer creates a fuzzer for the operations of config.APISpec
+func NewAPISpecFuzzer(config *Config) (*APISpecFuzzer, error) {
+	return fuzzer.NewAPISpecFuzzer(config)
+}
+
+// LoadAPISpec reads the operations of an OpenAPI or Swagger document. A
+// non-empty baseURL replaces the scheme and host the document names.
+func LoadAPISpec(path, baseURL string) ([]*APIEndpoint, error) {
+	return fuzzer.LoadAPISpec(path, baseURL)
+}
+
+// LoadMangleRules resolves comma-separated built-in rule set names or rule
+// files into hashcat-style wordlist mangling rules for Config.WordlistRules
+func LoadMangleRules(spec string) ([]string, error) {
+	return fuzzer.LoadMangleRules(spec)
+}
+
+// LoadCorpus reads a corpus file holding one input per line
+func LoadCorpus(path string) ([]string, error) {
+	return fuzzer.LoadCorpus(path)
+}
+
+// SaveCorpus writes a corpus file holding one input per line
+func SaveCorpus(path string, inputs []string) error {
+	return fuzzer.SaveCorpus(path, inputs)
+}
+
+// MinimizeCorpus replays the inputs against the target and keeps those that
+// reach new coverage
+func MinimizeCorpus(config *Config, inputs []string) ([]string, error) {
+	return fuzzer.MinimizeCorpus(config, inputs)
+}
+
+// RegisterMutator adds a mutator to every Config created afterwards
+func RegisterMutator(m Mutator) {
+	fuzzer.RegisterMutator(m)
+}
+
+// RegisterHooks adds hooks to every Config created afterwards
+func RegisterHooks(h Hooks) {
+	fuzzer.RegisterHooks(h)
+}
+
+// Hook events a HookScript can handle
+const (
+	HookRequest  = fuzzer.HookRequest
+	HookResponse = fuzzer.HookResponse
+	HookFinding  = fuzzer.HookFinding
+)
+
+// NewHookScript starts command to handle the given hook events
+func NewHookScript(command string, events []string) (*HookScript, error) {
+	return fuzzer.NewHookScript(command, events)
+}
+
+// NewAWSSigner creates an AWS Signature Version 4 signer
+func NewAWSSigner(credentials AWSCredentials, region, service string) (*AWSSigner, error) {
+	return fuzzer.NewAWSSigner(credentials, region, service)
+}
+
+// NewHMACSigner creates a signer setting header to the HMAC of the body
+func NewHMACSigner(header string, secret []byte, hash, encoding, prefix string) (*HMACSigner, error) {
+	return fuzzer.NewHMACSigner(header, secret, hash, encoding, prefix)
+}
+
+// ParseSigner parses an aws:<region>:<service> or hmac:<header> signer spec
+func ParseSigner(spec string, credentials AWSCredentials, secret []byte) (Signer, error) {
+	return fuzzer.ParseSigner(spec, credentials, secret)
+}
+
+// LoadPlugin opens a Go plugin (.so) whose init functions register detectors,
+// mutators and hooks
+func LoadPlugin(path string) error {
+	return fuzzer.LoadPlugin(path)
+}
+
+// NewTraffic creates a traffic recorder keeping at most max exchanges
+// (0 = default)
+func NewTraffic(max int) *Traffic {
+	return fuzzer.NewTraffic(max)
+}
+
+// ExportFile returns the file name an export format is written to
+func ExportFile(format string) string {
+	return fuzzer.ExportFile(format)
+}
+
+// ReplayFindings re-sends the captured requests of findings, e.g. loaded with
+// report.LoadFindings, and compares the responses with the captured ones
+func ReplayFindings(config *Config, findings []*fuzzer.Finding) ([]ReplayResult, error) {
+	return fuzzer.ReplayFindings(config, findings)
+}
+
+// ReplayCorpus sends corpus inputs to the target again
+func ReplayCorpus(config *Config, inputs []string) ([]ReplayResult, error) {
+	return fuzzer.ReplayCorpus(config, inputs)
+}
+
+// ParseHeaders parses "Name: value" lines for Config.Headers
+func ParseHeaders(lines []string) (map[string]string, error) {
+	return fuzzer.ParseHeaders(lines)
+}
+
+// ParseResolve parses "host:ip" overrides for Config.Resolve
+func ParseResolve(specs []string) (map[string]string, error) {
+	return fuzzer.ParseResolve(specs)
+}
+
+// TLSConfig returns the client TLS configuration the fuzzers use, nil when
+// the TLS settings are left at their defaults
+func TLSConfig(config *Config) (*tls.Config, error) {
+	return fuzzer.TLSConfig(config)
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2" for Config.TLSMinVersion
+func ParseTLSVersion(version string) (uint16, error) {
+	return fuzzer.ParseTLSVersion(version)
+}
+
+// TargetServerNames returns the Config.ServerNames sending serverName to the
+// hosts of targets, or a virtual host's name to IP-literal targets
+func TargetServerNames(targets []string, serverName, vhost string) (map[string]string, error) {
+	return fuzzer.TargetServerNames(targets, serverName, vhost)
+}
+
+// ParseCookies parses "name=value; other=value" lists for Config.Cookies
+func ParseCookies(specs []string) ([]*http.Cookie, error) {
+	return fuzzer.ParseCookies(specs)
+}
+
+// ParseIdentities parses "name:Header: value" specs for Config.Identities
+func ParseIdentities(specs []string) ([]*Identity, error) {
+	return fuzzer.ParseIdentities(specs)
+}
+
+// NewAccessTester creates an access tester for the configured identities
+func NewAccessTester(config *Config) (*AccessTester, error) {
+	return fuzzer.NewAccessTester(config)
+}
+
+// NewEnumerationTester creates an identifier enumeration tester
+func NewEnumerationTester(config *Config) (*EnumerationTester, error) {
+	return fuzzer.NewEnumerationTester(config)
+}
+
+// NewBackupTester creates a backup file tester
+func NewBackupTester(config *Config) (*BackupTester, error) {
+	return fuzzer.NewBackupTester(config)
+}
+
+// NewVCSTester creates a version control metadata tester
+func NewVCSTester(config *Config) (*VCSTester, error) {
+	return fuzzer.NewVCSTester(config)
+}
+
+// NewAdminTester creates an admin panel and debug endpoint tester
+func NewAdminTester(config *Config) (*AdminTester, error) {
+	return fuzzer.NewAdminTester(config)
+}
+
+// NewTokenSource fetches the first access token and returns a source that
+// keeps it fresh
+func NewTokenSource(oauth OAuth2Config, config *Config) (*TokenSource, error) {
+	return fuzzer.NewTokenSource(oauth, config)
+}
+
+// NewWebFormFuzzer creates a new web form fuzzer
+func NewWebFormFuzzer(formURL string) (*WebFormFuzzer, error) {
+	return fuzzer.NewWebFormFuzzer(formURL)
+}
+
+// NewSQLInjectionFuzzer creates a new SQL injection fuzzer
+func NewSQLInjectionFuzzer(targetURL string, payload string) (*SQLInjectionFuzzer, error) {
+	return fuzzer.NewSQLInjectionFuzzer(targetURL, payload)
+}
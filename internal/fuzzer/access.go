@@ -0,0 +1,243 @@
+package fuzzer
+
+import (
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// anonymousIdentity names the principal that sends no credentials
+const anonymousIdentity = "anonymous"
+
+// Identity is a user whose access is compared with the primary identity,
+// the one given by the configured headers, cookies and OAuth2 token
+type Identity struct {
+	Name    string
+	Headers map[string]string // Credentials sent instead of the primary identity's, e.g. a Cookie or Authorization header
+}
+
+// ParseIdentities parses "name:Header: value" specs into identities. Specs
+// sharing a name add headers to the same identity, in first-seen order.
+func ParseIdentities(specs []string) ([]*Identity, error) {
+	var identities []*Identity
+	byName := make(map[string]*Identity)
+	for _, spec := range specs {
+		name, header, ok := strings.Cut(spec, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid identity %q: expected name:Header: value", spec)
+		}
+		if name == anonymousIdentity {
+			return nil, fmt.Errorf("invalid identity %q: %s is always tested", spec, anonymousIdentity)
+		}
+		headers, err := ParseHeaders([]string{header})
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity %q: %v", spec, err)
+		}
+
+		identity := byName[name]
+		if identity == nil {
+			identity = &Identity{Name: name, Headers: make(map[string]string)}
+			byName[name] = identity
+			identities = append(identities, identity)
+		}
+		for key, value := range headers {
+			identity.Headers[key] = value
+		}
+	}
+	return identities, nil
+}
+
+// principal is an identity replaying the primary identity's requests
+type principal struct {
+	name   string
+	client *http.Client
+}
+
+// accessResponse is what one principal got back for a URL
+type accessResponse struct {
+	req    *http.Request
+	resp   *http.Response
+	body   []byte
+	status int
+}
+
+// AccessTester detects broken access control by replaying the GET requests
+// of a crawl, made as the primary identity, as every other identity and with
+// no credentials at all. A principal that gets the primary identity's data
+// back is reported, provided some other principal is denied the same URL:
+// when everyone sees the same response the resource is public.
+type AccessTester struct {
+	config     *Config
+	primary    *http.Client
+	principals []principal
+	logger     *slog.Logger
+}
+
+// NewAccessTester creates an access tester for the configured identities
+func NewAccessTester(config *Config) (*AccessTester, error) {
+	if len(config.Identities) == 0 {
+		return nil, fmt.Errorf("access testing needs at least one identity besides the primary one")
+	}
+	primary, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &AccessTester{
+		config:  config,
+		primary: primary,
+		logger:  logging.For("access"),
+	}
+	identities := append([]*Identity{{Name: anonymousIdentity}}, config.Identities...)
+	for _, identity := range identities {
+		// The identity's credentials replace the primary identity's
+		other := *config
+		other.Headers = identity.Headers
+		other.Cookies = nil
+		other.OAuth2 = nil
+		client, err := newHTTPClient(&other, false)
+		if err != nil {
+			return nil, err
+		}
+		t.principals = append(t.principals, principal{name: identity.Name, client: client})
+	}
+	return t, nil
+}
+
+// Run crawls the target as the primary identity and tests every page and
+// GET API endpoint found
+func (t *AccessTester) Run() error {
+	orchestrator, err := NewOrchestrator(t.config)
+	if err != nil {
+		return err
+	}
+	crawler, err := orchestrator.crawl(0)
+	if err != nil {
+		return err
+	}
+	urls := accessURLs(crawler.GetVisitedURLs(), crawler.GetAPIEndpoints())
+	tested := t.Test(urls, t.config.Deadline)
+	t.logger.Info("access testing complete", "urls", tested, "findings", t.config.Findings.Count())
+	return nil
+}
+
+// accessURLs returns the crawled pages and GET API endpoints, sorted and
+// without duplicates. Other methods are left out as replaying them could
+// change data.
+func accessURLs(visited []string, endpoints []*APIEndpoint) []string {
+	seen := make(map[string]bool)
+	for _, pageURL := range visited {
+		seen[pageURL] = true
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.Method == "" || endpoint.Method == http.MethodGet {
+			seen[endpoint.URL] = true
+		}
+	}
+	urls := make([]string, 0, len(seen))
+	for u := range seen {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Test replays each URL as every principal and reports those that get the
+// primary identity's response. It stops once the deadline passes, if one is
+// set, and returns the number of URLs tested.
+func (t *AccessTester) Test(urls []string, deadline time.Time) int {
+	for i, targetURL := range urls {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			t.logger.Warn("deadline reached, skipping remaining URLs", "skipped", len(urls)-i)
+			return i
+		}
+		t.test(targetURL)
+	}
+	return len(urls)
+}
+
+// test compares the principals' responses for one URL with the primary
+// identity's
+func (t *AccessTester) test(targetURL string) {
+	reference, err := t.fetch(t.primary, targetURL)
+	if err != nil {
+		t.logger.Debug("request failed", "url", targetURL, "identity", "primary", "error", err)
+		return
+	}
+	// Only successful responses carry data worth protecting
+	if reference.status < 200 || reference.status >= 300 || len(reference.body) == 0 {
+		return
+	}
+
+	var leaked []string
+	var denied *accessResponse
+	deniedTo := ""
+	responses := make(map[string]*accessResponse)
+	for _, p := range t.principals {
+		response, err := t.fetch(p.client, targetURL)
+		if err != nil {
+			t.logger.Debug("request failed", "url", targetURL, "identity", p.name, "error", err)
+			return
+		}
+		responses[p.name] = response
+		if sameAccessResponse(reference, response) {
+			leaked = append(leaked, p.name)
+		} else if denied == nil {
+			denied, deniedTo = response, p.name
+		}
+	}
+	if denied == nil || len(leaked) == 0 {
+		return
+	}
+
+	for _, name := range leaked {
+		findingType := "broken-object-level-authorization"
+		if name == anonymousIdentity {
+			findingType = "missing-authentication"
+		}
+		response := responses[name]
+		finding := &Finding{
+			Type:       findingType,
+			Severity:   SeverityHigh,
+			Confidence: ConfidenceFirm,
+			URL:        targetURL,
+			Method:     http.MethodGet,
+			Evidence: fmt.Sprintf("%s gets the primary identity's response (HTTP %d, %d bytes) while %s gets HTTP %d",
+				name, response.status, len(response.body), deniedTo, denied.status),
+			Timestamp: time.Now(),
+		}
+		captureExchange(finding, response.req, nil, response.resp, response.body)
+		if t.config.Findings.Add(finding) {
+			t.logger.Warn("broken access control", "url", targetURL, "identity", name, "denied", deniedTo)
+		}
+	}
+}
+
+// fetch sends a GET request for targetURL with the client
+func (t *AccessTester) fetch(client *http.Client, targetURL string) (*accessResponse, error) {
+	response, err := fetchProbe(client, t.config, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &accessResponse{req: response.req, resp: response.resp, body: response.body, status: response.resp.StatusCode}, nil
+}
+
+// sameAccessResponse reports whether a response carries the same data as
+// the reference: the same status and a body that is identical once volatile
+// content is stripped, or near-identical by simhash
+func sameAccessResponse(reference, response *accessResponse) bool {
+	if response.status != reference.status || len(response.body) == 0 {
+		return false
+	}
+	if normalizeBody(response.body) == normalizeBody(reference.body) {
+		return true
+	}
+	return bits.OnesCount64(simhash(response.body)^simhash(reference.body)) <= simhashDistance
+}
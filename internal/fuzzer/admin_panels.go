@@ -0,0 +1,394 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Kinds of surface an adminCheck finds, which are the finding types
+const (
+	surfaceAdmin = "admin-interface"
+	surfaceDebug = "debug-endpoint"
+)
+
+// adminCheck recognizes a known admin or debug surface at a path below an
+// application root. The proof is matched against the body, or against a
+// header when proofHeader is set. The version is the first group of the
+// version pattern in the body, or the value of versionHeader. A surface
+// too costly to request is found in the Actuator index instead, under the
+// link named indexLink.
+type adminCheck struct {
+	path          string // Relative to the application root
+	product       string
+	kind          string
+	status        int // Status the surface answers with (0 = 200)
+	indexLink     string
+	proof         *regexp.Regexp
+	proofHeader   string
+	version       *regexp.Regexp
+	versionHeader string
+	severity      Severity
+	exposes       string // What the surface gives whoever reaches it
+}
+
+// Markers several checks share
+var (
+	phpinfoProof        = regexp.MustCompile(`(?i)<title>phpinfo\(\)`)
+	phpinfoVersion      = regexp.MustCompile(`PHP Version ([\d.]+)`)
+	phpMyAdminProof     = regexp.MustCompile(`(?i)<title>[^<]*phpMyAdmin|name="pma_username"`)
+	phpMyAdminVersion   = regexp.MustCompile(`[?&](?:amp;)?v=(\d+\.\d+\.\d+)`)
+	jenkinsConsoleProof = regexp.MustCompile(`(?s)Script Console.*name="script"`)
+	jenkinsAPIProof     = regexp.MustCompile(`"_class"\s*:\s*"hudson\.`)
+	grafanaVersion      = regexp.MustCompile(`"buildInfo"\s*:\s*\{[^}]*?"version"\s*:\s*"([^"]+)"`)
+	kibanaProof         = regexp.MustCompile(`kbn-injected-metadata|__kbnBootstrap__`)
+	kibanaVersion       = regexp.MustCompile(`"version"\s*:\s*"(\d+\.\d+\.\d+)"`)
+)
+
+// adminChecks are tried at every application root, in order. Paths several
+// checks share are requested once.
+var adminChecks = []adminCheck{
+	// Spring Boot Actuator
+	{path: "actuator", product: "Spring Boot Actuator", kind: surfaceDebug,
+		proof: regexp.MustCompile(`"_links"\s*:\s*\{\s*"self"`), severity: SeverityMedium,
+		exposes: "an index of the management endpoints"},
+	{path: "actuator/env", product: "Spring Boot Actuator", kind: surfaceDebug,
+		proof: regexp.MustCompile(`"propertySources"\s*:`), severity: SeverityHigh,
+		exposes: "the environment and configuration properties, credentials among them"},
+	// Requesting the heap dump makes the server write one, so it is looked
+	// up in the index
+	{path: "actuator/heapdump", product: "Spring Boot Actuator", kind: surfaceDebug,
+		indexLink: "heapdump", severity: SeverityCritical,
+		exposes: "a heap dump holding the secrets in the application's memory"},
+	{path: "actuator/threaddump", product: "Spring Boot Actuator", kind: surfaceDebug,
+		proof: regexp.MustCompile(`"threads"\s*:\s*\[`), severity: SeverityMedium,
+		exposes: "a thread dump"},
+	{path: "actuator/info", product: "Spring Boot Actuator", kind: surfaceDebug,
+		proof:   regexp.MustCompile(`"build"\s*:\s*\{`),
+		version: regexp.MustCompile(`"build"\s*:\s*\{[^}]*?"version"\s*:\s*"([^"]+)"`), severity: SeverityLow,
+		exposes: "build information"},
+	{path: "actuator/gateway/routes", product: "Spring Cloud Gateway", kind: surfaceDebug,
+		proof: regexp.MustCompile(`"route_id"\s*:`), severity: SeverityHigh,
+		exposes: "the gateway routes, which CVE-2022-22947 lets callers add code-running routes to"},
+	{path: "env", product: "Spring Boot Actuator", kind: surfaceDebug,
+		proof: regexp.MustCompile(`"systemProperties"\s*:`), severity: SeverityHigh,
+		exposes: "the environment and system properties, credentials among them"},
+
+	// Go
+	{path: "debug/pprof/", product: "Go pprof", kind: surfaceDebug,
+		proof: regexp.MustCompile(`Types of profiles available|/debug/pprof/goroutine`), severity: SeverityHigh,
+		exposes: "profiles of the running process, with its command line, heap and goroutine stacks"},
+	{path: "debug/vars", product: "Go expvar", kind: surfaceDebug,
+		proof: regexp.MustCompile(`"memstats"\s*:\s*\{`), severity: SeverityMedium,
+		exposes: "the process command line and memory statistics"},
+
+	// Framework debuggers and profilers
+	{path: "console", product: "Werkzeug debugger", kind: surfaceDebug,
+		proof: regexp.MustCompile(`Werkzeug Debugger|__debugger__`), versionHeader: "Server", severity: SeverityCritical,
+		exposes: "an interactive Python console, unless it asks for the debugger PIN"},
+	{path: "_profiler/", product: "Symfony profiler", kind: surfaceDebug,
+		proof: regexp.MustCompile(`Symfony Profiler|sf-toolbar`), severity: SeverityHigh,
+		exposes: "recorded requests with their headers, sessions and configuration"},
+	{path: "telescope", product: "Laravel Telescope", kind: surfaceDebug,
+		proof: regexp.MustCompile(`(?i)<title>[^<]*Telescope|window\.Telescope`), severity: SeverityHigh,
+		exposes: "recorded requests, queries, jobs and exceptions"},
+	{path: "phpinfo.php", product: "PHP", kind: surfaceDebug,
+		proof: phpinfoProof, version: phpinfoVersion, severity: SeverityMedium,
+		exposes: "phpinfo() output with the PHP configuration and environment"},
+	{path: "info.php", product: "PHP", kind: surfaceDebug,
+		proof: phpinfoProof, version: phpinfoVersion, severity: SeverityMedium,
+		exposes: "phpinfo() output with the PHP configuration and environment"},
+
+	// Database administration
+	{path: "phpmyadmin/", product: "phpMyAdmin", kind: surfaceAdmin,
+		proof: phpMyAdminProof, version: phpMyAdminVersion, severity: SeverityHigh,
+		exposes: "database administration"},
+	{path: "phpMyAdmin/", product: "phpMyAdmin", kind: surfaceAdmin,
+		proof: phpMyAdminProof, version: phpMyAdminVersion, severity: SeverityHigh,
+		exposes: "database administration"},
+	{path: "pma/", product: "phpMyAdmin", kind: surfaceAdmin,
+		proof: phpMyAdminProof, version: phpMyAdminVersion, severity: SeverityHigh,
+		exposes: "database administration"},
+	{path: "adminer.php", product: "Adminer", kind: surfaceAdmin,
+		proof:   regexp.MustCompile(`(?i)<title>[^<]*Adminer|adminer\.org`),
+		version: regexp.MustCompile(`<span class="version">([\d.]+)`), severity: SeverityHigh,
+		exposes: "database administration"},
+
+	// Jenkins
+	{path: "script", product: "Jenkins", kind: surfaceAdmin,
+		proof: jenkinsConsoleProof, versionHeader: "X-Jenkins",
+		severity: SeverityCritical, exposes: "the Groovy script console, running code on the controller"},
+	{path: "jenkins/script", product: "Jenkins", kind: surfaceAdmin,
+		proof: jenkinsConsoleProof, versionHeader: "X-Jenkins",
+		severity: SeverityCritical, exposes: "the Groovy script console, running code on the controller"},
+	{path: "api/json", product: "Jenkins", kind: surfaceAdmin,
+		proof: jenkinsAPIProof, versionHeader: "X-Jenkins", severity: SeverityMedium,
+		exposes: "anonymous read access to jobs and builds"},
+	{path: "jenkins/api/json", product: "Jenkins", kind: surfaceAdmin,
+		proof: jenkinsAPIProof, versionHeader: "X-Jenkins", severity: SeverityMedium,
+		exposes: "anonymous read access to jobs and builds"},
+
+	// Grafana
+	{path: "login", product: "Grafana", kind: surfaceAdmin,
+		proof:   regexp.MustCompile(`grafanaBootData`),
+		version: grafanaVersion, severity: SeverityLow,
+		exposes: "a login panel"},
+	{path: "grafana/login", product: "Grafana", kind: surfaceAdmin,
+		proof:   regexp.MustCompile(`grafanaBootData`),
+		version: grafanaVersion, severity: SeverityLow,
+		exposes: "a login panel"},
+	{path: "api/health", product: "Grafana", kind: surfaceAdmin,
+		proof:   regexp.MustCompile(`"database"\s*:\s*"ok"`),
+		version: regexp.MustCompile(`"version"\s*:\s*"([^"]+)"`), severity: SeverityInfo,
+		exposes: "its health API"},
+	{path: "api/search", product: "Grafana", kind: surfaceAdmin,
+		proof: regexp.MustCompile(`"type"\s*:\s*"dash-(?:db|folder)"`), severity: SeverityMedium,
+		exposes: "dashboards readable without logging in"},
+
+	// Kibana
+	{path: "app/kibana", product: "Kibana", kind: surfaceAdmin,
+		proof: kibanaProof, version: kibanaVersion, versionHeader: "Kbn-Version",
+		severity: SeverityHigh, exposes: "Kibana without logging in, with the Elasticsearch data it reads"},
+	{path: "login", product: "Kibana", kind: surfaceAdmin,
+		proof: kibanaProof, version: kibanaVersion, versionHeader: "Kbn-Version",
+		severity: SeverityLow, exposes: "a login panel"},
+	{path: "api/status", product: "Kibana", kind: surfaceAdmin,
+		proof:   regexp.MustCompile(`"overall"\s*:\s*\{\s*"(?:level|state)"`),
+		version: regexp.MustCompile(`"number"\s*:\s*"([^"]+)"`), severity: SeverityMedium,
+		exposes: "its status API, with plugin and host details"},
+
+	// Tomcat
+	{path: "manager/html", product: "Tomcat Manager", kind: surfaceAdmin,
+		proof: regexp.MustCompile(`Tomcat Web Application Manager`), severity: SeverityCritical,
+		exposes: "application deployment without logging in"},
+	{path: "manager/html", product: "Tomcat Manager", kind: surfaceAdmin, status: http.StatusUnauthorized,
+		proof: regexp.MustCompile(`Tomcat Manager`), proofHeader: "WWW-Authenticate", severity: SeverityLow,
+		exposes: "a login often left with default credentials, deploying applications once in"},
+}
+
+// AdminTester looks for known admin panels and debug endpoints: Spring Boot
+// Actuator, Go pprof and expvar, framework debuggers and profilers,
+// phpinfo, phpMyAdmin and Adminer, the Jenkins script console, Grafana,
+// Kibana and the Tomcat manager. A surface only counts when the response
+// carries its own markers and a made-up path next to it does not, so a
+// wordlist hit on a catch-all page reports nothing. The version banner the
+// surface shows goes into the finding.
+type AdminTester struct {
+	config      *Config
+	client      *http.Client
+	host        string // Canonical host of the target; URLs elsewhere are skipped
+	rng         *rand.Rand
+	tested      map[string]bool
+	responses   map[string]*probeResponse // Answers by URL, nil for failed requests
+	madeUpNames map[string]string         // Names requested as baselines, by directory
+	logger      *slog.Logger
+}
+
+// NewAdminTester creates an admin panel and debug endpoint tester
+func NewAdminTester(config *Config) (*AdminTester, error) {
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+	return &AdminTester{
+		config:      config,
+		client:      client,
+		host:        canonicalHost(target),
+		rng:         newRand(runSeed(config), streamAdmin),
+		tested:      make(map[string]bool),
+		responses:   make(map[string]*probeResponse),
+		madeUpNames: make(map[string]string),
+		logger:      logging.For("admin"),
+	}, nil
+}
+
+// Run tests the root of the configured target's host and the application
+// directory of the target URL
+func (t *AdminTester) Run() error {
+	t.Test([]string{t.config.TargetURL}, t.config.Deadline)
+	return nil
+}
+
+// Test runs the checks at every application root of the URLs: the root of
+// the host and the first directory of each path, each once. It stops once
+// the deadline passes if one is set and returns the number of roots tested.
+func (t *AdminTester) Test(urls []string, deadline time.Time) int {
+	tested := 0
+	for _, targetURL := range urls {
+		for _, root := range t.roots(targetURL) {
+			tested++
+			for _, check := range adminChecks {
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					return tested
+				}
+				if finding := t.check(root, check); finding != nil && t.config.Findings.Add(finding) {
+					t.logger.Warn(finding.Type, "url", finding.URL, "product", check.product, "evidence", finding.Evidence)
+				}
+			}
+		}
+	}
+	return tested
+}
+
+// roots returns the host root of a URL and the first directory of its
+// path, where applications mounted below the root keep their surfaces,
+// unless tested already
+func (t *AdminTester) roots(targetURL string) []string {
+	u, err := url.Parse(targetURL)
+	if err != nil || u.Host == "" || canonicalHost(u) != t.host {
+		return nil
+	}
+	prefixes := []string{"/"}
+	if first, rest, ok := strings.Cut(strings.TrimPrefix(u.EscapedPath(), "/"), "/"); ok && first != "" && rest != "" {
+		prefixes = append(prefixes, "/"+first+"/")
+	}
+	var roots []string
+	for _, prefix := range prefixes {
+		if key := u.Host + prefix; !t.tested[key] {
+			t.tested[key] = true
+			roots = append(roots, u.Scheme+"://"+u.Host+prefix)
+		}
+	}
+	return roots
+}
+
+// check requests a check's path below root and returns a finding when the
+// surface is there
+func (t *AdminTester) check(root string, check adminCheck) *Finding {
+	if check.indexLink != "" {
+		return t.checkIndex(root, check)
+	}
+	target := root + check.path
+	response := t.fetch(target)
+	if response == nil || !check.matches(response) {
+		return nil
+	}
+
+	// A made-up name next to the path answered alike is a catch-all page
+	dir, _ := path.Split(check.path)
+	if baseline := t.fetch(root + dir + t.madeUp(root+dir)); baseline != nil && check.matches(baseline) {
+		t.logger.Debug("surface markers on a made-up path", "url", target, "product", check.product)
+		return nil
+	}
+
+	evidence := fmt.Sprintf("%s answered HTTP %d, exposing %s", check.product, response.resp.StatusCode, check.exposes)
+	if version := check.banner(response); version != "" {
+		evidence += "; version " + version
+	}
+	finding := &Finding{
+		Type:       check.kind,
+		Severity:   check.severity,
+		Confidence: ConfidenceFirm,
+		URL:        target,
+		Method:     http.MethodGet,
+		Parameter:  check.product,
+		Evidence:   evidence,
+	}
+	captureExchange(finding, response.req, nil, response.resp, response.body)
+	return finding
+}
+
+// actuatorIndex is the part of the Actuator index that lists the exposed
+// endpoints
+type actuatorIndex struct {
+	Links map[string]struct {
+		Href string `json:"href"`
+	} `json:"_links"`
+}
+
+// checkIndex returns a finding when the Actuator index below root links the
+// check's surface, without requesting the surface itself
+func (t *AdminTester) checkIndex(root string, check adminCheck) *Finding {
+	response := t.fetch(root + "actuator")
+	if response == nil || response.resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	var index actuatorIndex
+	if json.Unmarshal(response.body, &index) != nil {
+		return nil
+	}
+	link, ok := index.Links[check.indexLink]
+	if !ok || link.Href == "" {
+		return nil
+	}
+	finding := &Finding{
+		Type:       check.kind,
+		Severity:   check.severity,
+		Confidence: ConfidenceFirm,
+		URL:        root + check.path,
+		Method:     http.MethodGet,
+		Parameter:  check.product,
+		Evidence: fmt.Sprintf("%s index at %s links %s (%s), exposing %s; not requested, as that would make the server produce it",
+			check.product, response.req.URL, check.indexLink, link.Href, check.exposes),
+	}
+	captureExchange(finding, response.req, nil, response.resp, response.body)
+	return finding
+}
+
+// matches reports whether a response carries the check's status and proof
+func (c adminCheck) matches(response *probeResponse) bool {
+	status := c.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if response.resp.StatusCode != status {
+		return false
+	}
+	if c.proofHeader != "" {
+		return c.proof.MatchString(response.resp.Header.Get(c.proofHeader))
+	}
+	return c.proof.Match(response.body)
+}
+
+// banner returns the version a response shows, or ""
+func (c adminCheck) banner(response *probeResponse) string {
+	if c.versionHeader != "" {
+		if version := response.resp.Header.Get(c.versionHeader); version != "" {
+			return version
+		}
+	}
+	if c.version != nil {
+		return submatch(c.version.FindSubmatch(response.body))
+	}
+	return ""
+}
+
+// madeUp returns a name no surface has, the same for every check in a
+// directory so its baseline is requested once
+func (t *AdminTester) madeUp(dir string) string {
+	if name, ok := t.madeUpNames[dir]; ok {
+		return name
+	}
+	name := fmt.Sprintf("gofuzz%08x", t.rng.Uint32())
+	t.madeUpNames[dir] = name
+	return name
+}
+
+// fetch sends a GET request once per URL and returns the response, or nil
+// when it failed
+func (t *AdminTester) fetch(targetURL string) *probeResponse {
+	if response, ok := t.responses[targetURL]; ok {
+		return response
+	}
+	t.responses[targetURL] = nil
+	response, err := fetchProbe(t.client, t.config, targetURL, nil)
+	if err != nil {
+		t.logger.Debug("request failed", "url", targetURL, "error", err)
+		return nil
+	}
+	t.responses[targetURL] = response
+	return response
+}
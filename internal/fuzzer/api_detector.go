@@ -3,19 +3,30 @@ package fuzzer
 import (
 	"encoding/json"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	formhtml "github.com/gregcmartin/gofuzz/internal/html"
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // APIEndpoint represents a detected API endpoint
 type APIEndpoint struct {
-	URL     string
-	Method  string
-	Params  map[string]ParamType
-	Headers map[string]string
+	URL        string
+	Method     string
+	Params     map[string]ParamType
+	Headers    map[string]string
+	BodySchema map[string]interface{} // JSON request body schema declared by an API spec
+	Declared   bool                   // Params were declared by an API spec, so they are the endpoint's contract
+
+	// Responses declared by an API spec by status code, e.g. "200", "4XX" or
+	// "default", with the schema of their JSON body or nil for any body
+	Responses map[string]map[string]interface{}
 }
 
 // ParamType represents the type and constraints of an API parameter
@@ -25,6 +36,9 @@ type ParamType struct {
 	Format     string // email, date, etc.
 	MinValue   float64
 	MaxValue   float64
+	HasMin     bool    // MinValue is set
+	HasMax     bool    // MaxValue is set
+	MultipleOf float64 // Values are multiples of it, 0 for any
 	MinLength  int
 	MaxLength  int
 	Pattern    string
@@ -33,11 +47,101 @@ type ParamType struct {
 	ObjectType map[string]ParamType // For object types
 }
 
-// APIDetector implements detection of API endpoints
+// clone returns a deep copy of the parameter type
+func (p ParamType) clone() ParamType {
+	p.Enum = append([]string(nil), p.Enum...)
+	if p.ArrayType != nil {
+		arrayType := p.ArrayType.clone()
+		p.ArrayType = &arrayType
+	}
+	if p.ObjectType != nil {
+		objectType := make(map[string]ParamType, len(p.ObjectType))
+		for name, field := range p.ObjectType {
+			objectType[name] = field.clone()
+		}
+		p.ObjectType = objectType
+	}
+	return p
+}
+
+// clone returns a deep copy of the endpoint, so a variant of it shares no
+// maps with it
+func (e *APIEndpoint) clone() *APIEndpoint {
+	c := *e
+	if e.Params != nil {
+		c.Params = make(map[string]ParamType, len(e.Params))
+		for name, param := range e.Params {
+			c.Params[name] = param.clone()
+		}
+	}
+	if e.Headers != nil {
+		c.Headers = make(map[string]string, len(e.Headers))
+		for name, value := range e.Headers {
+			c.Headers[name] = value
+		}
+	}
+	if e.BodySchema != nil {
+		c.BodySchema = cloneJSON(e.BodySchema).(map[string]interface{})
+	}
+	if e.Responses != nil {
+		c.Responses = make(map[string]map[string]interface{}, len(e.Responses))
+		for code, schema := range e.Responses {
+			if schema != nil {
+				schema = cloneJSON(schema).(map[string]interface{})
+			}
+			c.Responses[code] = schema
+		}
+	}
+	return &c
+}
+
+// cloneJSON returns a deep copy of a decoded JSON value
+func cloneJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			c[key] = cloneJSON(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = cloneJSON(item)
+		}
+		return c
+	}
+	return value
+}
+
+// bounds returns the numeric and length bounds of the parameter's values
+func (p ParamType) bounds() formhtml.Bounds {
+	b := formhtml.Bounds{
+		Min:       p.MinValue,
+		Max:       p.MaxValue,
+		HasMin:    p.HasMin,
+		HasMax:    p.HasMax,
+		Step:      p.MultipleOf,
+		ZeroBase:  true,
+		MinLength: p.MinLength,
+		MaxLength: p.MaxLength,
+	}
+	if p.Type == "int" && b.Step == 0 && (b.HasMin || b.HasMax) {
+		b.Step, b.ZeroBase = 1, false
+	}
+	return b
+}
+
+// APIDetector implements detection of API endpoints. It is safe for
+// concurrent use by the crawler's workers.
 type APIDetector struct {
-	endpoints map[string]*APIEndpoint
-	patterns  []*regexp.Regexp
-	config    *Config
+	mu        sync.RWMutex
+	endpoints map[string]*APIEndpoint // By endpointKey
+	specs     map[string]bool         // URLs of the spec documents read
+
+	patterns []*regexp.Regexp
+	config   *Config
+	logger   *slog.Logger
 }
 
 // NewAPIDetector creates a new API detector
@@ -50,7 +154,9 @@ func NewAPIDetector(config *Config) *APIDetector {
 
 	return &APIDetector{
 		endpoints: make(map[string]*APIEndpoint),
+		specs:     make(map[string]bool),
 		config:    config,
+		logger:    logging.For("api-detector"),
 		patterns: []*regexp.Regexp{
 			regexp.MustCompile(`(?i)/api/`),
 			regexp.MustCompile(`(?i)/v\d+/`),
@@ -74,7 +180,9 @@ func (d *APIDetector) IsAPIEndpoint(urlStr string) bool {
 	return false
 }
 
-// DetectEndpoint analyzes a URL and response to detect API characteristics
+// DetectEndpoint analyzes a URL and response to detect API characteristics.
+// It returns nil for an endpoint already known with the method the response
+// answered, however its URL was written.
 func (d *APIDetector) DetectEndpoint(urlStr string, resp *http.Response) (*APIEndpoint, error) {
 	// Check content type first
 	contentType := resp.Header.Get("Content-Type")
@@ -86,10 +194,14 @@ func (d *APIDetector) DetectEndpoint(urlStr string, resp *http.Response) (*APIEn
 		return nil, nil
 	}
 
-	// Create endpoint object
+	// Create endpoint object, for the method the response answered
+	method := http.MethodGet
+	if resp.Request != nil && resp.Request.Method != "" {
+		method = resp.Request.Method
+	}
 	endpoint := &APIEndpoint{
 		URL:     urlStr,
-		Method:  "GET", // Default to GET, can be updated based on form methods
+		Method:  method,
 		Params:  make(map[string]ParamType),
 		Headers: make(map[string]string),
 	}
@@ -106,8 +218,8 @@ func (d *APIDetector) DetectEndpoint(urlStr string, resp *http.Response) (*APIEn
 		endpoint.Params[param] = d.inferParamType(query.Get(param))
 	}
 
-	// Read and parse response body
-	body, err := io.ReadAll(resp.Body)
+	// Read and parse response body, leaving it intact for later readers
+	body, err := peekBody(resp, maxBodySize(d.config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %v", err)
 	}
@@ -117,13 +229,22 @@ func (d *APIDetector) DetectEndpoint(urlStr string, resp *http.Response) (*APIEn
 	if err := json.Unmarshal(body, &result); err == nil {
 		endpoint.Headers["Content-Type"] = "application/json"
 		d.inferJSONStructure(endpoint, result)
-		if d.config.Verbose {
-			fmt.Printf("Found JSON API endpoint: %s\n", urlStr)
-			fmt.Printf("Response structure: %+v\n", result)
-		}
+		d.logger.Debug("found JSON API endpoint", "url", urlStr, "params", len(endpoint.Params))
+	}
+
+	if !d.add(endpoint) {
+		return nil, nil
 	}
 
-	d.endpoints[urlStr] = endpoint
+	d.config.Findings.Add(&Finding{
+		Type:       "api-endpoint",
+		Severity:   SeverityInfo,
+		Confidence: ConfidenceFirm,
+		URL:        urlStr,
+		Method:     endpoint.Method,
+		Evidence:   fmt.Sprintf("Content-Type: %s, %d parameters inferred", contentType, len(endpoint.Params)),
+	})
+
 	return endpoint, nil
 }
 
@@ -218,7 +339,153 @@ func (d *APIDetector) inferJSONType(value interface{}) ParamType {
 	return ParamType{Type: "string"}
 }
 
-// GetEndpoints returns all detected API endpoints
-func (d *APIDetector) GetEndpoints() map[string]*APIEndpoint {
-	return d.endpoints
+// Endpoints returns a snapshot of the detected API endpoints, sorted by
+// URL and method
+func (d *APIDetector) Endpoints() []*APIEndpoint {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	endpoints := make([]*APIEndpoint, 0, len(d.endpoints))
+	for _, key := range sortedKeys(d.endpoints) {
+		endpoints = append(endpoints, d.endpoints[key])
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool { return endpoints[i].URL < endpoints[j].URL })
+	return endpoints
+}
+
+// Known reports whether an endpoint is known at a URL with a method, GET
+// when empty, however the URL is written
+func (d *APIDetector) Known(method, urlStr string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.endpoints[endpointKey(&APIEndpoint{URL: urlStr, Method: method})] != nil
+}
+
+// add records an endpoint, reporting false when one is known already under
+// its key
+func (d *APIDetector) add(endpoint *APIEndpoint) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.addLocked(endpoint)
+}
+
+// addLocked is add with d.mu held
+func (d *APIDetector) addLocked(endpoint *APIEndpoint) bool {
+	key := endpointKey(endpoint)
+	if d.endpoints[key] != nil {
+		return false
+	}
+	d.endpoints[key] = endpoint
+	return true
+}
+
+// atURL returns an endpoint known at a URL with any method, or nil. d.mu
+// must be held.
+func (d *APIDetector) atURL(urlStr string) *APIEndpoint {
+	target := normalizeEndpointURL(urlStr)
+	for _, key := range sortedKeys(d.endpoints) {
+		if normalizeEndpointURL(d.endpoints[key].URL) == target {
+			return d.endpoints[key]
+		}
+	}
+	return nil
+}
+
+// Observe records a request a page sent, e.g. an XHR or fetch call from its
+// scripts, so the endpoint is fuzzed with the method it was seen with. Only
+// GET, POST, PUT and PATCH requests to URLs that look like API endpoints, or
+// to endpoints already found, are kept; parameters are taken from an
+// endpoint found at the URL, else from the query string. It returns the
+// endpoint when it is new.
+func (d *APIDetector) Observe(method, urlStr string) *APIEndpoint {
+	method = strings.ToUpper(method)
+	if !fuzzedMethod(method) {
+		return nil
+	}
+	// The endpoint at the URL is looked up and its variant added at once,
+	// so workers observing the same call add it once
+	d.mu.Lock()
+	if known := d.atURL(urlStr); known != nil {
+		defer d.mu.Unlock()
+		return d.withMethod(known, method)
+	}
+	d.mu.Unlock()
+	if !d.IsAPIEndpoint(urlStr) {
+		return nil
+	}
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil
+	}
+
+	endpoint := &APIEndpoint{
+		URL:     urlStr,
+		Method:  method,
+		Params:  make(map[string]ParamType),
+		Headers: make(map[string]string),
+	}
+	query := parsedURL.Query()
+	for param := range query {
+		endpoint.Params[param] = d.inferParamType(query.Get(param))
+	}
+	if !d.add(endpoint) {
+		return nil
+	}
+	d.logger.Debug("observed API request", "method", method, "url", urlStr)
+	return endpoint
+}
+
+// ProbeMethods asks an endpoint with an OPTIONS request which methods it
+// supports and returns a new endpoint for each GET, POST, PUT or PATCH its
+// Allow header lists besides the methods already known, with the same
+// parameters
+func (d *APIDetector) ProbeMethods(client *http.Client, endpoint *APIEndpoint) []*APIEndpoint {
+	req, err := http.NewRequest(http.MethodOptions, endpoint.URL, nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		d.logger.Debug("OPTIONS probe failed", "url", endpoint.URL, "error", err)
+		return nil
+	}
+	resp.Body.Close()
+
+	var found []*APIEndpoint
+	d.mu.Lock()
+	for _, method := range strings.Split(resp.Header.Get("Allow"), ",") {
+		if added := d.withMethod(endpoint, strings.ToUpper(strings.TrimSpace(method))); added != nil {
+			found = append(found, added)
+		}
+	}
+	d.mu.Unlock()
+	if len(found) > 0 {
+		d.logger.Debug("endpoint allows more methods", "url", endpoint.URL, "allow", resp.Header.Get("Allow"))
+	}
+	return found
+}
+
+// withMethod records a copy of an endpoint with a different method. It
+// returns nil when the method is not fuzzed or the endpoint is known
+// already. d.mu must be held.
+func (d *APIDetector) withMethod(endpoint *APIEndpoint, method string) *APIEndpoint {
+	if !fuzzedMethod(method) {
+		return nil
+	}
+	variant := endpoint.clone()
+	variant.Method = method
+	if !d.addLocked(variant) {
+		return nil
+	}
+	return variant
+}
+
+// fuzzedMethod reports whether endpoints are fuzzed with a method: GET, POST,
+// PUT and PATCH, as for specs, so a run never removes data
+func fuzzedMethod(method string) bool {
+	for _, m := range specMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
 }
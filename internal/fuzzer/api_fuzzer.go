@@ -2,21 +2,39 @@ package fuzzer
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
+// schemaBodyCount is how many grammar-generated bodies are sent to an
+// endpoint whose schema has been inferred
+const schemaBodyCount = 50
+
 // APIFuzzer implements fuzzing for API endpoints
 type APIFuzzer struct {
-	endpoint *APIEndpoint
-	client   *http.Client
-	config   *Config
+	endpoint    *APIEndpoint
+	client      *http.Client
+	config      *Config
+	rng         *rand.Rand // Generated values, seeded from the run seed
+	bodyGrammar Grammar    // JSON body grammar built from the inferred schema
+	xmlTested   bool       // Whether the endpoint has been tried with an XML body
+	xmlParsed   bool       // Whether it parsed the XML body like its JSON one
+	logger      *slog.Logger
+
+	// Schema of a valid response that fuzzed responses are checked against
+	responseSchema map[string]interface{}
 }
 
 // NewAPIFuzzer creates a new API fuzzer
@@ -30,24 +48,64 @@ func NewAPIFuzzer(endpoint *APIEndpoint, config *Config) *APIFuzzer {
 		}
 	}
 
-	return &APIFuzzer{
+	client, err := newHTTPClient(config, true)
+	if err != nil {
+		client = &http.Client{Timeout: defaultClientTimeout}
+	}
+
+	f := &APIFuzzer{
 		endpoint: endpoint,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		config: config,
+		client:   client,
+		config:   config,
+		rng:      newRand(runSeed(config), streamAPI),
+		logger:   logging.For("api-fuzzer").With("endpoint", endpoint.URL),
+	}
+
+	// Bodies declared by a spec drive generation without inference
+	if kind := endpoint.BodySchema["type"]; kind == "object" || kind == "array" {
+		f.bodyGrammar = schemaGrammar(endpoint.BodySchema)
+	}
+	return f
+}
+
+// newTargetAPIFuzzer fetches the configured target and fuzzes it as an API
+// endpoint, with parameters inferred from its URL and JSON response. With
+// APISchema set the response schema also drives body generation.
+func newTargetAPIFuzzer(config *Config) (*APIFuzzer, error) {
+	client, err := newDiscoveryClient(config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch target: %v", err)
+	}
+	defer resp.Body.Close()
+
+	endpoint, err := NewAPIDetector(config).DetectEndpoint(config.TargetURL, resp)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == nil {
+		return nil, fmt.Errorf("target is not an API endpoint (no JSON response or API path), crawl the site to discover endpoints")
 	}
+
+	fuzzer := NewAPIFuzzer(endpoint, config)
+	if config.APISchema {
+		if err := fuzzer.InferSchema(); err != nil {
+			fuzzer.logger.Warn("schema inference failed", "error", err)
+		}
+	}
+	return fuzzer, nil
 }
 
 // InferSchema analyzes API responses to infer the schema
 func (f *APIFuzzer) InferSchema() error {
-	if !f.config.APISchema {
+	if !f.config.APISchema || f.endpoint.BodySchema != nil {
 		return nil
 	}
 
-	if f.config.Verbose {
-		fmt.Printf("Inferring schema for endpoint: %s\n", f.endpoint.URL)
-	}
+	f.logger.Debug("inferring schema")
 
 	// Make a request to get sample response
 	resp, err := f.client.Get(f.endpoint.URL)
@@ -58,17 +116,29 @@ func (f *APIFuzzer) InferSchema() error {
 
 	// Parse response body
 	var result interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxBodySize(f.config))).Decode(&result); err != nil {
 		return fmt.Errorf("failed to parse JSON response: %v", err)
 	}
 
-	// Infer schema from response
+	// Infer schema from response, learning value formats along the way
 	schema := f.inferJSONSchema(result)
+	f.config.Learner.ObserveJSON(result)
 
-	// Log inferred schema if verbose
-	if f.config.Verbose {
-		schemaJSON, _ := json.MarshalIndent(schema, "", "  ")
-		fmt.Printf("Inferred schema:\n%s\n", string(schemaJSON))
+	// Structured documents drive body generation for methods that take one
+	if kind := schema["type"]; kind == "object" || kind == "array" {
+		f.bodyGrammar = schemaGrammar(schema)
+	}
+
+	// Other methods answer with documents of their own, their baseline is
+	// the first valid response
+	if f.endpoint.Method == "" || f.endpoint.Method == http.MethodGet {
+		f.responseSchema = schema
+	}
+
+	// Log inferred schema at debug level
+	if f.logger.Enabled(context.Background(), slog.LevelDebug) {
+		schemaJSON, _ := json.Marshal(schema)
+		f.logger.Debug("inferred schema", "schema", string(schemaJSON))
 	}
 
 	return nil
@@ -133,48 +203,85 @@ func isDate(s string) bool {
 
 // Run starts the API fuzzing process
 func (f *APIFuzzer) Run() error {
-	// Generate test cases based on parameter types
-	testCases := f.generateTestCases()
+	// Each endpoint's fuzzer sends from one worker and has one session
+	sessions, err := newSessions(f.config, f.client)
+	if err != nil {
+		return err
+	}
+	f.client = sessions.client()
 
+	// Send the valid base case and the negative-testing matrix around it
+	testCases := f.generateTestCases()
 	for _, testCase := range testCases {
-		if err := f.executeTestCase(testCase); err != nil {
-			if f.config.Verbose {
-				fmt.Printf("[ERROR] Test case failed: %v\n", err)
-			}
+		exchange, err := f.sendTestCase(testCase.values)
+		if err != nil {
+			f.logger.Debug("test case failed", "rule", testCase.rule, "param", testCase.param, "error", err)
 			continue
 		}
+		f.checkContract(testCase, exchange)
 	}
 
-	return nil
-}
+	// The base case holds valid values for every parameter
+	base := testCases[0].values
+	if f.config.MassAssignment {
+		f.testMassAssignment(base)
+	}
+	if f.config.ContentTypeConfusion {
+		f.testContentTypes(base)
+	}
+	if f.config.XXE {
+		f.testXXE(base)
+	}
+	if f.config.NoSQLInjection {
+		f.testNoSQLInjection(base)
+	}
+	if f.config.PaginationAbuse {
+		f.testPagination(base)
+	}
+	if f.config.RateLimitMapping {
+		f.testRateLimits(base)
+	}
+	if f.config.ResourceExhaustion {
+		f.testResourceExhaustion(base)
+	}
+
+	// Send whole documents derived from the inferred schema, reaching nested
+	// fields that top-level parameter substitution cannot
+	if f.bodyGrammar == nil {
+		return nil
+	}
+	switch f.endpoint.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return nil
+	}
 
-// generateTestCases creates test cases based on parameter types
-func (f *APIFuzzer) generateTestCases() []map[string]interface{} {
-	var testCases []map[string]interface{}
-
-	// Generate base test case with valid values
-	baseCase := make(map[string]interface{})
-	for name, param := range f.endpoint.Params {
-		baseCase[name] = f.generateValidValue(param)
-	}
-	testCases = append(testCases, baseCase)
-
-	// Generate edge cases
-	for name, param := range f.endpoint.Params {
-		// Create variations of the base case with edge cases for each parameter
-		edgeCases := f.generateEdgeCases(param)
-		for _, edgeValue := range edgeCases {
-			testCase := copyMap(baseCase)
-			testCase[name] = edgeValue
-			testCases = append(testCases, testCase)
+	depth := f.config.MaxDepth
+	if depth <= 0 {
+		depth = 10
+	}
+	sent := make(map[string]bool)
+	for i := 0; i < schemaBodyCount; i++ {
+		body := expandGrammar(f.rng, f.bodyGrammar, "<start>", 0, depth)
+		if sent[body] {
+			continue
+		}
+		sent[body] = true
+
+		if err := f.executeBody([]byte(body)); err != nil {
+			f.logger.Debug("schema body failed", "error", err)
 		}
 	}
 
-	return testCases
+	return nil
 }
 
 // generateValidValue generates a valid value for a parameter type
 func (f *APIFuzzer) generateValidValue(param ParamType) interface{} {
+	if len(param.Enum) > 0 && param.Type != "array" && param.Type != "object" {
+		return param.Enum[f.rng.Intn(len(param.Enum))]
+	}
+
 	switch param.Type {
 	case "string":
 		if param.Format == "email" {
@@ -183,8 +290,15 @@ func (f *APIFuzzer) generateValidValue(param ParamType) interface{} {
 		if param.Format == "date" {
 			return f.generateDate()
 		}
+		if lengths := param.bounds().InLength(); len(lengths) > 0 {
+			return f.generateString(lengths[f.rng.Intn(len(lengths))])
+		}
 		return f.generateString(10)
 	case "int":
+		if values := param.bounds().InRange(); len(values) > 0 {
+			n, _ := strconv.ParseFloat(values[f.rng.Intn(len(values))], 64)
+			return int(n)
+		}
 		min := int(param.MinValue)
 		if min == 0 {
 			min = -100
@@ -193,8 +307,15 @@ func (f *APIFuzzer) generateValidValue(param ParamType) interface{} {
 		if max == 0 {
 			max = 100
 		}
-		return rand.Intn(max-min) + min
+		if max <= min {
+			return min
+		}
+		return f.rng.Intn(max-min) + min
 	case "float":
+		if values := param.bounds().InRange(); len(values) > 0 {
+			n, _ := strconv.ParseFloat(values[f.rng.Intn(len(values))], 64)
+			return n
+		}
 		min := param.MinValue
 		if min == 0 {
 			min = -100.0
@@ -203,14 +324,14 @@ func (f *APIFuzzer) generateValidValue(param ParamType) interface{} {
 		if max == 0 {
 			max = 100.0
 		}
-		return min + rand.Float64()*(max-min)
+		return min + f.rng.Float64()*(max-min)
 	case "bool":
-		return rand.Intn(2) == 1
+		return f.rng.Intn(2) == 1
 	case "array":
 		if param.ArrayType == nil {
 			return []interface{}{}
 		}
-		arr := make([]interface{}, rand.Intn(5)+1)
+		arr := make([]interface{}, f.rng.Intn(5)+1)
 		for i := range arr {
 			arr[i] = f.generateValidValue(*param.ArrayType)
 		}
@@ -220,8 +341,8 @@ func (f *APIFuzzer) generateValidValue(param ParamType) interface{} {
 			return map[string]interface{}{}
 		}
 		obj := make(map[string]interface{})
-		for key, fieldType := range param.ObjectType {
-			obj[key] = f.generateValidValue(fieldType)
+		for _, key := range sortedKeys(param.ObjectType) {
+			obj[key] = f.generateValidValue(param.ObjectType[key])
 		}
 		return obj
 	default:
@@ -229,12 +350,14 @@ func (f *APIFuzzer) generateValidValue(param ParamType) interface{} {
 	}
 }
 
-// generateEdgeCases generates edge cases for a parameter type
+// generateEdgeCases generates attack strings and extreme values for a
+// parameter type. Values breaking its declared type are part of the
+// negative-testing matrix instead.
 func (f *APIFuzzer) generateEdgeCases(param ParamType) []interface{} {
 	var cases []interface{}
 
-	// Add null/empty cases
-	cases = append(cases, nil, "")
+	// Add the empty case
+	cases = append(cases, "")
 
 	switch param.Type {
 	case "string":
@@ -253,7 +376,6 @@ func (f *APIFuzzer) generateEdgeCases(param ParamType) []interface{} {
 			1,
 			-9999999999,
 			9999999999,
-			"123", // Type confusion
 		)
 	case "float":
 		cases = append(cases,
@@ -262,27 +384,16 @@ func (f *APIFuzzer) generateEdgeCases(param ParamType) []interface{} {
 			-1.0,
 			math.MaxFloat64,
 			-math.MaxFloat64,
-			"123.45", // Type confusion
-		)
-	case "bool":
-		cases = append(cases,
-			"true",  // Type confusion
-			"false", // Type confusion
-			1,       // Type confusion
-			0,       // Type confusion
 		)
 	case "array":
 		cases = append(cases,
-			[]interface{}{},                        // Empty array
-			make([]interface{}, 1000),              // Very large array
-			"not_an_array",                         // Type confusion
-			[]interface{}{nil, nil},                // Array with null values
-			map[string]interface{}{"key": "value"}, // Type confusion
+			[]interface{}{},           // Empty array
+			make([]interface{}, 1000), // Very large array
+			[]interface{}{nil, nil},   // Array with null values
 		)
 	case "object":
 		cases = append(cases,
 			map[string]interface{}{},                               // Empty object
-			[]interface{}{},                                        // Type confusion
 			map[string]interface{}{"": nil},                        // Empty key
 			map[string]interface{}{"a": strings.Repeat("b", 1000)}, // Large value
 		)
@@ -291,9 +402,11 @@ func (f *APIFuzzer) generateEdgeCases(param ParamType) []interface{} {
 	return cases
 }
 
-// executeTestCase sends a request with the test case data
-func (f *APIFuzzer) executeTestCase(testCase map[string]interface{}) error {
+// sendTestCase sends a request with the test case data and returns the
+// exchange
+func (f *APIFuzzer) sendTestCase(testCase map[string]interface{}) (*probeResponse, error) {
 	var req *http.Request
+	var reqBody []byte
 	var err error
 
 	switch f.endpoint.Method {
@@ -315,24 +428,42 @@ func (f *APIFuzzer) executeTestCase(testCase map[string]interface{}) error {
 
 	case "POST", "PUT", "PATCH":
 		// Send as JSON body
-		body, err := json.Marshal(testCase)
+		reqBody, err = json.Marshal(testCase)
 		if err != nil {
-			return fmt.Errorf("failed to marshal request body: %v", err)
+			return nil, fmt.Errorf("failed to marshal request body: %v", err)
 		}
-		req, err = http.NewRequest(f.endpoint.Method, f.endpoint.URL, bytes.NewBuffer(body))
+		req, err = http.NewRequest(f.endpoint.Method, f.endpoint.URL, bytes.NewBuffer(reqBody))
 		if err != nil {
-			return fmt.Errorf("failed to create request: %v", err)
+			return nil, fmt.Errorf("failed to create request: %v", err)
 		}
 		req.Header.Set("Content-Type", "application/json")
 
 	default:
-		return fmt.Errorf("unsupported HTTP method: %s", f.endpoint.Method)
+		return nil, fmt.Errorf("unsupported HTTP method: %s", f.endpoint.Method)
 	}
 
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	payload, _ := json.Marshal(testCase)
+	return f.send(req, reqBody, string(payload))
+}
+
+// executeBody sends a JSON document as the request body
+func (f *APIFuzzer) executeBody(body []byte) error {
+	req, err := http.NewRequest(f.endpoint.Method, f.endpoint.URL, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = f.send(req, body, string(body))
+	return err
+}
 
+// send issues a request, reports server errors as findings and returns the
+// exchange
+func (f *APIFuzzer) send(req *http.Request, reqBody []byte, payload string) (*probeResponse, error) {
 	// Add any custom headers
 	for key, value := range f.endpoint.Headers {
 		req.Header.Set(key, value)
@@ -341,16 +472,23 @@ func (f *APIFuzzer) executeTestCase(testCase map[string]interface{}) error {
 	// Send request
 	resp, err := f.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %v", err)
+		inspectFailure(f.config, req, reqBody, err, payload)
+		return nil, fmt.Errorf("request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// Log response details in verbose mode
-	if f.config.Verbose {
-		fmt.Printf("[%s] %s -> %d\n", f.endpoint.Method, req.URL, resp.StatusCode)
+	f.logger.Debug("test case sent", "method", f.endpoint.Method, "url", req.URL.String(), "status", resp.StatusCode)
+
+	body, _ := readLimited(resp.Body, maxBodySize(f.config))
+	inspectResponse(f.config, req, reqBody, resp, body.data, payload)
+	if f.config.APISchema {
+		f.checkSchemaDrift(req, reqBody, resp, body.data, payload)
+	}
+	if f.endpoint.Responses != nil {
+		f.checkResponseContract(req, reqBody, resp, body.data, payload)
 	}
 
-	return nil
+	return &probeResponse{req: req, reqBody: reqBody, resp: resp, body: body.data}, nil
 }
 
 // Helper function to copy a map
@@ -364,14 +502,14 @@ func copyMap(m map[string]interface{}) map[string]interface{} {
 
 // Helper functions for generating test data
 func (f *APIFuzzer) generateEmail() string {
-	return fmt.Sprintf("test%d@example.com", rand.Intn(10000))
+	return fmt.Sprintf("test%d@example.com", f.rng.Intn(10000))
 }
 
 func (f *APIFuzzer) generateDate() string {
 	min := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
 	max := time.Now().Unix()
 	delta := max - min
-	sec := rand.Int63n(delta) + min
+	sec := f.rng.Int63n(delta) + min
 	return time.Unix(sec, 0).Format("2006-01-02")
 }
 
@@ -379,7 +517,7 @@ func (f *APIFuzzer) generateString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
 	for i := range b {
-		b[i] = charset[rand.Intn(len(charset))]
+		b[i] = charset[f.rng.Intn(len(charset))]
 	}
 	return string(b)
 }
@@ -0,0 +1,131 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiSpecPaths are where OpenAPI and Swagger documents are commonly served
+var apiSpecPaths = []string{
+	"/openapi.json",
+	"/openapi.yaml",
+	"/swagger.json",
+	"/swagger.yaml",
+	"/api/openapi.json",
+	"/api/swagger.json",
+	"/api-docs",
+	"/v2/api-docs",
+	"/v3/api-docs",
+	"/swagger/v1/swagger.json",
+	"/.well-known/openapi.json",
+	"/.well-known/openapi.yaml",
+}
+
+// apiRoots are paths APIs are commonly mounted at
+var apiRoots = []string{
+	"/api",
+	"/api/v1",
+	"/api/v2",
+	"/api/v3",
+	"/v1",
+	"/v2",
+	"/rest",
+	"/rest/v1",
+	"/graphql",
+	"/api/graphql",
+}
+
+// Probe requests the paths APIs and their spec documents are commonly
+// served at on the host of baseURL. The operations of every OpenAPI or
+// Swagger document found become endpoints, with the parameters and body
+// schemas it declares; API roots that answer become endpoints as pages
+// found while crawling do. Answers matching the one to a made-up path, as
+// from applications serving every path, are skipped. Probe returns the new
+// endpoints.
+func (d *APIDetector) Probe(client *http.Client, baseURL string) []*APIEndpoint {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" {
+		return nil
+	}
+	root := base.Scheme + "://" + base.Host
+
+	rng := newRand(runSeed(d.config), streamAPI)
+	missing, err := d.fetch(client, fmt.Sprintf("%s/gfa%08x", root, rng.Uint32()))
+	if err != nil {
+		d.logger.Debug("API probe failed", "url", root, "error", err)
+		return nil
+	}
+
+	var found []*APIEndpoint
+	for _, path := range apiSpecPaths {
+		resp, err := d.fetch(client, root+path)
+		if err != nil || resp.resp.StatusCode != http.StatusOK {
+			continue
+		}
+		endpoints, _ := d.harvestSpec(resp.resp.Request.URL, resp.body)
+		found = append(found, endpoints...)
+	}
+
+	for _, path := range apiRoots {
+		rootURL := root + path
+		if d.Known(http.MethodGet, rootURL) {
+			continue
+		}
+		resp, err := d.fetch(client, rootURL)
+		if err != nil || resp.resp.StatusCode == http.StatusNotFound || resp.like(missing) {
+			continue
+		}
+		endpoint, err := d.DetectEndpoint(rootURL, resp.resp)
+		if err != nil || endpoint == nil {
+			continue
+		}
+		found = append(found, endpoint)
+	}
+	return found
+}
+
+// fetch requests a probe URL. The answer's body is read into the probe
+// response and left readable on it.
+func (d *APIDetector) fetch(client *http.Client, probeURL string) (*probeResponse, error) {
+	response, err := fetchProbe(client, d.config, probeURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response.resp.Body = io.NopCloser(bytes.NewReader(response.body))
+	return response, nil
+}
+
+// endpointKey returns the key an endpoint is kept under: its method, GET
+// when empty, and normalized URL, so each operation is kept once however
+// its URL is written
+func endpointKey(endpoint *APIEndpoint) string {
+	method := strings.ToUpper(endpoint.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	return method + " " + normalizeEndpointURL(endpoint.URL)
+}
+
+// normalizeEndpointURL returns a URL with its scheme and host lower-cased,
+// the default port and fragment dropped and the query reduced to its sorted
+// parameter names, the values being samples rather than part of the
+// endpoint. URLs that do not parse are returned as they are.
+func normalizeEndpointURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return raw
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = canonicalHost(parsed)
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	parsed.RawQuery = strings.Join(sortedKeys(parsed.Query()), "&")
+	return parsed.String()
+}
@@ -0,0 +1,159 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+)
+
+// specPage recognizes the Swagger UI and ReDoc pages that render an API spec
+var specPage = regexp.MustCompile(`(?i)swagger-ui|SwaggerUIBundle|<redoc\b|Redoc\.init`)
+
+// specReferences match where Swagger UI and ReDoc pages name their spec: the
+// url and urls options of SwaggerUIBundle, ReDoc's spec-url attribute and
+// the first argument of Redoc.init
+var specReferences = []*regexp.Regexp{
+	regexp.MustCompile(`\burl\s*:\s*["']([^"']+)["']`),
+	regexp.MustCompile(`(?i)\bspec-url\s*=\s*["']([^"']+)["']`),
+	regexp.MustCompile(`Redoc\.init\(\s*["']([^"']+)["']`),
+}
+
+// specInitializer matches the script newer Swagger UI releases configure
+// themselves in, instead of the page
+var specInitializer = regexp.MustCompile(`(?i)src\s*=\s*["']([^"']*swagger-initializer\.js[^"']*)["']`)
+
+// DetectSpec checks whether a page is an OpenAPI or Swagger document, or a
+// Swagger UI or ReDoc page rendering one from the same host, and returns the
+// endpoints of every operation the document declares, typed by its schemas.
+// A document is read once however many pages lead to it, so only the first
+// yields endpoints. DetectSpec reports whether the page is a document or
+// such a page; other pages are left with their body intact.
+func (d *APIDetector) DetectSpec(client *http.Client, pageURL string, resp *http.Response) ([]*APIEndpoint, bool) {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, false
+	}
+	body, err := peekBody(resp, maxBodySize(d.config))
+	if err != nil || len(body) == 0 {
+		return nil, false
+	}
+	if endpoints, ok := d.harvestSpec(page, body); ok {
+		return endpoints, true
+	}
+	if !specPage.Match(body) {
+		return nil, false
+	}
+
+	refs := specURLs(page, body)
+	if match := specInitializer.FindSubmatch(body); match != nil {
+		if script := resolveSameHost(page, string(match[1])); script != nil {
+			if initializer, err := d.fetch(client, script.String()); err == nil {
+				refs = append(refs, specURLs(page, initializer.body)...)
+			}
+		}
+	}
+
+	var found []*APIEndpoint
+	for _, ref := range refs {
+		if d.specRead(ref.String()) {
+			continue
+		}
+		resp, err := d.fetch(client, ref.String())
+		if err != nil || resp.resp.StatusCode != http.StatusOK {
+			continue
+		}
+		endpoints, _ := d.harvestSpec(ref, resp.body)
+		found = append(found, endpoints...)
+	}
+	return found, true
+}
+
+// harvestSpec reads the endpoints of a spec document found at specURL, run
+// against the spec's host. It reports whether the data is a spec, and
+// returns the endpoints not known yet; a spec read before yields none.
+func (d *APIDetector) harvestSpec(specURL *url.URL, data []byte) ([]*APIEndpoint, bool) {
+	if !bytes.Contains(data, []byte("openapi")) && !bytes.Contains(data, []byte("swagger")) {
+		return nil, false // Not worth parsing
+	}
+	// Only a spec parsed before is marked read, so a page seen again need
+	// not be parsed again
+	if d.specRead(specURL.String()) {
+		return nil, true
+	}
+	endpoints, err := parseAPISpec(data, specURL.Path, specURL.Scheme+"://"+specURL.Host)
+	if err != nil {
+		return nil, false
+	}
+	// Pages fetched at once may both have parsed it; one keeps its endpoints
+	d.mu.Lock()
+	read := d.specs[specURL.String()]
+	d.specs[specURL.String()] = true
+	d.mu.Unlock()
+	if read {
+		return nil, true
+	}
+
+	d.logger.Info("found API spec", "url", specURL.String(), "operations", len(endpoints))
+	d.config.Findings.Add(&Finding{
+		Type:       "api-spec",
+		Severity:   SeverityInfo,
+		Confidence: ConfidenceCertain,
+		URL:        specURL.String(),
+		Method:     http.MethodGet,
+		Evidence:   fmt.Sprintf("OpenAPI/Swagger document declaring %d operations", len(endpoints)),
+	})
+	var found []*APIEndpoint
+	for _, endpoint := range endpoints {
+		if d.add(endpoint) {
+			found = append(found, endpoint)
+		}
+	}
+	return found, true
+}
+
+// specRead reports whether the spec document at a URL has been read
+func (d *APIDetector) specRead(specURL string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.specs[specURL]
+}
+
+// specURLs returns the spec documents a Swagger UI or ReDoc page or script
+// names, resolved against the page and limited to its host
+func specURLs(page *url.URL, data []byte) []*url.URL {
+	var refs []*url.URL
+	seen := make(map[string]bool)
+	for _, pattern := range specReferences {
+		for _, match := range pattern.FindAllSubmatch(data, -1) {
+			ref := resolveSameHost(page, string(match[1]))
+			if ref == nil || seen[ref.String()] {
+				continue
+			}
+			switch path.Ext(ref.Path) {
+			case ".js", ".css", ".html", ".png", ".svg", ".ico":
+				continue // Assets of the page, not the spec
+			}
+			seen[ref.String()] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// resolveSameHost resolves a reference against a page, returning nil when it
+// does not parse or points to another host
+func resolveSameHost(page *url.URL, ref string) *url.URL {
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return nil
+	}
+	resolved := page.ResolveReference(parsed)
+	if resolved.Host != page.Host || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+		return nil
+	}
+	resolved.Fragment = ""
+	return resolved
+}
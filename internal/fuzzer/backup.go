@@ -0,0 +1,307 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// backupFileNames are the names backup copies of a file go by, from its
+// name and its name without extension: editor backups and swap files, copies
+// admins make before an edit, and sources renamed to be shown as text
+var backupFileNames = []string{
+	"{name}.bak", "{name}.old", "{name}.orig", "{name}~", "{name}.save", "{name}.tmp", "{name}.copy",
+	"{name}.1", "{name}.txt", "{name}.dist", ".{name}.swp", "#{name}#", "{stem}.bak", "{stem}.old",
+}
+
+// backupArchiveNames are the names archives of a directory go by, next to
+// the directory
+var backupArchiveNames = []string{
+	"{name}.zip", "{name}.tar.gz", "{name}.tgz", "{name}.tar", "{name}.tar.bz2", "{name}.rar", "{name}.7z",
+	"{name}.bak",
+}
+
+// rootArchiveNames are the names of archives of the whole site, besides the
+// host's own name
+var rootArchiveNames = []string{"backup", "site", "www", "htdocs", "public_html"}
+
+// archiveMagic are the leading bytes of archive formats
+var archiveMagic = []struct {
+	format string
+	magic  []byte
+}{
+	{"zip", []byte("PK\x03\x04")},
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"bzip2", []byte("BZh")},
+	{"rar", []byte("Rar!\x1a\x07")},
+	{"7z", []byte("7z\xbc\xaf\x27\x1c")},
+}
+
+// serverSource matches server-side source code, which a server running the
+// file never sends as is
+var serverSource = regexp.MustCompile(`<\?php|<\?=|<%[@=]?|<cf(set|query|component)\b|^#!/|` +
+	`(?m)^\s*(import|package|require|using|def|from \S+ import|module\.exports|const \w+ = require)\b`)
+
+// backupCandidate is a backup name of a file or directory, with the
+// request to the same name of something that does not exist to tell it
+// from the server's answer to unknown paths
+type backupCandidate struct {
+	dir      string // Directory the candidate is in, with trailing slash
+	name     string
+	pattern  string // The name pattern, which the baseline shares
+	archive  bool   // An archive of a directory rather than a copy of a file
+	original string // URL of the file or directory the candidate backs up
+}
+
+// BackupTester looks for backup and temporary copies of the paths found:
+// editor backups, swap files and copies of files, archives of directories
+// and of the whole site. A candidate only counts when it is answered
+// otherwise than a made-up name of the same pattern in the same directory,
+// and otherwise than the original, so servers that answer every path, or
+// ignore the suffix, report nothing. Archives and server-side source are
+// reported as recoverable; other copies as possible backups.
+type BackupTester struct {
+	config    *Config
+	client    *http.Client
+	host      string // Canonical host of the target; paths elsewhere, such as CDN assets, are skipped
+	rng       *rand.Rand
+	tested    map[string]bool
+	baselines map[string]*probeResponse // Answers to made-up names, by directory and pattern
+	originals map[string]*probeResponse // Answers to the paths backed up, by URL
+	logger    *slog.Logger
+}
+
+// NewBackupTester creates a backup file tester
+func NewBackupTester(config *Config) (*BackupTester, error) {
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+	return &BackupTester{
+		config:    config,
+		client:    client,
+		host:      canonicalHost(target),
+		rng:       newRand(runSeed(config), streamBackup),
+		tested:    make(map[string]bool),
+		baselines: make(map[string]*probeResponse),
+		originals: make(map[string]*probeResponse),
+		logger:    logging.For("backups"),
+	}, nil
+}
+
+// Run tests the configured target URL and the directories above it
+func (t *BackupTester) Run() error {
+	t.Test([]string{t.config.TargetURL}, t.config.Deadline)
+	return nil
+}
+
+// Test probes the backup names of every URL's file and of each directory
+// above it, each path on the target's host once, and stops once the
+// deadline passes if one is set. It returns the number of paths tested.
+func (t *BackupTester) Test(urls []string, deadline time.Time) int {
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	tested := 0
+	for _, targetURL := range urls {
+		for _, candidates := range t.candidates(targetURL) {
+			if expired() {
+				return tested
+			}
+			tested++
+			for _, candidate := range candidates {
+				if expired() {
+					return tested
+				}
+				if finding := t.probe(candidate); finding != nil {
+					t.report(finding)
+				}
+			}
+		}
+	}
+	return tested
+}
+
+// candidates returns the backup names of a URL's file and of every
+// directory above it not tested yet, grouped by the path they back up
+func (t *BackupTester) candidates(targetURL string) [][]backupCandidate {
+	u, err := url.Parse(targetURL)
+	if err != nil || u.Host == "" || canonicalHost(u) != t.host {
+		return nil
+	}
+	root := u.Scheme + "://" + u.Host
+	var groups [][]backupCandidate
+	add := func(key string, candidates []backupCandidate) {
+		if !t.tested[key] {
+			t.tested[key] = true
+			groups = append(groups, candidates)
+		}
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	dir, name := path.Split(p)
+	if name != "" {
+		stem := strings.TrimSuffix(name, path.Ext(name))
+		original := root + p
+		add(u.Host+p, backupNames(dir, name, stem, original, backupFileNames, false))
+	}
+
+	// Every directory up to the root, archived next to itself
+	for dir != "/" {
+		parent, name := path.Split(strings.TrimSuffix(dir, "/"))
+		add(u.Host+dir, backupNames(parent, name, name, root+dir, backupArchiveNames, true))
+		dir = parent
+	}
+	var site []backupCandidate
+	for _, name := range append([]string{u.Hostname()}, rootArchiveNames...) {
+		site = append(site, backupNames("/", name, name, root+"/", backupArchiveNames, true)...)
+	}
+	add(u.Host+"/", site)
+
+	for _, group := range groups {
+		for i := range group {
+			group[i].dir = root + group[i].dir
+		}
+	}
+	return groups
+}
+
+// backupNames fills the name patterns with a file or directory name and
+// its stem, skipping duplicates
+func backupNames(dir, name, stem, original string, patterns []string, archive bool) []backupCandidate {
+	var candidates []backupCandidate
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		candidate := strings.NewReplacer("{name}", name, "{stem}", stem).Replace(pattern)
+		if seen[candidate] || candidate == name {
+			continue
+		}
+		seen[candidate] = true
+		candidates = append(candidates, backupCandidate{dir: dir, name: candidate, pattern: pattern,
+			archive: archive, original: original})
+	}
+	return candidates
+}
+
+// probe requests a candidate and returns a finding when it holds a backup
+func (t *BackupTester) probe(candidate backupCandidate) *Finding {
+	target := candidate.dir + escapePathPayload(candidate.name)
+	response, err := fetchProbe(t.client, t.config, target, nil)
+	if err != nil {
+		t.logger.Debug("request failed", "url", target, "error", err)
+		return nil
+	}
+	status := response.resp.StatusCode
+	if (status != http.StatusOK && status != http.StatusPartialContent) || len(response.body) == 0 {
+		return nil
+	}
+
+	// Answered like a name that does not exist, or like the original itself
+	baseline := t.baseline(candidate)
+	if baseline != nil && baseline.like(response) {
+		return nil
+	}
+	original := t.original(candidate.original)
+	if original != nil && original.like(response) {
+		return nil
+	}
+
+	kind, severity, confidence := t.classify(response, original)
+	evidence := fmt.Sprintf("%s answered HTTP %d with %d bytes", kind, status, len(response.body))
+	if baseline != nil {
+		evidence += fmt.Sprintf(", where a made-up name of the same pattern got HTTP %d", baseline.resp.StatusCode)
+	}
+	if contentType := response.resp.Header.Get("Content-Type"); contentType != "" {
+		evidence += ", Content-Type " + contentType
+	}
+
+	finding := &Finding{
+		Type:       "backup-file",
+		Severity:   severity,
+		Confidence: confidence,
+		URL:        target,
+		Method:     http.MethodGet,
+		Payload:    candidate.name,
+		Evidence:   evidence + " (backup of " + candidate.original + ")",
+	}
+	captureExchange(finding, response.req, nil, response.resp, response.body)
+	return finding
+}
+
+// classify tells what a backup holds, from its content and the original's
+func (t *BackupTester) classify(response, original *probeResponse) (string, Severity, Confidence) {
+	for _, format := range archiveMagic {
+		if bytes.HasPrefix(response.body, format.magic) {
+			return "recoverable " + format.format + " archive", SeverityHigh, ConfidenceCertain
+		}
+	}
+	if len(response.body) > 262 && bytes.Equal(response.body[257:262], []byte("ustar")) {
+		return "recoverable tar archive", SeverityHigh, ConfidenceCertain
+	}
+	if bytes.HasPrefix(response.body, []byte("b0VIM")) {
+		return "vim swap file", SeverityMedium, ConfidenceCertain
+	}
+	// Source the original page does not show was not run by the server
+	if match := serverSource.Find(response.body); match != nil &&
+		(original == nil || !bytes.Contains(original.body, match)) {
+		return fmt.Sprintf("recoverable source code (%q)", match), SeverityHigh, ConfidenceFirm
+	}
+	return "possible backup copy", SeverityLow, ConfidenceTentative
+}
+
+// baseline returns the answer to a made-up name of the candidate's pattern
+// in its directory, asking once per directory and pattern
+func (t *BackupTester) baseline(candidate backupCandidate) *probeResponse {
+	key := candidate.dir + "\x00" + candidate.pattern
+	if response, ok := t.baselines[key]; ok {
+		return response
+	}
+	made := fmt.Sprintf("gofuzz%08x", t.rng.Uint32())
+	name := made
+	if !candidate.archive {
+		name += path.Ext(candidate.original)
+	}
+	name = strings.NewReplacer("{name}", name, "{stem}", made).Replace(candidate.pattern)
+	response, err := fetchProbe(t.client, t.config, candidate.dir+escapePathPayload(name), nil)
+	if err != nil {
+		response = nil
+	}
+	t.baselines[key] = response
+	return response
+}
+
+// original returns the answer to the path a candidate backs up, asking once
+func (t *BackupTester) original(targetURL string) *probeResponse {
+	if response, ok := t.originals[targetURL]; ok {
+		return response
+	}
+	response, err := fetchProbe(t.client, t.config, targetURL, nil)
+	if err != nil {
+		response = nil
+	}
+	t.originals[targetURL] = response
+	return response
+}
+
+// report records a finding
+func (t *BackupTester) report(finding *Finding) {
+	if t.config.Findings.Add(finding) {
+		t.logger.Warn(finding.Type, "url", finding.URL, "evidence", finding.Evidence)
+	}
+}
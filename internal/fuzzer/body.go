@@ -0,0 +1,98 @@
+package fuzzer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+// defaultMaxBodySize is the response body limit used when none is configured
+const defaultMaxBodySize = 10 << 20
+
+// limitedBody is a response body read up to a size limit. Bytes beyond the
+// limit are streamed through the hash and discarded rather than buffered.
+type limitedBody struct {
+	data      []byte // Body up to the limit
+	size      int64  // Full body length, including discarded bytes
+	truncated bool   // Whether data stops short of the full body
+	hash      string // Hex SHA-256 of the full body
+}
+
+// maxBodySize returns the configured body limit
+func maxBodySize(config *Config) int64 {
+	if config == nil || config.MaxBodySize <= 0 {
+		return defaultMaxBodySize
+	}
+	return config.MaxBodySize
+}
+
+// readLimited reads r to the end, keeping at most limit bytes in memory. On
+// a read error the bytes received so far are still returned.
+func readLimited(r io.Reader, limit int64) (*limitedBody, error) {
+	h := sha256.New()
+	tee := io.TeeReader(r, h)
+
+	data, err := io.ReadAll(io.LimitReader(tee, limit))
+	var rest int64
+	if err == nil {
+		rest, err = io.Copy(io.Discard, tee)
+	}
+
+	return &limitedBody{
+		data:      data,
+		size:      int64(len(data)) + rest,
+		truncated: rest > 0,
+		hash:      hex.EncodeToString(h.Sum(nil)),
+	}, err
+}
+
+// fetchProbe sends a GET request with extra headers and reads the answer,
+// up to the configured body limit, into a probe response
+func fetchProbe(client *http.Client, config *Config, targetURL string, headers map[string]string) (*probeResponse, error) {
+	req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil, err
+	}
+	return &probeResponse{req: req, resp: resp, body: body.data}, nil
+}
+
+// peekBody returns up to limit bytes of the response body without consuming
+// it: the peeked bytes are stitched back in front of the unread remainder so
+// later readers still stream the full body
+func peekBody(resp *http.Response, limit int64) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+
+	prefix, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	resp.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		closer: resp.Body,
+	}
+	return prefix, err
+}
+
+// peekedBody replays a peeked prefix before the rest of the original body
+type peekedBody struct {
+	io.Reader
+	closer io.Closer
+}
+
+// Close implements io.Closer
+func (b *peekedBody) Close() error {
+	return b.closer.Close()
+}
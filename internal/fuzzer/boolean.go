@@ -0,0 +1,38 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// probeResponse is one exchange of a boolean probe
+type probeResponse struct {
+	req     *http.Request
+	reqBody []byte
+	resp    *http.Response
+	body    []byte
+}
+
+// like reports whether two probes were answered alike: same status and a
+// similar body once volatile content is ignored
+func (r *probeResponse) like(other *probeResponse) bool {
+	return r.resp.StatusCode == other.resp.StatusCode && similarBodies(r.body, other.body)
+}
+
+// String describes the response for finding evidence
+func (r *probeResponse) String() string {
+	return fmt.Sprintf("HTTP %d with %d bytes", r.resp.StatusCode, len(r.body))
+}
+
+// booleanConfirmed reports whether an injected condition flips the outcome.
+// baseline answers an ordinary value that matches nothing, falsy the
+// injected condition that is always false and truthy the one that is always
+// true. The false condition must be answered like the baseline, showing the
+// injection itself is harmless to the request, and the true one differently
+// from both without a server error. Syntax the backend does not evaluate
+// makes both conditions look alike, so spraying payloads at an endpoint
+// that merely errors on odd input reports nothing.
+func booleanConfirmed(baseline, truthy, falsy *probeResponse) bool {
+	return falsy.like(baseline) && !truthy.like(baseline) && !truthy.like(falsy) &&
+		truthy.resp.StatusCode < http.StatusInternalServerError
+}
@@ -0,0 +1,71 @@
+package fuzzer
+
+import (
+	"net/http"
+	"strings"
+
+	formhtml "github.com/gregcmartin/gofuzz/internal/html"
+)
+
+// maxBoundedLength is the longest length limit whose values are spelled out
+// in full in grammars and boundary probes; longer limits are left to the
+// generic long-string cases
+const maxBoundedLength = 256
+
+// outOfBounds returns values just outside the bounds: a step past either
+// end of the range, a value off the step grid, and text one character
+// shorter than the minimum length and one longer than the maximum
+func outOfBounds(bounds formhtml.Bounds) []string {
+	values := bounds.OutOfRange()
+	for _, length := range bounds.OutOfLength() {
+		if length <= maxBoundedLength {
+			values = append(values, strings.Repeat("a", length))
+		}
+	}
+	return values
+}
+
+// withParams returns a form input, "METHOD URL data", with the given
+// parameters set, in the body or, for GET, in the query string
+func withParams(input string, values map[string]string) string {
+	parts := strings.SplitN(input, " ", 3)
+	switch {
+	case len(parts) == 3:
+		parts[2] = applyParams(parts[2], values)
+	case len(parts) == 2:
+		if base, query, ok := strings.Cut(parts[1], "?"); ok {
+			parts[1] = base + "?" + applyParams(query, values)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// testBoundaries submits, for one field at a time, each value just outside
+// the field's min, max, step, minlength and maxlength, with the other fields
+// kept at one set of generated values. The browser would refuse these, so
+// they show whether the server checks the bounds again; the answers go
+// through the same checks as fuzzed submissions. With PreserveDefaults the
+// other fields keep their defaults.
+func (f *WebFormFuzzer) testBoundaries(client *http.Client) {
+	base := f.nextInput()
+	if f.defaults != nil {
+		base = omitParams(withParams(base, f.defaults), f.unchecked)
+	}
+	sent := 0
+	for _, name := range sortedKeys(f.fields) {
+		for _, value := range outOfBounds(f.fields[name].bounds()) {
+			if f.expired() {
+				return
+			}
+			result := f.submit(client, withParams(base, map[string]string{name: value}))
+			if result.Error != nil {
+				f.logger.Debug("boundary value not answered", "field", name, "value", value, "error", result.Error)
+				continue
+			}
+			sent++
+		}
+	}
+	if sent > 0 {
+		f.logger.Info("boundary values sent", "submissions", sent)
+	}
+}
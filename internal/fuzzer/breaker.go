@@ -0,0 +1,306 @@
+package fuzzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Circuit breaker tuning
+const (
+	breakerWindow        = 20               // Recent requests the error rate and latency are taken over
+	breakerErrorRate     = 0.5              // Share of failed requests in the window that trips the breaker
+	breakerLatencyFactor = 10               // How many times the baseline latency trips the breaker
+	breakerMinLatency    = time.Second      // Latency that never trips the breaker, however low the baseline
+	breakerProbeInterval = 2 * time.Second  // Wait before the first health probe, doubled for each failed one
+	breakerMaxInterval   = 30 * time.Second // Longest wait between health probes
+	breakerMaxOutage     = 10 * time.Minute // How long the target may stay down before the remaining requests fail
+)
+
+// errTargetDown fails requests once the target has been down for too long
+var errTargetDown = fmt.Errorf("target did not recover within %s", breakerMaxOutage)
+
+// Outage is a period the target was unstable and fuzzing was paused.
+// Findings reported between Start and End were made against a struggling
+// target and are worth verifying again.
+type Outage struct {
+	Start  time.Time `json:"start"` // When the failures that tripped the breaker began
+	End    time.Time `json:"end"`   // When a health probe succeeded; zero if the run ended first
+	Reason string    `json:"reason"`
+}
+
+// Covers reports whether t falls within the outage
+func (o Outage) Covers(t time.Time) bool {
+	return !t.Before(o.Start) && (o.End.IsZero() || !t.After(o.End))
+}
+
+// outcome is the result of one request, as the breaker sees it
+type outcome struct {
+	at      time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// CircuitBreaker pauses fuzzing while the target is unstable. It trips when
+// half of the recent requests fail to connect, time out or get a 429, 502,
+// 503 or 504, or when their median latency grows to ten times the baseline.
+// While it is open every request waits, and the health URL is probed with
+// growing intervals until it answers again; the outage is recorded. A target
+// still down after ten minutes is given up on and the remaining requests
+// fail at once. The baseline is the median latency of the first requests
+// unless set. It is shared by every client built from the same Config and
+// is safe for concurrent use.
+type CircuitBreaker struct {
+	healthURL string
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	window   []outcome
+	baseline time.Duration
+	samples  []time.Duration // Latencies the baseline is taken from
+	resume   chan struct{}   // Closed when the breaker closes again; nil while closed
+	down     bool            // Whether the target was given up on
+	outages  []Outage
+}
+
+// NewCircuitBreaker creates a breaker that probes healthURL while open. An
+// empty healthURL probes the root of the host that tripped it.
+func NewCircuitBreaker(healthURL string) *CircuitBreaker {
+	return &CircuitBreaker{
+		healthURL: healthURL,
+		logger:    logging.For("breaker"),
+	}
+}
+
+// Clone returns a closed breaker that has seen no requests, probing the
+// health URL b was created with, or targetURL when b has none
+func (b *CircuitBreaker) Clone(targetURL string) *CircuitBreaker {
+	if b == nil {
+		return nil
+	}
+	healthURL := b.healthURL
+	if healthURL == "" {
+		healthURL = targetURL
+	}
+	clone := NewCircuitBreaker(healthURL)
+	b.mu.Lock()
+	clone.baseline = b.baseline
+	b.mu.Unlock()
+	return clone
+}
+
+// SetBaseline sets the latency the target normally answers in, instead of
+// taking it from the first requests
+func (b *CircuitBreaker) SetBaseline(latency time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.baseline = latency
+	b.samples = nil
+}
+
+// Outages returns the outages recorded so far
+func (b *CircuitBreaker) Outages() []Outage {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Outage(nil), b.outages...)
+}
+
+// Wait blocks while the breaker is open. It fails once the target has been
+// given up on.
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	resume, down := b.resume, b.down
+	b.mu.Unlock()
+	if down {
+		return errTargetDown
+	}
+	if resume == nil {
+		return nil
+	}
+	select {
+	case <-resume:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.down {
+		return errTargetDown
+	}
+	return nil
+}
+
+// record adds the outcome of a request sent through prober, tripping the
+// breaker when the target looks unstable
+func (b *CircuitBreaker) record(req *http.Request, latency time.Duration, failed bool, prober http.RoundTripper) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.resume != nil || b.down {
+		return // Requests sent before the breaker opened say nothing new
+	}
+
+	if !failed && b.baseline == 0 {
+		b.samples = append(b.samples, latency)
+		if len(b.samples) == breakerWindow {
+			b.baseline = median(b.samples)
+			b.samples = nil
+		}
+	}
+	b.window = append(b.window, outcome{at: time.Now(), latency: latency, failed: failed})
+	if len(b.window) > breakerWindow {
+		b.window = b.window[1:]
+	}
+	if len(b.window) < breakerWindow {
+		return
+	}
+
+	reason := b.tripReason()
+	if reason == "" {
+		return
+	}
+	start := b.window[0].at
+	for _, o := range b.window {
+		if o.failed {
+			start = o.at
+			break
+		}
+	}
+	b.outages = append(b.outages, Outage{Start: start, Reason: reason})
+	b.window = nil
+	b.resume = make(chan struct{})
+	b.logger.Warn("target unstable, pausing", "reason", reason)
+
+	healthURL := b.healthURL
+	if healthURL == "" {
+		healthURL = req.URL.Scheme + "://" + req.URL.Host + "/"
+	}
+	go b.probe(healthURL, prober)
+}
+
+// tripReason says why the window shows an unstable target, or returns ""
+func (b *CircuitBreaker) tripReason() string {
+	var failures int
+	var latencies []time.Duration
+	for _, o := range b.window {
+		if o.failed {
+			failures++
+		} else {
+			latencies = append(latencies, o.latency)
+		}
+	}
+	if float64(failures) >= breakerErrorRate*float64(len(b.window)) {
+		return fmt.Sprintf("%d of the last %d requests failed", failures, len(b.window))
+	}
+	if b.baseline > 0 && len(latencies) > 0 {
+		limit := max(breakerLatencyFactor*b.baseline, breakerMinLatency)
+		if m := median(latencies); m > limit {
+			return fmt.Sprintf("median latency %s, baseline %s", m.Round(time.Millisecond), b.baseline.Round(time.Millisecond))
+		}
+	}
+	return ""
+}
+
+// probe requests healthURL with growing intervals until the target answers,
+// then closes the breaker. It gives up on a target down for too long.
+func (b *CircuitBreaker) probe(healthURL string, prober http.RoundTripper) {
+	opened := time.Now()
+	interval := breakerProbeInterval
+	for {
+		time.Sleep(interval)
+		if b.healthy(healthURL, prober) {
+			break
+		}
+		if time.Since(opened) > breakerMaxOutage {
+			b.mu.Lock()
+			b.down = true
+			close(b.resume)
+			b.resume = nil
+			b.mu.Unlock()
+			b.logger.Error("target down, failing the remaining requests", "url", healthURL, "down_for", time.Since(opened).Round(time.Second))
+			return
+		}
+		b.logger.Debug("health probe failed", "url", healthURL, "next", interval)
+		interval = min(2*interval, breakerMaxInterval)
+	}
+
+	b.mu.Lock()
+	outage := &b.outages[len(b.outages)-1]
+	outage.End = time.Now()
+	downtime := outage.End.Sub(outage.Start)
+	close(b.resume)
+	b.resume = nil
+	b.mu.Unlock()
+	b.logger.Info("target recovered, resuming", "downtime", downtime.Round(time.Second))
+}
+
+// healthy reports whether the target answers healthURL, with anything but
+// the statuses of an overloaded server
+func (b *CircuitBreaker) healthy(healthURL string, prober http.RoundTripper) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultClientTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := prober.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return !transientStatus(resp.StatusCode)
+}
+
+// median returns the middle value of latencies
+func median(latencies []time.Duration) time.Duration {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+// SaveOutages writes outages as JSON
+func SaveOutages(path string, outages []Outage) error {
+	data, err := json.MarshalIndent(outages, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode outages: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write outages: %v", err)
+	}
+	return nil
+}
+
+// LoadOutages reads outages saved by SaveOutages
+func LoadOutages(path string) ([]Outage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outages: %v", err)
+	}
+	var outages []Outage
+	if err := json.Unmarshal(data, &outages); err != nil {
+		return nil, fmt.Errorf("failed to parse outages: %v", err)
+	}
+	return outages, nil
+}
@@ -0,0 +1,51 @@
+package fuzzer
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// requestBudget hands out a fixed number of request slots to any number of
+// workers. Workers take slots until the budget is spent, so the whole budget
+// is used no matter how it divides across workers and a slow worker never
+// holds up the others.
+type requestBudget struct {
+	next     atomic.Int64
+	total    int64
+	deadline time.Time // No slots are handed out after this time (zero = no limit)
+}
+
+// newRequestBudget creates a budget of n requests that also runs out at the
+// deadline, if one is set. A budget of n <= 0 is limited by the deadline
+// alone.
+func newRequestBudget(n int, deadline time.Time) *requestBudget {
+	total := int64(n)
+	if n <= 0 {
+		total = math.MaxInt64
+	}
+	return &requestBudget{total: total, deadline: deadline}
+}
+
+// take claims the next slot, returning its sequence number and false once
+// the budget is exhausted or the deadline has passed
+func (b *requestBudget) take() (int, bool) {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return 0, false
+	}
+	seq := b.next.Add(1) - 1
+	if seq >= b.total {
+		return 0, false
+	}
+	return int(seq), true
+}
+
+// exhausted reports whether no slots are left to take
+func (b *requestBudget) exhausted() bool {
+	return (!b.deadline.IsZero() && time.Now().After(b.deadline)) || b.next.Load() >= b.total
+}
+
+// used returns the number of slots handed out so far
+func (b *requestBudget) used() int {
+	return int(min(b.next.Load(), b.total))
+}
@@ -0,0 +1,208 @@
+package fuzzer
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Sides of the request budget
+const (
+	sideExplore = iota // The fuzzer's own inputs, reaching for new URLs, parameters and expansions
+	sideExploit        // Payloads sent to the injection points exploration found
+)
+
+// splitWindow is the number of requests between rebalancings of an
+// adaptive split
+const splitWindow = 50
+
+// minSideShare is the least share of requests an adaptive split leaves
+// either side, so a side that stopped yielding is still tried
+const minSideShare = 0.1
+
+// injectionPoint is a parameter exploration sent, which exploitation sends
+// every payload in turn
+type injectionPoint struct {
+	input string // Input the parameter was first seen in, whose other parameters keep their values
+	param string
+	next  int // Next payload sent
+}
+
+// inject returns the point's input with the parameter set to payload
+func (p *injectionPoint) inject(payload string) string {
+	prefix, query, _ := splitInputQuery(p.input)
+	return prefix + replaceQueryParam(query, p.param, payload)
+}
+
+// splitInputQuery splits an input around the query string holding its
+// parameters: the data of a form submission "METHOD URL data", else the
+// query of a URL, without its fragment. ok is false when it has neither.
+func splitInputQuery(input string) (prefix, query string, ok bool) {
+	if parts := strings.SplitN(input, " ", 3); len(parts) == 3 {
+		return parts[0] + " " + parts[1] + " ", parts[2], true
+	}
+	base, query, ok := strings.Cut(input, "?")
+	if !ok {
+		return "", "", false
+	}
+	query, _, _ = strings.Cut(query, "#")
+	return base + "?", query, true
+}
+
+// sideStats counts the requests a side sent and those that yielded
+type sideStats struct {
+	sent    int
+	yielded int
+}
+
+// budgetSplit divides the request budget of the coverage-guided fuzzers
+// between exploration, the fuzzer's own inputs, and exploitation, the
+// payloads sent to every parameter exploration has sent so far. Each
+// request exploits with the configured probability, as long as a point has
+// payloads left. An adaptive split moves that probability every
+// splitWindow requests halfway toward the exploitation side's part of the
+// combined yield per request, a request yielding when it adds a finding,
+// reaches a new path, parameter or response, or, exploring, finds a new
+// injection point. A nil split explores only.
+type budgetSplit struct {
+	payloads []string
+	adaptive bool
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	share  float64           // Probability a request exploits
+	points []*injectionPoint // Points with payloads left, exploited in turn
+	known  map[string]bool   // Points found, by input prefix and parameter
+	cursor int               // Next point exploited
+	window [2]sideStats      // Requests per side since the last rebalancing
+	totals [2]sideStats      // Requests per side in the run
+	rates  [2]float64        // Smoothed yield per request of each side
+}
+
+// newBudgetSplit creates the split Config.ExploitRatio asks for, or nil
+// when it is 0. Exploitation sends the default payloads and the -w
+// wordlist, as the stack selects them; mangled words are for discovery and
+// are left out.
+func newBudgetSplit(config *Config) (*budgetSplit, error) {
+	if config.ExploitRatio <= 0 {
+		return nil, nil
+	}
+	payloads := defaultPayloads()
+	if config.WordlistPath != "" && len(config.WordlistRules) == 0 {
+		words, err := loadWordlist(config.WordlistPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load wordlist: %v", err)
+		}
+		payloads = append(payloads, words...)
+	}
+	return &budgetSplit{
+		payloads: config.Stack.SelectPayloads(payloads),
+		adaptive: config.AdaptiveSplit,
+		logger:   logging.For("split"),
+		share:    config.ExploitRatio,
+		known:    make(map[string]bool),
+		rates:    [2]float64{0.5, 0.5},
+	}, nil
+}
+
+// next returns the input of the next request and the side it is sent for.
+// Explored inputs come from explore.
+func (s *budgetSplit) next(rng *rand.Rand, explore func(rng *rand.Rand) string) (string, int) {
+	if s == nil {
+		return explore(rng), sideExplore
+	}
+	s.mu.Lock()
+	if rng.Float64() < s.share && len(s.points) > 0 {
+		s.cursor %= len(s.points)
+		point := s.points[s.cursor]
+		payload := s.payloads[point.next]
+		if point.next++; point.next == len(s.payloads) {
+			s.points = append(s.points[:s.cursor], s.points[s.cursor+1:]...)
+		} else {
+			s.cursor++
+		}
+		s.mu.Unlock()
+		return point.inject(payload), sideExploit
+	}
+	s.mu.Unlock()
+	return explore(rng), sideExplore
+}
+
+// record counts a request of a side and whether it yielded, registering
+// the injection points of explored inputs, and rebalances an adaptive
+// split once a window is complete
+func (s *budgetSplit) record(input string, side int, yielded bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if side == sideExplore && s.register(input) {
+		yielded = true
+	}
+	for _, stats := range []*sideStats{&s.window[side], &s.totals[side]} {
+		stats.sent++
+		if yielded {
+			stats.yielded++
+		}
+	}
+	if s.adaptive && s.window[sideExplore].sent+s.window[sideExploit].sent >= splitWindow {
+		s.rebalance()
+	}
+}
+
+// register adds the parameters of an input not seen before as injection
+// points, reporting whether there were any
+func (s *budgetSplit) register(input string) bool {
+	prefix, query, ok := splitInputQuery(input)
+	if !ok {
+		return false
+	}
+	added := false
+	for _, param := range queryParamNames(query) {
+		key := prefix + "\x00" + param
+		if !s.known[key] {
+			s.known[key] = true
+			s.points = append(s.points, &injectionPoint{input: input, param: param})
+			added = true
+		}
+	}
+	return added
+}
+
+// rebalance moves the exploitation share halfway toward exploitation's
+// part of the yield rates, within minSideShare of either end. The rates
+// average each window with the ones before, so one dry window does not
+// starve a side; a side that sent nothing keeps its rate.
+func (s *budgetSplit) rebalance() {
+	for side, stats := range s.window {
+		if stats.sent > 0 {
+			s.rates[side] = (s.rates[side] + float64(stats.yielded)/float64(stats.sent)) / 2
+		}
+	}
+	target := 0.5
+	if total := s.rates[sideExplore] + s.rates[sideExploit]; total > 0 {
+		target = s.rates[sideExploit] / total
+	}
+	s.share = min(max((s.share+target)/2, minSideShare), 1-minSideShare)
+	s.logger.Debug("rebalanced budget split", "explore_rate", s.rates[sideExplore],
+		"exploit_rate", s.rates[sideExploit], "exploit_share", s.share)
+	s.window = [2]sideStats{}
+}
+
+// summary logs how the budget was split and what each side yielded
+func (s *budgetSplit) summary() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger.Info("budget split", "explored", s.totals[sideExplore].sent,
+		"explore_yield", s.totals[sideExplore].yielded, "exploited", s.totals[sideExploit].sent,
+		"exploit_yield", s.totals[sideExploit].yielded, "points", len(s.known), "exploit_share", s.share)
+}
@@ -0,0 +1,340 @@
+package fuzzer
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// cacheBusterParam is the query parameter that gives every poisoning probe
+// a cache key of its own, so no other visitor is served a poisoned entry
+const cacheBusterParam = "gfcb"
+
+// cacheHeaders are response headers caching layers describe themselves in
+var cacheHeaders = []string{"X-Cache", "X-Cache-Status", "CF-Cache-Status", "X-Proxy-Cache", "X-Varnish",
+	"X-Drupal-Cache", "X-Cache-Hits", "X-Served-By", "Akamai-Cache-Status", "X-Vercel-Cache", "X-Nextjs-Cache"}
+
+// unkeyedHeader is a request header that caches commonly leave out of the
+// key while the application uses it
+type unkeyedHeader struct {
+	name  string
+	value func(canary string) string
+}
+
+// unkeyedHeaders are tried in turn: host overrides that end up in absolute
+// links and redirects, and URL overrides that make the application serve
+// another path
+var unkeyedHeaders = []unkeyedHeader{
+	{"X-Forwarded-Host", canaryHost},
+	{"X-Host", canaryHost},
+	{"X-Forwarded-Server", canaryHost},
+	{"X-Original-URL", canaryPath},
+	{"X-Rewrite-URL", canaryPath},
+	{"X-Forwarded-Prefix", canaryPath},
+	{"X-Forwarded-Scheme", func(string) string { return "nothttps" }},
+}
+
+// canaryHost returns a host name holding the canary
+func canaryHost(canary string) string {
+	return canary + ".example.com"
+}
+
+// canaryPath returns a path holding the canary
+func canaryPath(canary string) string {
+	return "/" + canary
+}
+
+// deceptionSuffixes make a path look like a static file to a cache while
+// the application still routes it to the page: an extra path segment, a
+// matrix parameter and an encoded slash
+var deceptionSuffixes = []string{"/%s.css", ";%s.css", "%%2F%s.css"}
+
+// cacheState is what a response says about the cache that served it
+type cacheState struct {
+	present bool   // A caching layer answered
+	hit     bool   // The response came from the cache
+	headers string // The headers that tell, for evidence
+}
+
+// cacheStatus reads the caching layer's headers of a response
+func cacheStatus(resp *http.Response) cacheState {
+	var state cacheState
+	var seen []string
+	for _, name := range cacheHeaders {
+		value := resp.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		state.present = true
+		seen = append(seen, name+": "+value)
+		if strings.Contains(strings.ToUpper(value), "HIT") {
+			state.hit = true
+		}
+	}
+	if age := resp.Header.Get("Age"); age != "" {
+		state.present = true
+		seen = append(seen, "Age: "+age)
+		if n, err := strconv.Atoi(age); err == nil && n > 0 {
+			state.hit = true
+		}
+	}
+	if via := resp.Header.Get("Via"); strings.Contains(strings.ToLower(via), "varnish") || strings.Contains(strings.ToLower(via), "cache") {
+		state.present = true
+		seen = append(seen, "Via: "+via)
+	}
+	state.headers = strings.Join(seen, ", ")
+	return state
+}
+
+// CacheTester looks for web cache poisoning and web cache deception. It
+// finds caching layers by their headers, sends headers caches often leave
+// out of the key and checks whether a clean request is then served the
+// poisoned response, and requests pages under static-looking suffixes to
+// see whether a visitor without credentials gets the cached page back.
+type CacheTester struct {
+	config    *Config
+	client    *http.Client // Configured credentials
+	anonymous *http.Client // No credentials
+	rng       *rand.Rand
+	tested    map[string]bool
+	logger    *slog.Logger
+}
+
+// NewCacheTester creates a cache poisoning and deception tester
+func NewCacheTester(config *Config) (*CacheTester, error) {
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+	anonymousConfig := *config
+	anonymousConfig.Headers = nil
+	anonymousConfig.Cookies = nil
+	anonymousConfig.OAuth2 = nil
+	anonymous, err := newHTTPClient(&anonymousConfig, false)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheTester{
+		config:    config,
+		client:    client,
+		anonymous: anonymous,
+		rng:       newRand(runSeed(config), streamCache),
+		tested:    make(map[string]bool),
+		logger:    logging.For("cache"),
+	}, nil
+}
+
+// Run tests the configured target URL
+func (t *CacheTester) Run() error {
+	t.Test([]string{t.config.TargetURL}, t.config.Deadline)
+	return nil
+}
+
+// Test probes every URL, each path once, and stops once the deadline
+// passes if one is set. It returns the number of paths tested.
+func (t *CacheTester) Test(urls []string, deadline time.Time) int {
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	tested := 0
+	for _, targetURL := range urls {
+		parsed, err := url.Parse(targetURL)
+		if err != nil {
+			continue
+		}
+		key := parsed.Host + parsed.Path
+		if t.tested[key] {
+			continue
+		}
+		if expired() {
+			return tested
+		}
+		t.tested[key] = true
+		tested++
+
+		if finding := t.probePoisoning(parsed, expired); finding != nil {
+			t.report(finding)
+		}
+		if finding := t.probeDeception(parsed, expired); finding != nil {
+			t.report(finding)
+		}
+	}
+	return tested
+}
+
+// report records a finding
+func (t *CacheTester) report(finding *Finding) {
+	if t.config.Findings.Add(finding) {
+		t.logger.Warn(finding.Type, "url", finding.URL, "parameter", finding.Parameter, "evidence", finding.Evidence)
+	}
+}
+
+// busted returns u with a fresh cache buster
+func (t *CacheTester) busted(u *url.URL) string {
+	busted := *u
+	query := busted.Query()
+	query.Set(cacheBusterParam, fmt.Sprintf("%08x", t.rng.Uint32()))
+	busted.RawQuery = query.Encode()
+	return busted.String()
+}
+
+// keyedBuster reports whether the cache in front of u keeps responses for
+// repeated requests and includes the buster in its key: the same busted URL
+// is a hit the second time and another one is not. Without both, poisoning
+// probes could reach other visitors or could not be verified.
+func (t *CacheTester) keyedBuster(u *url.URL) (cacheState, bool) {
+	first := t.busted(u)
+	if _, err := fetchProbe(t.client, t.config, first, nil); err != nil {
+		return cacheState{}, false
+	}
+	again, err := fetchProbe(t.client, t.config, first, nil)
+	if err != nil {
+		return cacheState{}, false
+	}
+	state := cacheStatus(again.resp)
+	if !state.hit {
+		if state.present {
+			t.logger.Debug("caching layer does not cache the page", "url", u.String(), "headers", state.headers)
+		}
+		return state, false
+	}
+	other, err := fetchProbe(t.client, t.config, t.busted(u), nil)
+	if err != nil || cacheStatus(other.resp).hit {
+		t.logger.Debug("cache ignores the buster, skipping poisoning probes", "url", u.String())
+		return state, false
+	}
+	return state, true
+}
+
+// probePoisoning sends each unkeyed header with a canary to a busted URL,
+// then requests that URL again without it. A clean request served the
+// canary, or the response the header caused, shows the cache stored a
+// response shaped by a header outside its key.
+func (t *CacheTester) probePoisoning(u *url.URL, expired func() bool) *Finding {
+	state, ok := t.keyedBuster(u)
+	if !ok {
+		return nil
+	}
+	t.logger.Info("caching layer found", "url", u.String(), "headers", state.headers)
+
+	for _, header := range unkeyedHeaders {
+		if expired() {
+			return nil
+		}
+		canary := fmt.Sprintf("gfc%08x", t.rng.Uint32())
+		value := header.value(canary)
+
+		clean, err := fetchProbe(t.client, t.config, t.busted(u), nil)
+		if err != nil {
+			continue
+		}
+		target := t.busted(u)
+		poisoned, err := fetchProbe(t.client, t.config, target, map[string]string{header.name: value})
+		if err != nil {
+			continue
+		}
+		reflected := strings.Contains(string(poisoned.body), canary) ||
+			strings.Contains(poisoned.resp.Header.Get("Location"), canary)
+		if !reflected && poisoned.like(clean) {
+			continue
+		}
+
+		served, err := fetchProbe(t.client, t.config, target, nil)
+		if err != nil {
+			continue
+		}
+		servedCanary := strings.Contains(string(served.body), canary) ||
+			strings.Contains(served.resp.Header.Get("Location"), canary)
+		if !servedCanary && (reflected || !served.like(poisoned) || served.like(clean)) {
+			continue
+		}
+
+		confidence, how := ConfidenceFirm, "the response it caused"
+		if servedCanary {
+			confidence, how = ConfidenceCertain, fmt.Sprintf("the canary %q", canary)
+		}
+		finding := &Finding{
+			Type:       "cache-poisoning",
+			Severity:   SeverityHigh,
+			Confidence: confidence,
+			URL:        target,
+			Method:     http.MethodGet,
+			Parameter:  header.name,
+			Payload:    header.name + ": " + value,
+			Evidence: fmt.Sprintf("%s is left out of the cache key: a request without it is served %s (%s; %s)",
+				header.name, how, served, cacheStatus(served.resp).headers),
+		}
+		captureExchange(finding, poisoned.req, nil, poisoned.resp, poisoned.body)
+		return finding
+	}
+	return nil
+}
+
+// probeDeception requests the page under each static-looking suffix. When
+// the application answers it with the page itself and a request without
+// credentials is then served the same content, though the page on its own
+// path is private, a victim following such a link would have their page
+// cached for anyone to read.
+func (t *CacheTester) probeDeception(u *url.URL, expired func() bool) *Finding {
+	original, err := fetchProbe(t.client, t.config, u.String(), nil)
+	if err != nil || original.resp.StatusCode < 200 || original.resp.StatusCode >= 300 || len(original.body) == 0 {
+		return nil
+	}
+	direct, err := fetchProbe(t.anonymous, t.config, u.String(), nil)
+	if err != nil {
+		return nil
+	}
+	private := !direct.like(original)
+
+	for _, suffix := range deceptionSuffixes {
+		if expired() {
+			return nil
+		}
+		// A fresh file name keeps the probe out of entries others may hit
+		name := fmt.Sprintf("gfc%08x", t.rng.Uint32())
+		deceptiveURL := u.Scheme + "://" + u.Host + strings.TrimSuffix(u.EscapedPath(), "/") + fmt.Sprintf(suffix, name)
+		if u.RawQuery != "" {
+			deceptiveURL += "?" + u.RawQuery
+		}
+
+		authed, err := fetchProbe(t.client, t.config, deceptiveURL, nil)
+		if err != nil || !authed.like(original) {
+			continue
+		}
+		stolen, err := fetchProbe(t.anonymous, t.config, deceptiveURL, nil)
+		if err != nil || !stolen.like(original) {
+			continue
+		}
+		state := cacheStatus(stolen.resp)
+		if !private && !state.hit {
+			continue
+		}
+
+		finding := &Finding{
+			Type:       "cache-deception",
+			Severity:   SeverityHigh,
+			Confidence: ConfidenceFirm,
+			URL:        deceptiveURL,
+			Method:     http.MethodGet,
+			Parameter:  "path",
+			Payload:    deceptiveURL,
+			Evidence: fmt.Sprintf("%s is answered with the page at %s and then served to a request without credentials (%s; %s)",
+				deceptiveURL, u.Path, stolen, state.headers),
+		}
+		if !private {
+			// Public pages only show the cache stores such paths
+			finding.Severity = SeverityLow
+			finding.Evidence += "; the page is public here, but pages with private data under this path scheme would leak"
+		}
+		captureExchange(finding, stolen.req, nil, stolen.resp, stolen.body)
+		return finding
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package fuzzer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Calibration settings
+const (
+	calibrationSamples  = 10              // Sequential requests the latency is measured over
+	calibrationSlowdown = 3               // Median latency growth that marks a concurrency level as too much
+	minTunedTimeout     = 3 * time.Second // Bounds of the timeout derived from the latency
+	maxTunedTimeout     = time.Minute
+)
+
+// Calibration is what a health check measured of the target before a run:
+// whether it answers, how fast, and how many concurrent requests it keeps
+// up with
+type Calibration struct {
+	Requests    int           // Sequential health requests sent
+	Failures    int           // Health requests without an answer or with a 5xx status
+	Median      time.Duration // Latency of the successful health requests
+	P95         time.Duration
+	Max         time.Duration
+	Timeout     time.Duration // Suggested timeout, ten times the 95th percentile latency within 3s and 1m
+	Concurrency int           // Most workers, up to Config.Concurrency, the target served without slowing down
+}
+
+// CalibrateTarget checks that the target answers and measures its latency,
+// first with sequential requests to the target URL and then with growing
+// numbers of concurrent ones, doubling up to Config.Concurrency until the
+// median latency triples or requests fail. It returns an error when no
+// health request succeeded. Retries and the circuit breaker are bypassed so
+// the raw behavior is measured; with a rate limit or politeness the
+// concurrency is not measured.
+func CalibrateTarget(config *Config) (*Calibration, error) {
+	raw := *config
+	raw.DryRun = nil
+	raw.Retry = nil
+	raw.Breaker = nil
+	raw.RateLimit = nil
+	raw.Politeness = nil
+	client, err := newHTTPClient(&raw, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var host string
+	if target, err := url.Parse(config.TargetURL); err == nil {
+		host = target.Host
+	}
+
+	cal := &Calibration{Requests: calibrationSamples, Concurrency: config.Concurrency}
+	var latencies []time.Duration
+	var lastErr error
+	for i := 0; i < calibrationSamples; i++ {
+		if config.RateLimit != nil {
+			config.RateLimit.Wait()
+		}
+		// Paced outside the client, so the wait is not measured as latency
+		release := func() {}
+		if config.Politeness != nil {
+			if release, err = config.Politeness.acquire(context.Background(), host); err != nil {
+				return nil, err
+			}
+		}
+		latency, err := healthRequest(client, config.TargetURL)
+		release()
+		if err != nil {
+			cal.Failures++
+			lastErr = err
+			continue
+		}
+		latencies = append(latencies, latency)
+	}
+	if len(latencies) == 0 {
+		return nil, fmt.Errorf("target failed health check: %d of %d requests failed, last: %v", cal.Failures, cal.Requests, lastErr)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	cal.Median = latencies[len(latencies)/2]
+	cal.P95 = latencies[(len(latencies)*95)/100]
+	cal.Max = latencies[len(latencies)-1]
+	cal.Timeout = min(max(10*cal.P95, minTunedTimeout), maxTunedTimeout)
+
+	if config.RateLimit == nil && config.Politeness == nil {
+		cal.Concurrency = maxConcurrency(client, config.TargetURL, cal.Median, config.Concurrency)
+	}
+	return cal, nil
+}
+
+// maxConcurrency doubles the number of concurrent requests up to limit and
+// returns the last level the target served without failures or slowing
+// down beyond calibrationSlowdown times the sequential median
+func maxConcurrency(client *http.Client, targetURL string, sequential time.Duration, limit int) int {
+	threshold := max(calibrationSlowdown*sequential, sequential+100*time.Millisecond)
+	good := 1
+	for level := 2; good < limit; level *= 2 {
+		level = min(level, limit)
+		latencies, failed := burst(client, targetURL, level)
+		if failed || median(latencies) > threshold {
+			break
+		}
+		good = level
+	}
+	return good
+}
+
+// burst sends two requests per worker from level concurrent workers and
+// returns their latencies, and whether any failed
+func burst(client *http.Client, targetURL string, level int) ([]time.Duration, bool) {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		latencies []time.Duration
+		failed    bool
+	)
+	for w := 0; w < level; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2; i++ {
+				latency, err := healthRequest(client, targetURL)
+				mu.Lock()
+				if err != nil {
+					failed = true
+				} else {
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return latencies, failed
+}
+
+// healthRequest fetches targetURL and returns how long the whole response
+// took. A 5xx status counts as a failure.
+func healthRequest(client *http.Client, targetURL string) (time.Duration, error) {
+	start := time.Now()
+	resp, err := client.Get(targetURL)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20)); err != nil {
+		return 0, fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return 0, fmt.Errorf("HTTP %d response", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
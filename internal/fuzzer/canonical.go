@@ -0,0 +1,90 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// sessionParams match query and path parameters carrying session ids or
+// click tracking, which give every visit its own URL for the same page
+var sessionParams = regexp.MustCompile(`(?i)^(jsessionid|phpsessid|aspsessionid\w*|sid|sessid|sessionid|session_id|sess|cfid|cftoken|zenid|oscsid|utm_\w+|fbclid|gclid|msclkid)$`)
+
+// canonicalURL returns the key a crawled URL is deduplicated by: the scheme
+// and host lower-cased, the default port, the fragment and a trailing slash
+// dropped, session and tracking parameters removed from the query and path
+// and the query sorted by name. With wildcard set, query values are
+// replaced by *, so URLs differing only in them are one page. URLs that do
+// not parse are returned as they are.
+func canonicalURL(raw string, wildcard bool) string {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return raw
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = canonicalHost(parsed)
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	// Path parameters, e.g. /cart;jsessionid=..., go the way of the query's
+	segments := strings.Split(parsed.Path, "/")
+	for i, segment := range segments {
+		name, rest, found := strings.Cut(segment, ";")
+		if !found {
+			continue
+		}
+		kept := []string{name}
+		for _, param := range strings.Split(rest, ";") {
+			key, _, _ := strings.Cut(param, "=")
+			if !sessionParams.MatchString(key) {
+				kept = append(kept, param)
+			}
+		}
+		segments[i] = strings.Join(kept, ";")
+	}
+	parsed.Path = strings.TrimSuffix(strings.Join(segments, "/"), "/")
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	parsed.RawPath = ""
+
+	query := parsed.Query()
+	for name, values := range query {
+		if sessionParams.MatchString(name) {
+			delete(query, name)
+			continue
+		}
+		if wildcard {
+			for i := range values {
+				values[i] = "*"
+			}
+		}
+	}
+	parsed.RawQuery = query.Encode() // Sorted by name
+	return parsed.String()
+}
+
+// canonicalHost returns the host of u lower-cased and without the scheme's
+// default port, keeping the brackets of an IPv6 literal, so
+// http://[::1]:80/ and http://[::1]/ are on the same host
+func canonicalHost(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		host := strings.ToLower(u.Hostname())
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return strings.ToLower(u.Host)
+}
+
+// checkHost rejects a target URL host holding an IPv6 literal without
+// brackets, which parses with the literal's last group taken for the port
+func checkHost(u *url.URL) error {
+	if strings.Count(u.Host, ":") > 1 && !strings.HasPrefix(u.Host, "[") {
+		return fmt.Errorf("IPv6 address in host %s must be enclosed in brackets, e.g. %s://[::1]:8080/", u.Host, u.Scheme)
+	}
+	return nil
+}
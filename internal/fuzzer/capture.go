@@ -0,0 +1,119 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxCapturedBody limits how much of a body is kept as evidence
+const maxCapturedBody = 4096
+
+// captureExchange stores the raw request and response on the finding together
+// with a curl command that reproduces the request. Bodies are truncated to
+// maxCapturedBody bytes.
+func captureExchange(f *Finding, req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) {
+	if req != nil {
+		if dump, err := httputil.DumpRequestOut(req, false); err == nil {
+			f.Request = string(dump) + string(truncateBody(reqBody))
+		}
+		if f.Method == "" {
+			f.Method = req.Method
+		}
+		f.Curl = curlCommand(req, reqBody)
+	}
+	if resp != nil {
+		if dump, err := httputil.DumpResponse(resp, false); err == nil {
+			f.Response = string(dump) + string(truncateBody(respBody))
+		}
+	}
+}
+
+// truncateBody caps a body at maxCapturedBody bytes, noting how much was cut
+func truncateBody(body []byte) []byte {
+	if len(body) > maxCapturedBody {
+		note := fmt.Sprintf("\n[truncated %d of %d bytes]", len(body)-maxCapturedBody, len(body))
+		return append(body[:maxCapturedBody:maxCapturedBody], note...)
+	}
+	return body
+}
+
+// curlCommand builds a shell command line that replays the request
+func curlCommand(req *http.Request, body []byte) string {
+	parts := []string{"curl", "-i", "-s", "--path-as-is", "-X", req.Method}
+
+	// Sort header names so the command is stable across runs
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			parts = append(parts, "-H", shellQuote(name+": "+value))
+		}
+	}
+	if req.Host != "" && req.URL != nil && req.Host != req.URL.Host {
+		parts = append(parts, "-H", shellQuote("Host: "+req.Host))
+	}
+
+	if len(body) > 0 {
+		parts = append(parts, "--data-binary", shellQuote(string(body)))
+	}
+
+	if req.URL != nil {
+		parts = append(parts, shellQuote(req.URL.String()))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote wraps s in single quotes for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// WriteCaptures writes the raw exchange of every finding that has one into
+// dir, one file per finding, and records the file name on the finding
+func (s *FindingStore) WriteCaptures(dir string) error {
+	findings := s.Findings()
+	if len(findings) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create capture directory: %v", err)
+	}
+
+	for i, f := range findings {
+		if f.Request == "" && f.Response == "" {
+			continue
+		}
+
+		name := fmt.Sprintf("%04d-%s.http", i+1, f.Type)
+		var b strings.Builder
+		fmt.Fprintf(&b, "# %s (%s, %s) %s\n", f.Type, f.Severity, f.Confidence, f.URL)
+		if f.Curl != "" {
+			fmt.Fprintf(&b, "# Reproduce: %s\n", f.Curl)
+		}
+		b.WriteString("\n")
+		b.WriteString(f.Request)
+		b.WriteString("\n\n")
+		b.WriteString(f.Response)
+		b.WriteString("\n")
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(b.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write capture: %v", err)
+		}
+
+		s.mu.Lock()
+		f.CaptureFile = filepath.Join(filepath.Base(dir), name)
+		s.mu.Unlock()
+	}
+
+	return nil
+}
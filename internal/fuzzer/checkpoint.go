@@ -0,0 +1,100 @@
+package fuzzer
+
+import (
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+// defaultCheckpointInterval is how often a time-boxed run reports progress
+// when Config.CheckpointInterval is not set
+const defaultCheckpointInterval = time.Minute
+
+// checkpointer periodically logs an interim summary of a time-boxed run and
+// checkpoints its state: the findings so far and, for fuzzers keeping one,
+// the corpus. A run cut short then still leaves its results behind.
+type checkpointer struct {
+	config  *Config
+	logger  *slog.Logger
+	started time.Time
+	budget  *requestBudget
+	corpus  func() []string // Current corpus, nil when the fuzzer keeps none
+	summary func() []any    // Coverage attributes for the progress record, may be nil
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// startCheckpoints starts checkpointing a fuzzer's run. It returns nil,
+// which is safe to stop, unless the run is time-boxed by Config.Duration.
+func startCheckpoints(config *Config, logger *slog.Logger, budget *requestBudget,
+	corpus func() []string, summary func() []any) *checkpointer {
+	if config.Duration <= 0 {
+		return nil
+	}
+	interval := config.CheckpointInterval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+
+	c := &checkpointer{
+		config:  config,
+		logger:  logger,
+		started: time.Now(),
+		budget:  budget,
+		corpus:  corpus,
+		summary: summary,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.checkpoint()
+			}
+		}
+	}()
+	return c
+}
+
+// Stop ends checkpointing and writes a final checkpoint
+func (c *checkpointer) Stop() {
+	if c == nil {
+		return
+	}
+	close(c.stop)
+	<-c.done
+	c.checkpoint()
+}
+
+// checkpoint logs the progress summary and saves the run's state
+func (c *checkpointer) checkpoint() {
+	attrs := []any{
+		"elapsed", time.Since(c.started).Round(time.Second),
+		"requests", c.budget.used(),
+		"findings", c.config.Findings.Count(),
+	}
+	if !c.config.Deadline.IsZero() {
+		attrs = append(attrs, "remaining", max(time.Until(c.config.Deadline), 0).Round(time.Second))
+	}
+	if c.summary != nil {
+		attrs = append(attrs, c.summary()...)
+	}
+	c.logger.Info("progress", attrs...)
+
+	if c.config.Findings != nil {
+		if err := c.config.Findings.Save(filepath.Join(c.config.OutputDir, "findings.jsonl")); err != nil {
+			c.logger.Error("failed to checkpoint findings", "error", err)
+		}
+	}
+	if c.corpus != nil {
+		if err := SaveCorpus(filepath.Join(c.config.OutputDir, "corpus.txt"), c.corpus()); err != nil {
+			c.logger.Error("failed to checkpoint corpus", "error", err)
+		}
+	}
+}
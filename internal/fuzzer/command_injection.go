@@ -0,0 +1,191 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// commandDelay is how long the sleep payloads ask the target to pause
+	commandDelay = 5 * time.Second
+
+	// commandConfirmDelay is the shorter pause a timing hit is confirmed with
+	commandConfirmDelay = 2 * time.Second
+
+	// commandDelaySlack is how much sooner than asked a delayed response
+	// may arrive and still count
+	commandDelaySlack = 500 * time.Millisecond
+)
+
+// commandSeparator chains an injected command after the original value on
+// one operating system's shell. %s stands for the command.
+type commandSeparator struct {
+	os       string
+	template string
+}
+
+// commandSeparators cover the usual ways of breaking out of a shell argument
+var commandSeparators = []commandSeparator{
+	{"linux", ";%s"},
+	{"linux", "|%s"},
+	{"linux", "&&%s"},
+	{"linux", "\n%s"},
+	{"linux", "$(%s)"},
+	{"linux", "`%s`"},
+	{"windows", "&%s"},
+	{"windows", "|%s"},
+	{"windows", "&&%s"},
+}
+
+// echoCommand returns a command printing canary, written so that the text
+// of the command does not contain the canary: the shell removes the empty
+// quotes (sh) or the caret escape (cmd), a plain reflection keeps them
+func echoCommand(os, canary string) string {
+	split := len(canary) / 2
+	if os == "windows" {
+		return "echo " + canary[:split] + "^" + canary[split:]
+	}
+	return "echo " + canary[:split] + "''" + canary[split:]
+}
+
+// sleepCommand returns a command pausing for delay
+func sleepCommand(os string, delay time.Duration) string {
+	seconds := int(delay / time.Second)
+	if os == "windows" {
+		// ping waits a second between its echo requests
+		return fmt.Sprintf("ping -n %d 127.0.0.1", seconds+1)
+	}
+	return fmt.Sprintf("sleep %d", seconds)
+}
+
+// probeCommandInjection appends shell commands to one query parameter. A
+// command echoing a unique canary that shows up in the response confirms
+// injection; otherwise sleep commands are timed against the normal latency,
+// and a delay that scales down with a shorter sleep confirms it blind. The
+// timed requests go through a client of their own, sending each once.
+func probeCommandInjection(client *http.Client, config *Config, rng *rand.Rand, targetURL, param string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	original := parsed.Query().Get(param)
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	withValue := func(value string) string {
+		u := *parsed
+		query := u.Query()
+		query.Set(param, value)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+
+	canary := fmt.Sprintf("gfc%08x", rng.Uint32())
+	for _, separator := range commandSeparators {
+		if expired() {
+			return nil, nil
+		}
+		payload := original + fmt.Sprintf(separator.template, echoCommand(separator.os, canary))
+		req, resp, body, _, err := timedGet(client, config, withValue(payload))
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(body), canary) {
+			finding := &Finding{
+				Type:       "command-injection",
+				Severity:   SeverityCritical,
+				Confidence: ConfidenceCertain,
+				URL:        req.URL.String(),
+				Method:     req.Method,
+				Parameter:  param,
+				Payload:    payload,
+				Evidence:   fmt.Sprintf("output of injected %s echo command (%s) in response", separator.os, canary),
+			}
+			captureExchange(finding, req, nil, resp, body)
+			return finding, nil
+		}
+	}
+
+	// Sleeping must fit in the request timeout, with room for the response
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultClientTimeout
+	}
+	delay := min(commandDelay, timeout/2)
+	if delay <= commandConfirmDelay {
+		return nil, nil
+	}
+	client, err = newTimingClient(config, client, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// The slower of two plain requests is the latency to beat
+	var baseline time.Duration
+	for i := 0; i < 2; i++ {
+		_, _, _, elapsed, err := timedGet(client, config, withValue(original))
+		if err != nil {
+			return nil, err
+		}
+		baseline = max(baseline, elapsed)
+	}
+
+	for _, separator := range commandSeparators {
+		if expired() {
+			return nil, nil
+		}
+		payload := original + fmt.Sprintf(separator.template, sleepCommand(separator.os, delay))
+		_, _, _, elapsed, err := timedGet(client, config, withValue(payload))
+		if err != nil || elapsed < baseline+delay-commandDelaySlack {
+			continue
+		}
+
+		// A slow server would be slow for the shorter sleep too; a sleeping
+		// one answers sooner
+		confirm := original + fmt.Sprintf(separator.template, sleepCommand(separator.os, commandConfirmDelay))
+		req, resp, body, confirmed, err := timedGet(client, config, withValue(confirm))
+		if err != nil || confirmed < baseline+commandConfirmDelay-commandDelaySlack || confirmed >= elapsed-commandDelaySlack {
+			continue
+		}
+		finding := &Finding{
+			Type:       "command-injection",
+			Severity:   SeverityCritical,
+			Confidence: ConfidenceFirm,
+			URL:        req.URL.String(),
+			Method:     req.Method,
+			Parameter:  param,
+			Payload:    payload,
+			Evidence: fmt.Sprintf("%s sleep commands delay the response: %v for %v, %v for %v, against %v normally",
+				separator.os, elapsed.Round(time.Millisecond), delay, confirmed.Round(time.Millisecond),
+				commandConfirmDelay, baseline.Round(time.Millisecond)),
+		}
+		captureExchange(finding, req, nil, resp, body)
+		return finding, nil
+	}
+	return nil, nil
+}
+
+// timedGet sends a GET request and returns the response with its body and
+// how long the whole exchange took from asking for a connection
+func timedGet(client *http.Client, config *Config, targetURL string) (*http.Request, *http.Response, []byte, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	req, elapsed := startClock(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	return req, resp, body.data, elapsed(), nil
+}
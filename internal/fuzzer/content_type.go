@@ -0,0 +1,224 @@
+package fuzzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// minEchoMarker is the shortest body value used to recognize a request
+	// echoed in a response
+	minEchoMarker = 4
+
+	// xmlEncodingName names the XML body encoding
+	xmlEncodingName = "xml"
+)
+
+// bodyEncoding is one way of sending the logical content of a JSON body
+type bodyEncoding struct {
+	name     string
+	severity Severity
+	risk     string                                            // Why accepting it matters
+	encode   func(doc map[string]interface{}) ([]byte, string) // Returns the body and its Content-Type
+}
+
+// xmlBodyEncoding sends the body as an XML document
+var xmlBodyEncoding = bodyEncoding{xmlEncodingName, SeverityMedium, "XML parsers may resolve external entities (XXE)", xmlEncoding}
+
+// bodyEncodings are the formats a JSON endpoint is tried with
+var bodyEncodings = []bodyEncoding{
+	xmlBodyEncoding,
+	{"form", SeverityLow, "form bodies can be sent cross-site without a CORS preflight", formEncoding},
+	{"multipart", SeverityLow, "multipart bodies can be sent cross-site without a CORS preflight", multipartEncoding},
+	{"json-as-text", SeverityMedium, "JSON labelled text/plain can be sent cross-site without a CORS preflight (CSRF)",
+		mislabelledJSON("text/plain")},
+	{"json-as-form", SeverityMedium, "JSON labelled as a form can be sent cross-site without a CORS preflight (CSRF)",
+		mislabelledJSON("application/x-www-form-urlencoded")},
+}
+
+// testContentTypes resends the valid base body in other formats and with
+// mismatched Content-Type headers, and reports the formats the endpoint
+// parses as if they were its JSON. A format counts as parsed when it gets
+// the JSON body's successful response and an empty body of the same type
+// does not, or when the response echoes values of the body as the JSON
+// response does.
+func (f *APIFuzzer) testContentTypes(base map[string]interface{}) {
+	switch f.endpoint.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+
+	resp, respBody, ok := f.acceptedBody(base)
+	if !ok {
+		return
+	}
+	for _, encoding := range bodyEncodings {
+		parsed := f.parsesEncoding(encoding, base, resp, respBody)
+		if encoding.name == xmlEncodingName {
+			f.xmlTested, f.xmlParsed = true, parsed != nil
+		}
+		if parsed == nil {
+			continue
+		}
+
+		finding := &Finding{
+			Type:       "content-type-confusion",
+			Severity:   encoding.severity,
+			Confidence: ConfidenceFirm,
+			URL:        f.endpoint.URL,
+			Method:     f.endpoint.Method,
+			Parameter:  encoding.name,
+			Payload:    string(parsed.body),
+			Evidence:   fmt.Sprintf("accepts %s (%s): %s; %s", encoding.name, parsed.mediaType, parsed.evidence, encoding.risk),
+			Timestamp:  time.Now(),
+		}
+		captureExchange(finding, parsed.req, parsed.body, parsed.resp, parsed.respBody)
+		if f.config.Findings.Add(finding) {
+			f.logger.Warn("content type confusion", "encoding", encoding.name, "content_type", parsed.mediaType)
+		}
+	}
+}
+
+// parsedEncoding is the exchange showing that an endpoint parses a format
+type parsedEncoding struct {
+	req       *http.Request
+	body      []byte
+	resp      *http.Response
+	respBody  []byte
+	mediaType string
+	evidence  string
+}
+
+// parsesEncoding sends the base body in the given encoding and returns the
+// exchange when the endpoint answers it like the accepted JSON body, or nil
+func (f *APIFuzzer) parsesEncoding(encoding bodyEncoding, base map[string]interface{}, resp *http.Response, respBody []byte) *parsedEncoding {
+	shape := responseShape(resp.Header.Get("Content-Type"), respBody)
+	variant, contentType := encoding.encode(base)
+	mediaType, _, _ := strings.Cut(contentType, ";")
+
+	req, vresp, vbody, err := f.exchangeAs(variant, contentType)
+	if err != nil {
+		f.logger.Debug("content type request failed", "encoding", encoding.name, "error", err)
+		return nil
+	}
+	if vresp.StatusCode != resp.StatusCode || responseShape(vresp.Header.Get("Content-Type"), vbody) != shape {
+		return nil
+	}
+
+	parsed := &parsedEncoding{req: req, body: variant, resp: vresp, respBody: vbody, mediaType: mediaType}
+	echoed := echoMarkers(base, respBody)
+	if markers := echoMarkers(base, vbody); len(echoed) > 0 && len(markers) == len(echoed) {
+		parsed.evidence = fmt.Sprintf("the response echoes the body's values (%s) as it does for JSON", strings.Join(markers, ", "))
+		return parsed
+	}
+
+	_, cresp, cbody, err := f.exchangeAs(nil, contentType)
+	if err != nil || (cresp.StatusCode == resp.StatusCode &&
+		responseShape(cresp.Header.Get("Content-Type"), cbody) == shape) {
+		// The endpoint answers the same without a body, so it proves nothing
+		return nil
+	}
+	parsed.evidence = fmt.Sprintf("HTTP %d like the JSON body, while an empty %s body gets HTTP %d",
+		vresp.StatusCode, mediaType, cresp.StatusCode)
+	return parsed
+}
+
+// exchangeAs sends body to the endpoint with the given Content-Type
+func (f *APIFuzzer) exchangeAs(body []byte, contentType string) (*http.Request, *http.Response, []byte, error) {
+	return f.exchangeWith(f.endpoint.Method, f.endpoint.URL, body, contentType)
+}
+
+// echoMarkers returns the string values of doc, long enough to be told
+// apart from chance matches, that appear in the response body
+func echoMarkers(doc map[string]interface{}, respBody []byte) []string {
+	var markers []string
+	for _, key := range sortedKeys(doc) {
+		value, ok := doc[key].(string)
+		if ok && len(value) >= minEchoMarker && bytes.Contains(respBody, []byte(value)) {
+			markers = append(markers, value)
+		}
+	}
+	return markers
+}
+
+// xmlEncoding renders doc as an XML document with one element per field
+func xmlEncoding(doc map[string]interface{}) ([]byte, string) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	writeXMLElement(&buf, "request", doc)
+	return buf.Bytes(), "application/xml"
+}
+
+// writeXMLElement writes value as an element named name. Arrays repeat the
+// element once per item.
+func writeXMLElement(buf *bytes.Buffer, name string, value interface{}) {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			writeXMLElement(buf, name, item)
+		}
+		return
+	}
+
+	fmt.Fprintf(buf, "<%s>", name)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			writeXMLElement(buf, key, v[key])
+		}
+	case nil:
+	default:
+		xml.EscapeText(buf, []byte(fmt.Sprint(v)))
+	}
+	fmt.Fprintf(buf, "</%s>", name)
+}
+
+// formEncoding renders doc as a URL-encoded form; nested values are sent as
+// JSON
+func formEncoding(doc map[string]interface{}) ([]byte, string) {
+	form := url.Values{}
+	for _, key := range sortedKeys(doc) {
+		form.Set(key, formValue(doc[key]))
+	}
+	return []byte(form.Encode()), "application/x-www-form-urlencoded"
+}
+
+// multipartEncoding renders doc as multipart form data; nested values are
+// sent as JSON
+func multipartEncoding(doc map[string]interface{}) ([]byte, string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, key := range sortedKeys(doc) {
+		writer.WriteField(key, formValue(doc[key]))
+	}
+	writer.Close()
+	return buf.Bytes(), writer.FormDataContentType()
+}
+
+// formValue renders a JSON value as a form field value
+func formValue(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// mislabelledJSON sends the JSON body under another Content-Type
+func mislabelledJSON(contentType string) func(map[string]interface{}) ([]byte, string) {
+	return func(doc map[string]interface{}) ([]byte, string) {
+		data, _ := json.Marshal(doc)
+		return data, contentType
+	}
+}
@@ -0,0 +1,207 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Contract rules the negative-testing matrix breaks, one per test case
+const (
+	ruleMissingRequired = "missing-required" // A required parameter is left out
+	ruleNull            = "null"             // A required parameter is null
+	ruleWrongType       = "wrong-type"       // A value of another type than declared
+	ruleOutOfBounds     = "out-of-bounds"    // A value just outside the declared bounds or lengths
+	ruleFormat          = "format"           // A value breaking the declared format or pattern
+	ruleEnum            = "enum"             // A value outside the declared enum
+	ruleExtraField      = "extra-field"      // A parameter the endpoint does not declare
+	ruleEdgeCase        = "edge-case"        // Attack strings and extreme values no rule forbids
+)
+
+// ruleDescriptions describe what a test case breaking each rule sends
+var ruleDescriptions = map[string]string{
+	ruleMissingRequired: "required parameter left out",
+	ruleNull:            "null for a required parameter",
+	ruleWrongType:       "value of the wrong type",
+	ruleOutOfBounds:     "value outside the declared bounds",
+	ruleFormat:          "value breaking the declared format",
+	ruleEnum:            "value outside the declared enum",
+	ruleExtraField:      "undeclared parameter",
+}
+
+// extraFieldName is the undeclared parameter the extra-field case adds
+const extraFieldName = "gofuzz_extra"
+
+// apiTestCase is one request of the negative-testing matrix: values for the
+// endpoint's parameters, the contract rule they break and the parameter
+// breaking it. The valid base case breaks none.
+type apiTestCase struct {
+	values map[string]interface{}
+	rule   string
+	param  string
+}
+
+// generateTestCases returns the valid base case, with valid values for every
+// parameter, followed by the negative-testing matrix: for each parameter the
+// base case with it left out, null, of the wrong type, just outside its
+// bounds, breaking its format, pattern or enum and
+// set to attack strings and extreme values, and once the base case with an
+// undeclared parameter added
+func (f *APIFuzzer) generateTestCases() []apiTestCase {
+	base := make(map[string]interface{})
+	for _, name := range sortedKeys(f.endpoint.Params) {
+		param := f.endpoint.Params[name]
+		base[name] = f.generateValidValue(param)
+
+		// Strings of no known format take a real value seen for the name, or
+		// one of the kind the name suggests, else follow the learned format
+		if param.Type == "string" && param.Format == "" && len(param.Enum) == 0 {
+			if value, ok := f.config.Learner.Sample(f.rng, name); ok {
+				base[name] = value
+			} else if value, ok := f.config.Learner.Generate(f.rng, name); ok {
+				base[name] = value
+			}
+		}
+		// Integer IDs seen for the name are likelier to exist than random ones
+		if param.Type == "int" && len(param.Enum) == 0 {
+			if value, ok := f.config.Learner.Sample(f.rng, name); ok {
+				n, err := strconv.Atoi(value)
+				if err == nil && (!param.HasMin || float64(n) >= param.MinValue) && (!param.HasMax || float64(n) <= param.MaxValue) {
+					base[name] = n
+				}
+			}
+		}
+	}
+	testCases := []apiTestCase{{values: base}}
+
+	add := func(rule, name string, value interface{}) {
+		values := copyMap(base)
+		values[name] = value
+		testCases = append(testCases, apiTestCase{values: values, rule: rule, param: name})
+	}
+	query := f.endpoint.Method == "" || f.endpoint.Method == http.MethodGet
+	for _, name := range sortedKeys(f.endpoint.Params) {
+		param := f.endpoint.Params[name]
+
+		if param.Required {
+			values := copyMap(base)
+			delete(values, name)
+			testCases = append(testCases, apiTestCase{values: values, rule: ruleMissingRequired, param: name})
+			if !query {
+				add(ruleNull, name, nil) // Query strings have no null
+			}
+		}
+		if value, ok := wrongType(param, query); ok {
+			add(ruleWrongType, name, value)
+		}
+		for _, value := range outOfBounds(param.bounds()) {
+			// Numbers stay numbers in JSON bodies
+			if n, err := strconv.ParseFloat(value, 64); err == nil && (param.Type == "int" || param.Type == "float") {
+				add(ruleOutOfBounds, name, n)
+				continue
+			}
+			add(ruleOutOfBounds, name, value)
+		}
+		if value, ok := formatViolation(param); ok {
+			add(ruleFormat, name, value)
+		}
+		if len(param.Enum) > 0 && param.Type != "array" && param.Type != "object" {
+			add(ruleEnum, name, "not_in_enum")
+		}
+		for _, value := range f.generateEdgeCases(param) {
+			add(ruleEdgeCase, name, value)
+		}
+	}
+	if _, declared := f.endpoint.Params[extraFieldName]; !declared {
+		add(ruleExtraField, extraFieldName, "unexpected")
+	}
+	return testCases
+}
+
+// wrongType returns a value of another type than the parameter's. In query
+// strings every value is text, so only parameters of other types get one.
+func wrongType(param ParamType, query bool) (interface{}, bool) {
+	switch param.Type {
+	case "int", "float":
+		return "not_a_number", true
+	case "bool":
+		return "not_a_bool", true
+	case "string":
+		return 12345, !query
+	case "array":
+		return "not_an_array", !query
+	case "object":
+		return "not_an_object", !query
+	}
+	return nil, false
+}
+
+// patternViolations are tried in turn for a value a declared pattern rejects
+var patternViolations = []string{"!@#$%^&*", "gofuzz", "0", " ", strings.Repeat("a", 300)}
+
+// formatViolation returns a value breaking the parameter's declared format
+// or pattern
+func formatViolation(param ParamType) (interface{}, bool) {
+	switch param.Format {
+	case "email":
+		return "not-an-email", true
+	case "date":
+		return "2024-13-45", true
+	case "date-time":
+		return "yesterday", true
+	case "uuid":
+		return "not-a-uuid", true
+	case "uri", "url":
+		return "not a uri", true
+	case "ipv4":
+		return "999.999.999.999", true
+	}
+	if param.Pattern == "" {
+		return nil, false
+	}
+	pattern, err := regexp.Compile("^(?:" + param.Pattern + ")$")
+	if err != nil {
+		return nil, false
+	}
+	for _, candidate := range patternViolations {
+		if !pattern.MatchString(candidate) {
+			return candidate, true
+		}
+	}
+	return nil, false
+}
+
+// checkContract reports a test case breaking a rule of a declared contract
+// that the endpoint accepted, answering 2xx, as the rule the server failed
+// to enforce. Endpoints without a spec have no contract to hold them to.
+func (f *APIFuzzer) checkContract(testCase apiTestCase, exchange *probeResponse) {
+	description, ok := ruleDescriptions[testCase.rule]
+	if !ok || !f.endpoint.Declared {
+		return
+	}
+	status := exchange.resp.StatusCode
+	if status < 200 || status >= 300 {
+		return
+	}
+
+	severity := SeverityLow
+	if testCase.rule == ruleExtraField {
+		severity = SeverityInfo // Ignoring unknown fields is common and harmless
+	}
+	payload, _ := json.Marshal(testCase.values)
+	finding := &Finding{
+		Type:       "contract-" + testCase.rule,
+		Severity:   severity,
+		Confidence: ConfidenceFirm,
+		URL:        f.endpoint.URL,
+		Method:     f.endpoint.Method,
+		Parameter:  testCase.param,
+		Payload:    string(payload),
+		Evidence:   fmt.Sprintf("%s accepted with HTTP %d instead of rejected with 4xx", description, status),
+	}
+	captureExchange(finding, exchange.req, exchange.reqBody, exchange.resp, exchange.body)
+	f.config.Findings.Add(finding)
+}
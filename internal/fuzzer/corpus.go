@@ -0,0 +1,99 @@
+package fuzzer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// LoadCorpus reads corpus inputs, one per line. Blank lines are skipped.
+func LoadCorpus(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open corpus: %v", err)
+	}
+	defer file.Close()
+
+	var inputs []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); strings.TrimSpace(line) != "" {
+			inputs = append(inputs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %v", err)
+	}
+	return inputs, nil
+}
+
+// SaveCorpus writes corpus inputs, one per line
+func SaveCorpus(path string, inputs []string) error {
+	var b strings.Builder
+	for _, input := range inputs {
+		b.WriteString(input)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write corpus: %v", err)
+	}
+	return nil
+}
+
+// MinimizeCorpus replays corpus inputs against the target and returns the
+// subset reaching the same coverage: an input is kept when it reaches a
+// path, parameter name, status or response no earlier input did. New
+// values of known parameters alone do not keep an input. Inputs are replayed
+// shortest first, so each behavior is kept with its shortest trigger.
+// Inputs that are not absolute URLs are appended to the target URL, as the
+// coverage fuzzers do.
+func MinimizeCorpus(config *Config, inputs []string) ([]string, error) {
+	client, err := newHTTPClient(config, true)
+	if err != nil {
+		return nil, err
+	}
+	logger := logging.For("corpus")
+	coverage := NewCoverage()
+	coverage.SetMaxFingerprints(config.MaxFingerprints)
+
+	seen := make(map[string]bool)
+	var ordered []string
+	for _, input := range inputs {
+		if !seen[input] {
+			seen[input] = true
+			ordered = append(ordered, input)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return len(ordered[i]) < len(ordered[j])
+	})
+
+	var kept []string
+	for _, input := range ordered {
+		fullURL := input
+		if !isAbsoluteURL(input) {
+			fullURL = config.TargetURL + input
+		}
+		resp, err := client.Get(fullURL)
+		if err != nil {
+			logger.Debug("replay failed", "url", fullURL, "error", err)
+			continue
+		}
+		before := coverage.surface()
+		coverage.TrackURL(fullURL)
+		newResponse := coverage.TrackResponse(resp)
+		resp.Body.Close()
+
+		if newResponse || coverage.surface() > before {
+			kept = append(kept, input)
+		}
+	}
+
+	logger.Info("corpus minimized", "inputs", len(inputs), "kept", len(kept))
+	return kept, nil
+}
@@ -1,9 +1,6 @@
 package fuzzer
 
 import (
-	"crypto/sha256"
-	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"sort"
@@ -12,8 +9,8 @@ import (
 
 // Coverage tracks which parts of the application have been tested
 type Coverage struct {
-	// Map of response hash to count of times seen
-	responses map[string]int
+	// Similarity index of response bodies, bounded in size
+	responses *responseIndex
 	// Map of status code to count of times seen
 	statusCodes map[int]int
 	// Map of unique paths tested
@@ -29,7 +26,7 @@ type Coverage struct {
 // NewCoverage creates a new Coverage tracker
 func NewCoverage() *Coverage {
 	return &Coverage{
-		responses:   make(map[string]int),
+		responses:   newResponseIndex(defaultMaxFingerprints),
 		statusCodes: make(map[int]int),
 		paths:       make(map[string]bool),
 		params:      make(map[string]bool),
@@ -37,6 +34,14 @@ func NewCoverage() *Coverage {
 	}
 }
 
+// SetMaxFingerprints bounds how many response fingerprints are kept for
+// similarity dedup (0 = default). Previously tracked responses are discarded.
+func (c *Coverage) SetMaxFingerprints(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses = newResponseIndex(max)
+}
+
 // TrackResponse records a response and returns true if it's new
 func (c *Coverage) TrackResponse(resp *http.Response) bool {
 	c.mu.Lock()
@@ -50,37 +55,42 @@ func (c *Coverage) TrackResponse(resp *http.Response) bool {
 	}
 	c.statusCodes[resp.StatusCode]++
 
-	// Track response body hash
-	body, err := io.ReadAll(resp.Body)
+	// Track the response body by similarity, so pages differing only in
+	// timestamps or tokens are not counted as new
+	body, err := readLimited(resp.Body, defaultMaxBodySize)
 	if err != nil {
 		return isNew
 	}
 	resp.Body.Close()
 
-	hash := fmt.Sprintf("%x", sha256.Sum256(body))
-	if _, exists := c.responses[hash]; !exists {
+	if c.responses.add(simhash(body.data)) {
 		isNew = true
 	}
-	c.responses[hash]++
 
 	return isNew
 }
 
 // TrackURL records URL components and returns true if anything is new
 func (c *Coverage) TrackURL(urlStr string) bool {
+	isNew, _ := c.trackURL(urlStr)
+	return isNew
+}
+
+// trackURL records URL components and reports whether anything is new, and
+// whether a path or parameter is, which unlike a value grows the surface
+func (c *Coverage) trackURL(urlStr string) (isNew, grew bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	isNew := false
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return false
+		return false, false
 	}
 
 	// Track path
 	if !c.paths[parsedURL.Path] {
 		c.paths[parsedURL.Path] = true
-		isNew = true
+		isNew, grew = true, true
 	}
 
 	// Track query parameters and values
@@ -88,7 +98,7 @@ func (c *Coverage) TrackURL(urlStr string) bool {
 	for param, values := range query {
 		if !c.params[param] {
 			c.params[param] = true
-			isNew = true
+			isNew, grew = true, true
 		}
 
 		if c.values[param] == nil {
@@ -103,7 +113,7 @@ func (c *Coverage) TrackURL(urlStr string) bool {
 		}
 	}
 
-	return isNew
+	return isNew, grew
 }
 
 // GetStats returns coverage statistics
@@ -114,7 +124,7 @@ func (c *Coverage) GetStats() map[string]interface{} {
 	stats := make(map[string]interface{})
 
 	// Unique responses seen
-	stats["unique_responses"] = len(c.responses)
+	stats["unique_responses"] = c.responses.unique
 
 	// Status code distribution
 	statusDist := make(map[int]int)
@@ -151,7 +161,16 @@ func (c *Coverage) GetStats() map[string]interface{} {
 func (c *Coverage) GetUniqueResponseCount() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return len(c.responses)
+	return c.responses.unique
+}
+
+// surface returns the number of paths, parameters and distinct responses
+// seen, which grows when a request reaches something new but not with new
+// parameter values alone
+func (c *Coverage) surface() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.paths) + len(c.params) + c.responses.unique
 }
 
 // GetUniquePaths returns all unique paths tested
@@ -238,7 +257,7 @@ func (c *Coverage) Reset() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.responses = make(map[string]int)
+	c.responses = newResponseIndex(c.responses.max)
 	c.statusCodes = make(map[int]int)
 	c.paths = make(map[string]bool)
 	c.params = make(map[string]bool)
@@ -1,13 +1,19 @@
 package fuzzer
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"sync"
 	"time"
 
-	"fuzzer/internal/html"
+	"github.com/gregcmartin/gofuzz/internal/html"
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // CoverageFuzzer implements coverage-guided fuzzing for web applications
@@ -30,18 +36,23 @@ type CoverageFuzzer struct {
 	// Interesting inputs that led to new coverage
 	corpus []string
 
+	// Request budget shared with other fuzzers; nil for one of its own
+	// holding Config.NumRequests
+	budget *requestBudget
+
+	// Structured logger tagged with the fuzzer module
+	logger *slog.Logger
+
 	// Protect concurrent access
 	mu sync.RWMutex
 }
 
 // NewCoverageFuzzer creates a new coverage-guided fuzzer
 func NewCoverageFuzzer(config *Config) (*CoverageFuzzer, error) {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: config.Timeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse // Don't follow redirects
-		},
+	// Create HTTP client with timeout, not following redirects
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get initial page and parse form
@@ -52,64 +63,159 @@ func NewCoverageFuzzer(config *Config) (*CoverageFuzzer, error) {
 	defer resp.Body.Close()
 
 	// Parse HTML form
-	form, err := html.ParseForm(string(readBody(resp)))
+	page, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target URL: %v", err)
+	}
+	form, err := html.ParseForm(string(page.data))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse form: %v", err)
 	}
 
-	// Generate grammar from form
+	// A JSON page holds samples of the values the application expects
+	var document interface{}
+	if json.Unmarshal(page.data, &document) == nil {
+		config.Learner.ObserveJSON(document)
+	}
+
+	// Generate grammar from form, unless the user supplied one
 	grammar := form.GenerateGrammar()
+	learnFieldFormats(grammar, form, config.Learner)
+	if config.GrammarFile != "" {
+		if grammar, err = LoadGrammarFile(config.GrammarFile); err != nil {
+			return nil, err
+		}
+	}
+
+	coverage := NewCoverage()
+	coverage.SetMaxFingerprints(config.MaxFingerprints)
 
 	fuzzer := &CoverageFuzzer{
 		config:   config,
 		form:     form,
-		coverage: NewCoverage(),
+		coverage: coverage,
 		grammar:  grammar,
 		client:   client,
 		corpus:   make([]string, 0),
+		logger:   logging.For("coverage"),
 	}
 
 	return fuzzer, nil
 }
 
+// learnFieldFormats lets text fields without a pattern also derive values in
+// the format learned from observed samples
+func learnFieldFormats(grammar Grammar, form *html.Form, learner *GrammarLearner) {
+	for _, name := range sortedKeys(form.Fields) {
+		field := form.Fields[name]
+		if field.Type != "text" || field.Pattern != "" {
+			continue
+		}
+		learned := learner.Grammar(name)
+		if learned == nil {
+			continue
+		}
+		for symbol, alternatives := range learned {
+			grammar[symbol] = alternatives
+		}
+		fieldSymbol := "<" + name + ">"
+		grammar[fieldSymbol] = append(grammar[fieldSymbol], name+"="+LearnedSymbol(name))
+	}
+}
+
 // Run starts the fuzzing process
 func (f *CoverageFuzzer) Run() error {
+	return f.runPool(f.client, f.generateInput, f.testInput)
+}
+
+// runPool runs Concurrency workers that share the request budget, each
+// producing inputs with next and sending them with send through its session
+// client built on base. With Config.ExploitRatio set, part of the budget
+// sends payloads to the parameters next has produced instead.
+func (f *CoverageFuzzer) runPool(base *http.Client, next func(rng *rand.Rand) string, send func(client *http.Client, input string) *Result) error {
+	sessions, err := newSessions(f.config, base)
+	if err != nil {
+		return err
+	}
+	split, err := newBudgetSplit(f.config)
+	if err != nil {
+		return err
+	}
+
 	// Create worker pool
 	var wg sync.WaitGroup
 	results := make(chan *Result, f.config.Concurrency)
 
-	// Start workers
+	// Start workers sharing one request budget, each with its own random
+	// stream derived from the run seed
+	budget := f.budget
+	if budget == nil {
+		budget = newRequestBudget(f.config.NumRequests, f.config.Deadline)
+	}
+	checkpoints := startCheckpoints(f.config, f.logger, budget, f.corpusSnapshot, f.coverageSummary)
+	defer checkpoints.Stop()
+	seed := runSeed(f.config)
 	for i := 0; i < f.config.Concurrency; i++ {
 		wg.Add(1)
-		go f.worker(&wg, results)
+		go f.worker(&wg, budget, split, newRand(seed, i), sessions, next, send, results)
 	}
 
 	// Start result processor
-	go f.processResults(results)
+	done := make(chan struct{})
+	go func() {
+		f.processResults(results)
+		close(done)
+	}()
 
-	// Wait for all workers to complete
+	// Wait for all workers and the result processor to complete
 	wg.Wait()
 	close(results)
+	<-done
+	split.summary()
 
 	return nil
 }
 
-// worker performs the actual fuzzing
-func (f *CoverageFuzzer) worker(wg *sync.WaitGroup, results chan<- *Result) {
+// corpusSnapshot returns a copy of the corpus
+func (f *CoverageFuzzer) corpusSnapshot() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]string(nil), f.corpus...)
+}
+
+// coverageSummary describes the coverage reached so far for progress records
+func (f *CoverageFuzzer) coverageSummary() []any {
+	f.mu.RLock()
+	corpus := len(f.corpus)
+	f.mu.RUnlock()
+	return []any{
+		"paths", len(f.coverage.GetUniquePaths()),
+		"params", len(f.coverage.GetUniqueParams()),
+		"responses", f.coverage.GetUniqueResponseCount(),
+		"corpus", corpus,
+	}
+}
+
+// worker performs the actual fuzzing, taking requests from the shared budget
+// until it is spent
+func (f *CoverageFuzzer) worker(wg *sync.WaitGroup, budget *requestBudget, split *budgetSplit, rng *rand.Rand,
+	sessions *sessions, next func(rng *rand.Rand) string, send func(client *http.Client, input string) *Result,
+	results chan<- *Result) {
 	defer wg.Done()
 
-	requestsPerWorker := f.config.NumRequests / f.config.Concurrency
+	client := sessions.client()
 
-	for i := 0; i < requestsPerWorker; i++ {
-		// Generate input
-		input := f.generateInput()
+	for _, ok := budget.take(); ok; _, ok = budget.take() {
+		// Generate input, or a payload for a known parameter
+		input, side := split.next(rng, next)
 
 		// Test the input
-		result := f.testInput(input)
+		result := send(client, input)
 		results <- result
+		split.record(input, side, result.yielded)
 
-		// If we found new coverage, add to corpus
-		if f.coverage.HasNewCoverage(input) {
+		// If we found new coverage, add to corpus; payloads only probe
+		if side == sideExplore && f.coverage.HasNewCoverage(input) {
 			f.mu.Lock()
 			f.corpus = append(f.corpus, input)
 			f.mu.Unlock()
@@ -118,51 +224,59 @@ func (f *CoverageFuzzer) worker(wg *sync.WaitGroup, results chan<- *Result) {
 }
 
 // generateInput creates a new test input
-func (f *CoverageFuzzer) generateInput() string {
+func (f *CoverageFuzzer) generateInput(rng *rand.Rand) string {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 
 	// 70% chance to mutate from corpus if available
-	if len(f.corpus) > 0 && randFloat() < 0.7 {
-		base := f.corpus[randInt(len(f.corpus))]
-		return f.mutateInput(base)
+	if len(f.corpus) > 0 && rng.Float64() < 0.7 {
+		base := spliceFrom(f.config, rng, f.corpus[rng.Intn(len(f.corpus))], f.corpus)
+		return f.mutateInput(rng, base)
 	}
 
 	// Otherwise generate new input from grammar
-	return f.generateFromGrammar()
+	return f.generateFromGrammar(rng)
 }
 
 // mutateInput modifies an existing input
-func (f *CoverageFuzzer) mutateInput(input string) string {
+func (f *CoverageFuzzer) mutateInput(rng *rand.Rand, input string) string {
 	parsedURL, err := url.Parse(input)
 	if err != nil {
-		return f.generateFromGrammar()
+		return f.generateFromGrammar(rng)
+	}
+
+	// Custom mutators are picked as often as each built-in strategy. Without
+	// any the choices stay as they were, so seeds replay the same run.
+	if len(f.config.Mutators) > 0 {
+		if n := rng.Intn(4 + len(f.config.Mutators)); n >= 4 {
+			return applyMutator(f.config.Mutators[n-4], rng, input)
+		}
 	}
 
 	query := parsedURL.Query()
 
 	// Pick a random mutation strategy
-	switch randInt(4) {
+	switch rng.Intn(4) {
 	case 0: // Change parameter value
 		if len(query) > 0 {
-			param := randomKey(query)
-			query.Set(param, f.generateParamValue(param))
+			param := randomKey(rng, query)
+			query.Set(param, f.generateParamValue(rng, param))
 		}
 	case 1: // Add new parameter
 		params := f.form.Fields
 		if len(params) > 0 {
-			param := randomMapKey(params)
-			query.Set(param, f.generateParamValue(param))
+			param := randomMapKey(rng, params)
+			query.Set(param, f.generateParamValue(rng, param))
 		}
 	case 2: // Remove parameter
 		if len(query) > 0 {
-			param := randomKey(query)
+			param := randomKey(rng, query)
 			query.Del(param)
 		}
 	case 3: // Duplicate parameter
 		if len(query) > 0 {
-			param := randomKey(query)
-			query.Add(param, f.generateParamValue(param))
+			param := randomKey(rng, query)
+			query.Add(param, f.generateParamValue(rng, param))
 		}
 	}
 
@@ -171,9 +285,9 @@ func (f *CoverageFuzzer) mutateInput(input string) string {
 }
 
 // generateFromGrammar creates input from the grammar
-func (f *CoverageFuzzer) generateFromGrammar() string {
+func (f *CoverageFuzzer) generateFromGrammar(rng *rand.Rand) string {
 	// Start with <start> rule
-	result := f.expandRule("<start>")
+	result := f.expandRule(rng, "<start>")
 
 	// Parse as URL and encode properly
 	if u, err := url.Parse(result); err == nil {
@@ -182,67 +296,75 @@ func (f *CoverageFuzzer) generateFromGrammar() string {
 	return result
 }
 
-// expandRule expands a grammar rule
-func (f *CoverageFuzzer) expandRule(rule string) string {
-	if alternatives, ok := f.grammar[rule]; ok {
-		// Pick random alternative
-		alt := alternatives[randInt(len(alternatives))]
-
-		// Expand any nested rules
-		for {
-			start := -1
-			end := -1
-
-			// Find next rule to expand (enclosed in < >)
-			for i := 0; i < len(alt); i++ {
-				if alt[i] == '<' {
-					start = i
-				} else if alt[i] == '>' && start != -1 {
-					end = i + 1
-					break
-				}
-			}
-
-			if start == -1 || end == -1 {
-				break
-			}
-
-			// Extract and expand nested rule
-			nestedRule := alt[start:end]
-			expansion := f.expandRule(nestedRule)
-
-			// Replace in original
-			alt = alt[:start] + expansion + alt[end:]
-		}
-		return alt
-	}
-	return rule
+// expandRule expands a grammar rule. Pattern rules contain literal '<' and
+// recursive repetitions, so expansion is depth-limited and only replaces
+// symbols the grammar defines.
+func (f *CoverageFuzzer) expandRule(rng *rand.Rand, rule string) string {
+	return expandGrammar(rng, f.grammar, rule, 0, f.config.MaxDepth)
 }
 
 // generateParamValue creates a value for a parameter
-func (f *CoverageFuzzer) generateParamValue(param string) string {
+func (f *CoverageFuzzer) generateParamValue(rng *rand.Rand, param string) string {
 	if field, ok := f.form.Fields[param]; ok {
+		// Pattern fields get values matching the pattern or just outside it
+		symbols := []string{fmt.Sprintf("<pattern-%s>", param)}
+		if _, ok := f.grammar[html.InvalidSymbol(symbols[0])]; ok {
+			symbols = append(symbols, html.InvalidSymbol(symbols[0]))
+		}
+		if _, ok := f.grammar[symbols[0]]; ok && field.Pattern != "" {
+			return f.expandRule(rng, symbols[rng.Intn(len(symbols))])
+		}
+		// Options, bounds and lengths are in the field's value rule, which
+		// derives query-escaped values
+		if symbol := html.ValueSymbol(param); field.Constrained() && len(f.grammar[symbol]) > 0 {
+			value := f.expandRule(rng, symbol)
+			if unescaped, err := url.QueryUnescape(value); err == nil {
+				return unescaped
+			}
+			return value
+		}
+
 		switch field.Type {
-		case "select":
+		case "select", "radio":
 			if len(field.Options) > 0 {
-				return field.Options[randInt(len(field.Options))]
+				return field.Options[rng.Intn(len(field.Options))]
 			}
 		case "number":
-			return fmt.Sprintf("%d", randInt(10000))
+			return fmt.Sprintf("%d", rng.Intn(10000))
 		case "email":
-			return fmt.Sprintf("test%d@example.com", randInt(1000))
+			return fmt.Sprintf("test%d@example.com", rng.Intn(1000))
 		case "checkbox":
-			if randBool() {
+			if rng.Intn(2) == 1 {
 				return "on"
 			}
 			return "off"
 		}
 	}
-	return fmt.Sprintf("fuzz%d", randInt(1000))
+	// Real values seen for the parameter pass validation random ones would
+	// not, and changed a little they reach the records next to them
+	switch rng.Intn(3) {
+	case 0:
+		if value, ok := f.config.Learner.Sample(rng, param); ok {
+			return value
+		}
+	case 1:
+		if value, ok := f.config.Learner.Seed(rng, param); ok {
+			return value
+		}
+	}
+	if value, ok := f.config.Learner.Generate(rng, param); ok {
+		return value
+	}
+	// Parameters never seen borrow the IDs, slugs or tokens seen elsewhere
+	// their name suggests
+	if value, ok := f.config.Learner.Seed(rng, param); ok {
+		return value
+	}
+	return fmt.Sprintf("fuzz%d", rng.Intn(1000))
 }
 
 // testInput sends a request with the given input
-func (f *CoverageFuzzer) testInput(input string) *Result {
+func (f *CoverageFuzzer) testInput(client *http.Client, input string) *Result {
 	start := time.Now()
 
 	// Construct full URL
@@ -252,8 +374,17 @@ func (f *CoverageFuzzer) testInput(input string) *Result {
 	}
 
 	// Send request
-	resp, err := f.client.Get(fullURL)
+	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
 	if err != nil {
+		return &Result{
+			URL:       fullURL,
+			Error:     err,
+			Timestamp: start,
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		inspectFailure(f.config, req, nil, err, input)
 		return &Result{
 			URL:       fullURL,
 			Error:     err,
@@ -263,86 +394,48 @@ func (f *CoverageFuzzer) testInput(input string) *Result {
 	}
 	defer resp.Body.Close()
 
+	// Keep the body so it can be captured as evidence after tracking
+	body, _ := readLimited(resp.Body, maxBodySize(f.config))
+	resp.Body = io.NopCloser(bytes.NewReader(body.data))
+
+	found := inspectResponse(f.config, req, nil, resp, body.data, input)
+
 	// Track coverage
-	f.coverage.TrackResponse(resp)
-	f.coverage.TrackURL(fullURL)
+	newResponse := f.coverage.TrackResponse(resp)
+	_, grew := f.coverage.trackURL(fullURL)
 
-	return &Result{
+	result := &Result{
 		URL:        fullURL,
 		StatusCode: resp.StatusCode,
+		Response:   string(body.data),
 		Duration:   time.Since(start),
 		Timestamp:  start,
+		yielded:    found || newResponse || grew,
 	}
+	result.measureBody(body)
+	return result
 }
 
 // processResults handles the fuzzing results
 func (f *CoverageFuzzer) processResults(results <-chan *Result) {
 	for result := range results {
-		if f.config.Verbose {
-			if result.Error != nil {
-				fmt.Printf("[ERROR] %s: %v\n", result.URL, result.Error)
-			} else {
-				fmt.Printf("[%d] %s (%.2fs)\n",
-					result.StatusCode, result.URL, result.Duration.Seconds())
+		if result.Error != nil {
+			f.logger.Debug("request failed", "url", result.URL, "error", result.Error)
+		} else if f.config.ResultFilter.Active() {
+			if f.config.ResultFilter.Keep(result) {
+				f.logger.Info("result matched", "status", result.StatusCode, "url", result.URL,
+					"size", result.Size, "words", result.Words, "duration", result.Duration)
 			}
+		} else {
+			f.logger.Debug("request completed", "status", result.StatusCode,
+				"url", result.URL, "duration", result.Duration)
 		}
 	}
 }
 
 // Helper functions
 
-func randInt(n int) int {
-	if n <= 0 {
-		return 0
-	}
-	return int(randFloat() * float64(n))
-}
-
-func randFloat() float64 {
-	return float64(time.Now().UnixNano()) / float64(1<<63)
-}
-
-func randBool() bool {
-	return randInt(2) == 1
-}
-
-func randomKey(values url.Values) string {
-	keys := make([]string, 0, len(values))
-	for k := range values {
-		keys = append(keys, k)
-	}
-	return keys[randInt(len(keys))]
-}
-
-func randomMapKey[K comparable, V any](m map[K]V) K {
-	keys := make([]K, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
-	}
-	return keys[randInt(len(keys))]
-}
-
 func isAbsoluteURL(urlStr string) bool {
 	u, err := url.Parse(urlStr)
 	return err == nil && u.Scheme != "" && u.Host != ""
 }
-
-func readBody(resp *http.Response) []byte {
-	if resp.Body == nil {
-		return nil
-	}
-	defer resp.Body.Close()
-
-	body := make([]byte, 0)
-	buf := make([]byte, 1024)
-	for {
-		n, err := resp.Body.Read(buf)
-		if n > 0 {
-			body = append(body, buf[:n]...)
-		}
-		if err != nil {
-			break
-		}
-	}
-	return body
-}
@@ -0,0 +1,240 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// volatileHeaders change between any two responses or deployments and say
+// nothing about their behavior
+var volatileHeaders = map[string]bool{
+	"Age":               true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Etag":              true,
+	"Expires":           true,
+	"Last-Modified":     true,
+	"Set-Cookie":        true,
+	"X-Request-Id":      true,
+	"X-Correlation-Id":  true,
+	"X-Amzn-Requestid":  true,
+	"X-Amzn-Trace-Id":   true,
+	"Cf-Ray":            true,
+	"Server-Timing":     true,
+	"Report-To":         true,
+	"Nel":               true,
+	"Alt-Svc":           true,
+	"Keep-Alive":        true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+}
+
+// Differ sends every fuzzed request a second time to another deployment of
+// the target, e.g. staging next to production or a new release next to the
+// current one, and reports where the two answer differently: a payload one
+// of them fails on, different content, or different headers. The secondary
+// deployment is reached with the same settings, retries, circuit breaker and
+// rate limit as the target but separate from them. It is shared by every
+// client built from the same Config and is safe for concurrent use.
+type Differ struct {
+	secondary *url.URL
+
+	once    sync.Once
+	primary *url.URL // Target URL, whose requests are mapped onto secondary
+	client  *http.Client
+	err     error
+}
+
+// NewDiffer creates a differ comparing the target with the deployment at
+// secondaryURL. Paths below the target URL map to the same paths below
+// secondaryURL.
+func NewDiffer(secondaryURL string) (*Differ, error) {
+	u, err := url.Parse(secondaryURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid comparison URL %q: absolute URL expected", secondaryURL)
+	}
+	return &Differ{secondary: u}, nil
+}
+
+// URL returns the URL of the secondary deployment
+func (d *Differ) URL() string {
+	if d == nil {
+		return ""
+	}
+	return d.secondary.String()
+}
+
+// setup builds the client for the secondary deployment from the target's
+// config, once
+func (d *Differ) setup(config *Config) error {
+	d.once.Do(func() {
+		if config.TargetURL != "" {
+			d.primary, _ = url.Parse(config.TargetURL)
+		}
+
+		secondary := *config
+		secondary.TargetURL = d.secondary.String()
+		secondary.Differ = nil
+		secondary.Traffic = nil
+		secondary.Retry = config.Retry.Clone()
+		if config.Breaker != nil {
+			// A health URL given is the target's; the second deployment is
+			// probed itself
+			secondary.Breaker = NewCircuitBreaker(secondary.TargetURL)
+		}
+		if config.RateLimit != nil {
+			secondary.RateLimit = NewRateLimiter(config.RateLimit.Rate())
+		}
+		// A Host header overriding the target's would send the secondary
+		// requests to the target's virtual host
+		secondary.Headers = make(map[string]string, len(config.Headers))
+		for name, value := range config.Headers {
+			if !strings.EqualFold(name, "Host") {
+				secondary.Headers[name] = value
+			}
+		}
+		d.client, d.err = newHTTPClient(&secondary, false)
+	})
+	return d.err
+}
+
+// mapURL returns the secondary deployment's URL for a request URL, or nil
+// for requests to hosts other than the target
+func (d *Differ) mapURL(u *url.URL) *url.URL {
+	mapped := *u
+	mapped.Scheme = d.secondary.Scheme
+	mapped.Host = d.secondary.Host
+	if d.primary == nil {
+		return &mapped
+	}
+	if u.Host != d.primary.Host {
+		return nil
+	}
+	prefix := strings.TrimSuffix(d.primary.Path, "/")
+	if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+		mapped.Path = strings.TrimSuffix(d.secondary.Path, "/") + rest
+		mapped.RawPath = ""
+	}
+	return &mapped
+}
+
+// compare resends req to the secondary deployment and returns findings for
+// the ways its response differs from resp and body
+func (d *Differ) compare(config *Config, req *http.Request, reqBody []byte, resp *http.Response, body []byte) []*Finding {
+	if d == nil {
+		return nil
+	}
+	if err := d.setup(config); err != nil {
+		return nil
+	}
+	target := d.mapURL(req.URL)
+	if target == nil {
+		return nil
+	}
+
+	other, err := http.NewRequest(req.Method, target.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil
+	}
+	other.Header = req.Header.Clone()
+	otherResp, err := d.client.Do(other)
+	if err != nil {
+		return nil
+	}
+	defer otherResp.Body.Close()
+	otherBody, _ := readLimited(otherResp.Body, maxBodySize(config))
+
+	var findings []*Finding
+	newFinding := func(kind string, severity Severity, evidence string) *Finding {
+		finding := &Finding{
+			Type:       kind,
+			Severity:   severity,
+			Confidence: ConfidenceTentative,
+			Evidence:   evidence + "; compared with " + target.String(),
+		}
+		findings = append(findings, finding)
+		return finding
+	}
+
+	if resp.StatusCode != otherResp.StatusCode {
+		severity := SeverityLow
+		if resp.StatusCode >= http.StatusInternalServerError || otherResp.StatusCode >= http.StatusInternalServerError {
+			severity = SeverityMedium
+		}
+		newFinding("differential-status", severity,
+			fmt.Sprintf("HTTP %d from the target, HTTP %d from the comparison deployment", resp.StatusCode, otherResp.StatusCode))
+		return findings
+	}
+	if !similarBodies(body, otherBody.data) {
+		newFinding("differential-body", SeverityInfo,
+			fmt.Sprintf("same HTTP %d but different content: %d bytes from the target, %d from the comparison deployment", resp.StatusCode, len(body), len(otherBody.data)))
+	}
+
+	// Header differences hold for the whole deployment, so each is reported
+	// once against the target rather than per endpoint. Responses with
+	// different statuses differ in headers anyway.
+	for _, diff := range headerDiff(resp.Header, otherResp.Header) {
+		finding := newFinding("differential-header", SeverityInfo, diff.evidence)
+		finding.URL = config.TargetURL
+		finding.Parameter = diff.name
+	}
+	return findings
+}
+
+// similarBodies reports whether two response bodies show the same page once
+// volatile content such as timestamps and tokens is ignored
+func similarBodies(a, b []byte) bool {
+	if normalizeBody(a) == normalizeBody(b) {
+		return true
+	}
+	return bits.OnesCount64(simhash(a)^simhash(b)) <= simhashDistance
+}
+
+// headerDifference is a header one deployment sends differently
+type headerDifference struct {
+	name     string
+	evidence string
+}
+
+// headerDiff returns the headers, other than volatile ones, that only one of
+// two responses has or that they give different values, by name
+func headerDiff(a, b http.Header) []headerDifference {
+	names := make(map[string]bool)
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+
+	var diffs []headerDifference
+	for _, name := range sortedKeys(names) {
+		if volatileHeaders[name] {
+			continue
+		}
+		va, vb := headerValue(a, name), headerValue(b, name)
+		switch {
+		case normalizeBody([]byte(va)) == normalizeBody([]byte(vb)):
+		case vb == "":
+			diffs = append(diffs, headerDifference{name, fmt.Sprintf("%s: %s sent by the target only", name, va)})
+		case va == "":
+			diffs = append(diffs, headerDifference{name, fmt.Sprintf("%s: %s sent by the comparison deployment only", name, vb)})
+		default:
+			diffs = append(diffs, headerDifference{name, fmt.Sprintf("%s: %s from the target, %s from the comparison deployment", name, va, vb)})
+		}
+	}
+	return diffs
+}
+
+// headerValue joins the sorted values of a header
+func headerValue(h http.Header, name string) string {
+	values := append([]string(nil), h.Values(name)...)
+	sort.Strings(values)
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,91 @@
+package fuzzer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DryRun records the requests a run would send instead of sending them, so
+// they can be audited before active fuzzing is authorized. It stands in for
+// the network behind every fuzzer's client and answers each request with an
+// empty 200 response. Discovery still reaches the target: the crawl and API
+// detection send no attack payloads and the fuzzers need what they find.
+type DryRun struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	count int
+}
+
+// NewDryRun creates a dry run writing the planned requests to path
+func NewDryRun(path string) (*DryRun, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create planned requests file: %v", err)
+	}
+	return &DryRun{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// RoundTrip implements http.RoundTripper, recording the raw request
+func (d *DryRun) RoundTrip(req *http.Request) (*http.Response, error) {
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record request: %v", err)
+	}
+
+	d.mu.Lock()
+	d.count++
+	fmt.Fprintf(d.w, "### %d %s %s\n", d.count, req.Method, req.URL)
+	d.w.Write(dump)
+	if !bytes.HasSuffix(dump, []byte("\n")) {
+		d.w.WriteString("\n")
+	}
+	d.w.WriteString("\n")
+	d.mu.Unlock()
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// Count returns the number of requests recorded so far
+func (d *DryRun) Count() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+// Close flushes the recorded requests to the file
+func (d *DryRun) Close() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.w.Flush(); err != nil {
+		d.file.Close()
+		return fmt.Errorf("failed to write planned requests: %v", err)
+	}
+	return d.file.Close()
+}
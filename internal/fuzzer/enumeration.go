@@ -0,0 +1,317 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+const (
+	// enumerationWindow is how far either side of a numeric identifier the
+	// neighbouring identifiers are tried
+	enumerationWindow = 3
+
+	// minEnumeratedNumeric is how many neighbouring numeric identifiers must
+	// return other resources for the identifier to count as enumerable. A
+	// single guessed UUID is enough.
+	minEnumeratedNumeric = 2
+)
+
+var (
+	// numericID matches path segments and parameter values that are
+	// sequential identifiers
+	numericID = regexp.MustCompile(`^\d{1,18}$`)
+
+	// uuidID matches UUID identifiers
+	uuidID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// idSlot is one identifier in a URL: a path segment or a query parameter
+type idSlot struct {
+	name     string                 // Query parameter name, or "path segment i" for the i-th path segment
+	value    string                 // Identifier in the original URL
+	template string                 // URL with the identifier replaced by {id}, to test each slot once
+	with     func(id string) string // Returns the URL holding id instead
+}
+
+// enumResponse is the part of a response identifier comparison looks at
+type enumResponse struct {
+	status int
+	shape  string // JSON keys or media type, see responseShape
+	body   string // Normalized body
+	req    *http.Request
+	resp   *http.Response
+	raw    []byte
+}
+
+// EnumerationTester looks for REST resources whose identifiers can be
+// enumerated. Every numeric or UUID path segment and query value is replaced
+// by neighbouring identifiers; when those return resources of the same shape
+// with different content, other users' records are likely reachable by
+// guessing IDs.
+type EnumerationTester struct {
+	config *Config
+	client *http.Client
+	tested map[string]bool
+	logger *slog.Logger
+}
+
+// NewEnumerationTester creates an identifier enumeration tester using the
+// configured credentials
+func NewEnumerationTester(config *Config) (*EnumerationTester, error) {
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+	return &EnumerationTester{
+		config: config,
+		client: client,
+		tested: make(map[string]bool),
+		logger: logging.For("enumeration"),
+	}, nil
+}
+
+// Run tests the identifiers of the configured target URL
+func (t *EnumerationTester) Run() error {
+	if t.Test([]string{t.config.TargetURL}, t.config.Deadline) == 0 {
+		t.logger.Warn("no numeric or UUID identifiers in the target URL", "url", t.config.TargetURL)
+	}
+	return nil
+}
+
+// Test enumerates the identifiers of every URL, testing each identifier
+// position once across URLs that differ only in its value. It stops once the
+// deadline passes, if one is set, and returns the number of identifiers
+// tested.
+func (t *EnumerationTester) Test(urls []string, deadline time.Time) int {
+	tested := 0
+	for _, targetURL := range urls {
+		parsed, err := url.Parse(targetURL)
+		if err != nil {
+			continue
+		}
+		for _, slot := range identifierSlots(parsed) {
+			if t.tested[slot.template] {
+				continue
+			}
+			if !deadline.IsZero() && time.Now().After(deadline) {
+				return tested
+			}
+			t.tested[slot.template] = true
+			t.enumerate(targetURL, slot)
+			tested++
+		}
+	}
+	return tested
+}
+
+// enumerate tries the neighbouring identifiers of one slot and reports the
+// slot when enough of them return other resources
+func (t *EnumerationTester) enumerate(targetURL string, slot idSlot) {
+	reference, err := t.fetch(targetURL)
+	if err != nil {
+		t.logger.Debug("request failed", "url", targetURL, "error", err)
+		return
+	}
+	if reference.status < 200 || reference.status >= 300 || reference.body == "" {
+		return
+	}
+
+	var found []string
+	statuses := make(map[int]int)
+	var last *enumResponse
+	for _, id := range candidateIDs(slot.value) {
+		response, err := t.fetch(slot.with(id))
+		if err != nil {
+			t.logger.Debug("request failed", "url", slot.with(id), "error", err)
+			continue
+		}
+		statuses[response.status]++
+		if response.status == reference.status && response.shape == reference.shape && response.body != reference.body {
+			found = append(found, id)
+			last = response
+		}
+	}
+	t.logger.Debug("identifiers tried", "url", targetURL, "slot", slot.name, "found", len(found), "statuses", statuses)
+
+	needed := minEnumeratedNumeric
+	if uuidID.MatchString(slot.value) {
+		needed = 1
+	}
+	if len(found) < needed {
+		return
+	}
+
+	finding := &Finding{
+		Type:       "enumerable-identifier",
+		Severity:   SeverityMedium,
+		Confidence: ConfidenceTentative,
+		URL:        targetURL,
+		Method:     http.MethodGet,
+		Parameter:  slot.name,
+		Payload:    strings.Join(found, ","),
+		Evidence: fmt.Sprintf("%d of %d identifiers near %s return other resources of the same shape (HTTP %d); responses by status: %s",
+			len(found), len(candidateIDs(slot.value)), slot.value, reference.status, formatStatusCounts(statuses)),
+		Timestamp: time.Now(),
+	}
+	captureExchange(finding, last.req, nil, last.resp, last.raw)
+	if t.config.Findings.Add(finding) {
+		t.logger.Warn("enumerable identifier", "url", targetURL, "slot", slot.name, "found", len(found))
+	}
+}
+
+// fetch sends a GET request for targetURL
+func (t *EnumerationTester) fetch(targetURL string) (*enumResponse, error) {
+	response, err := fetchProbe(t.client, t.config, targetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &enumResponse{
+		status: response.resp.StatusCode,
+		shape:  responseShape(response.resp.Header.Get("Content-Type"), response.body),
+		body:   normalizeBody(response.body),
+		req:    response.req,
+		resp:   response.resp,
+		raw:    response.body,
+	}, nil
+}
+
+// identifierSlots returns the numeric and UUID path segments and query
+// values of u
+func identifierSlots(u *url.URL) []idSlot {
+	var slots []idSlot
+
+	segments := strings.Split(u.EscapedPath(), "/")
+	for i, segment := range segments {
+		if !numericID.MatchString(segment) && !uuidID.MatchString(segment) {
+			continue
+		}
+		rawPath := func(id string) string {
+			replaced := append([]string(nil), segments...)
+			replaced[i] = id
+			return strings.Join(replaced, "/")
+		}
+		with := func(id string) string {
+			// The segments are escaped already; setting them as RawPath
+			// keeps them from being escaped again
+			c := *u
+			escaped := rawPath(id)
+			path, err := url.PathUnescape(escaped)
+			if err != nil {
+				return u.String()
+			}
+			c.Path, c.RawPath = path, escaped
+			return c.String()
+		}
+		slots = append(slots, idSlot{
+			name:     fmt.Sprintf("path segment %d", i),
+			value:    segment,
+			template: (&url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}).String() + rawPath("{id}"),
+			with:     with,
+		})
+	}
+
+	query := u.Query()
+	for _, name := range sortedKeys(query) {
+		value := query.Get(name)
+		if !numericID.MatchString(value) && !uuidID.MatchString(value) {
+			continue
+		}
+		with := func(id string) string {
+			q := u.Query()
+			q.Set(name, id)
+			c := *u
+			c.RawQuery = q.Encode()
+			return c.String()
+		}
+		slots = append(slots, idSlot{
+			name:     name,
+			value:    value,
+			template: withoutQuery(u.String()) + "?" + name,
+			with:     with,
+		})
+	}
+	return slots
+}
+
+// withoutQuery returns rawURL without its query string and fragment
+func withoutQuery(rawURL string) string {
+	if i := strings.IndexAny(rawURL, "?#"); i >= 0 {
+		return rawURL[:i]
+	}
+	return rawURL
+}
+
+// candidateIDs returns the identifiers tried in place of id: the neighbours
+// within enumerationWindow and the first IDs for numbers, or the UUIDs whose
+// last digit is one off and the nil UUID for UUIDs
+func candidateIDs(id string) []string {
+	if uuidID.MatchString(id) {
+		candidates := []string{"00000000-0000-0000-0000-000000000000"}
+		last, _ := strconv.ParseUint(id[len(id)-1:], 16, 8)
+		for _, delta := range []int{-1, 1} {
+			digit := (int(last) + delta + 16) % 16
+			candidates = append(candidates, id[:len(id)-1]+strconv.FormatInt(int64(digit), 16))
+		}
+		return candidates
+	}
+
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	seen := map[int64]bool{n: true}
+	var candidates []string
+	add := func(c int64) {
+		if c >= 0 && !seen[c] {
+			seen[c] = true
+			candidates = append(candidates, strconv.FormatInt(c, 10))
+		}
+	}
+	for d := int64(1); d <= enumerationWindow; d++ {
+		add(n - d)
+		add(n + d)
+	}
+	add(1)
+	add(2)
+	return candidates
+}
+
+// responseShape summarizes the structure of a response: the sorted keys of a
+// JSON object, or the media type for anything else. Records of one resource
+// type share a shape while their values differ.
+func responseShape(contentType string, body []byte) string {
+	var object map[string]interface{}
+	if json.Unmarshal(body, &object) == nil && object != nil {
+		return "json:" + strings.Join(sortedKeys(object), ",")
+	}
+	var array []interface{}
+	if json.Unmarshal(body, &array) == nil {
+		return "json:array"
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// formatStatusCounts lists status codes with their counts, e.g. "200x2 404x4"
+func formatStatusCounts(counts map[int]int) string {
+	statuses := make([]int, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = fmt.Sprintf("%dx%d", status, counts[status])
+	}
+	return strings.Join(parts, " ")
+}
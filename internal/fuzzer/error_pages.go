@@ -0,0 +1,91 @@
+package fuzzer
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxTraceLines bounds the stack trace lines kept as evidence
+const maxTraceLines = 8
+
+// errorPageSignature recognizes the verbose error page of one framework
+type errorPageSignature struct {
+	framework string
+	pattern   *regexp.Regexp
+	severity  Severity
+}
+
+// errorPageSignatures are checked in order; the first match is reported.
+// Debug pages that dump settings and source come first, generic traces last.
+var errorPageSignatures = []errorPageSignature{
+	{"Django debug page", regexp.MustCompile(`DEBUG = True</code> in your Django settings|<th>Django Version:</th>`), SeverityMedium},
+	{"Werkzeug debugger", regexp.MustCompile(`(?i)<title>[^<]*// Werkzeug Debugger</title>|The debugger caught an exception in your WSGI application`), SeverityMedium},
+	{"Rails exception page", regexp.MustCompile(`Action Controller: Exception caught|Rails\.root: |Application Trace \| Framework Trace`), SeverityMedium},
+	{"Laravel exception page", regexp.MustCompile(`Whoops, looks like something went wrong|Illuminate\\[A-Z]\w+\\`), SeverityMedium},
+	{"ASP.NET yellow screen of death", regexp.MustCompile(`Server Error in '[^']*' Application|<b> ?Exception Details: ?</b>`), SeverityMedium},
+	{"Spring Whitelabel error page", regexp.MustCompile(`Whitelabel Error Page|There was an unexpected error \(type=[^,]+, status=\d+\)`), SeverityLow},
+	{"Apache Tomcat error report", regexp.MustCompile(`Apache Tomcat/[\d.]+ - Error report|<h3>Apache Tomcat/[\d.]+</h3>`), SeverityLow},
+	{"PHP error", regexp.MustCompile(`<b>(Warning|Fatal error|Notice|Parse error|Deprecated)</b>: .{1,300}? in <b>[^<]+</b> on line <b>\d+</b>|` +
+		`PHP (Warning|Fatal error|Notice|Parse error):\s+.{1,300}? in \S+ on line \d+`), SeverityLow},
+	{"Java stack trace", regexp.MustCompile(`\b(java|javax|jakarta)\.[\w.]+(Exception|Error)\b[^\n]*\n\s+at [\w$.<>]+\(`), SeverityLow},
+	{"Node.js stack trace", regexp.MustCompile(`\b\w*Error: [^\n]*\n\s+at [^\n]+\((/|[A-Za-z]:\\)[^\n]+\.[cm]?js:\d+:\d+\)`), SeverityLow},
+	{"Python traceback", regexp.MustCompile(`Traceback \(most recent call last\):\s+File "`), SeverityLow},
+}
+
+// traceLine matches the frames of the stack traces the signatures recognize
+var traceLine = regexp.MustCompile(`^(File "[^"]+", line \d+|at [\w$.<>]+\(|at .+\(?(/|[A-Za-z]:\\).+:\d+|` +
+	`#\d+ .+\(\d+\)|.+ in \S+ on line \d+|\S+\.rb:\d+:in |.+ in [A-Za-z]:\\.+:line \d+)`)
+
+// htmlTag matches the markup stripped before trace lines are extracted
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// detectErrorPage looks for a framework's verbose error page in a response
+// and returns a finding naming the framework, with the stack trace it leaks
+// as evidence. It returns nil when nothing matched or the match is only the
+// payload reflected back.
+func detectErrorPage(payload string, body []byte) *Finding {
+	for _, signature := range errorPageSignatures {
+		match := signature.pattern.Find(body)
+		if match == nil || (payload != "" && strings.Contains(payload, string(match))) {
+			continue
+		}
+
+		evidence := signature.framework
+		if trace := extractTrace(body); len(trace) > 0 {
+			evidence += ", stack trace: " + strings.Join(trace, "; ")
+		} else {
+			evidence += fmt.Sprintf(": %q", match)
+		}
+		return &Finding{
+			Type:       "verbose-error",
+			Severity:   signature.severity,
+			Confidence: ConfidenceFirm,
+			Parameter:  signature.framework,
+			Evidence:   evidence,
+			Timestamp:  time.Now(),
+		}
+	}
+	return nil
+}
+
+// extractTrace returns the first stack frames in an error page, with the
+// markup removed
+func extractTrace(body []byte) []string {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(string(body), ""))
+
+	var trace []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" || !traceLine.MatchString(line) {
+			continue
+		}
+		trace = append(trace, line)
+		if len(trace) == maxTraceLines {
+			break
+		}
+	}
+	return trace
+}
@@ -0,0 +1,123 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expressionSyntax wraps an expression in the delimiters of one expression
+// language or template engine. %s stands for the expression.
+type expressionSyntax struct {
+	name     string
+	template string
+}
+
+// expressionSyntaxes cover Java EL and Spring SpEL, JSF deferred
+// expressions, Thymeleaf selection expressions, Struts OGNL and the double
+// braces of most template engines
+var expressionSyntaxes = []expressionSyntax{
+	{"EL", "${%s}"},
+	{"deferred EL", "#{%s}"},
+	{"Thymeleaf", "*{%s}"},
+	{"OGNL", "%%{%s}"},
+	{"template", "{{%s}}"},
+}
+
+// expressionErrors are errors of expression evaluators that show input
+// reached one
+var expressionErrors = regexp.MustCompile(`(?i)(javax\.el\.|jakarta\.el\.|ELException|PropertyNotFoundException|` +
+	`org\.springframework\.expression|SpelEvaluationException|SpelParseException|EL10[0-9]{2}E|ognl\.OgnlException|` +
+	`org\.thymeleaf\.exceptions|TemplateSyntaxError|jinja2\.exceptions|Twig_Error|Twig\\Error|freemarker\.core\.|` +
+	`org\.apache\.velocity|Liquid::SyntaxError)`)
+
+// probeExpressionInjection appends expressions to one query parameter in
+// the syntax of each expression language. The product of two random numbers
+// showing up in the response shows evaluation, confirmed with a second
+// product so a number that happens to be on the page is not reported.
+// Otherwise an evaluator error the plain value does not cause is reported.
+func probeExpressionInjection(client *http.Client, config *Config, rng *rand.Rand, targetURL, param string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	original := parsed.Query().Get(param)
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	send := func(value string) (*probeResponse, error) {
+		u := *parsed
+		query := u.Query()
+		query.Set(param, value)
+		u.RawQuery = query.Encode()
+		req, resp, body, _, err := timedGet(client, config, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &probeResponse{req: req, resp: resp, body: body}, nil
+	}
+	// evaluates sends a product in one syntax and reports whether the
+	// response holds its result
+	evaluates := func(syntax expressionSyntax) (string, *probeResponse, bool) {
+		a, b := 1000+rng.Intn(9000), 1000+rng.Intn(9000)
+		payload := original + fmt.Sprintf(syntax.template, fmt.Sprintf("%d*%d", a, b))
+		probe, err := send(payload)
+		if err != nil {
+			return payload, nil, false
+		}
+		return payload, probe, strings.Contains(string(probe.body), strconv.Itoa(a*b))
+	}
+
+	baseline, err := send(original)
+	if err != nil {
+		return nil, err
+	}
+	var errorFinding *Finding
+	for _, syntax := range expressionSyntaxes {
+		if expired() {
+			return nil, nil
+		}
+		payload, probe, ok := evaluates(syntax)
+		if probe == nil {
+			continue
+		}
+		if ok {
+			confirm, confirmed, ok := evaluates(syntax)
+			if !ok {
+				continue
+			}
+			finding := &Finding{
+				Type:       "expression-injection",
+				Severity:   SeverityCritical,
+				Confidence: ConfidenceCertain,
+				URL:        confirmed.req.URL.String(),
+				Method:     confirmed.req.Method,
+				Parameter:  param,
+				Payload:    payload,
+				Evidence:   fmt.Sprintf("%s expressions %q and %q are evaluated: their products are in the responses", syntax.name, payload, confirm),
+			}
+			captureExchange(finding, confirmed.req, nil, confirmed.resp, confirmed.body)
+			return finding, nil
+		}
+		signature := expressionErrors.FindString(string(probe.body))
+		if errorFinding == nil && signature != "" && !expressionErrors.Match(baseline.body) {
+			errorFinding = &Finding{
+				Type:       "expression-injection",
+				Severity:   SeverityMedium,
+				Confidence: ConfidenceFirm,
+				URL:        probe.req.URL.String(),
+				Method:     probe.req.Method,
+				Parameter:  param,
+				Payload:    payload,
+				Evidence:   fmt.Sprintf("%s expression causes an evaluator error: %q", syntax.name, signature),
+			}
+			captureExchange(errorFinding, probe.req, nil, probe.resp, probe.body)
+		}
+	}
+	return errorFinding, nil
+}
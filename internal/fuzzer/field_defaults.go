@@ -0,0 +1,109 @@
+package fuzzer
+
+import (
+	"math/rand"
+	"net/url"
+	"strings"
+)
+
+// unfuzzedTypes are input types users do not type into; with
+// PreserveDefaults they always keep their value
+var unfuzzedTypes = map[string]bool{
+	"hidden": true, "submit": true, "button": true, "reset": true, "image": true,
+}
+
+// preserveDefaults prepares fuzzing one field at a time. Every field keeps
+// the value the page fills in, else the first of its options, else one
+// generated value, and an unchecked checkbox is left out, while the field
+// being fuzzed takes generated values; the fields users fill in are fuzzed
+// in turn. A submission then fails the
+// server's validation, if at all, only on the field under test.
+func (f *WebFormFuzzer) preserveDefaults() {
+	generated := inputParams(f.nextInput())
+	f.defaults = make(map[string]string, len(f.fields))
+	f.unchecked = make(map[string]bool)
+	f.targets = nil
+	for _, name := range sortedKeys(f.fields) {
+		field := f.fields[name]
+		switch {
+		case field.Value != "":
+			f.defaults[name] = field.Value
+		case field.Type == "checkbox":
+			f.unchecked[name] = true
+		case len(field.Options) > 0:
+			f.defaults[name] = field.Options[0]
+		default:
+			f.defaults[name] = generated.Get(name)
+		}
+		if !unfuzzedTypes[field.Type] {
+			f.targets = append(f.targets, name)
+		}
+	}
+	f.logger.Info("fuzzing one field at a time", "fields", f.targets)
+}
+
+// singleFieldInput returns a generated input with every field but one,
+// picked at random, set back to its default
+func (f *WebFormFuzzer) singleFieldInput(rng *rand.Rand) string {
+	input := f.nextInput()
+	if len(f.targets) == 0 {
+		return omitParams(withParams(input, f.defaults), f.unchecked)
+	}
+	target := f.targets[rng.Intn(len(f.targets))]
+	kept := make(map[string]string, len(f.defaults))
+	for name, value := range f.defaults {
+		if name != target {
+			kept[name] = value
+		}
+	}
+	omitted := make(map[string]bool, len(f.unchecked))
+	for name := range f.unchecked {
+		if name != target {
+			omitted[name] = true
+		}
+	}
+	return omitParams(withParams(input, kept), omitted)
+}
+
+// omitParams returns a form input, "METHOD URL data", without the
+// parameters named in names
+func omitParams(input string, names map[string]bool) string {
+	if len(names) == 0 {
+		return input
+	}
+	omit := func(data string) string {
+		var kept []string
+		for _, part := range strings.Split(data, "&") {
+			rawName, _, _ := strings.Cut(part, "=")
+			if name, err := url.QueryUnescape(rawName); err != nil || !names[name] {
+				kept = append(kept, part)
+			}
+		}
+		return strings.Join(kept, "&")
+	}
+	parts := strings.SplitN(input, " ", 3)
+	switch {
+	case len(parts) == 3:
+		parts[2] = omit(parts[2])
+	case len(parts) == 2:
+		if base, query, ok := strings.Cut(parts[1], "?"); ok {
+			parts[1] = base + "?" + omit(query)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// inputParams returns the parameters of a form input, "METHOD URL data":
+// the body data, or for GET the query string
+func inputParams(input string) url.Values {
+	parts := strings.SplitN(input, " ", 3)
+	data := ""
+	switch {
+	case len(parts) == 3:
+		data = parts[2]
+	case len(parts) == 2:
+		_, data, _ = strings.Cut(parts[1], "?")
+	}
+	values, _ := url.ParseQuery(data)
+	return values
+}
@@ -0,0 +1,162 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inclusionPayload matches payloads that try to include a file: path
+// traversal, absolute system paths, stream wrappers and remote URLs
+var inclusionPayload = regexp.MustCompile(`(?i)(\.\.[/\\]|%2e%2e|%252e|/etc/|\\windows\\|win\.ini|boot\.ini|/proc/self|` +
+	`(php|file|data|expect|zip|phar)://|(https?|ftp)://)`)
+
+// remoteInclusionPayload matches payloads naming a remote file
+var remoteInclusionPayload = regexp.MustCompile(`(?i)(https?|ftp)://`)
+
+// inclusionSignature recognizes the content of an included file, or the
+// error of a failed inclusion, in a response
+type inclusionSignature struct {
+	pattern    *regexp.Regexp
+	what       string
+	remote     bool // Only counts for payloads naming a remote file
+	severity   Severity
+	confidence Confidence
+}
+
+// inclusionSignatures are checked in order; the first match is reported
+var inclusionSignatures = []inclusionSignature{
+	{regexp.MustCompile(`root:[^:\n]*:0:0:`), "content of /etc/passwd", false, SeverityCritical, ConfidenceCertain},
+	{regexp.MustCompile(`cm9vdDp4OjA6MDo|cm9vdDoqOjA6MDo`), "base64-encoded /etc/passwd", false, SeverityCritical, ConfidenceCertain},
+	{regexp.MustCompile(`(?i); for 16-bit app support|\[mci extensions\]`), "content of win.ini", false, SeverityCritical, ConfidenceCertain},
+	{regexp.MustCompile(`(?i)\[boot loader\]`), "content of boot.ini", false, SeverityCritical, ConfidenceCertain},
+	{regexp.MustCompile(`PD9waHA`), "base64-encoded PHP source, as php://filter returns it", false, SeverityHigh, ConfidenceCertain},
+	{regexp.MustCompile(`(DOCUMENT_ROOT|HTTP_USER_AGENT|SERVER_SOFTWARE|GATEWAY_INTERFACE)=`), "process environment, as /proc/self/environ holds it", false, SeverityHigh, ConfidenceFirm},
+	{regexp.MustCompile(`(?i)failed to open stream: HTTP request failed|URL file-access is disabled|allow_url_include`), "PHP error fetching a remote include", true, SeverityMedium, ConfidenceTentative},
+	{regexp.MustCompile(`(?i)failed opening '[^']*' for inclusion|(include|require)(_once)?\([^)]*\): failed to open stream`), "PHP include error", false, SeverityMedium, ConfidenceTentative},
+}
+
+// detectFileInclusion looks for the signatures of an included file in the
+// response to a file inclusion payload. A signature only counts when the
+// unfuzzed response for the same URL lacks it, so pages that always show
+// /etc/passwd or PHP settings are not reported. It returns nil when the
+// payload is no inclusion attempt, nothing matched, or config has no
+// baselines to compare with.
+func detectFileInclusion(config *Config, req *http.Request, payload string, body []byte) *Finding {
+	if config.Baselines == nil || !inclusionPayload.MatchString(fuzzedValue(req, payload)) {
+		return nil
+	}
+	remote := remoteInclusionPayload.MatchString(fuzzedValue(req, payload))
+
+	for _, signature := range inclusionSignatures {
+		if signature.remote && !remote {
+			continue
+		}
+		match := signature.pattern.Find(body)
+		if match == nil {
+			continue
+		}
+		baseline, ok := config.Baselines.body(config, unfuzzedURL(req, payload))
+		if !ok || signature.pattern.Match(baseline) {
+			continue
+		}
+
+		findingType := "file-inclusion"
+		if signature.remote {
+			findingType = "remote-file-inclusion"
+		}
+		return &Finding{
+			Type:       findingType,
+			Severity:   signature.severity,
+			Confidence: signature.confidence,
+			Evidence:   fmt.Sprintf("%s in response: %q, not in the unfuzzed response", signature.what, match),
+			Timestamp:  time.Now(),
+		}
+	}
+	return nil
+}
+
+// fuzzedValue returns the part of a request the fuzzer chose: the payload,
+// or the path and query when the payload is the whole URL, as it is for the
+// inputs of the coverage fuzzers, whose scheme is not fuzzed
+func fuzzedValue(req *http.Request, payload string) string {
+	if payload == req.URL.String() {
+		return req.URL.RequestURI()
+	}
+	return payload
+}
+
+// unfuzzedURL returns the request URL without the payload: with the payload
+// cut out where it appears in the URL, raw or escaped, and without the query
+// when the payload is the whole URL
+func unfuzzedURL(req *http.Request, payload string) string {
+	u := req.URL.String()
+	if payload == "" {
+		return u
+	}
+	if payload == u {
+		endpoint := *req.URL
+		endpoint.RawQuery = ""
+		endpoint.Fragment = ""
+		return endpoint.String()
+	}
+	for _, form := range []string{payload, url.QueryEscape(payload), url.PathEscape(payload)} {
+		if strings.Contains(u, form) {
+			return strings.Replace(u, form, "", 1)
+		}
+	}
+	return u
+}
+
+// BaselineCache holds the unfuzzed responses fuzzed ones are compared
+// with, fetched once per URL. A nil cache fetches nothing. It is safe for
+// concurrent use.
+type BaselineCache struct {
+	mu     sync.Mutex
+	bodies map[string][]byte // nil for URLs that could not be fetched
+}
+
+// NewBaselineCache creates an empty baseline cache
+func NewBaselineCache() *BaselineCache {
+	return &BaselineCache{bodies: make(map[string][]byte)}
+}
+
+// body returns the unfuzzed response body for a URL, fetching it with GET
+// the first time; ok is false when it could not be fetched. The fetch is
+// made without holding the lock, so concurrent first lookups of one URL
+// may fetch it more than once.
+func (c *BaselineCache) body(config *Config, rawURL string) ([]byte, bool) {
+	c.mu.Lock()
+	data, seen := c.bodies[rawURL]
+	c.mu.Unlock()
+	if !seen {
+		data = fetchBaseline(config, rawURL)
+		c.mu.Lock()
+		c.bodies[rawURL] = data
+		c.mu.Unlock()
+	}
+	return data, data != nil
+}
+
+// fetchBaseline returns the body of a GET of rawURL, or nil when it could
+// not be fetched
+func fetchBaseline(config *Config, rawURL string) []byte {
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	body, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil
+	}
+	return append([]byte{}, body.data...)
+}
@@ -0,0 +1,301 @@
+package fuzzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severity ranks how serious a finding is
+type Severity string
+
+// Severity levels, from least to most serious
+const (
+	SeverityInfo     Severity = "info"
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// ParseSeverity parses a severity level name
+func ParseSeverity(name string) (Severity, error) {
+	s := Severity(strings.ToLower(name))
+	if s.rank() == 0 && s != SeverityInfo {
+		return "", fmt.Errorf("unknown severity %q", name)
+	}
+	return s, nil
+}
+
+// AtLeast reports whether the severity is min or more serious
+func (s Severity) AtLeast(min Severity) bool {
+	return s.rank() >= min.rank()
+}
+
+// rank returns a sortable weight for the severity
+func (s Severity) rank() int {
+	switch s {
+	case SeverityCritical:
+		return 4
+	case SeverityHigh:
+		return 3
+	case SeverityMedium:
+		return 2
+	case SeverityLow:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Confidence describes how certain a detector is about a finding
+type Confidence string
+
+// Confidence levels, from least to most certain
+const (
+	ConfidenceTentative Confidence = "tentative"
+	ConfidenceFirm      Confidence = "firm"
+	ConfidenceCertain   Confidence = "certain"
+)
+
+// Finding represents a single issue reported by a detector
+type Finding struct {
+	Type        string     `json:"type"`                   // Detector-specific finding type (e.g. "sql-injection")
+	Severity    Severity   `json:"severity"`               // How serious the issue is
+	Confidence  Confidence `json:"confidence"`             // How certain the detector is
+	URL         string     `json:"url"`                    // URL the issue was observed on
+	Method      string     `json:"method,omitempty"`       // HTTP method of the triggering request
+	Parameter   string     `json:"parameter,omitempty"`    // Affected parameter, if any
+	Payload     string     `json:"payload,omitempty"`      // Payload that triggered the issue
+	Evidence    string     `json:"evidence,omitempty"`     // What the detector matched on
+	Source      string     `json:"source,omitempty"`       // Page the fuzzed form was found on, when URL is where it submits
+	Request     string     `json:"request,omitempty"`      // Captured raw request (headers + truncated body)
+	Response    string     `json:"response,omitempty"`     // Captured raw response (headers + truncated body)
+	Curl        string     `json:"curl,omitempty"`         // curl command reproducing the request
+	CaptureFile string     `json:"capture_file,omitempty"` // File holding the raw exchange, relative to the output directory
+	Timestamp   time.Time  `json:"timestamp"`              // When the issue was first seen
+	Occurrences int        `json:"occurrences"`            // Number of times the signature was reported
+}
+
+// Signature returns the key used to deduplicate findings. Findings of the same
+// type against the same endpoint and parameter are considered duplicates
+// regardless of the payload or query values used.
+func (f *Finding) Signature() string {
+	endpoint := f.URL
+	if u, err := url.Parse(f.URL); err == nil {
+		u.RawQuery = ""
+		u.Fragment = ""
+		endpoint = u.String()
+	}
+	return strings.Join([]string{f.Type, strings.ToUpper(f.Method), endpoint, f.Parameter}, "|")
+}
+
+// FindingStore collects findings from all detectors, deduplicating by signature
+type FindingStore struct {
+	findings []*Finding
+	seen     map[string]*Finding
+	dropped  map[string]bool // Signatures an OnFinding hook dropped
+	hooks    []Hooks
+	mu       sync.RWMutex
+	parent   *FindingStore // Store a view made by WithSource adds to
+	source   string        // Source a view sets on the findings added through it
+}
+
+// NewFindingStore creates an empty finding store
+func NewFindingStore() *FindingStore {
+	return &FindingStore{
+		findings: make([]*Finding, 0),
+		seen:     make(map[string]*Finding),
+		dropped:  make(map[string]bool),
+	}
+}
+
+// WithSource returns a view of the store that records source as the Source
+// of the findings added through it that have none. Everything else goes to
+// the store itself.
+func (s *FindingStore) WithSource(source string) *FindingStore {
+	if s == nil {
+		return nil
+	}
+	return &FindingStore{parent: s.root(), source: source}
+}
+
+// root returns the store a view adds to, or the store itself
+func (s *FindingStore) root() *FindingStore {
+	if s.parent != nil {
+		return s.parent
+	}
+	return s
+}
+
+// SetHooks sets the hooks whose OnFinding sees every new finding before it
+// is stored. Later occurrences of a finding are counted without the hooks,
+// and those of a dropped one are dropped too.
+func (s *FindingStore) SetHooks(hooks []Hooks) {
+	s = s.root()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = hooks
+}
+
+// Add records a finding and returns true if its signature had not been seen
+// before. Adding to a nil store is a no-op so detectors can run without one.
+func (s *FindingStore) Add(f *Finding) bool {
+	if s == nil || f == nil {
+		return false
+	}
+	if s.parent != nil {
+		if f.Source == "" {
+			f.Source = s.source
+		}
+		return s.parent.Add(f)
+	}
+
+	if f.Timestamp.IsZero() {
+		f.Timestamp = time.Now()
+	}
+	if f.Severity == "" {
+		f.Severity = SeverityInfo
+	}
+	if f.Confidence == "" {
+		f.Confidence = ConfidenceTentative
+	}
+
+	sig := f.Signature()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.repeated(sig, f) {
+		return false
+	}
+	if len(s.hooks) > 0 {
+		// Hooks may be slow, like a script, so other findings are stored
+		// meanwhile; one with the same signature may get in first
+		hooks := s.hooks
+		s.mu.Unlock()
+		kept := true
+		for _, h := range hooks {
+			if kept = h.OnFinding(f); !kept {
+				break
+			}
+		}
+		s.mu.Lock()
+		if !kept {
+			s.dropped[sig] = true
+			return false
+		}
+		if s.repeated(sig, f) {
+			return false
+		}
+	}
+
+	f.Occurrences = 1
+	s.seen[sig] = f
+	s.findings = append(s.findings, f)
+	return true
+}
+
+// repeated reports whether a finding with the signature is stored or was
+// dropped by a hook, counting an occurrence of a stored one. s.mu must be
+// held.
+func (s *FindingStore) repeated(sig string, f *Finding) bool {
+	if existing, ok := s.seen[sig]; ok {
+		existing.Occurrences++
+		// Escalate if a more severe variant of the same issue is reported
+		if f.Severity.rank() > existing.Severity.rank() {
+			existing.Severity = f.Severity
+		}
+		return true
+	}
+	return s.dropped[sig]
+}
+
+// Findings returns a snapshot of all findings, most severe first
+func (s *FindingStore) Findings() []*Finding {
+	if s == nil {
+		return nil
+	}
+	s = s.root()
+
+	s.mu.RLock()
+	findings := make([]*Finding, len(s.findings))
+	copy(findings, s.findings)
+	s.mu.RUnlock()
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity.rank() > findings[j].Severity.rank()
+	})
+	return findings
+}
+
+// Count returns the number of unique findings
+func (s *FindingStore) Count() int {
+	if s == nil {
+		return 0
+	}
+	s = s.root()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.findings)
+}
+
+// Save writes all findings to path as JSON lines
+func (s *FindingStore) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create findings file: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, f := range s.Findings() {
+		if err := enc.Encode(f); err != nil {
+			return fmt.Errorf("failed to encode finding: %v", err)
+		}
+	}
+	return w.Flush()
+}
+
+// LoadFindings reads findings written by Save
+func LoadFindings(path string) ([]*Finding, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open findings file: %v", err)
+	}
+	defer file.Close()
+
+	var findings []*Finding
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var f Finding
+		if err := dec.Decode(&f); err == io.EOF {
+			return findings, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode finding %d: %v", len(findings)+1, err)
+		}
+		findings = append(findings, &f)
+	}
+}
+
+// newServerErrorFinding builds the finding reported when a fuzzed input makes
+// the server fail with a 5xx status
+func newServerErrorFinding(urlStr, method, payload string, statusCode int) *Finding {
+	return &Finding{
+		Type:       "server-error",
+		Severity:   SeverityLow,
+		Confidence: ConfidenceTentative,
+		URL:        urlStr,
+		Method:     method,
+		Payload:    payload,
+		Evidence:   fmt.Sprintf("HTTP %d response", statusCode),
+	}
+}
@@ -0,0 +1,454 @@
+package fuzzer
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Technology categories
+const (
+	TechWebServer  = "web-server"
+	TechLanguage   = "language"
+	TechFramework  = "framework"
+	TechCMS        = "cms"
+	TechJavaScript = "javascript"
+	TechCDN        = "cdn"
+	TechOS         = "os"
+)
+
+// Technology is one component of the target's stack
+type Technology struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Version  string `json:"version,omitempty"`
+	Evidence string `json:"evidence"` // What revealed it
+}
+
+// TechStack is what fingerprinting learned about the target. It picks the
+// payloads worth sending: those aimed at a language or operating system
+// other than the one found are dropped, and payloads specific to the
+// languages found are added. A nil stack keeps every payload.
+type TechStack struct {
+	Technologies []Technology `json:"technologies"`
+}
+
+// techRule recognizes a technology in one place of a response: a header, a
+// cookie name, the page markup or the URL of a script. The first group of
+// the pattern, if it matched, is the version.
+type techRule struct {
+	source   string
+	pattern  *regexp.Regexp
+	name     string
+	category string
+	language string // Language the technology implies
+	platform string // Operating system the technology implies
+}
+
+// Sources techRule.source may name besides a header
+const (
+	sourceCookie = "cookie"
+	sourceHTML   = "html"
+	sourceScript = "script"
+)
+
+// techRules are checked against the target page in order
+var techRules = []techRule{
+	// Server header
+	{"Server", regexp.MustCompile(`(?i)\bnginx(?:/([\d.]+))?`), "nginx", TechWebServer, "", ""},
+	{"Server", regexp.MustCompile(`(?i)^Apache(?:/([\d.]+))?(?:\s|$)`), "Apache HTTP Server", TechWebServer, "", ""},
+	{"Server", regexp.MustCompile(`(?i)Microsoft-IIS(?:/([\d.]+))?`), "IIS", TechWebServer, "", "Windows"},
+	{"Server", regexp.MustCompile(`(?i)LiteSpeed`), "LiteSpeed", TechWebServer, "", ""},
+	{"Server", regexp.MustCompile(`(?i)\bCaddy\b`), "Caddy", TechWebServer, "", ""},
+	{"Server", regexp.MustCompile(`(?i)openresty(?:/([\d.]+))?`), "OpenResty", TechWebServer, "", ""},
+	{"Server", regexp.MustCompile(`(?i)Apache-Coyote|Tomcat(?:/([\d.]+))?`), "Apache Tomcat", TechWebServer, "Java", ""},
+	{"Server", regexp.MustCompile(`(?i)Jetty(?:\(([\d.]+))?`), "Jetty", TechWebServer, "Java", ""},
+	{"Server", regexp.MustCompile(`(?i)Kestrel`), "Kestrel", TechWebServer, "ASP.NET", ""},
+	{"Server", regexp.MustCompile(`(?i)gunicorn(?:/([\d.]+))?`), "Gunicorn", TechWebServer, "Python", ""},
+	{"Server", regexp.MustCompile(`(?i)uvicorn`), "Uvicorn", TechWebServer, "Python", ""},
+	{"Server", regexp.MustCompile(`(?i)Werkzeug(?:/([\d.]+))?`), "Werkzeug", TechWebServer, "Python", ""},
+	{"Server", regexp.MustCompile(`(?i)cloudflare`), "Cloudflare", TechCDN, "", ""},
+	{"Server", regexp.MustCompile(`(?i)\((?:Ubuntu|Debian|CentOS|Red Hat|Fedora|Amazon Linux|Unix|FreeBSD)\)`), "Unix", TechOS, "", ""},
+	{"Server", regexp.MustCompile(`(?i)\(Win(?:32|64)\)`), "Windows", TechOS, "", ""},
+
+	// Other headers
+	{"X-Powered-By", regexp.MustCompile(`(?i)\bPHP(?:/([\d.]+))?`), "PHP", TechLanguage, "", ""},
+	{"X-Powered-By", regexp.MustCompile(`(?i)ASP\.NET`), "ASP.NET", TechLanguage, "", ""},
+	{"X-Powered-By", regexp.MustCompile(`(?i)^Express$`), "Express", TechFramework, "Node.js", ""},
+	{"X-Powered-By", regexp.MustCompile(`(?i)Next\.js(?: ([\d.]+))?`), "Next.js", TechFramework, "Node.js", ""},
+	{"X-Powered-By", regexp.MustCompile(`(?i)Servlet(?:/([\d.]+))?`), "Java Servlet", TechFramework, "Java", ""},
+	{"X-AspNet-Version", regexp.MustCompile(`([\d.]+)`), "ASP.NET", TechLanguage, "", ""},
+	{"X-AspNetMvc-Version", regexp.MustCompile(`([\d.]+)`), "ASP.NET MVC", TechFramework, "ASP.NET", ""},
+	{"X-Generator", regexp.MustCompile(`(?i)Drupal(?: (\d+))?`), "Drupal", TechCMS, "PHP", ""},
+	{"X-Drupal-Cache", regexp.MustCompile(`.`), "Drupal", TechCMS, "PHP", ""},
+
+	// Cookie names
+	{sourceCookie, regexp.MustCompile(`^PHPSESSID$`), "PHP", TechLanguage, "", ""},
+	{sourceCookie, regexp.MustCompile(`^JSESSIONID$`), "Java", TechLanguage, "", ""},
+	{sourceCookie, regexp.MustCompile(`^(ASP\.NET_SessionId|\.ASPXAUTH|\.AspNetCore\..+)$`), "ASP.NET", TechLanguage, "", ""},
+	{sourceCookie, regexp.MustCompile(`^csrftoken$`), "Django", TechFramework, "Python", ""},
+	{sourceCookie, regexp.MustCompile(`^laravel_session$`), "Laravel", TechFramework, "PHP", ""},
+	{sourceCookie, regexp.MustCompile(`^ci_session$`), "CodeIgniter", TechFramework, "PHP", ""},
+	{sourceCookie, regexp.MustCompile(`^_[\w-]+_session$`), "Ruby on Rails", TechFramework, "Ruby", ""},
+	{sourceCookie, regexp.MustCompile(`^rack\.session$`), "Rack", TechFramework, "Ruby", ""},
+	{sourceCookie, regexp.MustCompile(`^connect\.sid$`), "Express", TechFramework, "Node.js", ""},
+	{sourceCookie, regexp.MustCompile(`^(wordpress_|wp-settings-)`), "WordPress", TechCMS, "PHP", ""},
+	{sourceCookie, regexp.MustCompile(`^(__cf_bm|__cfduid|cf_clearance)$`), "Cloudflare", TechCDN, "", ""},
+
+	// Page markup
+	{sourceHTML, regexp.MustCompile(`(?i)<meta[^>]+content="WordPress ?([\d.]*)"`), "WordPress", TechCMS, "PHP", ""},
+	{sourceHTML, regexp.MustCompile(`/wp-(?:content|includes)/`), "WordPress", TechCMS, "PHP", ""},
+	{sourceHTML, regexp.MustCompile(`(?i)<meta[^>]+content="Drupal ?(\d*)|Drupal\.settings`), "Drupal", TechCMS, "PHP", ""},
+	{sourceHTML, regexp.MustCompile(`(?i)<meta[^>]+content="Joomla`), "Joomla", TechCMS, "PHP", ""},
+	{sourceHTML, regexp.MustCompile(`csrfmiddlewaretoken`), "Django", TechFramework, "Python", ""},
+	{sourceHTML, regexp.MustCompile(`__VIEWSTATE|__EVENTVALIDATION`), "ASP.NET", TechLanguage, "", ""},
+	{sourceHTML, regexp.MustCompile(`name="authenticity_token"|data-turbo-track|rails-ujs`), "Ruby on Rails", TechFramework, "Ruby", ""},
+	{sourceHTML, regexp.MustCompile(`__NEXT_DATA__|/_next/static/`), "Next.js", TechFramework, "Node.js", ""},
+	{sourceHTML, regexp.MustCompile(`__NUXT__|/_nuxt/`), "Nuxt", TechFramework, "Node.js", ""},
+	{sourceHTML, regexp.MustCompile(`ng-version="([\d.]+)"`), "Angular", TechJavaScript, "", ""},
+	{sourceHTML, regexp.MustCompile(`data-reactroot`), "React", TechJavaScript, "", ""},
+	{sourceHTML, regexp.MustCompile(`data-v-[0-9a-f]{8}|data-server-rendered`), "Vue.js", TechJavaScript, "", ""},
+
+	// Script URLs
+	{sourceScript, regexp.MustCompile(`(?i)jquery[.-]?ui`), "jQuery UI", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)jquery`), "jQuery", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)bootstrap`), "Bootstrap", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)react(?:-dom)?[.@/-]`), "React", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)\bvue[.@/-]`), "Vue.js", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)angular(?:js)?[.@/-]`), "AngularJS", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)lodash`), "Lodash", TechJavaScript, "", ""},
+	{sourceScript, regexp.MustCompile(`(?i)moment[.@/-]`), "Moment.js", TechJavaScript, "", ""},
+}
+
+// scriptSrc matches the URL of a script the page loads
+var scriptSrc = regexp.MustCompile(`(?i)<script[^>]+src=["']([^"']+)["']`)
+
+// iconHref matches the favicon a page declares
+var iconHref = regexp.MustCompile(`(?i)<link[^>]+rel=["'][^"']*icon[^"']*["'][^>]*href=["']([^"']+)["']`)
+
+// versionNumber matches the version in a script URL
+var versionNumber = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// faviconHashes maps the Shodan-style favicon hash (MurmurHash3 of the
+// base64-encoded icon) of well-known applications to the application
+var faviconHashes = map[int32]techRule{
+	116323821:  {name: "Spring Boot", category: TechFramework, language: "Java"},
+	81586312:   {name: "Jenkins", category: TechFramework, language: "Java"},
+	-297069493: {name: "Apache Tomcat", category: TechWebServer, language: "Java"},
+	1278323681: {name: "GitLab", category: TechFramework, language: "Ruby"},
+}
+
+// payloadTargets recognize payloads aimed at one language or operating
+// system, which are skipped when fingerprinting found another
+var payloadTargets = []struct {
+	pattern  *regexp.Regexp
+	category string
+	name     string
+}{
+	{regexp.MustCompile(`(?i)\.php\d?\b|php://|<\?php|phpinfo|\bwp-(?:admin|content|includes|login)`), TechLanguage, "PHP"},
+	{regexp.MustCompile(`(?i)\.as[hp]x?\b|web\.config|__VIEWSTATE|trace\.axd`), TechLanguage, "ASP.NET"},
+	{regexp.MustCompile(`(?i)\.jsp\b|WEB-INF|java\.lang\.`), TechLanguage, "Java"},
+	{regexp.MustCompile(`(?i)win\.ini|boot\.ini|\\windows\\|\b[a-z]:\\|\bnet user\b`), TechOS, "Windows"},
+	{regexp.MustCompile("/etc/(?:passwd|shadow|hosts)|/proc/self|\\bcat /|\\bls -la\\b|\\$\\(id\\)|`id`"), TechOS, "Unix"},
+}
+
+// stackPayloads are added for the languages fingerprinting found
+var stackPayloads = map[string][]string{
+	"PHP": {
+		"php://filter/convert.base64-encode/resource=index.php",
+		"<?php echo 7*7; ?>",
+		"expect://id",
+	},
+	"ASP.NET": {
+		"..\\web.config",
+		"trace.axd",
+		"<%= 7*7 %>",
+	},
+	"Java": {
+		"${T(java.lang.Runtime).getRuntime().exec('id')}",
+		"../WEB-INF/web.xml",
+		"#{7*7}",
+	},
+	"Python": {
+		"{{config}}",
+		"{{''.__class__.__mro__}}",
+	},
+	"Ruby": {
+		"#{7*7}",
+		"<%= 7*7 %>",
+	},
+	"Node.js": {
+		"{\"__proto__\":{\"polluted\":true}}",
+		"require('child_process').execSync('id')",
+	},
+}
+
+// FingerprintTarget fetches the target page and its favicon, identifies the
+// technologies they reveal from headers, cookies, markup, scripts and the
+// favicon hash, and reports each as an informational finding. Requests carry
+// no payloads, so they are sent even in a dry run.
+func FingerprintTarget(config *Config) (*TechStack, error) {
+	client, err := newDiscoveryClient(config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch target: %v", err)
+	}
+	defer resp.Body.Close()
+	page, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read target: %v", err)
+	}
+
+	stack := &TechStack{}
+	for _, rule := range techRules {
+		switch rule.source {
+		case sourceCookie:
+			for _, cookie := range resp.Cookies() {
+				if rule.pattern.MatchString(cookie.Name) {
+					stack.add(rule, "", "cookie "+cookie.Name)
+				}
+			}
+		case sourceHTML:
+			if match := rule.pattern.FindSubmatch(page.data); match != nil {
+				stack.add(rule, submatch(match), fmt.Sprintf("page markup %q", match[0]))
+			}
+		case sourceScript:
+			for _, src := range scriptSrc.FindAllSubmatch(page.data, -1) {
+				if rule.pattern.Match(src[1]) {
+					stack.add(rule, versionNumber.FindString(string(src[1])), "script "+string(src[1]))
+				}
+			}
+		default:
+			for _, value := range resp.Header.Values(rule.source) {
+				if match := rule.pattern.FindStringSubmatch(value); match != nil {
+					stack.add(rule, stringSubmatch(match), fmt.Sprintf("%s: %s", rule.source, value))
+				}
+			}
+		}
+	}
+
+	if hash, ok := faviconHash(client, config, resp.Request.URL, page.data); ok {
+		if rule, known := faviconHashes[hash]; known {
+			stack.add(rule, "", fmt.Sprintf("favicon hash %d", hash))
+		}
+	}
+
+	var names []string
+	for _, tech := range stack.Technologies {
+		names = append(names, tech.Name)
+		evidence := tech.Evidence
+		if tech.Version != "" {
+			evidence = fmt.Sprintf("version %s, %s", tech.Version, evidence)
+		}
+		config.Findings.Add(&Finding{
+			Type:       "technology",
+			Severity:   SeverityInfo,
+			Confidence: ConfidenceFirm,
+			URL:        config.TargetURL,
+			Method:     http.MethodGet,
+			Parameter:  tech.Name,
+			Evidence:   evidence,
+		})
+	}
+	logging.For("fingerprint").Info("fingerprinted target", "url", config.TargetURL, "technologies", strings.Join(names, ", "))
+	return stack, nil
+}
+
+// add records a technology, and the language and operating system it
+// implies. A technology already recorded only gains a missing version.
+func (s *TechStack) add(rule techRule, version, evidence string) {
+	s.record(Technology{Name: rule.name, Category: rule.category, Version: version, Evidence: evidence})
+	if rule.language != "" {
+		s.record(Technology{Name: rule.language, Category: TechLanguage, Evidence: "implied by " + rule.name})
+	}
+	if rule.platform != "" {
+		s.record(Technology{Name: rule.platform, Category: TechOS, Evidence: "implied by " + rule.name})
+	}
+}
+
+// record appends tech unless a technology of that name is known
+func (s *TechStack) record(tech Technology) {
+	for i := range s.Technologies {
+		if s.Technologies[i].Name == tech.Name {
+			if s.Technologies[i].Version == "" {
+				s.Technologies[i].Version = tech.Version
+			}
+			return
+		}
+	}
+	s.Technologies = append(s.Technologies, tech)
+}
+
+// Has reports whether a technology of that name was found
+func (s *TechStack) Has(name string) bool {
+	if s == nil {
+		return false
+	}
+	for _, tech := range s.Technologies {
+		if tech.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCategory reports whether any technology of the category was found
+func (s *TechStack) hasCategory(category string) bool {
+	for _, tech := range s.Technologies {
+		if tech.Category == category {
+			return true
+		}
+	}
+	return false
+}
+
+// Relevant reports whether a payload suits the stack. Payloads aimed at a
+// language or operating system are irrelevant when fingerprinting found
+// technologies of that kind but not the one aimed at.
+func (s *TechStack) Relevant(payload string) bool {
+	if s == nil {
+		return true
+	}
+	for _, target := range payloadTargets {
+		if target.pattern.MatchString(payload) && s.hasCategory(target.category) && !s.Has(target.name) {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectPayloads drops the payloads irrelevant to the stack and adds those
+// specific to the languages found. Payloads are returned unchanged when the
+// stack is nil or nothing relevant would be left.
+func (s *TechStack) SelectPayloads(payloads []string) []string {
+	if s == nil {
+		return payloads
+	}
+
+	var selected []string
+	seen := make(map[string]bool)
+	for _, payload := range payloads {
+		if s.Relevant(payload) {
+			selected = append(selected, payload)
+			seen[payload] = true
+		}
+	}
+	if len(selected) == 0 {
+		return payloads
+	}
+	skipped := len(payloads) - len(selected)
+
+	for _, tech := range s.Technologies {
+		for _, payload := range stackPayloads[tech.Name] {
+			if !seen[payload] {
+				selected = append(selected, payload)
+				seen[payload] = true
+			}
+		}
+	}
+	logging.For("fingerprint").Debug("selected payloads for the stack", "skipped", skipped,
+		"added", len(selected)-len(payloads)+skipped)
+	return selected
+}
+
+// faviconHash fetches the favicon the page declares, or /favicon.ico, and
+// returns its hash
+func faviconHash(client *http.Client, config *Config, pageURL *url.URL, page []byte) (int32, bool) {
+	iconURL := pageURL.ResolveReference(&url.URL{Path: "/favicon.ico"})
+	if match := iconHref.FindSubmatch(page); match != nil {
+		if ref, err := url.Parse(string(match[1])); err == nil {
+			iconURL = pageURL.ResolveReference(ref)
+		}
+	}
+
+	resp, err := client.Get(iconURL.String())
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+	icon, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil || resp.StatusCode != http.StatusOK || len(icon.data) == 0 {
+		return 0, false
+	}
+	return murmur3(encodeBase64Lines(icon.data)), true
+}
+
+// encodeBase64Lines encodes data as base64 in lines of 76 characters, each
+// ending in a newline, the form the favicon hashes are computed over
+func encodeBase64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for i := 0; i < len(encoded); i += 76 {
+		b.WriteString(encoded[i:min(i+76, len(encoded))])
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// murmur3 returns the 32-bit MurmurHash3 of data with seed 0, as a signed
+// integer like the favicon hashes are published
+func murmur3(data []byte) int32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	var h uint32
+	n := len(data)
+	for i := 0; i+4 <= n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[n&^3:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return int32(h)
+}
+
+// submatch returns the first group of a match, if it matched
+func submatch(match [][]byte) string {
+	if len(match) > 1 {
+		return string(match[1])
+	}
+	return ""
+}
+
+// stringSubmatch returns the first group of a match, if it matched
+func stringSubmatch(match []string) string {
+	if len(match) > 1 {
+		return match[1]
+	}
+	return ""
+}
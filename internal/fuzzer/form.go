@@ -1,10 +1,312 @@
 package fuzzer
 
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	formhtml "github.com/gregcmartin/gofuzz/internal/html"
+	"golang.org/x/net/html"
+)
+
+// Form encodings a form can declare in its enctype attribute
+const (
+	EnctypeURLEncoded = "application/x-www-form-urlencoded"
+	EnctypeMultipart  = "multipart/form-data"
+	EnctypeTextPlain  = "text/plain"
+)
+
 // FormField represents an HTML form field
 type FormField struct {
-	Name     string
-	Type     string
-	Options  []string // For select/radio fields
-	Required bool
-	Pattern  string // HTML5 pattern attribute
+	Name      string
+	Type      string
+	Options   []string // Values of select options and radio and checkbox groups
+	Required  bool
+	Pattern   string // HTML5 pattern attribute
+	Value     string // Value the page fills in, a sample of the field's format
+	Min       string // min attribute of number, range and date fields
+	Max       string // max attribute
+	Step      string // step attribute, "any" for no step
+	MinLength int    // minlength attribute, 0 for none
+	MaxLength int    // maxlength attribute, 0 for none
+}
+
+// bounds returns the numeric and length bounds of the field's values
+func (f FormField) bounds() formhtml.Bounds {
+	return formhtml.FieldBounds(f.Type, f.Min, f.Max, f.Step, f.MinLength, f.MaxLength)
+}
+
+// Form is an HTML form: where it submits, how, and its fields
+type Form struct {
+	Action  string // Absolute URL the form submits to
+	Method  string // GET or POST
+	Enctype string // How a POST body is encoded, one of the Enctype constants
+	Fields  []FormField
+}
+
+// newForm returns a form with its action resolved against the page URL and
+// its method and encoding defaulted and normalized as browsers do
+func newForm(action, method, enctype string, page *url.URL) Form {
+	form := Form{Action: page.String(), Method: http.MethodGet, Enctype: EnctypeURLEncoded}
+	if action = strings.TrimSpace(action); action != "" {
+		if ref, err := url.Parse(action); err == nil {
+			form.Action = page.ResolveReference(ref).String()
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(method), http.MethodPost) {
+		form.Method = http.MethodPost
+	}
+	switch strings.ToLower(strings.TrimSpace(enctype)) {
+	case EnctypeMultipart:
+		form.Enctype = EnctypeMultipart
+	case EnctypeTextPlain:
+		form.Enctype = EnctypeTextPlain
+	}
+	return form
+}
+
+// fieldMap returns the form's fields by name, the first of each name, with
+// the options of radio buttons and checkboxes sharing a name merged
+func (f Form) fieldMap() map[string]FormField {
+	fields := make(map[string]FormField, len(f.Fields))
+	for _, field := range f.Fields {
+		group, ok := fields[field.Name]
+		switch {
+		case !ok:
+			fields[field.Name] = field
+		case group.Type == field.Type && (field.Type == "radio" || field.Type == "checkbox"):
+			group.Options = append(append([]string(nil), group.Options...), field.Options...)
+			if group.Value == "" {
+				group.Value = field.Value
+			}
+			fields[field.Name] = group
+		}
+	}
+	return fields
+}
+
+// benignValues are what navigationURLs fill fields of each type with that
+// the page leaves empty and that have no options
+var benignValues = map[string]string{
+	"number": "1", "range": "1", "email": "test@example.com", "url": "http://example.com/",
+	"tel": "5555555555", "date": "2024-01-01", "month": "2024-01", "week": "2024-W01",
+	"time": "12:00", "datetime-local": "2024-01-01T12:00", "color": "#000000",
+}
+
+// navigationURLs returns the URLs a GET form leads to, as a browser submits
+// it: first with benign values, those the page fills in, else the first
+// option, else a placeholder of the field's type, then once for each other
+// option of its selects and radio groups, up to max URLs. Search and filter
+// forms lead to pages no link does. Other forms, and file fields, yield
+// none, and unchecked checkboxes are left out as browsers do.
+func (f Form) navigationURLs(max int) []string {
+	action, err := url.Parse(f.Action)
+	if f.Method != http.MethodGet || err != nil {
+		return nil
+	}
+	fields := f.fieldMap()
+	values := url.Values{}
+	for _, name := range sortedKeys(fields) {
+		field := fields[name]
+		switch {
+		case field.Type == "file" || field.Type == "reset" || field.Type == "button":
+		case field.Value != "":
+			values.Set(name, field.Value)
+		case field.Type == "checkbox":
+		case len(field.Options) > 0:
+			values.Set(name, field.Options[0])
+		case benignValues[field.Type] != "":
+			values.Set(name, benignValues[field.Type])
+		default:
+			values.Set(name, "test")
+		}
+	}
+
+	var urls []string
+	add := func(query url.Values) {
+		if len(urls) < max {
+			action.RawQuery = query.Encode() // Browsers replace the action's query
+			urls = append(urls, action.String())
+		}
+	}
+	add(values)
+	for _, name := range sortedKeys(fields) {
+		field := fields[name]
+		if field.Type != "select" && field.Type != "radio" {
+			continue
+		}
+		for _, option := range field.Options {
+			if option == values.Get(name) {
+				continue
+			}
+			variant := url.Values{}
+			for key, value := range values {
+				variant[key] = value
+			}
+			variant.Set(name, option)
+			add(variant)
+		}
+	}
+	return urls
+}
+
+// signature identifies forms that submit the same fields the same way, so a
+// form repeated on many pages is only kept once
+func (f Form) signature() string {
+	var fields []string
+	for _, field := range f.Fields {
+		fields = append(fields, fmt.Sprintf("%s:%s:%v:%s",
+			field.Name, field.Type, field.Required, field.Pattern))
+	}
+	sort.Strings(fields) // Sort for consistent ordering
+	return f.Method + " " + f.Action + " " + f.Enctype + " " + strings.Join(fields, "|")
+}
+
+// parseForms returns the forms of a parsed HTML page, in document order.
+// Fields outside any form, as on pages that submit them from JavaScript,
+// make up a last form submitting to the page itself.
+func parseForms(doc *html.Node, page *url.URL) []Form {
+	var forms []Form
+	var loose []FormField
+
+	var walk func(n *html.Node, form *Form)
+	walk = func(n *html.Node, form *Form) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "form":
+				if form == nil {
+					found := newForm(attrValue(n, "action"), attrValue(n, "method"), attrValue(n, "enctype"), page)
+					for c := n.FirstChild; c != nil; c = c.NextSibling {
+						walk(c, &found)
+					}
+					forms = append(forms, found)
+					return
+				}
+			case "input", "select", "textarea":
+				if field, ok := parseFormField(n); ok {
+					if form != nil {
+						form.Fields = append(form.Fields, field)
+					} else {
+						loose = append(loose, field)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, form)
+		}
+	}
+	walk(doc, nil)
+
+	if len(loose) > 0 {
+		form := newForm("", "", "", page)
+		form.Fields = loose
+		forms = append(forms, form)
+	}
+	return forms
+}
+
+// parseFormField reads a named input, select or textarea element. A radio
+// button or checkbox has its value as its one option, and as its value only
+// when checked.
+func parseFormField(n *html.Node) (FormField, bool) {
+	field := FormField{}
+	checked := false
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "name":
+			field.Name = attr.Val
+		case "type":
+			field.Type = strings.ToLower(attr.Val)
+		case "required":
+			field.Required = true
+		case "pattern":
+			field.Pattern = attr.Val
+		case "value":
+			field.Value = attr.Val
+		case "min":
+			field.Min = attr.Val
+		case "max":
+			field.Max = attr.Val
+		case "step":
+			field.Step = attr.Val
+		case "minlength":
+			field.MinLength, _ = strconv.Atoi(attr.Val)
+		case "maxlength":
+			field.MaxLength, _ = strconv.Atoi(attr.Val)
+		case "checked":
+			checked = true
+		}
+	}
+	switch n.Data {
+	case "select":
+		field.Type = "select"
+		field.Options = extractSelectOptions(n)
+	case "textarea":
+		field.Type = "textarea"
+		if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			field.Value = n.FirstChild.Data
+		}
+	case "input":
+		if field.Type == "radio" || field.Type == "checkbox" {
+			if field.Value == "" {
+				field.Value = "on" // What browsers submit for a box without a value
+			}
+			field.Options = []string{field.Value}
+			if !checked {
+				field.Value = ""
+			}
+		}
+	}
+	return field, field.Name != ""
+}
+
+// attrValue returns the value of an element's attribute, or ""
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// encodeFormBody encodes URL-encoded form data, "a=1&b=2", as a POST body in
+// the form's encoding, and returns it with its Content-Type
+func encodeFormBody(data, enctype string) ([]byte, string, error) {
+	switch enctype {
+	case EnctypeMultipart, EnctypeTextPlain:
+	default:
+		return []byte(data), EnctypeURLEncoded, nil
+	}
+	// Malformed escapes in fuzzed data are sent as far as they parse
+	values, _ := url.ParseQuery(data)
+
+	var buf bytes.Buffer
+	if enctype == EnctypeTextPlain {
+		for _, name := range sortedKeys(values) {
+			for _, value := range values[name] {
+				fmt.Fprintf(&buf, "%s=%s\r\n", name, value)
+			}
+		}
+		return buf.Bytes(), EnctypeTextPlain, nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	for _, name := range sortedKeys(values) {
+		for _, value := range values[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
 }
@@ -0,0 +1,282 @@
+package fuzzer
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// frameLoadTimeout bounds loading one page in the harness
+const frameLoadTimeout = 15 * time.Second
+
+// formTag recognizes pages with a form, whose actions a framing page could
+// trick a visitor into taking
+var formTag = regexp.MustCompile(`(?i)<form[\s>]`)
+
+// framePolicy is what a response's headers say about framing
+type framePolicy struct {
+	refused bool   // Cross-origin framing is refused
+	headers string // The headers that tell, for evidence
+}
+
+// frameProtection reads the framing policy of a response. A CSP
+// frame-ancestors directive takes precedence over X-Frame-Options in
+// browsers; a policy only reported, ALLOW-FROM, which browsers no longer
+// support, and wildcard sources refuse nothing.
+func frameProtection(header http.Header) framePolicy {
+	var policy framePolicy
+	var seen []string
+	csp := false
+	for _, value := range header.Values("Content-Security-Policy") {
+		for _, directive := range strings.Split(value, ";") {
+			fields := strings.Fields(strings.TrimSpace(directive))
+			if len(fields) == 0 || !strings.EqualFold(fields[0], "frame-ancestors") {
+				continue
+			}
+			csp = true
+			seen = append(seen, "Content-Security-Policy: "+strings.Join(fields, " "))
+			if !anyAncestor(fields[1:]) {
+				policy.refused = true
+			}
+		}
+	}
+	for _, value := range header.Values("X-Frame-Options") {
+		seen = append(seen, "X-Frame-Options: "+value)
+		switch strings.ToUpper(strings.TrimSpace(value)) {
+		case "DENY", "SAMEORIGIN":
+			if !csp {
+				policy.refused = true
+			}
+		}
+	}
+	if len(seen) == 0 {
+		policy.headers = "no X-Frame-Options or CSP frame-ancestors"
+		if header.Get("Content-Security-Policy-Report-Only") != "" {
+			policy.headers += " (a report-only CSP is not enforced)"
+		}
+	} else {
+		policy.headers = strings.Join(seen, ", ")
+	}
+	return policy
+}
+
+// anyAncestor reports whether frame-ancestors sources let any site frame the
+// page: a wildcard or a bare scheme
+func anyAncestor(sources []string) bool {
+	for _, source := range sources {
+		switch strings.ToLower(source) {
+		case "*", "http:", "https:", "http://*", "https://*":
+			return true
+		}
+	}
+	return false
+}
+
+// FrameTester looks for pages that other sites can frame, which lets them
+// overlay the page with their own and trick a visitor into clicking it. It
+// reads each page's X-Frame-Options and CSP frame-ancestors, then loads the
+// page, with the configured credentials, in an iframe of a harness page
+// served from a local address in a headless browser, and reports the pages
+// that render there. Without a browser, the headers alone decide.
+type FrameTester struct {
+	config  *Config
+	client  *http.Client
+	browser context.Context // Headless browser tab, nil when none could start
+	harness string          // URL of the local harness page
+	tested  map[string]bool
+	logger  *slog.Logger
+}
+
+// NewFrameTester creates a clickjacking tester
+func NewFrameTester(config *Config) (*FrameTester, error) {
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+	return &FrameTester{
+		config: config,
+		client: client,
+		tested: make(map[string]bool),
+		logger: logging.For("frames"),
+	}, nil
+}
+
+// Run tests the configured target URL
+func (t *FrameTester) Run() error {
+	t.Test([]string{t.config.TargetURL}, t.config.Deadline)
+	return nil
+}
+
+// Test checks every HTML page among the URLs, each path once, and stops once
+// the deadline passes if one is set. It returns the number of pages checked.
+func (t *FrameTester) Test(urls []string, deadline time.Time) int {
+	stop, err := t.startBrowser()
+	if err != nil {
+		t.logger.Warn("headless browser unavailable, judging frameability by headers alone", "error", err)
+	}
+	defer stop()
+
+	tested := 0
+	for _, targetURL := range urls {
+		parsed, err := url.Parse(targetURL)
+		if err != nil {
+			continue
+		}
+		key := parsed.Host + parsed.Path
+		if t.tested[key] {
+			continue
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return tested
+		}
+		t.tested[key] = true
+
+		finding, checked := t.check(targetURL)
+		if checked {
+			tested++
+		}
+		if finding != nil && t.config.Findings.Add(finding) {
+			t.logger.Warn("clickjacking", "url", finding.URL, "evidence", finding.Evidence)
+		}
+	}
+	return tested
+}
+
+// startBrowser serves the harness page on a local address and opens a
+// browser tab that sends the configured headers and cookies. The returned
+// function closes both; it is safe to call when starting failed.
+func (t *FrameTester) startBrowser() (func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return func() {}, fmt.Errorf("failed to serve harness: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(serveHarness)}
+	go server.Serve(listener)
+
+	browser, cancel := newBrowserContext(t.config.Resolve, t.config.InsecureSkipVerify)
+	stop := func() {
+		cancel()
+		server.Close()
+	}
+	actions := []chromedp.Action{network.Enable()}
+	if headers := extraHeaders(t.config); len(headers) > 0 {
+		extra := make(network.Headers, len(headers))
+		for _, header := range headers {
+			extra[header[0]] = header[1]
+		}
+		actions = append(actions, network.SetExtraHTTPHeaders(extra))
+	}
+	if err := chromedp.Run(browser, actions...); err != nil {
+		stop()
+		return func() {}, err
+	}
+	t.browser = browser
+	t.harness = "http://" + listener.Addr().String() + "/"
+	return stop, nil
+}
+
+// serveHarness answers with a page framing the URL in its url parameter
+func serveHarness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html><html><body><iframe src="%s" width="1024" height="768"></iframe></body></html>`,
+		html.EscapeString(r.URL.Query().Get("url")))
+}
+
+// check fetches one page and, when it is HTML, returns a finding if another
+// site can frame it. It reports whether the page was checked.
+func (t *FrameTester) check(targetURL string) (*Finding, bool) {
+	req, err := http.NewRequest(http.MethodGet, targetURL, nil)
+	if err != nil {
+		return nil, false
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+	body, err := readLimited(resp.Body, maxBodySize(t.config))
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 ||
+		!strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/html") {
+		return nil, false
+	}
+
+	policy := frameProtection(resp.Header)
+	finding := &Finding{
+		Type:       "clickjacking",
+		Severity:   SeverityLow,
+		Confidence: ConfidenceFirm,
+		URL:        targetURL,
+		Method:     http.MethodGet,
+		Parameter:  "X-Frame-Options",
+	}
+	if formTag.Match(body.data) {
+		finding.Severity = SeverityMedium
+	}
+	what := "the page"
+	if finding.Severity == SeverityMedium {
+		what = "the page, which has a form,"
+	}
+
+	if t.browser == nil {
+		if policy.refused {
+			return nil, true
+		}
+		finding.Evidence = fmt.Sprintf("%s can be framed by any site: %s", what, policy.headers)
+	} else {
+		rendered, err := t.rendersFramed(targetURL)
+		if err != nil {
+			t.logger.Debug("harness failed", "url", targetURL, "error", err)
+			return nil, false
+		}
+		if !rendered {
+			if !policy.refused {
+				t.logger.Debug("frame refused without a framing header", "url", targetURL, "headers", policy.headers)
+			}
+			return nil, true
+		}
+		finding.Confidence = ConfidenceCertain
+		finding.Evidence = fmt.Sprintf("%s renders in an iframe of a page on another origin in a headless browser: %s",
+			what, policy.headers)
+		if policy.refused {
+			finding.Evidence += ", which the browser did not enforce"
+		}
+	}
+	captureExchange(finding, req, nil, resp, body.data)
+	return finding, true
+}
+
+// rendersFramed loads the harness page framing targetURL and reports whether
+// the frame holds the page rather than the browser's error page
+func (t *FrameTester) rendersFramed(targetURL string) (bool, error) {
+	ctx, cancel := context.WithTimeout(t.browser, frameLoadTimeout)
+	defer cancel()
+	var tree *page.FrameTree
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(t.harness+"?url="+url.QueryEscape(targetURL)),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			tree, err = page.GetFrameTree().Do(ctx)
+			return err
+		}),
+	)
+	if err != nil {
+		return false, err
+	}
+	if len(tree.ChildFrames) == 0 {
+		return false, fmt.Errorf("harness page has no frame")
+	}
+	frame := tree.ChildFrames[0].Frame
+	return frame.UnreachableURL == "" && strings.HasPrefix(frame.URL, "http"), nil
+}
@@ -0,0 +1,433 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Full-auto stages, in the order they run
+const (
+	StageCrawl     = "crawl"     // Discover forms, API endpoints and parameterized URLs
+	StageAccess    = "access"    // Replay the crawled URLs as the other identities to find broken access control
+	StageIDs       = "ids"       // Try neighbouring identifiers in the crawled URLs to find enumerable resources
+	StageCache     = "cache"     // Probe the crawled URLs for web cache poisoning and deception
+	StageFrames    = "frames"    // Load the crawled pages in a cross-origin iframe to find clickjacking
+	StageBackups   = "backups"   // Look for backup copies of the crawled files and archives of their directories
+	StageVCS       = "vcs"       // Look for version control metadata served from the crawled directories
+	StageAdmin     = "admin"     // Look for known admin panels and debug endpoints
+	StageAPI       = "api"       // Fuzz detected API endpoints, with schema-driven bodies
+	StageForms     = "forms"     // Fuzz discovered forms
+	StageParams    = "params"    // Fuzz the query strings of parameterized URLs
+	StageInjection = "injection" // Probe every query parameter for SQL injection and reflected XSS
+)
+
+// Stage outcomes recorded in the full-auto report
+const (
+	stageCompleted = "completed"
+	stageTimedOut  = "timed-out"
+	stageSkipped   = "skipped"
+	stageFailed    = "failed"
+)
+
+// stageOrder lists the full-auto stages in execution order
+var stageOrder = []string{StageCrawl, StageAccess, StageIDs, StageCache, StageFrames, StageBackups, StageVCS, StageAdmin,
+	StageAPI, StageForms, StageParams, StageInjection}
+
+// DefaultStageBudgets are the time limits of the full-auto stages. A stage
+// that runs out stops starting requests and hands over to the next one.
+var DefaultStageBudgets = map[string]time.Duration{
+	StageCrawl:     2 * time.Minute,
+	StageAccess:    2 * time.Minute,
+	StageIDs:       2 * time.Minute,
+	StageCache:     2 * time.Minute,
+	StageFrames:    2 * time.Minute,
+	StageBackups:   2 * time.Minute,
+	StageVCS:       time.Minute,
+	StageAdmin:     time.Minute,
+	StageAPI:       3 * time.Minute,
+	StageForms:     5 * time.Minute,
+	StageParams:    5 * time.Minute,
+	StageInjection: 3 * time.Minute,
+}
+
+// ParseStageBudgets parses stage=duration overrides of the default stage
+// budgets, e.g. "crawl=30s"
+func ParseStageBudgets(specs []string) (map[string]time.Duration, error) {
+	budgets := make(map[string]time.Duration)
+	for _, spec := range specs {
+		stage, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid stage budget %q: expected stage=duration", spec)
+		}
+		if _, known := DefaultStageBudgets[stage]; !known {
+			return nil, fmt.Errorf("invalid stage budget %q: unknown stage %q (want one of %s)",
+				spec, stage, strings.Join(stageOrder, ", "))
+		}
+		budget, err := time.ParseDuration(value)
+		if err != nil || budget <= 0 {
+			return nil, fmt.Errorf("invalid stage budget %q: expected a positive duration", spec)
+		}
+		budgets[stage] = budget
+	}
+	return budgets, nil
+}
+
+// StageResult records how one full-auto stage went
+type StageResult struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`          // completed, timed-out, skipped or failed
+	Budget   float64 `json:"budget_seconds"`  // Time the stage was allowed
+	Seconds  float64 `json:"seconds"`         // Time the stage took
+	Targets  int     `json:"targets"`         // Targets the stage worked on
+	Findings int     `json:"findings"`        // Findings first reported during the stage
+	Error    string  `json:"error,omitempty"` // Why the stage failed
+}
+
+// FullAutoReport is the combined report of a full-auto run
+type FullAutoReport struct {
+	TargetURL    string           `json:"target_url"`
+	Started      time.Time        `json:"started"`
+	Seconds      float64          `json:"seconds"`
+	Stages       []StageResult    `json:"stages"`
+	Technologies []Technology     `json:"technologies"` // Technologies fingerprinted before the run
+	Targets      map[string]int   `json:"targets"`      // Targets discovered, by kind
+	Findings     int              `json:"findings"`     // Distinct findings from all stages
+	BySeverity   map[Severity]int `json:"by_severity"`  // Findings per severity
+	ByType       map[string]int   `json:"by_type"`      // Findings per finding type
+	Outages      []Outage         `json:"outages"`      // When the target was unstable and fuzzing paused
+}
+
+// FullAuto runs every testing capability against the target in stages:
+// crawl, access control testing, identifier enumeration, cache probes,
+// clickjacking checks, backup file discovery, version control metadata
+// discovery, admin panel and debug endpoint checks, API fuzzing, form
+// fuzzing, parameter fuzzing and injection probes.
+// Each stage has its own time budget; the request budget is split across
+// the fuzzed targets. Findings from all stages go to the shared store and
+// a combined report is written to report.json in the output directory.
+type FullAuto struct {
+	config       *Config
+	orchestrator *Orchestrator
+	budgets      map[string]time.Duration
+	targets      []Target
+	urls         []string // Crawled pages and GET API endpoints, for access and identifier testing
+	assets       []string // Scripts, stylesheets and other files the crawled pages reference
+	logger       *slog.Logger
+}
+
+// NewFullAuto creates a full-auto run for the configured target
+func NewFullAuto(config *Config) (*FullAuto, error) {
+	orchestrator, err := NewOrchestrator(config)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := make(map[string]time.Duration)
+	for stage, budget := range DefaultStageBudgets {
+		budgets[stage] = budget
+	}
+	for stage, budget := range config.StageBudgets {
+		budgets[stage] = budget
+	}
+
+	// Full-auto enables every capability the stages draw on
+	config.APIFuzzing = true
+	config.APISchema = true
+	config.APIProbe = true
+	config.SQLInjection = true
+	config.CommandInjection = true
+	config.NoSQLInjection = true
+	config.LDAPInjection = true
+	config.XPathInjection = true
+	config.ELInjection = true
+	config.PollutionProbes = true
+	config.Normalization = true
+	config.EnumerateIDs = true
+	config.CacheProbes = true
+	config.Clickjacking = true
+	config.BackupFiles = true
+	config.VCSMetadata = true
+	config.AdminPanels = true
+	config.MassAssignment = true
+	config.PaginationAbuse = true
+	config.ContentTypeConfusion = true
+	config.XXE = true
+	config.BoundaryValues = true
+
+	return &FullAuto{
+		config:       config,
+		orchestrator: orchestrator,
+		budgets:      budgets,
+		logger:       logging.For("fullauto"),
+	}, nil
+}
+
+// Run executes the stages in order and writes the combined report
+func (a *FullAuto) Run() error {
+	report := &FullAutoReport{
+		TargetURL: a.config.TargetURL,
+		Started:   time.Now(),
+		Targets:   make(map[string]int),
+	}
+
+	for _, stage := range stageOrder {
+		report.Stages = append(report.Stages, a.runStage(stage))
+
+		// A failed crawl leaves nothing for the other stages
+		if stage == StageCrawl && report.Stages[0].Status == stageFailed {
+			break
+		}
+	}
+
+	if a.config.Stack != nil {
+		report.Technologies = a.config.Stack.Technologies
+	}
+	report.Outages = a.config.Breaker.Outages()
+	for _, target := range a.targets {
+		report.Targets[target.Kind]++
+	}
+	report.BySeverity = make(map[Severity]int)
+	report.ByType = make(map[string]int)
+	for _, finding := range a.config.Findings.Findings() {
+		report.Findings++
+		report.BySeverity[finding.Severity]++
+		report.ByType[finding.Type]++
+	}
+	report.Seconds = time.Since(report.Started).Seconds()
+
+	path := filepath.Join(a.config.OutputDir, "report.json")
+	if err := writeFullAutoReport(path, report); err != nil {
+		return err
+	}
+	a.logger.Info("full-auto run complete", "findings", report.Findings,
+		"duration", time.Since(report.Started).Round(time.Second), "report", path)
+	return nil
+}
+
+// runStage runs one stage within its time budget and records the outcome
+func (a *FullAuto) runStage(stage string) StageResult {
+	budget := a.budgets[stage]
+	deadline := time.Now().Add(budget)
+	if !a.config.Deadline.IsZero() && a.config.Deadline.Before(deadline) {
+		deadline = a.config.Deadline
+	}
+
+	a.logger.Info("starting stage", "stage", stage, "budget", budget)
+	start := time.Now()
+	before := a.config.Findings.Count()
+
+	var worked int
+	var err error
+	switch stage {
+	case StageCrawl:
+		var crawler *WebCrawler
+		if crawler, err = a.orchestrator.crawl(time.Until(deadline)); err == nil {
+			a.targets = a.orchestrator.collectTargets(crawler)
+			a.urls = accessURLs(crawler.GetVisitedURLs(), crawler.GetAPIEndpoints())
+			a.assets = crawler.GetAssets()
+		}
+		worked = len(a.targets)
+	case StageAccess:
+		worked = a.testAccess(deadline)
+	case StageIDs:
+		worked = a.enumerateIDs(deadline)
+	case StageCache:
+		worked = a.testCache(deadline)
+	case StageFrames:
+		worked = a.testFrames(deadline)
+	case StageBackups:
+		worked = a.findBackups(deadline)
+	case StageVCS:
+		worked = a.findVCS(deadline)
+	case StageAdmin:
+		worked = a.findAdminPanels(deadline)
+	case StageAPI:
+		worked = a.fuzzKind(TargetAPI, deadline)
+	case StageForms:
+		worked = a.fuzzKind(TargetForm, deadline)
+	case StageParams:
+		worked = a.fuzzKind(TargetParams, deadline)
+	case StageInjection:
+		worked = a.probeInjection(deadline)
+	}
+
+	result := StageResult{
+		Name:     stage,
+		Status:   stageCompleted,
+		Budget:   budget.Seconds(),
+		Seconds:  time.Since(start).Seconds(),
+		Targets:  worked,
+		Findings: a.config.Findings.Count() - before,
+	}
+	switch {
+	case err != nil:
+		result.Status = stageFailed
+		result.Error = err.Error()
+	case time.Now().After(deadline):
+		result.Status = stageTimedOut
+	case worked == 0:
+		result.Status = stageSkipped
+	}
+
+	a.logger.Info("stage finished", "stage", stage, "status", result.Status,
+		"targets", result.Targets, "findings", result.Findings,
+		"duration", time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		a.logger.Error("stage failed", "stage", stage, "error", err)
+	}
+	return result
+}
+
+// fuzzKind fuzzes the discovered targets of one kind until the deadline,
+// most promising first, each with its share of the request budget. The
+// budget is split across the targets of all kinds.
+func (a *FullAuto) fuzzKind(kind string, deadline time.Time) int {
+	prioritized := prioritizeTargets(a.targets)
+	allShares := requestShares(a.config.NumRequests, prioritized)
+
+	var targets []Target
+	var shares []int
+	for i, target := range prioritized {
+		if target.Kind == kind {
+			targets = append(targets, target)
+			shares = append(shares, allShares[i])
+		}
+	}
+	return a.orchestrator.fuzzTargets(targets, shares, deadline)
+}
+
+// testAccess replays the crawled URLs as every configured identity and with
+// no credentials. It returns the number of URLs tested, 0 when there are no
+// identities to compare.
+func (a *FullAuto) testAccess(deadline time.Time) int {
+	if len(a.config.Identities) == 0 {
+		return 0
+	}
+	tester, err := NewAccessTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create access tester", "error", err)
+		return 0
+	}
+	return tester.Test(a.urls, deadline)
+}
+
+// enumerateIDs tries neighbouring identifiers in the crawled URLs. It
+// returns the number of identifiers tested.
+func (a *FullAuto) enumerateIDs(deadline time.Time) int {
+	tester, err := NewEnumerationTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create enumeration tester", "error", err)
+		return 0
+	}
+	return tester.Test(a.urls, deadline)
+}
+
+// testCache probes the crawled URLs for cache poisoning and deception. It
+// returns the number of paths tested.
+func (a *FullAuto) testCache(deadline time.Time) int {
+	tester, err := NewCacheTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create cache tester", "error", err)
+		return 0
+	}
+	return tester.Test(a.urls, deadline)
+}
+
+// testFrames loads the crawled pages in a cross-origin iframe. It returns
+// the number of pages checked.
+func (a *FullAuto) testFrames(deadline time.Time) int {
+	tester, err := NewFrameTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create clickjacking tester", "error", err)
+		return 0
+	}
+	return tester.Test(a.urls, deadline)
+}
+
+// findBackups looks for backup copies of the crawled pages and assets and
+// archives of their directories. It returns the number of paths tested.
+func (a *FullAuto) findBackups(deadline time.Time) int {
+	tester, err := NewBackupTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create backup tester", "error", err)
+		return 0
+	}
+	return tester.Test(append(append([]string(nil), a.urls...), a.assets...), deadline)
+}
+
+// findVCS looks for version control metadata in the directories of the
+// crawled pages and assets. It returns the number of directories tested.
+func (a *FullAuto) findVCS(deadline time.Time) int {
+	tester, err := NewVCSTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create version control tester", "error", err)
+		return 0
+	}
+	return tester.Test(append(append([]string(nil), a.urls...), a.assets...), deadline)
+}
+
+// findAdminPanels looks for known admin panels and debug endpoints at the
+// host root and the application directories of the crawled URLs. It
+// returns the number of roots tested.
+func (a *FullAuto) findAdminPanels(deadline time.Time) int {
+	tester, err := NewAdminTester(a.config)
+	if err != nil {
+		a.logger.Error("failed to create admin panel tester", "error", err)
+		return 0
+	}
+	return tester.Test(append([]string{a.config.TargetURL}, a.urls...), deadline)
+}
+
+// probeInjection sends the SQL injection payloads and the reflected XSS,
+// command, NoSQL, LDAP, XPath and expression language injection, parameter
+// pollution and Unicode normalization probes to every query parameter of the
+// parameterized URLs found. It returns the number of URLs probed.
+func (a *FullAuto) probeInjection(deadline time.Time) int {
+	prober, err := NewInjectionProber(a.config)
+	if err != nil {
+		a.logger.Error("failed to create injection prober", "error", err)
+		return 0
+	}
+	prober.SetXSS(true)
+	prober.SetCommandInjection(true)
+	prober.SetNoSQLInjection(true)
+	prober.SetLDAPInjection(true)
+	prober.SetXPathInjection(true)
+	prober.SetELInjection(true)
+	prober.SetParameterPollution(true)
+	prober.SetNormalization(true)
+
+	probed := 0
+	for _, target := range a.targets {
+		if target.Kind != TargetParams {
+			continue
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		if err := prober.Probe(target.URL, deadline); err != nil {
+			a.logger.Debug("injection probes failed", "url", target.URL, "error", err)
+		}
+		probed++
+	}
+	return probed
+}
+
+// writeFullAutoReport saves the combined report as indented JSON
+func writeFullAutoReport(path string, report *FullAutoReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
@@ -2,16 +2,17 @@ package fuzzer
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/http/cookiejar"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // Config holds the fuzzer configuration
@@ -24,29 +25,136 @@ type Config struct {
 	WordlistPath string
 	OutputDir    string
 	Verbose      bool
-	MaxWorkers   int // Maximum number of concurrent workers
-	MaxPages     int // Maximum number of pages to crawl
+	MaxWorkers   int       // Maximum number of concurrent workers
+	MaxPages     int       // Maximum number of pages to crawl
+	Deadline     time.Time // No new requests are started after this time (zero = no limit)
+
+	// Crawl settings
+	CrawlWildcardParams bool          // Whether crawled URLs differing only in query values count as one page
+	CrawlRespectRobots  bool          // Whether the crawler leaves out links robots meta tags and rel=nofollow ask it not to follow
+	CrawlIdleTimeout    time.Duration // Stop crawling once no page has been visited for this long (0 = never)
+	CrawlFormTimeout    time.Duration // Stop crawling once no new form has been found for this long (0 = never)
+	CrawlFuzzForms      bool          // Whether a crawler not limited to discovery submits fuzzed data to each form as it finds it
+
+	// Time-boxed runs
+	Duration           time.Duration // Run until this much time has passed; NumRequests <= 0 then means no request limit
+	CheckpointInterval time.Duration // How often a time-boxed run reports progress and checkpoints (0 = 1 minute)
 
 	// Coverage settings
-	UseCoverage        bool // Whether to use coverage-guided fuzzing
-	UseGrammarCoverage bool // Whether to use grammar-coverage-guided fuzzing
-	UseSystematic      bool // Whether to use systematic coverage-guided fuzzing
-	MaxCorpus          int  // Maximum size of interesting inputs corpus (0 = unlimited)
+	UseCoverage        bool  // Whether to use coverage-guided fuzzing
+	UseGrammarCoverage bool  // Whether to use grammar-coverage-guided fuzzing
+	UseSystematic      bool  // Whether to use systematic coverage-guided fuzzing
+	MaxCorpus          int   // Maximum size of interesting inputs corpus (0 = unlimited)
+	MaxFingerprints    int   // Maximum response fingerprints kept for similarity dedup (0 = 10000)
+	MaxBodySize        int64 // Maximum response body bytes held in memory (0 = 10 MiB)
+
+	// Budget split of the coverage-guided fuzzers between exploring, with
+	// their own inputs, and exploiting, sending payloads to the parameters
+	// exploring found
+	ExploitRatio  float64 // Share of requests exploiting (0 = explore only)
+	AdaptiveSplit bool    // Whether the share moves toward the side yielding more findings and coverage per request
 
 	// Grammar settings
-	MaxDepth          int  // Maximum depth for grammar derivation trees
-	DuplicateContexts bool // Whether to duplicate grammar rules for context coverage
+	MaxDepth          int             // Maximum depth for grammar derivation trees
+	DuplicateContexts bool            // Whether to duplicate grammar rules for context coverage
+	GrammarFile       string          // BNF/EBNF grammar file replacing the built-in grammars
+	Learner           *GrammarLearner // Learns the format of fields from observed valid values
+
+	// Wordlist mangling, hashcat-style rules applied to every word of -w and
+	// the position wordlists as it is sent (nil = words as they are)
+	WordlistRules []string
+
+	// Payload position settings of the basic fuzzer
+	PayloadPosition string // Where payloads go: path, query, fragment, marker, params, body or header (empty = marker when the target URL has FUZZ, else path)
+	PayloadParam    string // Query or body parameter, or header, payloads go in (empty = the target's first query parameter, else "q"; User-Agent for headers)
+
+	// Template settings
+	RequestTemplate   string   // Raw HTTP request file with FUZZ markers
+	PayloadSource     string   // Where template payloads come from: wordlist or grammar
+	AttackMode        string   // How multiple markers are combined: batteringram, pitchfork or clusterbomb
+	PositionWordlists []string // Wordlists for FUZZ, FUZZ2, ... in pitchfork/clusterbomb modes
+
+	// Sticky parameters, fetched fresh from a page before every submission
+	StickyParams []string // Names refreshed besides the detected anti-CSRF tokens, view state and nonces
+	StickySource string   // Page request template submissions take them from (default the target URL)
+
+	// Protocol settings
+	HTTPProtocol        string            // auto, http1.0, http1.1, h2 or h2c
+	MaxIdleConnsPerHost int               // Idle connections kept per host (0 = Concurrency)
+	DisableKeepAlives   bool              // Whether to open a new connection per request
+	DisableCompression  bool              // Whether to stop requesting gzip-compressed responses
+	DNSCacheTTL         time.Duration     // How long resolved addresses are reused (0 = no caching)
+	RateLimit           *RateLimiter      // Paces the requests sent to the target (nil = as fast as the workers go)
+	Politeness          *Politeness       // Spaces and caps the requests in flight to each host (nil = no per-host limits)
+	Retry               *RetryPolicy      // Retries requests failing transiently, e.g. on a reset connection (nil = no retries)
+	Breaker             *CircuitBreaker   // Pauses requests while the target is unstable (nil = never pauses)
+	Resolve             map[string]string // Addresses host names are dialled at instead of looking them up, e.g. a staging server
+
+	// TLS settings
+	ClientCert         string            // PEM client certificate presented to servers requiring mutual TLS
+	ClientKey          string            // PEM private key of ClientCert
+	CACert             string            // PEM bundle of CAs trusted on top of the system roots, e.g. a private PKI
+	TLSMinVersion      uint16            // Lowest TLS version negotiated, e.g. tls.VersionTLS12 (0 = Go's default)
+	InsecureSkipVerify bool              // Whether to accept any server certificate
+	ServerNames        map[string]string // TLS server names (SNI) sent to hosts instead of their own, e.g. the virtual host served at an IP-literal target
+
+	// Request settings
+	Headers map[string]string // Extra headers sent with every request, e.g. API keys or tenant IDs
+	Cookies []*http.Cookie    // Cookies sent with every request, e.g. a logged-in session
+	OAuth2  *TokenSource      // Bearer tokens attached to every request, refreshed before expiry
+	Signers map[string]Signer // Sign requests by host, last thing before they are sent; "" signs the target's
+
+	Impersonation *Impersonation // Browser User-Agent and navigation headers for requests not setting their own (nil = Go's)
 
 	// Attack settings
-	SQLInjection bool // Whether to perform SQL injection testing
+	SQLInjection     bool        // Whether to perform SQL injection testing
+	CommandInjection bool        // Whether to probe query parameters for OS command injection with echo and sleep commands
+	NoSQLInjection   bool        // Whether to inject MongoDB operators and $where JavaScript into query parameters and JSON bodies
+	LDAPInjection    bool        // Whether to probe query parameters for LDAP filter injection
+	XPathInjection   bool        // Whether to probe query parameters for XPath injection
+	ELInjection      bool        // Whether to probe query parameters for expression language and template injection
+	PollutionProbes  bool        // Whether to send duplicated query parameters and report which value the server honors
+	Normalization    bool        // Whether to send Unicode normalization variants of query parameter values and the last path segment
+	ReDoS            bool        // Whether to time catastrophic-backtracking inputs against pattern-validated form fields
+	BoundaryValues   bool        // Whether to send values just outside the bounds and lengths of form fields before fuzzing them; API parameters always get them
+	PreserveDefaults bool        // Whether to fuzz one form field at a time, the others keeping the values the page fills in
+	LoginLockout     bool        // Whether to send a series of failed logins to login forms and report when none is throttled
+	AllowBruteForce  bool        // Whether probes that send repeated failed logins or account submissions, like LoginLockout and UserEnumeration, may run
+	LoginUser        string      // Account LoginLockout fails logins for (empty = a made-up account)
+	LoginPassword    string      // Password of LoginUser, checked before and after the failed logins (empty = not checked)
+	UserEnumeration  bool        // Whether to diff the answers of password reset and registration forms to existing and made-up accounts
+	KnownAccount     string      // Existing account UserEnumeration submits (empty = LoginUser, else common names like admin)
+	SmugglingProbes  bool        // Whether to probe for CL.TE/TE.CL request smuggling
+	WAFEvasion       bool        // Whether to resend payloads the WAF blocks with varied header casing, order, spacing and chunking
+	EnumerateIDs     bool        // Whether to try neighbouring values of numeric and UUID identifiers in the target URL
+	CacheProbes      bool        // Whether to probe the target for web cache poisoning and deception
+	Clickjacking     bool        // Whether to check that the target refuses to be framed by other sites
+	BackupFiles      bool        // Whether to look for backup copies of the target's file and archives of its directories
+	VCSMetadata      bool        // Whether to look for Git, Subversion and Mercurial metadata served from the target's directories
+	VCSListing       bool        // Whether findings of exposed metadata list the working copy files it names
+	AdminPanels      bool        // Whether to look for known admin panels and debug endpoints on the target's host
+	Identities       []*Identity // Other users whose access to the crawled URLs is compared with the configured credentials
+	CallbackURL      string      // Out-of-band interaction server that blind probes make the target contact
+	Stack            *TechStack  // Fingerprinted technologies of the target, which pick the payloads sent (nil = all payloads)
 
 	// API settings
-	APIFuzzing bool // Whether to enable API endpoint detection and fuzzing
-	APISchema  bool // Whether to enable API schema inference
-	APIFull    bool // Whether to enable full API testing suite
+	APIFuzzing           bool   // Whether to enable API endpoint detection and fuzzing
+	APISchema            bool   // Whether to enable API schema inference
+	MassAssignment       bool   // Whether to add privileged fields such as is_admin or role to valid API request bodies
+	ContentTypeConfusion bool   // Whether to resend valid API request bodies as XML, form and multipart data and under mismatched Content-Types
+	XXE                  bool   // Whether to send external entity payloads to endpoints that take XML
+	PaginationAbuse      bool   // Whether to send huge, negative and SQL-breaking values to API pagination and sorting parameters
+	RateLimitMapping     bool   // Whether to send each API endpoint requests in a row until it answers 429, then try bypassing the limit
+	ResourceExhaustion   bool   // Whether to send nested, oversized, compressed and many-part API bodies and time them
+	AllowDoS             bool   // Whether probes that may degrade or take down the target, like ResourceExhaustion and RateLimitMapping, may run
+	APIFull              bool   // Whether to enable full API testing suite
+	APISpec              string // OpenAPI/Swagger document listing the endpoints to fuzz
+	APIProbe             bool   // Whether crawls first request common API roots and spec documents, e.g. /api/v1 and /openapi.json
 
 	// Testing modes
-	FullAuto bool // Whether to enable all testing capabilities
+	FullAuto     bool                     // Whether to run every stage: crawl, API, forms, parameters, injection probes
+	Crawl        bool                     // Whether to crawl the target and fuzz every form, API and parameter found
+	StageBudgets map[string]time.Duration // Time allowed per full-auto stage, overriding the defaults; the crawl stage's also bounds crawls outside full-auto
 
 	// Mutation settings
 	UseMutation      bool     // Whether to use mutation-based fuzzing
@@ -54,7 +162,37 @@ type Config struct {
 	MaxMutations     int      // Maximum mutations per input
 	SeedInputs       []string // Initial seed inputs for mutation
 	MutationRate     float64  // Probability of mutating vs generating new (0.0-1.0)
+	PowerSchedule    string   // How seeds share mutations: exploit, explore, fast or decay (empty = exploit)
+	SpliceRate       float64  // Probability a mutated input is first spliced with another corpus entry (0 = never)
 	PreserveSessions bool     // Whether to maintain session cookies across requests
+	SessionMode      string   // How workers keep sessions: SessionShared (default) or SessionPerWorker
+	LoginRequest     string   // Raw HTTP request file sent to log each new session in
+
+	// Randomness
+	Seed int64 // Seed for all random choices (0 = pick one from the clock); replays a run exactly only with Concurrency 1
+
+	// DryRun, when set, records planned requests instead of sending them
+	DryRun *DryRun
+
+	// Differ, when set, resends every fuzzed request to a second deployment
+	// and reports where it answers differently
+	Differ *Differ
+
+	// Traffic, when set, records the exchanges with the target for export
+	// to Burp or ZAP in ExportFormats (ExportBurp, ExportHAR)
+	Traffic       *Traffic
+	ExportFormats []string
+
+	// Results
+	Findings     *FindingStore  // Shared store that all detectors report into
+	ResultFilter *ResultFilter  // Match/filter rules deciding which results are reported
+	Leaks        *LeakScanner   // Secrets and personal data looked for in response bodies (nil = no scanning)
+	Baselines    *BaselineCache // Unfuzzed responses file inclusion signatures are checked against (nil = no file inclusion checks)
+
+	// Plugins
+	Detectors []Detector // Custom checks run on every fuzzed exchange (default the registered ones)
+	Mutators  []Mutator  // Custom mutation strategies (default the registered ones)
+	Hooks     []Hooks    // Called on every request, fuzzed response and new finding (default the registered ones)
 }
 
 // DefaultConfig returns a Config with sensible defaults
@@ -70,6 +208,8 @@ func DefaultConfig(targetURL string) *Config {
 		UseGrammarCoverage: true,
 		MaxCorpus:          2000, // Increased corpus size
 		MaxDepth:           10,
+		HTTPProtocol:       ProtocolAuto,
+		DNSCacheTTL:        time.Minute,
 		SQLInjection:       false,
 		APIFuzzing:         false,
 		APISchema:          false,
@@ -78,32 +218,51 @@ func DefaultConfig(targetURL string) *Config {
 		MutationRate:       0.7,
 		MaxMutations:       5,
 		PreserveSessions:   true,
+		SessionMode:        SessionShared,
+		Learner:            NewGrammarLearner(),
+		Findings:           newHookedFindingStore(RegisteredHooks()),
+		Leaks:              NewLeakScanner(),
+		Baselines:          NewBaselineCache(),
+		Detectors:          RegisteredDetectors(),
+		Mutators:           RegisteredMutators(),
+		Hooks:              RegisteredHooks(),
+		Retry:              NewRetryPolicy(2, 500*time.Millisecond),
+		Breaker:            NewCircuitBreaker(targetURL),
 	}
 }
 
 // Fuzzer represents the web application fuzzer
 type Fuzzer struct {
-	config   *Config
-	client   *http.Client
-	payloads []string
-	results  chan *Result
-	wg       sync.WaitGroup
-	logger   *log.Logger
+	config    *Config
+	sessions  *sessions         // Hands each worker its client
+	placement *payloadPlacement // Builds the request each payload is sent in
+	payloads  []string
+	words     *mangledWordlist // Mangled wordlist words, sent after payloads; nil without rules
+	results   chan *Result
+	wg        sync.WaitGroup
+	logger    *slog.Logger
 }
 
 // Result represents a fuzzing test result
 type Result struct {
 	Payload    string
 	URL        string
+	Placement  string // Where the payload went when the URL does not show it, e.g. "header User-Agent"
 	StatusCode int
-	Response   string
+	Response   string // Response body, searched by regex rules
+	Size       int    // Body length in bytes
+	Words      int    // Whitespace-separated words in the body
+	Lines      int    // Lines in the body
+	Hash       string // SHA-256 of the full body
 	Error      error
 	Duration   time.Duration
 	Timestamp  time.Time
+
+	yielded bool // Whether the request reached new coverage or a new finding
 }
 
 // New creates a new Fuzzer instance
-func New(config *Config) (FuzzerInterface, error) {
+func New(config *Config) (Runner, error) {
 	if err := validateConfig(config); err != nil {
 		return nil, err
 	}
@@ -113,7 +272,51 @@ func New(config *Config) (FuzzerInterface, error) {
 		return nil, fmt.Errorf("failed to create output directory: %v", err)
 	}
 
+	if config.Findings == nil {
+		config.Findings = newHookedFindingStore(config.Hooks)
+	}
+
+	// A time budget ends the run at a deadline, unless an earlier one is set
+	if config.Duration > 0 {
+		deadline := time.Now().Add(config.Duration)
+		if config.Deadline.IsZero() || deadline.Before(config.Deadline) {
+			config.Deadline = deadline
+		}
+	}
+
+	// Report the seed so the run can be replayed with -seed, which repeats
+	// the request sequence only with a single worker
+	logging.For("fuzzer").Info("random seed", "seed", runSeed(config), "exact_replay", config.Concurrency <= 1)
+
 	// Choose fuzzer type based on configuration
+	if config.RequestTemplate != "" {
+		return NewTemplateFuzzer(config)
+	}
+
+	if config.FullAuto {
+		return NewFullAuto(config)
+	}
+
+	if config.Crawl {
+		return NewOrchestrator(config)
+	}
+
+	if config.APISpec != "" {
+		return NewAPISpecFuzzer(config)
+	}
+
+	if config.APIFuzzing {
+		return newTargetAPIFuzzer(config)
+	}
+
+	if config.UseMutation {
+		// Mutation starts from the target URL unless seeds are given
+		if len(config.SeedInputs) == 0 {
+			config.SeedInputs = []string{config.TargetURL}
+		}
+		return NewMutationCoverageFuzzer(config)
+	}
+
 	if config.UseCoverage {
 		if config.UseSystematic {
 			return NewSystematicCoverageFuzzer(config)
@@ -123,43 +326,27 @@ func New(config *Config) (FuzzerInterface, error) {
 		return NewCoverageFuzzer(config)
 	}
 
-	// Initialize logger
-	logFile, err := os.Create(filepath.Join(config.OutputDir, "fuzzer.log"))
+	// Initialize HTTP client with timeout and optional session handling
+	client, err := newHTTPClient(config, config.PreserveSessions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log file: %v", err)
+		return nil, err
 	}
-
-	logger := log.New(logFile, "", log.LstdFlags)
-
-	// Initialize HTTP client with timeout and optional session handling
-	client := &http.Client{
-		Timeout: config.Timeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if !config.PreserveSessions {
-				return http.ErrUseLastResponse
-			}
-			if len(via) >= 10 {
-				return errors.New("stopped after 10 redirects")
-			}
-			return nil
-		},
-		Jar: nil, // Will be set to CookieJar if PreserveSessions is true
+	sessions, err := newSessions(config, client)
+	if err != nil {
+		return nil, err
 	}
-
-	if config.PreserveSessions {
-		jar, err := cookiejar.New(nil)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create cookie jar: %v", err)
-		}
-		client.Jar = jar
+	placement, err := newPayloadPlacement(config)
+	if err != nil {
+		return nil, err
 	}
 
 	f := &Fuzzer{
-		config:   config,
-		client:   client,
-		results:  make(chan *Result, config.Concurrency),
-		logger:   logger,
-		payloads: defaultPayloads(),
+		config:    config,
+		sessions:  sessions,
+		placement: placement,
+		results:   make(chan *Result, config.Concurrency),
+		logger:    logging.For("fuzzer"),
+		payloads:  defaultPayloads(),
 	}
 
 	// Load custom wordlist if provided
@@ -168,8 +355,16 @@ func New(config *Config) (FuzzerInterface, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to load wordlist: %v", err)
 		}
-		f.payloads = append(f.payloads, payloads...)
+		// Mangled words are for discovery, so the stack does not pick them
+		if len(config.WordlistRules) > 0 {
+			if f.words, err = newMangledWordlist(payloads, config.WordlistRules); err != nil {
+				return nil, err
+			}
+		} else {
+			f.payloads = append(f.payloads, payloads...)
+		}
 	}
+	f.payloads = config.Stack.SelectPayloads(f.payloads)
 
 	return f, nil
 }
@@ -180,63 +375,96 @@ func (f *Fuzzer) Run() error {
 	defer cancel()
 
 	// Start result processor
-	go f.processResults()
-
-	// Start worker pool
+	done := make(chan struct{})
+	go func() {
+		f.processResults()
+		close(done)
+	}()
+
+	// Start worker pool, all pulling from one queue
+	jobs := make(chan payloadJob)
 	for i := 0; i < f.config.Concurrency; i++ {
 		f.wg.Add(1)
-		go f.worker(ctx)
+		go f.worker(ctx, jobs)
+	}
+
+	// Feed the whole request budget, cycling through the payloads in order,
+	// then the mangled words, each sent in every slot before the next
+	budget := newRequestBudget(f.config.NumRequests, f.config.Deadline)
+	checkpoints := startCheckpoints(f.config, f.logger, budget, nil, nil)
+	defer checkpoints.Stop()
+	slots := f.placement.slots()
+	total := len(f.payloads) + f.words.Len()
+	for seq, ok := budget.take(); ok; seq, ok = budget.take() {
+		jobs <- payloadJob{payload: f.payload((seq / slots) % total), slot: seq % slots}
 	}
+	close(jobs)
 
-	// Wait for all workers to complete
+	// Wait for all workers and the result processor to complete
 	f.wg.Wait()
 	close(f.results)
+	<-done
 
 	return nil
 }
 
-// worker performs the actual fuzzing
-func (f *Fuzzer) worker(ctx context.Context) {
+// payload returns payload i of the payloads followed by the mangled words
+func (f *Fuzzer) payload(i int) string {
+	if i < len(f.payloads) {
+		return f.payloads[i]
+	}
+	return f.words.At(i - len(f.payloads))
+}
+
+// payloadJob is a payload to send and the slot of the placement it goes in
+type payloadJob struct {
+	payload string
+	slot    int
+}
+
+// worker tests payloads from the job queue until it is drained
+func (f *Fuzzer) worker(ctx context.Context, jobs <-chan payloadJob) {
 	defer f.wg.Done()
 
-	for i := 0; i < f.config.NumRequests/f.config.Concurrency; i++ {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			payload := f.payloads[i%len(f.payloads)]
-			result := f.testPayload(payload)
-			f.results <- result
-
-			if f.config.Verbose {
-				log.Printf("[%d] Testing: %s\n", result.StatusCode, result.URL)
-			}
+	client := f.sessions.client()
+	for job := range jobs {
+		if ctx.Err() != nil {
+			continue // Drain the queue without sending
 		}
+
+		result := f.testPayload(client, job.payload, job.slot)
+		f.results <- result
+
+		f.logger.Debug("tested payload", "status", result.StatusCode, "url", result.URL)
 	}
 }
 
-// testPayload sends a request with the given payload
-func (f *Fuzzer) testPayload(payload string) *Result {
+// testPayload sends a request with the given payload in the given slot of
+// the placement
+func (f *Fuzzer) testPayload(client *http.Client, payload string, slot int) *Result {
 	start := time.Now()
-	url := f.buildURL(payload)
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, placement, err := f.placement.request(payload, slot)
 	if err != nil {
 		return &Result{
 			Payload:   payload,
-			URL:       url,
+			URL:       f.placement.target.String(),
+			Placement: placement,
 			Error:     err,
 			Timestamp: start,
 		}
 	}
+	url := req.URL.String()
 
-	resp, err := f.client.Do(req)
+	resp, err := client.Do(req)
 	duration := time.Since(start)
 
 	if err != nil {
+		inspectFailure(f.config, req, nil, err, payload)
 		return &Result{
 			Payload:   payload,
 			URL:       url,
+			Placement: placement,
 			Error:     err,
 			Duration:  duration,
 			Timestamp: start,
@@ -244,53 +472,73 @@ func (f *Fuzzer) testPayload(payload string) *Result {
 	}
 	defer resp.Body.Close()
 
-	return &Result{
+	body, _ := readLimited(resp.Body, maxBodySize(f.config))
+
+	inspectResponse(f.config, req, nil, resp, body.data, payload)
+
+	result := &Result{
 		Payload:    payload,
 		URL:        url,
+		Placement:  placement,
 		StatusCode: resp.StatusCode,
+		Response:   string(body.data),
 		Duration:   duration,
 		Timestamp:  start,
 	}
+	result.measureBody(body)
+	return result
 }
 
 // processResults handles the fuzzing results
 func (f *Fuzzer) processResults() {
 	resultsFile, err := os.Create(filepath.Join(f.config.OutputDir, "results.txt"))
 	if err != nil {
-		log.Printf("Error creating results file: %v", err)
+		f.logger.Error("failed to create results file", "error", err)
 		return
 	}
 	defer resultsFile.Close()
 
 	for result := range f.results {
+		where := result.URL
+		if result.Placement != "" {
+			where += fmt.Sprintf(" (%s: %q)", result.Placement, result.Payload)
+		}
 		if result.Error != nil {
-			fmt.Fprintf(resultsFile, "[ERROR] %s: %v\n", result.URL, result.Error)
+			fmt.Fprintf(resultsFile, "[ERROR] %s: %v\n", where, result.Error)
 			continue
 		}
 
-		// Log interesting responses (non-200 status codes)
-		if result.StatusCode != http.StatusOK {
-			fmt.Fprintf(resultsFile, "[%d] %s (%.2fs)\n",
-				result.StatusCode, result.URL, result.Duration.Seconds())
+		// Log interesting responses: those passing the match/filter rules
+		// when configured, otherwise anything but a 200
+		interesting := result.StatusCode != http.StatusOK
+		if f.config.ResultFilter.Active() {
+			interesting = f.config.ResultFilter.Keep(result)
+		}
+		if interesting {
+			fmt.Fprintf(resultsFile, "[%d] %s size=%d words=%d (%.2fs)\n",
+				result.StatusCode, where, result.Size, result.Words, result.Duration.Seconds())
 		}
 	}
 }
 
-// buildURL constructs the URL with the payload
-func (f *Fuzzer) buildURL(payload string) string {
-	return fmt.Sprintf("%s/%s", f.config.TargetURL, payload)
-}
-
 // validateConfig checks if the configuration is valid
 func validateConfig(config *Config) error {
-	if config.TargetURL == "" {
+	if config.TargetURL == "" && config.APISpec == "" {
 		return fmt.Errorf("target URL is required")
 	}
+	if target, err := url.Parse(config.TargetURL); err == nil {
+		if err := checkHost(target); err != nil {
+			return err
+		}
+	}
 	if config.Concurrency < 1 || config.Concurrency > 100 {
 		return fmt.Errorf("concurrency must be between 1 and 100")
 	}
-	if config.NumRequests < 1 {
-		return fmt.Errorf("number of requests must be greater than 0")
+	if config.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	if config.NumRequests < 1 && config.Duration == 0 {
+		return fmt.Errorf("number of requests must be greater than 0 unless a duration is set")
 	}
 	if config.Timeout < 1*time.Second {
 		return fmt.Errorf("timeout must be at least 1 second")
@@ -298,6 +546,37 @@ func validateConfig(config *Config) error {
 	if config.MaxDepth < 1 {
 		return fmt.Errorf("max depth must be greater than 0")
 	}
+	if config.ExploitRatio < 0 || config.ExploitRatio > 1 {
+		return fmt.Errorf("exploit ratio must be between 0 and 1")
+	}
+	switch config.HTTPProtocol {
+	case "", ProtocolAuto, ProtocolHTTP10, ProtocolHTTP11, ProtocolHTTP2, ProtocolH2C:
+	default:
+		return fmt.Errorf("unsupported HTTP protocol: %s", config.HTTPProtocol)
+	}
+	switch config.SessionMode {
+	case "", SessionShared, SessionPerWorker:
+	default:
+		return fmt.Errorf("unsupported session mode: %s", config.SessionMode)
+	}
+	for _, rule := range config.WordlistRules {
+		if _, err := parseMangleRule(rule); err != nil {
+			return err
+		}
+	}
+	if config.SpliceRate < 0 || config.SpliceRate > 1 {
+		return fmt.Errorf("splice rate must be between 0 and 1")
+	}
+	switch config.PowerSchedule {
+	case "", ScheduleExploit, ScheduleExplore, ScheduleFast, ScheduleDecay:
+	default:
+		return fmt.Errorf("unsupported power schedule: %s", config.PowerSchedule)
+	}
+	switch config.PayloadPosition {
+	case "", PositionPath, PositionQuery, PositionFragment, PositionMarker, PositionParams, PositionBody, PositionHeader:
+	default:
+		return fmt.Errorf("unsupported payload position: %s", config.PayloadPosition)
+	}
 	return nil
 }
 
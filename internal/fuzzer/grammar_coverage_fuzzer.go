@@ -1,10 +1,11 @@
 package fuzzer
 
 import (
-	"fmt"
 	"math/rand"
 	"strings"
-	"time"
+	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // GrammarCoverageFuzzer implements coverage-guided fuzzing
@@ -12,6 +13,8 @@ type GrammarCoverageFuzzer struct {
 	*CoverageFuzzer
 	grammar         Grammar
 	grammarCoverage *GrammarCoverage
+	rng             *rand.Rand // Expansion choices, seeded from the run seed
+	genMu           sync.Mutex // Serializes derivations, which share rng and coverage state
 }
 
 // NewGrammarCoverageFuzzer creates a new grammar-coverage-guided fuzzer
@@ -27,44 +30,44 @@ func NewGrammarCoverageFuzzer(config *Config) (*GrammarCoverageFuzzer, error) {
 		grammar[symbol] = make([]string, len(expansions))
 		copy(grammar[symbol], expansions)
 	}
+	baseFuzzer.logger = logging.For("grammar")
+
+	// Clone shared rules per occurrence so each context is covered on its own
+	if config.DuplicateContexts {
+		before := len(grammar)
+		grammar = duplicateContexts(grammar, "<start>", duplicateContextDepth)
+		baseFuzzer.logger.Info("duplicated grammar contexts", "rules_before", before, "rules_after", len(grammar))
+	}
 
 	return &GrammarCoverageFuzzer{
 		CoverageFuzzer:  baseFuzzer,
 		grammar:         grammar,
 		grammarCoverage: NewGrammarCoverage(grammar),
+		rng:             newRand(runSeed(config), streamGrammar),
 	}, nil
 }
 
-// Run starts the fuzzing process with grammar coverage guidance
+// Run starts the fuzzing process with grammar coverage guidance, deriving a
+// fresh input for every request in the budget
 func (f *GrammarCoverageFuzzer) Run() error {
-	// Create derivation tree
-	tree := f.generateDerivationTree("<start>", 0)
-
-	// Track coverage
-	f.grammarCoverage.TrackDerivationTree(tree)
-
-	// Convert tree to string and test it
-	input := f.treeToString(tree)
-	result := f.testInput(input)
-
-	// Process result
-	if result.Error != nil {
-		if f.config.Verbose {
-			fmt.Printf("[ERROR] %s: %v\n", result.URL, result.Error)
-		}
-		return result.Error
-	}
+	return f.runPool(f.client, func(*rand.Rand) string { return f.nextInput() }, f.testInput)
+}
 
-	if f.config.Verbose {
-		fmt.Printf("[%d] %s\n", result.StatusCode, result.URL)
-	}
+// nextInput derives an input steered towards uncovered expansions. Each
+// derivation depends on the coverage left by the previous ones, so they are
+// made one at a time while requests are sent concurrently.
+func (f *GrammarCoverageFuzzer) nextInput() string {
+	f.genMu.Lock()
+	defer f.genMu.Unlock()
 
-	return nil
+	tree := f.generateDerivationTree("<start>", 0)
+	f.grammarCoverage.TrackDerivationTree(tree)
+	return f.treeToString(tree)
 }
 
 // generateDerivationTree creates a derivation tree for a symbol
 func (f *GrammarCoverageFuzzer) generateDerivationTree(symbol string, depth int) *DerivationTree {
-	if depth > f.config.MaxDepth {
+	if depth > 2*f.config.MaxDepth {
 		return &DerivationTree{
 			Symbol: symbol,
 			Value:  "max_depth_reached",
@@ -81,15 +84,21 @@ func (f *GrammarCoverageFuzzer) generateDerivationTree(symbol string, depth int)
 		return tree
 	}
 
-	// Choose expansion based on coverage
-	expansion := f.chooseExpansion(symbol, expansions)
+	// Choose expansion based on coverage, heading for the shortest expansion
+	// once past the depth limit so recursive rules terminate
+	var expansion string
+	if depth >= f.config.MaxDepth {
+		expansion = shortestExpansion(expansions)
+	} else {
+		expansion = f.chooseExpansion(symbol, expansions)
+	}
 	tree.Expansion = expansion
 
 	// Track expansion
 	f.grammarCoverage.TrackExpansion(symbol, expansion)
 
 	// Generate children
-	parts := strings.Fields(expansion)
+	parts := splitExpansion(f.grammar, expansion)
 	for _, part := range parts {
 		if isNonterminal(part) {
 			child := f.generateDerivationTree(part, depth+1)
@@ -120,7 +129,7 @@ func (f *GrammarCoverageFuzzer) chooseExpansion(symbol string, expansions []stri
 
 	// Choose based on weighted probability
 	if totalPriority > 0 {
-		r := rand.Float64() * totalPriority
+		r := f.rng.Float64() * totalPriority
 		sum := 0.0
 		for i, priority := range priorities {
 			sum += priority
@@ -131,7 +140,7 @@ func (f *GrammarCoverageFuzzer) chooseExpansion(symbol string, expansions []stri
 	}
 
 	// Fallback to random selection
-	return expansions[rand.Intn(len(expansions))]
+	return expansions[f.rng.Intn(len(expansions))]
 }
 
 // treeToString converts a derivation tree to its string representation
@@ -156,7 +165,3 @@ func (f *GrammarCoverageFuzzer) GetCoverageStats() map[string]interface{} {
 func (f *GrammarCoverageFuzzer) Reset() {
 	f.grammarCoverage.Reset()
 }
-
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
@@ -0,0 +1,331 @@
+package fuzzer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadGrammarFile reads a grammar in BNF/EBNF notation from a file
+func LoadGrammarFile(path string) (Grammar, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grammar file: %v", err)
+	}
+	grammar, err := ParseGrammar(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return grammar, nil
+}
+
+// ParseGrammar parses a grammar written in BNF with EBNF extensions:
+//
+//	# JSON object with one or more string members
+//	<start>   ::= "{" <member> ( "," <member> )* "}"
+//	<member>  ::= <string> ":" <string>
+//	<string>  ::= '"' <char>+ '"'
+//	<char>    ::= "a" | "b" | "c"
+//
+// Nonterminals are written <name> and terminals are quoted with " or '.
+// Elements are concatenated without separators, so whitespace must be quoted.
+// [x] and x? are optional, {x} and x* repeat zero or more times, x+ repeats at
+// least once and ( ) groups alternatives. Rules are defined with ::= or = and
+// may span lines; # starts a comment. The grammar must define <start>.
+func ParseGrammar(src string) (Grammar, error) {
+	tokens, err := tokenizeGrammar(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &grammarParser{tokens: tokens, grammar: make(Grammar), refs: make(map[string]int)}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.grammar["<start>"]; !ok {
+		return nil, fmt.Errorf("grammar does not define <start>")
+	}
+	for _, ref := range sortedKeys(p.refs) {
+		if _, ok := p.grammar[ref]; !ok {
+			return nil, fmt.Errorf("line %d: undefined nonterminal %s", p.refs[ref], ref)
+		}
+	}
+	return p.grammar, nil
+}
+
+// grammarToken is a lexical element of a grammar file
+type grammarToken struct {
+	kind  byte   // 'n' nonterminal, 's' string, 'd' definition, or the operator itself
+	value string // Symbol name or unquoted terminal
+	line  int
+}
+
+// tokenizeGrammar splits grammar source into tokens
+func tokenizeGrammar(src string) ([]grammarToken, error) {
+	var tokens []grammarToken
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+
+		case c == '<':
+			end := strings.IndexByte(src[i:], '>')
+			if end == -1 || strings.ContainsAny(src[i:i+end], " \t\n") {
+				return nil, fmt.Errorf("line %d: unterminated nonterminal", line)
+			}
+			tokens = append(tokens, grammarToken{kind: 'n', value: src[i : i+end+1], line: line})
+			i += end + 1
+
+		case c == '"' || c == '\'':
+			value, n, err := unquoteTerminal(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			tokens = append(tokens, grammarToken{kind: 's', value: value, line: line})
+			i += n
+
+		case strings.HasPrefix(src[i:], "::="):
+			tokens = append(tokens, grammarToken{kind: 'd', line: line})
+			i += 3
+
+		case c == '=':
+			tokens = append(tokens, grammarToken{kind: 'd', line: line})
+			i++
+
+		case strings.IndexByte("|()[]{}*+?;", c) >= 0:
+			tokens = append(tokens, grammarToken{kind: c, line: line})
+			i++
+
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+		}
+	}
+	return tokens, nil
+}
+
+// unquoteTerminal reads a quoted terminal at the start of s, returning its
+// value and the number of bytes consumed
+func unquoteTerminal(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// grammarParser turns tokens into grammar rules, desugaring EBNF operators
+// into helper nonterminals
+type grammarParser struct {
+	tokens  []grammarToken
+	pos     int
+	grammar Grammar
+	refs    map[string]int // Referenced nonterminals and the line first seen on
+	rule    string         // Rule being parsed, used to name helper nonterminals
+	helpers int
+}
+
+// parse reads rules until the tokens run out
+func (p *grammarParser) parse() error {
+	for p.pos < len(p.tokens) {
+		if p.peek(';') {
+			p.pos++
+			continue
+		}
+
+		name := p.tokens[p.pos]
+		if name.kind != 'n' || p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1].kind != 'd' {
+			return fmt.Errorf("line %d: expected rule definition <name> ::=", name.line)
+		}
+		p.pos += 2
+		p.rule = name.value
+
+		alternatives, err := p.alternation()
+		if err != nil {
+			return err
+		}
+		if p.pos < len(p.tokens) && !p.peek(';') && !p.atRuleStart() {
+			return fmt.Errorf("line %d: unexpected %s", p.tokens[p.pos].line, describeToken(p.tokens[p.pos]))
+		}
+
+		// Repeated definitions of a rule add alternatives
+		p.grammar[name.value] = append(p.grammar[name.value], alternatives...)
+	}
+	return nil
+}
+
+// alternation parses sequences separated by |
+func (p *grammarParser) alternation() ([]string, error) {
+	var alternatives []string
+	for {
+		seq, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, seq)
+
+		if !p.peek('|') {
+			return alternatives, nil
+		}
+		p.pos++
+	}
+}
+
+// sequence parses elements up to the end of an alternative
+func (p *grammarParser) sequence() (string, error) {
+	var b strings.Builder
+	for p.pos < len(p.tokens) && !p.atRuleStart() {
+		tok := p.tokens[p.pos]
+		if tok.kind == '|' || tok.kind == ')' || tok.kind == ']' || tok.kind == '}' || tok.kind == ';' {
+			break
+		}
+
+		item, err := p.item()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(item)
+	}
+	return b.String(), nil
+}
+
+// item parses a primary element with an optional postfix operator
+func (p *grammarParser) item() (string, error) {
+	primary, err := p.primary()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case p.peek('?'):
+		p.pos++
+		return p.helper("opt", []string{"", primary}), nil
+	case p.peek('*'):
+		p.pos++
+		return p.repetition(primary), nil
+	case p.peek('+'):
+		p.pos++
+		return primary + p.repetition(primary), nil
+	}
+	return primary, nil
+}
+
+// primary parses a nonterminal, terminal or bracketed group
+func (p *grammarParser) primary() (string, error) {
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch tok.kind {
+	case 'n':
+		if _, seen := p.refs[tok.value]; !seen {
+			p.refs[tok.value] = tok.line
+		}
+		return tok.value, nil
+
+	case 's':
+		return tok.value, nil
+
+	case '(', '[', '{':
+		closing := map[byte]byte{'(': ')', '[': ']', '{': '}'}[tok.kind]
+		alternatives, err := p.alternation()
+		if err != nil {
+			return "", err
+		}
+		if !p.peek(closing) {
+			return "", fmt.Errorf("line %d: missing %q", tok.line, closing)
+		}
+		p.pos++
+
+		group := alternatives[0]
+		if len(alternatives) > 1 {
+			group = p.helper("group", alternatives)
+		}
+		switch tok.kind {
+		case '[':
+			return p.helper("opt", []string{"", group}), nil
+		case '{':
+			return p.repetition(group), nil
+		}
+		return group, nil
+	}
+
+	return "", fmt.Errorf("line %d: unexpected %s", tok.line, describeToken(tok))
+}
+
+// repetition returns a helper nonterminal matching zero or more of element
+func (p *grammarParser) repetition(element string) string {
+	name := p.helperName("rep")
+	p.grammar[name] = []string{"", element + name}
+	return name
+}
+
+// helper defines a nonterminal with the given alternatives and returns it
+func (p *grammarParser) helper(kind string, alternatives []string) string {
+	name := p.helperName(kind)
+	p.grammar[name] = alternatives
+	return name
+}
+
+// helperName returns a fresh nonterminal name derived from the current rule
+func (p *grammarParser) helperName(kind string) string {
+	p.helpers++
+	return fmt.Sprintf("<%s-%s-%d>", strings.Trim(p.rule, "<>"), kind, p.helpers)
+}
+
+// peek reports whether the next token is the given operator
+func (p *grammarParser) peek(kind byte) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind
+}
+
+// atRuleStart reports whether the next tokens begin a new rule
+func (p *grammarParser) atRuleStart() bool {
+	return p.pos+1 < len(p.tokens) && p.tokens[p.pos].kind == 'n' && p.tokens[p.pos+1].kind == 'd'
+}
+
+// describeToken renders a token for error messages
+func describeToken(tok grammarToken) string {
+	switch tok.kind {
+	case 'n':
+		return tok.value
+	case 's':
+		return fmt.Sprintf("%q", tok.value)
+	case 'd':
+		return "::="
+	}
+	return fmt.Sprintf("%q", tok.kind)
+}
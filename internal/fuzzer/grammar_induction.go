@@ -0,0 +1,440 @@
+package fuzzer
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxLearnedSamples bounds the distinct values remembered per field
+	maxLearnedSamples = 1000
+
+	// maxLearnedShapes bounds the token shapes kept per field, most common first
+	maxLearnedShapes = 8
+
+	// maxLearnedLengths bounds the most common run lengths kept per token,
+	// on top of the shortest and longest seen
+	maxLearnedLengths = 3
+)
+
+// learnedClasses are the character classes runs of letters and digits are
+// generalized to, most specific first
+var learnedClasses = []struct {
+	name  string
+	chars string
+}{
+	{"digit", "0123456789"},
+	{"lower", "abcdefghijklmnopqrstuvwxyz"},
+	{"upper", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	{"hex", "0123456789abcdef"},
+	{"HEX", "0123456789ABCDEF"},
+	{"alnum", "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+}
+
+// GrammarLearner induces grammars for fields of unknown format from valid
+// values seen in crawled pages, API responses or a samples file. Values are
+// split into runs of letters and digits and the punctuation between them;
+// runs become character classes with the lengths observed, punctuation and
+// runs that never vary stay literal, and a prefix or suffix shared by every
+// value is kept as is. The values themselves are kept too, by field and by
+// kind (IDs, slugs and tokens), as seeds for mutation. A nil learner knows
+// nothing. It is safe for concurrent use.
+type GrammarLearner struct {
+	mu       sync.Mutex
+	samples  map[string][]string
+	seen     map[string]map[string]bool
+	kinds    map[string][]string // Values of each kind, whatever field they were seen in
+	grammars map[string]Grammar  // Induced grammars, dropped when a field gets new samples
+}
+
+// NewGrammarLearner creates an empty learner
+func NewGrammarLearner() *GrammarLearner {
+	return &GrammarLearner{
+		samples:  make(map[string][]string),
+		seen:     make(map[string]map[string]bool),
+		kinds:    make(map[string][]string),
+		grammars: make(map[string]Grammar),
+	}
+}
+
+// Clone returns a learner knowing what l knows so far, such as the samples
+// loaded from a file, that learns apart from it from then on
+func (l *GrammarLearner) Clone() *GrammarLearner {
+	if l == nil {
+		return nil
+	}
+	clone := NewGrammarLearner()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for field, samples := range l.samples {
+		clone.samples[field] = append([]string(nil), samples...)
+	}
+	for field, values := range l.seen {
+		clone.seen[field] = make(map[string]bool, len(values))
+		for value := range values {
+			clone.seen[field][value] = true
+		}
+	}
+	for kind, values := range l.kinds {
+		clone.kinds[kind] = append([]string(nil), values...)
+	}
+	for field, grammar := range l.grammars {
+		clone.grammars[field] = grammar
+	}
+	return clone
+}
+
+// Observe records a valid value for a field
+func (l *GrammarLearner) Observe(field, value string) {
+	if l == nil || field == "" || value == "" {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen[field] == nil {
+		l.seen[field] = make(map[string]bool)
+	}
+	if l.seen[field][value] || len(l.samples[field]) >= maxLearnedSamples {
+		return
+	}
+	l.seen[field][value] = true
+	l.samples[field] = append(l.samples[field], value)
+	delete(l.grammars, field)
+	l.observeKind(value)
+}
+
+// ObserveValue records a valid value seen outside any field, such as an ID
+// in a path, by its kind only
+func (l *GrammarLearner) ObserveValue(value string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.observeKind(value)
+}
+
+// observeKind adds a value to the samples of its kind, if it has one
+func (l *GrammarLearner) observeKind(value string) {
+	kind := observedKind(value)
+	if kind == "" || len(l.kinds[kind]) >= maxLearnedSamples {
+		return
+	}
+	for _, sample := range l.kinds[kind] {
+		if sample == value {
+			return
+		}
+	}
+	l.kinds[kind] = append(l.kinds[kind], value)
+}
+
+// ObserveJSON records the string and number values of a decoded JSON
+// document under the key that holds them, at any depth
+func (l *GrammarLearner) ObserveJSON(data interface{}) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			switch val := val.(type) {
+			case string:
+				l.Observe(key, val)
+			case float64:
+				l.Observe(key, fmt.Sprint(val))
+			default:
+				l.ObserveJSON(val)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			l.ObserveJSON(item)
+		}
+	}
+}
+
+// LoadSamples reads field=value lines from a file. Blank lines and lines
+// starting with # are skipped.
+func (l *GrammarLearner) LoadSamples(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open samples file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		field, value, ok := strings.Cut(text, "=")
+		if !ok || field == "" {
+			return fmt.Errorf("%s: line %d: expected field=value", path, line)
+		}
+		l.Observe(strings.TrimSpace(field), value)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read samples file: %v", err)
+	}
+	return nil
+}
+
+// Knows reports whether any values have been observed for a field
+func (l *GrammarLearner) Knows(field string) bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.samples[field]) > 0
+}
+
+// Grammar returns the grammar induced for a field, rooted at LearnedSymbol(field),
+// or nil when nothing has been observed for it
+func (l *GrammarLearner) Grammar(field string) Grammar {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if grammar, ok := l.grammars[field]; ok {
+		return grammar
+	}
+	if len(l.samples[field]) == 0 {
+		return nil
+	}
+	grammar := induceGrammar(LearnedSymbol(field), l.samples[field])
+	l.grammars[field] = grammar
+	return grammar
+}
+
+// Generate derives a value for a field from its induced grammar
+func (l *GrammarLearner) Generate(rng *rand.Rand, field string) (string, bool) {
+	grammar := l.Grammar(field)
+	if grammar == nil {
+		return "", false
+	}
+	return expandGrammar(rng, grammar, LearnedSymbol(field), 0, 10), true
+}
+
+// LearnedSymbol returns the start symbol of the grammar induced for a field
+func LearnedSymbol(field string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '<' || r == '>' || r == ' ' || r == ':' {
+			return '_'
+		}
+		return r
+	}, field)
+	return "<learned-" + name + ">"
+}
+
+// learnedToken is a run of letters and digits (class set) or a single
+// punctuation character (class empty)
+type learnedToken struct {
+	class string
+	text  string
+}
+
+// tokenizeSample splits a value into letter/digit runs and punctuation
+func tokenizeSample(value string) []learnedToken {
+	var tokens []learnedToken
+	run := -1
+	for i, r := range value {
+		alnum := r < utf8.RuneSelf && (r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+		switch {
+		case alnum && run == -1:
+			run = i
+		case !alnum:
+			if run != -1 {
+				tokens = append(tokens, learnedToken{class: classifyRun(value[run:i]), text: value[run:i]})
+				run = -1
+			}
+			tokens = append(tokens, learnedToken{text: string(r)})
+		}
+	}
+	if run != -1 {
+		tokens = append(tokens, learnedToken{class: classifyRun(value[run:]), text: value[run:]})
+	}
+	return tokens
+}
+
+// classifyRun returns the most specific class containing every character
+func classifyRun(run string) string {
+	for _, class := range learnedClasses {
+		if strings.Trim(run, class.chars) == "" {
+			return class.name
+		}
+	}
+	return "alnum"
+}
+
+// shapeKey identifies values with the same sequence of classes and punctuation
+func shapeKey(tokens []learnedToken) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		if tok.class != "" {
+			b.WriteString("<" + tok.class + ">")
+		} else {
+			b.WriteString(tok.text)
+		}
+	}
+	return b.String()
+}
+
+// induceGrammar builds a grammar generalizing the samples, rooted at symbol
+func induceGrammar(symbol string, samples []string) Grammar {
+	grammar := make(Grammar)
+	base := strings.TrimSuffix(symbol, ">")
+	helpers := 0
+	define := func(alternatives []string) string {
+		if len(alternatives) == 1 {
+			return alternatives[0]
+		}
+		helpers++
+		name := fmt.Sprintf("%s-%d>", base, helpers)
+		grammar[name] = alternatives
+		return name
+	}
+
+	// A prefix and suffix shared by every value stay literal
+	prefix, suffix := "", ""
+	if len(samples) > 1 {
+		prefix, suffix = commonAffixes(samples)
+	}
+
+	// Group values by shape, most common shapes first
+	type shape struct {
+		key     string
+		samples [][]learnedToken
+	}
+	var shapes []*shape
+	byKey := make(map[string]*shape)
+	for _, sample := range samples {
+		tokens := tokenizeSample(sample[len(prefix) : len(sample)-len(suffix)])
+		key := shapeKey(tokens)
+		if byKey[key] == nil {
+			byKey[key] = &shape{key: key}
+			shapes = append(shapes, byKey[key])
+		}
+		byKey[key].samples = append(byKey[key].samples, tokens)
+	}
+	sort.SliceStable(shapes, func(i, j int) bool {
+		return len(shapes[i].samples) > len(shapes[j].samples)
+	})
+	if len(shapes) > maxLearnedShapes {
+		shapes = shapes[:maxLearnedShapes]
+	}
+
+	var alternatives []string
+	for _, s := range shapes {
+		var b strings.Builder
+		b.WriteString(prefix)
+		for i, tok := range s.samples[0] {
+			if tok.class == "" || len(s.samples) > 1 && constantToken(s.samples, i) {
+				b.WriteString(tok.text)
+				continue
+			}
+
+			// Runs that vary become their class at the observed lengths
+			classSymbol := "<learned:" + tok.class + ">"
+			for _, class := range learnedClasses {
+				if class.name == tok.class {
+					grammar[classSymbol] = strings.Split(class.chars, "")
+				}
+			}
+			var runs []string
+			for _, length := range observedLengths(s.samples, i) {
+				runs = append(runs, strings.Repeat(classSymbol, length))
+			}
+			b.WriteString(define(runs))
+		}
+		b.WriteString(suffix)
+		alternatives = append(alternatives, b.String())
+	}
+
+	grammar[symbol] = alternatives
+	return grammar
+}
+
+// commonAffixes returns the longest prefix and suffix shared by all samples,
+// never overlapping within the shortest one
+func commonAffixes(samples []string) (string, string) {
+	prefix, suffix := samples[0], samples[0]
+	shortest := len(samples[0])
+	for _, s := range samples[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+		for !strings.HasSuffix(s, suffix) {
+			suffix = suffix[1:]
+		}
+		shortest = min(shortest, len(s))
+	}
+	if len(prefix)+len(suffix) > shortest {
+		suffix = suffix[len(prefix)+len(suffix)-shortest:]
+	}
+
+	// Keep affixes on rune boundaries
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	for !utf8.ValidString(suffix) {
+		suffix = suffix[1:]
+	}
+	return prefix, suffix
+}
+
+// constantToken reports whether token i has the same text in every sample
+func constantToken(samples [][]learnedToken, i int) bool {
+	for _, tokens := range samples[1:] {
+		if tokens[i].text != samples[0][i].text {
+			return false
+		}
+	}
+	return true
+}
+
+// observedLengths returns the most common lengths of token i plus the
+// shortest and longest seen, most common first
+func observedLengths(samples [][]learnedToken, i int) []int {
+	counts := make(map[int]int)
+	shortest, longest := len(samples[0][i].text), len(samples[0][i].text)
+	for _, tokens := range samples {
+		n := len(tokens[i].text)
+		counts[n]++
+		shortest, longest = min(shortest, n), max(longest, n)
+	}
+
+	lengths := make([]int, 0, len(counts))
+	for n := range counts {
+		lengths = append(lengths, n)
+	}
+	sort.Slice(lengths, func(a, b int) bool {
+		if counts[lengths[a]] != counts[lengths[b]] {
+			return counts[lengths[a]] > counts[lengths[b]]
+		}
+		return lengths[a] < lengths[b]
+	})
+	if len(lengths) > maxLearnedLengths {
+		lengths = lengths[:maxLearnedLengths]
+	}
+
+	for _, n := range []int{shortest, longest} {
+		found := false
+		for _, l := range lengths {
+			found = found || l == n
+		}
+		if !found {
+			lengths = append(lengths, n)
+		}
+	}
+	return lengths
+}
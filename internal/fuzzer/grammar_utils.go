@@ -1,6 +1,8 @@
 package fuzzer
 
 import (
+	"fmt"
+	"math/rand"
 	"strings"
 )
 
@@ -12,6 +14,37 @@ func isNonterminal(s string) bool {
 // Grammar represents a context-free grammar
 type Grammar map[string][]string
 
+// splitExpansion splits an expansion into the nonterminals of the grammar it
+// references and the literal text between them. Whitespace stays part of the
+// literals, and <...> text that is not a defined symbol is literal too.
+func splitExpansion(grammar Grammar, expansion string) []string {
+	var parts []string
+	literal := 0
+	for i := 0; i < len(expansion); i++ {
+		if expansion[i] != '<' {
+			continue
+		}
+		end := strings.IndexByte(expansion[i:], '>')
+		if end == -1 {
+			break
+		}
+		symbol := expansion[i : i+end+1]
+		if _, ok := grammar[symbol]; !ok {
+			continue
+		}
+		if literal < i {
+			parts = append(parts, expansion[literal:i])
+		}
+		parts = append(parts, symbol)
+		i += end
+		literal = i + 1
+	}
+	if literal < len(expansion) {
+		parts = append(parts, expansion[literal:])
+	}
+	return parts
+}
+
 // expansionKey creates a unique key for a symbol and its expansion
 func expansionKey(symbol, expansion string) string {
 	return symbol + " -> " + expansion
@@ -25,3 +58,149 @@ func parseExpansionKey(key string) (symbol, expansion string) {
 	}
 	return parts[0], parts[1]
 }
+
+// expandGrammar randomly expands symbol, replacing nonterminals embedded
+// anywhere in an expansion. Beyond maxDepth the shortest expansion is used so
+// recursive rules terminate.
+func expandGrammar(rng *rand.Rand, grammar Grammar, symbol string, depth, maxDepth int) string {
+	alternatives, ok := grammar[symbol]
+	if !ok || len(alternatives) == 0 {
+		return symbol
+	}
+
+	var expansion string
+	if depth >= maxDepth {
+		expansion = shortestExpansion(alternatives)
+	} else {
+		expansion = alternatives[rng.Intn(len(alternatives))]
+	}
+
+	var result strings.Builder
+	for _, part := range splitExpansion(grammar, expansion) {
+		if _, ok := grammar[part]; ok {
+			result.WriteString(expandGrammar(rng, grammar, part, depth+1, maxDepth))
+		} else {
+			result.WriteString(part)
+		}
+	}
+	return result.String()
+}
+
+// shortestExpansion returns the alternative with the fewest nonterminals,
+// used past the depth limit so recursive rules terminate
+func shortestExpansion(alternatives []string) string {
+	shortest := alternatives[0]
+	for _, alt := range alternatives[1:] {
+		if strings.Count(alt, "<") < strings.Count(shortest, "<") {
+			shortest = alt
+		}
+	}
+	return shortest
+}
+
+// defaultPayloadGrammar generates attack strings when no grammar is supplied
+var defaultPayloadGrammar = Grammar{
+	"<start>":     {"<injection>"},
+	"<injection>": {"<sqli>", "<xss>", "<traversal>", "<cmdi>", "<template>"},
+	"<sqli>": {
+		"<quote> OR <quote>1<quote>=<quote>1",
+		"<quote><comment>",
+		"1<quote> UNION SELECT NULL<comment>",
+		"1<quote> AND SLEEP(5)<comment>",
+	},
+	"<quote>":     {"'", "\"", ""},
+	"<comment>":   {"--", "#", "/*"},
+	"<xss>":       {"<tag>alert(1)</script>", "\"><img src=x onerror=alert(1)>", "javascript:alert(1)"},
+	"<tag>":       {"<script>", "<ScRiPt>"},
+	"<traversal>": {"<dotdot><dotdot><dotdot>etc/passwd", "<dotdot><dotdot>windows/win.ini"},
+	"<dotdot>":    {"../", "..%2f", "%2e%2e/", "....//"},
+	"<cmdi>":      {"<sep>id", "<sep>cat /etc/passwd", "$(id)", "`id`"},
+	"<sep>":       {";", "|", "&&", "%0a"},
+	"<template>":  {"{{7*7}}", "${7*7}", "<%= 7*7 %>", "#{7*7}"},
+}
+
+// duplicateContextDepth is how many levels below <start> nonterminals are
+// cloned per occurrence when contexts are duplicated
+const duplicateContextDepth = 4
+
+// duplicateContexts returns a copy of grammar in which every occurrence of a
+// nonterminal within depth levels of symbol refers to its own clone of the
+// rule, so that e.g. <digit> under <year> and <digit> under <port> are
+// covered separately. Recursive references inside a clone point back at the
+// clone. Rules that become unreachable from <start> are dropped.
+func duplicateContexts(grammar Grammar, symbol string, depth int) Grammar {
+	result := make(Grammar, len(grammar))
+	for s, alternatives := range grammar {
+		result[s] = append([]string(nil), alternatives...)
+	}
+
+	var duplicate func(symbol string, depth int, seen map[string]string)
+	duplicate = func(symbol string, depth int, seen map[string]string) {
+		for i, expansion := range result[symbol] {
+			var b strings.Builder
+			for _, part := range splitExpansion(grammar, expansion) {
+				if _, ok := grammar[part]; !ok || depth == 0 {
+					b.WriteString(part)
+					continue
+				}
+				if clone, ok := seen[part]; ok {
+					b.WriteString(clone)
+					continue
+				}
+
+				clone := newSymbolName(result, part)
+				result[clone] = append([]string(nil), grammar[part]...)
+
+				// Siblings get their own clones; descendants reuse this one
+				path := make(map[string]string, len(seen)+1)
+				for s, c := range seen {
+					path[s] = c
+				}
+				path[part] = clone
+				duplicate(clone, depth-1, path)
+
+				b.WriteString(clone)
+			}
+			result[symbol][i] = b.String()
+		}
+	}
+	duplicate(symbol, depth, map[string]string{symbol: symbol})
+
+	used := reachableSymbols(result, "<start>")
+	for s := range result {
+		if !used[s] {
+			delete(result, s)
+		}
+	}
+	return result
+}
+
+// reachableSymbols returns the nonterminals derivable from symbol
+func reachableSymbols(grammar Grammar, symbol string) map[string]bool {
+	used := map[string]bool{symbol: true}
+	pending := []string{symbol}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for _, expansion := range grammar[current] {
+			for _, part := range splitExpansion(grammar, expansion) {
+				if _, ok := grammar[part]; ok && !used[part] {
+					used[part] = true
+					pending = append(pending, part)
+				}
+			}
+		}
+	}
+	return used
+}
+
+// newSymbolName returns an unused nonterminal name derived from symbol
+func newSymbolName(grammar Grammar, symbol string) string {
+	base := strings.TrimSuffix(symbol, ">")
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("%s-%d>", base, n)
+		if _, exists := grammar[name]; !exists {
+			return name
+		}
+	}
+}
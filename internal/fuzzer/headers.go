@@ -0,0 +1,98 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ParseHeaders parses "Name: value" lines into the extra headers sent with
+// every request
+func ParseHeaders(lines []string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q: expected \"Name: value\"", line)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// ParseCookies parses "name=value; other=value" lists into the cookies sent
+// with every request
+func ParseCookies(specs []string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	for _, spec := range specs {
+		parsed, err := http.ParseCookie(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie %q: %v", spec, err)
+		}
+		cookies = append(cookies, parsed...)
+	}
+	return cookies, nil
+}
+
+// headerTransport adds the configured headers and cookies to every request
+// that does not set them itself, so templates and fuzzers can still override
+// them
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+	cookies []*http.Cookie
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		if name == "Host" {
+			if req.Host == "" || req.Host == req.URL.Host {
+				req.Host = value
+			}
+			continue
+		}
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+	for _, cookie := range t.cookies {
+		if _, err := req.Cookie(cookie.Name); err != nil {
+			req.AddCookie(cookie)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// extraHeaders returns the configured headers with the cookies folded into
+// a Cookie header, in a stable order, for clients that take plain header
+// lines: the browser and raw socket probes
+func extraHeaders(config *Config) [][2]string {
+	if config == nil {
+		return nil
+	}
+	var headers [][2]string
+	for _, name := range sortedKeys(config.Headers) {
+		headers = append(headers, [2]string{name, config.Headers[name]})
+	}
+	if config.Impersonation != nil && config.Headers["User-Agent"] == "" {
+		headers = append(headers, [2]string{"User-Agent", config.Impersonation.UserAgent()})
+	}
+	if config.OAuth2 != nil && config.Headers["Authorization"] == "" {
+		if token, err := config.OAuth2.Token(); err == nil {
+			headers = append(headers, [2]string{"Authorization", "Bearer " + token})
+		}
+	}
+	if len(config.Cookies) > 0 {
+		pairs := make([]string, len(config.Cookies))
+		for i, cookie := range config.Cookies {
+			pairs[i] = cookie.Name + "=" + cookie.Value
+		}
+		sort.Strings(pairs)
+		headers = append(headers, [2]string{"Cookie", strings.Join(pairs, "; ")})
+	}
+	return headers
+}
@@ -0,0 +1,320 @@
+package fuzzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Hooks are called at the points of a request's life where a run can be
+// customized: before a request is sent, e.g. to sign it or compute a dynamic
+// header, after a fuzzed response arrived, to classify it, and before a new
+// finding is stored. Hooks are called from many workers at once.
+type Hooks interface {
+	// OnRequest may change req and returns its body, changed or not. An
+	// error fails the request.
+	OnRequest(req *http.Request, body []byte) ([]byte, error)
+	// OnResponse returns findings for a fuzzed exchange
+	OnResponse(req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) []*Finding
+	// OnFinding may change a new finding; returning false drops it
+	OnFinding(f *Finding) bool
+}
+
+// Hook events a HookScript can handle
+const (
+	HookRequest  = "request"
+	HookResponse = "response"
+	HookFinding  = "finding"
+)
+
+// hookTransport calls the OnRequest hooks on every request before sending it
+type hookTransport struct {
+	base  http.RoundTripper
+	hooks []Hooks
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+		req.Body.Close()
+	}
+
+	req = req.Clone(req.Context())
+	for _, h := range t.hooks {
+		var err error
+		if body, err = h.OnRequest(req, body); err != nil {
+			return nil, fmt.Errorf("request hook failed: %v", err)
+		}
+	}
+
+	req.ContentLength = int64(len(body))
+	req.Body = http.NoBody
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	if len(body) > 0 {
+		req.Body, _ = req.GetBody()
+	}
+	return t.base.RoundTrip(req)
+}
+
+// runResponseHooks collects the findings the OnResponse hooks return for a
+// fuzzed exchange
+func runResponseHooks(config *Config, req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) []*Finding {
+	var findings []*Finding
+	for _, h := range config.Hooks {
+		findings = append(findings, h.OnResponse(req, reqBody, resp, body, payload)...)
+	}
+	return findings
+}
+
+// newHookedFindingStore creates an empty finding store calling hooks on
+// every new finding
+func newHookedFindingStore(hooks []Hooks) *FindingStore {
+	store := NewFindingStore()
+	store.SetHooks(hooks)
+	return store
+}
+
+// HookScript runs a user-supplied script as hooks. The script is started once
+// and handles one event at a time: it reads a JSON object per line on stdin
+// and answers each with one JSON object line on stdout, so it can be written
+// in any language. Events it was not started for are not sent.
+//
+//	{"event":"request","request":{...}}  ->  {"request":{...}} to replace the request, or {}
+//	{"event":"response","request":{...},"response":{...},"payload":"..."}  ->  {"findings":[...]} or {}
+//	{"event":"finding","finding":{...}}  ->  {"finding":{...}} to replace it, {"drop":true} or {}
+//
+// Requests carry method, url, headers (name to list of values, Host
+// included) and body; responses carry status, headers and body; findings are
+// encoded as in findings.jsonl. Fields left out of an answer keep their
+// values. Bodies are strings, so binary bodies do not survive a round trip
+// through the script.
+type HookScript struct {
+	events map[string]bool
+
+	mu     sync.Mutex // One event at a time
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	err    error // Set once the script failed; later events fail too
+}
+
+// hookRequest is a request as a HookScript sees it
+type hookRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
+// hookResponse is a response as a HookScript sees it
+type hookResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body"`
+}
+
+// hookMessage is an event sent to a HookScript
+type hookMessage struct {
+	Event    string        `json:"event"`
+	Request  *hookRequest  `json:"request,omitempty"`
+	Response *hookResponse `json:"response,omitempty"`
+	Payload  string        `json:"payload,omitempty"`
+	Finding  *Finding      `json:"finding,omitempty"`
+}
+
+// hookReply is a HookScript's answer to an event. The request and finding
+// are decoded over the ones sent, so fields left out keep their values.
+type hookReply struct {
+	Request  json.RawMessage `json:"request"`
+	Findings []*Finding      `json:"findings"`
+	Finding  json.RawMessage `json:"finding"`
+	Drop     bool            `json:"drop"`
+}
+
+// NewHookScript starts command, a program and its arguments separated by
+// spaces, to handle the given events (HookRequest, HookResponse,
+// HookFinding). Its stderr goes to the fuzzer's.
+func NewHookScript(command string, events []string) (*HookScript, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("hook script command is empty")
+	}
+	s := &HookScript{events: make(map[string]bool)}
+	for _, event := range events {
+		switch event {
+		case HookRequest, HookResponse, HookFinding:
+			s.events[event] = true
+		default:
+			return nil, fmt.Errorf("unknown hook event %q (want %s, %s or %s)", event, HookRequest, HookResponse, HookFinding)
+		}
+	}
+
+	s.cmd = exec.Command(args[0], args[1:]...)
+	s.cmd.Stderr = os.Stderr
+	var err error
+	if s.stdin, err = s.cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("failed to start hook script: %v", err)
+	}
+	stdout, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start hook script: %v", err)
+	}
+	s.stdout = bufio.NewReader(stdout)
+	if err := s.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start hook script: %v", err)
+	}
+	return s, nil
+}
+
+// Close ends the script's input and waits for it to exit
+func (s *HookScript) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stdin.Close()
+	return s.cmd.Wait()
+}
+
+// call sends one event to the script and reads its answer. The first
+// failure of the script is logged, and fails every later event.
+func (s *HookScript) call(msg *hookMessage) (*hookReply, error) {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %v", msg.Event, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	if _, err := s.stdin.Write(append(line, '\n')); err != nil {
+		s.err = fmt.Errorf("hook script stopped reading: %v", err)
+		logging.For("hooks").Warn("hook script failed, later events are skipped", "error", s.err)
+		return nil, s.err
+	}
+	answer, err := s.stdout.ReadBytes('\n')
+	if err != nil {
+		s.err = fmt.Errorf("hook script did not answer: %v", err)
+		logging.For("hooks").Warn("hook script failed, later events are skipped", "error", s.err)
+		return nil, s.err
+	}
+
+	var reply hookReply
+	if err := json.Unmarshal(answer, &reply); err != nil {
+		err = fmt.Errorf("invalid hook script answer to %s event: %v", msg.Event, err)
+		logging.For("hooks").Warn("hook script answer ignored", "error", err)
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// OnRequest implements Hooks, replacing the request with the one the script
+// answers with
+func (s *HookScript) OnRequest(req *http.Request, body []byte) ([]byte, error) {
+	if !s.events[HookRequest] {
+		return body, nil
+	}
+	sent := newHookRequest(req, body)
+	reply, err := s.call(&hookMessage{Event: HookRequest, Request: sent})
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.Request) == 0 {
+		return body, nil
+	}
+
+	changed := *sent
+	changed.Headers = sent.Headers.Clone()
+	if err := json.Unmarshal(reply.Request, &changed); err != nil {
+		return nil, fmt.Errorf("invalid request from hook script: %v", err)
+	}
+	if changed.URL != sent.URL {
+		u, err := url.Parse(changed.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL from hook script: %v", err)
+		}
+		req.URL = u
+	}
+	req.Method = changed.Method
+
+	// An unchanged Host header follows a changed URL
+	host := changed.Headers.Get("Host")
+	changed.Headers.Del("Host")
+	if host == sent.Headers.Get("Host") && changed.URL != sent.URL || host == req.URL.Host {
+		host = ""
+	}
+	req.Host = host
+	req.Header = changed.Headers
+	return []byte(changed.Body), nil
+}
+
+// OnResponse implements Hooks, returning the findings the script reports
+func (s *HookScript) OnResponse(req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) []*Finding {
+	if !s.events[HookResponse] {
+		return nil
+	}
+	reply, err := s.call(&hookMessage{
+		Event:    HookResponse,
+		Request:  newHookRequest(req, reqBody),
+		Response: &hookResponse{Status: resp.StatusCode, Headers: resp.Header, Body: string(body)},
+		Payload:  payload,
+	})
+	if err != nil {
+		return nil
+	}
+	return reply.Findings
+}
+
+// OnFinding implements Hooks, replacing or dropping the finding as the
+// script answers
+func (s *HookScript) OnFinding(f *Finding) bool {
+	if !s.events[HookFinding] {
+		return true
+	}
+	reply, err := s.call(&hookMessage{Event: HookFinding, Finding: f})
+	if err != nil {
+		return true
+	}
+	if reply.Drop {
+		return false
+	}
+	if len(reply.Finding) > 0 {
+		if err := json.Unmarshal(reply.Finding, f); err != nil {
+			logging.For("hooks").Warn("invalid finding from hook script", "error", err)
+		}
+	}
+	return true
+}
+
+// newHookRequest describes req to a script, with the Host header it is sent
+// with
+func newHookRequest(req *http.Request, body []byte) *hookRequest {
+	headers := req.Header.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers.Set("Host", host)
+	return &hookRequest{Method: req.Method, URL: req.URL.String(), Headers: headers, Body: string(body)}
+}
@@ -0,0 +1,221 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Precedences a server applies to a duplicated parameter
+const (
+	precedenceFirst  = "first"
+	precedenceLast   = "last"
+	precedenceJoined = "joined"
+)
+
+// pollutionVariant sends one parameter twice, with a first and a second
+// value, in one layout
+type pollutionVariant struct {
+	name  string
+	build func(u url.URL, param, first, second string) (*http.Request, []byte, error)
+}
+
+// pollutionVariants are the duplicate layouts tried: the repeated query
+// parameter most frameworks pick one value from, the array syntax PHP,
+// Express and Rails decode into a list, and the same parameter in the query
+// string and a form body, which frameworks that merge both resolve in
+// different orders
+var pollutionVariants = []pollutionVariant{
+	{"duplicate query parameter", func(u url.URL, param, first, second string) (*http.Request, []byte, error) {
+		query := u.Query()
+		query.Del(param)
+		u.RawQuery = appendQuery(query.Encode(), url.QueryEscape(param)+"="+url.QueryEscape(first), url.QueryEscape(param)+"="+url.QueryEscape(second))
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		return req, nil, err
+	}},
+	{"array-style query parameter", func(u url.URL, param, first, second string) (*http.Request, []byte, error) {
+		query := u.Query()
+		query.Del(param)
+		name := url.QueryEscape(param + "[]")
+		u.RawQuery = appendQuery(query.Encode(), name+"="+url.QueryEscape(first), name+"="+url.QueryEscape(second))
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		return req, nil, err
+	}},
+	{"query and body parameter", func(u url.URL, param, first, second string) (*http.Request, []byte, error) {
+		query := u.Query()
+		query.Set(param, first)
+		u.RawQuery = query.Encode()
+		body := []byte(url.Values{param: {second}}.Encode())
+		req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(string(body)))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, body, nil
+	}},
+}
+
+// appendQuery joins encoded query string parts, skipping empty ones
+func appendQuery(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// reflectedPrecedence tells from the values a response reflects which of two
+// duplicates the server honored. It returns "" when the response reflects
+// neither, or both apart, as a page echoing its whole URL does.
+func reflectedPrecedence(body []byte, first, second string) string {
+	text := string(body)
+	hasFirst, hasSecond := strings.Contains(text, first), strings.Contains(text, second)
+	switch {
+	case strings.Contains(text, first+","+second) || strings.Contains(text, first+second):
+		return precedenceJoined
+	case hasFirst && !hasSecond:
+		return precedenceFirst
+	case hasSecond && !hasFirst:
+		return precedenceLast
+	}
+	return ""
+}
+
+// probeParameterPollution sends one query parameter twice with conflicting
+// values in each duplicate layout and works out which value the server
+// honors: from the canary it reflects, or else by diffing the response
+// against those for the original value and a canary sent alone. Only
+// handling that can be abused is reported: layouts honoring different
+// values, as low, since a filter reading one layout and the application
+// another disagree, and joined values, as ASP.NET answers with
+// "first,second", as medium: a payload split across duplicates gets past
+// filters that inspect each value on its own. One consistent precedence is
+// how every framework behaves and is not reported.
+func probeParameterPollution(client *http.Client, config *Config, rng *rand.Rand, targetURL, param string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	exchange := func(req *http.Request, reqBody []byte) (*probeResponse, error) {
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := readLimited(resp.Body, maxBodySize(config))
+		if err != nil {
+			return nil, err
+		}
+		return &probeResponse{req: req, reqBody: reqBody, resp: resp, body: body.data}, nil
+	}
+	single := func(value string) (*probeResponse, error) {
+		u := *parsed
+		query := u.Query()
+		query.Set(param, value)
+		u.RawQuery = query.Encode()
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return exchange(req, nil)
+	}
+
+	first := fmt.Sprintf("gfp%08x", rng.Uint32())
+	second := fmt.Sprintf("gfq%08x", rng.Uint32())
+
+	// The original value and a canary are diffed against when no canary is
+	// reflected; a response that varies on its own cannot be diffed
+	original := parsed.Query().Get(param)
+	var originalResp, canaryResp *probeResponse
+	if original != "" {
+		if originalResp, err = single(original); err != nil {
+			return nil, err
+		}
+		if canaryResp, err = single(second); err != nil {
+			return nil, err
+		}
+		again, err := single(original)
+		if err != nil {
+			return nil, err
+		}
+		if !originalResp.like(again) || originalResp.like(canaryResp) {
+			originalResp, canaryResp = nil, nil
+		}
+	}
+
+	var behaviours []string
+	precedences := make(map[string]bool)
+	var joined *probeResponse
+	var joinedVariant string
+	var evidence *probeResponse
+	for _, variant := range pollutionVariants {
+		if expired() {
+			break
+		}
+		req, reqBody, err := variant.build(*parsed, param, first, second)
+		if err != nil {
+			return nil, err
+		}
+		probe, err := exchange(req, reqBody)
+		if err != nil {
+			continue
+		}
+		precedence := reflectedPrecedence(probe.body, first, second)
+		if precedence == "" && originalResp != nil {
+			// Diff with the original value first and a canary second
+			req, reqBody, err := variant.build(*parsed, param, original, second)
+			if err != nil {
+				return nil, err
+			}
+			if probe, err = exchange(req, reqBody); err != nil {
+				continue
+			}
+			switch {
+			case probe.like(originalResp):
+				precedence = precedenceFirst
+			case probe.like(canaryResp):
+				precedence = precedenceLast
+			}
+		}
+		if precedence == "" || probe.resp.StatusCode >= http.StatusBadRequest {
+			continue
+		}
+		behaviours = append(behaviours, fmt.Sprintf("%s: %s value honored", variant.name, precedence))
+		precedences[precedence] = true
+		if evidence == nil {
+			evidence = probe
+		}
+		if precedence == precedenceJoined && joined == nil {
+			joined, joinedVariant = probe, variant.name
+		}
+	}
+	if joined == nil && len(precedences) < 2 {
+		return nil, nil
+	}
+
+	finding := &Finding{
+		Type:       "parameter-pollution",
+		Severity:   SeverityLow,
+		Confidence: ConfidenceFirm,
+		Parameter:  param,
+		Payload:    fmt.Sprintf("%s=%s&%s=%s", param, first, param, second),
+		Evidence:   "Duplicated parameter handling differs between layouts: " + strings.Join(behaviours, "; "),
+	}
+	if joined != nil {
+		finding.Severity = SeverityMedium
+		finding.Evidence = fmt.Sprintf("Duplicated parameter handling: %s. The %s values are joined, so a payload split across duplicates passes filters that check each value",
+			strings.Join(behaviours, "; "), joinedVariant)
+		evidence = joined
+	}
+	finding.URL, finding.Method = evidence.req.URL.String(), evidence.req.Method
+	captureExchange(finding, evidence.req, evidence.reqBody, evidence.resp, evidence.body)
+	return finding, nil
+}
@@ -0,0 +1,198 @@
+package fuzzer
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// BrowserRotate is the browser profile name rotating through every profile
+const BrowserRotate = "rotate"
+
+// browserProfile is the User-Agent and the headers a browser sends when it
+// navigates to a page. Accept-Encoding is left to the transport, which only
+// decompresses responses when it asked for gzip itself.
+type browserProfile struct {
+	userAgent string
+	headers   [][2]string
+}
+
+// browserProfiles are the browsers requests can impersonate, by name
+var browserProfiles = map[string]browserProfile{
+	"chrome": {
+		userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+		headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Sec-Ch-Ua", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+			{"Sec-Ch-Ua-Mobile", "?0"},
+			{"Sec-Ch-Ua-Platform", `"Windows"`},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+			{"Upgrade-Insecure-Requests", "1"},
+		},
+	},
+	"edge": {
+		userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+		headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Sec-Ch-Ua", `"Chromium";v="124", "Microsoft Edge";v="124", "Not-A.Brand";v="99"`},
+			{"Sec-Ch-Ua-Mobile", "?0"},
+			{"Sec-Ch-Ua-Platform", `"Windows"`},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+			{"Upgrade-Insecure-Requests", "1"},
+		},
+	},
+	"firefox": {
+		userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+		headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+			{"Upgrade-Insecure-Requests", "1"},
+		},
+	},
+	"safari": {
+		userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+		headers: [][2]string{
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+		},
+	},
+}
+
+// Impersonation makes requests look like a browser's: each is sent a
+// browser profile's User-Agent and navigation headers, or a User-Agent from
+// a rotation list, taking the next profile and User-Agent in turn. It is
+// shared by every client built from the same Config and is safe for
+// concurrent use.
+type Impersonation struct {
+	profiles   []browserProfile
+	userAgents []string
+	next       uint64
+}
+
+// NewImpersonation creates an impersonation of the named browser, chrome,
+// edge, firefox or safari, or of each in turn with BrowserRotate, sending
+// the User-Agents of userAgents in turn instead of the browsers' when any
+// are given. With no browser only the User-Agent is changed.
+func NewImpersonation(browser string, userAgents []string) (*Impersonation, error) {
+	imp := &Impersonation{userAgents: userAgents}
+	switch browser {
+	case "":
+	case BrowserRotate:
+		for _, name := range sortedKeys(browserProfiles) {
+			imp.profiles = append(imp.profiles, browserProfiles[name])
+		}
+	default:
+		profile, ok := browserProfiles[strings.ToLower(browser)]
+		if !ok {
+			return nil, fmt.Errorf("unknown browser %q: expected one of %s or %s",
+				browser, strings.Join(sortedKeys(browserProfiles), ", "), BrowserRotate)
+		}
+		imp.profiles = []browserProfile{profile}
+	}
+	if len(imp.profiles) == 0 && len(imp.userAgents) == 0 {
+		return nil, fmt.Errorf("impersonation needs a browser or User-Agents")
+	}
+	return imp, nil
+}
+
+// LoadUserAgents reads User-Agents to rotate through, one per line. Blank
+// lines and lines starting with # are skipped.
+func LoadUserAgents(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open User-Agent list: %v", err)
+	}
+	defer file.Close()
+
+	var userAgents []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text != "" && !strings.HasPrefix(text, "#") {
+			userAgents = append(userAgents, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read User-Agent list: %v", err)
+	}
+	if len(userAgents) == 0 {
+		return nil, fmt.Errorf("%s: no User-Agents", path)
+	}
+	return userAgents, nil
+}
+
+// pick returns the User-Agent and headers of the next request
+func (imp *Impersonation) pick() (string, [][2]string) {
+	turn := atomic.AddUint64(&imp.next, 1) - 1
+	var userAgent string
+	var headers [][2]string
+	if len(imp.profiles) > 0 {
+		profile := imp.profiles[turn%uint64(len(imp.profiles))]
+		userAgent, headers = profile.userAgent, profile.headers
+	}
+	if len(imp.userAgents) > 0 {
+		userAgent = imp.userAgents[turn%uint64(len(imp.userAgents))]
+	}
+	return userAgent, headers
+}
+
+// UserAgent returns the User-Agent of the next request
+func (imp *Impersonation) UserAgent() string {
+	userAgent, _ := imp.pick()
+	return userAgent
+}
+
+// impersonateTransport sends each request with the impersonated browser's
+// User-Agent, and navigations with its navigation headers too, where the
+// request does not set them itself
+type impersonateTransport struct {
+	base          http.RoundTripper
+	impersonation *Impersonation
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *impersonateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	userAgent, headers := t.impersonation.pick()
+	req = req.Clone(req.Context())
+	// Go's default User-Agent is only filled in on the wire, so any set here
+	// was set on purpose
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	if !navigation(req) {
+		return t.base.RoundTrip(req)
+	}
+	for _, header := range headers {
+		if req.Header.Get(header[0]) == "" {
+			req.Header.Set(header[0], header[1])
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// navigation reports whether a request is one a browser would send as a
+// page navigation: a GET without a body that does not ask for a content
+// type of its own. Form posts, API calls and fetches of JSON would never
+// carry navigation headers from a browser.
+func navigation(req *http.Request) bool {
+	return req.Method == http.MethodGet && req.Header.Get("Accept") == "" &&
+		(req.Body == nil || req.Body == http.NoBody) && req.ContentLength == 0
+}
@@ -0,0 +1,244 @@
+package fuzzer
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// sqlInjectionPayloads are sent to every probed query parameter
+var sqlInjectionPayloads = []string{
+	"'",
+	"\"",
+	"')",
+	"' OR '1'='1",
+	"1' AND 1=CONVERT(int,@@version)--",
+	"1 UNION SELECT NULL--",
+}
+
+// InjectionProber sends SQL injection payloads, and optionally reflected
+// XSS, command, NoSQL, LDAP, XPath and expression language injection,
+// parameter pollution and Unicode normalization probes, to every query
+// parameter of a URL. A URL without parameters is
+// probed through "id".
+type InjectionProber struct {
+	config   *Config
+	client   *http.Client
+	rng      *rand.Rand
+	sql      bool
+	xss      bool
+	commands bool
+	nosql    bool
+	ldap     bool
+	xpath    bool
+	el       bool
+	hpp      bool
+	unicode  bool
+	logger   *slog.Logger
+}
+
+// NewInjectionProber creates a prober reporting into the configured finding store
+func NewInjectionProber(config *Config) (*InjectionProber, error) {
+	if _, err := url.Parse(config.TargetURL); err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	client, err := newHTTPClient(config, true)
+	if err != nil {
+		return nil, err
+	}
+	return &InjectionProber{
+		config: config,
+		client: client,
+		rng:    newRand(runSeed(config), streamInjection),
+		sql:    true,
+		logger: logging.For("injection"),
+	}, nil
+}
+
+// SetSQLInjection enables or disables the SQL injection payloads, which are
+// sent by default
+func (p *InjectionProber) SetSQLInjection(enabled bool) {
+	p.sql = enabled
+}
+
+// SetXSS enables the reflected XSS probe
+func (p *InjectionProber) SetXSS(enabled bool) {
+	p.xss = enabled
+}
+
+// SetCommandInjection enables the command injection probes
+func (p *InjectionProber) SetCommandInjection(enabled bool) {
+	p.commands = enabled
+}
+
+// SetNoSQLInjection enables the NoSQL operator injection probes
+func (p *InjectionProber) SetNoSQLInjection(enabled bool) {
+	p.nosql = enabled
+}
+
+// SetLDAPInjection enables the LDAP filter injection probes
+func (p *InjectionProber) SetLDAPInjection(enabled bool) {
+	p.ldap = enabled
+}
+
+// SetXPathInjection enables the XPath injection probes
+func (p *InjectionProber) SetXPathInjection(enabled bool) {
+	p.xpath = enabled
+}
+
+// SetELInjection enables the expression language injection probes
+func (p *InjectionProber) SetELInjection(enabled bool) {
+	p.el = enabled
+}
+
+// SetParameterPollution enables the duplicated parameter probes
+func (p *InjectionProber) SetParameterPollution(enabled bool) {
+	p.hpp = enabled
+}
+
+// SetNormalization enables the Unicode normalization probes, which also
+// cover the last segment of the URL path
+func (p *InjectionProber) SetNormalization(enabled bool) {
+	p.unicode = enabled
+}
+
+// Run probes the configured target URL
+func (p *InjectionProber) Run() error {
+	return p.Probe(p.config.TargetURL, p.config.Deadline)
+}
+
+// Probe probes every query parameter of targetURL, stopping once the
+// deadline passes if one is set
+func (p *InjectionProber) Probe(targetURL string, deadline time.Time) error {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return fmt.Errorf("invalid target URL: %v", err)
+	}
+	params := sortedKeys(parsed.Query())
+	if len(params) == 0 {
+		params = []string{"id"}
+	}
+
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+
+	if p.unicode {
+		finding, err := probePathNormalization(p.client, p.config, p.rng, targetURL, deadline)
+		if err != nil {
+			p.logger.Debug("path normalization probe failed", "url", targetURL, "error", err)
+		} else if finding != nil {
+			p.logger.Warn("unicode normalization", "url", targetURL, "parameter", "path", "evidence", finding.Evidence)
+			p.config.Findings.Add(finding)
+		}
+	}
+
+	for _, param := range params {
+		for _, payload := range sqlInjectionPayloads {
+			if !p.sql {
+				break
+			}
+			if expired() {
+				return nil
+			}
+			sqli, err := NewSQLInjectionFuzzer(targetURL, payload)
+			if err != nil {
+				return err
+			}
+			sqli.SetParameter(param)
+			sqli.SetFindings(p.config.Findings)
+			sqli.client = p.client
+			if err := sqli.Run(); err != nil {
+				// One confirmed payload is enough for this parameter
+				p.logger.Debug("sql injection probe", "url", targetURL, "parameter", param, "result", err)
+				break
+			}
+		}
+
+		if p.xss && !expired() {
+			finding, err := probeReflectedXSS(p.client, p.config, p.rng, targetURL, param)
+			if err != nil {
+				p.logger.Debug("xss probe failed", "url", targetURL, "parameter", param, "error", err)
+			} else if finding != nil {
+				p.logger.Warn("reflected XSS", "url", targetURL, "parameter", param)
+				p.config.Findings.Add(finding)
+			}
+		}
+
+		if p.commands && !expired() {
+			finding, err := probeCommandInjection(p.client, p.config, p.rng, targetURL, param, deadline)
+			if err != nil {
+				p.logger.Debug("command injection probe failed", "url", targetURL, "parameter", param, "error", err)
+			} else if finding != nil {
+				p.logger.Warn("command injection", "url", targetURL, "parameter", param, "evidence", finding.Evidence)
+				p.config.Findings.Add(finding)
+			}
+		}
+
+		if p.nosql && !expired() {
+			finding, err := probeNoSQLInjection(p.client, p.config, p.rng, targetURL, param, deadline)
+			if err != nil {
+				p.logger.Debug("NoSQL injection probe failed", "url", targetURL, "parameter", param, "error", err)
+			} else if finding != nil {
+				p.logger.Warn("NoSQL injection", "url", targetURL, "parameter", param, "evidence", finding.Evidence)
+				p.config.Findings.Add(finding)
+			}
+		}
+
+		if p.ldap && !expired() {
+			p.probeLanguage(ldapPack, targetURL, param, deadline)
+		}
+
+		if p.xpath && !expired() {
+			p.probeLanguage(xpathPack, targetURL, param, deadline)
+		}
+
+		if p.el && !expired() {
+			finding, err := probeExpressionInjection(p.client, p.config, p.rng, targetURL, param, deadline)
+			if err != nil {
+				p.logger.Debug("expression injection probe failed", "url", targetURL, "parameter", param, "error", err)
+			} else if finding != nil {
+				p.logger.Warn("expression injection", "url", targetURL, "parameter", param, "evidence", finding.Evidence)
+				p.config.Findings.Add(finding)
+			}
+		}
+
+		if p.hpp && !expired() {
+			finding, err := probeParameterPollution(p.client, p.config, p.rng, targetURL, param, deadline)
+			if err != nil {
+				p.logger.Debug("parameter pollution probe failed", "url", targetURL, "parameter", param, "error", err)
+			} else if finding != nil {
+				p.logger.Warn("parameter pollution", "url", targetURL, "parameter", param, "evidence", finding.Evidence)
+				p.config.Findings.Add(finding)
+			}
+		}
+
+		if p.unicode && !expired() {
+			finding, err := probeNormalization(p.client, p.config, p.rng, targetURL, param, deadline)
+			if err != nil {
+				p.logger.Debug("unicode normalization probe failed", "url", targetURL, "parameter", param, "error", err)
+			} else if finding != nil {
+				p.logger.Warn("unicode normalization", "url", targetURL, "parameter", param, "evidence", finding.Evidence)
+				p.config.Findings.Add(finding)
+			}
+		}
+	}
+	return nil
+}
+
+// probeLanguage runs one language pack against a parameter and records its
+// finding
+func (p *InjectionProber) probeLanguage(pack *languagePack, targetURL, param string, deadline time.Time) {
+	finding, err := probeLanguage(p.client, p.config, p.rng, pack, targetURL, param, deadline)
+	if err != nil {
+		p.logger.Debug(pack.language+" injection probe failed", "url", targetURL, "parameter", param, "error", err)
+	} else if finding != nil {
+		p.logger.Warn(pack.language+" injection", "url", targetURL, "parameter", param, "evidence", finding.Evidence)
+		p.config.Findings.Add(finding)
+	}
+}
@@ -0,0 +1,89 @@
+package fuzzer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// inspectResponse runs the response detectors on one fuzzed exchange and
+// records what they find: server errors, framework error pages, content
+// showing that the payload worked, leaked secrets, differences from the
+// comparison deployment, and whatever the custom detectors and hooks report.
+// It reports whether any of the findings is new.
+func inspectResponse(config *Config, req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) bool {
+	var findings []*Finding
+	if resp.StatusCode >= http.StatusInternalServerError {
+		findings = append(findings, newServerErrorFinding(req.URL.String(), req.Method, payload, resp.StatusCode))
+	}
+	if finding := detectErrorPage(payload, body); finding != nil {
+		findings = append(findings, finding)
+	}
+	if finding := detectFileInclusion(config, req, payload, body); finding != nil {
+		findings = append(findings, finding)
+	}
+	findings = append(findings, config.Leaks.Scan(req, body, payload)...)
+	findings = append(findings, config.Differ.compare(config, req, reqBody, resp, body)...)
+	findings = append(findings, runDetectors(config, req, reqBody, resp, body, payload)...)
+	findings = append(findings, runResponseHooks(config, req, reqBody, resp, body, payload)...)
+
+	found := false
+	for _, finding := range findings {
+		if finding.URL == "" {
+			finding.URL = req.URL.String()
+		}
+		if finding.Method == "" {
+			finding.Method = req.Method
+		}
+		finding.Payload = payload
+		captureExchange(finding, req, reqBody, resp, body)
+		if config.Findings.Add(finding) {
+			found = true
+		}
+	}
+	return found
+}
+
+// inspectFailure records what a request failing for good says about the
+// target. An endpoint that cannot be connected to is down and is noted with
+// the retry policy. A payload the target times out or drops the connection
+// on every attempt may hang or crash it and is reported. Errors that were
+// not retried say neither.
+func inspectFailure(config *Config, req *http.Request, reqBody []byte, err error, payload string) {
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		return
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		endpoint := *req.URL
+		endpoint.RawQuery = ""
+		endpoint.Fragment = ""
+		config.Retry.markDead(endpoint.String(), retryErr.Err)
+		return
+	}
+	if payload == "" {
+		return
+	}
+
+	finding := &Finding{
+		Type:       "connection-dropped",
+		Severity:   SeverityInfo,
+		Confidence: ConfidenceTentative,
+		URL:        req.URL.String(),
+		Method:     req.Method,
+		Payload:    payload,
+		Evidence:   fmt.Sprintf("connection closed without a response in %d attempts: %v", retryErr.Attempts, retryErr.Err),
+		Timestamp:  time.Now(),
+	}
+	if retryErr.Timeout() {
+		finding.Type = "timeout"
+		finding.Severity = SeverityLow
+		finding.Evidence = fmt.Sprintf("no response in %d attempts, the payload may hang the server", retryErr.Attempts)
+	}
+	captureExchange(finding, req, reqBody, nil, nil)
+	config.Findings.Add(finding)
+}
@@ -1,7 +1,12 @@
 package fuzzer
 
-// FuzzerInterface defines the common interface for all fuzzer implementations
-type FuzzerInterface interface {
+// Runner defines the common interface for all fuzzer implementations
+type Runner interface {
 	// Run starts the fuzzing process
 	Run() error
 }
+
+// FuzzerInterface is the original name of Runner.
+//
+// Deprecated: Use Runner instead.
+type FuzzerInterface = Runner
@@ -3,11 +3,14 @@ package fuzzer
 import (
 	"context"
 	"fmt"
-	"log"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // JSFormDetector implements detection of JavaScript-rendered forms
@@ -15,21 +18,39 @@ type JSFormDetector struct {
 	url      string
 	timeout  time.Duration
 	maxDepth int
+	headers  [][2]string       // Extra headers the browser sends with every request
+	resolve  map[string]string // Addresses the browser dials host names at
+	insecure bool              // Whether the browser accepts any certificate
+
+	requests     []JSRequest // XHR and fetch requests the page sent
+	requestsLock sync.Mutex
+}
+
+// JSRequest is an XHR or fetch request a page's scripts sent
+type JSRequest struct {
+	Method string
+	URL    string
 }
 
 // JSForm represents a form detected in JavaScript
 type JSForm struct {
-	Action string    `json:"action"`
-	Method string    `json:"method"`
-	Fields []JSField `json:"fields"`
+	Action  string    `json:"action"`
+	Method  string    `json:"method"`
+	Enctype string    `json:"enctype"`
+	Fields  []JSField `json:"fields"`
 }
 
 // JSField represents a form field detected in JavaScript
 type JSField struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Required bool   `json:"required"`
-	Pattern  string `json:"pattern"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Required  bool   `json:"required"`
+	Pattern   string `json:"pattern"`
+	Min       string `json:"min"`
+	Max       string `json:"max"`
+	Step      string `json:"step"`
+	MinLength int    `json:"minLength"`
+	MaxLength int    `json:"maxLength"`
 }
 
 // NewJSFormDetector creates a new JavaScript form detector
@@ -41,10 +62,54 @@ func NewJSFormDetector(url string, timeout time.Duration) *JSFormDetector {
 	}
 }
 
+// SetHeaders sets extra headers the browser sends with every request, e.g.
+// session cookies or API keys
+func (d *JSFormDetector) SetHeaders(headers [][2]string) {
+	d.headers = headers
+}
+
+// SetResolve makes the browser dial host names at fixed addresses instead
+// of looking them up, as Config.Resolve does for the fuzzers
+func (d *JSFormDetector) SetResolve(resolve map[string]string) {
+	d.resolve = resolve
+}
+
+// SetInsecure makes the browser accept any server certificate, as
+// Config.InsecureSkipVerify does for the fuzzers
+func (d *JSFormDetector) SetInsecure(insecure bool) {
+	d.insecure = insecure
+}
+
+// newBrowserContext starts a headless browser that dials host names at the
+// addresses in resolve and, when insecure, accepts any server certificate.
+// Cancelling the context closes the browser.
+func newBrowserContext(resolve map[string]string, insecure bool) (context.Context, context.CancelFunc) {
+	parent, cancelAlloc := context.Background(), context.CancelFunc(func() {})
+	if len(resolve) > 0 || insecure {
+		opts := chromedp.DefaultExecAllocatorOptions[:]
+		if len(resolve) > 0 {
+			var rules []string
+			for _, host := range sortedKeys(resolve) {
+				rules = append(rules, "MAP "+host+" "+resolve[host])
+			}
+			opts = append(opts, chromedp.Flag("host-resolver-rules", strings.Join(rules, ", ")))
+		}
+		if insecure {
+			opts = append(opts, chromedp.IgnoreCertErrors)
+		}
+		parent, cancelAlloc = chromedp.NewExecAllocator(parent, opts...)
+	}
+	ctx, cancel := chromedp.NewContext(parent)
+	return ctx, func() {
+		cancel()
+		cancelAlloc()
+	}
+}
+
 // DetectForms finds JavaScript-rendered forms in the page
-func (d *JSFormDetector) DetectForms() ([]FormField, error) {
+func (d *JSFormDetector) DetectForms() ([]Form, error) {
 	// Create Chrome instance
-	ctx, cancel := chromedp.NewContext(context.Background())
+	ctx, cancel := newBrowserContext(d.resolve, d.insecure)
 	defer cancel()
 
 	// Add timeout
@@ -83,9 +148,13 @@ func (d *JSFormDetector) DetectForms() ([]FormField, error) {
 					// Default to current URL if no action specified
 					action = action || window.location.href;
 
+					// Forms submit with GET by default; script-driven
+					// containers usually post
+					const isForm = element.tagName.toLowerCase() === 'form';
 					return {
 						action: action,
-						method: element.getAttribute('method') || 'POST',
+						method: element.getAttribute('method') || (isForm ? 'GET' : 'POST'),
+						enctype: element.getAttribute('enctype') || '',
 						fields: fields
 					};
 				};
@@ -144,7 +213,12 @@ func (d *JSFormDetector) DetectForms() ([]FormField, error) {
 								element.getAttribute('aria-required') === 'true',
 						pattern: element.getAttribute('pattern') || 
 								element.getAttribute('data-pattern') ||
-								element.getAttribute('data-validation')
+								element.getAttribute('data-validation'),
+						min: element.getAttribute('min') || '',
+						max: element.getAttribute('max') || '',
+						step: element.getAttribute('step') || '',
+						minLength: parseInt(element.getAttribute('minlength'), 10) || 0,
+						maxLength: parseInt(element.getAttribute('maxlength'), 10) || 0
 					};
 				};
 
@@ -276,27 +350,54 @@ func (d *JSFormDetector) DetectForms() ([]FormField, error) {
 		`, &forms),
 	}
 
+	setup := []chromedp.Action{network.Enable()}
+	if len(d.headers) > 0 {
+		extra := make(network.Headers, len(d.headers))
+		for _, header := range d.headers {
+			extra[header[0]] = header[1]
+		}
+		setup = append(setup, network.SetExtraHTTPHeaders(extra))
+	}
+	actions = append(setup, actions...)
+	if err := d.MonitorNetworkActivity(ctx); err != nil {
+		return nil, err
+	}
+
 	// Execute actions
 	if err := chromedp.Run(ctx, actions...); err != nil {
 		return nil, fmt.Errorf("failed to execute actions: %v", err)
 	}
 
-	// Convert JS forms to FormField structs
-	var formFields []FormField
-	for _, form := range forms {
-		for _, field := range form.Fields {
+	page, err := url.Parse(d.url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert JS forms to Form structs
+	var result []Form
+	for _, jsForm := range forms {
+		form := newForm(jsForm.Action, jsForm.Method, jsForm.Enctype, page)
+		for _, field := range jsForm.Fields {
 			if field.Name != "" { // Only include fields with names
-				formFields = append(formFields, FormField{
-					Name:     field.Name,
-					Type:     field.Type,
-					Required: field.Required,
-					Pattern:  field.Pattern,
+				form.Fields = append(form.Fields, FormField{
+					Name:      field.Name,
+					Type:      field.Type,
+					Required:  field.Required,
+					Pattern:   field.Pattern,
+					Min:       field.Min,
+					Max:       field.Max,
+					Step:      field.Step,
+					MinLength: field.MinLength,
+					MaxLength: field.MaxLength,
 				})
 			}
 		}
+		if len(form.Fields) > 0 {
+			result = append(result, form)
+		}
 	}
 
-	return formFields, nil
+	return result, nil
 }
 
 // WaitForDynamicContent waits for dynamic content to load
@@ -332,7 +433,7 @@ func (d *JSFormDetector) WaitForDynamicContent(ctx context.Context) error {
 	for _, selector := range selectors {
 		// Try to wait for element to be visible
 		if err := chromedp.Run(ctx, chromedp.WaitVisible(selector, chromedp.ByQuery)); err == nil {
-			log.Printf("Found dynamic content: %s\n", selector)
+			logging.For("jsform").Debug("found dynamic content", "url", d.url, "selector", selector)
 			return nil
 		}
 	}
@@ -340,17 +441,30 @@ func (d *JSFormDetector) WaitForDynamicContent(ctx context.Context) error {
 	return nil
 }
 
-// MonitorNetworkActivity monitors XHR/fetch requests
+// MonitorNetworkActivity records the XHR and fetch requests the page sends,
+// which Requests returns
 func (d *JSFormDetector) MonitorNetworkActivity(ctx context.Context) error {
 	// Listen for network events
 	chromedp.ListenTarget(ctx, func(ev interface{}) {
 		switch e := ev.(type) {
 		case *network.EventRequestWillBeSent:
-			if e.Request.Method == "POST" {
-				log.Printf("Detected form submission to: %s\n", e.Request.URL)
+			if e.Type != network.ResourceTypeXHR && e.Type != network.ResourceTypeFetch {
+				return
 			}
+			logging.For("jsform").Debug("detected script request", "method", e.Request.Method, "url", e.Request.URL)
+			d.requestsLock.Lock()
+			d.requests = append(d.requests, JSRequest{Method: e.Request.Method, URL: e.Request.URL})
+			d.requestsLock.Unlock()
 		}
 	})
 
 	return nil
 }
+
+// Requests returns the XHR and fetch requests the page sent while its forms
+// were detected
+func (d *JSFormDetector) Requests() []JSRequest {
+	d.requestsLock.Lock()
+	defer d.requestsLock.Unlock()
+	return append([]JSRequest(nil), d.requests...)
+}
@@ -0,0 +1,137 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonStringPayloads are attack strings offered wherever the schema has a
+// string, already quoted and escaped so the document stays valid JSON
+var jsonStringPayloads = []string{
+	"<script>alert(1)</script>",
+	"'; DROP TABLE users; --",
+	"../../../etc/passwd",
+	"{{7*7}}",
+	"\u0000dangerous",
+	"🦊⚡️🌟",
+}
+
+// jsonBaseGrammar holds the rules for scalar JSON values shared by all
+// schema grammars
+var jsonBaseGrammar = Grammar{
+	"<json-integer>": {"0", "<json-natural>", "-<json-natural>", "2147483648", "-9007199254740993"},
+	"<json-natural>": {"<json-nonzero>", "<json-nonzero><json-digits>"},
+	"<json-nonzero>": {"1", "2", "3", "4", "5", "6", "7", "8", "9"},
+	"<json-number>":  {"<json-integer>.<json-digits>", "-0.0", "1e308", "<json-natural>e-<json-digits>"},
+	"<json-boolean>": {"true", "false"},
+	"<json-any>":     {"null", "0", "\"\"", "true", "{}", "[]"},
+	"<json-digits>":  {"<json-digit>", "<json-digit><json-digits>"},
+	"<json-digit>":   {"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"},
+	"<json-chars>":   {"<json-char>", "<json-char><json-chars>"},
+	"<json-char>":    {"a", "b", "c", "x", "y", "z", "A", "Z", "0", "1", "9", " ", "-", "_", "."},
+	"<json-word>":    {"<json-letter>", "<json-letter><json-word>"},
+	"<json-letter>":  {"a", "b", "c", "d", "e", "m", "s", "t", "x", "z"},
+	"<json-email>":   {"\"<json-word>@<json-word>.com\""},
+	"<json-date>":    {"\"20<json-digit><json-digit>-<json-month>-<json-day>\""},
+	"<json-month>":   {"01", "02", "06", "09", "10", "12"},
+	"<json-day>":     {"01", "09", "10", "19", "28", "30", "31"},
+}
+
+// schemaGrammar builds a grammar whose <start> derives JSON documents shaped
+// like a schema from inferJSONSchema: the same keys, value types and nesting,
+// with arrays of varying length and values drawn from typed rules
+func schemaGrammar(schema map[string]interface{}) Grammar {
+	grammar := make(Grammar)
+	for symbol, alternatives := range jsonBaseGrammar {
+		grammar[symbol] = alternatives
+	}
+
+	strs := []string{"\"<json-chars>\"", "\"\""}
+	for _, payload := range jsonStringPayloads {
+		quoted, _ := json.Marshal(payload)
+		strs = append(strs, string(quoted))
+	}
+	grammar["<json-string>"] = strs
+
+	b := &schemaGrammarBuilder{grammar: grammar}
+	grammar["<start>"] = []string{b.value(schema)}
+	return grammar
+}
+
+// schemaGrammarBuilder turns schema nodes into grammar rules
+type schemaGrammarBuilder struct {
+	grammar Grammar
+	next    int
+}
+
+// value returns the expansion deriving values of a schema node
+func (b *schemaGrammarBuilder) value(schema map[string]interface{}) string {
+	// Declared enum values are offered next to other values of their type
+	if values, ok := schema["enum"].([]interface{}); ok && len(values) > 0 {
+		var alternatives []string
+		for _, value := range values {
+			encoded, _ := json.Marshal(value)
+			alternatives = append(alternatives, string(encoded))
+		}
+		typed := make(map[string]interface{}, len(schema))
+		for key, value := range schema {
+			if key != "enum" {
+				typed[key] = value
+			}
+		}
+		return b.define("enum", append(alternatives, b.value(typed)))
+	}
+
+	kind, _ := schema["type"].(string)
+	switch kind {
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		var members []string
+		for _, key := range sortedKeys(properties) {
+			property, _ := properties[key].(map[string]interface{})
+			name, _ := json.Marshal(key)
+			members = append(members, string(name)+":"+b.value(property))
+		}
+		return b.define("object", []string{"{" + strings.Join(members, ",") + "}"})
+
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		item := b.value(items)
+
+		// <items> ::= item | item,<items>
+		list := b.newSymbol("items")
+		b.grammar[list] = []string{item, item + "," + list}
+		return b.define("array", []string{"[]", "[" + list + "]"})
+
+	case "string":
+		switch schema["format"] {
+		case "email":
+			return "<json-email>"
+		case "date":
+			return "<json-date>"
+		}
+		return "<json-string>"
+
+	case "integer":
+		return "<json-integer>"
+	case "number":
+		return "<json-number>"
+	case "boolean":
+		return "<json-boolean>"
+	}
+	return "<json-any>"
+}
+
+// define adds a rule with the given alternatives and returns its symbol
+func (b *schemaGrammarBuilder) define(kind string, alternatives []string) string {
+	symbol := b.newSymbol(kind)
+	b.grammar[symbol] = alternatives
+	return symbol
+}
+
+// newSymbol returns a fresh symbol name for a schema node
+func (b *schemaGrammarBuilder) newSymbol(kind string) string {
+	b.next++
+	return fmt.Sprintf("<json-%s-%d>", kind, b.next)
+}
@@ -0,0 +1,158 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// languagePack probes one query language a parameter may be pasted into:
+// values breaking its syntax, whose parser errors are recognized, and
+// conditions only that language evaluates, each in an always true and an
+// always false form that must flip the response
+type languagePack struct {
+	kind     string         // Finding type
+	language string         // Shown in evidence
+	errors   *regexp.Regexp // Parser and engine errors
+	breakers []string       // Appended to the original value
+	pairs    [][2]string    // True and false conditions; %s is a canary matching nothing
+}
+
+// ldapPack finds input pasted into LDAP search filters such as
+// (&(uid=INPUT)(userPassword=...)). The conditions close the attribute and
+// add an objectClass test, which only an LDAP filter evaluates; a bare
+// wildcard comes last, as other query languages match it too.
+var ldapPack = &languagePack{
+	kind:     "ldap-injection",
+	language: "LDAP filter",
+	errors: regexp.MustCompile(`(?i)(InvalidSearchFilterException|Bad search filter|LDAPException|com\.sun\.jndi\.ldap|` +
+		`ldap_search\(|supplied argument is not a valid ldap|Invalid DN syntax|LDAP: error code|System\.DirectoryServices|` +
+		`Novell\.Directory\.Ldap|unbalanced parenthes[ie]s in (search )?filter)`),
+	breakers: []string{"*)(", ")", "\\", "*)(|(objectClass=*"},
+	pairs: [][2]string{
+		{"*)(objectClass=*", "*)(objectClass=%s"},
+		{"*)(|(objectClass=*)", "*)(|(objectClass=%s)"},
+		{"*", "%s*"},
+	},
+}
+
+// xpathPack finds input pasted into XPath string literals such as
+// //user[name='INPUT']. The conditions test count(/*), which is 1 in every
+// XML document and is a syntax error to SQL, so SQL injection does not flip
+// them.
+var xpathPack = &languagePack{
+	kind:     "xpath-injection",
+	language: "XPath",
+	errors: regexp.MustCompile(`(?i)(XPathException|XPathEvalError|XPathExpressionException|javax\.xml\.xpath|System\.Xml\.XPath|` +
+		`SimpleXMLElement::xpath|DOMXPath::(query|evaluate)|xmlXPathEval|XPST0003|org\.apache\.xpath|Invalid predicate|` +
+		`Unterminated string literal|Expected token ']')`),
+	breakers: []string{"'", "\"", "']", "\")]"},
+	pairs: [][2]string{
+		{"%s' or count(/*)=1 or 'a'='b", "%s' or count(/*)=2 or 'a'='b"},
+		{`%s" or count(/*)=1 or "a"="b`, `%s" or count(/*)=2 or "a"="b`},
+	},
+}
+
+// probeLanguage injects a language's syntax breakers and conditions into one
+// query parameter. A condition is reported when its true form changes the
+// response and its false form is answered like an ordinary value; otherwise
+// an error of the language's parser that the ordinary value does not cause
+// is reported.
+func probeLanguage(client *http.Client, config *Config, rng *rand.Rand, pack *languagePack, targetURL, param string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	original := parsed.Query().Get(param)
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	send := func(value string) (*probeResponse, error) {
+		u := *parsed
+		query := u.Query()
+		query.Set(param, value)
+		u.RawQuery = query.Encode()
+		req, resp, body, _, err := timedGet(client, config, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &probeResponse{req: req, resp: resp, body: body}, nil
+	}
+
+	canary := fmt.Sprintf("gfl%08x", rng.Uint32())
+	baseline, err := send(canary)
+	if err != nil {
+		return nil, err
+	}
+	// A response that changes on every request cannot be diffed
+	again, err := send(canary)
+	if err != nil {
+		return nil, err
+	}
+	if baseline.like(again) {
+		for _, pair := range pack.pairs {
+			if expired() {
+				return nil, nil
+			}
+			truthyValue := strings.ReplaceAll(pair[0], "%s", canary)
+			falsyValue := strings.ReplaceAll(pair[1], "%s", canary)
+			truthy, err := send(truthyValue)
+			if err != nil {
+				continue
+			}
+			falsy, err := send(falsyValue)
+			if err != nil || !booleanConfirmed(baseline, truthy, falsy) {
+				continue
+			}
+			repeated, err := send(truthyValue)
+			if err != nil || !repeated.like(truthy) {
+				continue
+			}
+			finding := &Finding{
+				Type:       pack.kind,
+				Severity:   SeverityHigh,
+				Confidence: ConfidenceFirm,
+				URL:        truthy.req.URL.String(),
+				Method:     truthy.req.Method,
+				Parameter:  param,
+				Payload:    truthyValue,
+				Evidence: fmt.Sprintf("%s condition %q is answered with %s, unlike a value matching nothing and %q (%s)",
+					pack.language, truthyValue, truthy, falsyValue, baseline),
+			}
+			captureExchange(finding, truthy.req, nil, truthy.resp, truthy.body)
+			return finding, nil
+		}
+	}
+
+	if pack.errors.Match(baseline.body) {
+		return nil, nil
+	}
+	for _, breaker := range pack.breakers {
+		if expired() {
+			return nil, nil
+		}
+		probe, err := send(original + breaker)
+		if err != nil {
+			continue
+		}
+		if signature := pack.errors.FindString(string(probe.body)); signature != "" {
+			finding := &Finding{
+				Type:       pack.kind,
+				Severity:   SeverityMedium,
+				Confidence: ConfidenceFirm,
+				URL:        probe.req.URL.String(),
+				Method:     probe.req.Method,
+				Parameter:  param,
+				Payload:    original + breaker,
+				Evidence:   fmt.Sprintf("%s error in response: %q", pack.language, signature),
+			}
+			captureExchange(finding, probe.req, nil, probe.resp, probe.body)
+			return finding, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,184 @@
+package fuzzer
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maxLeakMatches bounds the matches of one rule reported per response
+const maxLeakMatches = 5
+
+// LeakRule recognizes one kind of secret or personal data in a response
+type LeakRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Exclude *regexp.Regexp // Matches of Pattern that are not leaks, such as asset names; nil for none
+}
+
+// leakExclusions are the matches of default rules that are not leaks:
+// asset names such as logo@2x.png look like email addresses, with a file
+// extension for a top-level domain
+var leakExclusions = map[string]string{
+	"email": `(?i)\.(png|jpe?g|gif|svg|webp|avif|ico|bmp|tiff?|css|js|mjs|map|json|xml|txt|pdf|zip|gz|woff2?|ttf|eot|otf|mp[34]|webm|mov)$`,
+}
+
+// DefaultLeakRules are the rules a LeakScanner starts with
+func DefaultLeakRules() []*LeakRule {
+	rules := []struct{ name, pattern string }{
+		{"aws-access-key-id", `\b(AKIA|ASIA)[0-9A-Z]{16}\b`},
+		{"aws-secret-access-key", `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+]{40}\b`},
+		{"google-api-key", `\bAIza[0-9A-Za-z_-]{35}\b`},
+		{"github-token", `\bgh[pousr]_[A-Za-z0-9]{36}\b`},
+		{"slack-token", `\bxox[abprs]-[0-9A-Za-z-]{10,}`},
+		{"jwt", `\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`},
+		{"private-key", `-----BEGIN (RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY( BLOCK)?-----`},
+		{"email", `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,24}\b`},
+		{"internal-ip", `\b(10\.\d{1,3}\.\d{1,3}\.\d{1,3}|172\.(1[6-9]|2\d|3[01])\.\d{1,3}\.\d{1,3}|192\.168\.\d{1,3}\.\d{1,3})\b`},
+		{"stack-trace-path", `at [\w$.<>]+\([\w$]+\.(java|kt|scala):\d+\)|File "[^"\n]+\.py", line \d+|` +
+			`(/[\w.-]+)+\.(php|rb|go|js|ts|cs|java):\d+|[A-Za-z]:\\[^\s:*?"<>|]+\.(cs|vb|php|aspx?):line \d+`},
+	}
+	var parsed []*LeakRule
+	for _, rule := range rules {
+		parsed = append(parsed, &LeakRule{Name: rule.name, Pattern: regexp.MustCompile(rule.pattern)})
+		if exclude, ok := leakExclusions[rule.name]; ok {
+			parsed[len(parsed)-1].Exclude = regexp.MustCompile(exclude)
+		}
+	}
+	return parsed
+}
+
+// LeakScanner looks for secrets and personal data in response bodies: keys,
+// tokens, email addresses, internal addresses and stack traces naming source
+// files. Each distinct match is reported once per run as an informational
+// finding, however many pages show it. A nil scanner finds nothing. It is
+// safe for concurrent use.
+type LeakScanner struct {
+	mu       sync.Mutex
+	rules    []*LeakRule
+	reported map[string]bool // rule name and match already reported
+}
+
+// NewLeakScanner creates a scanner with the default rules
+func NewLeakScanner() *LeakScanner {
+	return &LeakScanner{
+		rules:    DefaultLeakRules(),
+		reported: make(map[string]bool),
+	}
+}
+
+// Clone returns a scanner with the same rules that has reported nothing yet
+func (s *LeakScanner) Clone() *LeakScanner {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &LeakScanner{
+		rules:    s.rules,
+		reported: make(map[string]bool),
+	}
+}
+
+// AddRule adds a rule, replacing any rule of the same name. A rule without a
+// pattern removes the rule of that name.
+func (s *LeakScanner) AddRule(rule *LeakRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var kept []*LeakRule
+	for _, existing := range s.rules {
+		if existing.Name != rule.Name {
+			kept = append(kept, existing)
+		}
+	}
+	if rule.Pattern != nil {
+		kept = append(kept, rule)
+	}
+	s.rules = kept
+}
+
+// LoadRules reads name=regex lines and adds them with AddRule. Blank lines
+// and lines starting with # are skipped; "name=" alone removes a rule.
+func (s *LeakScanner) LoadRules(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open leak rules: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("%s: line %d: expected name=regex", path, line)
+		}
+		rule := &LeakRule{Name: name}
+		if expr != "" {
+			if rule.Pattern, err = regexp.Compile(expr); err != nil {
+				return fmt.Errorf("%s: line %d: invalid regex: %v", path, line, err)
+			}
+		}
+		s.AddRule(rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read leak rules: %v", err)
+	}
+	return nil
+}
+
+// Scan returns a finding for every match in body not reported before. Text
+// that is part of the payload is the target echoing the request back and is
+// skipped.
+func (s *LeakScanner) Scan(req *http.Request, body []byte, payload string) []*Finding {
+	if s == nil || len(body) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	rules := s.rules
+	s.mu.Unlock()
+
+	var findings []*Finding
+	for _, rule := range rules {
+		for _, match := range rule.Pattern.FindAll(body, maxLeakMatches) {
+			value := string(match)
+			if payload != "" && strings.Contains(payload, value) || rule.Exclude != nil && rule.Exclude.MatchString(value) {
+				continue
+			}
+			if !s.firstReport(rule.Name + "|" + value) {
+				continue
+			}
+			findings = append(findings, &Finding{
+				Type:       "sensitive-data",
+				Severity:   SeverityInfo,
+				Confidence: ConfidenceFirm,
+				URL:        req.URL.String(),
+				Method:     req.Method,
+				Parameter:  rule.Name,
+				Evidence:   fmt.Sprintf("%s in response: %s", rule.Name, value),
+			})
+		}
+	}
+	return findings
+}
+
+// firstReport records a match and reports whether it is new
+func (s *LeakScanner) firstReport(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reported[key] {
+		return false
+	}
+	s.reported[key] = true
+	return true
+}
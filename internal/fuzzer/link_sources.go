@@ -0,0 +1,245 @@
+package fuzzer
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/html"
+)
+
+// maxHarvestedAssets bounds the scripts and stylesheets fetched in a crawl
+// to harvest the URLs they hold
+const maxHarvestedAssets = 50
+
+// linkSources maps the elements leading to other pages to the attribute
+// holding the reference
+var linkSources = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"iframe": "src",
+	"frame":  "src",
+	"form":   "action",
+}
+
+// scriptURLs match URLs and paths quoted in scripts: absolute and
+// protocol-relative URLs, and paths starting with /, ./ or ../
+var scriptURLs = regexp.MustCompile("[\"'`]((?:https?:)?//[^\\s\"'`<>\\\\]+|\\.{0,2}/[\\w\\-.~%]+(?:/[\\w\\-.~%]*)*(?:\\?[^\\s\"'`<>\\\\]*)?)[\"'`]")
+
+// styleURLs match the url() and @import references of stylesheets
+var styleURLs = regexp.MustCompile(`(?i)(?:url\(\s*['"]?|@import\s+['"])([^'")\s]+)`)
+
+// textURLs match absolute URLs and root-relative paths in free text, such as
+// a comment noting an old page
+var textURLs = regexp.MustCompile(`https?://[^\s"'<>]+|(?:^|\s)(/[\w\-.~%]+(?:/[^\s"'<>]*)?)`)
+
+// staticExtensions are the extensions of files that are no pages to crawl
+var staticExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".map": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".svg": true, ".ico": true, ".webp": true, ".bmp": true, ".woff": true, ".woff2": true,
+	".ttf": true, ".eot": true, ".otf": true, ".mp3": true, ".mp4": true, ".webm": true, ".ogg": true,
+}
+
+// documentBase returns the URL a page's relative links resolve against: its
+// <base href>, else the page's own URL
+func (c *WebCrawler) documentBase(node *html.Node, pageURL string) *url.URL {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return c.baseURL
+	}
+	var base *url.URL
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if base != nil {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "base" {
+			if href := attrValue(n, "href"); href != "" {
+				if ref, err := url.Parse(href); err == nil {
+					base = page.ResolveReference(ref)
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			find(child)
+		}
+	}
+	find(node)
+	if base == nil {
+		return page
+	}
+	return base
+}
+
+// extractLinks extracts the links of a page, resolved against base: anchors,
+// image map areas, frames, form actions and meta refresh targets, and the
+// URLs quoted in inline scripts or written in comments, including markup
+// commented out. Links to static files found in scripts and comments are
+// left out, as are repeats.
+func (c *WebCrawler) extractLinks(node *html.Node, base *url.URL) []string {
+	var links []string
+	seen := make(map[string]bool)
+	add := func(href string, mined bool) {
+		link := c.resolveURL(base, href)
+		if link == "" || seen[link] || (mined && staticFile(link)) {
+			return
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+
+	var extract func(*html.Node)
+	extract = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			if key, ok := linkSources[n.Data]; ok {
+				if href := attrValue(n, key); href != "" {
+					add(href, false)
+				}
+			}
+			if n.Data == "meta" && strings.EqualFold(attrValue(n, "http-equiv"), "refresh") {
+				if target := metaRefreshURL(attrValue(n, "content")); target != "" {
+					add(target, false)
+				}
+			}
+			if n.Data == "script" {
+				for child := n.FirstChild; child != nil; child = child.NextSibling {
+					if child.Type == html.TextNode {
+						for _, href := range scriptLinks(child.Data) {
+							add(href, true)
+						}
+					}
+				}
+			}
+		case html.CommentNode:
+			if fragment, err := html.Parse(strings.NewReader(n.Data)); err == nil {
+				for _, link := range c.extractLinks(fragment, base) {
+					add(link, true)
+				}
+			}
+			for _, href := range textLinks(n.Data) {
+				add(href, true)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			extract(child)
+		}
+	}
+	extract(node)
+
+	return links
+}
+
+// metaRefreshURL returns the target of a meta refresh's content, such as
+// "5; url=/next", or "" when it only reloads the page
+func metaRefreshURL(content string) string {
+	_, target, found := strings.Cut(content, ";")
+	if !found {
+		return ""
+	}
+	target = strings.TrimSpace(target)
+	if len(target) < 4 || !strings.EqualFold(target[:4], "url=") {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(target[4:]), `'"`)
+}
+
+// scriptLinks returns the URLs and paths quoted in script source
+func scriptLinks(source string) []string {
+	var links []string
+	for _, match := range scriptURLs.FindAllStringSubmatch(source, -1) {
+		links = append(links, match[1])
+	}
+	return links
+}
+
+// styleLinks returns the URLs a stylesheet references
+func styleLinks(source string) []string {
+	var links []string
+	for _, match := range styleURLs.FindAllStringSubmatch(source, -1) {
+		if !strings.HasPrefix(match[1], "data:") {
+			links = append(links, match[1])
+		}
+	}
+	return links
+}
+
+// textLinks returns the absolute URLs and root-relative paths in free text
+func textLinks(text string) []string {
+	var links []string
+	for _, match := range textURLs.FindAllStringSubmatch(text, -1) {
+		if match[1] != "" {
+			links = append(links, match[1])
+		} else {
+			links = append(links, strings.TrimSpace(match[0]))
+		}
+	}
+	return links
+}
+
+// staticFile reports whether a URL names a static file rather than a page
+func staticFile(link string) bool {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return staticExtensions[strings.ToLower(path.Ext(parsed.Path))]
+}
+
+// harvestAssets fetches the same-host scripts and stylesheets among assets,
+// up to maxHarvestedAssets in a crawl, and returns the links they hold:
+// URLs and paths quoted in scripts, and stylesheet references to anything
+// but static files, which are recorded as assets instead
+func (c *WebCrawler) harvestAssets(assets []string) []string {
+	var links []string
+	for _, asset := range assets {
+		parsed, err := url.Parse(asset)
+		if err != nil || !c.isSameHost(asset) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(parsed.Path))
+		if ext != ".js" && ext != ".mjs" && ext != ".css" {
+			continue
+		}
+		if atomic.AddInt32(&c.harvested, 1) > maxHarvestedAssets {
+			return links
+		}
+		select {
+		case <-c.stopCrawl:
+			return links
+		default:
+		}
+
+		resp, err := c.client.Get(asset)
+		if err != nil {
+			c.logger.Debug("asset fetch failed", "url", asset, "error", err)
+			continue
+		}
+		body, err := readLimited(resp.Body, maxBodySize(c.config))
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		found := scriptLinks(string(body.data))
+		if ext == ".css" {
+			found = styleLinks(string(body.data))
+		}
+		var static []string
+		for _, href := range found {
+			link := c.resolveURL(parsed, href)
+			switch {
+			case link == "":
+			case staticFile(link):
+				static = append(static, link)
+			default:
+				links = append(links, link)
+			}
+		}
+		c.addAssets(static)
+	}
+	return links
+}
@@ -0,0 +1,185 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// lockoutAttempts is how many failed logins are sent; lockout policies
+	// commonly kick in after 3 to 10
+	lockoutAttempts = 25
+
+	// lockoutMinDelay and lockoutSlowdown are how much slower than the first
+	// failed login a later one must be to count as a progressive delay
+	lockoutMinDelay = 2 * time.Second
+	lockoutSlowdown = 3
+)
+
+// lockoutSignatures are messages of lockout, throttling and CAPTCHA
+// challenges on login pages
+var lockoutSignatures = regexp.MustCompile(`(?i)(too many|locked|lock ?out|temporarily (disabled|blocked|suspended)|` +
+	`try again (later|in)|rate.?limit|captcha|recaptcha|hcaptcha|account (is )?(suspended|disabled)|attempts? (remaining|left|exceeded))`)
+
+// userFieldNames recognize the account field of a login form
+var userFieldNames = regexp.MustCompile(`(?i)user|login|email|mail|account|name|ident`)
+
+// loginFields returns the account and password fields of a login form, or
+// false when the form has no password field
+func loginFields(fields map[string]FormField) (string, string, bool) {
+	var password string
+	for _, name := range sortedKeys(fields) {
+		if fields[name].Type == "password" {
+			password = name
+			break
+		}
+	}
+	return accountField(fields), password, password != ""
+}
+
+// accountField returns the field of a form naming an account: an email
+// field, else a text field named like one, else the first text field
+func accountField(fields map[string]FormField) string {
+	var named, fallback string
+	for _, name := range sortedKeys(fields) {
+		switch fields[name].Type {
+		case "email":
+			return name
+		case "text", "":
+			if named == "" && userFieldNames.MatchString(name) {
+				named = name
+			}
+			if fallback == "" {
+				fallback = name
+			}
+		}
+	}
+	if named != "" {
+		return named
+	}
+	return fallback
+}
+
+// testLockout sends a fixed series of failed logins for one account to a
+// login form, the same submission each time but for a made-up password that
+// cannot be right, and reports when none of them is throttled: no 429 or
+// 423, no Retry-After, no lockout or CAPTCHA message, no change of the
+// failure response and no growing delay. The account is LoginUser, or a made-up one. When
+// LoginPassword is set too, the account logs in once before and once after
+// the series, and still getting in afterwards makes the finding certain.
+// It only runs with AllowBruteForce set, as a real account may get locked.
+func (f *WebFormFuzzer) testLockout(client *http.Client) {
+	if !f.config.AllowBruteForce {
+		f.logger.Warn("login lockout testing needs AllowBruteForce, skipping")
+		return
+	}
+	userField, passwordField, ok := loginFields(f.fields)
+	if !ok {
+		return
+	}
+	user := f.config.LoginUser
+	if user == "" {
+		user = fmt.Sprintf("gofuzz-%08x", f.rng.Uint32())
+	}
+	// Every login sends the same submission but for the password, so a
+	// changed answer comes from the attempts and not from another field
+	base := f.nextInput()
+	if f.defaults != nil {
+		base = omitParams(withParams(base, f.defaults), f.unchecked)
+	}
+	login := func(password string) (*probeResponse, time.Duration, error) {
+		set := map[string]string{passwordField: password}
+		if userField != "" {
+			set[userField] = user
+		}
+		return f.timedSubmission(client, base, set)
+	}
+
+	var accepted *probeResponse
+	if f.config.LoginPassword != "" {
+		var err error
+		if accepted, _, err = login(f.config.LoginPassword); err != nil {
+			f.logger.Debug("login with the configured password failed", "error", err)
+			return
+		}
+	}
+
+	var first *probeResponse
+	var baseline time.Duration
+	var last *probeResponse
+	for i := 1; i <= lockoutAttempts; i++ {
+		if f.expired() {
+			return
+		}
+		password := fmt.Sprintf("gofuzz-wrong-%d-%08x", i, f.rng.Uint32())
+		probe, elapsed, err := login(password)
+		if err != nil {
+			f.logger.Debug("failed login not answered", "attempt", i, "error", err)
+			return
+		}
+		if first == nil {
+			first, baseline = probe, elapsed
+			if accepted != nil && probe.like(accepted) {
+				f.logger.Debug("failed and accepted logins look alike, skipping")
+				return
+			}
+			continue
+		}
+		if reason := lockoutSignal(first, probe, elapsed, baseline); reason != "" {
+			f.logger.Info("login throttled", "attempt", i, "signal", reason)
+			return
+		}
+		last = probe
+	}
+	if last == nil {
+		return
+	}
+
+	finding := &Finding{
+		Type:       "no-login-lockout",
+		Severity:   SeverityMedium,
+		Confidence: ConfidenceFirm,
+		URL:        f.formURL,
+		Method:     last.req.Method,
+		Parameter:  passwordField,
+		Payload:    fmt.Sprintf("%d failed logins for %q", lockoutAttempts, user),
+		Evidence: fmt.Sprintf("%d failed logins in a row were all answered like the first (%s): no lockout, "+
+			"throttling, CAPTCHA or growing delay, so passwords can be guessed without limit", lockoutAttempts, last),
+	}
+	if accepted != nil {
+		again, _, err := login(f.config.LoginPassword)
+		if err == nil && again.like(accepted) {
+			finding.Confidence = ConfidenceCertain
+			finding.Evidence += "; the correct password still logs in afterwards"
+		} else if err == nil {
+			finding.Evidence += fmt.Sprintf("; the correct password is answered differently afterwards (%s), "+
+				"which may be a silent lockout", again)
+			finding.Confidence = ConfidenceTentative
+		}
+	}
+	captureExchange(finding, last.req, last.reqBody, last.resp, last.body)
+	if f.config.Findings.Add(finding) {
+		f.logger.Warn("no login lockout", "evidence", finding.Evidence)
+	}
+}
+
+// lockoutSignal returns why a failed login looks throttled next to the
+// first one, or "" when it does not
+func lockoutSignal(first, probe *probeResponse, elapsed, baseline time.Duration) string {
+	switch {
+	case probe.resp.StatusCode == http.StatusTooManyRequests || probe.resp.StatusCode == http.StatusLocked:
+		return fmt.Sprintf("HTTP %d", probe.resp.StatusCode)
+	case probe.resp.Header.Get("Retry-After") != "":
+		return "Retry-After: " + probe.resp.Header.Get("Retry-After")
+	case lockoutSignatures.Match(probe.body) && !lockoutSignatures.Match(first.body):
+		return fmt.Sprintf("message %q", strings.TrimSpace(string(lockoutSignatures.Find(probe.body))))
+	case !probe.like(first):
+		return fmt.Sprintf("response changed from %s to %s", first, probe)
+	case elapsed >= baseline+lockoutMinDelay && elapsed >= lockoutSlowdown*baseline:
+		return fmt.Sprintf("answered in %s against %s", elapsed.Round(time.Millisecond), baseline.Round(time.Millisecond))
+	}
+	return ""
+}
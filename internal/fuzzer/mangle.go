@@ -0,0 +1,329 @@
+package fuzzer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Built-in rule sets, given to -rules by name
+var mangleRuleSets = map[string][]string{
+	// Backup and temporary copies editors and admins leave behind
+	"backup": {":", "$~", "$.$b$a$k", "$.$o$l$d", "$.$o$r$i$g", "$.$s$w$p", "$.$t$m$p", "$.$s$a$v$e",
+		"$.$1", "$_$b$a$c$k$u$p", "$.$z$i$p", "^."},
+	// Case variants
+	"case": {":", "l", "u", "c", "t"},
+	// Parameter name variants: ID suffixes, plurals and array syntax
+	"params": {":", "$_$i$d", "$I$d", "$s", "$_$i$d$s", "$[$]", "^_", "c"},
+	// Years appended, the current one and the four before it
+	"years": yearRules(5),
+}
+
+// yearRules appends each of the last n years, the current one first
+func yearRules(n int) []string {
+	rules := []string{":"}
+	for year := time.Now().Year(); len(rules) <= n; year-- {
+		rule := make([]string, 0, 4)
+		for _, digit := range fmt.Sprint(year) {
+			rule = append(rule, "$"+string(digit))
+		}
+		rules = append(rules, strings.Join(rule, ""))
+	}
+	return rules
+}
+
+// LoadMangleRules resolves a -rules value: comma-separated names of built-in
+// rule sets (backup, case, params, years) or paths of rule files, one rule
+// per line with blank lines and lines starting with # skipped. Rules are
+// checked here so a typo fails before any request is sent.
+func LoadMangleRules(spec string) ([]string, error) {
+	var rules []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if set, ok := mangleRuleSets[name]; ok {
+			rules = append(rules, set...)
+			continue
+		}
+		fileRules, err := loadRuleFile(name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("unknown rule set %q: expected one of %s or a rule file",
+					name, strings.Join(sortedKeys(mangleRuleSets), ", "))
+			}
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+	// Sets share rules, ":" above all, which would send words twice
+	var unique []string
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if _, err := parseMangleRule(rule); err != nil {
+			return nil, err
+		}
+		if !seen[rule] {
+			seen[rule] = true
+			unique = append(unique, rule)
+		}
+	}
+	return unique, nil
+}
+
+// loadRuleFile reads a hashcat rule file
+func loadRuleFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text != "" && !strings.HasPrefix(text, "#") {
+			rules = append(rules, text)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %v", err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules", path)
+	}
+	return rules, nil
+}
+
+// mangleRule is a parsed rule, its functions applied left to right
+type mangleRule []func(word string) string
+
+// parseMangleRule parses a rule in hashcat syntax. Functions may be
+// separated by spaces. Supported are : l u c C t TN r d f { } $X ^X [ ] DN
+// 'N iNX oNX sXY and @X, positions N being 0-9 then A-Z.
+func parseMangleRule(rule string) (mangleRule, error) {
+	var parsed mangleRule
+	for i := 0; i < len(rule); {
+		fn := rule[i]
+		i++
+		if fn == ' ' {
+			continue
+		}
+		// Arguments of the function: positions and characters
+		args, ok := ruleArgs[fn]
+		if !ok {
+			return nil, fmt.Errorf("rule %q: unknown function %q", rule, fn)
+		}
+		if i+len(args) > len(rule) {
+			return nil, fmt.Errorf("rule %q: function %q needs %d argument(s)", rule, fn, len(args))
+		}
+		var n int
+		var chars []byte
+		for j, kind := range args {
+			arg := rule[i+j]
+			if kind == 'N' {
+				if n = rulePosition(arg); n < 0 {
+					return nil, fmt.Errorf("rule %q: invalid position %q", rule, arg)
+				}
+			} else {
+				chars = append(chars, arg)
+			}
+		}
+		i += len(args)
+		parsed = append(parsed, ruleFunction(fn, n, chars))
+	}
+	return parsed, nil
+}
+
+// ruleArgs are the arguments each function takes, N for a position and X
+// for a character
+var ruleArgs = map[byte]string{
+	':': "", 'l': "", 'u': "", 'c': "", 'C': "", 't': "", 'r': "", 'd': "", 'f': "", '{': "", '}': "",
+	'[': "", ']': "", 'T': "N", 'D': "N", '\'': "N", '$': "X", '^': "X", '@': "X",
+	'i': "NX", 'o': "NX", 's': "XX",
+}
+
+// rulePosition decodes a position, 0-9 then A-Z for 10-35, or returns -1
+func rulePosition(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// ruleFunction returns the function fn with its position and characters
+func ruleFunction(fn byte, n int, chars []byte) func(string) string {
+	switch fn {
+	case 'l':
+		return strings.ToLower
+	case 'u':
+		return strings.ToUpper
+	case 'c':
+		return func(w string) string { return capitalize(strings.ToLower(w)) }
+	case 'C':
+		return func(w string) string {
+			if w == "" {
+				return w
+			}
+			return strings.ToLower(w[:1]) + strings.ToUpper(w[1:])
+		}
+	case 't':
+		return func(w string) string { return strings.Map(toggleCase, w) }
+	case 'T':
+		return func(w string) string {
+			if n >= len(w) {
+				return w
+			}
+			return w[:n] + strings.Map(toggleCase, w[n:n+1]) + w[n+1:]
+		}
+	case 'r':
+		return reverse
+	case 'd':
+		return func(w string) string { return w + w }
+	case 'f':
+		return func(w string) string { return w + reverse(w) }
+	case '{':
+		return func(w string) string {
+			if w == "" {
+				return w
+			}
+			return w[1:] + w[:1]
+		}
+	case '}':
+		return func(w string) string {
+			if w == "" {
+				return w
+			}
+			return w[len(w)-1:] + w[:len(w)-1]
+		}
+	case '[':
+		return func(w string) string {
+			if w == "" {
+				return w
+			}
+			return w[1:]
+		}
+	case ']':
+		return func(w string) string {
+			if w == "" {
+				return w
+			}
+			return w[:len(w)-1]
+		}
+	case 'D':
+		return func(w string) string {
+			if n >= len(w) {
+				return w
+			}
+			return w[:n] + w[n+1:]
+		}
+	case '\'':
+		return func(w string) string {
+			if n >= len(w) {
+				return w
+			}
+			return w[:n]
+		}
+	case '$':
+		return func(w string) string { return w + string(chars[0]) }
+	case '^':
+		return func(w string) string { return string(chars[0]) + w }
+	case '@':
+		return func(w string) string { return strings.ReplaceAll(w, string(chars[0]), "") }
+	case 'i':
+		return func(w string) string {
+			if n > len(w) {
+				return w
+			}
+			return w[:n] + string(chars[0]) + w[n:]
+		}
+	case 'o':
+		return func(w string) string {
+			if n >= len(w) {
+				return w
+			}
+			return w[:n] + string(chars[0]) + w[n+1:]
+		}
+	case 's':
+		return func(w string) string { return strings.ReplaceAll(w, string(chars[0]), string(chars[1])) }
+	}
+	return func(w string) string { return w } // ':'
+}
+
+// toggleCase swaps the case of an ASCII letter
+func toggleCase(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return r - 'a' + 'A'
+	case r >= 'A' && r <= 'Z':
+		return r - 'A' + 'a'
+	}
+	return r
+}
+
+// capitalize upper-cases the first byte of w
+func capitalize(w string) string {
+	if w == "" {
+		return w
+	}
+	return strings.ToUpper(w[:1]) + w[1:]
+}
+
+// reverse reverses the bytes of w
+func reverse(w string) string {
+	b := []byte(w)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// mangledWordlist is a wordlist with every rule applied to every word,
+// generated as payloads are sent rather than up front: payload i is rule
+// i%rules applied to word i/rules, so each word's variants go out
+// together. Without rules it is the words as they are.
+type mangledWordlist struct {
+	words []string
+	rules []mangleRule
+}
+
+// newMangledWordlist parses rules for the words. The rules are expected to
+// have been checked by LoadMangleRules or validateConfig.
+func newMangledWordlist(words, rules []string) (*mangledWordlist, error) {
+	list := &mangledWordlist{words: words}
+	for _, rule := range rules {
+		parsed, err := parseMangleRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		list.rules = append(list.rules, parsed)
+	}
+	return list, nil
+}
+
+// Len returns the number of payloads, words times rules
+func (l *mangledWordlist) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.words) * max(1, len(l.rules))
+}
+
+// At returns payload i
+func (l *mangledWordlist) At(i int) string {
+	if len(l.rules) == 0 {
+		return l.words[i]
+	}
+	word := l.words[i/len(l.rules)]
+	for _, fn := range l.rules[i%len(l.rules)] {
+		word = fn(word)
+	}
+	return word
+}
@@ -0,0 +1,258 @@
+package fuzzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// maxFieldDepth bounds how deeply a response document is searched for an
+// injected field, e.g. inside a "data" wrapper
+const maxFieldDepth = 3
+
+// privilegedField is an attribute servers commonly set themselves, with a
+// value that would grant the client something if accepted
+type privilegedField struct {
+	name  string
+	value interface{}
+}
+
+// privilegedFields are added to otherwise valid request bodies to test for
+// mass assignment
+var privilegedFields = []privilegedField{
+	{"is_admin", true},
+	{"isAdmin", true},
+	{"admin", true},
+	{"role", "admin"},
+	{"roles", []interface{}{"admin"}},
+	{"permissions", []interface{}{"*"}},
+	{"verified", true},
+	{"is_verified", true},
+	{"email_verified", true},
+	{"approved", true},
+	{"price", 0.01},
+	{"discount", 100},
+	{"balance", 1000000},
+	{"credits", 1000000},
+}
+
+// testMassAssignment sends the valid base body once per privileged field
+// with that field added, and reports fields the API takes: those echoed back
+// in the response, or present in the resource read back afterwards. Fields
+// the endpoint declares as parameters are not tested.
+func (f *APIFuzzer) testMassAssignment(base map[string]interface{}) {
+	switch f.endpoint.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+
+	_, respBody, ok := f.acceptedBody(base)
+	if !ok {
+		return
+	}
+	var baseline interface{}
+	json.Unmarshal(respBody, &baseline)
+
+	for _, field := range privilegedFields {
+		if _, declared := f.endpoint.Params[field.name]; declared {
+			continue
+		}
+		if _, present := base[field.name]; present {
+			continue
+		}
+		// A default that already matches proves nothing
+		if value, ok := jsonField(baseline, field.name, 0); ok && sameJSONValue(value, field.value) {
+			continue
+		}
+		f.injectField(base, field)
+	}
+}
+
+// injectField sends the base body with one privileged field added and
+// reports the field when the API takes it
+func (f *APIFuzzer) injectField(base map[string]interface{}, field privilegedField) {
+	doc := copyMap(base)
+	doc[field.name] = field.value
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+
+	req, resp, respBody, err := f.exchange(f.endpoint.Method, f.endpoint.URL, body)
+	if err != nil {
+		f.logger.Debug("mass assignment request failed", "field", field.name, "error", err)
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return
+	}
+
+	value, _ := json.Marshal(field.value)
+	finding := &Finding{
+		Type:      "mass-assignment",
+		Severity:  SeverityHigh,
+		URL:       f.endpoint.URL,
+		Method:    f.endpoint.Method,
+		Parameter: field.name,
+		Payload:   string(body),
+		Timestamp: time.Now(),
+	}
+
+	var echoed interface{}
+	json.Unmarshal(respBody, &echoed)
+
+	// A stored value is conclusive; an echo may only mirror the request
+	if readURL := f.readBackURL(resp, echoed); readURL != "" {
+		readReq, readResp, readBody, err := f.exchange(http.MethodGet, readURL, nil)
+		if err == nil && readResp.StatusCode == http.StatusOK {
+			var stored interface{}
+			json.Unmarshal(readBody, &stored)
+			if got, ok := jsonField(stored, field.name, 0); ok && sameJSONValue(got, field.value) {
+				finding.Confidence = ConfidenceCertain
+				finding.Evidence = fmt.Sprintf("%s=%s was stored: GET %s returns it", field.name, value, readURL)
+				captureExchange(finding, readReq, nil, readResp, readBody)
+				f.reportMassAssignment(finding)
+				return
+			}
+		}
+	}
+	if got, ok := jsonField(echoed, field.name, 0); ok && sameJSONValue(got, field.value) {
+		finding.Confidence = ConfidenceFirm
+		finding.Evidence = fmt.Sprintf("%s=%s was accepted and echoed in the HTTP %d response", field.name, value, resp.StatusCode)
+		captureExchange(finding, req, body, resp, respBody)
+		f.reportMassAssignment(finding)
+	}
+}
+
+// reportMassAssignment records a mass assignment finding
+func (f *APIFuzzer) reportMassAssignment(finding *Finding) {
+	if f.config.Findings.Add(finding) {
+		f.logger.Warn("mass assignment", "field", finding.Parameter, "confidence", finding.Confidence)
+	}
+}
+
+// readBackURL returns where the resource a request created or changed can
+// be read: the Location header, the endpoint itself for PUT and PATCH, or
+// the endpoint followed by the id of the created object. It returns "" when
+// none applies.
+func (f *APIFuzzer) readBackURL(resp *http.Response, created interface{}) string {
+	if location, err := resp.Location(); err == nil {
+		return location.String()
+	}
+	if f.endpoint.Method != "POST" {
+		return f.endpoint.URL
+	}
+	id, ok := jsonField(created, "id", 0)
+	if !ok {
+		return ""
+	}
+	switch id.(type) {
+	case string, float64:
+	default:
+		return ""
+	}
+	base, err := url.Parse(f.endpoint.URL)
+	if err != nil {
+		return ""
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/" + url.PathEscape(fmt.Sprint(id))
+	base.RawPath = ""
+	return base.String()
+}
+
+// acceptedBody sends the base body as JSON and returns the response when
+// the endpoint accepts it. Without an accepted baseline, a rejected variant
+// of the body cannot be told apart from a rejected body.
+func (f *APIFuzzer) acceptedBody(base map[string]interface{}) (*http.Response, []byte, bool) {
+	body, err := json.Marshal(base)
+	if err != nil {
+		return nil, nil, false
+	}
+	_, resp, respBody, err := f.exchange(f.endpoint.Method, f.endpoint.URL, body)
+	if err != nil {
+		f.logger.Debug("baseline request failed", "error", err)
+		return nil, nil, false
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		f.logger.Debug("baseline body rejected", "status", resp.StatusCode)
+		return nil, nil, false
+	}
+	return resp, respBody, true
+}
+
+// exchange sends a request with a JSON body, if any, and the endpoint's
+// headers
+func (f *APIFuzzer) exchange(method, targetURL string, body []byte) (*http.Request, *http.Response, []byte, error) {
+	return f.exchangeWith(method, targetURL, body, "application/json")
+}
+
+// exchangeWith sends a request with the endpoint's headers and a body of the
+// given Content-Type, and returns the response together with its body, read
+// up to the configured limit
+func (f *APIFuzzer) exchangeWith(method, targetURL string, body []byte, contentType string) (*http.Request, *http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, targetURL, reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	for key, value := range f.endpoint.Headers {
+		req.Header.Set(key, value)
+	}
+	if body != nil || method != http.MethodGet {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	limited, err := readLimited(resp.Body, maxBodySize(f.config))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return req, resp, limited.data, nil
+}
+
+// jsonField finds the value of the named field in a decoded JSON document,
+// looking through nested objects up to maxFieldDepth levels down
+func jsonField(doc interface{}, name string, depth int) (interface{}, bool) {
+	object, ok := doc.(map[string]interface{})
+	if !ok || depth > maxFieldDepth {
+		return nil, false
+	}
+	if value, ok := object[name]; ok {
+		return value, true
+	}
+	for _, key := range sortedKeys(object) {
+		if value, ok := jsonField(object[key], name, depth+1); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// sameJSONValue reports whether a decoded JSON value equals the value sent,
+// comparing both in their decoded form
+func sameJSONValue(got, sent interface{}) bool {
+	data, err := json.Marshal(sent)
+	if err != nil {
+		return false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(got, decoded)
+}
@@ -0,0 +1,202 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultFilter decides which results are worth reporting. A result is kept
+// when it satisfies every match rule and none of the filter rules. Rules are
+// written as kind:value, for example:
+//
+//	status:200,301,500-599
+//	size:0-512 or size:>10000
+//	words:<20
+//	lines:1-3
+//	regex:(?i)sql syntax
+//	latency:>2s
+//
+// Comma-separated values within a rule are alternatives.
+type ResultFilter struct {
+	match  []resultRule
+	filter []resultRule
+}
+
+// resultRule is a single parsed match or filter rule
+type resultRule struct {
+	kind    string
+	ranges  []valueRange // status, size, words, lines and latency (nanoseconds)
+	pattern *regexp.Regexp
+}
+
+// valueRange is an inclusive numeric range
+type valueRange struct {
+	min, max int64
+}
+
+// ParseResultFilter builds a ResultFilter from match and filter rules
+func ParseResultFilter(match, filter []string) (*ResultFilter, error) {
+	rf := &ResultFilter{}
+	for _, spec := range match {
+		rule, err := parseResultRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match rule %q: %v", spec, err)
+		}
+		rf.match = append(rf.match, rule)
+	}
+	for _, spec := range filter {
+		rule, err := parseResultRule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter rule %q: %v", spec, err)
+		}
+		rf.filter = append(rf.filter, rule)
+	}
+	return rf, nil
+}
+
+// Active reports whether any rules are configured
+func (rf *ResultFilter) Active() bool {
+	return rf != nil && len(rf.match)+len(rf.filter) > 0
+}
+
+// Keep reports whether a result passes the rules. Failed requests are always
+// kept so errors are not hidden; a nil filter keeps everything.
+func (rf *ResultFilter) Keep(r *Result) bool {
+	if rf == nil || r.Error != nil {
+		return true
+	}
+	for _, rule := range rf.match {
+		if !rule.matches(r) {
+			return false
+		}
+	}
+	for _, rule := range rf.filter {
+		if rule.matches(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the result satisfies the rule
+func (rule resultRule) matches(r *Result) bool {
+	var value int64
+	switch rule.kind {
+	case "regex":
+		return rule.pattern.MatchString(r.Response)
+	case "status":
+		value = int64(r.StatusCode)
+	case "size":
+		value = int64(r.Size)
+	case "words":
+		value = int64(r.Words)
+	case "lines":
+		value = int64(r.Lines)
+	case "latency":
+		value = int64(r.Duration)
+	}
+
+	for _, vr := range rule.ranges {
+		if value >= vr.min && value <= vr.max {
+			return true
+		}
+	}
+	return false
+}
+
+// parseResultRule parses a single kind:value rule
+func parseResultRule(spec string) (resultRule, error) {
+	kind, value, ok := strings.Cut(spec, ":")
+	if !ok || value == "" {
+		return resultRule{}, fmt.Errorf("expected kind:value")
+	}
+	rule := resultRule{kind: strings.ToLower(strings.TrimSpace(kind))}
+
+	switch rule.kind {
+	case "regex":
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return resultRule{}, err
+		}
+		rule.pattern = pattern
+		return rule, nil
+
+	case "status", "size", "words", "lines":
+		parse := func(s string) (int64, error) {
+			return strconv.ParseInt(s, 10, 64)
+		}
+		ranges, err := parseRanges(value, parse)
+		if err != nil {
+			return resultRule{}, err
+		}
+		rule.ranges = ranges
+		return rule, nil
+
+	case "latency":
+		parse := func(s string) (int64, error) {
+			d, err := time.ParseDuration(s)
+			return int64(d), err
+		}
+		ranges, err := parseRanges(value, parse)
+		if err != nil {
+			return resultRule{}, err
+		}
+		rule.ranges = ranges
+		return rule, nil
+
+	default:
+		return resultRule{}, fmt.Errorf("unknown rule kind: %s", kind)
+	}
+}
+
+// parseRanges parses comma-separated values of the form n, n-m, >n or <n
+func parseRanges(spec string, parse func(string) (int64, error)) ([]valueRange, error) {
+	var ranges []valueRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+
+		var vr valueRange
+		var err error
+		switch {
+		case strings.HasPrefix(part, ">"):
+			vr.min, err = parse(part[1:])
+			vr.min++
+			vr.max = math.MaxInt64
+		case strings.HasPrefix(part, "<"):
+			vr.max, err = parse(part[1:])
+			vr.max--
+			vr.min = math.MinInt64
+		case strings.Contains(part, "-"):
+			low, high, _ := strings.Cut(part, "-")
+			if vr.min, err = parse(low); err == nil {
+				vr.max, err = parse(high)
+			}
+			if err == nil && vr.min > vr.max {
+				err = fmt.Errorf("range %s is reversed", part)
+			}
+		default:
+			vr.min, err = parse(part)
+			vr.max = vr.min
+		}
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, vr)
+	}
+	return ranges, nil
+}
+
+// measureBody fills the size, hash, word and line counts of a result. Size
+// and hash cover the full body; words and lines only the part kept in memory.
+func (r *Result) measureBody(body *limitedBody) {
+	r.Size = int(body.size)
+	r.Hash = body.hash
+	r.Words = len(strings.Fields(string(body.data)))
+	if len(body.data) > 0 {
+		r.Lines = strings.Count(string(body.data), "\n") + 1
+	}
+}
@@ -2,20 +2,21 @@ package fuzzer
 
 import (
 	"fmt"
-	"math/rand"
 	"net/http"
 	"sort"
 	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // MutationCoverageFuzzer implements coverage-guided mutation fuzzing
 type MutationCoverageFuzzer struct {
 	*MutationFuzzer
 	population    []string        // Current population of inputs
+	populationMu  sync.RWMutex    // Guards replacing the population while checkpoints read it
 	coverageSeen  map[string]bool // Track unique coverage paths
 	coverageLock  sync.RWMutex    // Protect coverage map
-	energies      map[string]int  // Energy assigned to each input
-	totalEnergy   int             // Total energy in the system
+	schedule      *powerSchedule  // Energy of each input, from its statistics
 	maxPopulation int             // Maximum population size
 }
 
@@ -25,74 +26,93 @@ func NewMutationCoverageFuzzer(config *Config) (*MutationCoverageFuzzer, error)
 	if err != nil {
 		return nil, err
 	}
+	base.logger = logging.For("mutation-coverage")
 
 	return &MutationCoverageFuzzer{
 		MutationFuzzer: base,
 		population:     make([]string, 0),
 		coverageSeen:   make(map[string]bool),
-		energies:       make(map[string]int),
+		schedule:       newPowerSchedule(config.PowerSchedule),
 		maxPopulation:  config.MaxCorpus,
 	}, nil
 }
 
 // Run starts the coverage-guided fuzzing process
 func (f *MutationCoverageFuzzer) Run() error {
+	if err := f.startSession(); err != nil {
+		return err
+	}
+
 	// Initialize population with seed inputs
 	for _, seed := range f.config.SeedInputs {
-		f.addToPopulation(seed)
+		f.addToPopulation(seed, "")
 	}
 
 	// Main fuzzing loop
-	for i := 0; i < f.config.NumRequests; i++ {
+	budget := newRequestBudget(f.config.NumRequests, f.config.Deadline)
+	checkpoints := startCheckpoints(f.config, f.logger, budget, f.populationSnapshot, func() []any {
+		f.coverageLock.RLock()
+		defer f.coverageLock.RUnlock()
+		return []any{"coverage", len(f.coverageSeen)}
+	})
+	defer checkpoints.Stop()
+	for _, ok := budget.take(); ok; _, ok = budget.take() {
 		// Select input based on energy
 		input := f.selectInput()
+		f.schedule.choose(input)
 
 		// Generate mutations
 		numMutations := f.config.MinMutations
 		if f.config.MaxMutations > f.config.MinMutations {
-			numMutations += rand.Intn(f.config.MaxMutations - f.config.MinMutations + 1)
+			numMutations += f.rng.Intn(f.config.MaxMutations - f.config.MinMutations + 1)
 		}
 
-		mutated := input
+		mutated := spliceFrom(f.config, f.rng, input, f.population)
 		for j := 0; j < numMutations; j++ {
 			mutated = f.mutate(mutated)
 		}
 
 		// Test the mutated input
-		resp, err := f.test(mutated)
+		resp, err := f.test(mutated, mutatedValue(input, mutated))
 		if err != nil {
-			if f.config.Verbose {
-				fmt.Printf("Error testing %s: %v\n", mutated, err)
-			}
+			f.logger.Debug("request failed", "input", mutated, "error", err)
 			continue
 		}
 
 		// Calculate coverage
 		coverage := f.calculateCoverage(resp)
+		resp.Body.Close()
 
 		// Check if we found new coverage
-		if f.isNewCoverage(coverage) {
-			if f.config.Verbose {
-				fmt.Printf("New coverage found: %s\n", mutated)
-			}
-			f.addToPopulation(mutated)
-			f.assignEnergy(mutated, 10) // High energy for new coverage
-		} else {
-			f.assignEnergy(input, 1) // Low energy for existing coverage
+		isNew := f.isNewCoverage(coverage)
+		f.schedule.hit(input, coverage, isNew)
+		if isNew {
+			f.logger.Debug("new coverage", "signature", coverage, "input", mutated)
+			f.addToPopulation(mutated, coverage)
 		}
 
 		// Maintain population size
 		f.prunePopulation()
 	}
 
+	f.schedule.summary(f.logger)
 	return nil
 }
 
-// addToPopulation adds a new input to the population
-func (f *MutationCoverageFuzzer) addToPopulation(input string) {
+// addToPopulation adds a new input to the population, path being the
+// coverage it reached or empty for a seed input
+func (f *MutationCoverageFuzzer) addToPopulation(input, path string) {
+	f.populationMu.Lock()
 	f.population = append(f.population, input)
-	f.energies[input] = 1
-	f.totalEnergy++
+	f.populationMu.Unlock()
+	f.schedule.add(input, path)
+}
+
+// populationSnapshot returns a copy of the population
+func (f *MutationCoverageFuzzer) populationSnapshot() []string {
+	f.populationMu.RLock()
+	defer f.populationMu.RUnlock()
+	return append([]string(nil), f.population...)
 }
 
 // selectInput selects an input from the population based on energy
@@ -102,10 +122,16 @@ func (f *MutationCoverageFuzzer) selectInput() string {
 	}
 
 	// Roulette wheel selection
-	point := rand.Intn(f.totalEnergy)
+	energies := make([]int, len(f.population))
+	total := 0
+	for i, input := range f.population {
+		energies[i] = f.schedule.energy(input)
+		total += energies[i]
+	}
+	point := f.rng.Intn(total)
 	sum := 0
-	for _, input := range f.population {
-		sum += f.energies[input]
+	for i, input := range f.population {
+		sum += energies[i]
 		if sum > point {
 			return input
 		}
@@ -132,13 +158,6 @@ func (f *MutationCoverageFuzzer) isNewCoverage(coverage string) bool {
 	return false
 }
 
-// assignEnergy assigns energy to an input
-func (f *MutationCoverageFuzzer) assignEnergy(input string, energy int) {
-	oldEnergy := f.energies[input]
-	f.energies[input] = energy
-	f.totalEnergy = f.totalEnergy - oldEnergy + energy
-}
-
 // prunePopulation maintains the population size
 func (f *MutationCoverageFuzzer) prunePopulation() {
 	if len(f.population) <= f.maxPopulation {
@@ -152,24 +171,21 @@ func (f *MutationCoverageFuzzer) prunePopulation() {
 	}
 	var entries []inputEnergy
 	for _, input := range f.population {
-		entries = append(entries, inputEnergy{input, f.energies[input]})
+		entries = append(entries, inputEnergy{input, f.schedule.energy(input)})
 	}
 	sort.Slice(entries, func(i, j int) bool {
 		return entries[i].energy > entries[j].energy
 	})
 
 	// Keep only the highest energy inputs
-	f.population = make([]string, 0, f.maxPopulation)
-	f.totalEnergy = 0
+	population := make([]string, 0, f.maxPopulation)
 	for i := 0; i < f.maxPopulation && i < len(entries); i++ {
-		f.population = append(f.population, entries[i].input)
-		f.totalEnergy += entries[i].energy
+		population = append(population, entries[i].input)
 	}
+	f.populationMu.Lock()
+	f.population = population
+	f.populationMu.Unlock()
 
-	// Clean up energies map
-	newEnergies := make(map[string]int)
-	for _, input := range f.population {
-		newEnergies[input] = f.energies[input]
-	}
-	f.energies = newEnergies
+	// Drop the statistics of pruned inputs
+	f.schedule.keep(f.population)
 }
@@ -1,12 +1,16 @@
 package fuzzer
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"log/slog"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // MutationFuzzer implements mutation-based fuzzing
@@ -15,6 +19,8 @@ type MutationFuzzer struct {
 	seedInputs []string
 	client     *http.Client
 	coverage   map[string]bool // Track unique responses
+	rng        *rand.Rand      // Mutation choices, seeded from the run seed
+	logger     *slog.Logger
 }
 
 // NewMutationFuzzer creates a new mutation-based fuzzer
@@ -23,34 +29,57 @@ func NewMutationFuzzer(config *Config) (*MutationFuzzer, error) {
 		return nil, fmt.Errorf("config is required")
 	}
 
+	client, err := newHTTPClient(config, true)
+	if err != nil {
+		return nil, err
+	}
+
 	return &MutationFuzzer{
 		config:   config,
 		coverage: make(map[string]bool),
-		client: &http.Client{
-			Timeout: config.Timeout,
-		},
+		client:   client,
+		rng:      newRand(runSeed(config), streamMutation),
+		logger:   logging.For("mutation"),
 	}, nil
 }
 
+// startSession switches the client to the run's session, with a cookie jar
+// and logged in as Config.LoginRequest says. The fuzzer sends from one
+// worker, so it has one session in either session mode.
+func (f *MutationFuzzer) startSession() error {
+	sessions, err := newSessions(f.config, f.client)
+	if err != nil {
+		return err
+	}
+	f.client = sessions.client()
+	return nil
+}
+
 // Run starts the fuzzing process
 func (f *MutationFuzzer) Run() error {
 	if len(f.config.SeedInputs) == 0 {
 		return fmt.Errorf("at least one seed input is required")
 	}
+	if err := f.startSession(); err != nil {
+		return err
+	}
 
 	// Initialize with seed inputs
 	inputs := make([]string, len(f.config.SeedInputs))
 	copy(inputs, f.config.SeedInputs)
 
 	// Main fuzzing loop
-	for i := 0; i < f.config.NumRequests; i++ {
+	budget := newRequestBudget(f.config.NumRequests, f.config.Deadline)
+	checkpoints := startCheckpoints(f.config, f.logger, budget, nil, nil)
+	defer checkpoints.Stop()
+	for _, ok := budget.take(); ok; _, ok = budget.take() {
 		// Select an input to mutate
-		input := inputs[rand.Intn(len(inputs))]
+		input := spliceFrom(f.config, f.rng, inputs[f.rng.Intn(len(inputs))], inputs)
 
 		// Generate mutations
 		numMutations := f.config.MinMutations
 		if f.config.MaxMutations > f.config.MinMutations {
-			numMutations += rand.Intn(f.config.MaxMutations - f.config.MinMutations + 1)
+			numMutations += f.rng.Intn(f.config.MaxMutations - f.config.MinMutations + 1)
 		}
 
 		mutated := input
@@ -59,21 +88,18 @@ func (f *MutationFuzzer) Run() error {
 		}
 
 		// Test the mutated input
-		resp, err := f.test(mutated)
+		resp, err := f.test(mutated, mutatedValue(input, mutated))
 		if err != nil {
-			if f.config.Verbose {
-				fmt.Printf("Error testing %s: %v\n", mutated, err)
-			}
+			f.logger.Debug("request failed", "input", mutated, "error", err)
 			continue
 		}
 
 		// Track coverage
 		coverage := fmt.Sprintf("%d-%d", resp.StatusCode, len(resp.Header))
+		resp.Body.Close()
 		if !f.coverage[coverage] {
 			f.coverage[coverage] = true
-			if f.config.Verbose {
-				fmt.Printf("New coverage: %s with input %s\n", coverage, mutated)
-			}
+			f.logger.Debug("new coverage", "signature", coverage, "input", mutated)
 			// Add interesting inputs to the pool
 			inputs = append(inputs, mutated)
 		}
@@ -90,20 +116,35 @@ func (f *MutationFuzzer) mutate(input string) string {
 		return input
 	}
 
-	switch rand.Intn(4) {
+	// Custom mutators are picked as often as each built-in strategy. Without
+	// any the choices stay as they were, so seeds replay the same run.
+	if len(f.config.Mutators) > 0 {
+		if n := f.rng.Intn(4 + len(f.config.Mutators)); n >= 4 {
+			return applyMutator(f.config.Mutators[n-4], f.rng, input)
+		}
+	}
+
+	switch f.rng.Intn(4) {
 	case 0: // Mutate path
 		parts := strings.Split(u.Path, "/")
 		if len(parts) > 0 {
-			idx := rand.Intn(len(parts))
+			idx := f.rng.Intn(len(parts))
 			parts[idx] = f.mutateString(parts[idx])
 			u.Path = strings.Join(parts, "/")
 		}
 	case 1: // Mutate query parameter
 		q := u.Query()
 		if len(q) > 0 {
-			// Modify existing parameter
+			// Modify existing parameter, often starting from a real value
+			// seen for it instead of the one in the input
 			for k := range q {
-				q.Set(k, f.mutateString(q.Get(k)))
+				value := q.Get(k)
+				if f.rng.Intn(2) == 0 {
+					if seed, ok := f.config.Learner.Seed(f.rng, k); ok {
+						value = seed
+					}
+				}
+				q.Set(k, f.mutateString(value))
 				break
 			}
 		} else {
@@ -115,7 +156,7 @@ func (f *MutationFuzzer) mutate(input string) string {
 		u.Path = "../" + u.Path
 	case 3: // Add special characters
 		specialChars := []string{"<", ">", "'", "\"", ";", "%00", "%0d%0a"}
-		u.Path += specialChars[rand.Intn(len(specialChars))]
+		u.Path += specialChars[f.rng.Intn(len(specialChars))]
 	}
 
 	return u.String()
@@ -127,21 +168,21 @@ func (f *MutationFuzzer) mutateString(s string) string {
 		return "fuzz"
 	}
 
-	switch rand.Intn(4) {
+	switch f.rng.Intn(4) {
 	case 0: // Bit flip
 		if len(s) > 0 {
-			pos := rand.Intn(len(s))
+			pos := f.rng.Intn(len(s))
 			char := s[pos]
-			char ^= byte(1 << uint(rand.Intn(8)))
+			char ^= byte(1 << uint(f.rng.Intn(8)))
 			return s[:pos] + string(char) + s[pos+1:]
 		}
 	case 1: // Insert character
-		pos := rand.Intn(len(s) + 1)
-		char := byte(rand.Intn(256))
+		pos := f.rng.Intn(len(s) + 1)
+		char := byte(f.rng.Intn(256))
 		return s[:pos] + string(char) + s[pos:]
 	case 2: // Delete character
 		if len(s) > 0 {
-			pos := rand.Intn(len(s))
+			pos := f.rng.Intn(len(s))
 			return s[:pos] + s[pos+1:]
 		}
 	case 3: // Replace with special string
@@ -154,23 +195,45 @@ func (f *MutationFuzzer) mutateString(s string) string {
 			"$(cat /etc/passwd)",
 			"{{7*7}}",
 		}
-		return specials[rand.Intn(len(specials))]
+		return specials[f.rng.Intn(len(specials))]
 	}
 
 	return s
 }
 
-// test sends a request with the mutated input
-func (f *MutationFuzzer) test(input string) (*http.Response, error) {
+// mutatedValue returns the part of mutated that differs from input, the
+// payload a mutation put in, without the prefix and suffix they share
+func mutatedValue(input, mutated string) string {
+	prefix := 0
+	for prefix < len(input) && prefix < len(mutated) && input[prefix] == mutated[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(input)-prefix && suffix < len(mutated)-prefix &&
+		input[len(input)-1-suffix] == mutated[len(mutated)-1-suffix] {
+		suffix++
+	}
+	return mutated[prefix : len(mutated)-suffix]
+}
+
+// test sends a request with the mutated input and inspects the response,
+// payload being what the mutations changed. The returned response's body
+// holds what was read, up to the body limit.
+func (f *MutationFuzzer) test(input, payload string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", input, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return f.client.Do(req)
-}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		inspectFailure(f.config, req, nil, err, payload)
+		return nil, err
+	}
+	body, _ := readLimited(resp.Body, maxBodySize(f.config))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body.data))
 
-func init() {
-	// Seed random number generator
-	rand.Seed(time.Now().UnixNano())
+	inspectResponse(f.config, req, nil, resp, body.data, payload)
+	return resp, nil
 }
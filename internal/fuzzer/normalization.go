@@ -0,0 +1,248 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// normalizationVariant is a value spelled so that it looks different to a
+// byte-wise comparison but becomes the original once normalized
+type normalizationVariant struct {
+	technique string
+	value     string
+}
+
+// caseFoldings are characters that lower or upper case into a different
+// ASCII letter: the Kelvin sign lowercases to k, the long s upper cases to S
+// and the dotless i to I
+var caseFoldings = map[rune]rune{
+	'k': 'K',
+	's': 'ſ',
+	'i': 'ı',
+}
+
+// compatibilityForms are characters NFKC maps to a plain ASCII letter
+var compatibilityForms = map[rune]rune{
+	'a': 'ª',
+	'o': 'º',
+	'i': 'ⁱ',
+	'n': 'ⁿ',
+	'h': 'ʰ',
+	'j': 'ʲ',
+	'r': 'ʳ',
+	'w': 'ʷ',
+	'y': 'ʸ',
+}
+
+// normalizationVariants returns spellings of value that normalization
+// turns back into it: a zero-width non-joiner and a zero-width space inside
+// it, its fullwidth form, case-folding and compatibility look-alikes and an
+// overlong UTF-8 encoding of its first character. Only the local part of an
+// email address is changed, so the domain still resolves.
+func normalizationVariants(value string) []normalizationVariant {
+	local, domain := value, ""
+	if at := strings.LastIndex(value, "@"); at > 0 {
+		local, domain = value[:at], value[at:]
+	}
+	if local == "" {
+		return nil
+	}
+	runes := []rune(local)
+
+	var variants []normalizationVariant
+	add := func(technique, changed string) {
+		if changed != local {
+			variants = append(variants, normalizationVariant{technique, changed + domain})
+		}
+	}
+	if len(runes) > 1 {
+		add("zero-width non-joiner", string(runes[:len(runes)/2])+"\u200c"+string(runes[len(runes)/2:]))
+		add("zero-width space", string(runes[:1])+"\u200b"+string(runes[1:]))
+	}
+	add("fullwidth", fullwidth(local))
+	add("case folding", replaceFirst(runes, caseFoldings))
+	add("compatibility", replaceFirst(runes, compatibilityForms))
+	if c := local[0]; c < 0x80 {
+		add("overlong UTF-8", string([]byte{0xc0 | c>>6, 0x80 | c&0x3f})+local[1:])
+	}
+	return variants
+}
+
+// replaceFirst swaps the first rune that has a look-alike in forms, matched
+// case-insensitively
+func replaceFirst(runes []rune, forms map[rune]rune) string {
+	for i, r := range runes {
+		if alike, ok := forms[toLowerASCII(r)]; ok {
+			changed := append([]rune{}, runes...)
+			changed[i] = alike
+			return string(changed)
+		}
+	}
+	return string(runes)
+}
+
+// toLowerASCII lowercases an ASCII letter and leaves other runes alone
+func toLowerASCII(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + 'a' - 'A'
+	}
+	return r
+}
+
+// fullwidth returns s with its printable ASCII characters replaced by their
+// fullwidth forms, which NFKC maps back
+func fullwidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0x20 && r < 0x7f {
+			return r - 0x21 + 0xff01
+		}
+		return r
+	}, s)
+}
+
+// normalizationFinding reports a variant the server takes for the original
+// value
+func normalizationFinding(name, original string, variant normalizationVariant, probe, canary *probeResponse) *Finding {
+	finding := &Finding{
+		Type:       "unicode-normalization",
+		Severity:   SeverityMedium,
+		Confidence: ConfidenceFirm,
+		URL:        probe.req.URL.String(),
+		Method:     probe.req.Method,
+		Parameter:  name,
+		Payload:    variant.value,
+		Evidence: fmt.Sprintf("%s spelling %q is answered like %q (%s), unlike another value (%s): "+
+			"input is normalized after comparison, so a check of the plain value can be bypassed, "+
+			"or a second account can be registered under the same name",
+			variant.technique, variant.value, original, probe, canary),
+	}
+	captureExchange(finding, probe.req, nil, probe.resp, probe.body)
+	return finding
+}
+
+// probeNormalization sends normalization variants of one query parameter's
+// value. A server reflecting a fullwidth canary in ASCII normalizes input,
+// which is reported as certain. Otherwise a variant answered like the
+// original value and unlike a random one, twice, shows the server takes the
+// two for the same, e.g. ad<ZWNJ>min for the admin account.
+func probeNormalization(client *http.Client, config *Config, rng *rand.Rand, targetURL, param string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	send := func(value string) (*probeResponse, error) {
+		u := *parsed
+		query := u.Query()
+		query.Set(param, value)
+		u.RawQuery = query.Encode()
+		req, resp, body, _, err := timedGet(client, config, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &probeResponse{req: req, resp: resp, body: body}, nil
+	}
+
+	canary := fmt.Sprintf("gfu%08x", rng.Uint32())
+	reflected, err := send(fullwidth(canary))
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(string(reflected.body), canary) {
+		finding := &Finding{
+			Type:       "unicode-normalization",
+			Severity:   SeverityMedium,
+			Confidence: ConfidenceCertain,
+			URL:        reflected.req.URL.String(),
+			Method:     reflected.req.Method,
+			Parameter:  param,
+			Payload:    fullwidth(canary),
+			Evidence: fmt.Sprintf("fullwidth %q is reflected as %q: input is NFKC normalized, "+
+				"so fullwidth <, > and quotes can get past filters applied before normalization", fullwidth(canary), canary),
+		}
+		captureExchange(finding, reflected.req, nil, reflected.resp, reflected.body)
+		return finding, nil
+	}
+
+	original := parsed.Query().Get(param)
+	if original == "" {
+		return nil, nil
+	}
+	return probeNormalizedValue(param, original, canary, send, expired)
+}
+
+// probeNormalizedValue sends the variants of original through send and
+// reports the first the server answers like original but not like canary
+func probeNormalizedValue(name, original, canary string, send func(string) (*probeResponse, error), expired func() bool) (*Finding, error) {
+	baseline, err := send(original)
+	if err != nil {
+		return nil, err
+	}
+	// A response that changes on every request, or that does not depend on
+	// the value, cannot be diffed
+	again, err := send(original)
+	if err != nil {
+		return nil, err
+	}
+	other, err := send(canary)
+	if err != nil {
+		return nil, err
+	}
+	if !baseline.like(again) || baseline.like(other) {
+		return nil, nil
+	}
+	for _, variant := range normalizationVariants(original) {
+		if expired() {
+			return nil, nil
+		}
+		probe, err := send(variant.value)
+		if err != nil || !probe.like(baseline) || probe.resp.StatusCode >= http.StatusBadRequest {
+			continue
+		}
+		repeated, err := send(variant.value)
+		if err != nil || !repeated.like(baseline) {
+			continue
+		}
+		return normalizationFinding(name, original, variant, probe, other), nil
+	}
+	return nil, nil
+}
+
+// probePathNormalization sends normalization variants of the last segment
+// of a URL path, such as /ａｄｍｉｎ for /admin. One answered like the
+// original path shows path rules matched byte-wise, like access controls in
+// a proxy, can be sidestepped.
+func probePathNormalization(client *http.Client, config *Config, rng *rand.Rand, targetURL string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	dir, escaped := "", strings.TrimSuffix(parsed.EscapedPath(), "/")
+	if slash := strings.LastIndex(escaped, "/"); slash >= 0 {
+		dir, escaped = escaped[:slash+1], escaped[slash+1:]
+	}
+	segment, err := url.PathUnescape(escaped)
+	if err != nil || segment == "" {
+		return nil, nil
+	}
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	send := func(value string) (*probeResponse, error) {
+		u := *parsed
+		u.RawPath = dir + url.PathEscape(value)
+		u.Path, _ = url.PathUnescape(u.RawPath)
+		req, resp, body, _, err := timedGet(client, config, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &probeResponse{req: req, resp: resp, body: body}, nil
+	}
+	return probeNormalizedValue("path", segment, fmt.Sprintf("gfu%08x", rng.Uint32()), send, expired)
+}
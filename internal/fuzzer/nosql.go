@@ -0,0 +1,256 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// nosqlErrorSignatures are errors MongoDB, Elasticsearch and their drivers
+// return for operators or query syntax they were not meant to receive
+var nosqlErrorSignatures = regexp.MustCompile(`(?i)(MongoError|MongoServerError|Mongo(DB)?\.Driver|unknown operator:? *\$|` +
+	`CastError: Cast to|cannot apply \$|\$where.{0,40}(SyntaxError|ReferenceError)|query_shard_exception|parsing_exception|` +
+	`search_phase_execution_exception|query_string_parse_exception|Failed to parse query|org\.elasticsearch|json_parse_exception)`)
+
+// nosqlValue is a value injected in place of a field: a MongoDB operator
+// object such as {"$ne": "x"}, or a plain string when operator is empty
+type nosqlValue struct {
+	operator string
+	value    string
+}
+
+// JSON returns the value as it is put in a JSON body
+func (v nosqlValue) JSON() interface{} {
+	if v.operator == "" {
+		return v.value
+	}
+	return map[string]interface{}{v.operator: v.value}
+}
+
+// String returns the value as reported in findings
+func (v nosqlValue) String() string {
+	data, _ := json.Marshal(v.JSON())
+	return string(data)
+}
+
+// setQuery puts the value in a query for param: operators in the bracket
+// syntax Express, PHP and Rails decode into objects, e.g. name[$ne]=x
+func (v nosqlValue) setQuery(query url.Values, param string) {
+	query.Del(param)
+	if v.operator == "" {
+		query.Set(param, v.value)
+	} else {
+		query.Set(param+"["+v.operator+"]", v.value)
+	}
+}
+
+// nosqlPair is a condition injected in an always true and an always false
+// form
+type nosqlPair struct {
+	truthy nosqlValue
+	falsy  nosqlValue
+}
+
+// nosqlPairs returns the injected conditions for a canary value matching
+// nothing: operator objects for filters built from decoded input, and
+// JavaScript for $where clauses built by string concatenation
+func nosqlPairs(canary string) []nosqlPair {
+	return []nosqlPair{
+		{nosqlValue{"$ne", canary}, nosqlValue{"$eq", canary}},
+		{nosqlValue{"$regex", ".*"}, nosqlValue{"$regex", "^" + canary + "$"}},
+		{nosqlValue{"$gt", ""}, nosqlValue{"$lt", ""}},
+		{nosqlValue{"", canary + "' || 'a'=='a"}, nosqlValue{"", canary + "' && 'a'=='b"}},
+		{nosqlValue{"", canary + `" || "a"=="a`}, nosqlValue{"", canary + `" && "a"=="b`}},
+	}
+}
+
+// nosqlErrorProbes returns values that make a NoSQL backend reject the query
+// loudly: an operator that does not exist and syntax breaking out of a
+// string in a $where clause or an Elasticsearch query string
+func nosqlErrorProbes(canary string) []nosqlValue {
+	return []nosqlValue{
+		{"$gofuzz", canary},
+		{"", canary + `'"\{(`},
+	}
+}
+
+// nosqlFinding reports an injected condition confirmed by its effect on
+// the response
+func nosqlFinding(name string, pair nosqlPair, baseline, truthy, falsy *probeResponse) *Finding {
+	finding := &Finding{
+		Type:       "nosql-injection",
+		Severity:   SeverityHigh,
+		Confidence: ConfidenceFirm,
+		URL:        truthy.req.URL.String(),
+		Method:     truthy.req.Method,
+		Parameter:  name,
+		Payload:    pair.truthy.String(),
+		Evidence: fmt.Sprintf("%s=%s is answered with %s, unlike a value matching nothing and %s (%s)",
+			name, pair.truthy, truthy, pair.falsy, baseline),
+	}
+	captureExchange(finding, truthy.req, truthy.reqBody, truthy.resp, truthy.body)
+	return finding
+}
+
+// nosqlErrorFinding reports a NoSQL error an injected value caused
+func nosqlErrorFinding(name string, value nosqlValue, probe *probeResponse, signature string) *Finding {
+	finding := &Finding{
+		Type:       "nosql-injection",
+		Severity:   SeverityMedium,
+		Confidence: ConfidenceFirm,
+		URL:        probe.req.URL.String(),
+		Method:     probe.req.Method,
+		Parameter:  name,
+		Payload:    value.String(),
+		Evidence:   fmt.Sprintf("%s=%s causes a NoSQL error: %q", name, value, signature),
+	}
+	captureExchange(finding, probe.req, probe.reqBody, probe.resp, probe.body)
+	return finding
+}
+
+// probeNoSQLInjection injects MongoDB operators and $where JavaScript into
+// one query parameter. A condition is reported when its true form changes
+// the response and its false form does not, or when a value makes the
+// backend answer with a NoSQL error the ordinary value does not cause.
+func probeNoSQLInjection(client *http.Client, config *Config, rng *rand.Rand, targetURL, param string, deadline time.Time) (*Finding, error) {
+	parsed, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	send := func(value nosqlValue) (*probeResponse, error) {
+		u := *parsed
+		query := u.Query()
+		value.setQuery(query, param)
+		u.RawQuery = query.Encode()
+		req, resp, body, _, err := timedGet(client, config, u.String())
+		if err != nil {
+			return nil, err
+		}
+		return &probeResponse{req: req, resp: resp, body: body}, nil
+	}
+
+	return probeNoSQL(param, fmt.Sprintf("gfn%08x", rng.Uint32()), send, expired)
+}
+
+// probeNoSQL injects into one parameter or field through send, first for
+// NoSQL errors and then for conditions that flip the response. canary is an
+// ordinary value matching nothing. A flipped condition is reported over an
+// error, as it shows the injection is exploitable rather than only parsed.
+func probeNoSQL(name, canary string, send func(nosqlValue) (*probeResponse, error), expired func() bool) (*Finding, error) {
+	baseline, err := send(nosqlValue{value: canary})
+	if err != nil {
+		return nil, err
+	}
+	// A response that changes on every request cannot be diffed
+	again, err := send(nosqlValue{value: canary})
+	if err != nil {
+		return nil, err
+	}
+	stable := baseline.like(again)
+	baselineError := nosqlErrorSignatures.FindString(string(baseline.body))
+
+	var errorFinding *Finding
+	for _, value := range nosqlErrorProbes(canary) {
+		if expired() {
+			return nil, nil
+		}
+		probe, err := send(value)
+		if err != nil {
+			continue
+		}
+		if signature := nosqlErrorSignatures.FindString(string(probe.body)); signature != "" && baselineError == "" {
+			errorFinding = nosqlErrorFinding(name, value, probe, signature)
+			break
+		}
+	}
+	if stable {
+		if finding := probeNoSQLPairs(name, canary, baseline, send, expired); finding != nil {
+			return finding, nil
+		}
+	}
+	return errorFinding, nil
+}
+
+// probeNoSQLPairs sends the injected conditions in turn and returns the
+// first confirmed one. The true form is sent twice, so a response that
+// merely varies is not taken for a flipped condition.
+func probeNoSQLPairs(name, canary string, baseline *probeResponse, send func(nosqlValue) (*probeResponse, error), expired func() bool) *Finding {
+	for _, pair := range nosqlPairs(canary) {
+		if expired() {
+			return nil
+		}
+		truthy, err := send(pair.truthy)
+		if err != nil {
+			continue
+		}
+		falsy, err := send(pair.falsy)
+		if err != nil || !booleanConfirmed(baseline, truthy, falsy) {
+			continue
+		}
+		repeated, err := send(pair.truthy)
+		if err != nil || !repeated.like(truthy) {
+			continue
+		}
+		return nosqlFinding(name, pair, baseline, truthy, falsy)
+	}
+	return nil
+}
+
+// testNoSQLInjection replaces each string and number field of a valid body
+// in turn with MongoDB operators and $where JavaScript, where operator
+// injection usually succeeds: JSON bodies decode into objects without any
+// bracket syntax. Conditions are confirmed as for query parameters. Probing
+// stops at Config.Deadline.
+func (f *APIFuzzer) testNoSQLInjection(base map[string]interface{}) {
+	switch f.endpoint.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+
+	expired := func() bool {
+		return !f.config.Deadline.IsZero() && time.Now().After(f.config.Deadline)
+	}
+	for _, name := range sortedKeys(base) {
+		switch base[name].(type) {
+		case string, int, float64:
+		default:
+			continue
+		}
+		send := func(value nosqlValue) (*probeResponse, error) {
+			doc := copyMap(base)
+			doc[name] = value.JSON()
+			body, err := json.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			req, resp, respBody, err := f.exchange(f.endpoint.Method, f.endpoint.URL, body)
+			if err != nil {
+				return nil, err
+			}
+			return &probeResponse{req: req, reqBody: body, resp: resp, body: respBody}, nil
+		}
+		if expired() {
+			return
+		}
+		finding, err := probeNoSQL(name, fmt.Sprintf("gfn%08x", f.rng.Uint32()), send, expired)
+		if err != nil {
+			f.logger.Debug("NoSQL injection probe failed", "field", name, "error", err)
+			continue
+		}
+		if finding != nil {
+			finding.URL = f.endpoint.URL
+			finding.Method = f.endpoint.Method
+			if f.config.Findings.Add(finding) {
+				f.logger.Warn("NoSQL injection", "field", name, "evidence", finding.Evidence)
+			}
+		}
+	}
+}
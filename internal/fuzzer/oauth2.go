@@ -0,0 +1,180 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// tokenRefreshMargin is how long before expiry a token is replaced, so
+// requests in flight never carry an expired one
+const tokenRefreshMargin = time.Minute
+
+// OAuth2Config describes how to obtain access tokens. With a refresh token
+// the refresh-token grant is used, otherwise client credentials.
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RefreshToken string
+}
+
+// TokenSource fetches OAuth2 access tokens and refreshes them before they
+// expire. It is safe for concurrent use; all clients of a run share one.
+type TokenSource struct {
+	oauth   OAuth2Config
+	client  *http.Client
+	mu      sync.Mutex
+	token   string
+	refresh string    // Current refresh token, rotated when the server issues a new one
+	expiry  time.Time // Zero when the server gave no lifetime
+	logger  *slog.Logger
+}
+
+// tokenResponse is the token endpoint's reply (RFC 6749 section 5)
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewTokenSource creates a token source and fetches the first token, so bad
+// credentials fail the run at startup. The token endpoint is reached with
+// the connection settings of config, even in a dry run.
+func NewTokenSource(oauth OAuth2Config, config *Config) (*TokenSource, error) {
+	if oauth.TokenURL == "" || oauth.ClientID == "" {
+		return nil, fmt.Errorf("OAuth2 needs a token URL and a client ID")
+	}
+
+	live := *config
+	live.DryRun = nil
+	live.OAuth2 = nil
+	live.Headers = nil
+	live.Cookies = nil
+	client, err := newHTTPClient(&live, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TokenSource{
+		oauth:   oauth,
+		client:  client,
+		refresh: oauth.RefreshToken,
+		logger:  logging.For("oauth2"),
+	}
+	if _, err := s.Token(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Token returns a valid access token, fetching a new one when the current
+// one is missing or about to expire
+func (s *TokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && (s.expiry.IsZero() || time.Now().Add(tokenRefreshMargin).Before(s.expiry)) {
+		return s.token, nil
+	}
+	if err := s.fetch(); err != nil {
+		return "", err
+	}
+	return s.token, nil
+}
+
+// fetch requests a new token from the token endpoint; the caller holds mu
+func (s *TokenSource) fetch() error {
+	form := url.Values{}
+	if s.refresh != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", s.refresh)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(s.oauth.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.oauth.Scopes, " "))
+	}
+	if s.oauth.ClientSecret == "" {
+		form.Set("client_id", s.oauth.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.oauth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("invalid token URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.oauth.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.oauth.ClientID), url.QueryEscape(s.oauth.ClientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read token response: %v", err)
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("invalid token response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		reason := token.Error
+		if token.ErrorDescription != "" {
+			reason += ": " + token.ErrorDescription
+		}
+		return fmt.Errorf("token request rejected (HTTP %d): %s", resp.StatusCode, reason)
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return fmt.Errorf("unsupported token type %q", token.TokenType)
+	}
+
+	s.token = token.AccessToken
+	s.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	if token.RefreshToken != "" {
+		s.refresh = token.RefreshToken
+	}
+	s.logger.Info("obtained access token", "grant", form.Get("grant_type"), "expires", s.expiry)
+	return nil
+}
+
+// bearerTransport attaches the current access token to every request that
+// does not carry an Authorization header of its own
+type bearerTransport struct {
+	base   http.RoundTripper
+	tokens *TokenSource
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	token, err := t.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
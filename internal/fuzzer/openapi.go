@@ -0,0 +1,451 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSpecRefDepth bounds how many $ref links are followed along one path,
+// so recursive schemas terminate
+const maxSpecRefDepth = 8
+
+// specMethods are the operations fuzzed from a spec, in order. DELETE is
+// left out so a run never removes data.
+var specMethods = []string{"get", "post", "put", "patch"}
+
+// LoadAPISpec reads an OpenAPI 3 or Swagger 2 document, in JSON or YAML, and
+// returns an endpoint for every GET, POST, PUT and PATCH operation. Query
+// parameters and JSON request bodies become the endpoint's parameters, with
+// types and constraints from their schemas; path parameters are filled with
+// their examples. When baseURL is set it replaces the scheme and host of the
+// spec's server URL; otherwise the spec must declare an absolute one.
+func LoadAPISpec(path, baseURL string) ([]*APIEndpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API spec: %v", err)
+	}
+	return parseAPISpec(data, path, baseURL)
+}
+
+// parseAPISpec reads the endpoints of an OpenAPI or Swagger document named
+// path, a file name or URL, as LoadAPISpec does
+func parseAPISpec(data []byte, path, baseURL string) ([]*APIEndpoint, error) {
+	var doc interface{}
+	var err error
+	trimmed := strings.TrimSpace(string(data))
+	if strings.EqualFold(filepath.Ext(path), ".json") || strings.HasPrefix(trimmed, "{") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		doc, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API spec %s: %v", path, err)
+	}
+
+	root, ok := doc.(map[string]interface{})
+	if !ok || (root["openapi"] == nil && root["swagger"] == nil) {
+		return nil, fmt.Errorf("%s is not an OpenAPI or Swagger document", path)
+	}
+	spec := &apiSpec{doc: root}
+
+	base, err := spec.serverURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, _ := root["paths"].(map[string]interface{})
+	var endpoints []*APIEndpoint
+	for _, p := range sortedKeys(paths) {
+		item, _ := spec.resolve(paths[p], 0).(map[string]interface{})
+		for _, method := range specMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			endpoints = append(endpoints, spec.endpoint(base, p, method, item, op))
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%s declares no GET, POST, PUT or PATCH operations", path)
+	}
+	return endpoints, nil
+}
+
+// apiSpec is a decoded OpenAPI or Swagger document
+type apiSpec struct {
+	doc map[string]interface{}
+}
+
+// serverURL returns the base URL operations are relative to
+func (s *apiSpec) serverURL(baseURL string) (string, error) {
+	var server string
+	if servers, ok := s.doc["servers"].([]interface{}); ok && len(servers) > 0 {
+		// OpenAPI 3: the first server, with variables set to their defaults
+		first, _ := servers[0].(map[string]interface{})
+		server, _ = first["url"].(string)
+		variables, _ := first["variables"].(map[string]interface{})
+		for name, v := range variables {
+			variable, _ := v.(map[string]interface{})
+			server = strings.ReplaceAll(server, "{"+name+"}", fmt.Sprint(variable["default"]))
+		}
+	} else if host, ok := s.doc["host"].(string); ok {
+		// Swagger 2: scheme, host and base path are separate fields
+		scheme := "https"
+		if schemes, ok := s.doc["schemes"].([]interface{}); ok && len(schemes) > 0 {
+			scheme = fmt.Sprint(schemes[0])
+		}
+		basePath, _ := s.doc["basePath"].(string)
+		server = scheme + "://" + host + basePath
+	} else if basePath, ok := s.doc["basePath"].(string); ok {
+		server = basePath
+	}
+
+	parsed, err := url.Parse(server)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL %q in API spec: %v", server, err)
+	}
+	if baseURL == "" {
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return "", fmt.Errorf("API spec has no absolute server URL, a base URL is required")
+		}
+		return strings.TrimSuffix(parsed.String(), "/"), nil
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %v", err)
+	}
+	return strings.TrimSuffix(base.Scheme+"://"+base.Host+parsed.Path, "/"), nil
+}
+
+// endpoint builds the endpoint for one operation
+func (s *apiSpec) endpoint(base, path, method string, item, op map[string]interface{}) *APIEndpoint {
+	endpoint := &APIEndpoint{
+		Method:   strings.ToUpper(method),
+		Params:   make(map[string]ParamType),
+		Headers:  make(map[string]string),
+		Declared: true,
+	}
+	hasBody := method != "get"
+
+	// Operation parameters override path-level ones of the same name
+	params := make(map[string]map[string]interface{})
+	var order []string
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		entries, _ := list.([]interface{})
+		for _, entry := range entries {
+			param, ok := s.resolve(entry, 0).(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := fmt.Sprint(param["in"], ":", param["name"])
+			if params[key] == nil {
+				order = append(order, key)
+			}
+			params[key] = param
+		}
+	}
+
+	query := url.Values{}
+	for _, key := range order {
+		param := params[key]
+		name := fmt.Sprint(param["name"])
+		required, _ := param["required"].(bool)
+
+		// Swagger 2 puts the schema on the parameter itself
+		schema, ok := param["schema"].(map[string]interface{})
+		if !ok {
+			schema = param
+		}
+
+		switch param["in"] {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(specExample(param, schema)))
+		case "query":
+			if hasBody {
+				// Body operations are fuzzed through their body; required
+				// query parameters keep an example value
+				if required {
+					query.Set(name, specExample(param, schema))
+				}
+				continue
+			}
+			endpoint.Params[name] = specParamType(schema, required)
+		case "header":
+			if example := specExample(param, schema); required && example != "" {
+				endpoint.Headers[name] = example
+			}
+		case "body":
+			endpoint.BodySchema = schema
+		}
+	}
+
+	// OpenAPI 3 request bodies
+	if body, ok := s.resolve(op["requestBody"], 0).(map[string]interface{}); ok {
+		content, _ := body["content"].(map[string]interface{})
+		for _, mediaType := range sortedKeys(content) {
+			if !strings.Contains(mediaType, "json") {
+				continue
+			}
+			media, _ := content[mediaType].(map[string]interface{})
+			if schema, ok := media["schema"].(map[string]interface{}); ok {
+				endpoint.BodySchema = schema
+				break
+			}
+		}
+	}
+
+	if endpoint.BodySchema != nil {
+		endpoint.BodySchema = s.resolve(endpoint.BodySchema, 0).(map[string]interface{})
+		endpoint.Headers["Content-Type"] = "application/json"
+		if hasBody {
+			required := make(map[string]bool)
+			names, _ := endpoint.BodySchema["required"].([]interface{})
+			for _, name := range names {
+				required[fmt.Sprint(name)] = true
+			}
+			properties, _ := endpoint.BodySchema["properties"].(map[string]interface{})
+			for name, property := range properties {
+				schema, _ := property.(map[string]interface{})
+				endpoint.Params[name] = specParamType(schema, required[name])
+			}
+		}
+	}
+
+	// Declared responses, with the schemas their bodies are validated against
+	if responses, ok := op["responses"].(map[string]interface{}); ok {
+		endpoint.Responses = make(map[string]map[string]interface{}, len(responses))
+		for code, r := range responses {
+			response, _ := s.resolve(r, 0).(map[string]interface{})
+			endpoint.Responses[strings.ToUpper(code)] = responseSchema(response)
+		}
+	}
+
+	endpoint.URL = base + path
+	if len(query) > 0 {
+		endpoint.URL += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// responseSchema returns the schema of a declared response's JSON body: the
+// first JSON media type's in OpenAPI 3, the response's own in Swagger 2
+func responseSchema(response map[string]interface{}) map[string]interface{} {
+	content, _ := response["content"].(map[string]interface{})
+	for _, mediaType := range sortedKeys(content) {
+		if !strings.Contains(mediaType, "json") {
+			continue
+		}
+		media, _ := content[mediaType].(map[string]interface{})
+		if schema, ok := media["schema"].(map[string]interface{}); ok {
+			return schema
+		}
+	}
+	schema, _ := response["schema"].(map[string]interface{})
+	return schema
+}
+
+// resolve returns a copy of a spec node with $ref links replaced by their
+// targets. allOf schemas are merged into one object schema, oneOf and anyOf
+// take their first alternative, and schemas with properties but no type are
+// typed as objects, matching what schemaGrammar expects.
+func (s *apiSpec) resolve(node interface{}, depth int) interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if depth >= maxSpecRefDepth {
+				return map[string]interface{}{"type": "object"}
+			}
+			target, ok := s.lookup(ref)
+			if !ok {
+				return map[string]interface{}{}
+			}
+			return s.resolve(target, depth+1)
+		}
+
+		result := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			result[key] = s.resolve(value, depth)
+		}
+
+		if parts, ok := result["allOf"].([]interface{}); ok {
+			properties, _ := result["properties"].(map[string]interface{})
+			if properties == nil {
+				properties = make(map[string]interface{})
+			}
+			var required []interface{}
+			for _, part := range parts {
+				schema, _ := part.(map[string]interface{})
+				partProperties, _ := schema["properties"].(map[string]interface{})
+				for name, property := range partProperties {
+					properties[name] = property
+				}
+				partRequired, _ := schema["required"].([]interface{})
+				required = append(required, partRequired...)
+			}
+			delete(result, "allOf")
+			result["properties"] = properties
+			result["required"] = required
+		}
+		for _, key := range []string{"oneOf", "anyOf"} {
+			if alternatives, ok := result[key].([]interface{}); ok && len(alternatives) > 0 {
+				if first, ok := alternatives[0].(map[string]interface{}); ok {
+					return first
+				}
+			}
+		}
+		if _, ok := result["properties"]; ok && result["type"] == nil {
+			result["type"] = "object"
+		}
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = s.resolve(value, depth)
+		}
+		return result
+	}
+	return node
+}
+
+// lookup finds the node a local reference such as
+// "#/components/schemas/Pet" points to
+func (s *apiSpec) lookup(ref string) (interface{}, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+	var node interface{} = s.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if node, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// specParamType converts a parameter or property schema to a ParamType
+func specParamType(schema map[string]interface{}, required bool) ParamType {
+	param := ParamType{Type: "string", Required: required}
+	switch schema["type"] {
+	case "integer":
+		param.Type = "int"
+	case "number":
+		param.Type = "float"
+	case "boolean":
+		param.Type = "bool"
+	case "array":
+		param.Type = "array"
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			itemType := specParamType(items, false)
+			param.ArrayType = &itemType
+		}
+	case "object":
+		param.Type = "object"
+		properties, _ := schema["properties"].(map[string]interface{})
+		if len(properties) > 0 {
+			param.ObjectType = make(map[string]ParamType)
+			for name, property := range properties {
+				propertySchema, _ := property.(map[string]interface{})
+				param.ObjectType[name] = specParamType(propertySchema, false)
+			}
+		}
+	}
+
+	param.Format, _ = schema["format"].(string)
+	param.Pattern, _ = schema["pattern"].(string)
+	param.MinValue, param.HasMin = schema["minimum"].(float64)
+	param.MaxValue, param.HasMax = schema["maximum"].(float64)
+	param.MultipleOf, _ = schema["multipleOf"].(float64)
+	if n, ok := schema["minLength"].(float64); ok {
+		param.MinLength = int(n)
+	}
+	if n, ok := schema["maxLength"].(float64); ok {
+		param.MaxLength = int(n)
+	}
+	if values, ok := schema["enum"].([]interface{}); ok {
+		for _, value := range values {
+			param.Enum = append(param.Enum, fmt.Sprint(value))
+		}
+	}
+	return param
+}
+
+// specExample returns a value for a parameter: its example, its default, its
+// first enum value or a placeholder of its type
+func specExample(param, schema map[string]interface{}) string {
+	for _, value := range []interface{}{param["example"], schema["example"], schema["default"]} {
+		if value != nil {
+			return fmt.Sprint(value)
+		}
+	}
+	if values, ok := schema["enum"].([]interface{}); ok && len(values) > 0 {
+		return fmt.Sprint(values[0])
+	}
+	switch schema["type"] {
+	case "integer", "number":
+		return "1"
+	case "boolean":
+		return "true"
+	}
+	return "test"
+}
+
+// APISpecFuzzer fuzzes every operation declared in an OpenAPI or Swagger
+// document, one endpoint at a time. Each endpoint gets the API fuzzer's test
+// cases plus bodies generated from its declared schema.
+type APISpecFuzzer struct {
+	config       *Config
+	endpoints    []*APIEndpoint
+	orchestrator *Orchestrator
+}
+
+// NewAPISpecFuzzer loads the configured spec. The target URL, when set,
+// replaces the scheme and host of the spec's server; when unset it is taken
+// from the spec.
+func NewAPISpecFuzzer(config *Config) (*APISpecFuzzer, error) {
+	endpoints, err := LoadAPISpec(config.APISpec, config.TargetURL)
+	if err != nil {
+		return nil, err
+	}
+	if config.TargetURL == "" {
+		first, err := url.Parse(endpoints[0].URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint URL: %v", err)
+		}
+		config.TargetURL = first.Scheme + "://" + first.Host + "/"
+	}
+
+	orchestrator, err := NewOrchestrator(config)
+	if err != nil {
+		return nil, err
+	}
+	return &APISpecFuzzer{
+		config:       config,
+		endpoints:    endpoints,
+		orchestrator: orchestrator,
+	}, nil
+}
+
+// Endpoints returns the operations loaded from the spec
+func (f *APISpecFuzzer) Endpoints() []*APIEndpoint {
+	return f.endpoints
+}
+
+// Run fuzzes each endpoint, most promising first
+func (f *APISpecFuzzer) Run() error {
+	targets := make([]Target, len(f.endpoints))
+	for i, endpoint := range f.endpoints {
+		targets[i] = Target{Kind: TargetAPI, URL: endpoint.URL, Endpoint: endpoint}
+	}
+	return f.orchestrator.Fuzz(targets)
+}
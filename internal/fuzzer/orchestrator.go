@@ -0,0 +1,295 @@
+package fuzzer
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// defaultMaxPages bounds the crawl when no page limit is configured
+const defaultMaxPages = 100
+
+// Target kinds found during discovery
+const (
+	TargetForm   = "form"   // Page holding an HTML form
+	TargetAPI    = "api"    // Detected API endpoint
+	TargetParams = "params" // Page taking query parameters
+)
+
+// Target is an attack surface found while crawling
+type Target struct {
+	Kind     string
+	URL      string             // Page the target was found on
+	Form     *Form              // Form, for form targets
+	Endpoint *APIEndpoint       // Detected endpoint, for API targets
+	Params   *InventoryEndpoint // Parameters seen on the page, for params targets
+	Priority float64            // Weight of the target's share of the budget, set when fuzzing starts
+}
+
+// Orchestrator crawls the target, collects what can be attacked and runs
+// the matching fuzzer against each target. All fuzzers share the
+// configuration, the finding store and the result filter; the request
+// budget is split between them.
+type Orchestrator struct {
+	config *Config
+	logger *slog.Logger
+}
+
+// NewOrchestrator creates an orchestrator for the configured target
+func NewOrchestrator(config *Config) (*Orchestrator, error) {
+	if _, err := url.Parse(config.TargetURL); err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	return &Orchestrator{
+		config: config,
+		logger: logging.For("orchestrator"),
+	}, nil
+}
+
+// Run discovers targets and fuzzes each of them
+func (o *Orchestrator) Run() error {
+	targets, err := o.Discover()
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		o.logger.Warn("no targets discovered", "url", o.config.TargetURL)
+		return nil
+	}
+	return o.Fuzz(targets)
+}
+
+// Discover crawls the target without attacking it and returns the forms,
+// API endpoints and parameterized URLs found, in a stable order
+func (o *Orchestrator) Discover() ([]Target, error) {
+	crawler, err := o.crawl(0)
+	if err != nil {
+		return nil, err
+	}
+	return o.collectTargets(crawler), nil
+}
+
+// DiscoverSiteMap crawls the target without attacking it and returns a
+// site map of everything found
+func (o *Orchestrator) DiscoverSiteMap() (*SiteMap, error) {
+	crawler, err := o.crawl(0)
+	if err != nil {
+		return nil, err
+	}
+	return newSiteMap(o.config.TargetURL, crawler, o.collectTargets(crawler)), nil
+}
+
+// crawl runs a discovery-only crawl of the target, stopping it after
+// timeout when positive, else after the crawl stage budget when one is set
+func (o *Orchestrator) crawl(timeout time.Duration) (*WebCrawler, error) {
+	if timeout <= 0 {
+		timeout = o.config.StageBudgets[StageCrawl]
+	}
+	maxPages := o.config.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	crawler, err := NewWebCrawler(o.config.TargetURL, maxPages, true, o.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crawler: %v", err)
+	}
+	crawler.SetMaxWorkers(o.config.MaxWorkers)
+	crawler.SetDiscoveryOnly(true)
+
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			o.logger.Info("stopping crawl", "reason", "crawl budget reached", "after", timeout)
+			crawler.Stop()
+		})
+		defer timer.Stop()
+	}
+
+	o.logger.Info("crawling", "url", o.config.TargetURL, "max_pages", maxPages)
+	if err := crawler.Crawl(); err != nil {
+		return nil, fmt.Errorf("crawl failed: %v", err)
+	}
+
+	// The endpoint inventory outlives the run, for scoping and later runs
+	if len(crawler.GetAPIEndpoints()) > 0 && o.config.OutputDir != "" {
+		path := filepath.Join(o.config.OutputDir, "api-endpoints.json")
+		if err := crawler.apiDetector.SaveInventory(path); err != nil {
+			o.logger.Warn("failed to save API inventory", "error", err)
+		}
+	}
+
+	// So are the pages visited against robots directives, for audit
+	if overrides := crawler.GetRobotsOverrides(); len(overrides) > 0 {
+		for _, override := range overrides {
+			o.logger.Info("visited against robots directive", "url", override.URL, "rule", override.Rule,
+				"source", override.Source)
+		}
+		if o.config.OutputDir != "" {
+			path := filepath.Join(o.config.OutputDir, "robots-overrides.json")
+			if err := saveRobotsOverrides(path, overrides); err != nil {
+				o.logger.Warn("failed to save robots overrides", "error", err)
+			}
+		}
+	}
+	return crawler, nil
+}
+
+// collectTargets returns the forms, API endpoints and parameterized URLs a
+// crawl found, in a stable order
+func (o *Orchestrator) collectTargets(crawler *WebCrawler) []Target {
+	var targets []Target
+	forms := crawler.GetForms()
+	for _, pageURL := range sortedKeys(forms) {
+		for i := range forms[pageURL] {
+			targets = append(targets, Target{Kind: TargetForm, URL: pageURL, Form: &forms[pageURL][i]})
+		}
+	}
+
+	endpoints := crawler.GetAPIEndpoints()
+	for _, endpoint := range endpoints {
+		targets = append(targets, Target{Kind: TargetAPI, URL: endpoint.URL, Endpoint: endpoint})
+	}
+
+	// Links with query strings expose parameters, whose values the crawler
+	// learned. The parameters of every URL of a page are pooled, so the page
+	// is one target taking all of them.
+	visited := crawler.GetVisitedURLs()
+	sort.Strings(visited)
+	var parameterized []string
+	for _, pageURL := range visited {
+		parsed, err := url.Parse(pageURL)
+		if err == nil && parsed.RawQuery != "" && !crawler.apiDetector.Known(http.MethodGet, pageURL) {
+			parameterized = append(parameterized, pageURL)
+		}
+	}
+	inventory := buildParamInventory(parameterized)
+	for _, endpoint := range inventory {
+		targets = append(targets, Target{Kind: TargetParams, URL: endpoint.Example, Params: endpoint})
+	}
+	if len(inventory) > 0 && o.config.OutputDir != "" {
+		path := filepath.Join(o.config.OutputDir, "parameters.json")
+		if err := saveParamInventory(path, inventory); err != nil {
+			o.logger.Warn("failed to save parameter inventory", "error", err)
+		}
+	}
+
+	o.logger.Info("discovery complete", "pages", len(visited), "forms", len(forms),
+		"apis", len(endpoints), "parameterized", len(inventory), "targets", len(targets))
+	return targets
+}
+
+// Fuzz runs the fuzzer matching each target's kind, one target at a time so
+// the configured concurrency holds across the run. The most promising
+// targets go first and get the largest shares of the request budget.
+func (o *Orchestrator) Fuzz(targets []Target) error {
+	targets = prioritizeTargets(targets)
+	o.fuzzTargets(targets, requestShares(o.config.NumRequests, targets), o.config.Deadline)
+	o.logger.Info("orchestrated run complete", "targets", len(targets), "findings", o.config.Findings.Count())
+	return nil
+}
+
+// fuzzTargets fuzzes the targets in order, each with its share of requests.
+// Once the deadline passes, if one is set, the remaining targets are skipped
+// and the running fuzzer stops starting requests. A share of 0 leaves
+// requests unlimited and gives the target a slice of the time left instead,
+// in proportion to its priority, and targets with skippedShare are left
+// out. It returns the number of targets fuzzed.
+func (o *Orchestrator) fuzzTargets(targets []Target, shares []int, deadline time.Time) int {
+	fuzzed := 0
+	for i, target := range targets {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			o.logger.Warn("deadline reached, skipping remaining targets", "skipped", len(targets)-i)
+			return fuzzed
+		}
+		if shares[i] == skippedShare {
+			o.logger.Debug("no requests left in the budget, skipping target", "kind", target.Kind, "url", target.URL)
+			continue
+		}
+		fuzzed++
+
+		config := *o.config
+		config.TargetURL = target.URL
+		config.NumRequests = shares[i]
+		config.Deadline = deadline
+		if target.Kind == TargetForm {
+			// Form findings carry the page the form is on, as they are
+			// reported against the URL it submits to
+			config.Findings = config.Findings.WithSource(target.URL)
+		}
+		if shares[i] == 0 && !deadline.IsZero() {
+			config.Deadline = time.Now().Add(timeSlice(time.Until(deadline), targets[i:]))
+		}
+
+		o.logger.Info("fuzzing target", "kind", target.Kind, "url", target.URL,
+			"target", i+1, "of", len(targets), "priority", target.Priority, "requests", shares[i])
+
+		if err := o.fuzzTarget(target, &config); err != nil {
+			o.logger.Error("target failed", "kind", target.Kind, "url", target.URL, "error", err)
+		}
+	}
+	return fuzzed
+}
+
+// timeSlice returns the part of the time left that the first of the
+// remaining targets gets, in proportion to its priority
+func timeSlice(left time.Duration, remaining []Target) time.Duration {
+	total := 0.0
+	for _, target := range remaining {
+		total += target.Priority
+	}
+	if total <= 0 {
+		return left / time.Duration(len(remaining))
+	}
+	return time.Duration(float64(left) * remaining[0].Priority / total)
+}
+
+// fuzzTarget runs the fuzzer for one target
+func (o *Orchestrator) fuzzTarget(target Target, config *Config) error {
+	switch target.Kind {
+	case TargetForm:
+		fuzzer, err := newFormFuzzer(target.URL, *target.Form, config)
+		if err != nil {
+			return err
+		}
+		return fuzzer.Run()
+
+	case TargetAPI:
+		fuzzer := NewAPIFuzzer(target.Endpoint, config)
+		if config.APISchema {
+			if err := fuzzer.InferSchema(); err != nil {
+				o.logger.Debug("schema inference failed", "url", target.URL, "error", err)
+			}
+		}
+		return fuzzer.Run()
+
+	case TargetParams:
+		// Every parameter gets the payloads of its type first
+		if target.Params != nil {
+			sent, err := fuzzParams(target.Params, config)
+			if err != nil {
+				return err
+			}
+			if config.NumRequests > 0 {
+				if sent >= config.NumRequests {
+					return nil
+				}
+				config.NumRequests -= sent
+			}
+		}
+		// Then the rest of the budget mutates the query string, starting
+		// from the page with every parameter set
+		fuzzer, err := NewCoverageFuzzer(config)
+		if err != nil {
+			return err
+		}
+		fuzzer.corpus = append(fuzzer.corpus, target.URL)
+		return fuzzer.Run()
+	}
+	return fmt.Errorf("unknown target kind: %s", target.Kind)
+}
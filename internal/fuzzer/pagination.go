@@ -0,0 +1,314 @@
+package fuzzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// paginationCap is the page size taken as the most a list endpoint should
+// return when its spec declares no maximum
+const paginationCap = 100
+
+// Kinds of pagination, filtering and sorting parameters
+const (
+	pageSize   = "size"   // How many items a page holds, e.g. limit or per_page
+	pageOffset = "offset" // Which page or item a page starts at, e.g. page or skip
+	pageSort   = "sort"   // Which column items are sorted by
+	pageOrder  = "order"  // Which direction items are sorted in
+)
+
+// paginationParams map parameter names, lower-cased without _ and -, to
+// their kind
+var paginationParams = map[string]string{
+	"limit": pageSize, "size": pageSize, "pagesize": pageSize, "perpage": pageSize, "count": pageSize,
+	"top": pageSize, "take": pageSize, "first": pageSize, "max": pageSize, "maxresults": pageSize,
+	"page": pageOffset, "pagenumber": pageOffset, "pageno": pageOffset, "offset": pageOffset,
+	"skip": pageOffset, "start": pageOffset, "from": pageOffset,
+	"sort": pageSort, "sortby": pageSort, "orderby": pageSort, "sortfield": pageSort, "sortcolumn": pageSort,
+	"order": pageOrder, "direction": pageOrder, "dir": pageOrder, "sortorder": pageOrder, "sortdir": pageOrder,
+}
+
+// paginationBaseline are the values pagination parameters take in the
+// baseline request; sort parameters are left out of it
+var paginationBaseline = map[string]interface{}{pageSize: 10, pageOffset: 1}
+
+// paginationValues are the extreme values each kind of parameter is sent:
+// huge, negative and zero page sizes, pages past the end and below the
+// first, and sort directions and columns built to break into SQL
+var paginationValues = map[string][]interface{}{
+	pageSize:   {1000000, -1, 0},
+	pageOffset: {-1, 99999999, 2147483648},
+	pageSort:   {"id'", "(select 1)", "id desc,1/0"},
+	pageOrder:  {"sideways", "asc'", "desc,(select 1)"},
+}
+
+// hiddenSortColumns are columns list endpoints hold but rarely list, whose
+// values sorting by them leaks one comparison at a time
+var hiddenSortColumns = []string{"password", "password_hash", "secret", "token", "api_key", "email"}
+
+// unknownSortColumn is a column no endpoint has, the control hidden columns
+// are compared against
+const unknownSortColumn = "gofuzz_nonexistent"
+
+// paginationKind returns the kind of a parameter, or "" when it is not a
+// pagination, filtering or sorting parameter
+func paginationKind(name string) string {
+	normalized := strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+	return paginationParams[normalized]
+}
+
+// testPagination finds the endpoint's pagination and sorting parameters and
+// sends each extreme values, against a baseline asking for a small first
+// page. A request much slower than the baseline is reported as
+// pagination-slow, a database error the baseline did not show as
+// pagination-sql-error, and a page size the server does not cap, returning
+// more than the declared maximum or paginationCap items, as
+// pagination-overexposure. A column the items do not list that the server
+// sorts by is reported as pagination-hidden-sort.
+func (f *APIFuzzer) testPagination(base map[string]interface{}) {
+	kinds := make(map[string]string)
+	values := copyMap(base)
+	for _, name := range sortedKeys(f.endpoint.Params) {
+		kind := paginationKind(name)
+		if kind == "" {
+			continue
+		}
+		kinds[name] = kind
+		if value, ok := paginationBaseline[kind]; ok {
+			values[name] = value
+		} else {
+			delete(values, name)
+		}
+	}
+	if len(kinds) == 0 {
+		return
+	}
+
+	baseline, baseTime, err := f.sendPage(values)
+	if err != nil || baseline.resp.StatusCode < 200 || baseline.resp.StatusCode >= 300 {
+		f.logger.Debug("pagination baseline rejected", "error", err)
+		return
+	}
+	limit := stressSlowdown * baseTime
+	if limit < baseTime+stressMinDelay {
+		limit = baseTime + stressMinDelay
+	}
+	baseSignature := sqlErrorSignature(baseline.body)
+	baseItems, _ := pageItems(baseline.body)
+
+	for _, name := range sortedKeys(kinds) {
+		kind := kinds[name]
+		for _, value := range paginationValues[kind] {
+			probe := copyMap(values)
+			probe[name] = value
+			result, elapsed, err := f.sendPage(probe)
+			if err != nil {
+				f.logger.Debug("pagination probe failed", "param", name, "value", value, "error", err)
+				continue
+			}
+			if elapsed >= limit {
+				f.reportPagination("pagination-slow", SeverityMedium, ConfidenceTentative, name, value, result,
+					fmt.Sprintf("%s=%v answered after %s, against %s for the baseline", name, value,
+						elapsed.Round(time.Millisecond), baseTime.Round(time.Millisecond)))
+			}
+			if signature := sqlErrorSignature(result.body); signature != "" && signature != baseSignature {
+				f.reportPagination("pagination-sql-error", SeverityHigh, ConfidenceFirm, name, value, result,
+					fmt.Sprintf("%s=%v made the server answer with the database error %q", name, value, signature))
+			}
+			if kind == pageSize {
+				f.checkOverexposure(name, value, result, len(baseItems))
+			}
+		}
+		if kind == pageSort {
+			f.testHiddenSort(values, name)
+		}
+	}
+}
+
+// checkOverexposure reports a page size probe answered with more items than
+// the baseline and than the parameter's declared maximum, or paginationCap
+func (f *APIFuzzer) checkOverexposure(name string, value interface{}, result *probeResponse, baseCount int) {
+	if result.resp.StatusCode < 200 || result.resp.StatusCode >= 300 {
+		return
+	}
+	items, ok := pageItems(result.body)
+	if !ok {
+		return
+	}
+	max := paginationCap
+	if param := f.endpoint.Params[name]; param.HasMax {
+		max = int(param.MaxValue)
+	}
+	if len(items) <= max || len(items) <= baseCount {
+		return
+	}
+	f.reportPagination("pagination-overexposure", SeverityMedium, ConfidenceFirm, name, value, result,
+		fmt.Sprintf("%s=%v returned %d items, more than the maximum page size of %d, against %d for %s=%v",
+			name, value, len(items), max, baseCount, name, paginationBaseline[pageSize]))
+}
+
+// testHiddenSort sorts by each hidden column the items do not list and,
+// twice, by a column that does not exist. A hidden column the server
+// accepts while rejecting the unknown one, or that returns other items or
+// another order than the unknown one steadily returns, is one the server
+// sorts by.
+func (f *APIFuzzer) testHiddenSort(values map[string]interface{}, name string) {
+	sortBy := func(column string) (*probeResponse, []interface{}, bool) {
+		probe := copyMap(values)
+		probe[name] = column
+		result, _, err := f.sendPage(probe)
+		if err != nil {
+			return nil, nil, false
+		}
+		items, _ := pageItems(result.body)
+		return result, items, result.resp.StatusCode >= 200 && result.resp.StatusCode < 300
+	}
+	_, controlItems, controlOK := sortBy(unknownSortColumn)
+	_, repeatItems, _ := sortBy(unknownSortColumn)
+	stable := sameOrder(controlItems, repeatItems)
+
+	for _, column := range hiddenSortColumns {
+		result, items, ok := sortBy(column)
+		if !ok || listsField(items, column) {
+			continue
+		}
+		switch {
+		case !controlOK:
+			f.reportPagination("pagination-hidden-sort", SeverityMedium, ConfidenceFirm, name, column, result,
+				fmt.Sprintf("%s=%s was accepted while %s=%s was rejected, though the items do not list %s",
+					name, column, name, unknownSortColumn, column))
+		case stable && len(items) > 1 && len(items) == len(controlItems) && !sameOrder(items, controlItems):
+			f.reportPagination("pagination-hidden-sort", SeverityMedium, ConfidenceTentative, name, column, result,
+				fmt.Sprintf("%s=%s returned other items or another order than %s=%s, though the items do not list %s",
+					name, column, name, unknownSortColumn, column))
+		default:
+			continue
+		}
+		return // One column is enough to show the leak
+	}
+}
+
+// sendPage sends the endpoint with the given values and returns the
+// response with how long it took
+func (f *APIFuzzer) sendPage(values map[string]interface{}) (*probeResponse, time.Duration, error) {
+	req, reqBody, err := f.valuesRequest(values)
+	if err != nil {
+		return nil, 0, err
+	}
+	payload, _ := json.Marshal(values)
+	start := time.Now()
+	result, err := f.send(req, reqBody, string(payload))
+	return result, time.Since(start), err
+}
+
+// valuesRequest builds a request to the endpoint with the given values, in
+// the query string of GET requests, replacing those in its URL, or as the
+// JSON body of others
+func (f *APIFuzzer) valuesRequest(values map[string]interface{}) (*http.Request, []byte, error) {
+	switch f.endpoint.Method {
+	case "", http.MethodGet:
+		target, err := url.Parse(f.endpoint.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		query := target.Query()
+		for key, value := range values {
+			query.Set(key, fmt.Sprint(value))
+		}
+		target.RawQuery = query.Encode()
+		req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+		return req, nil, err
+	}
+	reqBody, err := json.Marshal(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest(f.endpoint.Method, f.endpoint.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, reqBody, nil
+}
+
+// reportPagination records a pagination abuse finding
+func (f *APIFuzzer) reportPagination(kind string, severity Severity, confidence Confidence, name string, value interface{},
+	result *probeResponse, evidence string) {
+	finding := &Finding{
+		Type:       kind,
+		Severity:   severity,
+		Confidence: confidence,
+		URL:        f.endpoint.URL,
+		Method:     result.req.Method,
+		Parameter:  name,
+		Payload:    fmt.Sprintf("%s=%v", name, value),
+		Evidence:   evidence,
+	}
+	captureExchange(finding, result.req, result.reqBody, result.resp, result.body)
+	if f.config.Findings.Add(finding) {
+		f.logger.Warn("pagination abuse", "type", kind, "param", name, "evidence", evidence)
+	}
+}
+
+// pageItems returns the items of a list response: the document when it is
+// an array, else the longest array among its fields and theirs, up to
+// maxFieldDepth levels down, e.g. in a "data" or "items" wrapper. It reports
+// false when the body is not JSON holding an array.
+func pageItems(body []byte) ([]interface{}, bool) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, false
+	}
+	return longestArray(doc, 0)
+}
+
+// longestArray returns the longest array in a decoded JSON document
+func longestArray(doc interface{}, depth int) ([]interface{}, bool) {
+	switch v := doc.(type) {
+	case []interface{}:
+		return v, true
+	case map[string]interface{}:
+		if depth > maxFieldDepth {
+			return nil, false
+		}
+		var longest []interface{}
+		found := false
+		for _, key := range sortedKeys(v) {
+			if items, ok := longestArray(v[key], depth+1); ok && (!found || len(items) > len(longest)) {
+				longest, found = items, true
+			}
+		}
+		return longest, found
+	}
+	return nil, false
+}
+
+// listsField reports whether any item is an object with the named field
+func listsField(items []interface{}, name string) bool {
+	for _, item := range items {
+		if _, ok := jsonField(item, name, 0); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// encodedItems returns the items each encoded as JSON
+func encodedItems(items []interface{}) []string {
+	encoded := make([]string, len(items))
+	for i, item := range items {
+		data, _ := json.Marshal(item)
+		encoded[i] = string(data)
+	}
+	return encoded
+}
+
+// sameOrder reports whether two lists hold equal items in the same order
+func sameOrder(a, b []interface{}) bool {
+	return strings.Join(encodedItems(a), "\n") == strings.Join(encodedItems(b), "\n")
+}
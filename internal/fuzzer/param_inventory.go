@@ -0,0 +1,261 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// maxParamSamples bounds the distinct values kept per parameter
+const maxParamSamples = 10
+
+// Types inferred for query parameters from the values seen
+const (
+	ParamInteger = "integer"
+	ParamNumber  = "number"
+	ParamBoolean = "boolean"
+	ParamUUID    = "uuid"
+	ParamEmail   = "email"
+	ParamURL     = "url"
+	ParamDate    = "date"
+	ParamPath    = "path"
+	ParamString  = "string"
+)
+
+// Patterns the values of a parameter type match
+var (
+	integerValue = regexp.MustCompile(`^-?\d+$`)
+	numberValue  = regexp.MustCompile(`^-?(\d+\.\d*|\.\d+|\d+(\.\d*)?[eE][-+]?\d+)$`)
+	booleanValue = regexp.MustCompile(`(?i)^(true|false|yes|no|on|off)$`)
+	uuidValue    = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	urlValue     = regexp.MustCompile(`(?i)^((https?|ftp)://|//)\S+$`)
+	pathValue    = regexp.MustCompile(`^[\w\-.~%]*(/[\w\-.~%]*)+$|^[\w\-~%]+\.[A-Za-z0-9]{1,5}$`)
+)
+
+// paramPayloads are the payloads each parameter is sent, by its type: values
+// just outside what the type accepts, and the attacks values of the type
+// lend themselves to
+var paramPayloads = map[string][]string{
+	ParamInteger: {"0", "-1", "2147483648", "-2147483649", "99999999999999999999", "1.5", "1e309", "0x10",
+		"1'", "1 OR 1=1", "1;--", "[]"},
+	ParamNumber:  {"0", "-0", "NaN", "Infinity", "-Infinity", "1e309", "1e-400", "0.1.2", "1'", "1 OR 1=1"},
+	ParamBoolean: {"0", "1", "2", "-1", "null", "TRUE", "yes'", "true OR 1=1"},
+	ParamUUID: {"00000000-0000-0000-0000-000000000000", "ffffffff-ffff-ffff-ffff-ffffffffffff",
+		"00000000-0000-0000-0000", "' OR '1'='1", "{{7*7}}"},
+	ParamEmail: {"a@b", "@example.com", "test@example.com'", "\"<svg onload=alert(1)>\"@example.com",
+		"test@example.com%0d%0aBcc:gofuzz@example.com", "test@example.com' OR '1'='1"},
+	ParamURL: {"http://127.0.0.1/", "http://169.254.169.254/latest/meta-data/", "file:///etc/passwd",
+		"//gofuzz.example/", "https://gofuzz.example/", "javascript:alert(1)", "http://[::1]/"},
+	ParamDate: {"0000-00-00", "9999-12-31", "2024-02-30", "1970-01-01'", "-1", "now",
+		"2024-01-01T00:00:00Z' OR '1'='1"},
+	ParamPath: {"../../../../etc/passwd", "..%2f..%2f..%2f..%2fetc%2fpasswd", "....//....//....//etc/passwd",
+		"/etc/passwd%00", "..\\..\\..\\windows\\win.ini", "php://filter/convert.base64-encode/resource=index",
+		"file:///etc/passwd"},
+	ParamString: {"<script>alert(1)</script>", "\"><img src=x onerror=alert(1)>", "' OR '1'='1", "1' ORDER BY 1--",
+		"{{7*7}}", "${7*7}", "; cat /etc/passwd", "| whoami", "../../../etc/passwd", strings.Repeat("A", 4096)},
+}
+
+// InventoryParam is a query parameter seen on an endpoint while crawling
+type InventoryParam struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Samples []string `json:"samples"` // Distinct values seen, up to maxParamSamples
+}
+
+// InventoryEndpoint is a page and every query parameter seen on it, across
+// all the URLs of it the crawl visited
+type InventoryEndpoint struct {
+	URL     string            `json:"url"`     // The page, without query
+	Example string            `json:"example"` // The page with every parameter set to its first sample
+	Params  []*InventoryParam `json:"params"`
+}
+
+// buildParamInventory aggregates the query parameters of urls per endpoint,
+// that is scheme, host and path, in the order endpoints and parameters are
+// first seen, and infers each parameter's type from its values
+func buildParamInventory(urls []string) []*InventoryEndpoint {
+	var inventory []*InventoryEndpoint
+	endpoints := make(map[string]*InventoryEndpoint)
+	for _, raw := range urls {
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.RawQuery == "" {
+			continue
+		}
+		base := *parsed
+		base.Host = canonicalHost(parsed)
+		base.RawQuery = ""
+		base.Fragment = ""
+		base.RawFragment = ""
+		key := base.String()
+
+		endpoint, ok := endpoints[key]
+		if !ok {
+			endpoint = &InventoryEndpoint{URL: key}
+			endpoints[key] = endpoint
+			inventory = append(inventory, endpoint)
+		}
+		values := parsed.Query()
+		for _, name := range queryParamNames(parsed.RawQuery) {
+			param := endpoint.param(name)
+			for _, value := range values[name] {
+				param.observe(value)
+			}
+		}
+	}
+
+	for _, endpoint := range inventory {
+		query := ""
+		for _, param := range endpoint.Params {
+			param.Type = inferParamType(param.Samples)
+			sample := ""
+			if len(param.Samples) > 0 {
+				sample = param.Samples[0]
+			}
+			query = replaceQueryParam(query, param.Name, sample)
+		}
+		endpoint.Example = endpoint.URL + "?" + query
+	}
+	return inventory
+}
+
+// param returns the endpoint's parameter of the given name, adding it when
+// it is new
+func (e *InventoryEndpoint) param(name string) *InventoryParam {
+	for _, param := range e.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	param := &InventoryParam{Name: name, Samples: []string{}}
+	e.Params = append(e.Params, param)
+	return param
+}
+
+// observe records a value of the parameter, if it is new and there is room
+func (p *InventoryParam) observe(value string) {
+	if len(p.Samples) >= maxParamSamples {
+		return
+	}
+	for _, sample := range p.Samples {
+		if sample == value {
+			return
+		}
+	}
+	p.Samples = append(p.Samples, value)
+}
+
+// inferParamType returns the type every non-empty sample fits, integers
+// counting as numbers when some samples are decimals, and ParamString when
+// they fit none in common
+func inferParamType(samples []string) string {
+	inferred := ""
+	for _, sample := range samples {
+		if sample == "" {
+			continue
+		}
+		kind := valueType(sample)
+		switch {
+		case inferred == "" || inferred == kind:
+			inferred = kind
+		case (inferred == ParamInteger && kind == ParamNumber) || (inferred == ParamNumber && kind == ParamInteger):
+			inferred = ParamNumber
+		default:
+			return ParamString
+		}
+	}
+	if inferred == "" {
+		return ParamString
+	}
+	return inferred
+}
+
+// valueType returns the type of a single value
+func valueType(value string) string {
+	switch {
+	case integerValue.MatchString(value):
+		return ParamInteger
+	case numberValue.MatchString(value):
+		return ParamNumber
+	case booleanValue.MatchString(value):
+		return ParamBoolean
+	case uuidValue.MatchString(value):
+		return ParamUUID
+	case urlValue.MatchString(value):
+		return ParamURL
+	case isEmail(value):
+		return ParamEmail
+	case isDate(value):
+		return ParamDate
+	case pathValue.MatchString(value):
+		return ParamPath
+	}
+	return ParamString
+}
+
+// saveParamInventory writes the parameter inventory to path as an indented
+// JSON array
+func saveParamInventory(path string, inventory []*InventoryEndpoint) error {
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode parameter inventory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write parameter inventory: %v", err)
+	}
+	return nil
+}
+
+// fuzzParams sends every parameter of an endpoint the payloads of its type,
+// one parameter at a time, the others keeping their first sample. Responses
+// go through the detectors like any fuzzed response. It stops at the
+// configured request budget or deadline and returns the requests sent.
+func fuzzParams(endpoint *InventoryEndpoint, config *Config) (int, error) {
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return 0, err
+	}
+	example, err := url.Parse(endpoint.Example)
+	if err != nil {
+		return 0, fmt.Errorf("invalid endpoint URL: %v", err)
+	}
+	logger := logging.For("params")
+
+	budget := newRequestBudget(config.NumRequests, config.Deadline)
+	for _, param := range endpoint.Params {
+		for _, payload := range paramPayloads[param.Type] {
+			if _, ok := budget.take(); !ok {
+				return budget.used(), nil
+			}
+			target := *example
+			target.RawQuery = replaceQueryParam(example.RawQuery, param.Name, payload)
+			req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+			if err != nil {
+				continue
+			}
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				inspectFailure(config, req, nil, err, payload)
+				logger.Debug("request failed", "url", target.String(), "error", err)
+				continue
+			}
+			body, _ := readLimited(resp.Body, maxBodySize(config))
+			resp.Body.Close()
+			inspectResponse(config, req, nil, resp, body.data, payload)
+			logger.Debug("tested parameter", "param", param.Name, "type", param.Type, "status", resp.StatusCode,
+				"elapsed", time.Since(start))
+		}
+	}
+	return budget.used(), nil
+}
@@ -0,0 +1,220 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Supported values for Config.PayloadPosition, where the basic fuzzer puts
+// payloads
+const (
+	PositionPath     = "path"     // Appended to the target's path as a new segment
+	PositionQuery    = "query"    // The value of Config.PayloadParam in the target's query
+	PositionFragment = "fragment" // The fragment, which clients keep to themselves
+	PositionMarker   = "marker"   // In place of the FUZZ marker in the target URL's path or query
+	PositionParams   = "params"   // The value of each of the target's query parameters in turn
+	PositionBody     = "body"     // The value of Config.PayloadParam in a form-encoded POST body
+	PositionHeader   = "header"   // The value of the header named by Config.PayloadParam
+)
+
+// Parameters payloads go in when Config.PayloadParam is unset: for the
+// query, the target's first parameter if it has any, else defaultPayloadParam
+const (
+	defaultPayloadParam  = "q"
+	defaultPayloadHeader = "User-Agent"
+)
+
+// payloadPlacement builds the requests the basic fuzzer sends payloads in,
+// keeping the target's path, query and host, IPv6 literals included, as
+// they are apart from the payload. A payload is sent once per slot: once
+// for most positions, once per query parameter for PositionParams.
+type payloadPlacement struct {
+	target   *url.URL
+	raw      string // The target URL as given, for PositionMarker
+	position string
+	param    string
+	params   []string // The target's query parameters, for PositionParams
+}
+
+// newPayloadPlacement parses the target URL of config for placing payloads.
+// Without a position, payloads replace the FUZZ marker when the target URL
+// has one and are appended to its path otherwise.
+func newPayloadPlacement(config *Config) (*payloadPlacement, error) {
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("target URL %s needs a scheme and a host", config.TargetURL)
+	}
+	target.Fragment = ""
+	target.RawFragment = ""
+
+	p := &payloadPlacement{target: target, raw: config.TargetURL, position: config.PayloadPosition, param: config.PayloadParam}
+	if p.position == "" {
+		p.position = PositionPath
+		if strings.Contains(config.TargetURL, FuzzMarker) {
+			p.position = PositionMarker
+		}
+	}
+	switch p.position {
+	case PositionMarker:
+		if !strings.Contains(target.EscapedPath()+"?"+target.RawQuery, FuzzMarker) {
+			return nil, fmt.Errorf("target URL %s has no %s marker in its path or query", config.TargetURL, FuzzMarker)
+		}
+		p.raw, _, _ = strings.Cut(p.raw, "#")
+	case PositionParams:
+		p.params = queryParamNames(target.RawQuery)
+		if len(p.params) == 0 {
+			return nil, fmt.Errorf("target URL %s has no query parameters to fuzz in turn", config.TargetURL)
+		}
+	}
+	if p.param == "" {
+		switch p.position {
+		case PositionHeader:
+			p.param = defaultPayloadHeader
+		case PositionQuery:
+			p.param = defaultPayloadParam
+			if names := queryParamNames(target.RawQuery); len(names) > 0 {
+				p.param = names[0]
+			}
+		default:
+			p.param = defaultPayloadParam
+		}
+	}
+	return p, nil
+}
+
+// slots returns how many requests each payload is sent in
+func (p *payloadPlacement) slots() int {
+	if p.position == PositionParams {
+		return len(p.params)
+	}
+	return 1
+}
+
+// request builds the request carrying payload in the given slot, and
+// describes where the payload went when the URL does not show it
+func (p *payloadPlacement) request(payload string, slot int) (*http.Request, string, error) {
+	switch p.position {
+	case PositionBody:
+		body := replaceQueryParam("", p.param, payload)
+		req, err := http.NewRequest(http.MethodPost, p.target.String(), strings.NewReader(body))
+		if err != nil {
+			return nil, "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, "body " + p.param, nil
+
+	case PositionHeader:
+		req, err := http.NewRequest(http.MethodGet, p.target.String(), nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if strings.EqualFold(p.param, "Host") {
+			req.Host = payload
+		} else {
+			req.Header.Set(p.param, payload)
+		}
+		return req, "header " + p.param, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.url(payload, slot), nil)
+	return req, "", err
+}
+
+// url returns the URL carrying payload in the given slot, for the positions
+// within the URL
+func (p *payloadPlacement) url(payload string, slot int) string {
+	u := *p.target
+	switch p.position {
+	case PositionQuery:
+		u.RawQuery = replaceQueryParam(u.RawQuery, p.param, payload)
+	case PositionParams:
+		u.RawQuery = replaceQueryParam(u.RawQuery, p.params[slot], payload)
+	case PositionFragment:
+		u.Fragment = payload
+	case PositionMarker:
+		// The marker is replaced as text, escaped for the part it is in
+		path, query, found := strings.Cut(p.raw, "?")
+		path = strings.ReplaceAll(path, FuzzMarker, escapePathPayload(payload))
+		if !found {
+			return path
+		}
+		return path + "?" + strings.ReplaceAll(query, FuzzMarker, url.QueryEscape(payload))
+	default:
+		raw := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + escapePathPayload(payload)
+		if path, err := url.PathUnescape(raw); err == nil {
+			u.Path = path
+			u.RawPath = raw
+		}
+	}
+	return u.String()
+}
+
+// queryParamNames returns the names of the parameters of rawQuery in the
+// order they first appear
+func queryParamNames(rawQuery string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		name, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil || name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// replaceQueryParam returns rawQuery with the first value of param set to
+// value, or with param added when it is missing. The other parameters keep
+// their order and encoding.
+func replaceQueryParam(rawQuery, param, value string) string {
+	pair := url.QueryEscape(param) + "=" + url.QueryEscape(value)
+	if rawQuery == "" {
+		return pair
+	}
+	pairs := strings.Split(rawQuery, "&")
+	for i, existing := range pairs {
+		name, _, _ := strings.Cut(existing, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && unescaped == param {
+			pairs[i] = pair
+			return strings.Join(pairs, "&")
+		}
+	}
+	return rawQuery + "&" + pair
+}
+
+// escapePathPayload escapes the characters of a payload that would end the
+// path or are not allowed in it, such as ?, # and spaces. Slashes, dot
+// segments and valid percent-encodings are kept, so payloads like
+// admin/config or %2e%2e%2f reach the server as written.
+func escapePathPayload(payload string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(payload); i++ {
+		c := payload[i]
+		switch {
+		case c == '%' && i+2 < len(payload) && isHex(payload[i+1]) && isHex(payload[i+2]):
+			b.WriteByte(c)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.IndexByte("-._~!$&'()*+,;=:@/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// isHex reports whether c is a hexadecimal digit
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,138 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"plugin"
+	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Detector is a custom check run on every fuzzed exchange next to the built-in
+// ones, e.g. for product-specific error signatures or a proprietary auth
+// header. Findings without a URL or method get the request's; payload and the
+// raw exchange are filled in. Detect is called from many workers at once.
+type Detector interface {
+	// Name identifies the detector in logs
+	Name() string
+	// Detect inspects a response to req and returns what it finds
+	Detect(req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) []*Finding
+}
+
+// Mutator is a custom mutation strategy the mutation and coverage fuzzers
+// choose next to their built-in ones. Inputs are URLs. Mutate is called from
+// many workers at once, each with its own rng.
+type Mutator interface {
+	// Name identifies the mutator in logs
+	Name() string
+	// Mutate returns a variant of input
+	Mutate(rng *rand.Rand, input string) string
+}
+
+// registry holds the detectors, mutators and hooks registered by linked-in
+// packages and loaded plugins
+var registry struct {
+	mu        sync.Mutex
+	detectors []Detector
+	mutators  []Mutator
+	hooks     []Hooks
+}
+
+// RegisterDetector adds a detector to every Config created afterwards by
+// DefaultConfig. Packages linked into a custom build call it from init, as
+// do plugins loaded with LoadPlugin.
+func RegisterDetector(d Detector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.detectors = append(registry.detectors, d)
+}
+
+// RegisterMutator adds a mutator to every Config created afterwards by
+// DefaultConfig
+func RegisterMutator(m Mutator) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.mutators = append(registry.mutators, m)
+}
+
+// RegisterHooks adds hooks to every Config created afterwards by
+// DefaultConfig
+func RegisterHooks(h Hooks) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.hooks = append(registry.hooks, h)
+}
+
+// RegisteredDetectors returns the registered detectors in registration order
+func RegisteredDetectors() []Detector {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]Detector(nil), registry.detectors...)
+}
+
+// RegisteredMutators returns the registered mutators in registration order
+func RegisteredMutators() []Mutator {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]Mutator(nil), registry.mutators...)
+}
+
+// RegisteredHooks returns the registered hooks in registration order
+func RegisteredHooks() []Hooks {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]Hooks(nil), registry.hooks...)
+}
+
+// LoadPlugin opens a Go plugin (.so) built with -buildmode=plugin, whose init
+// functions register its detectors, mutators and hooks. Plugins must be built
+// with the same Go version and gofuzz module version as the fuzzer, and only
+// load on platforms Go supports plugins on.
+func LoadPlugin(path string) error {
+	before := registered()
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("failed to load plugin %s: %v", path, err)
+	}
+	if registered() == before {
+		return fmt.Errorf("plugin %s registered no detectors, mutators or hooks", path)
+	}
+	return nil
+}
+
+// registered counts what has been registered
+func registered() int {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return len(registry.detectors) + len(registry.mutators) + len(registry.hooks)
+}
+
+// runDetectors runs the configured detectors on one exchange. A detector that
+// panics is skipped for that exchange rather than ending the run.
+func runDetectors(config *Config, req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) []*Finding {
+	var findings []*Finding
+	for _, d := range config.Detectors {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logging.For("plugins").Warn("detector panicked", "detector", d.Name(), "url", req.URL.String(), "panic", r)
+				}
+			}()
+			findings = append(findings, d.Detect(req, reqBody, resp, body, payload)...)
+		}()
+	}
+	return findings
+}
+
+// applyMutator runs a configured mutator on input, keeping input when the
+// mutator panics
+func applyMutator(m Mutator, rng *rand.Rand, input string) (mutated string) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.For("plugins").Warn("mutator panicked", "mutator", m.Name(), "input", input, "panic", r)
+			mutated = input
+		}
+	}()
+	return m.Mutate(rng, input)
+}
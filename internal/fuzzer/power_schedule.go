@@ -0,0 +1,151 @@
+package fuzzer
+
+import "log/slog"
+
+// Supported values for Config.PowerSchedule, how the coverage-guided
+// mutation fuzzer shares its mutations among the seeds in its population
+const (
+	ScheduleExploit = "exploit" // Seeds that reached new coverage get 10 times the mutations until one of their mutations does not
+	ScheduleExplore = "explore" // Every seed gets the same share
+	ScheduleFast    = "fast"    // Seeds on rarely hit paths get exponentially more the more they are chosen, as in AFLFast
+	ScheduleDecay   = "decay"   // Seeds get fewer the longer they have been in the population
+)
+
+// Energies of the exploit schedule
+const (
+	exploitEnergy = 10
+	baseEnergy    = 1
+)
+
+// Energy of the fast schedule: fastEnergy doubled each time a seed is
+// chosen, at most maxFastDoublings times, divided by how often its path was
+// hit, and capped at maxEnergy
+const (
+	fastEnergy       = 16
+	maxFastDoublings = 10
+	maxEnergy        = 1024
+)
+
+// Energy of the decay schedule: decayEnergy halved every decayHalfLife
+// requests a seed has been in the population
+const (
+	decayEnergy   = 64
+	decayHalfLife = 100
+)
+
+// seedStats is what the fuzzer knows of a seed in its population
+type seedStats struct {
+	added  int    // Request the seed joined the population at, 0 for seed inputs
+	chosen int    // Times it was selected for mutation
+	finds  int    // Mutations of it that reached new coverage
+	path   string // Coverage signature it reached, empty for seed inputs
+	fresh  bool   // Whether it reached new coverage and none of its mutations has failed to since
+}
+
+// powerSchedule assigns the seeds of a coverage-guided mutation fuzzer
+// their energy, the weight they are selected for mutation with, from the
+// statistics it keeps of each seed and of the paths responses reached
+type powerSchedule struct {
+	name     string
+	seeds    map[string]*seedStats
+	pathHits map[string]int // Responses reaching each coverage signature
+	maxHits  int            // Hits of the most hit signature
+	requests int            // Requests sent so far
+}
+
+// newPowerSchedule creates the schedule Config.PowerSchedule names, exploit
+// when it is empty
+func newPowerSchedule(name string) *powerSchedule {
+	if name == "" {
+		name = ScheduleExploit
+	}
+	return &powerSchedule{
+		name:     name,
+		seeds:    make(map[string]*seedStats),
+		pathHits: make(map[string]int),
+	}
+}
+
+// add starts the statistics of a seed joining the population, path being
+// the signature it reached or empty for a seed input
+func (p *powerSchedule) add(input, path string) {
+	p.seeds[input] = &seedStats{added: p.requests, path: path, fresh: path != ""}
+}
+
+// choose counts a selection of a seed for mutation
+func (p *powerSchedule) choose(input string) {
+	p.requests++
+	if s := p.seeds[input]; s != nil {
+		s.chosen++
+	}
+}
+
+// hit records the signature a mutation of a seed reached, and whether it
+// was new
+func (p *powerSchedule) hit(input, path string, isNew bool) {
+	p.pathHits[path]++
+	p.maxHits = max(p.maxHits, p.pathHits[path])
+	s := p.seeds[input]
+	if s == nil {
+		return
+	}
+	if isNew {
+		s.finds++
+	} else {
+		s.fresh = false
+	}
+}
+
+// energy returns the energy of a seed, at least 1
+func (p *powerSchedule) energy(input string) int {
+	s := p.seeds[input]
+	if s == nil {
+		return baseEnergy
+	}
+	switch p.name {
+	case ScheduleExplore:
+		return baseEnergy
+	case ScheduleFast:
+		// A seed input's own path is unknown; it counts as on the most hit
+		// one, so discovered seeds are not crowded out
+		hits := p.maxHits
+		if s.path != "" {
+			hits = p.pathHits[s.path]
+		}
+		return min(max(fastEnergy<<min(s.chosen, maxFastDoublings)/max(hits, 1), 1), maxEnergy)
+	case ScheduleDecay:
+		return max(decayEnergy>>((p.requests-s.added)/decayHalfLife), 1)
+	default:
+		if s.fresh {
+			return exploitEnergy
+		}
+		return baseEnergy
+	}
+}
+
+// keep drops the statistics of seeds no longer in the population
+func (p *powerSchedule) keep(population []string) {
+	kept := make(map[string]*seedStats, len(population))
+	for _, input := range population {
+		if s := p.seeds[input]; s != nil {
+			kept[input] = s
+		}
+	}
+	p.seeds = kept
+}
+
+// summary logs the schedule's run and its most productive seed
+func (p *powerSchedule) summary(logger *slog.Logger) {
+	var best string
+	var bestStats *seedStats
+	for input, s := range p.seeds {
+		if bestStats == nil || s.finds > bestStats.finds || s.finds == bestStats.finds && input < best {
+			best, bestStats = input, s
+		}
+	}
+	if bestStats == nil {
+		return
+	}
+	logger.Info("power schedule", "schedule", p.name, "seeds", len(p.seeds), "paths", len(p.pathHits),
+		"best_seed", best, "best_finds", bestStats.finds, "best_chosen", bestStats.chosen)
+}
@@ -0,0 +1,175 @@
+package fuzzer
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Priority weights of the signals that make a target worth more requests
+const (
+	priorityBase      = 1.0 // Every target gets some of the budget
+	priorityPerParam  = 0.5 // Each input the target accepts, up to maxPriorityParams
+	priorityAPI       = 2.0 // Detected API endpoint: structured input, direct data access
+	priorityAPIPath   = 1.0 // Parameterized URL that looks like an API call
+	priorityProtected = 1.5 // Target that looks like it sits behind authentication
+	maxPriorityParams = 10
+)
+
+// protectedPathSegments mark paths that usually require a session or expose
+// privileged functionality
+var protectedPathSegments = []string{
+	"admin", "account", "auth", "dashboard", "login", "password",
+	"profile", "session", "settings", "token", "user",
+}
+
+// prioritizeTargets scores each target and returns them most promising
+// first, keeping discovery order between equal scores. A target scores
+// higher the more inputs it takes, when it is an API, and when it looks
+// protected by authentication; targets repeating the path of others of the
+// same kind share one score, as they mostly reach the same code.
+func prioritizeTargets(targets []Target) []Target {
+	paths := make(map[string]int)
+	for _, target := range targets {
+		paths[targetPathKey(target)]++
+	}
+
+	prioritized := make([]Target, len(targets))
+	for i, target := range targets {
+		target.Priority = targetPriority(target) / float64(paths[targetPathKey(target)])
+		prioritized[i] = target
+	}
+	sort.SliceStable(prioritized, func(i, j int) bool {
+		return prioritized[i].Priority > prioritized[j].Priority
+	})
+	return prioritized
+}
+
+// targetPriority scores one target on its own
+func targetPriority(target Target) float64 {
+	parsed, err := url.Parse(target.URL)
+	if err != nil {
+		return priorityBase
+	}
+	path := strings.ToLower(parsed.Path)
+
+	score := priorityBase
+	inputs := 0
+	protected := false
+	for _, segment := range protectedPathSegments {
+		if strings.Contains(path, segment) {
+			protected = true
+			break
+		}
+	}
+
+	switch target.Kind {
+	case TargetForm:
+		inputs = len(target.Form.Fields)
+		for _, field := range target.Form.Fields {
+			if field.Type == "password" {
+				protected = true
+			}
+		}
+
+	case TargetAPI:
+		score += priorityAPI
+		if target.Endpoint != nil {
+			inputs = len(target.Endpoint.Params)
+			if properties, ok := target.Endpoint.BodySchema["properties"].(map[string]interface{}); ok {
+				inputs += len(properties)
+			}
+			for name := range target.Endpoint.Headers {
+				switch strings.ToLower(name) {
+				case "authorization", "cookie", "x-api-key", "api-key":
+					protected = true
+				}
+			}
+		}
+
+	case TargetParams:
+		inputs = len(parsed.Query())
+		if strings.Contains(path, "/api/") || strings.HasSuffix(path, ".json") {
+			score += priorityAPIPath
+		}
+	}
+
+	score += priorityPerParam * float64(min(inputs, maxPriorityParams))
+	if protected {
+		score += priorityProtected
+	}
+	return score
+}
+
+// targetPathKey identifies targets of one kind reaching the same path
+func targetPathKey(target Target) string {
+	if parsed, err := url.Parse(target.URL); err == nil {
+		return target.Kind + " " + parsed.Host + parsed.Path
+	}
+	return target.Kind + " " + target.URL
+}
+
+// skippedShare is the share of a target left without a request when the
+// budget is smaller than the number of targets
+const skippedShare = -1
+
+// requestShares splits a request budget between the targets in proportion
+// to their priority. API fuzzers send a fixed set of cases and take no share.
+// Without a request limit (n <= 0) every share is 0 and targets share time
+// instead. Every other target gets at least one request while the budget
+// lasts; the shares never add up to more than n, and the least promising
+// targets past a budget too small for all of them get skippedShare.
+func requestShares(n int, targets []Target) []int {
+	shares := make([]int, len(targets))
+	if n <= 0 {
+		return shares
+	}
+
+	total := 0.0
+	for _, target := range targets {
+		if target.Kind != TargetAPI {
+			total += target.Priority
+		}
+	}
+	if total == 0 {
+		return shares
+	}
+
+	// Rounding leftovers go to the first, most promising target
+	assigned := 0
+	first := -1
+	for i, target := range targets {
+		if target.Kind == TargetAPI {
+			continue
+		}
+		shares[i] = max(int(float64(n)*target.Priority/total), 1)
+		assigned += shares[i]
+		if first < 0 {
+			first = i
+		}
+	}
+	if assigned < n {
+		shares[first] += n - assigned
+	}
+	// Rounding shares up to one request may overrun the budget; the excess
+	// comes off the largest shares, then targets are dropped from the end
+	for excess := assigned - n; excess > 0; excess-- {
+		largest := -1
+		for i, share := range shares {
+			if share > 1 && (largest < 0 || share > shares[largest]) {
+				largest = i
+			}
+		}
+		if largest >= 0 {
+			shares[largest]--
+			continue
+		}
+		for i := len(shares) - 1; i >= 0; i-- {
+			if shares[i] == 1 {
+				shares[i] = skippedShare
+				break
+			}
+		}
+	}
+	return shares
+}
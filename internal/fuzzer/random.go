@@ -0,0 +1,67 @@
+package fuzzer
+
+import (
+	"math/rand"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// streamStride spreads the seeds of per-worker streams apart so neighbouring
+// streams do not produce correlated sequences
+const streamStride uint64 = 0x9E3779B97F4A7C15
+
+// Random streams of the components that run single-threaded. Worker streams
+// count up from zero, so these count down to stay clear of them.
+const (
+	streamGrammar = -1 - iota
+	streamMutation
+	streamAPI
+	streamPayloads
+	streamInjection
+	streamCache
+	streamEvasion
+	streamBackup
+	streamAdmin
+)
+
+// runSeed returns the seed for the run. When Config.Seed is unset a seed is
+// chosen from the clock and stored back so it can be reported and replayed.
+func runSeed(config *Config) int64 {
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+	return config.Seed
+}
+
+// newRand returns a generator for the given stream of a seed. *rand.Rand is
+// not safe for concurrent use, so every worker takes its own stream. Which
+// requests a worker takes from the shared budget, and the corpus it sees when
+// it does, depend on response timing, so a seed replays a run exactly only
+// with a single worker.
+func newRand(seed int64, stream int) *rand.Rand {
+	return rand.New(rand.NewSource(seed ^ int64(uint64(stream)*streamStride)))
+}
+
+// randomKey returns a random parameter name. Keys are sorted first so the
+// choice depends only on the generator, not on map iteration order.
+func randomKey(rng *rand.Rand, values url.Values) string {
+	return randomMapKey(rng, values)
+}
+
+// randomMapKey returns a random key of a string-keyed map
+func randomMapKey[V any](rng *rand.Rand, m map[string]V) string {
+	keys := sortedKeys(m)
+	return keys[rng.Intn(len(keys))]
+}
+
+// sortedKeys returns the keys of m in order. Iterating maps through it keeps
+// the sequence of random choices, and so the whole run, reproducible.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,325 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitProbes is how many requests are sent in a row before an
+	// endpoint that never answers 429 is taken as unlimited
+	rateLimitProbes = 100
+
+	// rateBypassRepeats is how many requests a bypass vector must get
+	// through, each with fresh values, while plain requests are limited
+	rateBypassRepeats = 2
+
+	// rateBurstWorkers is how many requests of a multiplexed burst are in
+	// flight at once
+	rateBurstWorkers = 50
+)
+
+// sensitiveOperations recognize the paths of endpoints that guess secrets
+// or send messages one request at a time and so need a rate limit
+var sensitiveOperations = regexp.MustCompile(`(?i)log-?in|sign-?in|sign-?up|register|auth|token|session|passw|reset|forgot|otp|mfa|2fa|verif|code|pin\b|invite|contact|sms`)
+
+// rateLimitHeaders are the headers servers advertise their limit in
+var rateLimitHeaders = []string{"RateLimit-Limit", "X-RateLimit-Limit", "X-Rate-Limit-Limit", "RateLimit-Policy"}
+
+// spoofHeaders are the headers proxies pass the client address in, which
+// rate limiters keyed on the client address may trust
+var spoofHeaders = []string{
+	"X-Forwarded-For", "X-Real-IP", "X-Originating-IP", "X-Client-IP", "True-Client-IP",
+	"CF-Connecting-IP", "X-Remote-Addr", "Forwarded",
+}
+
+// rateBypass is one variation of a request that rate limiters keyed on the
+// client address or the exact path may count apart. apply changes the
+// request, with a fresh value each time from token.
+type rateBypass struct {
+	name  string
+	apply func(req *http.Request, token uint32)
+}
+
+// rateBypasses returns the bypass vectors: a spoofed client address in each
+// of spoofHeaders, and the path upper-cased, with a trailing slash, a
+// doubled or dot segment, a trailing semicolon or an extra query parameter
+func rateBypasses() []rateBypass {
+	var bypasses []rateBypass
+	for _, header := range spoofHeaders {
+		header := header
+		bypasses = append(bypasses, rateBypass{header + " header", func(req *http.Request, token uint32) {
+			ip := fmt.Sprintf("10.%d.%d.%d", byte(token>>16), byte(token>>8), byte(token)|1)
+			if header == "Forwarded" {
+				ip = "for=" + ip
+			}
+			req.Header.Set(header, ip)
+		}})
+	}
+	path := func(name string, change func(string) string) rateBypass {
+		return rateBypass{name, func(req *http.Request, token uint32) {
+			req.URL.Path = change(req.URL.Path)
+			req.URL.RawPath = ""
+		}}
+	}
+	bypasses = append(bypasses,
+		path("upper-case path", strings.ToUpper),
+		path("trailing slash", func(p string) string { return strings.TrimSuffix(p, "/") + "/" }),
+		path("doubled slash", func(p string) string { return "/" + p }),
+		path("dot segment", func(p string) string { return "/." + p }),
+		path("trailing semicolon", func(p string) string { return p + ";" }),
+		rateBypass{"extra query parameter", func(req *http.Request, token uint32) {
+			query := req.URL.Query()
+			query.Set("gofuzz", fmt.Sprintf("%08x", token))
+			req.URL.RawQuery = query.Encode()
+		}},
+	)
+	return bypasses
+}
+
+// testRateLimits maps the endpoint's rate limit by sending its valid base
+// case up to rateLimitProbes times in a row, until one is answered 429, or
+// with Retry-After and an error status. The limit found is reported as
+// rate-limit, with the limit the server advertises if any; a sensitive
+// operation such as a login, reset or one-time code that is never limited
+// as no-rate-limit. Once limited, each bypass vector is tried, and one
+// whose requests get through while plain ones stay limited is reported as
+// rate-limit-bypass. Targets speaking HTTP/2 are also sent, once the limit
+// has reset, twice the limit as one multiplexed burst, which counters
+// updated after the response may let through. Retries and the circuit
+// breaker are bypassed so 429s reach the test. It only runs with AllowDoS
+// set, as the bursts load the target and may get the scanner blocked.
+func (f *APIFuzzer) testRateLimits(base map[string]interface{}) {
+	if !f.config.AllowDoS {
+		f.logger.Warn("rate limit mapping needs AllowDoS, skipping")
+		return
+	}
+	raw := *f.config
+	raw.Retry = nil
+	raw.Breaker = nil
+	client, err := newHTTPClient(&raw, true)
+	if err != nil {
+		return
+	}
+	request := func(bypass *rateBypass) (*probeResponse, error) {
+		req, reqBody, err := f.valuesRequest(base)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range f.endpoint.Headers {
+			req.Header.Set(key, value)
+		}
+		if bypass != nil {
+			bypass.apply(req, f.rng.Uint32())
+		}
+		return rateExchange(client, req, reqBody, maxBodySize(f.config))
+	}
+
+	var limited *probeResponse
+	var last *probeResponse
+	sent := 0
+	waited := false
+	start := time.Now()
+	for sent < rateLimitProbes {
+		if !f.config.Deadline.IsZero() && time.Now().After(f.config.Deadline) {
+			return
+		}
+		result, err := request(nil)
+		if err != nil {
+			f.logger.Debug("rate limit probe failed", "sent", sent, "error", err)
+			return
+		}
+		if sent == 0 && (result.resp.StatusCode < 200 || result.resp.StatusCode >= 300) && !rateLimited(result.resp) {
+			f.logger.Debug("rate limit baseline rejected", "status", result.resp.StatusCode)
+			return
+		}
+		if rateLimited(result.resp) {
+			// Requests sent before may have used the limit up; a short
+			// wait lets the count start afresh
+			if sent == 0 && !waited {
+				if wait := retryAfter(result.resp); wait > 0 {
+					if !sleepBefore(f.config.Deadline, wait+time.Second) {
+						return
+					}
+					waited = true
+					start = time.Now()
+					continue
+				}
+			}
+			limited = result
+			break
+		}
+		sent++
+		last = result
+	}
+	elapsed := time.Since(start)
+	sensitive := sensitiveOperations.MatchString(f.endpoint.URL)
+
+	if limited == nil {
+		if !sensitive {
+			f.logger.Debug("no rate limit", "requests", sent)
+			return
+		}
+		f.reportRateLimit("no-rate-limit", SeverityMedium, ConfidenceFirm, "", fmt.Sprintf("%d requests", sent), last,
+			fmt.Sprintf("%d requests in %s were all answered without 429 or Retry-After, though the endpoint is a sensitive operation",
+				sent, elapsed.Round(time.Millisecond)))
+		return
+	}
+	evidence := fmt.Sprintf("HTTP %d after %d requests in %s", limited.resp.StatusCode, sent, elapsed.Round(time.Millisecond))
+	if sent == 0 {
+		evidence = fmt.Sprintf("HTTP %d from the first request, the limit being used up by the requests before", limited.resp.StatusCode)
+	}
+	if advertised := advertisedLimit(limited.resp); advertised != "" {
+		evidence += ", advertising " + advertised
+	}
+	f.reportRateLimit("rate-limit", SeverityInfo, ConfidenceCertain, "", fmt.Sprintf("%d requests", sent), limited, evidence)
+
+	severity := SeverityMedium
+	if sensitive {
+		severity = SeverityHigh
+	}
+	for _, bypass := range rateBypasses() {
+		bypass := bypass
+		var passed *probeResponse
+		for i := 0; i < rateBypassRepeats; i++ {
+			result, err := request(&bypass)
+			if err != nil || rateLimited(result.resp) || result.resp.StatusCode >= http.StatusInternalServerError {
+				passed = nil
+				break
+			}
+			passed = result
+		}
+		// A plain request getting through means the limit reset meanwhile
+		plain, err := request(nil)
+		if err != nil || !rateLimited(plain.resp) {
+			f.logger.Debug("rate limit reset during bypass tests", "vector", bypass.name)
+			break
+		}
+		if passed != nil {
+			f.reportRateLimit("rate-limit-bypass", severity, ConfidenceFirm, bypass.name, bypass.name, passed,
+				fmt.Sprintf("%d requests varied by %s were answered HTTP %d while plain requests got HTTP %d",
+					rateBypassRepeats, bypass.name, passed.resp.StatusCode, plain.resp.StatusCode))
+		}
+	}
+
+	if limited.resp.ProtoMajor == 2 && sent > 0 {
+		f.testMultiplexedBurst(limited, sent, severity, request)
+	}
+}
+
+// testMultiplexedBurst waits out the Retry-After of a limited response, up
+// to maxRetryDelay, then sends twice the limit at once, rateBurstWorkers
+// requests at a time, multiplexed on one HTTP/2 connection, and reports
+// more requests than the limit getting through
+func (f *APIFuzzer) testMultiplexedBurst(limited *probeResponse, limit int, severity Severity,
+	request func(*rateBypass) (*probeResponse, error)) {
+	wait := retryAfter(limited.resp)
+	if wait == 0 {
+		f.logger.Debug("no Retry-After, skipping the multiplexed burst")
+		return
+	}
+	if !sleepBefore(f.config.Deadline, wait+time.Second) {
+		return
+	}
+
+	burst := 2 * limit
+	jobs := make(chan struct{}, burst)
+	for i := 0; i < burst; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var passed *probeResponse
+	accepted := 0
+	for i := 0; i < min(burst, rateBurstWorkers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				result, err := request(nil)
+				if err != nil || rateLimited(result.resp) || result.resp.StatusCode >= http.StatusInternalServerError {
+					continue
+				}
+				mu.Lock()
+				accepted++
+				passed = result
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted <= limit {
+		return
+	}
+	f.reportRateLimit("rate-limit-bypass", severity, ConfidenceFirm, "HTTP/2 multiplexing",
+		fmt.Sprintf("%d concurrent requests", burst), passed,
+		fmt.Sprintf("%d of %d requests sent at once on one HTTP/2 connection got through, against a limit of %d in a row",
+			accepted, burst, limit))
+}
+
+// sleepBefore waits for wait and reports true, or reports false at once
+// when the deadline would pass first
+func sleepBefore(deadline time.Time, wait time.Duration) bool {
+	if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+		return false
+	}
+	time.Sleep(wait)
+	return true
+}
+
+// rateLimited reports whether a response refuses a request for its rate:
+// 429, or an error status with Retry-After
+func rateLimited(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 400 && resp.Header.Get("Retry-After") != "")
+}
+
+// advertisedLimit returns the rate limit headers of a response as
+// "Name: value" pairs, or "" when it has none
+func advertisedLimit(resp *http.Response) string {
+	var advertised []string
+	for _, name := range append(rateLimitHeaders, "Retry-After") {
+		if value := resp.Header.Get(name); value != "" {
+			advertised = append(advertised, name+": "+value)
+		}
+	}
+	return strings.Join(advertised, ", ")
+}
+
+// rateExchange sends a request and reads its response up to limit bytes
+func rateExchange(client *http.Client, req *http.Request, reqBody []byte, limit int64) (*probeResponse, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readLimited(resp.Body, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &probeResponse{req: req, reqBody: reqBody, resp: resp, body: body.data}, nil
+}
+
+// reportRateLimit records a rate limit finding
+func (f *APIFuzzer) reportRateLimit(kind string, severity Severity, confidence Confidence, vector, payload string,
+	result *probeResponse, evidence string) {
+	finding := &Finding{
+		Type:       kind,
+		Severity:   severity,
+		Confidence: confidence,
+		URL:        f.endpoint.URL,
+		Method:     result.req.Method,
+		Parameter:  vector,
+		Payload:    payload,
+		Evidence:   evidence,
+	}
+	captureExchange(finding, result.req, result.reqBody, result.resp, result.body)
+	if f.config.Findings.Add(finding) && severity != SeverityInfo {
+		f.logger.Warn("rate limit", "type", kind, "evidence", evidence)
+	}
+}
@@ -0,0 +1,180 @@
+package fuzzer
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces the requests sent to one target, spacing them evenly at
+// a fixed rate. It is shared by every client built from the same Config and
+// is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter creates a limiter allowing perSecond requests per second
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Rate returns the requests per second the limiter allows
+func (l *RateLimiter) Rate() float64 {
+	return float64(time.Second) / float64(l.interval)
+}
+
+// Wait blocks until the next request may be sent
+func (l *RateLimiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Politeness spaces the requests sent to each host by a minimum delay and
+// caps how many are in flight to it at once, however many workers run. It
+// is shared by every client built from the same Config and is safe for
+// concurrent use.
+type Politeness struct {
+	delay    time.Duration
+	parallel int
+	mu       sync.Mutex
+	hosts    map[string]*politeHost
+}
+
+// politeHost is the pacing state of one host
+type politeHost struct {
+	slots chan struct{} // Requests in flight, nil without a parallelism cap
+	next  time.Time     // When the next request may start
+}
+
+// NewPoliteness creates a politeness policy starting requests to the same
+// host at least delay apart, with at most parallel in flight to it at once.
+// Zero disables either limit.
+func NewPoliteness(delay time.Duration, parallel int) *Politeness {
+	return &Politeness{delay: delay, parallel: parallel, hosts: make(map[string]*politeHost)}
+}
+
+// acquire blocks until a request may be sent to host, or ctx is done, and
+// returns the function to call once the request's response headers arrived
+func (p *Politeness) acquire(ctx context.Context, host string) (func(), error) {
+	host = strings.ToLower(host)
+	p.mu.Lock()
+	h, ok := p.hosts[host]
+	if !ok {
+		h = &politeHost{}
+		if p.parallel > 0 {
+			h.slots = make(chan struct{}, p.parallel)
+		}
+		p.hosts[host] = h
+	}
+	p.mu.Unlock()
+
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if h.slots != nil {
+				<-h.slots
+			}
+		})
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if h.next.Before(now) {
+		h.next = now
+	}
+	wait := h.next.Sub(now)
+	h.next = h.next.Add(p.delay)
+	p.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// pace blocks until the rate limiter and the politeness policy of config,
+// if any, let a request to host go, for requests written on raw
+// connections rather than sent through a client. It returns the function
+// to call once the response headers arrived.
+func pace(ctx context.Context, config *Config, host string) (func(), error) {
+	if config.RateLimit != nil {
+		config.RateLimit.Wait()
+	}
+	if config.Politeness == nil {
+		return func() {}, nil
+	}
+	return config.Politeness.acquire(ctx, host)
+}
+
+// attemptTransport sends one attempt of a request once it may go: after
+// the rate limiter and the politeness policy of its host let it. Those
+// waits are not counted against the attempt's timeout, nor in the latency
+// the circuit breaker watches, so requests that were only queued are not
+// taken for failures. The host's politeness slot is released as soon as
+// the response headers arrive, so a caller holding a body open while it
+// sends more requests to the host does not block on itself. The timeout
+// also covers reading the body, so it is released when the body is closed.
+type attemptTransport struct {
+	base       http.RoundTripper
+	limiter    *RateLimiter    // nil for no rate limit
+	politeness *Politeness     // nil for no per-host limits
+	breaker    *CircuitBreaker // Told the latency and outcome of each attempt; nil for none
+	timeout    time.Duration   // Per attempt, 0 for none
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *attemptTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.limiter != nil {
+		t.limiter.Wait()
+	}
+	if t.politeness != nil {
+		release, err := t.politeness.acquire(req.Context(), req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+	}
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	failed := (err != nil && transientError(err)) || (err == nil && transientStatus(resp.StatusCode))
+	t.breaker.record(req, time.Since(start), failed, t.base)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
@@ -0,0 +1,261 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	formhtml "github.com/gregcmartin/gofuzz/internal/html"
+)
+
+const (
+	// redosTimeout bounds each ReDoS submission; a validator still busy
+	// after it counts as slow
+	redosTimeout = 10 * time.Second
+
+	// redosMinDelay is how much slower than with one repetition an attack
+	// must be answered to count
+	redosMinDelay = 2 * time.Second
+
+	// redosGrowth is how many times slower than with one repetition an
+	// attack must be answered, so a uniformly slow form is not reported
+	redosGrowth = 4
+)
+
+// Pump counts tried in turn: a few more repetitions multiply the time of an
+// exponential pattern, a polynomial one needs thousands
+var (
+	exponentialPumps = []int{8, 14, 20, 24, 28}
+	polynomialPumps  = []int{500, 2000, 8000, 20000}
+)
+
+// regexErrorSignatures are errors of server-side regex engines, showing a
+// field is matched against a pattern the page does not declare
+var regexErrorSignatures = regexp.MustCompile(`(?i)(preg_(match|replace|split)(_all)?\(\)|Compilation failed:|` +
+	`RegexMatchTimeoutException|System\.Text\.RegularExpressions|Invalid regular expression|PatternSyntaxException|` +
+	`java\.util\.regex|re\.error|unterminated character set|RegexpError|unmatched parenthes[ie]s|missing \) at position)`)
+
+// regexBreaker is sent to fields without a pattern: a value that breaks a
+// regex built from input, and a server-side validator's error shows
+const regexBreaker = "gofuzz(["
+
+// genericReDoSAttacks are tried on fields whose server-side pattern is only
+// known to exist: runs of the characters that nested quantifiers in common
+// email, name and identifier validators repeat
+var genericReDoSAttacks = []formhtml.ReDoSAttack{
+	{Pump: "a", Suffix: "!", Exponential: true, Reason: "server-side regex, runs of letters"},
+	{Pump: "0", Suffix: "!", Exponential: true, Reason: "server-side regex, runs of digits"},
+	{Pump: "a.", Suffix: "!", Exponential: true, Reason: "server-side regex, dotted words"},
+	{Prefix: "a@", Pump: "a.", Suffix: "!", Exponential: true, Reason: "server-side regex, email domains"},
+	{Pump: "a ", Suffix: "!", Exponential: true, Reason: "server-side regex, spaced words"},
+}
+
+// testReDoS times catastrophic-backtracking inputs against the form's
+// fields. Fields with an HTML5 pattern get attacks shaped to its nested or
+// overlapping repetitions; fields whose values make the server answer with a
+// regex engine error get generic ones. Each attack grows until it is
+// answered much slower than with a single repetition, and is reported when a
+// second submission is slow too. The pattern attribute is only a hint: a
+// server that checks the same pattern with a backtracking engine is what
+// the timing shows.
+func (f *WebFormFuzzer) testReDoS(client *http.Client) {
+	client, err := newTimingClient(f.config, client, redosTimeout)
+	if err != nil {
+		f.logger.Debug("ReDoS client failed", "error", err)
+		return
+	}
+	base := f.nextInput()
+	for _, name := range sortedKeys(f.fields) {
+		if f.expired() {
+			return
+		}
+		field := f.fields[name]
+		var attacks []formhtml.ReDoSAttack
+		if field.Pattern != "" {
+			var err error
+			if attacks, err = formhtml.ReDoSAttacks(field.Pattern); err != nil {
+				f.logger.Debug("pattern not analyzed", "field", name, "error", err)
+			}
+		} else if textField(field) && f.regexErrors(client, base, name) {
+			attacks = genericReDoSAttacks
+		}
+
+		for _, attack := range attacks {
+			if finding := f.probeReDoS(client, base, name, attack); finding != nil {
+				if f.config.Findings.Add(finding) {
+					f.logger.Warn("ReDoS", "field", name, "evidence", finding.Evidence)
+				}
+				break
+			}
+		}
+	}
+}
+
+// expired reports whether the run's deadline has passed
+func (f *WebFormFuzzer) expired() bool {
+	return !f.config.Deadline.IsZero() && time.Now().After(f.config.Deadline)
+}
+
+// textField reports whether a field takes free text
+func textField(field FormField) bool {
+	switch field.Type {
+	case "", "text", "search", "email", "url", "tel", "password", "textarea":
+		return true
+	}
+	return false
+}
+
+// regexErrors reports whether a regex-breaking value in the field makes the
+// server answer with a regex engine error that the ordinary value does not
+func (f *WebFormFuzzer) regexErrors(client *http.Client, base, name string) bool {
+	ordinary, _, err := f.timedSubmission(client, base, nil)
+	if err != nil || regexErrorSignatures.Match(ordinary.body) {
+		return false
+	}
+	broken, _, err := f.timedSubmission(client, base, map[string]string{name: regexBreaker})
+	return err == nil && regexErrorSignatures.Match(broken.body)
+}
+
+// probeReDoS sends one attack on a field at growing pump counts and returns
+// a finding when the submission slows down with the count
+func (f *WebFormFuzzer) probeReDoS(client *http.Client, base, name string, attack formhtml.ReDoSAttack) *Finding {
+	// The shortest attack, sent three times, is the baseline: it has the
+	// shape of the attack without its cost
+	var latencies []time.Duration
+	for i := 0; i < 3; i++ {
+		_, elapsed, err := f.timedSubmission(client, base, map[string]string{name: attack.Value(1)})
+		if err != nil {
+			return nil
+		}
+		latencies = append(latencies, elapsed)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	baseline := latencies[1]
+
+	pumps := polynomialPumps
+	if attack.Exponential {
+		pumps = exponentialPumps
+	}
+	var timings []string
+	for _, n := range pumps {
+		if f.expired() {
+			return nil
+		}
+		value := attack.Value(n)
+		probe, elapsed, err := f.timedSubmission(client, base, map[string]string{name: value})
+		if err != nil && !transientError(err) {
+			return nil
+		}
+		timings = append(timings, fmt.Sprintf("%d: %s", n, elapsed.Round(time.Millisecond)))
+		if elapsed < baseline+redosMinDelay || elapsed < redosGrowth*baseline {
+			continue
+		}
+
+		// Slow once could be the server busy elsewhere
+		again, repeated, err := f.timedSubmission(client, base, map[string]string{name: value})
+		if (err != nil && !transientError(err)) || repeated < baseline+redosMinDelay {
+			return nil
+		}
+		if probe == nil {
+			probe = again
+		}
+		finding := &Finding{
+			Type:       "redos",
+			Severity:   SeverityMedium,
+			Confidence: ConfidenceFirm,
+			URL:        f.formURL,
+			Parameter:  name,
+			Payload:    value,
+			Evidence: fmt.Sprintf("%s: %q repeated %d times is answered in %s and %s, against %s for one repetition (pump counts and times: %s)",
+				attack.Reason, attack.Pump, n, elapsed.Round(time.Millisecond), repeated.Round(time.Millisecond),
+				baseline.Round(time.Millisecond), strings.Join(timings, ", ")),
+		}
+		if probe != nil {
+			captureExchange(finding, probe.req, probe.reqBody, probe.resp, probe.body)
+		}
+		return finding
+	}
+	return nil
+}
+
+// timedSubmission sends a generated submission of the form, "METHOD URL
+// data", with the fields in set given their values and sticky tokens
+// refreshed, and returns the response with how long it took from asking for
+// a connection, so rate limit and politeness waits are not counted. The
+// time is returned on error too, telling a timeout from a refused request.
+func (f *WebFormFuzzer) timedSubmission(client *http.Client, input string, set map[string]string) (*probeResponse, time.Duration, error) {
+	parts := strings.SplitN(input, " ", 3)
+	if len(parts) < 2 {
+		return nil, 0, fmt.Errorf("invalid form data format")
+	}
+	target, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, 0, err
+	}
+	var data string
+	if len(parts) > 2 {
+		data = parts[2]
+	}
+	if f.sticky != nil {
+		fresh, err := f.sticky.refresh(client, f.config)
+		if err != nil {
+			f.logger.Debug("sticky parameters not refreshed", "error", err)
+		}
+		set = mergeParams(fresh, set)
+	}
+
+	var req *http.Request
+	var reqBody []byte
+	if parts[0] == http.MethodGet {
+		query := target.Query()
+		for name, value := range set {
+			query.Set(name, value)
+		}
+		target.RawQuery = query.Encode()
+		req, err = http.NewRequest(http.MethodGet, target.String(), nil)
+	} else {
+		values, _ := url.ParseQuery(data)
+		for name, value := range set {
+			values.Set(name, value)
+		}
+		var contentType string
+		if reqBody, contentType, err = encodeFormBody(values.Encode(), f.enctype); err == nil {
+			req, err = http.NewRequest(http.MethodPost, target.String(), bytes.NewReader(reqBody))
+		}
+		if err == nil {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, elapsed := startClock(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, elapsed(), err
+	}
+	defer resp.Body.Close()
+	body, err := readLimited(resp.Body, maxBodySize(f.config))
+	if err != nil {
+		return nil, elapsed(), err
+	}
+	return &probeResponse{req: req, reqBody: reqBody, resp: resp, body: body.data}, elapsed(), nil
+}
+
+// mergeParams returns the values of both maps, those of override winning
+func mergeParams(values, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(values)+len(override))
+	for name, value := range values {
+		merged[name] = value
+	}
+	for name, value := range override {
+		merged[name] = value
+	}
+	return merged
+}
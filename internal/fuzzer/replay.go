@@ -0,0 +1,207 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Replay outcomes
+const (
+	ReplayReproduced = "reproduced" // Same status and content as recorded: the issue is still there
+	ReplayChanged    = "changed"    // The target answers differently now, e.g. after a fix
+	ReplaySent       = "sent"       // Corpus input replayed, with no recorded response to compare
+	ReplayFailed     = "failed"     // The request could not be sent
+	ReplaySkipped    = "skipped"    // Nothing complete was recorded to replay
+)
+
+// ReplayResult is what replaying one stored request showed
+type ReplayResult struct {
+	Type           string `json:"type,omitempty"` // Type of the replayed finding; empty for corpus inputs
+	Method         string `json:"method"`
+	URL            string `json:"url"`
+	Outcome        string `json:"outcome"`
+	Status         int    `json:"status,omitempty"`          // Status of the replayed response
+	RecordedStatus int    `json:"recorded_status,omitempty"` // Status of the recorded response
+	Detail         string `json:"detail,omitempty"`          // What changed, or why replaying failed
+}
+
+// ReplayFindings re-sends the captured request of every finding and compares
+// the response with the captured one. With Config.TargetURL set, requests go
+// to its scheme and host instead of the recorded ones, e.g. to verify a fix
+// on staging. Replayed responses pass through the detectors again, so
+// Config.Findings ends up with what is still there.
+func ReplayFindings(config *Config, findings []*Finding) ([]ReplayResult, error) {
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *url.URL
+	if config.TargetURL != "" {
+		if base, err = url.Parse(config.TargetURL); err != nil {
+			return nil, fmt.Errorf("invalid target URL: %v", err)
+		}
+	}
+
+	results := make([]ReplayResult, 0, len(findings))
+	for _, finding := range findings {
+		results = append(results, replayFinding(config, client, base, finding))
+	}
+	return results, nil
+}
+
+// replayFinding replays one finding's captured request
+func replayFinding(config *Config, client *http.Client, base *url.URL, finding *Finding) ReplayResult {
+	result := ReplayResult{Type: finding.Type, Method: finding.Method, URL: finding.URL, Outcome: ReplaySkipped}
+	if finding.Request == "" {
+		result.Detail = "no request was captured"
+		return result
+	}
+	if strings.Contains(finding.Request, "\n[truncated ") {
+		result.Detail = "the request body was truncated when captured"
+		return result
+	}
+
+	req, reqBody, err := capturedRequest(finding, base)
+	if err != nil {
+		result.Outcome = ReplayFailed
+		result.Detail = err.Error()
+		return result
+	}
+	result.URL = req.URL.String()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		inspectFailure(config, req, reqBody, err, finding.Payload)
+		result.Outcome = ReplayFailed
+		result.Detail = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, _ := readLimited(resp.Body, maxBodySize(config))
+	inspectResponse(config, req, reqBody, resp, body.data, finding.Payload)
+	result.Status = resp.StatusCode
+
+	recordedStatus, recordedBody, truncated, ok := capturedResponse(finding.Response)
+	if !ok {
+		result.Outcome = ReplaySent
+		result.Detail = "no response was captured to compare with"
+		return result
+	}
+	result.RecordedStatus = recordedStatus
+
+	current := body.data
+	if truncated && len(current) > maxCapturedBody {
+		current = current[:maxCapturedBody]
+	}
+	switch {
+	case resp.StatusCode != recordedStatus:
+		result.Outcome = ReplayChanged
+		result.Detail = fmt.Sprintf("HTTP %d instead of %d", resp.StatusCode, recordedStatus)
+	case !similarBodies(recordedBody, current):
+		result.Outcome = ReplayChanged
+		result.Detail = "different content"
+	default:
+		result.Outcome = ReplayReproduced
+	}
+	return result
+}
+
+// capturedRequest rebuilds the request captured on a finding, sent to base
+// instead of the recorded host when base is set
+func capturedRequest(finding *Finding, base *url.URL) (*http.Request, []byte, error) {
+	tmpl, err := parseRawRequest(finding.Request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid captured request: %v", err)
+	}
+
+	recorded, err := url.Parse(finding.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid finding URL: %v", err)
+	}
+	target := recorded
+	if base != nil {
+		target = base
+	}
+
+	// The transport sets its own Accept-Encoding and decompresses only
+	// then, and a recorded Host would keep requests on the recorded host
+	headers := tmpl.Headers[:0]
+	for _, h := range tmpl.Headers {
+		switch {
+		case strings.EqualFold(h[0], "Accept-Encoding"):
+		case strings.EqualFold(h[0], "Host") && base != nil:
+		default:
+			headers = append(headers, h)
+		}
+	}
+	tmpl.Headers = headers
+
+	return tmpl.Build(target, nil)
+}
+
+// capturedResponse parses the status and body of a captured response, and
+// whether the body was truncated. ok is false when nothing was captured.
+func capturedResponse(raw string) (status int, body []byte, truncated bool, ok bool) {
+	statusLine, _, _ := strings.Cut(raw, "\n")
+	fields := strings.Fields(statusLine)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return 0, nil, false, false
+	}
+	status, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, nil, false, false
+	}
+
+	_, rest, _ := strings.Cut(raw, "\r\n\r\n")
+	if i := strings.LastIndex(rest, "\n[truncated "); i >= 0 {
+		rest, truncated = rest[:i], true
+	}
+	return status, []byte(rest), truncated, true
+}
+
+// ReplayCorpus sends every corpus input the way the coverage fuzzers do,
+// appending inputs that are not absolute URLs to Config.TargetURL. Corpus
+// files hold no responses, so the results only carry the current status;
+// the detectors report into Config.Findings what the inputs still trigger.
+func ReplayCorpus(config *Config, inputs []string) ([]ReplayResult, error) {
+	client, err := newHTTPClient(config, true)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReplayResult, 0, len(inputs))
+	for _, input := range inputs {
+		fullURL := input
+		if !isAbsoluteURL(input) {
+			fullURL = config.TargetURL + input
+		}
+		result := ReplayResult{Method: http.MethodGet, URL: fullURL, Outcome: ReplaySent}
+
+		req, err := http.NewRequest(http.MethodGet, fullURL, nil)
+		if err != nil {
+			result.Outcome = ReplayFailed
+			result.Detail = err.Error()
+			results = append(results, result)
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			inspectFailure(config, req, nil, err, input)
+			result.Outcome = ReplayFailed
+			result.Detail = err.Error()
+			results = append(results, result)
+			continue
+		}
+		body, _ := readLimited(resp.Body, maxBodySize(config))
+		resp.Body.Close()
+		inspectResponse(config, req, nil, resp, body.data, input)
+
+		result.Status = resp.StatusCode
+		results = append(results, result)
+	}
+	return results, nil
+}
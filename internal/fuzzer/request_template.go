@@ -0,0 +1,190 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// FuzzMarker is the placeholder replaced with payloads in request templates.
+// Additional injection points are numbered FUZZ2 through FUZZ9; a bare FUZZ
+// is the first position.
+const FuzzMarker = "FUZZ"
+
+// markerPattern matches FUZZ and its numbered variants
+var markerPattern = regexp.MustCompile(`FUZZ([2-9])?`)
+
+// RequestTemplate is a raw HTTP request with FUZZ placeholders in the request
+// line, headers or body
+type RequestTemplate struct {
+	Method  string
+	Target  string      // Request target as written (origin or absolute form)
+	Headers [][2]string // Header name/value pairs in file order
+	Body    string
+}
+
+// LoadRequestTemplate reads and parses a raw request file
+func LoadRequestTemplate(path string) (*RequestTemplate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request template: %v", err)
+	}
+	return ParseRequestTemplate(string(content))
+}
+
+// LoadLoginRequest reads and parses a raw request file that needs no FUZZ
+// marker, such as the login request of Config.LoginRequest
+func LoadLoginRequest(path string) (*RequestTemplate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read login request: %v", err)
+	}
+	return parseRawRequest(string(content))
+}
+
+// ParseRequestTemplate parses a raw HTTP request. Both CRLF and LF line
+// endings are accepted.
+func ParseRequestTemplate(raw string) (*RequestTemplate, error) {
+	tmpl, err := parseRawRequest(raw)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Positions() == 0 {
+		return nil, fmt.Errorf("request template contains no %s marker", FuzzMarker)
+	}
+	return tmpl, nil
+}
+
+// parseRawRequest parses a raw HTTP request with or without markers
+func parseRawRequest(raw string) (*RequestTemplate, error) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\n")
+
+	head, body, _ := strings.Cut(raw, "\n\n")
+	lines := strings.Split(strings.TrimLeft(head, "\n"), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return nil, fmt.Errorf("request template is empty")
+	}
+
+	requestLine := strings.Fields(lines[0])
+	if len(requestLine) < 2 {
+		return nil, fmt.Errorf("invalid request line: %q", lines[0])
+	}
+
+	tmpl := &RequestTemplate{
+		Method: requestLine[0],
+		Target: requestLine[1],
+		Body:   body,
+	}
+
+	for _, line := range lines[1:] {
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header line: %q", line)
+		}
+		tmpl.Headers = append(tmpl.Headers, [2]string{strings.TrimSpace(name), strings.TrimSpace(value)})
+	}
+
+	return tmpl, nil
+}
+
+// Positions returns the highest marker position used in the template, i.e.
+// the number of payload sets an attack needs
+func (t *RequestTemplate) Positions() int {
+	parts := []string{t.Method, t.Target, t.Body}
+	for _, h := range t.Headers {
+		parts = append(parts, h[0], h[1])
+	}
+
+	positions := 0
+	for _, part := range parts {
+		for _, m := range markerPattern.FindAllStringSubmatch(part, -1) {
+			pos := 1
+			if m[1] != "" {
+				pos = int(m[1][0] - '0')
+			}
+			if pos > positions {
+				positions = pos
+			}
+		}
+	}
+	return positions
+}
+
+// substitute replaces every marker in s with the payload for its position
+func substitute(s string, payloads []string, encode func(string) string) string {
+	return markerPattern.ReplaceAllStringFunc(s, func(marker string) string {
+		pos := 0
+		if len(marker) > len(FuzzMarker) {
+			pos = int(marker[len(FuzzMarker)]-'0') - 1
+		}
+		if pos >= len(payloads) {
+			return marker
+		}
+		return encode(payloads[pos])
+	})
+}
+
+// Build substitutes payloads[i] for the marker at position i+1 and returns
+// the request and its body. Relative targets are resolved against base; the
+// Host header of the template is preserved so virtual hosts keep working.
+func (t *RequestTemplate) Build(base *url.URL, payloads []string) (*http.Request, []byte, error) {
+	target := substitute(t.Target, payloads, escapeRequestTarget)
+
+	reqURL, err := url.Parse(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid request target %q: %v", target, err)
+	}
+	if !reqURL.IsAbs() {
+		reqURL.Scheme = base.Scheme
+		reqURL.Host = base.Host
+	}
+
+	// Header values cannot carry line breaks without corrupting the request
+	stripLineBreaks := strings.NewReplacer("\r", "", "\n", "").Replace
+	raw := func(s string) string { return s }
+
+	body := []byte(substitute(t.Body, payloads, raw))
+	method := substitute(t.Method, payloads, stripLineBreaks)
+
+	req, err := http.NewRequest(method, reqURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	for _, h := range t.Headers {
+		name := substitute(h[0], payloads, stripLineBreaks)
+		value := substitute(h[1], payloads, stripLineBreaks)
+		switch strings.ToLower(name) {
+		case "host":
+			req.Host = value
+		case "content-length":
+			// Recomputed from the substituted body
+		default:
+			req.Header.Add(name, value)
+		}
+	}
+
+	return req, body, nil
+}
+
+// escapeRequestTarget percent-encodes the bytes that cannot appear in a
+// request target while leaving path and query syntax intact
+func escapeRequestTarget(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || strings.IndexByte("\"<>`{}|\\^#", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
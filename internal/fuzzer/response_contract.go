@@ -0,0 +1,171 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxSchemaProblems bounds the schema mismatches listed as evidence
+const maxSchemaProblems = 5
+
+// declaredResponse returns the schema a spec declares for a status: that of
+// the status code itself, else of its range such as 4XX, else of the
+// default response. It reports false when the spec documents none of them.
+func declaredResponse(responses map[string]map[string]interface{}, status int) (map[string]interface{}, bool) {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", "DEFAULT"} {
+		if schema, ok := responses[key]; ok {
+			return schema, true
+		}
+	}
+	return nil, false
+}
+
+// checkResponseContract validates a response against the responses the
+// endpoint's spec declares. A status the spec does not document is reported
+// as api-undocumented-status, or for 5xx as api-raw-server-error, an error
+// that escaped the API's error handling; a body that does not match the
+// schema declared for its status as api-schema-mismatch. The status and
+// the paths that break the schema go in the evidence: Parameter names
+// request parameters, and one finding per endpoint and kind is enough.
+func (f *APIFuzzer) checkResponseContract(req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) {
+	report := func(kind string, severity Severity, evidence string) {
+		finding := &Finding{
+			Type:       kind,
+			Severity:   severity,
+			Confidence: ConfidenceFirm,
+			URL:        req.URL.String(),
+			Method:     req.Method,
+			Payload:    payload,
+			Evidence:   evidence,
+		}
+		captureExchange(finding, req, reqBody, resp, body)
+		f.config.Findings.Add(finding)
+	}
+
+	schema, documented := declaredResponse(f.endpoint.Responses, resp.StatusCode)
+	if !documented {
+		declared := sortedKeys(f.endpoint.Responses)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			report("api-raw-server-error", SeverityMedium,
+				fmt.Sprintf("HTTP %d, which the spec does not declare (declared: %s): the error escaped the API's error handling",
+					resp.StatusCode, strings.Join(declared, ", ")))
+			return
+		}
+		report("api-undocumented-status", SeverityLow,
+			fmt.Sprintf("HTTP %d, which the spec does not declare (declared: %s)", resp.StatusCode, strings.Join(declared, ", ")))
+		return
+	}
+	if len(schema) == 0 || len(body) == 0 {
+		return
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		report("api-schema-mismatch", SeverityLow,
+			fmt.Sprintf("HTTP %d body is not the JSON the spec declares", resp.StatusCode))
+		return
+	}
+	var problems []string
+	validateSchema(schema, doc, "$", &problems)
+	if len(problems) == 0 {
+		return
+	}
+	if len(problems) > maxSchemaProblems {
+		problems = append(problems[:maxSchemaProblems], fmt.Sprintf("%d more", len(problems)-maxSchemaProblems))
+	}
+	report("api-schema-mismatch", SeverityLow,
+		fmt.Sprintf("HTTP %d body does not match the declared schema: %s", resp.StatusCode, strings.Join(problems, ", ")))
+}
+
+// validateSchema appends to problems how the value at path breaks a declared
+// schema: a type other than declared, a required property missing, a
+// property additionalProperties forbids or a value outside the enum
+func validateSchema(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable && !schemaAllows(schema, "null") && schemaType(schema) != "" {
+			*problems = append(*problems, path+" null instead of "+schemaType(schema))
+		}
+		return
+	}
+	if expected := schemaType(schema); expected != "" && !schemaAllows(schema, jsonType(value)) {
+		*problems = append(*problems, fmt.Sprintf("%s %s instead of %s", path, jsonType(value), expected))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*problems = append(*problems, fmt.Sprintf("%s %v not in enum", path, value))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[fmt.Sprint(name)]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s.%v missing", path, name))
+			}
+		}
+		additional, restricted := schema["additionalProperties"].(bool)
+		for _, key := range sortedKeys(v) {
+			property, ok := properties[key].(map[string]interface{})
+			if !ok {
+				if restricted && !additional {
+					*problems = append(*problems, path+"."+key+" not declared")
+				}
+				continue
+			}
+			validateSchema(property, v[key], path+"."+key, problems)
+		}
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		for _, item := range v {
+			validateSchema(items, item, path+"[]", problems)
+			if len(*problems) > maxSchemaProblems {
+				return // One bad element usually means all are
+			}
+		}
+	}
+}
+
+// schemaType returns the type a schema declares, with the types of an
+// OpenAPI 3.1 type list joined by |, or "" for any type
+func schemaType(schema map[string]interface{}) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []interface{}:
+		var types []string
+		for _, name := range t {
+			types = append(types, fmt.Sprint(name))
+		}
+		return strings.Join(types, "|")
+	}
+	return ""
+}
+
+// schemaAllows reports whether a schema admits values of a JSON type. Whole
+// numbers are numbers too.
+func schemaAllows(schema map[string]interface{}, actual string) bool {
+	declared := schemaType(schema)
+	if declared == "" {
+		return true
+	}
+	for _, expected := range strings.Split(declared, "|") {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
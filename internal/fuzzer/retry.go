@@ -0,0 +1,231 @@
+package fuzzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// maxRetryDelay caps the backoff and any Retry-After the target asks for
+const maxRetryDelay = 30 * time.Second
+
+// RetryPolicy retries requests that fail transiently: connection resets and
+// refusals, timeouts, and 429, 502, 503 and 504 responses. Each retry waits
+// twice as long as the one before, with jitter so workers do not retry in
+// lockstep. A request still failing once the retries are spent fails for
+// good: a timeout is the payload hanging the target, a connection failure an
+// endpoint that is down. It is shared by every client built from the same
+// Config and is safe for concurrent use.
+type RetryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	logger     *slog.Logger
+
+	mu   sync.Mutex
+	dead map[string]bool // Endpoints that could not be reached after retries
+}
+
+// NewRetryPolicy creates a policy retrying up to maxRetries times, waiting
+// backoff before the first retry
+func NewRetryPolicy(maxRetries int, backoff time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		logger:     logging.For("retry"),
+		dead:       make(map[string]bool),
+	}
+}
+
+// Clone returns a policy with the same settings that has seen no failures
+func (p *RetryPolicy) Clone() *RetryPolicy {
+	if p == nil {
+		return nil
+	}
+	return NewRetryPolicy(p.maxRetries, p.backoff)
+}
+
+// DeadEndpoints returns the endpoints that stayed unreachable after retries
+func (p *RetryPolicy) DeadEndpoints() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sortedKeys(p.dead)
+}
+
+// markDead records an unreachable endpoint, logging it the first time
+func (p *RetryPolicy) markDead(endpoint string, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	seen := p.dead[endpoint]
+	p.dead[endpoint] = true
+	p.mu.Unlock()
+	if !seen {
+		p.logger.Warn("endpoint unreachable", "endpoint", endpoint, "error", err)
+	}
+}
+
+// delay returns the jittered wait before the given retry, counted from 0
+func (p *RetryPolicy) delay(retry int) time.Duration {
+	d := p.backoff << retry
+	d = time.Duration(float64(d) * (0.5 + rand.Float64()))
+	return min(d, maxRetryDelay)
+}
+
+// RetryError is returned when a request still failed transiently after all
+// its attempts
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+// Error implements error
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (gave up after %d attempts)", e.Err, e.Attempts)
+}
+
+// Unwrap returns the error of the last attempt
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the last attempt timed out
+func (e *RetryError) Timeout() bool {
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// transientError reports whether a request error is worth retrying: the
+// target timed out, dropped or refused the connection. TLS, DNS and URL
+// errors fail the same way every time.
+func transientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// transientStatus reports whether a response says to try again later
+func transientStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait a Retry-After header asks for in seconds, or 0
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryDelay)
+}
+
+// retryTransport retries the transient failures of the policy, if any,
+// over an attemptTransport giving each attempt its own timeout, so a timed
+// out attempt can be retried within the same client call. Attempts wait
+// while the circuit breaker is open.
+type retryTransport struct {
+	base    http.RoundTripper
+	policy  *RetryPolicy
+	breaker *CircuitBreaker
+}
+
+// retries returns how often a failed attempt may be retried
+func (t *retryTransport) retries() int {
+	if t.policy == nil {
+		return 0
+	}
+	return t.policy.maxRetries
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+		last := attempt == t.retries() || (req.Body != nil && req.GetBody == nil)
+		switch {
+		case err == nil && !transientStatus(resp.StatusCode):
+			return resp, nil
+		case err == nil && last:
+			return resp, nil
+		case err != nil && !transientError(err):
+			return nil, err
+		case err != nil && last:
+			if attempt == 0 {
+				return nil, err
+			}
+			return nil, &RetryError{Attempts: attempt + 1, Err: err}
+		}
+
+		wait := t.policy.delay(attempt)
+		if resp != nil {
+			if after := retryAfter(resp); after > 0 {
+				wait = after
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		t.policy.logger.Debug("retrying request", "url", req.URL.String(), "attempt", attempt+1, "wait", wait, "error", err)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %v", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// attempt sends req once, when the breaker is not holding requests back.
+// The attempt's timeout, pacing and breaker record are up to the
+// attemptTransport below.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// cancelBody releases the context of an attempt together with its body
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,177 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// RobotsOverride is a page visited against a robots directive: a link the
+// crawler was asked not to follow, unless CrawlRespectRobots, or a page asking
+// not to be indexed, which the site map lists regardless
+type RobotsOverride struct {
+	URL    string `json:"url"`
+	Rule   string `json:"rule"`   // The directive, e.g. "rel=nofollow" or "X-Robots-Tag: noindex"
+	Source string `json:"source"` // The page carrying the directive
+}
+
+// robotsDirectives returns the directives of a page's robots meta tags and
+// X-Robots-Tag headers, each with the rule naming where it came from, e.g.
+// "nofollow" from `<meta name="robots" content="nofollow">`. "none" is
+// both nofollow and noindex. Header directives scoped to a named crawler,
+// such as "googlebot: nofollow", apply too.
+func robotsDirectives(resp *http.Response, node *html.Node) map[string]string {
+	directives := make(map[string]string)
+	add := func(content, source string) {
+		for _, directive := range strings.Split(content, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			if _, value, scoped := strings.Cut(directive, ":"); scoped {
+				directive = strings.TrimSpace(value)
+			}
+			names := []string{directive}
+			if directive == "none" {
+				names = []string{"nofollow", "noindex"}
+			}
+			for _, name := range names {
+				if name != "nofollow" && name != "noindex" {
+					continue
+				}
+				if _, ok := directives[name]; !ok {
+					directives[name] = source + ": " + directive
+				}
+			}
+		}
+	}
+	if resp != nil {
+		for _, value := range resp.Header.Values("X-Robots-Tag") {
+			add(value, "X-Robots-Tag")
+		}
+	}
+
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "meta" && strings.EqualFold(attrValue(n, "name"), "robots") {
+			add(attrValue(n, "content"), "meta robots")
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			find(child)
+		}
+	}
+	find(node)
+	return directives
+}
+
+// nofollowLinks returns the links of a page's anchors and areas marked
+// rel=nofollow, resolved against base
+func (c *WebCrawler) nofollowLinks(node *html.Node, base *url.URL) map[string]bool {
+	links := make(map[string]bool)
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "area") {
+			for _, rel := range strings.Fields(strings.ToLower(attrValue(n, "rel"))) {
+				if rel == "nofollow" {
+					if link := c.resolveURL(base, attrValue(n, "href")); link != "" {
+						links[link] = true
+					}
+					break
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			find(child)
+		}
+	}
+	find(node)
+	return links
+}
+
+// followable applies a page's robots directives to the links found on it.
+// Links the page or its anchors ask not to be followed are kept and
+// remembered, so the pages reached only through them are recorded as
+// overrides, unless CrawlRespectRobots is set, when they are dropped. A page asking not to
+// be indexed is recorded either way.
+func (c *WebCrawler) followable(pageURL string, resp *http.Response, node *html.Node, base *url.URL, links []string) []string {
+	directives := robotsDirectives(resp, node)
+	nofollow := c.nofollowLinks(node, base)
+	if rule, ok := directives["noindex"]; ok {
+		c.logger.Debug("page asks not to be indexed", "url", pageURL, "rule", rule)
+		c.robotsLock.Lock()
+		c.noindex = append(c.noindex, RobotsOverride{URL: pageURL, Rule: rule, Source: pageURL})
+		c.robotsLock.Unlock()
+	}
+
+	var kept []string
+	c.robotsLock.Lock()
+	defer c.robotsLock.Unlock()
+	for _, link := range links {
+		rule := directives["nofollow"]
+		if rule == "" && nofollow[link] {
+			rule = "rel=nofollow"
+		}
+		key := canonicalURL(link, c.config.CrawlWildcardParams)
+		if rule == "" {
+			c.freeLinks[key] = true
+			kept = append(kept, link)
+			continue
+		}
+		if c.config.CrawlRespectRobots {
+			c.logger.Debug("not following link", "url", link, "rule", rule, "source", pageURL)
+			continue
+		}
+		if _, ok := c.robotsLinks[key]; !ok {
+			c.robotsLinks[key] = RobotsOverride{Rule: rule, Source: pageURL}
+		}
+		kept = append(kept, link)
+	}
+	return kept
+}
+
+// GetRobotsOverrides returns the pages visited against robots directives,
+// sorted by URL and rule: those every link found to them asked not to be
+// followed, and those asking not to be indexed
+func (c *WebCrawler) GetRobotsOverrides() []RobotsOverride {
+	c.visitedLock.RLock()
+	c.robotsLock.Lock()
+	overrides := append([]RobotsOverride(nil), c.noindex...)
+	for key, override := range c.robotsLinks {
+		fetched, visited := c.visited[key]
+		if !visited || c.freeLinks[key] {
+			continue
+		}
+		override.URL = fetched
+		overrides = append(overrides, override)
+	}
+	c.robotsLock.Unlock()
+	c.visitedLock.RUnlock()
+
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].URL != overrides[j].URL {
+			return overrides[i].URL < overrides[j].URL
+		}
+		return overrides[i].Rule < overrides[j].Rule
+	})
+	return overrides
+}
+
+// saveRobotsOverrides writes robots overrides to path as an indented JSON
+// array
+func saveRobotsOverrides(path string, overrides []RobotsOverride) error {
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode robots overrides: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write robots overrides: %v", err)
+	}
+	return nil
+}
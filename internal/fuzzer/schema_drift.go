@@ -0,0 +1,145 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// revealingField matches the names of response fields that expose internals
+// when a payload makes them appear: exceptions, debug output, stack traces,
+// queries and credentials. Plain error messages are expected for bad input.
+var revealingField = regexp.MustCompile(`(?i)exception|trace|stack|debug|sql|query|internal|secret|password|token`)
+
+// schemaChange is one way a response differs from the baseline schema
+type schemaChange struct {
+	path   string // JSONPath-like location of the field, e.g. $.user.roles[]
+	change string // What differs, e.g. "added (object)"
+}
+
+// schemaDrift compares a response document with the schema of the baseline
+// response and returns the fields the baseline lacked and those whose type
+// changed, in path order. Missing fields are not drift: error responses and
+// filtered results leave fields out all the time.
+func schemaDrift(schema map[string]interface{}, doc interface{}) []schemaChange {
+	changes := make(map[string]string)
+	compareSchema(schema, doc, "$", changes)
+
+	drift := make([]schemaChange, 0, len(changes))
+	for _, path := range sortedKeys(changes) {
+		drift = append(drift, schemaChange{path: path, change: changes[path]})
+	}
+	return drift
+}
+
+// compareSchema records in changes how the value at path differs from schema
+func compareSchema(schema map[string]interface{}, value interface{}, path string, changes map[string]string) {
+	expected, _ := schema["type"].(string)
+	actual := jsonType(value)
+	if !compatibleTypes(expected, actual) {
+		changes[path] = fmt.Sprintf("%s instead of %s", actual, expected)
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, val := range v {
+			fieldPath := path + "." + key
+			fieldSchema, ok := properties[key].(map[string]interface{})
+			if !ok {
+				changes[fieldPath] = fmt.Sprintf("added (%s)", jsonType(val))
+				continue
+			}
+			compareSchema(fieldSchema, val, fieldPath, changes)
+		}
+	case []interface{}:
+		items, _ := schema["items"].(map[string]interface{})
+		for _, item := range v {
+			compareSchema(items, item, path+"[]", changes)
+		}
+	}
+}
+
+// jsonType names the schema type of a decoded JSON value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// compatibleTypes reports whether a value of type actual fits a schema of
+// type expected. Nulls fit anything and anything fits a null or unknown
+// type, since one sample cannot tell an optional field's real type.
+func compatibleTypes(expected, actual string) bool {
+	switch {
+	case expected == actual, expected == "", expected == "any", expected == "null", actual == "null":
+		return true
+	case expected == "number" && actual == "integer", expected == "integer" && actual == "number":
+		return true
+	}
+	return false
+}
+
+// checkSchemaDrift validates a JSON response against the response schema of
+// the endpoint and reports a schema-drift finding when the payload changed
+// its shape. Without a schema yet, the first successful JSON response
+// becomes the baseline.
+func (f *APIFuzzer) checkSchemaDrift(req *http.Request, reqBody []byte, resp *http.Response, body []byte, payload string) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return
+	}
+
+	if f.responseSchema == nil {
+		if resp.StatusCode < http.StatusMultipleChoices {
+			f.responseSchema = f.inferJSONSchema(doc)
+		}
+		return
+	}
+
+	drift := schemaDrift(f.responseSchema, doc)
+	if len(drift) == 0 {
+		return
+	}
+
+	// The first field revealing internals names the finding, so different
+	// leaks on one endpoint are reported separately
+	finding := &Finding{
+		Type:       "schema-drift",
+		Severity:   SeverityLow,
+		Confidence: ConfidenceTentative,
+		URL:        req.URL.String(),
+		Method:     req.Method,
+		Parameter:  drift[0].path,
+		Payload:    payload,
+	}
+	var evidence []string
+	for _, c := range drift {
+		evidence = append(evidence, c.path+" "+c.change)
+		name := c.path[strings.LastIndex(c.path, ".")+1:]
+		if finding.Severity == SeverityLow && strings.HasPrefix(c.change, "added") && revealingField.MatchString(name) {
+			finding.Severity = SeverityMedium
+			finding.Parameter = c.path
+		}
+	}
+	finding.Evidence = fmt.Sprintf("HTTP %d response differs from the baseline schema: %s", resp.StatusCode, strings.Join(evidence, ", "))
+	captureExchange(finding, req, reqBody, resp, body)
+	f.config.Findings.Add(finding)
+}
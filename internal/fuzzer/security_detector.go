@@ -1,8 +1,6 @@
 package fuzzer
 
 import (
-	"bytes"
-	"io"
 	"net/http"
 	"strings"
 )
@@ -16,13 +14,11 @@ type SecurityBlock struct {
 
 // DetectSecurityProtection checks if a response indicates security protection
 func DetectSecurityProtection(resp *http.Response) (*SecurityBlock, error) {
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	// Inspect the start of the body, leaving it intact for later readers
+	body, err := peekBody(resp, defaultMaxBodySize)
 	if err != nil {
 		return nil, err
 	}
-	// Reset body for future reads
-	resp.Body = io.NopCloser(bytes.NewBuffer(body))
 
 	bodyStr := string(body)
 	headers := resp.Header
@@ -0,0 +1,104 @@
+package fuzzer
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Session modes for Config.SessionMode
+const (
+	SessionShared    = "shared"     // All workers share one cookie jar and login
+	SessionPerWorker = "per-worker" // Every worker has its own cookie jar and logs in itself
+)
+
+// sessions hands out the clients workers send with. Without
+// PreserveSessions every worker gets the base client and no cookies are
+// kept. In shared mode all workers get one client with a cookie jar, logged
+// in once; in per-worker mode each worker gets a client with its own jar and
+// login, so a payload that logs one worker out or changes its session state
+// leaves the others alone.
+type sessions struct {
+	config *Config
+	base   *http.Client
+	login  *RequestTemplate // Request sent to log a new session in; nil for none
+	target *url.URL
+	logger *slog.Logger
+
+	once   sync.Once
+	shared *http.Client
+}
+
+// newSessions prepares the sessions of config on top of base
+func newSessions(config *Config, base *http.Client) (*sessions, error) {
+	s := &sessions{config: config, base: base, logger: logging.For("sessions")}
+	if !config.PreserveSessions || config.LoginRequest == "" {
+		return s, nil
+	}
+
+	login, err := LoadLoginRequest(config.LoginRequest)
+	if err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	s.login, s.target = login, target
+	return s, nil
+}
+
+// client returns the client for a new worker
+func (s *sessions) client() *http.Client {
+	if !s.config.PreserveSessions {
+		return s.base
+	}
+	if s.config.SessionMode == SessionPerWorker {
+		return s.newSession()
+	}
+	s.once.Do(func() { s.shared = s.newSession() })
+	return s.shared
+}
+
+// newSession returns a copy of the base client with an empty cookie jar,
+// logged in when a login request is configured. A failed login is logged
+// and the session used anyway, unauthenticated.
+func (s *sessions) newSession() *http.Client {
+	client := *s.base
+	jar, _ := cookiejar.New(nil) // Only fails for an invalid public suffix list
+	client.Jar = jar
+
+	if s.login != nil {
+		if err := s.logIn(&client); err != nil {
+			s.logger.Warn("login failed, continuing without a session", "error", err)
+		}
+	}
+	return &client
+}
+
+// logIn sends the login request with client, whose jar keeps the session
+// cookies the response sets
+func (s *sessions) logIn(client *http.Client) error {
+	req, _, err := s.login.Build(s.target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("HTTP %d response", resp.StatusCode)
+	}
+	s.logger.Debug("logged in", "status", resp.StatusCode, "cookies", len(client.Jar.Cookies(req.URL)))
+	return nil
+}
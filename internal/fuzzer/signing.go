@@ -0,0 +1,314 @@
+package fuzzer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Signer signs a request just before it is sent, so APIs behind a gateway
+// that checks signatures accept mutated requests and the fuzzing reaches the
+// backend. Sign is called from many workers at once.
+type Signer interface {
+	// Sign sets the headers authenticating req, whose body is body
+	Sign(req *http.Request, body []byte) error
+}
+
+// AWSCredentials are the keys requests are signed with for AWS Signature
+// Version 4
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Set for temporary credentials
+}
+
+// AWSSigner signs requests with AWS Signature Version 4, e.g. for API
+// Gateway (service execute-api) or Lambda function URLs (service lambda)
+type AWSSigner struct {
+	Credentials AWSCredentials
+	Region      string
+	Service     string
+}
+
+// NewAWSSigner creates a SigV4 signer for one region and service
+func NewAWSSigner(credentials AWSCredentials, region, service string) (*AWSSigner, error) {
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS signing needs an access key ID and a secret access key")
+	}
+	if region == "" || service == "" {
+		return nil, fmt.Errorf("AWS signing needs a region and a service")
+	}
+	return &AWSSigner{Credentials: credentials, Region: region, Service: service}, nil
+}
+
+// Sign implements Signer. The host, Content-Type and X-Amz-* headers are
+// signed; headers added later on the way out, such as User-Agent, are not.
+func (s *AWSSigner) Sign(req *http.Request, body []byte) error {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.Credentials.SessionToken)
+	}
+	if s.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(values))
+			for i, value := range values {
+				trimmed[i] = strings.Join(strings.Fields(value), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := sortedKeys(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsCanonicalPath(req.URL, s.Service != "s3"),
+		awsCanonicalQuery(req.URL.RawQuery),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSum(sha256.New, []byte("AWS4"+s.Credentials.SecretAccessKey), date)
+	key = hmacSum(sha256.New, key, s.Region)
+	key = hmacSum(sha256.New, key, s.Service)
+	key = hmacSum(sha256.New, key, "aws4_request")
+	signature := hex.EncodeToString(hmacSum(sha256.New, key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.Credentials.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// awsCanonicalPath encodes the path of u as SigV4 expects: as sent for S3,
+// escaped once more for other services
+func awsCanonicalPath(u *url.URL, double bool) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	if !double {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsCanonicalQuery sorts and escapes a query string as SigV4 expects.
+// Fuzzed queries are often malformed, so parts that do not unescape are
+// taken as they are rather than dropped.
+func awsCanonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var pairs [][2]string
+	for _, part := range strings.Split(rawQuery, "&") {
+		name, value, _ := strings.Cut(part, "=")
+		pairs = append(pairs, [2]string{awsEscape(queryUnescape(name)), awsEscape(queryUnescape(value))})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][0] != pairs[j][0] {
+			return pairs[i][0] < pairs[j][0]
+		}
+		return pairs[i][1] < pairs[j][1]
+	})
+	encoded := make([]string, len(pairs))
+	for i, pair := range pairs {
+		encoded[i] = pair[0] + "=" + pair[1]
+	}
+	return strings.Join(encoded, "&")
+}
+
+// queryUnescape decodes a query component, or returns it as is if it does
+// not decode
+func queryUnescape(s string) string {
+	if decoded, err := url.QueryUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// awsEscape percent-encodes everything but the unreserved characters of
+// RFC 3986, as SigV4 expects
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// HMACSigner sets a header to an HMAC of the request body, as webhooks and
+// many in-house gateways expect, e.g. X-Hub-Signature-256: sha256=<hex>
+type HMACSigner struct {
+	Header   string // Header carrying the signature
+	Secret   []byte
+	Hash     string // sha1, sha256 or sha512
+	Encoding string // hex or base64
+	Prefix   string // Written before the signature, e.g. "sha256="
+}
+
+// hmacHashes are the hash functions an HMACSigner can use
+var hmacHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// NewHMACSigner creates a signer setting header to the HMAC of the body,
+// with the hash (default sha256) and encoding (default hex) given
+func NewHMACSigner(header string, secret []byte, hashName, encoding, prefix string) (*HMACSigner, error) {
+	if header == "" {
+		return nil, fmt.Errorf("HMAC signing needs a header")
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("HMAC signing needs a secret")
+	}
+	if hashName == "" {
+		hashName = "sha256"
+	}
+	if hmacHashes[hashName] == nil {
+		return nil, fmt.Errorf("unknown HMAC hash %q (want sha1, sha256 or sha512)", hashName)
+	}
+	if encoding == "" {
+		encoding = "hex"
+	}
+	if encoding != "hex" && encoding != "base64" {
+		return nil, fmt.Errorf("unknown HMAC encoding %q (want hex or base64)", encoding)
+	}
+	return &HMACSigner{Header: http.CanonicalHeaderKey(header), Secret: secret, Hash: hashName, Encoding: encoding, Prefix: prefix}, nil
+}
+
+// Sign implements Signer
+func (s *HMACSigner) Sign(req *http.Request, body []byte) error {
+	sum := hmacSum(hmacHashes[s.Hash], s.Secret, string(body))
+	signature := hex.EncodeToString(sum)
+	if s.Encoding == "base64" {
+		signature = base64.StdEncoding.EncodeToString(sum)
+	}
+	req.Header.Set(s.Header, s.Prefix+signature)
+	return nil
+}
+
+// ParseSigner parses a signer spec:
+//
+//	aws:<region>:<service>                           AWS SigV4 with credentials
+//	hmac:<header>[:<hash>[:<encoding>[:<prefix>]]]   HMAC of the body with secret
+func ParseSigner(spec string, credentials AWSCredentials, secret []byte) (Signer, error) {
+	kind, rest, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "aws":
+		region, service, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid signer %q: expected aws:<region>:<service>", spec)
+		}
+		signer, err := NewAWSSigner(credentials, region, service)
+		if err != nil {
+			return nil, err
+		}
+		return signer, nil
+	case "hmac":
+		fields := strings.SplitN(rest, ":", 4)
+		fields = append(fields, "", "", "")
+		signer, err := NewHMACSigner(fields[0], secret, fields[1], fields[2], fields[3])
+		if err != nil {
+			return nil, err
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("invalid signer %q: expected aws:<region>:<service> or hmac:<header>", spec)
+	}
+}
+
+// signTransport signs the requests to hosts a signer is configured for, last
+// thing before they are sent
+type signTransport struct {
+	base    http.RoundTripper
+	signers map[string]Signer // By host; "" for the target's
+	target  string            // Host of the target
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *signTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Host)
+	signer := t.signers[host]
+	if signer == nil && host == t.target {
+		signer = t.signers[""]
+	}
+	if signer == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+		req.Body.Close()
+	}
+	req = req.Clone(req.Context())
+	req.Body = http.NoBody
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	if len(body) > 0 {
+		req.Body, _ = req.GetBody()
+	}
+	if err := signer.Sign(req, body); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %v", err)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSum returns the HMAC of data under key
+func hmacSum(h func() hash.Hash, key []byte, data string) []byte {
+	mac := hmac.New(h, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
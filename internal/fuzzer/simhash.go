@@ -0,0 +1,157 @@
+package fuzzer
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"regexp"
+	"strings"
+)
+
+const (
+	// defaultMaxFingerprints bounds the response index when no limit is configured
+	defaultMaxFingerprints = 10000
+
+	// simhashDistance is the largest number of differing fingerprint bits for
+	// two responses to count as the same page
+	simhashDistance = 3
+
+	// simhashBands splits a fingerprint into 16-bit bands. Two fingerprints
+	// within simhashDistance bits always share at least one band, so only
+	// fingerprints in the same band buckets need comparing.
+	simhashBands = 4
+)
+
+// volatilePatterns match content that changes on every request (timestamps,
+// session tokens, nonces, request IDs) and would otherwise make every
+// response of a dynamic page look new
+var volatilePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`),
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:?\d{2})?)?`),
+	regexp.MustCompile(`\b\d{1,2}:\d{2}(:\d{2})?\b`),
+	regexp.MustCompile(`\b[0-9a-fA-F]{16,}\b`),
+	regexp.MustCompile(`[A-Za-z0-9+/_-]{24,}={0,2}`),
+	regexp.MustCompile(`\d{6,}`),
+}
+
+// normalizeBody strips volatile content so that reloads of the same page
+// produce the same text
+func normalizeBody(body []byte) string {
+	text := string(body)
+	for _, pattern := range volatilePatterns {
+		text = pattern.ReplaceAllString(text, "~")
+	}
+	return text
+}
+
+// simhash computes a 64-bit locality-sensitive fingerprint of the normalized
+// body from overlapping three-word shingles. Similar bodies get fingerprints
+// that differ in few bits.
+func simhash(body []byte) uint64 {
+	words := strings.Fields(normalizeBody(body))
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	addFeature := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	if len(words) < 3 {
+		addFeature(strings.Join(words, " "))
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		addFeature(strings.Join(words[i:i+3], " "))
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// responseIndex remembers response fingerprints up to a fixed limit and
+// answers whether a new response resembles one already seen. When full, the
+// oldest fingerprints are evicted first. It is not safe for concurrent use.
+type responseIndex struct {
+	max     int
+	buckets [simhashBands]map[uint16][]uint64
+	stored  []uint64 // Ring of stored fingerprints in insertion order
+	next    int      // Ring slot to overwrite once full
+	unique  int      // Distinct responses seen, including evicted ones
+}
+
+// newResponseIndex creates an index holding at most max fingerprints
+func newResponseIndex(max int) *responseIndex {
+	if max <= 0 {
+		max = defaultMaxFingerprints
+	}
+	idx := &responseIndex{max: max}
+	for i := range idx.buckets {
+		idx.buckets[i] = make(map[uint16][]uint64)
+	}
+	return idx
+}
+
+// band returns the i-th 16-bit band of a fingerprint
+func band(fingerprint uint64, i int) uint16 {
+	return uint16(fingerprint >> (16 * i))
+}
+
+// add records a fingerprint and reports whether it is new, i.e. not within
+// simhashDistance of any stored fingerprint
+func (idx *responseIndex) add(fingerprint uint64) bool {
+	for i := range idx.buckets {
+		for _, candidate := range idx.buckets[i][band(fingerprint, i)] {
+			if bits.OnesCount64(candidate^fingerprint) <= simhashDistance {
+				return false
+			}
+		}
+	}
+
+	if len(idx.stored) < idx.max {
+		idx.stored = append(idx.stored, fingerprint)
+	} else {
+		idx.evict(idx.stored[idx.next])
+		idx.stored[idx.next] = fingerprint
+		idx.next = (idx.next + 1) % idx.max
+	}
+	for i := range idx.buckets {
+		key := band(fingerprint, i)
+		idx.buckets[i][key] = append(idx.buckets[i][key], fingerprint)
+	}
+
+	idx.unique++
+	return true
+}
+
+// evict removes one occurrence of a fingerprint from its band buckets
+func (idx *responseIndex) evict(fingerprint uint64) {
+	for i := range idx.buckets {
+		key := band(fingerprint, i)
+		bucket := idx.buckets[i][key]
+		for j, candidate := range bucket {
+			if candidate == fingerprint {
+				bucket = append(bucket[:j], bucket[j+1:]...)
+				break
+			}
+		}
+		if len(bucket) == 0 {
+			delete(idx.buckets[i], key)
+		} else {
+			idx.buckets[i][key] = bucket
+		}
+	}
+}
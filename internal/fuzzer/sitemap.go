@@ -0,0 +1,191 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SiteMap is the machine-readable result of a discovery crawl: every page
+// visited, the forms and API endpoints found and the static assets the pages
+// reference. It is meant for scoping before active testing.
+type SiteMap struct {
+	TargetURL    string            `json:"target_url"`
+	Generated    time.Time         `json:"generated"`
+	Pages        []SiteMapPage     `json:"pages"`
+	Forms        []SiteMapForm     `json:"forms"`
+	APIEndpoints []SiteMapEndpoint `json:"api_endpoints"`
+	Assets       []string          `json:"assets"`
+
+	// Query parameters seen per page, with their inferred types
+	Parameters []*InventoryEndpoint `json:"parameters,omitempty"`
+
+	// Pages visited against robots directives, for audit
+	RobotsOverrides []RobotsOverride `json:"robots_overrides,omitempty"`
+}
+
+// SiteMapPage is a crawled page
+type SiteMapPage struct {
+	URL    string   `json:"url"`
+	Params []string `json:"params,omitempty"` // Query parameter names
+}
+
+// SiteMapForm is a form and the page holding it
+type SiteMapForm struct {
+	URL     string         `json:"url"`
+	Action  string         `json:"action"`
+	Method  string         `json:"method"`
+	Enctype string         `json:"enctype,omitempty"` // Set for POST forms
+	Fields  []SiteMapField `json:"fields"`
+}
+
+// SiteMapField is a form field
+type SiteMapField struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Options  []string `json:"options,omitempty"`
+}
+
+// SiteMapEndpoint is a detected API endpoint
+type SiteMapEndpoint struct {
+	URL      string                  `json:"url"`
+	Method   string                  `json:"method"`
+	Params   map[string]SiteMapParam `json:"params,omitempty"`
+	Declared bool                    `json:"declared,omitempty"` // Declared by an API spec
+}
+
+// SiteMapParam is the type of an API parameter
+type SiteMapParam struct {
+	Type     string   `json:"type"`
+	Required bool     `json:"required,omitempty"`
+	Format   string   `json:"format,omitempty"`
+	Enum     []string `json:"enum,omitempty"`
+}
+
+// newSiteMap builds the site map of a finished crawl and the targets
+// collected from it
+func newSiteMap(targetURL string, crawler *WebCrawler, targets []Target) *SiteMap {
+	siteMap := &SiteMap{
+		TargetURL:    targetURL,
+		Generated:    time.Now(),
+		Pages:        []SiteMapPage{},
+		Forms:        []SiteMapForm{},
+		APIEndpoints: []SiteMapEndpoint{},
+		Assets:       crawler.GetAssets(),
+
+		RobotsOverrides: crawler.GetRobotsOverrides(),
+	}
+	if siteMap.Assets == nil {
+		siteMap.Assets = []string{}
+	}
+
+	visited := crawler.GetVisitedURLs()
+	sort.Strings(visited)
+	for _, pageURL := range visited {
+		page := SiteMapPage{URL: pageURL}
+		if parsed, err := url.Parse(pageURL); err == nil {
+			page.Params = sortedKeys(parsed.Query())
+		}
+		siteMap.Pages = append(siteMap.Pages, page)
+	}
+
+	for _, target := range targets {
+		switch target.Kind {
+		case TargetForm:
+			form := SiteMapForm{URL: target.URL, Action: target.Form.Action, Method: target.Form.Method,
+				Fields: []SiteMapField{}}
+			if form.Method == http.MethodPost {
+				form.Enctype = target.Form.Enctype
+			}
+			for _, field := range target.Form.Fields {
+				form.Fields = append(form.Fields, SiteMapField{
+					Name:     field.Name,
+					Type:     field.Type,
+					Required: field.Required,
+					Pattern:  field.Pattern,
+					Options:  field.Options,
+				})
+			}
+			siteMap.Forms = append(siteMap.Forms, form)
+
+		case TargetAPI:
+			siteMap.APIEndpoints = append(siteMap.APIEndpoints, siteMapEndpoint(target.Endpoint))
+
+		case TargetParams:
+			if target.Params != nil {
+				siteMap.Parameters = append(siteMap.Parameters, target.Params)
+			}
+		}
+	}
+	return siteMap
+}
+
+// siteMapEndpoint describes an API endpoint for the site map
+func siteMapEndpoint(endpoint *APIEndpoint) SiteMapEndpoint {
+	described := SiteMapEndpoint{URL: endpoint.URL, Method: endpoint.Method, Declared: endpoint.Declared}
+	if len(endpoint.Params) > 0 {
+		described.Params = make(map[string]SiteMapParam)
+		for name, param := range endpoint.Params {
+			described.Params[name] = SiteMapParam{
+				Type:     param.Type,
+				Required: param.Required,
+				Format:   param.Format,
+				Enum:     param.Enum,
+			}
+		}
+	}
+	return described
+}
+
+// Save writes the site map as indented JSON
+func (m *SiteMap) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create site map: %v", err)
+	}
+	defer file.Close()
+	return m.Write(file)
+}
+
+// Write encodes the site map as indented JSON, leaving URLs unescaped
+func (m *SiteMap) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(m); err != nil {
+		return fmt.Errorf("failed to write site map: %v", err)
+	}
+	return nil
+}
+
+// SaveInventory writes the detected API endpoints to path as an indented
+// JSON array, in the site map's endpoint format
+func (d *APIDetector) SaveInventory(path string) error {
+	endpoints := d.Endpoints()
+	inventory := make([]SiteMapEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		inventory = append(inventory, siteMapEndpoint(endpoint))
+	}
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode API inventory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write API inventory: %v", err)
+	}
+	return nil
+}
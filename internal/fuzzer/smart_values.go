@@ -0,0 +1,201 @@
+package fuzzer
+
+import (
+	"math/rand"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kinds of observed values that parameters never seen themselves borrow by
+// their name
+const (
+	observedID    = "id"
+	observedSlug  = "slug"
+	observedToken = "token"
+)
+
+// Patterns of slugs and tokens; IDs are integers and UUIDs
+var (
+	slugValue  = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)+$`)
+	tokenValue = regexp.MustCompile(`^[A-Za-z0-9_\-]{16,}$`)
+)
+
+// observedKind returns the kind of a value, or "" when it is of none
+func observedKind(value string) string {
+	switch {
+	case integerValue.MatchString(value) && !strings.HasPrefix(value, "-"), uuidValue.MatchString(value):
+		return observedID
+	case slugValue.MatchString(value):
+		return observedSlug
+	case tokenValue.MatchString(value) && strings.ContainsAny(value, "0123456789") &&
+		strings.IndexFunc(value, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' }) >= 0:
+		return observedToken
+	}
+	return ""
+}
+
+// tokenWords are the words of parameter names holding tokens
+var tokenWords = map[string]bool{
+	"token": true, "key": true, "apikey": true, "nonce": true, "hash": true, "sig": true, "signature": true,
+}
+
+// nameKind returns the kind of values a parameter name suggests, or "" when
+// it suggests none. Names are matched by their words, so keyword and
+// signup suggest nothing.
+func nameKind(field string) string {
+	name := strings.ToLower(field)
+	words := nameWords(field)
+	last := words[len(words)-1]
+	switch {
+	case last == "id" || last == "uuid" || name == "uid" || name == "pid":
+		return observedID
+	case slices.Contains(words, "slug") || name == "handle" || name == "permalink":
+		return observedSlug
+	}
+	for _, word := range words {
+		// csrftoken and authtoken are written as one word
+		if tokenWords[word] || strings.HasSuffix(word, "token") {
+			return observedToken
+		}
+	}
+	return ""
+}
+
+// nameWords splits a parameter name into its lower-case words, at
+// punctuation such as _ and - and where camelCase starts a new word. It
+// returns at least one word.
+func nameWords(field string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	runes := []rune(field)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) ||
+			unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+			// userId and APIKey start a word at I and K
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+	if len(words) == 0 {
+		return []string{""}
+	}
+	return words
+}
+
+// Sample returns a real value observed for a field, or for a field never
+// observed one of the kind its name suggests, such as an ID seen elsewhere
+// for user_id
+func (l *GrammarLearner) Sample(rng *rand.Rand, field string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	samples := l.samples[field]
+	if len(samples) == 0 {
+		samples = l.kinds[nameKind(field)]
+	}
+	if len(samples) == 0 {
+		return "", false
+	}
+	return samples[rng.Intn(len(samples))], true
+}
+
+// Seed returns a real value observed for a field, as Sample does, changed
+// the way mutateObserved changes values
+func (l *GrammarLearner) Seed(rng *rand.Rand, field string) (string, bool) {
+	value, ok := l.Sample(rng, field)
+	if !ok {
+		return "", false
+	}
+	return mutateObserved(rng, value), true
+}
+
+// mutateObserved changes a value while keeping its shape, so it still
+// passes checks of its format: a number in it moves to a neighbouring
+// value, a letter or digit changes within its class, or a segment between
+// punctuation is dropped or repeated
+func mutateObserved(rng *rand.Rand, value string) string {
+	tokens := tokenizeSample(value)
+	var runs []int
+	for i, tok := range tokens {
+		if tok.class != "" {
+			runs = append(runs, i)
+		}
+	}
+	if len(runs) == 0 {
+		return value
+	}
+	i := runs[rng.Intn(len(runs))]
+	tok := &tokens[i]
+
+	// Values of a single run have no segments to drop or repeat
+	strategy := rng.Intn(3)
+	if len(runs) == 1 {
+		strategy = rng.Intn(2)
+	}
+	switch strategy {
+	case 0: // Neighbouring number, or a character of the same class
+		if n, err := strconv.ParseUint(tok.text, 10, 63); err == nil && tok.class == "digit" {
+			deltas := []int64{1, -1, 2, -2, int64(rng.Intn(100)) + 3}
+			next := int64(n) + deltas[rng.Intn(len(deltas))]
+			if next < 0 {
+				next = int64(n) + 1
+			}
+			text := strconv.FormatInt(next, 10)
+			// Zero-padded numbers keep their width
+			if len(text) < len(tok.text) {
+				text = strings.Repeat("0", len(tok.text)-len(text)) + text
+			}
+			tok.text = text
+			break
+		}
+		fallthrough
+	case 1: // A character of the same class
+		for _, class := range learnedClasses {
+			if class.name == tok.class {
+				pos := rng.Intn(len(tok.text))
+				tok.text = tok.text[:pos] + string(class.chars[rng.Intn(len(class.chars))]) + tok.text[pos+1:]
+			}
+		}
+	case 2: // Segment dropped or repeated
+		if rng.Intn(2) == 0 {
+			tok.text = ""
+			// The punctuation joining it to the rest goes too
+			if i > 0 && tokens[i-1].class == "" {
+				tokens[i-1].text = ""
+			} else if i+1 < len(tokens) {
+				tokens[i+1].text = ""
+			}
+		} else if i > 0 && tokens[i-1].class == "" {
+			tok.text += tokens[i-1].text + tok.text
+		} else {
+			tok.text += tokens[i+1].text + tok.text
+		}
+	}
+
+	var b strings.Builder
+	for _, tok := range tokens {
+		b.WriteString(tok.text)
+	}
+	if b.Len() == 0 {
+		return value
+	}
+	return b.String()
+}
@@ -0,0 +1,261 @@
+package fuzzer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// SmugglingProber detects HTTP request smuggling by sending requests with
+// conflicting Content-Length and Transfer-Encoding headers over raw
+// connections and watching for desync timeouts or gateway errors
+type SmugglingProber struct {
+	config *Config
+	target *url.URL
+	logger *slog.Logger
+}
+
+// smugglingResult is the outcome of a single raw probe
+type smugglingResult struct {
+	status   int
+	elapsed  time.Duration
+	timedOut bool
+	raw      string
+}
+
+// transferEncodingVariants are obfuscated Transfer-Encoding headers that
+// front-end and back-end servers commonly disagree on
+var transferEncodingVariants = []string{
+	"Transfer-Encoding: chunked",
+	"Transfer-Encoding : chunked",
+	"Transfer-Encoding:\tchunked",
+	"Transfer-Encoding: xchunked",
+	"Transfer-Encoding: chunked\r\nTransfer-Encoding: x",
+	" Transfer-Encoding: chunked",
+}
+
+// NewSmugglingProber creates a new request smuggling prober
+func NewSmugglingProber(config *Config) (*SmugglingProber, error) {
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme for smuggling probes: %s", target.Scheme)
+	}
+
+	return &SmugglingProber{
+		config: config,
+		target: target,
+		logger: logging.For("smuggling"),
+	}, nil
+}
+
+// Run sends the CL.TE and TE.CL probes for every Transfer-Encoding variant
+func (p *SmugglingProber) Run() error {
+	baseline, err := p.baseline()
+	if err != nil {
+		return fmt.Errorf("baseline request failed: %v", err)
+	}
+	if baseline.timedOut {
+		return fmt.Errorf("baseline request timed out, cannot measure desync delays")
+	}
+	p.logger.Debug("baseline measured", "status", baseline.status, "elapsed", baseline.elapsed)
+
+	// A probe counts as delayed if it takes well beyond the baseline
+	delayThreshold := min(baseline.elapsed+5*time.Second, p.timeout())
+
+	for _, te := range transferEncodingVariants {
+		for _, technique := range []string{"CL.TE", "TE.CL"} {
+			payload := p.buildPayload(technique, te)
+
+			result, err := p.send(payload)
+			if err != nil {
+				p.logger.Debug("probe failed", "technique", technique, "header", te, "error", err)
+				continue
+			}
+
+			anomaly := p.classify(result, baseline, delayThreshold)
+			if anomaly == "" {
+				continue
+			}
+
+			// Timing anomalies are confirmed by repeating the probe once
+			confidence := ConfidenceTentative
+			if confirm, err := p.send(payload); err == nil && p.classify(confirm, baseline, delayThreshold) == anomaly {
+				confidence = ConfidenceFirm
+			}
+
+			p.logger.Warn("possible request smuggling", "technique", technique, "header", te, "anomaly", anomaly)
+			p.config.Findings.Add(&Finding{
+				Type:       "request-smuggling",
+				Severity:   SeverityHigh,
+				Confidence: confidence,
+				URL:        p.target.String(),
+				Method:     http.MethodPost,
+				Parameter:  technique + " " + strings.TrimSpace(strings.SplitN(te, "\r\n", 2)[0]),
+				Payload:    payload,
+				Evidence:   fmt.Sprintf("%s (baseline %s, probe %s)", anomaly, baseline.elapsed, result.elapsed),
+				Request:    payload,
+				Response:   result.raw,
+			})
+		}
+	}
+
+	return nil
+}
+
+// baseline sends an unambiguous POST to measure normal latency
+func (p *SmugglingProber) baseline() (*smugglingResult, error) {
+	body := "x=1"
+	payload := p.requestHead() +
+		fmt.Sprintf("Content-Length: %d\r\n\r\n", len(body)) +
+		body
+	return p.send(payload)
+}
+
+// buildPayload creates the desync request for a technique. For CL.TE the
+// front-end forwards the Content-Length bytes and a chunked back-end waits
+// for the rest of the chunk; for TE.CL the front-end stops at the
+// terminating chunk and a Content-Length back-end waits for the missing byte.
+func (p *SmugglingProber) buildPayload(technique, te string) string {
+	switch technique {
+	case "CL.TE":
+		return p.requestHead() + "Content-Length: 4\r\n" + te + "\r\n\r\n" + "1\r\nA\r\nX"
+	default:
+		return p.requestHead() + "Content-Length: 6\r\n" + te + "\r\n\r\n" + "0\r\n\r\nX"
+	}
+}
+
+// requestHead returns the request line and fixed headers for a probe
+func (p *SmugglingProber) requestHead() string {
+	path := p.target.RequestURI()
+	host := p.target.Host
+	if override := p.config.Headers["Host"]; override != "" {
+		host = override
+	}
+	head := fmt.Sprintf("POST %s HTTP/1.1\r\n", path) +
+		fmt.Sprintf("Host: %s\r\n", host) +
+		"Content-Type: application/x-www-form-urlencoded\r\n" +
+		"Connection: close\r\n"
+	for _, header := range extraHeaders(p.config) {
+		if header[0] != "Host" {
+			head += header[0] + ": " + header[1] + "\r\n"
+		}
+	}
+	return head
+}
+
+// timeout returns how long a probe waits for its response
+func (p *SmugglingProber) timeout() time.Duration {
+	if p.config.Timeout > 0 {
+		return p.config.Timeout
+	}
+	return defaultClientTimeout
+}
+
+// send writes a raw payload and reads a single response. It waits for the
+// rate limit and the host's politeness policy like any client request, and
+// an answered exchange is recorded in Config.Traffic.
+func (p *SmugglingProber) send(payload string) (*smugglingResult, error) {
+	release, err := pace(context.Background(), p.config, p.target.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	timeout := p.timeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	tlsConfig, err := TLSConfig(p.config)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialTarget(ctx, p.target, timeout, p.config.Resolve, p.config.ServerNames, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	conn.SetDeadline(start.Add(timeout))
+
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		return nil, fmt.Errorf("failed to write probe: %v", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	elapsed := time.Since(start)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return &smugglingResult{elapsed: elapsed, timedOut: true}, nil
+		}
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+	release()
+
+	if p.config.Traffic != nil {
+		method, target, header, reqBody := splitRawRequest(payload)
+		u, _ := p.target.Parse(target)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxExchangeBody))
+		p.config.Traffic.recordRaw(start, method, u, header, []byte(reqBody), resp, body)
+	}
+
+	// Headers in a fixed order, so the evidence reads the same every run
+	raw := fmt.Sprintf("%s %s\r\n", resp.Proto, resp.Status)
+	for _, name := range sortedKeys(resp.Header) {
+		for _, v := range resp.Header[name] {
+			raw += name + ": " + v + "\r\n"
+		}
+	}
+
+	return &smugglingResult{
+		status:  resp.StatusCode,
+		elapsed: elapsed,
+		raw:     raw,
+	}, nil
+}
+
+// splitRawRequest returns the method, target, headers and body of a raw
+// request. Header names are kept as written, obfuscated ones included.
+func splitRawRequest(payload string) (string, string, http.Header, string) {
+	head, body, _ := strings.Cut(payload, "\r\n\r\n")
+	lines := strings.Split(head, "\r\n")
+	var method, target string
+	if fields := strings.Fields(lines[0]); len(fields) >= 2 {
+		method, target = fields[0], fields[1]
+	}
+	header := make(http.Header)
+	for _, line := range lines[1:] {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			header[name] = append(header[name], strings.TrimSpace(value))
+		}
+	}
+	return method, target, header, body
+}
+
+// classify describes how a probe deviates from the baseline, or returns ""
+func (p *SmugglingProber) classify(result, baseline *smugglingResult, delayThreshold time.Duration) string {
+	switch {
+	case result.timedOut:
+		return "probe timed out"
+	case result.elapsed >= delayThreshold:
+		return "probe response delayed"
+	case baseline.status < 500 && (result.status == http.StatusBadGateway || result.status == http.StatusGatewayTimeout):
+		return fmt.Sprintf("gateway error %d", result.status)
+	}
+	return ""
+}
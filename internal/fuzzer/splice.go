@@ -0,0 +1,153 @@
+package fuzzer
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/url"
+	"strings"
+)
+
+// spliceFrom splices input with another entry of pool, picked at random,
+// with probability Config.SpliceRate. Without splicing no random choice is
+// made, so seeds replay the same run.
+func spliceFrom(config *Config, rng *rand.Rand, input string, pool []string) string {
+	if config.SpliceRate <= 0 || len(pool) < 2 || rng.Float64() >= config.SpliceRate {
+		return input
+	}
+	other := pool[rng.Intn(len(pool))]
+	if other == input {
+		return input
+	}
+	return splice(rng, input, other)
+}
+
+// splice combines two inputs into one, as AFL's splicing stage does, in a
+// way single-input mutations cannot: the head of a with the tail of b, cut
+// where the inputs have structure. Two form submissions "METHOD URL data"
+// keep a's method and URL and splice their data, JSON objects by key,
+// arrays by element and form-encoded data by parameter. Otherwise the URLs
+// of the inputs are spliced: a's scheme and host are kept, with a's path
+// and b's query, or their query parameters or path segments spliced. URLs
+// that do not parse are cut as strings.
+func splice(rng *rand.Rand, a, b string) string {
+	partsA, partsB := strings.SplitN(a, " ", 3), strings.SplitN(b, " ", 3)
+	if len(partsA) == 3 && len(partsB) == 3 {
+		return partsA[0] + " " + partsA[1] + " " + spliceData(rng, partsA[2], partsB[2])
+	}
+	// The URL of a form submission follows its method
+	i := min(len(partsA)-1, 1)
+	partsA[i] = spliceURLs(rng, partsA[i], partsB[min(len(partsB)-1, 1)])
+	return strings.Join(partsA, " ")
+}
+
+// spliceURLs splices two URLs, or cuts them as strings when either does
+// not parse
+func spliceURLs(rng *rand.Rand, a, b string) string {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return spliceStrings(rng, a, b)
+	}
+	switch rng.Intn(3) {
+	case 0: // Path of one, query of the other
+		ua.RawQuery = ub.RawQuery
+	case 1: // Parameters of both
+		if ua.RawQuery != "" && ub.RawQuery != "" {
+			ua.RawQuery = strings.Join(spliceParts(rng, strings.Split(ua.RawQuery, "&"), strings.Split(ub.RawQuery, "&")), "&")
+			break
+		}
+		ua.RawQuery = ub.RawQuery
+	case 2: // Path segments of both
+		pathA, pathB := ua.EscapedPath(), ub.EscapedPath()
+		segments := spliceParts(rng, strings.Split(strings.TrimPrefix(pathA, "/"), "/"), strings.Split(strings.TrimPrefix(pathB, "/"), "/"))
+		rawPath := strings.Join(segments, "/")
+		if strings.HasPrefix(pathA, "/") {
+			rawPath = "/" + rawPath
+		}
+		path, err := url.PathUnescape(rawPath)
+		if err != nil {
+			return spliceStrings(rng, a, b)
+		}
+		ua.Path, ua.RawPath = path, rawPath
+	}
+	return ua.String()
+}
+
+// spliceData splices the data of two form submissions: JSON objects by
+// key, JSON arrays by element and anything else as form-encoded parameters
+func spliceData(rng *rand.Rand, a, b string) string {
+	docA, okA := decodeJSONData(a)
+	docB, okB := decodeJSONData(b)
+	if okA && okB {
+		var spliced interface{}
+		switch docA := docA.(type) {
+		case map[string]interface{}:
+			if docB, ok := docB.(map[string]interface{}); ok {
+				obj := make(map[string]interface{})
+				for _, key := range spliceParts(rng, sortedKeys(docA), sortedKeys(docB)) {
+					if value, ok := docB[key]; ok {
+						obj[key] = value
+					} else {
+						obj[key] = docA[key]
+					}
+				}
+				spliced = obj
+			}
+		case []interface{}:
+			if docB, ok := docB.([]interface{}); ok {
+				spliced = spliceParts(rng, docA, docB)
+			}
+		}
+		if data, err := json.Marshal(spliced); err == nil && spliced != nil {
+			return string(data)
+		}
+		return spliceStrings(rng, a, b)
+	}
+	if a == "" || b == "" {
+		return a + b
+	}
+	return strings.Join(spliceParts(rng, strings.Split(a, "&"), strings.Split(b, "&")), "&")
+}
+
+// decodeJSONData decodes form data holding a JSON document, keeping
+// numbers as written
+func decodeJSONData(data string) (interface{}, bool) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var document interface{}
+	if decoder.Decode(&document) != nil || decoder.More() {
+		return nil, false
+	}
+	return document, true
+}
+
+// spliceParts returns a head of a, at least its first part, followed by a
+// tail of b, at least its last part
+func spliceParts[T any](rng *rand.Rand, a, b []T) []T {
+	if len(a) == 0 || len(b) == 0 {
+		return append(append([]T(nil), a...), b...)
+	}
+	head := a[:1+rng.Intn(len(a))]
+	tail := b[rng.Intn(len(b)):]
+	return append(append(make([]T, 0, len(head)+len(tail)), head...), tail...)
+}
+
+// spliceStrings cuts two strings at one offset between the first and last
+// bytes they differ at and joins a's head to b's tail, as AFL does. Strings
+// differing in fewer places are cut at an offset of their own each.
+func spliceStrings(rng *rand.Rand, a, b string) string {
+	first, last := -1, -1
+	for i := 0; i < min(len(a), len(b)); i++ {
+		if a[i] != b[i] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first >= 0 && last-first >= 2 {
+		cut := first + 1 + rng.Intn(last-first)
+		return a[:cut] + b[cut:]
+	}
+	return a[:rng.Intn(len(a)+1)] + b[rng.Intn(len(b)+1):]
+}
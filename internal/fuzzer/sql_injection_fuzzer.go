@@ -2,14 +2,36 @@ package fuzzer
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
+// sqlErrorSignatures are fragments of database error messages that leak into
+// responses when injected SQL breaks a query
+var sqlErrorSignatures = []string{
+	"you have an error in your sql syntax",
+	"unclosed quotation mark",
+	"quoted string not properly terminated",
+	"pg::syntaxerror",
+	"syntax error at or near",
+	"sqlite3::",
+	"sqlite_error",
+	"sqlstate[",
+	"ora-00933",
+	"ora-01756",
+	"microsoft ole db provider for",
+	"odbc sql server driver",
+}
+
 // SQLInjectionFuzzer implements SQL injection testing
 type SQLInjectionFuzzer struct {
 	targetURL string
 	payload   string
+	parameter string // Query parameter the payload is placed in
+	findings  *FindingStore
+	client    *http.Client // Client of the run, default settings when nil
 }
 
 // NewSQLInjectionFuzzer creates a new SQL injection fuzzer
@@ -32,37 +54,80 @@ func NewSQLInjectionFuzzer(targetURL string, payload string) (*SQLInjectionFuzze
 	return &SQLInjectionFuzzer{
 		targetURL: parsedURL.String(),
 		payload:   payload,
+		parameter: "id",
 	}, nil
 }
 
+// SetParameter sets the query parameter the payload is injected into. Other
+// parameters already on the target URL are kept.
+func (f *SQLInjectionFuzzer) SetParameter(name string) {
+	if name != "" {
+		f.parameter = name
+	}
+}
+
+// SetFindings sets the store that confirmed issues are reported into
+func (f *SQLInjectionFuzzer) SetFindings(store *FindingStore) {
+	f.findings = store
+}
+
 // Run starts the SQL injection testing process
 func (f *SQLInjectionFuzzer) Run() error {
-	// Create test URL with SQL injection payload
-	testURL := f.targetURL + "?id=" + url.QueryEscape(f.payload)
-
-	// Parse and validate the test URL
-	parsedURL, err := url.Parse(testURL)
+	// Create test URL with the payload in the injected parameter
+	parsedURL, err := url.Parse(f.targetURL)
 	if err != nil {
 		return fmt.Errorf("invalid test URL: %v", err)
 	}
-
-	// Ensure URL has a scheme
-	if parsedURL.Scheme == "" {
-		parsedURL.Scheme = "https"
-		testURL = parsedURL.String()
-	}
+	query := parsedURL.Query()
+	query.Set(f.parameter, f.payload)
+	parsedURL.RawQuery = query.Encode()
+	testURL := parsedURL.String()
 
 	// Send request
-	resp, err := http.Get(testURL)
+	client := f.client
+	if client == nil {
+		if client, err = newHTTPClient(nil, true); err != nil {
+			return err
+		}
+	}
+	resp, err := client.Get(testURL)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	// Check for SQL errors in response
-	if resp.StatusCode == http.StatusInternalServerError {
-		return fmt.Errorf("possible SQL injection vulnerability found: server error")
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxCapturedBody))
+	finding := &Finding{
+		Type:      "sql-injection",
+		URL:       testURL,
+		Parameter: f.parameter,
+		Payload:   f.payload,
+	}
+	if signature := sqlErrorSignature(body); signature != "" {
+		finding.Severity = SeverityHigh
+		finding.Confidence = ConfidenceFirm
+		finding.Evidence = fmt.Sprintf("database error in response: %q", signature)
+	} else if resp.StatusCode == http.StatusInternalServerError {
+		finding.Severity = SeverityMedium
+		finding.Confidence = ConfidenceTentative
+		finding.Evidence = "HTTP 500 response to SQL injection payload"
+	} else {
+		return nil
 	}
+	captureExchange(finding, resp.Request, nil, resp, body)
+	f.findings.Add(finding)
+	return fmt.Errorf("possible SQL injection vulnerability found: %s", finding.Evidence)
+}
 
-	return nil
+// sqlErrorSignature returns the database error signature found in a
+// response body, or "" when there is none
+func sqlErrorSignature(body []byte) string {
+	lower := strings.ToLower(string(body))
+	for _, signature := range sqlErrorSignatures {
+		if strings.Contains(lower, signature) {
+			return signature
+		}
+	}
+	return ""
 }
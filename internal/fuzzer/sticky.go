@@ -0,0 +1,186 @@
+package fuzzer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// stickyPattern matches the names of parameters holding per-request tokens
+// that a server rejects once stale or tampered with: anti-CSRF tokens,
+// ASP.NET view state and event validation, and nonces
+var stickyPattern = regexp.MustCompile(`(?i)^(_token|__viewstate\w*|__eventvalidation)$|csrf|xsrf|nonce|authenticity_token|requestverificationtoken`)
+
+// stickyParams are the parameters of a submission that must carry a value
+// freshly issued by the server. Before every submission the page issuing
+// them is fetched again with the worker's client, so the tokens belong to
+// its session, and their values replace whatever the fuzzer generated.
+type stickyParams struct {
+	pageURL string          // Page the fresh values are read from
+	names   map[string]bool // Parameter names to refresh
+}
+
+// newStickyParams returns the sticky parameters read from pageURL, or nil
+// when there are none
+func newStickyParams(pageURL string, names map[string]bool) *stickyParams {
+	if len(names) == 0 {
+		return nil
+	}
+	return &stickyParams{pageURL: pageURL, names: names}
+}
+
+// detectStickyParams finds the parameters of the form on page that must be
+// refreshed per submission: the declared ones, hidden fields named like
+// tokens, and hidden fields whose value changes when the page is fetched
+// again with fetch
+func detectStickyParams(declared []string, page string, fetch func() (string, error)) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range declared {
+		names[name] = true
+	}
+
+	values, hidden := inputValues(page)
+	var unknown []string
+	for name := range hidden {
+		if stickyPattern.MatchString(name) {
+			names[name] = true
+		} else if !names[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return names
+	}
+
+	again, err := fetch()
+	if err != nil {
+		return names
+	}
+	fresh, _ := inputValues(again)
+	for _, name := range unknown {
+		if fresh[name] != values[name] {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// templateStickyParams returns the declared parameters together with the
+// query and form body parameters of t named like tokens
+func templateStickyParams(declared []string, t *RequestTemplate) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range declared {
+		names[name] = true
+	}
+	_, query, _ := strings.Cut(t.Target, "?")
+	for _, part := range append(strings.Split(query, "&"), strings.Split(t.Body, "&")...) {
+		name, _, ok := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(name); ok && err == nil && stickyPattern.MatchString(name) {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// withParams returns a copy of t whose query and form body parameters named
+// in values carry those values
+func (t *RequestTemplate) withParams(values map[string]string) *RequestTemplate {
+	if len(values) == 0 {
+		return t
+	}
+	clone := *t
+	if path, query, ok := strings.Cut(t.Target, "?"); ok {
+		clone.Target = path + "?" + applyParams(query, values)
+	}
+	clone.Body = applyParams(t.Body, values)
+	return &clone
+}
+
+// refresh fetches the page with client, reading at most config's body
+// limit, and returns the current values of the sticky parameters found on it
+func (s *stickyParams) refresh(client *http.Client, config *Config) (map[string]string, error) {
+	resp, err := client.Get(s.pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", s.pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", s.pageURL, err)
+	}
+
+	values, _ := inputValues(string(body.data))
+	fresh := make(map[string]string)
+	for name := range s.names {
+		if value, ok := values[name]; ok {
+			fresh[name] = value
+		}
+	}
+	if len(fresh) == 0 {
+		return nil, fmt.Errorf("no sticky parameters on %s (HTTP %d)", s.pageURL, resp.StatusCode)
+	}
+	return fresh, nil
+}
+
+// inputValues returns the value of every named input field on an HTML page,
+// the first one of each name, and which of them are hidden
+func inputValues(page string) (map[string]string, map[string]bool) {
+	values := make(map[string]string)
+	hidden := make(map[string]bool)
+
+	tokenizer := html.NewTokenizer(strings.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return values, hidden
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "input" {
+				continue
+			}
+			var name, value, typ string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "name":
+					name = attr.Val
+				case "value":
+					value = attr.Val
+				case "type":
+					typ = strings.ToLower(attr.Val)
+				}
+			}
+			if _, seen := values[name]; name == "" || seen {
+				continue
+			}
+			values[name] = value
+			if typ == "hidden" {
+				hidden[name] = true
+			}
+		}
+	}
+}
+
+// applyParams replaces the values of the given parameters in URL-encoded
+// data, leaving the order and encoding of the others untouched
+func applyParams(data string, values map[string]string) string {
+	if data == "" || len(values) == 0 {
+		return data
+	}
+	parts := strings.Split(data, "&")
+	for i, part := range parts {
+		rawName, _, _ := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			continue
+		}
+		if value, ok := values[name]; ok {
+			parts[i] = rawName + "=" + url.QueryEscape(value)
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,283 @@
+package fuzzer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// stressProbeTimeout bounds each stress request, so a server that hangs
+	// on one is given up on rather than waited for
+	stressProbeTimeout = 30 * time.Second
+
+	// stressMaxBytes caps the bytes a stress probe sends, or makes the server
+	// inflate for a compressed body
+	stressMaxBytes = 8 << 20
+
+	// stressSlowdown is how many times the baseline latency a probe must
+	// take to count as degrading the server, on top of stressMinDelay
+	stressSlowdown = 10
+
+	// stressMinDelay is how much slower than the baseline a probe must be,
+	// so fast endpoints are not flagged for ordinary jitter
+	stressMinDelay = 2 * time.Second
+
+	// stressPause separates stress probes, giving the server time to recover
+	stressPause = time.Second
+)
+
+// stressProbe is one resource exhaustion payload in escalating sizes. body
+// returns the request body, its Content-Type and Content-Encoding for a size.
+type stressProbe struct {
+	name  string
+	sizes []int
+	body  func(base map[string]interface{}, field string, size int) ([]byte, string, string, error)
+}
+
+// stressProbes are sent smallest size first, and a series stops at the first
+// size that degrades the server
+var stressProbes = []stressProbe{
+	{"nested JSON", []int{100, 1000, 10000}, nestedJSONBody},
+	{"large field", []int{256 << 10, 1 << 20, 4 << 20}, largeFieldBody},
+	{"compressed body", []int{1 << 20, stressMaxBytes}, compressedBody},
+	{"multipart parts", []int{1000, 10000}, multipartPartsBody},
+}
+
+// nestedJSONBody replaces field with arrays nested size levels deep, which
+// recursive parsers walk one stack frame per level
+func nestedJSONBody(base map[string]interface{}, field string, size int) ([]byte, string, string, error) {
+	doc := copyMap(base)
+	doc[field] = json.RawMessage(strings.Repeat("[", size) + strings.Repeat("]", size))
+	body, err := json.Marshal(doc)
+	return body, "application/json", "", err
+}
+
+// largeFieldBody replaces field with a string of size bytes
+func largeFieldBody(base map[string]interface{}, field string, size int) ([]byte, string, string, error) {
+	doc := copyMap(base)
+	doc[field] = strings.Repeat("A", size)
+	body, err := json.Marshal(doc)
+	return body, "application/json", "", err
+}
+
+// compressedBody sends a large field gzip-compressed: a few kilobytes on the
+// wire that a server decompressing request bodies inflates to size bytes
+func compressedBody(base map[string]interface{}, field string, size int) ([]byte, string, string, error) {
+	plain, _, _, err := largeFieldBody(base, field, size)
+	if err != nil {
+		return nil, "", "", err
+	}
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if _, err := writer.Write(plain); err != nil {
+		return nil, "", "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", "", err
+	}
+	return buf.Bytes(), "application/json", "gzip", nil
+}
+
+// multipartPartsBody sends the base fields as multipart form data followed
+// by size small parts, which parsers allocate for one by one
+func multipartPartsBody(base map[string]interface{}, field string, size int) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, name := range sortedKeys(base) {
+		if err := writer.WriteField(name, fmt.Sprint(base[name])); err != nil {
+			return nil, "", "", err
+		}
+	}
+	for i := 0; i < size; i++ {
+		if err := writer.WriteField(fmt.Sprintf("%s%d", field, i), "x"); err != nil {
+			return nil, "", "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), "", nil
+}
+
+// testResourceExhaustion sends deeply nested JSON, multi-megabyte fields,
+// highly compressed bodies and forms with thousands of parts, each in
+// escalating sizes, and times them against the accepted base body. A probe
+// much slower than the baseline, or answered with a server error, is
+// reported; one after which the base body itself is slow or fails shows the
+// degradation outlasts the request and is reported as high. It only runs
+// with AllowDoS set, as the probes may take down a fragile server, and stops
+// a series at its first degrading size.
+func (f *APIFuzzer) testResourceExhaustion(base map[string]interface{}) {
+	if !f.config.AllowDoS {
+		f.logger.Warn("resource exhaustion probes need AllowDoS, skipping")
+		return
+	}
+	switch f.endpoint.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+	field := stressField(base)
+	if field == "" {
+		return
+	}
+
+	baseBody, err := json.Marshal(base)
+	if err != nil {
+		return
+	}
+	client, err := newTimingClient(f.config, f.client, stressProbeTimeout)
+	if err != nil {
+		f.logger.Debug("stress client failed", "error", err)
+		return
+	}
+	baseline, ok := f.stressBaseline(client, baseBody)
+	if !ok {
+		return
+	}
+	limit := stressSlowdown * baseline
+	if limit < baseline+stressMinDelay {
+		limit = baseline + stressMinDelay
+	}
+
+	for _, probe := range stressProbes {
+		for _, size := range probe.sizes {
+			if !f.config.Deadline.IsZero() && time.Now().After(f.config.Deadline) {
+				return
+			}
+			body, contentType, encoding, err := probe.body(base, field, size)
+			if err != nil {
+				f.logger.Debug("stress body failed", "probe", probe.name, "error", err)
+				break
+			}
+			time.Sleep(stressPause)
+			result, elapsed, err := f.stressExchange(client, body, contentType, encoding)
+			// A timeout or a dropped connection is the server giving way
+			if err != nil && !transientError(err) {
+				f.logger.Debug("stress probe failed", "probe", probe.name, "size", size, "error", err)
+				break
+			}
+			serverError := result != nil && result.resp.StatusCode >= http.StatusInternalServerError
+			if err == nil && !serverError && elapsed < limit {
+				continue
+			}
+
+			// The base body right after shows whether the server recovered
+			_, after, afterErr := f.stressExchange(client, baseBody, "application/json", "")
+			lasting := afterErr != nil || after >= limit
+			f.reportResourceExhaustion(probe.name, size, field, body, result, err, elapsed, baseline, lasting)
+			break
+		}
+	}
+}
+
+// stressField picks the body field the payloads go in: the first string
+// field, or else the first field of any type
+func stressField(base map[string]interface{}) string {
+	names := sortedKeys(base)
+	for _, name := range names {
+		if _, ok := base[name].(string); ok {
+			return name
+		}
+	}
+	if len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// stressBaseline sends the accepted base body three times and returns the
+// median latency, or false when the endpoint does not accept it
+func (f *APIFuzzer) stressBaseline(client *http.Client, body []byte) (time.Duration, bool) {
+	var latencies []time.Duration
+	for i := 0; i < 3; i++ {
+		result, elapsed, err := f.stressExchange(client, body, "application/json", "")
+		if err != nil || result.resp.StatusCode < 200 || result.resp.StatusCode >= 300 {
+			f.logger.Debug("stress baseline rejected", "error", err)
+			return 0, false
+		}
+		latencies = append(latencies, elapsed)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[1], true
+}
+
+// stressExchange sends one stress body to the endpoint with a client timing
+// out after stressProbeTimeout and returns the response with how long it took
+// from asking for a connection. The time is returned on error too, telling a
+// timeout from a refused request.
+func (f *APIFuzzer) stressExchange(client *http.Client, body []byte, contentType, encoding string) (*probeResponse, time.Duration, error) {
+	req, err := http.NewRequest(f.endpoint.Method, f.endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, value := range f.endpoint.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	req, elapsed := startClock(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, elapsed(), err
+	}
+	defer resp.Body.Close()
+	limited, err := readLimited(resp.Body, maxBodySize(f.config))
+	if err != nil {
+		return nil, elapsed(), err
+	}
+	return &probeResponse{req: req, reqBody: body, resp: resp, body: limited.data}, elapsed(), nil
+}
+
+// reportResourceExhaustion records a stress probe that degraded the server
+func (f *APIFuzzer) reportResourceExhaustion(name string, size int, field string, body []byte, result *probeResponse,
+	err error, elapsed, baseline time.Duration, lasting bool) {
+	severity := SeverityMedium
+	confidence := ConfidenceTentative
+	var outcome string
+	switch {
+	case err != nil:
+		outcome = fmt.Sprintf("no response after %s (%v)", elapsed.Round(time.Millisecond), err)
+	case result.resp.StatusCode >= http.StatusInternalServerError:
+		severity = SeverityLow
+		outcome = fmt.Sprintf("HTTP %d after %s", result.resp.StatusCode, elapsed.Round(time.Millisecond))
+	default:
+		outcome = fmt.Sprintf("answered after %s", elapsed.Round(time.Millisecond))
+	}
+	evidence := fmt.Sprintf("%s of size %d in %s: %s, against %s for the base body",
+		name, size, field, outcome, baseline.Round(time.Millisecond))
+	if lasting {
+		severity, confidence = SeverityHigh, ConfidenceFirm
+		evidence += "; the base body sent next was slow or failed, so the degradation outlasts the request"
+	}
+
+	finding := &Finding{
+		Type:       "resource-exhaustion",
+		Severity:   severity,
+		Confidence: confidence,
+		URL:        f.endpoint.URL,
+		Method:     f.endpoint.Method,
+		Parameter:  field,
+		Payload:    fmt.Sprintf("%s (%d bytes sent)", name, len(body)),
+		Evidence:   evidence,
+	}
+	if result != nil {
+		captureExchange(finding, result.req, nil, result.resp, result.body)
+	}
+	if f.config.Findings.Add(finding) {
+		f.logger.Warn("resource exhaustion", "probe", name, "size", size, "evidence", evidence)
+	}
+}
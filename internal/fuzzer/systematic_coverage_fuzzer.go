@@ -5,6 +5,8 @@ import (
 	"math/rand"
 	"strings"
 	"sync"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
 )
 
 // SystematicCoverageFuzzer implements systematic coverage-guided fuzzing
@@ -20,6 +22,7 @@ func NewSystematicCoverageFuzzer(config *Config) (*SystematicCoverageFuzzer, err
 	if err != nil {
 		return nil, err
 	}
+	baseFuzzer.logger = logging.For("systematic")
 
 	f := &SystematicCoverageFuzzer{
 		GrammarCoverageFuzzer: baseFuzzer,
@@ -62,7 +65,7 @@ func (f *SystematicCoverageFuzzer) computeExpansionCoverage(symbol string, depth
 
 		// Recursively compute coverage for nonterminals in expansion
 		if depth > 0 {
-			for _, part := range strings.Fields(expansion) {
+			for _, part := range splitExpansion(f.grammar, expansion) {
 				if isNonterminal(part) {
 					f.computeExpansionCoverage(part, depth-1, coverage)
 				}
@@ -103,43 +106,32 @@ func (f *SystematicCoverageFuzzer) chooseExpansion(symbol string, expansions []s
 
 	// If we have uncovered expansions, choose one
 	if len(uncovered) > 0 {
-		return uncovered[rand.Intn(len(uncovered))]
+		return uncovered[f.rng.Intn(len(uncovered))]
 	}
 
 	// Otherwise choose randomly from all expansions
-	return expansions[rand.Intn(len(expansions))]
+	return expansions[f.rng.Intn(len(expansions))]
 }
 
-// Run starts the fuzzing process with systematic coverage
+// Run starts the fuzzing process with systematic coverage, deriving a fresh
+// input for every request in the budget
 func (f *SystematicCoverageFuzzer) Run() error {
-	// Create derivation tree
-	tree := f.generateDerivationTree("<start>", 0)
-
-	// Track coverage
-	f.grammarCoverage.TrackDerivationTree(tree)
-
-	// Convert tree to string and test it
-	input := f.treeToString(tree)
-	result := f.testInput(input)
-
-	// Process result
-	if result.Error != nil {
-		if f.config.Verbose {
-			fmt.Printf("[ERROR] %s: %v\n", result.URL, result.Error)
-		}
-		return result.Error
-	}
+	return f.runPool(f.client, func(*rand.Rand) string { return f.nextInput() }, f.testInput)
+}
 
-	if f.config.Verbose {
-		fmt.Printf("[%d] %s\n", result.StatusCode, result.URL)
-	}
+// nextInput derives an input that covers expansions not yet seen
+func (f *SystematicCoverageFuzzer) nextInput() string {
+	f.genMu.Lock()
+	defer f.genMu.Unlock()
 
-	return nil
+	tree := f.generateDerivationTree("<start>", 0)
+	f.grammarCoverage.TrackDerivationTree(tree)
+	return f.treeToString(tree)
 }
 
 // generateDerivationTree creates a derivation tree for a symbol
 func (f *SystematicCoverageFuzzer) generateDerivationTree(symbol string, depth int) *DerivationTree {
-	if depth > f.config.MaxDepth {
+	if depth > 2*f.config.MaxDepth {
 		return &DerivationTree{
 			Symbol: symbol,
 			Value:  "max_depth_reached",
@@ -156,15 +148,21 @@ func (f *SystematicCoverageFuzzer) generateDerivationTree(symbol string, depth i
 		return tree
 	}
 
-	// Choose expansion based on coverage
-	expansion := f.chooseExpansion(symbol, expansions)
+	// Choose expansion based on coverage, heading for the shortest expansion
+	// once past the depth limit so recursive rules terminate
+	var expansion string
+	if depth >= f.config.MaxDepth {
+		expansion = shortestExpansion(expansions)
+	} else {
+		expansion = f.chooseExpansion(symbol, expansions)
+	}
 	tree.Expansion = expansion
 
 	// Track expansion
 	f.grammarCoverage.TrackExpansion(symbol, expansion)
 
 	// Generate children
-	parts := strings.Fields(expansion)
+	parts := splitExpansion(f.grammar, expansion)
 	for _, part := range parts {
 		if isNonterminal(part) {
 			child := f.generateDerivationTree(part, depth+1)
@@ -0,0 +1,134 @@
+package fuzzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// TargetSummary records how one target of a multi-target run went
+type TargetSummary struct {
+	URL         string           `json:"url"`
+	OutputDir   string           `json:"output_dir"`            // Where the target's results were written
+	Findings    int              `json:"findings"`              // Distinct findings on the target
+	BySeverity  map[Severity]int `json:"by_severity"`           // Findings per severity
+	Error       string           `json:"error,omitempty"`       // Why the target's run failed
+	Unreachable []string         `json:"unreachable,omitempty"` // Endpoints that could not be connected to after retries
+	Outages     []Outage         `json:"outages,omitempty"`     // When the target was unstable and fuzzing paused
+}
+
+// LoadTargets reads target URLs, one per line. Blank lines and lines
+// starting with # are skipped.
+func LoadTargets(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open targets file: %v", err)
+	}
+	defer file.Close()
+
+	var targets []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		u, err := url.Parse(text)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%s: line %d: not an http or https URL: %s", path, line, text)
+		}
+		if err := checkHost(u); err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", path, line, err)
+		}
+		targets = append(targets, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read targets file: %v", err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", path)
+	}
+	return targets, nil
+}
+
+// TargetConfig derives the configuration for the index-th target of a
+// multi-target run from the shared one. The target gets its own output
+// directory below the shared one, its own finding store, leak scanner, retry
+// policy, circuit breaker, rate limiter, traffic recorder and format
+// learner, so nothing found, spent or learned on one target counts for
+// another. The learner starts from what the shared one knows, such as
+// loaded samples.
+// Sessions and coverage are per target already, as each run builds its own
+// fuzzers.
+func TargetConfig(base *Config, index int, targetURL string) *Config {
+	config := *base
+	config.TargetURL = targetURL
+	config.OutputDir = filepath.Join(base.OutputDir, targetDirName(index, targetURL))
+	config.Findings = newHookedFindingStore(base.Hooks)
+	config.Leaks = base.Leaks.Clone()
+	config.Stack = nil
+	config.DryRun = nil
+	config.Retry = base.Retry.Clone()
+	config.Learner = base.Learner.Clone()
+	config.Breaker = base.Breaker.Clone(targetURL)
+	if base.RateLimit != nil {
+		config.RateLimit = NewRateLimiter(base.RateLimit.Rate())
+	}
+	if base.Traffic != nil {
+		config.Traffic = NewTraffic(base.Traffic.max)
+	}
+	return &config
+}
+
+// unsafePathChars matches what is replaced in output directory names
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// targetDirName names the output directory of a target after its position
+// and its host and path, e.g. 01-example.com_8080_api
+func targetDirName(index int, targetURL string) string {
+	name := targetURL
+	if u, err := url.Parse(targetURL); err == nil {
+		name = u.Host + u.Path
+	}
+	name = strings.Trim(unsafePathChars.ReplaceAllString(name, "_"), "_")
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	return fmt.Sprintf("%02d-%s", index+1, name)
+}
+
+// SummarizeTarget records the outcome of a target's run
+func SummarizeTarget(config *Config, runErr error) TargetSummary {
+	summary := TargetSummary{
+		URL:        config.TargetURL,
+		OutputDir:  config.OutputDir,
+		BySeverity: make(map[Severity]int),
+	}
+	for _, finding := range config.Findings.Findings() {
+		summary.Findings++
+		summary.BySeverity[finding.Severity]++
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	summary.Unreachable = config.Retry.DeadEndpoints()
+	summary.Outages = config.Breaker.Outages()
+	return summary
+}
+
+// SaveTargetSummaries writes the summaries of a multi-target run as JSON
+func SaveTargetSummaries(path string, summaries []TargetSummary) error {
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode target summaries: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write target summaries: %v", err)
+	}
+	return nil
+}
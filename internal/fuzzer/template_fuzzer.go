@@ -0,0 +1,367 @@
+package fuzzer
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// Supported values for Config.PayloadSource
+const (
+	PayloadSourceWordlist = "wordlist" // Payloads from the wordlist (or built-in list)
+	PayloadSourceGrammar  = "grammar"  // Payloads generated from the payload grammar
+)
+
+// Supported values for Config.AttackMode, named after their Burp Intruder
+// equivalents
+const (
+	AttackBatteringRam = "batteringram" // One payload set, same payload in every position
+	AttackPitchfork    = "pitchfork"    // One set per position, iterated in parallel
+	AttackClusterBomb  = "clusterbomb"  // One set per position, every combination
+)
+
+// timeBoxedGrammarPayloads is the number of grammar payloads drawn per
+// position when a time-boxed run sets no request limit
+const timeBoxedGrammarPayloads = 1000
+
+// TemplateFuzzer substitutes payloads into a raw request template, giving
+// the user exact control over where payloads are injected
+type TemplateFuzzer struct {
+	config      *Config
+	template    *RequestTemplate
+	base        *url.URL
+	client      *http.Client
+	positions   int
+	payloadSets []*mangledWordlist // Payload set per marker position
+	sticky      *stickyParams      // Tokens fetched fresh before every request; nil for none
+	grammar     Grammar
+	logger      *slog.Logger
+}
+
+// NewTemplateFuzzer creates a fuzzer for Config.RequestTemplate
+func NewTemplateFuzzer(config *Config) (*TemplateFuzzer, error) {
+	template, err := LoadRequestTemplate(config.RequestTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &TemplateFuzzer{
+		config:    config,
+		template:  template,
+		base:      base,
+		client:    client,
+		positions: template.Positions(),
+		grammar:   defaultPayloadGrammar,
+		logger:    logging.For("template"),
+	}
+
+	switch config.AttackMode {
+	case "", AttackBatteringRam:
+		f.positions = 1
+	case AttackPitchfork, AttackClusterBomb:
+	default:
+		return nil, fmt.Errorf("unsupported attack mode: %s", config.AttackMode)
+	}
+
+	source := config.StickySource
+	if source == "" {
+		source = config.TargetURL
+	}
+	if f.sticky = newStickyParams(source, templateStickyParams(config.StickyParams, template)); f.sticky != nil {
+		f.logger.Info("refreshing sticky parameters per request", "params", sortedKeys(f.sticky.names), "source", source)
+	}
+
+	if config.GrammarFile != "" {
+		if f.grammar, err = LoadGrammarFile(config.GrammarFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := f.loadPayloadSets(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// loadPayloadSets prepares one payload set per position. Wordlists given in
+// Config.PositionWordlists map to FUZZ, FUZZ2, ... in order; positions without
+// their own list, and battering ram attacks, share the main wordlist.
+func (f *TemplateFuzzer) loadPayloadSets() error {
+	switch f.config.PayloadSource {
+	case "", PayloadSourceWordlist:
+		// Mangling rules apply to the wordlists given, not the built-in list
+		shared, err := newMangledWordlist(f.config.Stack.SelectPayloads(defaultPayloads()), nil)
+		if err != nil {
+			return err
+		}
+		if f.config.WordlistPath != "" {
+			words, err := loadWordlist(f.config.WordlistPath)
+			if err != nil {
+				return fmt.Errorf("failed to load wordlist: %v", err)
+			}
+			if len(f.config.WordlistRules) == 0 {
+				words = f.config.Stack.SelectPayloads(words)
+			}
+			if shared, err = newMangledWordlist(words, f.config.WordlistRules); err != nil {
+				return err
+			}
+		}
+
+		for pos := 0; pos < f.positions; pos++ {
+			set := shared
+			if f.positions > 1 && pos < len(f.config.PositionWordlists) {
+				words, err := loadWordlist(f.config.PositionWordlists[pos])
+				if err != nil {
+					return fmt.Errorf("failed to load wordlist for position %d: %v", pos+1, err)
+				}
+				if set, err = newMangledWordlist(words, f.config.WordlistRules); err != nil {
+					return err
+				}
+			}
+			if set.Len() == 0 {
+				return fmt.Errorf("payload set for position %d is empty", pos+1)
+			}
+			f.payloadSets = append(f.payloadSets, set)
+		}
+
+	case PayloadSourceGrammar:
+		// Clusterbomb needs finite sets; size them so the product roughly
+		// matches the request budget
+		size := f.config.NumRequests
+		if size <= 0 {
+			size = timeBoxedGrammarPayloads
+		}
+		if f.config.AttackMode == AttackClusterBomb && f.positions > 1 {
+			size = int(math.Ceil(math.Pow(float64(size), 1/float64(f.positions))))
+		}
+		rng := newRand(runSeed(f.config), streamPayloads)
+		for pos := 0; pos < f.positions; pos++ {
+			set := make([]string, size)
+			for i := range set {
+				set[i] = expandGrammar(rng, f.grammar, "<start>", 0, f.config.MaxDepth)
+			}
+			f.payloadSets = append(f.payloadSets, &mangledWordlist{words: set})
+		}
+
+	default:
+		return fmt.Errorf("unsupported payload source: %s", f.config.PayloadSource)
+	}
+
+	return nil
+}
+
+// plannedRequests returns how many requests the attack would send without a
+// budget, saturating instead of overflowing
+func (f *TemplateFuzzer) plannedRequests() int {
+	switch f.config.AttackMode {
+	case AttackClusterBomb:
+		total := 1
+		for _, set := range f.payloadSets {
+			if total > math.MaxInt/set.Len() {
+				return math.MaxInt
+			}
+			total *= set.Len()
+		}
+		return total
+	default:
+		shortest := f.payloadSets[0].Len()
+		for _, set := range f.payloadSets[1:] {
+			shortest = min(shortest, set.Len())
+		}
+		return shortest
+	}
+}
+
+// Run sends one request per payload combination, bounded by NumRequests and
+// the deadline
+func (f *TemplateFuzzer) Run() error {
+	if planned := f.plannedRequests(); f.config.NumRequests > 0 && planned > f.config.NumRequests {
+		f.logger.Warn("attack truncated to request budget", "mode", f.config.AttackMode,
+			"planned", planned, "budget", f.config.NumRequests)
+	}
+
+	sessions, err := newSessions(f.config, f.client)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan []string)
+	results := make(chan *Result, f.config.Concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < f.config.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := sessions.client()
+			for payloads := range jobs {
+				results <- f.send(client, payloads)
+			}
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- f.processResults(results)
+	}()
+
+	budget := newRequestBudget(f.config.NumRequests, f.config.Deadline)
+	checkpoints := startCheckpoints(f.config, f.logger, budget, nil, nil)
+	f.producePayloads(jobs, budget)
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	err = <-done
+	checkpoints.Stop()
+	return err
+}
+
+// producePayloads feeds payload combinations to the workers until the
+// combinations or the budget run out
+func (f *TemplateFuzzer) producePayloads(jobs chan<- []string, budget *requestBudget) {
+	switch f.config.AttackMode {
+	case AttackClusterBomb:
+		// Odometer over all sets, last position changing fastest
+		indexes := make([]int, len(f.payloadSets))
+		for _, ok := budget.take(); ok; _, ok = budget.take() {
+			combo := make([]string, len(f.payloadSets))
+			for pos, set := range f.payloadSets {
+				combo[pos] = set.At(indexes[pos])
+			}
+			jobs <- combo
+
+			pos := len(indexes) - 1
+			for ; pos >= 0; pos-- {
+				indexes[pos]++
+				if indexes[pos] < f.payloadSets[pos].Len() {
+					break
+				}
+				indexes[pos] = 0
+			}
+			if pos < 0 {
+				return
+			}
+		}
+
+	default:
+		// Battering ram uses a single set; pitchfork walks all sets in step
+		count := f.plannedRequests()
+		for i, ok := budget.take(); ok && i < count; i, ok = budget.take() {
+			combo := make([]string, len(f.payloadSets))
+			for pos, set := range f.payloadSets {
+				combo[pos] = set.At(i)
+			}
+			if f.config.AttackMode != AttackPitchfork {
+				// Same payload in every position
+				combo = fill(combo[0], f.template.Positions())
+			}
+			jobs <- combo
+		}
+	}
+}
+
+// fill returns a slice of n copies of s
+func fill(s string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = s
+	}
+	return out
+}
+
+// send builds the request for a payload combination and records the outcome
+func (f *TemplateFuzzer) send(client *http.Client, payloads []string) *Result {
+	start := time.Now()
+	payload := strings.Join(payloads, " | ")
+
+	template := f.template
+	if f.sticky != nil {
+		fresh, err := f.sticky.refresh(client, f.config)
+		if err != nil {
+			f.logger.Debug("sticky parameters not refreshed", "error", err)
+		}
+		template = template.withParams(fresh)
+	}
+
+	req, reqBody, err := template.Build(f.base, payloads)
+	if err != nil {
+		return &Result{Payload: payload, Error: err, Timestamp: start}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		inspectFailure(f.config, req, reqBody, err, payload)
+		return &Result{
+			Payload:   payload,
+			URL:       req.URL.String(),
+			Error:     err,
+			Duration:  time.Since(start),
+			Timestamp: start,
+		}
+	}
+	defer resp.Body.Close()
+
+	body, _ := readLimited(resp.Body, maxBodySize(f.config))
+	duration := time.Since(start)
+
+	inspectResponse(f.config, req, reqBody, resp, body.data, payload)
+
+	f.logger.Debug("template request sent", "status", resp.StatusCode, "url", req.URL.String(), "payload", payload)
+
+	result := &Result{
+		Payload:    payload,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Response:   string(body.data),
+		Duration:   duration,
+		Timestamp:  start,
+	}
+	result.measureBody(body)
+	return result
+}
+
+// processResults writes every result that passes the match/filter rules to
+// the results file
+func (f *TemplateFuzzer) processResults(results <-chan *Result) error {
+	resultsFile, err := os.Create(filepath.Join(f.config.OutputDir, "results.txt"))
+	if err != nil {
+		for range results {
+		}
+		return fmt.Errorf("failed to create results file: %v", err)
+	}
+	defer resultsFile.Close()
+
+	for result := range results {
+		if result.Error != nil {
+			fmt.Fprintf(resultsFile, "[ERROR] %s: %v\n", result.URL, result.Error)
+			continue
+		}
+		if !f.config.ResultFilter.Keep(result) {
+			continue
+		}
+		fmt.Fprintf(resultsFile, "[%d] %s payload=%q size=%d words=%d (%.2fs)\n",
+			result.StatusCode, result.URL, result.Payload, result.Size, result.Words, result.Duration.Seconds())
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package fuzzer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// tlsKey holds the settings that distinguish one client TLS configuration
+// from another
+type tlsKey struct {
+	clientCert string
+	clientKey  string
+	caCert     string
+	minVersion uint16
+	insecure   bool
+}
+
+// tlsConfigs caches one client TLS configuration per distinct key so the
+// certificate files are read once per run
+var tlsConfigs = struct {
+	sync.Mutex
+	m map[tlsKey]*tls.Config
+}{m: make(map[tlsKey]*tls.Config)}
+
+// newTLSKey returns the TLS settings of config
+func newTLSKey(config *Config) tlsKey {
+	return tlsKey{
+		clientCert: config.ClientCert,
+		clientKey:  config.ClientKey,
+		caCert:     config.CACert,
+		minVersion: config.TLSMinVersion,
+		insecure:   config.InsecureSkipVerify,
+	}
+}
+
+// TLSConfig returns the client TLS configuration for the configured client
+// certificate, CA bundle, minimum version and verification mode. It returns
+// nil when all of them are left at their defaults. Every transport, the raw
+// connections of smuggling probes and HTTP/1.0 included, uses it.
+func TLSConfig(config *Config) (*tls.Config, error) {
+	if config == nil {
+		return nil, nil
+	}
+	key := newTLSKey(config)
+	if key == (tlsKey{}) {
+		return nil, nil
+	}
+
+	tlsConfigs.Lock()
+	defer tlsConfigs.Unlock()
+
+	if cfg, ok := tlsConfigs.m[key]; ok {
+		return cfg, nil
+	}
+	cfg, err := newTLSConfig(key)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfigs.m[key] = cfg
+	return cfg, nil
+}
+
+// newTLSConfig loads the certificates named by key
+func newTLSConfig(key tlsKey) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         key.minVersion,
+		InsecureSkipVerify: key.insecure,
+	}
+
+	if key.clientCert != "" || key.clientKey != "" {
+		if key.clientCert == "" || key.clientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(key.clientCert, key.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if key.caCert != "" {
+		data, err := os.ReadFile(key.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		// Trust the bundle on top of the system roots, so public hosts a
+		// crawl reaches still verify
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", key.caCert)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// tlsVersions maps the version names accepted by ParseTLSVersion
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion parses a TLS version such as "1.2" for
+// Config.TLSMinVersion. An empty string yields 0, Go's default minimum.
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q: expected 1.0, 1.1, 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// TargetServerNames returns the Config.ServerNames sending serverName to
+// the hosts of targets in TLS handshakes. Without a serverName, an
+// IP-literal target reached under a virtual host, as with a Host header
+// override, is sent the virtual host's name, which is what its certificate
+// is issued for. Empty targets are skipped. It returns nil when every
+// target keeps its own name.
+func TargetServerNames(targets []string, serverName, vhost string) (map[string]string, error) {
+	if serverName == "" && vhost == "" {
+		return nil, nil
+	}
+	var names map[string]string
+	hosts := 0
+	for _, target := range targets {
+		if target == "" {
+			continue
+		}
+		u, err := url.Parse(target)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		hosts++
+		host := strings.ToLower(u.Hostname())
+		name := serverName
+		if name == "" {
+			if net.ParseIP(host) == nil {
+				continue
+			}
+			name = vhost
+			if h, _, err := net.SplitHostPort(vhost); err == nil {
+				name = h
+			}
+		}
+		name = strings.Trim(name, "[]")
+		if name == "" || strings.ContainsAny(name, "/:@ ") {
+			return nil, fmt.Errorf("invalid TLS server name %q", name)
+		}
+		if names == nil {
+			names = make(map[string]string)
+		}
+		names[host] = name
+	}
+	if hosts == 0 && serverName != "" {
+		return nil, fmt.Errorf("a TLS server name needs a target URL with a host")
+	}
+	return names, nil
+}
+
+// serverName returns the TLS server name sent to host: its override in
+// serverNames, else the host itself
+func serverName(host string, serverNames map[string]string) string {
+	if name, ok := serverNames[strings.ToLower(strings.Trim(host, "[]"))]; ok {
+		return name
+	}
+	return host
+}
+
+// serverNameProxy wraps the proxy function of a transport so a request to
+// a host sent another TLS server name fails rather than reaching a proxy:
+// through a CONNECT tunnel the transport does the handshake itself, with
+// the host's own name, and the override would be silently dropped
+func serverNameProxy(proxy func(*http.Request) (*url.URL, error), serverNames map[string]string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if proxy == nil {
+			return nil, nil
+		}
+		proxyURL, err := proxy(req)
+		if err != nil || proxyURL == nil || req.URL.Scheme != "https" {
+			return proxyURL, err
+		}
+		if host := req.URL.Hostname(); serverName(host, serverNames) != host {
+			return nil, fmt.Errorf("TLS server name override for %s cannot be sent through proxy %s", host, proxyURL.Redacted())
+		}
+		return proxyURL, nil
+	}
+}
+
+// dialTLS returns a dialer completing the connections of dial with a TLS
+// handshake using the settings of tlsConfig, if any, sending each host the
+// server name serverNames gives it and offering protocols in ALPN
+func dialTLS(dial func(ctx context.Context, network, addr string) (net.Conn, error), tlsConfig *tls.Config,
+	serverNames map[string]string, protocols []string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		cfg.ServerName = serverName(host, serverNames)
+		cfg.NextProtos = protocols
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
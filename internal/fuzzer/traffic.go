@@ -0,0 +1,184 @@
+package fuzzer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+const (
+	// defaultMaxExchanges bounds the recorded traffic when no limit is configured
+	defaultMaxExchanges = 5000
+
+	// maxExchangeBody limits how much of each body is recorded for export
+	maxExchangeBody = 1 << 20
+)
+
+// exchange is one recorded request and its response
+type exchange struct {
+	time           time.Time
+	duration       time.Duration
+	method         string
+	url            *url.URL
+	proto          string
+	requestHeader  http.Header
+	requestBody    []byte
+	status         int
+	statusText     string
+	responseHeader http.Header
+	responseBody   []byte
+	comment        string // Findings reported on the exchange
+}
+
+// Traffic records the in-scope exchanges of a run, so they can be exported
+// to an intercepting proxy such as Burp or ZAP and explored by hand. Requests
+// to hosts other than the target's are out of scope. Fuzzing sends many
+// requests that all look alike, so an exchange is only kept when it shows
+// something new: an endpoint and status not recorded yet, or a response body
+// unlike any recorded. Dry runs record nothing, as nothing is sent. Traffic is
+// shared by every client built from the same Config and is safe for
+// concurrent use.
+type Traffic struct {
+	mu        sync.Mutex
+	max       int
+	seen      map[string]bool // Method, endpoint and status of kept exchanges
+	responses *responseIndex
+	exchanges []*exchange
+	full      bool
+}
+
+// NewTraffic creates a recorder keeping at most max exchanges (0 = default)
+func NewTraffic(max int) *Traffic {
+	if max <= 0 {
+		max = defaultMaxExchanges
+	}
+	return &Traffic{
+		max:       max,
+		seen:      make(map[string]bool),
+		responses: newResponseIndex(max),
+	}
+}
+
+// Count returns the number of exchanges recorded so far
+func (t *Traffic) Count() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.exchanges)
+}
+
+// record keeps the exchange if it shows something new
+func (t *Traffic) record(ex *exchange) {
+	endpoint := *ex.url
+	endpoint.RawQuery = ""
+	endpoint.Fragment = ""
+	key := fmt.Sprintf("%s %s %d", ex.method, endpoint.String(), ex.status)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.exchanges) >= t.max {
+		if !t.full {
+			t.full = true
+			logging.For("traffic").Warn("traffic recording limit reached, later exchanges are not exported", "max", t.max)
+		}
+		return
+	}
+	newEndpoint := !t.seen[key]
+	newResponse := t.responses.add(simhash(ex.responseBody))
+	if !newEndpoint && !newResponse {
+		return
+	}
+	t.seen[key] = true
+	t.exchanges = append(t.exchanges, ex)
+}
+
+// snapshot returns the recorded exchanges
+func (t *Traffic) snapshot() []*exchange {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*exchange(nil), t.exchanges...)
+}
+
+// recordRaw records an exchange written on a raw connection rather than
+// sent through a client, with the response body read so far
+func (t *Traffic) recordRaw(start time.Time, method string, u *url.URL, header http.Header, reqBody []byte,
+	resp *http.Response, respBody []byte) {
+	if t == nil {
+		return
+	}
+	t.record(&exchange{
+		time:           start,
+		duration:       time.Since(start),
+		method:         method,
+		url:            u,
+		proto:          resp.Proto,
+		requestHeader:  header,
+		requestBody:    reqBody,
+		status:         resp.StatusCode,
+		statusText:     strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		responseHeader: resp.Header.Clone(),
+		responseBody:   respBody,
+	})
+}
+
+// trafficTransport records the exchanges with one target's host
+type trafficTransport struct {
+	base    http.RoundTripper
+	traffic *Traffic
+	host    string // In-scope host; empty for any
+}
+
+// RoundTrip implements http.RoundTripper. The response body is read up to
+// maxExchangeBody bytes for the record and handed on unchanged.
+func (t *trafficTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || (t.host != "" && !strings.EqualFold(req.URL.Host, t.host)) {
+		return resp, err
+	}
+
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(io.LimitReader(body, maxExchangeBody))
+			body.Close()
+		}
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxExchangeBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(respBody), resp.Body), resp.Body}
+
+	requestHeader := req.Header.Clone()
+	if req.Host != "" && req.Host != req.URL.Host {
+		requestHeader.Set("Host", req.Host)
+	}
+	t.traffic.record(&exchange{
+		time:           start,
+		duration:       time.Since(start),
+		method:         req.Method,
+		url:            req.URL,
+		proto:          resp.Proto,
+		requestHeader:  requestHeader,
+		requestBody:    reqBody,
+		status:         resp.StatusCode,
+		statusText:     strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		responseHeader: resp.Header.Clone(),
+		responseBody:   respBody,
+	})
+	return resp, nil
+}
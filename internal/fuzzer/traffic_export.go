@@ -0,0 +1,456 @@
+package fuzzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Export formats for Traffic.Export
+const (
+	ExportBurp = "burp" // Burp Suite saved items XML
+	ExportHAR  = "har"  // HTTP Archive 1.2, which ZAP and browsers import
+)
+
+// ExportFile returns the file name an export format is written to
+func ExportFile(format string) string {
+	if format == ExportHAR {
+		return "traffic.har"
+	}
+	return "traffic.xml"
+}
+
+// Export writes the recorded traffic to filename in format. Every finding is
+// noted as a comment on the exchange it was reported for; findings whose
+// exchange was not recorded, e.g. because it looked like an earlier one,
+// are added from their own captured request and response.
+func (t *Traffic) Export(filename, format string, findings []*Finding) error {
+	if format != ExportBurp && format != ExportHAR {
+		return fmt.Errorf("unknown export format %q (want %s or %s)", format, ExportBurp, ExportHAR)
+	}
+	exchanges := annotateExchanges(t.snapshot(), findings)
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %v", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if format == ExportHAR {
+		err = writeHAR(w, exchanges)
+	} else {
+		err = writeBurp(w, exchanges)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s export: %v", format, err)
+	}
+	return w.Flush()
+}
+
+// annotateExchanges returns copies of exchanges commented with the findings
+// reported on them, followed by the captured exchanges of the other findings
+func annotateExchanges(exchanges []*exchange, findings []*Finding) []*exchange {
+	annotated := make([]*exchange, len(exchanges))
+	index := make(map[string]*exchange)
+	for i, ex := range exchanges {
+		clone := *ex
+		annotated[i] = &clone
+		if key := ex.method + " " + ex.url.String(); index[key] == nil {
+			index[key] = &clone
+		}
+	}
+
+	for _, f := range findings {
+		note := fmt.Sprintf("%s (%s): %s", f.Type, f.Severity, f.Evidence)
+		if f.Parameter != "" {
+			note = fmt.Sprintf("%s (%s) in %s: %s", f.Type, f.Severity, f.Parameter, f.Evidence)
+		}
+		ex := index[f.Method+" "+f.URL]
+		if ex == nil {
+			if ex = capturedExchange(f); ex == nil {
+				continue
+			}
+			index[f.Method+" "+f.URL] = ex
+			annotated = append(annotated, ex)
+		}
+		if ex.comment != "" {
+			ex.comment += "; "
+		}
+		ex.comment += note
+	}
+	return annotated
+}
+
+// capturedExchange rebuilds the exchange captured on a finding, or returns
+// nil when no request was captured
+func capturedExchange(f *Finding) *exchange {
+	if f.Request == "" {
+		return nil
+	}
+	tmpl, err := parseRawRequest(f.Request)
+	if err != nil {
+		return nil
+	}
+	u, err := url.Parse(f.URL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	ex := &exchange{
+		time:          f.Timestamp,
+		method:        tmpl.Method,
+		url:           u,
+		proto:         "HTTP/1.1",
+		requestHeader: make(http.Header),
+		requestBody:   []byte(tmpl.Body),
+	}
+	for _, h := range tmpl.Headers {
+		ex.requestHeader.Add(h[0], h[1])
+	}
+
+	// Captured bodies may be truncated, so the response is read leniently
+	head, body, _ := strings.Cut(f.Response, "\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(head+"\r\n\r\n")), nil)
+	if err == nil {
+		ex.proto = resp.Proto
+		ex.status = resp.StatusCode
+		ex.statusText = strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode)))
+		ex.responseHeader = resp.Header
+		ex.responseBody = []byte(body)
+	}
+	return ex
+}
+
+// rawRequest renders the request of an exchange as sent on the wire
+func (ex *exchange) rawRequest() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", ex.method, ex.url.RequestURI())
+	if ex.requestHeader.Get("Host") == "" {
+		fmt.Fprintf(&b, "Host: %s\r\n", ex.url.Host)
+	}
+	writeHeaders(&b, ex.requestHeader)
+	b.WriteString("\r\n")
+	b.Write(ex.requestBody)
+	return b.Bytes()
+}
+
+// rawResponse renders the response of an exchange as received
+func (ex *exchange) rawResponse() []byte {
+	if ex.status == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %d %s\r\n", ex.proto, ex.status, ex.statusText)
+	writeHeaders(&b, ex.responseHeader)
+	b.WriteString("\r\n")
+	b.Write(ex.responseBody)
+	return b.Bytes()
+}
+
+// writeHeaders writes headers sorted by name, Host first
+func writeHeaders(w io.Writer, header http.Header) {
+	for _, value := range header.Values("Host") {
+		fmt.Fprintf(w, "Host: %s\r\n", value)
+	}
+	for _, name := range sortedKeys(header) {
+		if name == "Host" {
+			continue
+		}
+		for _, value := range header[name] {
+			fmt.Fprintf(w, "%s: %s\r\n", name, value)
+		}
+	}
+}
+
+// burpItems is the document Burp writes when saving selected items
+type burpItems struct {
+	XMLName     xml.Name   `xml:"items"`
+	BurpVersion string     `xml:"burpVersion,attr"` // Version of the tool that wrote the file
+	ExportTime  string     `xml:"exportTime,attr"`  // When the file was written
+	Items       []burpItem `xml:"item"`             // The exchanges, in the order they were sent
+}
+
+// burpItem is one request and response in Burp's saved items format
+type burpItem struct {
+	Time           string    `xml:"time"`           // When the request was sent
+	URL            burpCDATA `xml:"url"`            // Full URL of the request
+	Host           burpHost  `xml:"host"`           // Host the request went to
+	Port           string    `xml:"port"`           // Port, explicit or the scheme's default
+	Protocol       string    `xml:"protocol"`       // http or https
+	Method         burpCDATA `xml:"method"`         // HTTP method
+	Path           burpCDATA `xml:"path"`           // Path and query of the request
+	Extension      string    `xml:"extension"`      // File extension of the path, "null" for none
+	Request        burpData  `xml:"request"`        // Raw request, base64-encoded
+	Status         int       `xml:"status"`         // Response status code
+	ResponseLength int       `xml:"responselength"` // Length of the raw response
+	MIMEType       string    `xml:"mimetype"`       // Burp's name for the response content type
+	Response       burpData  `xml:"response"`       // Raw response, base64-encoded
+	Comment        string    `xml:"comment"`        // Findings reported on the exchange
+}
+
+// burpCDATA is text Burp writes as a CDATA section
+type burpCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+// burpHost is the host of a Burp item, with its address
+type burpHost struct {
+	IP   string `xml:"ip,attr"`   // Address of the host, left empty
+	Name string `xml:",chardata"` // Host name
+}
+
+// burpData is a raw request or response of a Burp item
+type burpData struct {
+	Base64 bool   `xml:"base64,attr"` // Whether Value is base64-encoded
+	Value  string `xml:",cdata"`
+}
+
+// writeBurp writes exchanges in Burp's saved items format, which Burp and
+// most of its import extensions read
+func writeBurp(w io.Writer, exchanges []*exchange) error {
+	doc := burpItems{BurpVersion: Version, ExportTime: time.Now().Format(time.UnixDate)}
+	for _, ex := range exchanges {
+		port := ex.url.Port()
+		if port == "" {
+			port = "80"
+			if ex.url.Scheme == "https" {
+				port = "443"
+			}
+		}
+		extension := strings.TrimPrefix(path.Ext(ex.url.Path), ".")
+		if extension == "" {
+			extension = "null"
+		}
+		response := ex.rawResponse()
+		doc.Items = append(doc.Items, burpItem{
+			Time:           ex.time.Format(time.UnixDate),
+			URL:            burpCDATA{ex.url.String()},
+			Host:           burpHost{Name: ex.url.Hostname()},
+			Port:           port,
+			Protocol:       ex.url.Scheme,
+			Method:         burpCDATA{ex.method},
+			Path:           burpCDATA{ex.url.RequestURI()},
+			Extension:      extension,
+			Request:        burpData{true, base64.StdEncoding.EncodeToString(ex.rawRequest())},
+			Status:         ex.status,
+			ResponseLength: len(response),
+			MIMEType:       burpMIMEType(ex.responseHeader.Get("Content-Type")),
+			Response:       burpData{true, base64.StdEncoding.EncodeToString(response)},
+			Comment:        ex.comment,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// burpMIMEType names a content type the way Burp's MIME type column does
+func burpMIMEType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "":
+		return ""
+	case mediaType == "text/html":
+		return "HTML"
+	case strings.HasSuffix(mediaType, "json"):
+		return "JSON"
+	case strings.HasSuffix(mediaType, "xml"):
+		return "XML"
+	case strings.Contains(mediaType, "javascript"):
+		return "script"
+	case mediaType == "text/css":
+		return "CSS"
+	case strings.HasPrefix(mediaType, "image/"):
+		return strings.ToUpper(strings.TrimPrefix(mediaType, "image/"))
+	case strings.HasPrefix(mediaType, "text/"):
+		return "text"
+	}
+	return "app"
+}
+
+// har is an HTTP Archive 1.2 document
+type har struct {
+	Log harLog `json:"log"`
+}
+
+// harLog is the root of an HTTP Archive: the tool that wrote it and the
+// exchanges recorded
+type harLog struct {
+	Version string     `json:"version"` // HAR format version, 1.2
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"` // The exchanges, in the order they were sent
+}
+
+// harCreator names the tool that wrote an HTTP Archive
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harEntry is one request and response of an HTTP Archive
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"` // When the request was sent, RFC 3339
+	Time            float64     `json:"time"`            // Milliseconds the exchange took
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`             // Required by the format, always empty
+	Timings         harTimings  `json:"timings"`           // How Time splits between sending, waiting and receiving
+	Comment         string      `json:"comment,omitempty"` // Findings reported on the exchange
+}
+
+// harRequest is the request of a HAR entry
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`            // Always empty; cookies stay in Headers
+	Headers     []harNameValue `json:"headers"`            // Sorted by name
+	QueryString []harNameValue `json:"queryString"`        // Parameters of the URL's query
+	PostData    *harPostData   `json:"postData,omitempty"` // Request body, nil for none
+	HeadersSize int            `json:"headersSize"`        // -1, not measured
+	BodySize    int            `json:"bodySize"`           // Length of the recorded body
+}
+
+// harResponse is the response of a HAR entry
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"` // Always empty; cookies stay in Headers
+	Headers     []harNameValue `json:"headers"` // Sorted by name
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"` // Location header, empty for none
+	HeadersSize int            `json:"headersSize"` // -1, not measured
+	BodySize    int            `json:"bodySize"`    // Length of the recorded body
+}
+
+// harNameValue is a header, cookie or query parameter
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harPostData is the body of a HAR request
+type harPostData struct {
+	MimeType string `json:"mimeType"` // Content-Type of the body
+	Text     string `json:"text"`
+}
+
+// harContent is the body of a HAR response
+type harContent struct {
+	Size     int    `json:"size"`               // Length of the recorded body
+	MimeType string `json:"mimeType"`           // Content-Type of the body
+	Text     string `json:"text,omitempty"`     // The body, base64-encoded when Encoding says so
+	Encoding string `json:"encoding,omitempty"` // "base64" for bodies that are not UTF-8, else empty
+}
+
+// harTimings splits the time of a HAR entry
+type harTimings struct {
+	Send    float64 `json:"send"`    // Milliseconds sending the request
+	Wait    float64 `json:"wait"`    // Milliseconds waiting for the first byte
+	Receive float64 `json:"receive"` // Milliseconds reading the response
+}
+
+// writeHAR writes exchanges as an HTTP Archive, which ZAP imports
+func writeHAR(w io.Writer, exchanges []*exchange) error {
+	doc := har{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "gofuzz", Version: Version},
+		Entries: make([]harEntry, 0, len(exchanges)),
+	}}
+	for _, ex := range exchanges {
+		millis := float64(ex.duration) / float64(time.Millisecond)
+		entry := harEntry{
+			StartedDateTime: ex.time.Format(time.RFC3339Nano),
+			Time:            millis,
+			Request: harRequest{
+				Method:      ex.method,
+				URL:         ex.url.String(),
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(ex.requestHeader),
+				QueryString: harQuery(ex.url.Query()),
+				HeadersSize: -1,
+				BodySize:    len(ex.requestBody),
+			},
+			Response: harResponse{
+				Status:      ex.status,
+				StatusText:  ex.statusText,
+				HTTPVersion: ex.proto,
+				Cookies:     []harNameValue{},
+				Headers:     harHeaders(ex.responseHeader),
+				Content:     harBody(ex.responseHeader.Get("Content-Type"), ex.responseBody),
+				RedirectURL: ex.responseHeader.Get("Location"),
+				HeadersSize: -1,
+				BodySize:    len(ex.responseBody),
+			},
+			Timings: harTimings{Wait: millis},
+			Comment: ex.comment,
+		}
+		if len(ex.requestBody) > 0 {
+			entry.Request.PostData = &harPostData{
+				MimeType: ex.requestHeader.Get("Content-Type"),
+				Text:     string(ex.requestBody),
+			}
+		}
+		doc.Log.Entries = append(doc.Log.Entries, entry)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// harHeaders lists headers sorted by name
+func harHeaders(header http.Header) []harNameValue {
+	list := []harNameValue{}
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			list = append(list, harNameValue{name, value})
+		}
+	}
+	return list
+}
+
+// harQuery lists query parameters sorted by name
+func harQuery(query url.Values) []harNameValue {
+	list := []harNameValue{}
+	for _, name := range sortedKeys(query) {
+		for _, value := range query[name] {
+			list = append(list, harNameValue{name, value})
+		}
+	}
+	return list
+}
+
+// harBody describes a response body, base64-encoded unless it is text
+func harBody(contentType string, body []byte) harContent {
+	content := harContent{Size: len(body), MimeType: contentType}
+	if len(body) == 0 {
+		return content
+	}
+	if utf8.Valid(body) {
+		content.Text = string(body)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(body)
+		content.Encoding = "base64"
+	}
+	return content
+}
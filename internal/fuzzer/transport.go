@@ -0,0 +1,521 @@
+package fuzzer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Supported values for Config.HTTPProtocol
+const (
+	ProtocolAuto   = "auto"    // HTTP/1.1, upgrading to HTTP/2 via ALPN when offered
+	ProtocolHTTP10 = "http1.0" // HTTP/1.0 over a fresh connection per request
+	ProtocolHTTP11 = "http1.1" // HTTP/1.1 only, HTTP/2 disabled
+	ProtocolHTTP2  = "h2"      // HTTP/2 over TLS, fails if the server does not negotiate it
+	ProtocolH2C    = "h2c"     // Cleartext HTTP/2 with prior knowledge
+)
+
+// defaultClientTimeout is used when a component has no configured timeout
+const defaultClientTimeout = 10 * time.Second
+
+// transportKey holds the settings that distinguish one shared transport from
+// another
+type transportKey struct {
+	protocol           string
+	timeout            time.Duration
+	maxIdlePerHost     int
+	disableKeepAlives  bool
+	disableCompression bool
+	dnsCacheTTL        time.Duration
+	resolve            string // Canonical form of Config.Resolve
+	serverNames        string // Canonical form of Config.ServerNames
+	tls                tlsKey
+}
+
+// transports caches one round tripper per distinct transport configuration so
+// every fuzzer, crawler and detector in a run shares the same connection pool
+var transports = struct {
+	sync.Mutex
+	m map[transportKey]http.RoundTripper
+}{m: make(map[transportKey]http.RoundTripper)}
+
+// sharedTransport returns the pooled round tripper for the configuration,
+// building it on first use. A nil config yields the default settings.
+func sharedTransport(config *Config) (http.RoundTripper, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	key := transportKey{
+		protocol:           config.HTTPProtocol,
+		timeout:            config.Timeout,
+		maxIdlePerHost:     config.MaxIdleConnsPerHost,
+		disableKeepAlives:  config.DisableKeepAlives,
+		disableCompression: config.DisableCompression,
+		dnsCacheTTL:        config.DNSCacheTTL,
+		resolve:            resolveKey(config.Resolve),
+		serverNames:        resolveKey(config.ServerNames),
+		tls:                newTLSKey(config),
+	}
+	if key.protocol == "" {
+		key.protocol = ProtocolAuto
+	}
+	if key.maxIdlePerHost == 0 {
+		// Keep enough idle connections for every worker to reuse one
+		key.maxIdlePerHost = max(config.Concurrency, http.DefaultMaxIdleConnsPerHost)
+	}
+
+	transports.Lock()
+	defer transports.Unlock()
+
+	if t, ok := transports.m[key]; ok {
+		return t, nil
+	}
+	tlsConfig, err := TLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTransport(key, config.Resolve, config.ServerNames, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	transports.m[key] = t
+	return t, nil
+}
+
+// newHTTPClient returns a client backed by the shared transport. Redirects are
+// only followed when followRedirects is set.
+func newHTTPClient(config *Config, followRedirects bool) (*http.Client, error) {
+	transport, err := sharedTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultClientTimeout
+	if config != nil && config.Timeout > 0 {
+		timeout = config.Timeout
+	}
+	retrying := config != nil && config.DryRun == nil &&
+		((config.Retry != nil && config.Retry.maxRetries > 0) || config.Breaker != nil)
+	paced := config != nil && (config.RateLimit != nil || config.Politeness != nil)
+	if retrying || paced {
+		attempts := &attemptTransport{base: transport, limiter: config.RateLimit, politeness: config.Politeness, timeout: timeout}
+		if retrying {
+			attempts.breaker = config.Breaker
+		}
+		transport = attempts
+	}
+	if retrying {
+		transport = &retryTransport{base: transport, policy: config.Retry, breaker: config.Breaker}
+	}
+	if config != nil && config.DryRun != nil {
+		transport = config.DryRun
+	}
+	if config != nil && config.Traffic != nil && config.DryRun == nil {
+		var host string
+		if target, err := url.Parse(config.TargetURL); err == nil {
+			host = target.Host
+		}
+		transport = &trafficTransport{base: transport, traffic: config.Traffic, host: host}
+	}
+	if config != nil && len(config.Signers) > 0 {
+		var host string
+		if target, err := url.Parse(config.TargetURL); err == nil {
+			host = strings.ToLower(target.Host)
+		}
+		transport = &signTransport{base: transport, signers: config.Signers, target: host}
+	}
+	if config != nil && len(config.Hooks) > 0 {
+		transport = &hookTransport{base: transport, hooks: config.Hooks}
+	}
+	if config != nil && config.OAuth2 != nil {
+		transport = &bearerTransport{base: transport, tokens: config.OAuth2}
+	}
+	if config != nil && config.Impersonation != nil {
+		transport = &impersonateTransport{base: transport, impersonation: config.Impersonation}
+	}
+	if config != nil && (len(config.Headers) > 0 || len(config.Cookies) > 0) {
+		transport = &headerTransport{base: transport, headers: config.Headers, cookies: config.Cookies}
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+	if retrying || paced {
+		// Each attempt has its own timeout, a client-wide one would cut
+		// the retries and pauses short and count the time spent waiting
+		// for the rate limit or a host slot
+		client.Timeout = 0
+	}
+	if !followRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	return client, nil
+}
+
+// newDiscoveryClient returns a client that reaches the target even in a dry
+// run, for requests that carry no attack payloads
+func newDiscoveryClient(config *Config) (*http.Client, error) {
+	if config == nil {
+		return newHTTPClient(nil, true)
+	}
+	live := *config
+	live.DryRun = nil
+	return newHTTPClient(&live, true)
+}
+
+// newTimingClient returns a client for probes that time the responses,
+// keeping base's cookies. It waits up to timeout for a response and sends
+// each request once: retries and breaker pauses would count towards the
+// time, and the configured timeout would cut the probe off first.
+func newTimingClient(config *Config, base *http.Client, timeout time.Duration) (*http.Client, error) {
+	timed := *config
+	timed.Retry = nil
+	timed.Breaker = nil
+	timed.Timeout = timeout
+	client, err := newHTTPClient(&timed, true)
+	if err != nil {
+		return nil, err
+	}
+	client.Jar = base.Jar
+	return client, nil
+}
+
+// startClock returns req set to note when it asks for a connection, after
+// any rate limit or politeness wait, and a function returning the time since
+// then, or since startClock when the transport reports no connection. Timing
+// probes read it so queueing behind other requests is not taken for the
+// server's slowness.
+func startClock(req *http.Request) (*http.Request, func() time.Duration) {
+	start := time.Now()
+	var mu sync.Mutex
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			mu.Lock()
+			start = time.Now()
+			mu.Unlock()
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), func() time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return time.Since(start)
+	}
+}
+
+// newTransport builds the round tripper for the configured protocol. Hosts
+// in resolve are dialled at the address given instead of being looked up,
+// hosts in serverNames are sent the TLS server name given instead of their
+// own, and TLS connections use tlsConfig when it is set.
+func newTransport(key transportKey, resolve, serverNames map[string]string, tlsConfig *tls.Config) (http.RoundTripper, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if key.dnsCacheTTL > 0 {
+		dial = newDNSCache(dialer, key.dnsCacheTTL).DialContext
+	}
+	if len(resolve) > 0 {
+		lookup := dial
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return lookup(ctx, network, resolvedAddr(addr, resolve))
+		}
+	}
+
+	tuned := func() *http.Transport {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = dial
+		t.TLSClientConfig = tlsConfig
+		t.MaxIdleConns = 0 // No global cap, MaxIdleConnsPerHost bounds the pool
+		t.MaxIdleConnsPerHost = key.maxIdlePerHost
+		t.DisableKeepAlives = key.disableKeepAlives
+		t.DisableCompression = key.disableCompression
+		if len(serverNames) > 0 {
+			t.Proxy = serverNameProxy(t.Proxy, serverNames)
+		}
+		return t
+	}
+
+	switch key.protocol {
+	case ProtocolAuto:
+		t := tuned()
+		if len(serverNames) > 0 {
+			// The transport only fills in the server name when it dials TLS itself
+			t.DialTLSContext = dialTLS(dial, tlsConfig, serverNames, []string{"h2", "http/1.1"})
+		}
+		return t, nil
+
+	case ProtocolHTTP11:
+		t := tuned()
+		t.ForceAttemptHTTP2 = false
+		// A non-nil empty map disables the automatic HTTP/2 upgrade
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if len(serverNames) > 0 {
+			t.DialTLSContext = dialTLS(dial, tlsConfig, serverNames, []string{"http/1.1"})
+		}
+		return t, nil
+
+	case ProtocolHTTP2:
+		return &http2.Transport{
+			TLSClientConfig:    tlsConfig,
+			DisableCompression: key.disableCompression,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				if host, _, err := net.SplitHostPort(addr); err == nil {
+					cfg.ServerName = serverName(host, serverNames)
+				}
+				conn, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					conn.Close()
+					return nil, err
+				}
+				return tlsConn, nil
+			},
+		}, nil
+
+	case ProtocolH2C:
+		return &http2.Transport{
+			AllowHTTP:          true,
+			DisableCompression: key.disableCompression,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		}, nil
+
+	case ProtocolHTTP10:
+		return &http10Transport{timeout: key.timeout, resolve: resolve, serverNames: serverNames, tlsConfig: tlsConfig}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported HTTP protocol: %s", key.protocol)
+	}
+}
+
+// dnsCache resolves host names once per TTL so high-concurrency runs do not
+// hit the resolver for every new connection
+type dnsCache struct {
+	dialer  *net.Dialer
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+// dnsEntry is a cached lookup result
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// newDNSCache creates a DNS cache that dials through dialer
+func newDNSCache(dialer *net.Dialer, ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		dialer:  dialer,
+		ttl:     ttl,
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+// DialContext resolves addr through the cache and dials the first reachable
+// address
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// lookup returns the cached addresses for host, resolving on a miss
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// http10Transport sends each request as HTTP/1.0 on its own connection.
+// net/http always speaks HTTP/1.1, so the request line is written by hand.
+type http10Transport struct {
+	timeout     time.Duration
+	resolve     map[string]string
+	serverNames map[string]string
+	tlsConfig   *tls.Config
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *http10Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := dialTarget(req.Context(), req.URL, t.timeout, t.resolve, t.serverNames, t.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if t.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(t.timeout))
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/1.0\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	req.Header.Write(&buf)
+	if len(body) > 0 {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(body))
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write request: %v", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	resp.Body = &connBody{ReadCloser: resp.Body, conn: conn}
+	return resp, nil
+}
+
+// connBody closes the underlying connection together with the response body
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+// Close implements io.Closer
+func (b *connBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.conn.Close()
+	return err
+}
+
+// dialTarget opens a raw connection to the host of u, or the address resolve
+// gives for it, wrapping it in TLS for https URLs with the settings of
+// tlsConfig, if any, and the server name serverNames gives the host. It is
+// used wherever requests must be written byte for byte.
+func dialTarget(ctx context.Context, u *url.URL, timeout time.Duration, resolve, serverNames map[string]string,
+	tlsConfig *tls.Config) (net.Conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := resolvedAddr(net.JoinHostPort(u.Hostname(), port), resolve)
+
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+
+	if u.Scheme != "https" {
+		return conn, nil
+	}
+
+	cfg := &tls.Config{}
+	if tlsConfig != nil {
+		cfg = tlsConfig.Clone()
+	}
+	cfg.ServerName = serverName(u.Hostname(), serverNames)
+	cfg.NextProtos = []string{"http/1.1"}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %v", addr, err)
+	}
+	return tlsConn, nil
+}
+
+// ParseResolve parses "host:ip" overrides for Config.Resolve, which dial a
+// host at a fixed address the way curl's --resolve does
+func ParseResolve(specs []string) (map[string]string, error) {
+	resolve := make(map[string]string)
+	for _, spec := range specs {
+		host, ip, ok := strings.Cut(spec, ":")
+		ip = strings.Trim(ip, "[]")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid resolve override %q: expected host:ip", spec)
+		}
+		resolve[strings.ToLower(host)] = ip
+	}
+	return resolve, nil
+}
+
+// resolvedAddr replaces the host of a host:port address with its override
+func resolvedAddr(addr string, resolve map[string]string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip, ok := resolve[strings.ToLower(host)]; ok {
+		return net.JoinHostPort(ip, port)
+	}
+	return addr
+}
+
+// resolveKey returns resolve in a canonical form that can key the shared
+// transports
+func resolveKey(resolve map[string]string) string {
+	var pairs []string
+	for _, host := range sortedKeys(resolve) {
+		pairs = append(pairs, host+"="+resolve[host])
+	}
+	return strings.Join(pairs, ",")
+}
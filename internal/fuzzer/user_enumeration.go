@@ -0,0 +1,255 @@
+package fuzzer
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// enumerationRounds is how many times the existing and a made-up account
+	// are each submitted
+	enumerationRounds = 3
+
+	// enumerationTimingGap is how much slower or faster every submission of
+	// the existing account must be than every made-up one to count
+	enumerationTimingGap = 150 * time.Millisecond
+
+	// enumerationPassword fills the password fields of registration forms
+	enumerationPassword = "Gofuzz-Enum-1!"
+)
+
+var (
+	// resetForm and registrationForm recognize the forms by their URLs
+	resetForm        = regexp.MustCompile(`(?i)reset|forgot|recover|lost.?password`)
+	registrationForm = regexp.MustCompile(`(?i)regist|sign.?up|join|create.?account|enrol`)
+)
+
+// guessedAccounts are tried when no existing account is configured; an
+// answer that sets one apart from made-up accounts shows it exists
+var guessedAccounts = []string{"admin", "administrator", "test", "info", "support"}
+
+// enumerationForm returns what kind of account form the form is, by its
+// URLs and fields, or "" for other forms
+func enumerationForm(urls []string, fields map[string]FormField) string {
+	for _, u := range urls {
+		switch {
+		case resetForm.MatchString(u):
+			return "password reset"
+		case registrationForm.MatchString(u):
+			return "registration"
+		}
+	}
+	passwords := 0
+	for _, field := range fields {
+		if field.Type == "password" {
+			passwords++
+		}
+	}
+	if passwords >= 2 {
+		return "registration"
+	}
+	return ""
+}
+
+// accountSubmission is the answer to one submission of an account
+type accountSubmission struct {
+	probe   *probeResponse
+	text    string // Normalized body with the account masked
+	elapsed time.Duration
+}
+
+// testUserEnumeration submits an existing account and made-up ones to a
+// password reset or registration form and reports when the answers tell
+// them apart: a different status or message, with the account itself masked
+// in both, or every existing-account submission slower or faster than every
+// made-up one. The existing account is KnownAccount, else LoginUser, else
+// common names like admin are tried in turn. The other fields keep one set
+// of generated values throughout, so only the account differs, and the
+// submissions are sent once through a client of their own so only the
+// server's time is compared. It only runs with AllowBruteForce set, as a
+// reset form mails the existing account and a registration form may create
+// the made-up ones.
+func (f *WebFormFuzzer) testUserEnumeration(client *http.Client) {
+	if !f.config.AllowBruteForce {
+		f.logger.Warn("account enumeration needs AllowBruteForce, skipping")
+		return
+	}
+	timeout := f.config.Timeout
+	if timeout <= 0 {
+		timeout = defaultClientTimeout
+	}
+	client, err := newTimingClient(f.config, client, timeout)
+	if err != nil {
+		f.logger.Debug("account enumeration client failed", "error", err)
+		return
+	}
+	base := f.nextInput()
+	parts := strings.SplitN(base, " ", 3)
+	if len(parts) < 2 {
+		return
+	}
+	kind := enumerationForm([]string{f.formURL, parts[1]}, f.fields)
+	field := accountField(f.fields)
+	if kind == "" || field == "" {
+		return
+	}
+	set := make(map[string]string)
+	for name, formField := range f.fields {
+		if formField.Type == "password" {
+			set[name] = enumerationPassword
+		}
+	}
+
+	email := f.fields[field].Type == "email"
+	domain := "example.com"
+	if u, err := url.Parse(f.formURL); err == nil && u.Hostname() != "" {
+		domain = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+	var accounts []string
+	switch {
+	case f.config.KnownAccount != "":
+		accounts = []string{f.config.KnownAccount}
+	case f.config.LoginUser != "":
+		accounts = []string{f.config.LoginUser}
+	default:
+		for _, name := range guessedAccounts {
+			if email {
+				name += "@" + domain
+			}
+			accounts = append(accounts, name)
+		}
+	}
+	if at := strings.LastIndex(accounts[0], "@"); at > 0 {
+		email, domain = true, accounts[0][at+1:]
+	}
+
+	submit := func(account string) (*accountSubmission, error) {
+		set[field] = account
+		probe, elapsed, err := f.timedSubmission(client, base, set)
+		if err != nil {
+			return nil, err
+		}
+		return &accountSubmission{probe, maskAccount(probe.body, account), elapsed}, nil
+	}
+	for _, account := range accounts {
+		if f.expired() {
+			return
+		}
+		var existing, madeUp []*accountSubmission
+		for i := 0; i < enumerationRounds; i++ {
+			known, err := submit(account)
+			if err != nil {
+				f.logger.Debug("account submission failed", "error", err)
+				return
+			}
+			other := fmt.Sprintf("gofuzz%08x", f.rng.Uint32())
+			if email {
+				other += "@" + domain
+			}
+			unknown, err := submit(other)
+			if err != nil {
+				f.logger.Debug("account submission failed", "error", err)
+				return
+			}
+			existing, madeUp = append(existing, known), append(madeUp, unknown)
+		}
+		if finding := enumerationFinding(kind, field, account, existing, madeUp); finding != nil {
+			finding.URL = f.formURL
+			if f.config.Findings.Add(finding) {
+				f.logger.Warn("user enumeration", "field", field, "evidence", finding.Evidence)
+			}
+			return
+		}
+	}
+}
+
+// maskAccount returns the normalized body with the account, as submitted,
+// HTML-escaped or URL-encoded, replaced, so a page echoing it reads the
+// same for every account
+func maskAccount(body []byte, account string) string {
+	text := string(body)
+	for _, form := range []string{account, html.EscapeString(account), url.QueryEscape(account)} {
+		text = strings.ReplaceAll(text, form, "{account}")
+	}
+	return normalizeBody([]byte(text))
+}
+
+// enumerationFinding compares the submissions of an existing account with
+// those of made-up ones, and returns a finding when they tell them apart
+func enumerationFinding(kind, field, account string, existing, madeUp []*accountSubmission) *Finding {
+	consistent := func(submissions []*accountSubmission) bool {
+		for _, s := range submissions[1:] {
+			if s.text != submissions[0].text || s.probe.resp.StatusCode != submissions[0].probe.resp.StatusCode {
+				return false
+			}
+		}
+		return true
+	}
+	known, unknown := existing[0], madeUp[0]
+	finding := &Finding{
+		Type:      "user-enumeration",
+		Method:    known.probe.req.Method,
+		Parameter: field,
+		Payload:   account,
+	}
+
+	if consistent(existing) && consistent(madeUp) &&
+		(known.text != unknown.text || known.probe.resp.StatusCode != unknown.probe.resp.StatusCode) {
+		finding.Severity, finding.Confidence = SeverityMedium, ConfidenceFirm
+		finding.Evidence = fmt.Sprintf("the %s form answers the existing account %q with %s and made-up accounts with %s",
+			kind, account, known.probe, unknown.probe)
+		if ours, theirs := differingText(known.text, unknown.text); ours != "" || theirs != "" {
+			finding.Evidence += fmt.Sprintf(", reading %q where they read %q", ours, theirs)
+		}
+		captureExchange(finding, known.probe.req, known.probe.reqBody, known.probe.resp, known.probe.body)
+		return finding
+	}
+
+	slowest, fastest := known.elapsed, known.elapsed
+	for _, s := range existing {
+		slowest, fastest = max(slowest, s.elapsed), min(fastest, s.elapsed)
+	}
+	otherSlowest, otherFastest := unknown.elapsed, unknown.elapsed
+	for _, s := range madeUp {
+		otherSlowest, otherFastest = max(otherSlowest, s.elapsed), min(otherFastest, s.elapsed)
+	}
+	if fastest < otherSlowest+enumerationTimingGap && otherFastest < slowest+enumerationTimingGap {
+		return nil
+	}
+	finding.Severity, finding.Confidence = SeverityLow, ConfidenceTentative
+	finding.Evidence = fmt.Sprintf("the %s form answers alike, but the existing account %q takes %s to %s and made-up accounts %s to %s",
+		kind, account, fastest.Round(time.Millisecond), slowest.Round(time.Millisecond),
+		otherFastest.Round(time.Millisecond), otherSlowest.Round(time.Millisecond))
+	captureExchange(finding, known.probe.req, known.probe.reqBody, known.probe.resp, known.probe.body)
+	return finding
+}
+
+// differingText returns a short excerpt of each text where they first
+// differ, with markup removed
+func differingText(a, b string) (string, string) {
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	// Back up to the start of the text node the difference is in
+	if tag := strings.LastIndex(a[:start], ">"); tag >= 0 {
+		start = tag + 1
+	}
+	excerpt := func(text string) string {
+		text = text[start:]
+		if end := strings.Index(text, "<"); end >= 0 {
+			text = text[:end]
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if len(text) > 80 {
+			text = text[:80] + "…"
+		}
+		return text
+	}
+	return excerpt(a), excerpt(b)
+}
@@ -0,0 +1,479 @@
+package fuzzer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// maxVCSListed bounds the files of a reconstructed listing named in a
+// finding's evidence
+const maxVCSListed = 50
+
+// Contents of Git and Mercurial metadata files
+var (
+	gitHead     = regexp.MustCompile(`^(?:ref: (refs/\S+)|([0-9a-f]{40}))$`)
+	gitObjectID = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	gitRemote   = regexp.MustCompile(`(?m)^\s*url\s*=\s*(\S+)`)
+	hgRequire   = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]*$`)
+)
+
+// vcsSystem is a version control system whose metadata directory a site may
+// serve along with the working copy
+type vcsSystem struct {
+	name   string
+	dir    string // Metadata directory, with trailing slash
+	verify func(t *VCSTester, base string) *vcsExposure
+}
+
+// vcsSystems are the systems looked for in every directory
+var vcsSystems = []vcsSystem{
+	{"Git", ".git/", (*VCSTester).verifyGit},
+	{"Subversion", ".svn/", (*VCSTester).verifySVN},
+	{"Mercurial", ".hg/", (*VCSTester).verifyHg},
+}
+
+// vcsExposure is what fetching a metadata directory's files showed
+type vcsExposure struct {
+	response   *probeResponse // The first file recognized, for the captured exchange
+	evidence   []string       // Each file fetched and what it held
+	confidence Confidence
+	files      []string // Working copy files listed by the metadata, when listing is enabled
+	partial    bool     // The listing stops short, the file holding it being truncated or damaged
+}
+
+// VCSTester looks for Git, Subversion and Mercurial metadata served from
+// the directories of the paths found. A directory is only reported once
+// its files parse as what they claim to be: a Git HEAD naming a ref, then
+// the commit it points to inflating from the object store; a Subversion
+// wc.db database or entries file; a Mercurial requires file, then the
+// changelog revlog. With Config.VCSListing the working copy's files are
+// listed from the Git index, the Mercurial dirstate or the Subversion
+// entries and named in the finding.
+type VCSTester struct {
+	config *Config
+	client *http.Client
+	host   string // Canonical host of the target; paths elsewhere, such as CDN assets, are skipped
+	tested map[string]bool
+	logger *slog.Logger
+}
+
+// NewVCSTester creates a version control metadata tester
+func NewVCSTester(config *Config) (*VCSTester, error) {
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	client, err := newHTTPClient(config, false)
+	if err != nil {
+		return nil, err
+	}
+	return &VCSTester{
+		config: config,
+		client: client,
+		host:   canonicalHost(target),
+		tested: make(map[string]bool),
+		logger: logging.For("vcs"),
+	}, nil
+}
+
+// Run tests the directory of the configured target URL and those above it
+func (t *VCSTester) Run() error {
+	t.Test([]string{t.config.TargetURL}, t.config.Deadline)
+	return nil
+}
+
+// Test looks for metadata in the directory of every URL and each directory
+// above it, each directory on the target's host once, and stops once the
+// deadline passes if one is set. It returns the number of directories
+// tested.
+func (t *VCSTester) Test(urls []string, deadline time.Time) int {
+	expired := func() bool {
+		return !deadline.IsZero() && time.Now().After(deadline)
+	}
+	tested := 0
+	for _, targetURL := range urls {
+		for _, dir := range t.directories(targetURL) {
+			tested++
+			for _, system := range vcsSystems {
+				if expired() {
+					return tested
+				}
+				if exposure := system.verify(t, dir+system.dir); exposure != nil {
+					t.report(system, dir+system.dir, exposure)
+				}
+			}
+		}
+	}
+	return tested
+}
+
+// directories returns the URLs of a URL's directory and of every directory
+// above it not tested yet
+func (t *VCSTester) directories(targetURL string) []string {
+	u, err := url.Parse(targetURL)
+	if err != nil || u.Host == "" || canonicalHost(u) != t.host {
+		return nil
+	}
+	root := u.Scheme + "://" + u.Host
+	dir, _ := path.Split(u.EscapedPath())
+	if dir == "" {
+		dir = "/"
+	}
+	var dirs []string
+	for {
+		if key := u.Host + dir; !t.tested[key] {
+			t.tested[key] = true
+			dirs = append(dirs, root+dir)
+		}
+		if dir == "/" {
+			return dirs
+		}
+		dir, _ = path.Split(strings.TrimSuffix(dir, "/"))
+	}
+}
+
+// verifyGit recognizes a Git directory by its HEAD and config, and confirms
+// it by inflating the commit HEAD points to from the loose objects
+func (t *VCSTester) verifyGit(base string) *vcsExposure {
+	head := t.fetch(base + "HEAD")
+	if head == nil {
+		return nil
+	}
+	text := strings.TrimSpace(string(head.body))
+	match := gitHead.FindStringSubmatch(text)
+	if match == nil {
+		return nil
+	}
+	exposure := &vcsExposure{response: head, confidence: ConfidenceTentative,
+		evidence: []string{fmt.Sprintf("HEAD holds %q", text)}}
+
+	if config := t.fetch(base + "config"); config != nil && bytes.Contains(config.body, []byte("[core]")) {
+		exposure.confidence = ConfidenceFirm
+		evidence := "config has a [core] section"
+		if remote := gitRemote.FindSubmatch(config.body); remote != nil {
+			evidence += fmt.Sprintf(" and remote %s", remote[1])
+		}
+		exposure.evidence = append(exposure.evidence, evidence)
+	}
+
+	commit := match[2]
+	if ref := match[1]; ref != "" {
+		commit = t.gitRef(base, ref)
+	}
+	if commit != "" {
+		if kind := t.gitObject(base, commit); kind == "commit" {
+			exposure.confidence = ConfidenceCertain
+			exposure.evidence = append(exposure.evidence, fmt.Sprintf("commit %s inflates from objects/%s/",
+				commit, commit[:2]))
+		}
+	}
+
+	if t.config.VCSListing {
+		if index := t.fetch(base + "index"); index != nil {
+			exposure.files, exposure.partial = parseGitIndex(index.body)
+		}
+	}
+	return exposure
+}
+
+// gitRef resolves a ref to the commit it names, from its loose file or
+// from packed-refs, or returns ""
+func (t *VCSTester) gitRef(base, ref string) string {
+	if loose := t.fetch(base + ref); loose != nil {
+		if id := strings.TrimSpace(string(loose.body)); gitObjectID.MatchString(id) {
+			return id
+		}
+	}
+	packed := t.fetch(base + "packed-refs")
+	if packed == nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(packed.body), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == ref && gitObjectID.MatchString(fields[0]) {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// gitObject fetches a loose object and returns its type, or "" when it is
+// missing, packed or not an object
+func (t *VCSTester) gitObject(base, id string) string {
+	object := t.fetch(base + "objects/" + id[:2] + "/" + id[2:])
+	if object == nil {
+		return ""
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(object.body))
+	if err != nil {
+		return ""
+	}
+	defer reader.Close()
+	header := make([]byte, 32)
+	n, _ := io.ReadFull(reader, header)
+	kind, size, ok := strings.Cut(string(header[:n]), " ")
+	if !ok {
+		return ""
+	}
+	if end := strings.IndexByte(size, 0); end < 0 {
+		return ""
+	} else if _, err := strconv.Atoi(size[:end]); err != nil {
+		return ""
+	}
+	return kind
+}
+
+// parseGitIndex lists the paths of a Git index, versions 2 to 4. It
+// returns the paths read before any damage or truncation, and whether it
+// stopped short.
+func parseGitIndex(data []byte) ([]string, bool) {
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, true
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	if version < 2 || version > 4 {
+		return nil, true
+	}
+
+	var files []string
+	previous := ""
+	pos := 12
+	for len(files) < count {
+		// ctime, mtime, dev, ino, mode, uid, gid, size, object ID and flags
+		start := pos
+		if pos+62 > len(data) {
+			return files, true
+		}
+		flags := binary.BigEndian.Uint16(data[pos+60 : pos+62])
+		pos += 62
+		if version >= 3 && flags&0x4000 != 0 {
+			pos += 2
+		}
+
+		var name string
+		if version == 4 {
+			// The path is the previous one with some bytes stripped, plus a suffix
+			strip, n := gitVarint(data[min(pos, len(data)):])
+			if n == 0 || strip > len(previous) {
+				return files, true
+			}
+			pos += n
+			end := bytes.IndexByte(data[min(pos, len(data)):], 0)
+			if end < 0 {
+				return files, true
+			}
+			name = previous[:len(previous)-strip] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[min(pos, len(data)):], 0)
+			if end < 0 {
+				return files, true
+			}
+			name = string(data[pos : pos+end])
+			// Entries are padded with NULs to a multiple of eight bytes
+			pos = start + (pos+end-start+8)&^7
+		}
+		files = append(files, name)
+		previous = name
+	}
+	return files, false
+}
+
+// gitVarint decodes the offset encoding of index version 4, returning the
+// value and the bytes read, or 0 bytes when it runs off the data
+func gitVarint(data []byte) (int, int) {
+	value := 0
+	for i, c := range data {
+		if i > 8 {
+			return 0, 0
+		}
+		if i > 0 {
+			value++
+		}
+		value = value<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// verifySVN recognizes a Subversion working copy by its wc.db database, of
+// version 1.7 on, or by its entries file, of older versions
+func (t *VCSTester) verifySVN(base string) *vcsExposure {
+	if db := t.fetch(base + "wc.db"); db != nil && bytes.HasPrefix(db.body, []byte("SQLite format 3\x00")) {
+		return &vcsExposure{response: db, confidence: ConfidenceCertain,
+			evidence: []string{"wc.db is an SQLite database"}}
+	}
+
+	entries := t.fetch(base + "entries")
+	if entries == nil {
+		return nil
+	}
+	first, rest, _ := strings.Cut(string(entries.body), "\n")
+	format, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || format < 7 || format > 40 {
+		return nil
+	}
+	// From 1.7 on entries only holds the format; wc.db holds the rest
+	if format > 10 {
+		if strings.TrimSpace(rest) != "" {
+			return nil
+		}
+		return &vcsExposure{response: entries, confidence: ConfidenceTentative,
+			evidence: []string{fmt.Sprintf("entries holds working copy format %d, without its wc.db", format)}}
+	}
+
+	// Records are separated by form feeds, the first being the directory itself
+	records := strings.Split(rest, "\f\n")
+	if lines := strings.SplitN(records[0], "\n", 3); len(lines) < 2 || lines[0] != "" || lines[1] != "dir" {
+		return nil
+	}
+	exposure := &vcsExposure{response: entries, confidence: ConfidenceCertain,
+		evidence: []string{fmt.Sprintf("entries is a format %d working copy directory", format)}}
+	if t.config.VCSListing {
+		for _, record := range records[1:] {
+			lines := strings.SplitN(record, "\n", 3)
+			if len(lines) < 2 || lines[0] == "" {
+				continue
+			}
+			name := lines[0]
+			if lines[1] == "dir" {
+				name += "/"
+			}
+			exposure.files = append(exposure.files, name)
+		}
+		exposure.partial = !strings.HasSuffix(rest, "\f\n")
+	}
+	return exposure
+}
+
+// verifyHg recognizes a Mercurial repository by its requires file, and
+// confirms it by the header of the changelog revlog
+func (t *VCSTester) verifyHg(base string) *vcsExposure {
+	requires := t.fetch(base + "requires")
+	if requires == nil {
+		return nil
+	}
+	features := strings.Fields(string(requires.body))
+	known := false
+	for _, feature := range features {
+		if !hgRequire.MatchString(feature) {
+			return nil
+		}
+		known = known || strings.HasPrefix(feature, "revlog") || feature == "store" || feature == "share-safe"
+	}
+	if !known {
+		return nil
+	}
+	exposure := &vcsExposure{response: requires, confidence: ConfidenceFirm,
+		evidence: []string{"requires lists " + strings.Join(features, ", ")}}
+
+	for _, changelog := range []string{"store/00changelog.i", "00changelog.i"} {
+		// Revlog version 1, the flags before it aside
+		if revlog := t.fetch(base + changelog); revlog != nil && len(revlog.body) >= 64 &&
+			binary.BigEndian.Uint16(revlog.body[2:4]) == 1 {
+			exposure.confidence = ConfidenceCertain
+			exposure.evidence = append(exposure.evidence, changelog+" has a revlog header")
+			break
+		}
+	}
+
+	if t.config.VCSListing {
+		if dirstate := t.fetch(base + "dirstate"); dirstate != nil {
+			exposure.files, exposure.partial = parseHgDirstate(dirstate.body)
+		}
+	}
+	return exposure
+}
+
+// parseHgDirstate lists the paths of a version 1 Mercurial dirstate. It
+// returns the paths read before any damage or truncation, and whether it
+// stopped short.
+func parseHgDirstate(data []byte) ([]string, bool) {
+	// Two parent node IDs, then entries of state, mode, size, mtime, path
+	// length and path, a copy source following the path after a NUL
+	if len(data) < 40 || bytes.HasPrefix(data, []byte("dirstate-v2")) {
+		return nil, true
+	}
+	var files []string
+	for pos := 40; pos < len(data); {
+		if pos+17 > len(data) || !strings.ContainsRune("nmar", rune(data[pos])) {
+			return files, true
+		}
+		length := int(binary.BigEndian.Uint32(data[pos+13 : pos+17]))
+		pos += 17
+		if pos+length > len(data) {
+			return files, true
+		}
+		name, _, _ := strings.Cut(string(data[pos:pos+length]), "\x00")
+		files = append(files, name)
+		pos += length
+	}
+	return files, false
+}
+
+// report records a finding for an exposed metadata directory
+func (t *VCSTester) report(system vcsSystem, base string, exposure *vcsExposure) {
+	severity := SeverityHigh
+	if exposure.confidence == ConfidenceTentative {
+		severity = SeverityMedium
+	}
+	evidence := fmt.Sprintf("%s metadata served: %s", system.name, strings.Join(exposure.evidence, "; "))
+	if exposure.files != nil || exposure.partial {
+		evidence += fmt.Sprintf("; lists %d files", len(exposure.files))
+		if exposure.partial {
+			evidence += " (partial)"
+		}
+		if len(exposure.files) > 0 {
+			listed := exposure.files[:min(len(exposure.files), maxVCSListed)]
+			evidence += ": " + strings.Join(listed, ", ")
+			if more := len(exposure.files) - len(listed); more > 0 {
+				evidence += fmt.Sprintf(" and %d more", more)
+			}
+		}
+	}
+
+	finding := &Finding{
+		Type:       "vcs-metadata",
+		Severity:   severity,
+		Confidence: exposure.confidence,
+		URL:        base,
+		Method:     http.MethodGet,
+		Payload:    system.dir,
+		Evidence:   evidence,
+	}
+	response := exposure.response
+	captureExchange(finding, response.req, nil, response.resp, response.body)
+	if t.config.Findings.Add(finding) {
+		t.logger.Warn(finding.Type, "url", finding.URL, "system", system.name, "confidence", finding.Confidence,
+			"files", len(exposure.files))
+	}
+}
+
+// fetch sends a GET request and returns the response when it is a 200 with
+// a body, or nil
+func (t *VCSTester) fetch(targetURL string) *probeResponse {
+	response, err := fetchProbe(t.client, t.config, targetURL, nil)
+	if err != nil {
+		t.logger.Debug("request failed", "url", targetURL, "error", err)
+		return nil
+	}
+	if response.resp.StatusCode != http.StatusOK || len(response.body) == 0 {
+		return nil
+	}
+	return response
+}
@@ -0,0 +1,6 @@
+package fuzzer
+
+// Version is the semantic version of the fuzzer module. The public packages
+// (fuzz, crawl, detect, report) follow semver: breaking API changes only
+// happen on a major version bump.
+const Version = "1.0.0"
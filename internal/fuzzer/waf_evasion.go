@@ -0,0 +1,350 @@
+package fuzzer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gregcmartin/gofuzz/internal/logging"
+)
+
+// wafParam is the parameter the trigger payloads are sent in
+const wafParam = "q"
+
+// wafTriggers are payloads WAFs block on sight, one per attack class
+var wafTriggers = []struct{ name, payload string }{
+	{"xss", "<script>alert(1)</script>"},
+	{"sqli", "' OR '1'='1' --"},
+	{"traversal", "../../../../etc/passwd"},
+	{"command", ";cat /etc/passwd"},
+}
+
+// rawHeader is a header line of a raw request
+type rawHeader struct {
+	name, value string
+}
+
+// wafRequest is a request written byte for byte, in a formatting the
+// evasion variations change
+type wafRequest struct {
+	method     string
+	target     string // The request target, path and query
+	headers    []rawHeader
+	body       string
+	separator  string // Between a header's name and value
+	trailing   string // After a header's value
+	chunkSize  int    // Sends the body chunked in pieces this long (0 = with Content-Length)
+	extensions bool   // Adds a chunk extension to every chunk
+}
+
+// String renders the request as sent on the wire
+func (r wafRequest) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", r.method, r.target)
+	for _, header := range r.headers {
+		b.WriteString(header.name + r.separator + header.value + r.trailing + "\r\n")
+	}
+	if r.body == "" {
+		b.WriteString("\r\n")
+		return b.String()
+	}
+	if r.chunkSize == 0 {
+		fmt.Fprintf(&b, "Content-Length%s%d%s\r\n\r\n%s", r.separator, len(r.body), r.trailing, r.body)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Transfer-Encoding%schunked%s\r\n\r\n", r.separator, r.trailing)
+	for rest := r.body; rest != ""; {
+		chunk := rest[:min(r.chunkSize, len(rest))]
+		rest = rest[len(chunk):]
+		extension := ""
+		if r.extensions {
+			extension = ";gofuzz=1"
+		}
+		fmt.Fprintf(&b, "%x%s\r\n%s\r\n", len(chunk), extension, chunk)
+	}
+	b.WriteString("0\r\n\r\n")
+	return b.String()
+}
+
+// wafVariation is one way of formatting a request that a WAF may not
+// normalize the way the server behind it does
+type wafVariation struct {
+	name  string
+	body  bool // Only applies to requests with a body
+	apply func(r *wafRequest, rng *rand.Rand)
+}
+
+// wafVariations vary header casing, order and spacing, and send bodies
+// chunked
+var wafVariations = []wafVariation{
+	{"lower-case header names", false, func(r *wafRequest, _ *rand.Rand) {
+		for i := range r.headers {
+			r.headers[i].name = strings.ToLower(r.headers[i].name)
+		}
+	}},
+	{"upper-case header names", false, func(r *wafRequest, _ *rand.Rand) {
+		for i := range r.headers {
+			r.headers[i].name = strings.ToUpper(r.headers[i].name)
+		}
+	}},
+	{"random-case header names", false, func(r *wafRequest, rng *rand.Rand) {
+		for i := range r.headers {
+			name := []byte(r.headers[i].name)
+			for j := range name {
+				if rng.Intn(2) == 0 {
+					name[j] = strings.ToUpper(string(name[j]))[0]
+				} else {
+					name[j] = strings.ToLower(string(name[j]))[0]
+				}
+			}
+			r.headers[i].name = string(name)
+		}
+	}},
+	{"shuffled header order", false, func(r *wafRequest, rng *rand.Rand) {
+		rng.Shuffle(len(r.headers), func(i, j int) { r.headers[i], r.headers[j] = r.headers[j], r.headers[i] })
+	}},
+	{"no space after colon", false, func(r *wafRequest, _ *rand.Rand) { r.separator = ":" }},
+	{"tab after colon", false, func(r *wafRequest, _ *rand.Rand) { r.separator = ":\t" }},
+	{"padded header values", false, func(r *wafRequest, _ *rand.Rand) {
+		r.separator = ":    "
+		r.trailing = "  "
+	}},
+	{"chunked body", true, func(r *wafRequest, _ *rand.Rand) { r.chunkSize = 3 }},
+	{"one-byte chunks with extensions", true, func(r *wafRequest, _ *rand.Rand) {
+		r.chunkSize = 1
+		r.extensions = true
+	}},
+}
+
+// wafBlockStatuses are the statuses WAFs answer blocked requests with
+var wafBlockStatuses = map[int]bool{
+	http.StatusForbidden: true, http.StatusNotAcceptable: true, 419: true,
+	http.StatusNotImplemented: true, 999: true,
+}
+
+// wafResult is the outcome of a raw request
+type wafResult struct {
+	status int
+	block  *SecurityBlock
+	raw    string // Status line and headers
+}
+
+// WAFEvasionProber tests how the WAF in front of the target normalizes
+// requests. Attack payloads it blocks are sent again in requests formatted
+// otherwise, with header names in other cases, headers in another order,
+// other spacing around header values and bodies sent chunked, and each
+// variation that gets a payload past the block is reported.
+type WAFEvasionProber struct {
+	config *Config
+	target *url.URL
+	rng    *rand.Rand
+	logger *slog.Logger
+}
+
+// NewWAFEvasionProber creates a WAF evasion prober for the target
+func NewWAFEvasionProber(config *Config) (*WAFEvasionProber, error) {
+	target, err := url.Parse(config.TargetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme for WAF evasion probes: %s", target.Scheme)
+	}
+	return &WAFEvasionProber{
+		config: config,
+		target: target,
+		rng:    newRand(runSeed(config), streamEvasion),
+		logger: logging.For("waf-evasion"),
+	}, nil
+}
+
+// Run sends each trigger payload in the query of a GET and the body of a
+// POST. Payloads the plain request gets blocked are sent with every
+// variation, and a variation answered like the benign baseline, while the
+// plain request is still blocked afterwards, is reported as waf-bypass.
+func (p *WAFEvasionProber) Run() error {
+	baseline, err := p.send(p.request(http.MethodGet, "gofuzz"))
+	if err != nil {
+		return fmt.Errorf("baseline request failed: %v", err)
+	}
+	if p.blocked(baseline, 0) {
+		return fmt.Errorf("baseline request blocked with HTTP %d, nothing to compare against", baseline.status)
+	}
+
+	blocks := 0
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		for _, trigger := range wafTriggers {
+			plain := p.request(method, trigger.payload)
+			result, err := p.send(plain)
+			if err != nil || !p.blocked(result, baseline.status) {
+				continue
+			}
+			blocks++
+			for _, variation := range wafVariations {
+				if variation.body && plain.body == "" {
+					continue
+				}
+				p.tryVariation(plain, result, baseline, trigger.name, trigger.payload, variation)
+			}
+		}
+	}
+	if blocks == 0 {
+		p.logger.Info("no trigger payload was blocked, nothing to evade")
+	}
+	return nil
+}
+
+// tryVariation sends a blocked request formatted by a variation and reports
+// it getting through
+func (p *WAFEvasionProber) tryVariation(plain wafRequest, blocked, baseline *wafResult, class, payload string,
+	variation wafVariation) {
+	varied := plain
+	varied.headers = append([]rawHeader(nil), plain.headers...)
+	variation.apply(&varied, p.rng)
+	result, err := p.send(varied)
+	if err != nil {
+		p.logger.Debug("variation failed", "variation", variation.name, "error", err)
+		return
+	}
+	if p.blocked(result, baseline.status) || result.status != baseline.status {
+		p.logger.Debug("variation normalized", "variation", variation.name, "class", class, "status", result.status)
+		return
+	}
+	// The plain request getting through now means the block was transient
+	if again, err := p.send(plain); err != nil || !p.blocked(again, baseline.status) {
+		return
+	}
+
+	p.logger.Warn("WAF bypass", "variation", variation.name, "class", class, "method", plain.method)
+	p.config.Findings.Add(&Finding{
+		Type:       "waf-bypass",
+		Severity:   SeverityMedium,
+		Confidence: ConfidenceFirm,
+		URL:        p.target.String(),
+		Method:     plain.method,
+		Parameter:  variation.name,
+		Payload:    payload,
+		Evidence: fmt.Sprintf("%s payload sent with %s was answered HTTP %d like a benign request, while the plain request got HTTP %d%s",
+			class, variation.name, result.status, blocked.status, blockEvidence(blocked)),
+		Request:  varied.String(),
+		Response: result.raw,
+	})
+}
+
+// request builds a plain request carrying value in wafParam: in the query
+// of GETs, in a form-encoded body otherwise
+func (p *WAFEvasionProber) request(method, value string) wafRequest {
+	host := p.target.Host
+	if override := p.config.Headers["Host"]; override != "" {
+		host = override
+	}
+	target := *p.target
+	query := target.Query()
+	var body string
+	if method == http.MethodGet {
+		query.Set(wafParam, value)
+	} else {
+		body = url.Values{wafParam: {value}}.Encode()
+	}
+	target.RawQuery = query.Encode()
+
+	r := wafRequest{method: method, target: target.RequestURI(), body: body, separator: ": "}
+	r.headers = append(r.headers, rawHeader{"Host", host})
+	userAgent := "Mozilla/5.0 (compatible; gofuzz)"
+	for _, header := range extraHeaders(p.config) {
+		switch header[0] {
+		case "Host":
+		case "User-Agent":
+			userAgent = header[1]
+		default:
+			r.headers = append(r.headers, rawHeader{header[0], header[1]})
+		}
+	}
+	r.headers = append(r.headers, rawHeader{"User-Agent", userAgent}, rawHeader{"Accept", "*/*"})
+	if body != "" {
+		r.headers = append(r.headers, rawHeader{"Content-Type", "application/x-www-form-urlencoded"})
+	}
+	r.headers = append(r.headers, rawHeader{"Connection", "close"})
+	return r
+}
+
+// send writes a raw request on its own connection and reads the response.
+// It waits for the rate limit and the host's politeness policy like any
+// client request, and the exchange is recorded in Config.Traffic.
+func (p *WAFEvasionProber) send(r wafRequest) (*wafResult, error) {
+	release, err := pace(context.Background(), p.config, p.target.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+	defer cancel()
+
+	tlsConfig, err := TLSConfig(p.config)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	conn, err := dialTarget(ctx, p.target, p.config.Timeout, p.config.Resolve, p.config.ServerNames, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.config.Timeout))
+
+	if _, err := conn.Write([]byte(r.String())); err != nil {
+		return nil, fmt.Errorf("failed to write request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	defer resp.Body.Close()
+	release()
+
+	if p.config.Traffic != nil {
+		header := make(http.Header)
+		for _, h := range r.headers {
+			header.Add(h.name, h.value)
+		}
+		u, _ := p.target.Parse(r.target)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxExchangeBody))
+		p.config.Traffic.recordRaw(start, r.method, u, header, []byte(r.body), resp, body)
+	}
+
+	// Headers in a fixed order, so the evidence reads the same every run
+	result := &wafResult{status: resp.StatusCode, raw: fmt.Sprintf("%s %s\r\n", resp.Proto, resp.Status)}
+	for _, name := range sortedKeys(resp.Header) {
+		for _, value := range resp.Header[name] {
+			result.raw += name + ": " + value + "\r\n"
+		}
+	}
+	if block, err := DetectSecurityProtection(resp); err == nil && block != nil && block.Type != "Rate Limit" {
+		result.block = block
+	}
+	return result, nil
+}
+
+// blocked reports whether a response is a WAF's block: a detected security
+// protection, or a status WAFs block with that a benign request with
+// baseline status does not get
+func (p *WAFEvasionProber) blocked(result *wafResult, baseline int) bool {
+	return result.block != nil || (wafBlockStatuses[result.status] && result.status != baseline)
+}
+
+// blockEvidence describes the protection a blocked response came from, if
+// it was recognized
+func blockEvidence(result *wafResult) string {
+	if result.block == nil {
+		return ""
+	}
+	return fmt.Sprintf(" from %s (%s)", result.block.Type, result.block.Evidence)
+}
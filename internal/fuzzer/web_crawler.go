@@ -1,25 +1,27 @@
 package fuzzer
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
-	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
+	"github.com/gregcmartin/gofuzz/internal/logging"
 	"golang.org/x/net/html"
 )
 
 // WebCrawler implements web application crawling
 type WebCrawler struct {
 	baseURL        *url.URL
-	visited        map[string]bool
-	forms          map[string][]FormField
+	visited        map[string]string // Canonical URL to the URL fetched for it
+	forms          map[string][]Form
 	formSignatures map[string]bool // Track unique form signatures
+	assets         map[string]bool // Scripts, stylesheets, images and media referenced by crawled pages
 	maxPages       int
 	concurrent     bool
 	maxWorkers     int
@@ -27,11 +29,25 @@ type WebCrawler struct {
 	visitedLock    sync.RWMutex
 	formsLock      sync.RWMutex
 	signaturesLock sync.RWMutex
-	stopCrawl      chan struct{} // Signal to stop crawling
-	apiDetector    *APIDetector  // API endpoint detector
+	assetsLock     sync.Mutex
+	harvested      int32                     // Scripts and stylesheets fetched for the links they hold
+	robotsLinks    map[string]RobotsOverride // Canonical URLs linked against a robots directive
+	freeLinks      map[string]bool           // Canonical URLs linked without one
+	noindex        []RobotsOverride          // Pages asking not to be indexed
+	robotsLock     sync.Mutex
+	stopCrawl      chan struct{}  // Signal to stop crawling
+	stopOnce       sync.Once      // Guards closing stopCrawl
+	idleTimer      *time.Timer    // Stops the crawl after CrawlIdleTimeout without a page visited
+	formTimer      *time.Timer    // Stops the crawl after CrawlFormTimeout without a new form
+	discoveryOnly  bool           // Record forms and API endpoints instead of fuzzing them
+	formBudget     *requestBudget // Requests the forms fuzzed during the crawl share
+	apiDetector    *APIDetector   // API endpoint detector
+	client         *http.Client   // Client backed by the shared transport
+	logger         *slog.Logger
 }
 
-// NewWebCrawler creates a new web crawler
+// NewWebCrawler creates a new web crawler visiting at most maxPages pages
+// (0 = no limit)
 func NewWebCrawler(baseURL string, maxPages int, concurrent bool, config *Config) (*WebCrawler, error) {
 	parsed, err := url.Parse(baseURL)
 	if err != nil {
@@ -47,20 +63,39 @@ func NewWebCrawler(baseURL string, maxPages int, concurrent bool, config *Config
 		}
 	}
 
+	client, err := newDiscoveryClient(config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &WebCrawler{
 		baseURL:        parsed,
-		visited:        make(map[string]bool),
-		forms:          make(map[string][]FormField),
+		visited:        make(map[string]string),
+		forms:          make(map[string][]Form),
 		formSignatures: make(map[string]bool),
+		assets:         make(map[string]bool),
+		robotsLinks:    make(map[string]RobotsOverride),
+		freeLinks:      make(map[string]bool),
 		maxPages:       maxPages,
 		concurrent:     concurrent,
 		maxWorkers:     config.MaxWorkers,
 		config:         config,
 		stopCrawl:      make(chan struct{}),
+		formBudget:     newRequestBudget(config.NumRequests, config.Deadline),
 		apiDetector:    NewAPIDetector(config),
+		client:         client,
+		logger:         logging.For("crawler"),
 	}, nil
 }
 
+// SetDiscoveryOnly makes the crawler record forms and API endpoints without
+// fuzzing anything it finds. Otherwise API endpoints are fuzzed with the
+// crawler's config as soon as they are found when APIFuzzing is set, and
+// forms when CrawlFuzzForms is set.
+func (c *WebCrawler) SetDiscoveryOnly(discoveryOnly bool) {
+	c.discoveryOnly = discoveryOnly
+}
+
 // SetMaxWorkers sets the maximum number of concurrent workers
 func (c *WebCrawler) SetMaxWorkers(workers int) {
 	if workers <= 0 {
@@ -72,125 +107,150 @@ func (c *WebCrawler) SetMaxWorkers(workers int) {
 	c.maxWorkers = workers
 }
 
-// Crawl starts crawling from the base URL
+// Stop ends the crawl; pages being fetched are finished and the forms and
+// endpoints found so far are kept. It is safe to call more than once and
+// from any goroutine.
+func (c *WebCrawler) Stop() {
+	c.stopOnce.Do(func() { close(c.stopCrawl) })
+}
+
+// Crawl starts crawling from the base URL, after probing for API roots and
+// spec documents when APIProbe is set. Besides running out of pages, the
+// crawl stops once MaxPages pages are visited, when Stop is called, and
+// after CrawlIdleTimeout without a page visited or CrawlFormTimeout without
+// a new form, each when set.
 func (c *WebCrawler) Crawl() error {
+	// Pages are fetched in one session, logged in as Config.LoginRequest
+	// says; a dry run sends no login
+	if c.config.DryRun == nil {
+		sessions, err := newSessions(c.config, c.client)
+		if err != nil {
+			return err
+		}
+		c.client = sessions.client()
+	}
+	c.probeAPIs()
+	c.freeLinks[canonicalURL(c.baseURL.String(), c.config.CrawlWildcardParams)] = true
+
+	stopAfter := func(timeout time.Duration, reason string) *time.Timer {
+		if timeout <= 0 {
+			return nil
+		}
+		return time.AfterFunc(timeout, func() {
+			c.logger.Info("stopping crawl", "reason", reason, "after", timeout)
+			c.Stop()
+		})
+	}
+	c.idleTimer = stopAfter(c.config.CrawlIdleTimeout, "no page visited")
+	c.formTimer = stopAfter(c.config.CrawlFormTimeout, "no new form found")
+	for _, timer := range []*time.Timer{c.idleTimer, c.formTimer} {
+		if timer != nil {
+			defer timer.Stop()
+		}
+	}
+
 	if c.concurrent {
 		return c.crawlConcurrent(c.baseURL.String())
 	}
 	return c.crawlSequential(c.baseURL.String())
 }
 
+// progress restarts a stop condition's timer, if it is set, after the crawl
+// made the progress it waits for
+func (c *WebCrawler) progress(timer *time.Timer) {
+	if timer == nil {
+		return
+	}
+	select {
+	case <-c.stopCrawl:
+		// A stopped crawl stays stopped
+	default:
+		switch timer {
+		case c.idleTimer:
+			timer.Reset(c.config.CrawlIdleTimeout)
+		case c.formTimer:
+			timer.Reset(c.config.CrawlFormTimeout)
+		}
+	}
+}
+
 // crawlSequential performs sequential crawling
 func (c *WebCrawler) crawlSequential(startURL string) error {
-	noNewFormsSince := time.Now()
-
 	var crawl func(string) error
 	crawl = func(url string) error {
-		if c.isVisited(url) || !c.isSameHost(url) {
+		if !c.isSameHost(url) || !c.markVisited(url) {
 			return nil
 		}
 
-		c.markVisited(url)
-
 		// Get page content
-		if c.config.Verbose {
-			log.Printf("Crawling URL: %s\n", url)
+		c.logger.Debug("crawling", "url", url)
+		resp, err := c.client.Get(url)
+		if err != nil {
+			c.logger.Error("fetch failed", "url", url, "error", err)
+			return err
 		}
-		resp, err := http.Get(url)
+		// The page is read and its connection given back before anything
+		// else is requested from the host
+		page, err := readLimited(resp.Body, maxBodySize(c.config))
+		resp.Body.Close()
 		if err != nil {
-			log.Printf("Error fetching %s: %v\n", url, err)
+			c.logger.Error("read failed", "url", url, "error", err)
 			return err
 		}
-		defer resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(page.data))
 
 		// Check for security blocks
 		if block, err := DetectSecurityProtection(resp); err != nil {
-			log.Printf("Error checking security protection: %v\n", err)
+			c.logger.Error("security protection check failed", "url", url, "error", err)
 		} else if block != nil {
-			log.Printf("Security protection detected!\nType: %s\nDescription: %s\nEvidence: %s\n",
-				block.Type, block.Description, block.Evidence)
+			c.logger.Warn("security protection detected", "url", url, "type", block.Type,
+				"description", block.Description, "evidence", block.Evidence)
+			c.reportSecurityBlock(url, block)
 			return fmt.Errorf("security protection detected: %s", block.Type)
 		}
 
-		// Check if API fuzzing is enabled
-		if c.config.APIFuzzing {
-			// Check if this is an API endpoint
-			if endpoint, err := c.apiDetector.DetectEndpoint(url, resp); err != nil {
-				if c.config.Verbose {
-					log.Printf("Error detecting API endpoint %s: %v\n", url, err)
-				}
-			} else if endpoint != nil {
-				if c.config.Verbose {
-					log.Printf("Found API endpoint: %s\n", url)
-				}
-				// Fuzz the API endpoint
-				fuzzer := NewAPIFuzzer(endpoint, c.config)
-				if err := fuzzer.Run(); err != nil {
-					log.Printf("Error fuzzing API endpoint %s: %v\n", url, err)
-				}
-
-				// Perform schema inference if enabled
-				if c.config.APISchema {
-					if c.config.Verbose {
-						log.Printf("Inferring schema for API endpoint: %s\n", url)
-					}
-					if err := fuzzer.InferSchema(); err != nil {
-						log.Printf("Error inferring schema for API endpoint %s: %v\n", url, err)
-					}
-				}
-			}
-		}
+		// Check if this is an API endpoint
+		c.detectAPI(url, resp)
 
 		// Parse HTML
-		doc, err := html.Parse(resp.Body)
+		doc, err := html.Parse(bytes.NewReader(page.data))
 		if err != nil {
-			log.Printf("Error parsing HTML from %s: %v\n", url, err)
+			c.logger.Error("HTML parse failed", "url", url, "error", err)
 			return err
 		}
 
-		// Extract and add forms
-		foundNew := false
-
-		// Extract static forms
-		staticForms := c.extractForms(doc)
+		// Extract and add forms, static ones and those scripts render
+		staticForms := c.extractForms(doc, url)
 		if len(staticForms) > 0 {
-			if c.addForms(url, staticForms) {
-				foundNew = true
-			}
+			c.addForms(url, staticForms)
 		}
 
-		// Extract JavaScript forms
 		jsDetector := NewJSFormDetector(url, 10*time.Second)
+		jsDetector.SetHeaders(extraHeaders(c.config))
+		jsDetector.SetResolve(c.config.Resolve)
+		jsDetector.SetInsecure(c.config.InsecureSkipVerify)
 		jsForms, err := jsDetector.DetectForms()
 		if err == nil && len(jsForms) > 0 {
-			if c.addForms(url, jsForms) {
-				foundNew = true
-			}
-		}
-
-		// Update last new form time
-		if foundNew {
-			noNewFormsSince = time.Now()
-		} else if time.Since(noNewFormsSince) > 15*time.Second {
-			if c.config.Verbose {
-				log.Printf("No new forms found for 15 seconds, stopping crawl\n")
-			}
-			select {
-			case <-c.stopCrawl: // Check if already closed
-			default:
-				close(c.stopCrawl)
-			}
-			return nil
+			c.addForms(url, jsForms)
 		}
-
-		// Extract links
-		links := c.extractLinks(doc)
+		c.observeRequests(jsDetector.Requests())
+
+		base := c.documentBase(doc, url)
+		assets := c.addAssets(c.extractAssets(doc, base))
+
+		// Extract links, those in the page's scripts and stylesheets, and the
+		// pages GET forms lead to
+		links := c.extractLinks(doc, base)
+		links = append(links, c.harvestAssets(assets)...)
+		links = append(links, formLinks(staticForms)...)
+		links = append(links, formLinks(jsForms)...)
+		links = c.followable(url, resp, doc, base, links)
 		for _, link := range links {
 			select {
 			case <-c.stopCrawl:
 				return nil
 			default:
-				if len(c.visited) >= c.maxPages {
+				if c.budgetSpent() {
 					return nil
 				}
 				if err := crawl(link); err != nil {
@@ -205,295 +265,394 @@ func (c *WebCrawler) crawlSequential(startURL string) error {
 	return crawl(startURL)
 }
 
-// crawlConcurrent performs concurrent crawling
+// crawlQueueSize bounds the links waiting to be crawled; links found while
+// the queue is full are dropped
+const crawlQueueSize = 10000
+
+// crawlConcurrent crawls with maxWorkers workers taking URLs from a queue.
+// Every URL queued is counted in pending until a worker has processed or
+// skipped it, so the crawl is complete once pending drops to zero: no URL
+// is waiting and no worker can queue more.
 func (c *WebCrawler) crawlConcurrent(startURL string) error {
 	var (
-		wg              sync.WaitGroup
-		noNewFormsSince = time.Now()
-		timeLock        sync.Mutex
-		urlQueue        = make(chan string, 10000)
-		workQueue       = make(chan struct{}, c.maxWorkers) // Limit concurrent work
-		done            = make(chan struct{})               // Signal completion
-		pendingWork     = int32(1)                          // Start with 1 for initial URL
+		workers  sync.WaitGroup
+		pending  sync.WaitGroup
+		urlQueue = make(chan string, crawlQueueSize)
+		done     = make(chan struct{})
 	)
 
-	// Start URL processor workers
+	// enqueue counts a link as pending before queueing it, or drops it when
+	// the queue is full
+	enqueue := func(link string) {
+		pending.Add(1)
+		select {
+		case urlQueue <- link:
+		default:
+			pending.Done()
+		}
+	}
+
 	for i := 0; i < c.maxWorkers; i++ {
-		wg.Add(1)
+		workers.Add(1)
 		go func() {
-			defer wg.Done()
+			defer workers.Done()
 			for {
 				select {
 				case <-c.stopCrawl:
 					return
-				case url, ok := <-urlQueue:
-					if !ok {
-						return
-					}
-
-					workQueue <- struct{}{} // Acquire work slot
-					if !c.isVisited(url) && c.isSameHost(url) {
-						c.markVisited(url)
-						c.processURL(url, urlQueue, &noNewFormsSince, &timeLock, &pendingWork)
-					} else {
-						atomic.AddInt32(&pendingWork, -1) // Decrement pending work
+				case <-done:
+					return
+				case url := <-urlQueue:
+					if c.isSameHost(url) && c.markVisited(url) {
+						c.processURL(url, enqueue)
 					}
-					<-workQueue // Release work slot
+					pending.Done()
 				}
 			}
 		}()
 	}
 
-	// Monitor completion
+	enqueue(startURL)
 	go func() {
-		for {
-			if atomic.LoadInt32(&pendingWork) == 0 {
-				select {
-				case <-c.stopCrawl:
-					return
-				default:
-					close(c.stopCrawl)
-					close(done)
-					return
-				}
-			}
-			time.Sleep(100 * time.Millisecond)
-		}
+		pending.Wait()
+		close(done)
 	}()
 
-	// Add initial URL
-	urlQueue <- startURL
-
-	// Wait for completion or stop signal
 	select {
 	case <-done:
 	case <-c.stopCrawl:
 	}
-
-	// Cleanup
-	close(urlQueue)
-	wg.Wait()
-
-	return nil
+	c.Stop()
+
+	// Once the workers have returned nothing queues links any more, so the
+	// links left over can be counted off, which lets the waiter above return
+	workers.Wait()
+	for {
+		select {
+		case <-urlQueue:
+			pending.Done()
+		default:
+			<-done
+			return nil
+		}
+	}
 }
 
-// processURL processes a single URL, extracting forms and links
-func (c *WebCrawler) processURL(url string, urlQueue chan<- string, noNewFormsSince *time.Time, timeLock *sync.Mutex, pendingWork *int32) {
+// processURL processes a single URL, extracting forms and queueing links
+// with enqueue
+func (c *WebCrawler) processURL(url string, enqueue func(string)) {
+	defer c.progress(c.idleTimer) // A page taking long to process is no idle time
 	// Get page content
-	resp, err := http.Get(url)
+	c.logger.Debug("crawling", "url", url)
+	resp, err := c.client.Get(url)
 	if err != nil {
-		if c.config.Verbose {
-			log.Printf("Error fetching %s: %v\n", url, err)
-		}
+		c.logger.Debug("fetch failed", "url", url, "error", err)
 		return
 	}
-	defer resp.Body.Close()
-
-	// Check if API fuzzing is enabled
-	if c.config.APIFuzzing {
-		if endpoint, err := c.apiDetector.DetectEndpoint(url, resp); err != nil {
-			if c.config.Verbose {
-				log.Printf("Error detecting API endpoint %s: %v\n", url, err)
-			}
-		} else if endpoint != nil {
-			if c.config.Verbose {
-				log.Printf("Found API endpoint: %s\n", url)
-			}
-			fuzzer := NewAPIFuzzer(endpoint, c.config)
-			if err := fuzzer.Run(); err != nil {
-				log.Printf("Error fuzzing API endpoint %s: %v\n", url, err)
-			}
-			if c.config.APISchema {
-				if err := fuzzer.InferSchema(); err != nil {
-					log.Printf("Error inferring schema for API endpoint %s: %v\n", url, err)
-				}
-			}
-		}
+	// The page is read and its connection given back before anything else
+	// is requested from the host
+	page, err := readLimited(resp.Body, maxBodySize(c.config))
+	resp.Body.Close()
+	if err != nil {
+		return
 	}
+	resp.Body = io.NopCloser(bytes.NewReader(page.data))
+
+	// Check if this is an API endpoint
+	c.detectAPI(url, resp)
+	c.observeURL(url)
 
 	// Check for security blocks
 	if block, err := DetectSecurityProtection(resp); err != nil {
-		if c.config.Verbose {
-			log.Printf("Error checking security protection: %v\n", err)
-		}
+		c.logger.Debug("security protection check failed", "url", url, "error", err)
 	} else if block != nil {
-		if c.config.Verbose {
-			log.Printf("Security protection detected!\nType: %s\nDescription: %s\nEvidence: %s\n",
-				block.Type, block.Description, block.Evidence)
-		}
+		c.logger.Warn("security protection detected", "url", url, "type", block.Type,
+			"description", block.Description, "evidence", block.Evidence)
+		c.reportSecurityBlock(url, block)
 		return
 	}
 
+	for _, finding := range c.config.Leaks.Scan(resp.Request, page.data, "") {
+		captureExchange(finding, resp.Request, nil, resp, page.data)
+		c.config.Findings.Add(finding)
+	}
+
 	// Parse HTML
-	doc, err := html.Parse(resp.Body)
+	doc, err := html.Parse(bytes.NewReader(page.data))
 	if err != nil {
 		return
 	}
 
-	// Extract and add forms
-	foundNew := false
-
-	staticForms := c.extractForms(doc)
-	if len(staticForms) > 0 && c.addForms(url, staticForms) {
-		foundNew = true
+	// Extract and add forms, static ones and those scripts render
+	staticForms := c.extractForms(doc, url)
+	if len(staticForms) > 0 {
+		c.addForms(url, staticForms)
 	}
 
 	jsDetector := NewJSFormDetector(url, 10*time.Second)
-	if jsForms, err := jsDetector.DetectForms(); err == nil && len(jsForms) > 0 {
-		if c.addForms(url, jsForms) {
-			foundNew = true
-			if c.config.Verbose {
-				log.Printf("Found new unique form at %s with %d fields\n", url, len(jsForms))
-			}
+	jsDetector.SetHeaders(extraHeaders(c.config))
+	jsDetector.SetResolve(c.config.Resolve)
+	jsDetector.SetInsecure(c.config.InsecureSkipVerify)
+	jsForms, err := jsDetector.DetectForms()
+	if err == nil && len(jsForms) > 0 {
+		c.addForms(url, jsForms)
+	}
+	c.observeRequests(jsDetector.Requests())
+
+	base := c.documentBase(doc, url)
+	assets := c.addAssets(c.extractAssets(doc, base))
+
+	// Queue new links, those in the page's scripts and stylesheets, and the
+	// pages GET forms lead to
+	links := c.extractLinks(doc, base)
+	links = append(links, c.harvestAssets(assets)...)
+	links = append(links, formLinks(staticForms)...)
+	links = append(links, formLinks(jsForms)...)
+	links = c.followable(url, resp, doc, base, links)
+	for _, link := range links {
+		if c.budgetSpent() {
+			return
 		}
+		enqueue(link)
 	}
+}
 
-	// Update last new form time
-	if foundNew {
-		timeLock.Lock()
-		*noNewFormsSince = time.Now()
-		timeLock.Unlock()
-	} else {
-		timeLock.Lock()
-		elapsed := time.Since(*noNewFormsSince)
-		timeLock.Unlock()
-		if elapsed > 15*time.Second {
-			if c.config.Verbose {
-				log.Printf("No new forms found for 15 seconds, stopping crawl\n")
-			}
-			select {
-			case <-c.stopCrawl:
-			default:
-				close(c.stopCrawl)
+// detectAPI checks whether a page is an API endpoint, or an API spec or a
+// page rendering one, whose operations are then the endpoints. Endpoints are
+// fuzzed as soon as they are found, unless the crawl is for discovery only.
+func (c *WebCrawler) detectAPI(url string, resp *http.Response) {
+	if !c.config.APIFuzzing && !c.discoveryOnly {
+		return
+	}
+
+	if endpoints, ok := c.apiDetector.DetectSpec(c.client, url, resp); ok {
+		c.logger.Info("found API spec endpoints", "url", url, "endpoints", len(endpoints))
+		if !c.discoveryOnly {
+			for _, endpoint := range endpoints {
+				c.fuzzAPI(endpoint)
 			}
-			return
 		}
+		return
 	}
 
-	// Add new links to queue and update pending work count
-	links := c.extractLinks(doc)
-	if len(links) > 0 {
-		atomic.AddInt32(pendingWork, int32(len(links))) // Add new work
-		for _, link := range links {
-			if len(c.visited) >= c.maxPages {
-				close(c.stopCrawl)
-				return
-			}
-			select {
-			case urlQueue <- link:
-			default:
-				atomic.AddInt32(pendingWork, -1) // Decrement if we couldn't queue
-			}
+	endpoint, err := c.apiDetector.DetectEndpoint(url, resp)
+	if err != nil {
+		c.logger.Debug("API endpoint detection failed", "url", url, "error", err)
+		return
+	}
+	if endpoint == nil {
+		return
+	}
+	c.logger.Info("found API endpoint", "url", url)
+	c.foundAPI(endpoint)
+}
+
+// observeRequests records the requests a page's scripts sent with the API
+// detector, so API endpoints are known with the methods pages use
+func (c *WebCrawler) observeRequests(requests []JSRequest) {
+	if !c.config.APIFuzzing && !c.discoveryOnly {
+		return
+	}
+	for _, request := range requests {
+		if !c.isSameHost(request.URL) {
+			continue
+		}
+		if endpoint := c.apiDetector.Observe(request.Method, request.URL); endpoint != nil {
+			c.logger.Info("found API endpoint", "url", endpoint.URL, "method", endpoint.Method)
+			c.foundAPI(endpoint)
 		}
 	}
-	atomic.AddInt32(pendingWork, -1) // Current URL is done
 }
 
-// addForms adds forms for a URL if they are unique
-func (c *WebCrawler) addForms(url string, forms []FormField) bool {
-	if len(forms) == 0 {
-		return false
+// foundAPI asks a new endpoint which other methods it supports and, unless
+// the crawl is for discovery only, fuzzes it with each of them
+func (c *WebCrawler) foundAPI(endpoint *APIEndpoint) {
+	endpoints := append([]*APIEndpoint{endpoint}, c.apiDetector.ProbeMethods(c.client, endpoint)...)
+	if c.discoveryOnly {
+		return
+	}
+	for _, endpoint := range endpoints {
+		c.fuzzAPI(endpoint)
+	}
+}
+
+// probeAPIs requests the common API roots and spec documents on the
+// target's host, when APIProbe is set, and fuzzes the endpoints found unless
+// the crawl is for discovery only
+func (c *WebCrawler) probeAPIs() {
+	if !c.config.APIProbe || (!c.config.APIFuzzing && !c.discoveryOnly) {
+		return
+	}
+	endpoints := c.apiDetector.Probe(c.client, c.baseURL.String())
+	c.logger.Info("API probe complete", "endpoints", len(endpoints))
+	if c.discoveryOnly {
+		return
+	}
+	for _, endpoint := range endpoints {
+		c.fuzzAPI(endpoint)
+	}
+}
+
+// fuzzAPI fuzzes an API endpoint with the crawler's config
+func (c *WebCrawler) fuzzAPI(endpoint *APIEndpoint) {
+	// Infer the schema first so fuzzing can generate bodies from it
+	fuzzer := NewAPIFuzzer(endpoint, c.config)
+	if c.config.APISchema {
+		if err := fuzzer.InferSchema(); err != nil {
+			c.logger.Error("schema inference failed", "url", endpoint.URL, "error", err)
+		}
+	}
+	if err := fuzzer.Run(); err != nil {
+		c.logger.Error("API fuzzing failed", "url", endpoint.URL, "error", err)
 	}
+}
 
-	// Generate signature for these forms
-	signature := c.generateFormSignature(forms)
+// reportSecurityBlock records a detected security protection as a finding
+func (c *WebCrawler) reportSecurityBlock(url string, block *SecurityBlock) {
+	c.config.Findings.Add(&Finding{
+		Type:       "security-protection",
+		Severity:   SeverityInfo,
+		Confidence: ConfidenceFirm,
+		URL:        url,
+		Method:     http.MethodGet,
+		Parameter:  block.Type,
+		Evidence:   block.Description + ": " + block.Evidence,
+	})
+}
 
-	// Check if we've seen this form signature before
+// addForms records the forms found on a page that were not seen before,
+// on this or another page, and reports whether there were any
+func (c *WebCrawler) addForms(url string, forms []Form) bool {
+	var fresh []Form
 	c.signaturesLock.Lock()
-	seen := c.formSignatures[signature]
-	if !seen {
-		c.formSignatures[signature] = true
+	for _, form := range forms {
+		if len(form.Fields) == 0 {
+			continue
+		}
+		signature := form.signature()
+		if !c.formSignatures[signature] {
+			c.formSignatures[signature] = true
+			fresh = append(fresh, form)
+		}
 	}
 	c.signaturesLock.Unlock()
 
-	if seen {
+	if len(fresh) == 0 {
 		return false
 	}
+	c.progress(c.formTimer)
 
 	c.formsLock.Lock()
-	c.forms[url] = forms
+	c.forms[url] = append(c.forms[url], fresh...)
 	c.formsLock.Unlock()
 
-	if c.config.Verbose {
-		log.Printf("Found new unique form at %s with %d fields\n", url, len(forms))
+	for _, form := range fresh {
+		c.logger.Info("found new unique form", "url", url, "action", form.Action, "method", form.Method,
+			"fields", len(form.Fields))
+		if !c.discoveryOnly && c.config.CrawlFuzzForms {
+			c.fuzzForm(url, form)
+		}
 	}
-
 	return true
 }
 
-// generateFormSignature creates a unique signature for a set of form fields
-func (c *WebCrawler) generateFormSignature(forms []FormField) string {
-	var fields []string
-	for _, form := range forms {
-		fields = append(fields, fmt.Sprintf("%s:%s:%v:%s",
-			form.Name, form.Type, form.Required, form.Pattern))
+// fuzzForm fuzzes a form as soon as it is found, as API endpoints are, with
+// its findings attributed to the page it is on. All forms draw from one
+// budget of NumRequests requests, so forms found once it is spent are only
+// recorded.
+func (c *WebCrawler) fuzzForm(url string, form Form) {
+	if c.formBudget.exhausted() {
+		return
+	}
+	config := *c.config
+	config.Findings = config.Findings.WithSource(url)
+	fuzzer, err := newFormFuzzer(url, form, &config)
+	if err != nil {
+		c.logger.Error("form fuzzer creation failed", "url", url, "error", err)
+		return
+	}
+	fuzzer.budget = c.formBudget
+	if err := fuzzer.Run(); err != nil {
+		c.logger.Error("form fuzzing failed", "url", url, "error", err)
 	}
-	sort.Strings(fields) // Sort for consistent ordering
-	return strings.Join(fields, "|")
 }
 
-// extractForms extracts forms from HTML
-func (c *WebCrawler) extractForms(node *html.Node) []FormField {
-	var forms []FormField
-
-	var extract func(*html.Node)
-	extract = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "form" {
-			// Extract form fields
-			var fields []FormField
-			var extractFields func(*html.Node)
-			extractFields = func(node *html.Node) {
-				if node.Type == html.ElementNode {
-					switch node.Data {
-					case "input", "select", "textarea":
-						field := FormField{}
-						for _, attr := range node.Attr {
-							switch attr.Key {
-							case "name":
-								field.Name = attr.Val
-							case "type":
-								field.Type = attr.Val
-							case "required":
-								field.Required = true
-							case "pattern":
-								field.Pattern = attr.Val
-							}
-						}
-						if field.Name != "" {
-							fields = append(fields, field)
-						}
-					}
-				}
-				for c := node.FirstChild; c != nil; c = c.NextSibling {
-					extractFields(c)
-				}
-			}
-			extractFields(n)
-			forms = append(forms, fields...)
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			extract(c)
+// extractForms extracts the forms of a page, learning the formats of the
+// values it fills in
+func (c *WebCrawler) extractForms(node *html.Node, pageURL string) []Form {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	forms := parseForms(node, page)
+	for _, form := range forms {
+		for _, field := range form.Fields {
+			// Prefilled values are samples of the field's format
+			c.config.Learner.Observe(field.Name, field.Value)
 		}
 	}
-	extract(node)
-
 	return forms
 }
 
-// extractLinks extracts links from HTML
-func (c *WebCrawler) extractLinks(node *html.Node) []string {
+// observeURL learns the values in a page's URL: its query parameters, and
+// the IDs, slugs and tokens in its path
+func (c *WebCrawler) observeURL(pageURL string) {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	for name, values := range page.Query() {
+		for _, value := range values {
+			c.config.Learner.Observe(name, value)
+		}
+	}
+	for _, segment := range strings.Split(page.Path, "/") {
+		c.config.Learner.ObserveValue(segment)
+	}
+}
+
+// formNavigationURLs bounds the pages followed from one GET form
+const formNavigationURLs = 10
+
+// formLinks returns the pages the GET forms among forms lead to, submitted
+// with benign values
+func formLinks(forms []Form) []string {
 	var links []string
+	for _, form := range forms {
+		links = append(links, form.navigationURLs(formNavigationURLs)...)
+	}
+	return links
+}
+
+// assetSources maps the elements referencing static assets to the attribute
+// holding the reference
+var assetSources = map[string]string{
+	"script": "src",
+	"link":   "href",
+	"img":    "src",
+	"source": "src",
+	"video":  "src",
+	"audio":  "src",
+	"embed":  "src",
+	"object": "data",
+}
+
+// extractAssets extracts the static assets a page references, resolved
+// against base: scripts, stylesheets, icons, images and media
+func (c *WebCrawler) extractAssets(node *html.Node, base *url.URL) []string {
+	var assets []string
 
 	var extract func(*html.Node)
 	extract = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					link := c.resolveURL(attr.Val)
-					if link != "" {
-						links = append(links, link)
+		if n.Type == html.ElementNode {
+			if key, ok := assetSources[n.Data]; ok {
+				for _, attr := range n.Attr {
+					if attr.Key == key && attr.Val != "" {
+						if asset := c.resolveURL(base, attr.Val); asset != "" {
+							assets = append(assets, asset)
+						}
+						break
 					}
-					break
 				}
 			}
 		}
@@ -503,16 +662,37 @@ func (c *WebCrawler) extractLinks(node *html.Node) []string {
 	}
 	extract(node)
 
-	return links
+	return assets
+}
+
+// addAssets records static assets referenced by a crawled page and returns
+// those not recorded before
+func (c *WebCrawler) addAssets(assets []string) []string {
+	c.assetsLock.Lock()
+	defer c.assetsLock.Unlock()
+	var fresh []string
+	for _, asset := range assets {
+		if !c.assets[asset] {
+			c.assets[asset] = true
+			fresh = append(fresh, asset)
+		}
+	}
+	return fresh
 }
 
-// resolveURL resolves a URL relative to the base URL
-func (c *WebCrawler) resolveURL(href string) string {
-	relative, err := url.Parse(href)
+// resolveURL resolves a URL relative to base, the URL of the document it is
+// in. Absolute links to the virtual host set with a Host header point at the
+// base URL's host, which serves it.
+func (c *WebCrawler) resolveURL(base *url.URL, href string) string {
+	relative, err := url.Parse(strings.TrimSpace(href))
 	if err != nil {
 		return ""
 	}
-	absolute := c.baseURL.ResolveReference(relative)
+	absolute := base.ResolveReference(relative)
+	if vhost := c.config.Headers["Host"]; vhost != "" && strings.EqualFold(absolute.Host, vhost) {
+		absolute.Scheme = c.baseURL.Scheme
+		absolute.Host = c.baseURL.Host
+	}
 	return absolute.String()
 }
 
@@ -522,42 +702,68 @@ func (c *WebCrawler) isSameHost(urlStr string) bool {
 	if err != nil {
 		return false
 	}
-	return parsed.Host == c.baseURL.Host
-}
-
-// isVisited checks if a URL has been visited
-func (c *WebCrawler) isVisited(url string) bool {
-	c.visitedLock.RLock()
-	defer c.visitedLock.RUnlock()
-	return c.visited[url]
+	return canonicalHost(parsed) == canonicalHost(c.baseURL)
 }
 
-// markVisited marks a URL as visited
-func (c *WebCrawler) markVisited(url string) {
+// markVisited marks a URL as visited, reporting false when it or another
+// URL with the same canonical form was visited already, or maxPages pages
+// were. Checking and marking at once keeps two workers from fetching the
+// same page or going over the budget.
+func (c *WebCrawler) markVisited(url string) bool {
+	key := canonicalURL(url, c.config.CrawlWildcardParams)
 	c.visitedLock.Lock()
 	defer c.visitedLock.Unlock()
-	c.visited[url] = true
+	if _, ok := c.visited[key]; ok {
+		return false
+	}
+	if c.maxPages > 0 && len(c.visited) >= c.maxPages {
+		return false
+	}
+	c.visited[key] = url
+	c.progress(c.idleTimer)
+	return true
+}
+
+// budgetSpent reports whether maxPages pages have been visited
+func (c *WebCrawler) budgetSpent() bool {
+	c.visitedLock.RLock()
+	defer c.visitedLock.RUnlock()
+	return c.maxPages > 0 && len(c.visited) >= c.maxPages
 }
 
-// GetForms returns all discovered forms
-func (c *WebCrawler) GetForms() map[string][]FormField {
+// GetForms returns all discovered forms by the page they are on
+func (c *WebCrawler) GetForms() map[string][]Form {
 	c.formsLock.RLock()
 	defer c.formsLock.RUnlock()
 
-	forms := make(map[string][]FormField)
-	for url, fields := range c.forms {
-		forms[url] = fields
+	forms := make(map[string][]Form)
+	for url, pageForms := range c.forms {
+		forms[url] = append([]Form(nil), pageForms...)
 	}
 	return forms
 }
 
-// GetVisitedURLs returns all visited URLs
+// GetAPIEndpoints returns a snapshot of the API endpoints detected while
+// crawling, sorted by URL and method
+func (c *WebCrawler) GetAPIEndpoints() []*APIEndpoint {
+	return c.apiDetector.Endpoints()
+}
+
+// GetAssets returns the static assets referenced by crawled pages, sorted
+func (c *WebCrawler) GetAssets() []string {
+	c.assetsLock.Lock()
+	defer c.assetsLock.Unlock()
+	return sortedKeys(c.assets)
+}
+
+// GetVisitedURLs returns all visited URLs, as fetched: one for each
+// canonical URL
 func (c *WebCrawler) GetVisitedURLs() []string {
 	c.visitedLock.RLock()
 	defer c.visitedLock.RUnlock()
 
 	var urls []string
-	for url := range c.visited {
+	for _, url := range c.visited {
 		urls = append(urls, url)
 	}
 	return urls
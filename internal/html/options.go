@@ -0,0 +1,60 @@
+package html
+
+import (
+	"strconv"
+)
+
+// optionPayloads are injection payloads sent in place of an option, which
+// servers trusting the browser to submit a listed one may use unchecked
+var optionPayloads = []string{
+	"'",
+	"' OR '1'='1",
+	"1 OR 1=1",
+	`"><script>alert(1)</script>`,
+	"../../../../etc/passwd",
+}
+
+// InvalidOptions returns values outside the options of a select, radio or
+// checkbox group: an empty value, values next to numeric options or
+// resembling the listed ones, and injection payloads. A server should refuse
+// each, as no browser submits them.
+func InvalidOptions(options []string) []string {
+	listed := make(map[string]bool, len(options))
+	for _, option := range options {
+		listed[option] = true
+	}
+
+	candidates := []string{""}
+	lowest, highest, numeric := 0, 0, len(options) > 0
+	for i, option := range options {
+		n, err := strconv.Atoi(option)
+		if err != nil {
+			numeric = false
+			break
+		}
+		if i == 0 || n < lowest {
+			lowest = n
+		}
+		if i == 0 || n > highest {
+			highest = n
+		}
+	}
+	if numeric {
+		candidates = append(candidates, strconv.Itoa(lowest-1), strconv.Itoa(highest+1), "2147483648")
+	} else {
+		if len(options) > 0 {
+			candidates = append(candidates, options[0]+"x")
+		}
+		candidates = append(candidates, "nonexistent")
+	}
+	candidates = append(candidates, optionPayloads...)
+
+	var invalid []string
+	for _, candidate := range candidates {
+		if !listed[candidate] {
+			listed[candidate] = true
+			invalid = append(invalid, candidate)
+		}
+	}
+	return invalid
+}
@@ -2,17 +2,41 @@ package html
 
 import (
 	"fmt"
-	"regexp"
+	"net/url"
+	"strconv"
 	"strings"
+
+	nethtml "golang.org/x/net/html"
 )
 
+// maxBoundedText is the longest maxlength whose values are derived at full
+// length; longer limits keep the unbounded text rule
+const maxBoundedText = 256
+
 // FormField represents an HTML form field
 type FormField struct {
-	Name     string
-	Type     string
-	Pattern  string
-	Required bool
-	Options  []string // For select/datalist elements
+	Name      string
+	Type      string
+	Pattern   string
+	Required  bool
+	Options   []string // Values of select options, radio and checkbox groups and datalist suggestions
+	Value     string   // Value the page fills in or checks
+	Min       string   // min attribute
+	Max       string   // max attribute
+	Step      string   // step attribute, "any" for no step
+	MinLength int      // minlength attribute, 0 for none
+	MaxLength int      // maxlength attribute, 0 for none
+}
+
+// Bounds returns the numeric and length bounds of the field's values
+func (f FormField) Bounds() Bounds {
+	return FieldBounds(f.Type, f.Min, f.Max, f.Step, f.MinLength, f.MaxLength)
+}
+
+// Constrained reports whether the field limits its values beyond its type:
+// a set of options or suggestions, numeric bounds or a maximum length
+func (f FormField) Constrained() bool {
+	return len(f.Options) > 0 || f.Bounds().Numeric() || f.MinLength > 0 || f.MaxLength > 0
 }
 
 // Form represents an HTML form
@@ -23,86 +47,235 @@ type Form struct {
 	Patterns map[string]string
 }
 
-// ParseForm extracts form information from HTML content
+// ParseForm extracts form information from HTML content. Of several forms
+// the one with the most fields is taken; a page without form elements
+// yields the fields anywhere in it.
 func ParseForm(html string) (*Form, error) {
-	form := &Form{
-		Fields:   make(map[string]FormField),
-		Patterns: make(map[string]string),
+	doc, err := nethtml.Parse(strings.NewReader(html))
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract form action
-	actionRe := regexp.MustCompile(`<form[^>]+action="([^"]+)"`)
-	if matches := actionRe.FindStringSubmatch(html); len(matches) > 1 {
-		form.Action = matches[1]
+	datalists := make(map[string][]string)
+	var forms []*nethtml.Node
+	var walk func(*nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode {
+			switch n.Data {
+			case "form":
+				forms = append(forms, n)
+			case "datalist":
+				if id := attr(n, "id"); id != "" {
+					datalists[id] = optionValues(n)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	form := &Form{Method: "GET"}
+	root := doc
+	best := -1
+	for _, n := range forms {
+		if fields := parseFields(n, datalists); len(fields) > best {
+			best, root = len(fields), n
+		}
+	}
+	if root != doc {
+		form.Action = attr(root, "action")
+		if method := attr(root, "method"); method != "" {
+			form.Method = strings.ToUpper(method)
+		}
 	}
+	form.Fields = parseFields(root, datalists)
+	form.Patterns = make(map[string]string)
+	for name, field := range form.Fields {
+		if field.Pattern != "" {
+			form.Patterns[name] = field.Pattern
+		}
+	}
+	return form, nil
+}
 
-	// Extract form method
-	methodRe := regexp.MustCompile(`<form[^>]+method="([^"]+)"`)
-	if matches := methodRe.FindStringSubmatch(html); len(matches) > 1 {
-		form.Method = strings.ToUpper(matches[1])
-	} else {
-		form.Method = "GET" // Default method
+// parseFields collects the named fields under n. Radio buttons and
+// checkboxes sharing a name become one field whose options are their values,
+// and fields with a list attribute take the options of that datalist.
+func parseFields(n *nethtml.Node, datalists map[string][]string) map[string]FormField {
+	fields := make(map[string]FormField)
+	var walk func(*nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode {
+			switch n.Data {
+			case "input", "select", "textarea":
+				if field, ok := parseField(n, datalists); ok {
+					addField(fields, field, n)
+				}
+				if n.Data != "input" {
+					return // Options and text are read by parseField
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
 	}
+	walk(n)
+	return fields
+}
 
-	// Extract input fields
-	inputRe := regexp.MustCompile(`<input[^>]+>`)
-	inputs := inputRe.FindAllString(html, -1)
-	for _, input := range inputs {
-		field := FormField{}
+// addField adds a field, merging radio buttons and checkboxes into the group
+// of their name
+func addField(fields map[string]FormField, field FormField, n *nethtml.Node) {
+	if field.Type != "radio" && field.Type != "checkbox" {
+		fields[field.Name] = field
+		return
+	}
+	value := attr(n, "value")
+	if value == "" {
+		value = "on" // What browsers submit for a checked box without a value
+	}
+	group, ok := fields[field.Name]
+	if !ok || group.Type != field.Type {
+		group = field
+		group.Options, group.Value = nil, ""
+	}
+	group.Options = append(group.Options, value)
+	group.Required = group.Required || field.Required
+	if hasAttr(n, "checked") && group.Value == "" {
+		group.Value = value
+	}
+	fields[field.Name] = group
+}
 
-		// Extract name
-		nameRe := regexp.MustCompile(`name="([^"]+)"`)
-		if matches := nameRe.FindStringSubmatch(input); len(matches) > 1 {
-			field.Name = matches[1]
-		} else {
-			continue // Skip fields without name
+// parseField reads a named input, select or textarea element
+func parseField(n *nethtml.Node, datalists map[string][]string) (FormField, bool) {
+	field := FormField{
+		Name:     attr(n, "name"),
+		Type:     strings.ToLower(attr(n, "type")),
+		Pattern:  attr(n, "pattern"),
+		Required: hasAttr(n, "required"),
+		Value:    attr(n, "value"),
+		Min:      attr(n, "min"),
+		Max:      attr(n, "max"),
+		Step:     attr(n, "step"),
+	}
+	if field.Name == "" {
+		return field, false
+	}
+	if minLength, err := strconv.Atoi(attr(n, "minlength")); err == nil && minLength > 0 {
+		field.MinLength = minLength
+	}
+	if maxLength, err := strconv.Atoi(attr(n, "maxlength")); err == nil && maxLength > 0 {
+		field.MaxLength = maxLength
+	}
+	switch n.Data {
+	case "select":
+		field.Type = "select"
+		field.Options = optionValues(n)
+		field.Value = ""
+		for _, option := range options(n) {
+			if hasAttr(option, "selected") {
+				field.Value = optionValue(option)
+				break
+			}
 		}
-
-		// Extract type
-		typeRe := regexp.MustCompile(`type="([^"]+)"`)
-		if matches := typeRe.FindStringSubmatch(input); len(matches) > 1 {
-			field.Type = matches[1]
-		} else {
-			field.Type = "text" // Default type
+	case "textarea":
+		field.Type = "textarea"
+		field.Value = text(n)
+	default:
+		if field.Type == "" {
+			field.Type = "text"
 		}
-
-		// Extract pattern
-		patternRe := regexp.MustCompile(`pattern="([^"]+)"`)
-		if matches := patternRe.FindStringSubmatch(input); len(matches) > 1 {
-			field.Pattern = matches[1]
-			form.Patterns[field.Name] = field.Pattern
+		if list := attr(n, "list"); list != "" {
+			field.Options = datalists[list]
 		}
+	}
+	return field, true
+}
 
-		// Check if required
-		field.Required = strings.Contains(input, "required")
+// options returns the option elements under n, including those in optgroups
+func options(n *nethtml.Node) []*nethtml.Node {
+	var found []*nethtml.Node
+	var walk func(*nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode && n.Data == "option" {
+			found = append(found, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
 
-		form.Fields[field.Name] = field
+// optionValues returns the values of the option elements under n
+func optionValues(n *nethtml.Node) []string {
+	var values []string
+	for _, option := range options(n) {
+		if hasAttr(option, "disabled") {
+			continue
+		}
+		values = append(values, optionValue(option))
 	}
+	return values
+}
 
-	// Extract select fields
-	selectRe := regexp.MustCompile(`<select[^>]+name="([^"]+)"[^>]*>(.*?)</select>`)
-	selects := selectRe.FindAllStringSubmatch(html, -1)
-	for _, sel := range selects {
-		name := sel[1]
-		content := sel[2]
+// optionValue returns what an option submits: its value attribute, else its
+// text with whitespace collapsed
+func optionValue(option *nethtml.Node) string {
+	for _, a := range option.Attr {
+		if a.Key == "value" {
+			return a.Val
+		}
+	}
+	return strings.Join(strings.Fields(text(option)), " ")
+}
 
-		field := FormField{
-			Name:    name,
-			Type:    "select",
-			Options: make([]string, 0),
+// text returns the text content of n
+func text(n *nethtml.Node) string {
+	var b strings.Builder
+	var walk func(*nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.TextNode {
+			b.WriteString(n.Data)
 		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
 
-		// Extract options
-		optionRe := regexp.MustCompile(`<option[^>]+value="([^"]+)"`)
-		options := optionRe.FindAllStringSubmatch(content, -1)
-		for _, opt := range options {
-			field.Options = append(field.Options, opt[1])
+// attr returns the value of an element's attribute, or ""
+func attr(n *nethtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
 		}
+	}
+	return ""
+}
 
-		form.Fields[name] = field
+// hasAttr reports whether an element has an attribute, with or without a value
+func hasAttr(n *nethtml.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
 	}
+	return false
+}
 
-	return form, nil
+// ValueSymbol returns the symbol GenerateGrammar derives a field's values
+// from, without its name
+func ValueSymbol(name string) string {
+	return fmt.Sprintf("<value-%s>", name)
 }
 
 // GenerateGrammar creates a grammar for fuzzing based on the form fields
@@ -122,21 +295,33 @@ func (f *Form) GenerateGrammar() map[string][]string {
 	var queryParts []string
 	for name, field := range f.Fields {
 		fieldSymbol := fmt.Sprintf("<%s>", name)
+		valueSymbol := ValueSymbol(name)
 		queryParts = append(queryParts, fieldSymbol)
+		grammar[fieldSymbol] = []string{fmt.Sprintf("%s=%s", name, valueSymbol)}
 
 		switch field.Type {
-		case "select":
-			// Direct values for select fields
-			grammar[fieldSymbol] = []string{
-				fmt.Sprintf("%s=<value-%s>", name, name),
+		case "select", "radio", "checkbox":
+			options := field.Options
+			if len(options) == 0 && field.Type == "checkbox" {
+				options = []string{"on"}
+			}
+			// Direct values for fields with a set of options, and values
+			// outside the set no browser would submit
+			for _, option := range options {
+				grammar[valueSymbol] = append(grammar[valueSymbol], url.QueryEscape(option))
 			}
-			valueSymbol := fmt.Sprintf("<value-%s>", name)
-			grammar[valueSymbol] = field.Options
+			invalidSymbol := InvalidSymbol(valueSymbol)
+			for _, option := range InvalidOptions(options) {
+				grammar[invalidSymbol] = append(grammar[invalidSymbol], url.QueryEscape(option))
+			}
+			grammar[valueSymbol] = append(grammar[valueSymbol], invalidSymbol)
 
-		case "number":
-			grammar[fieldSymbol] = []string{
-				fmt.Sprintf("%s=<number>", name),
+		case "number", "range":
+			if values := field.Bounds().InRange(); len(values) > 0 {
+				grammar[valueSymbol] = values
+				continue
 			}
+			grammar[valueSymbol] = []string{"<number>"}
 			if _, exists := grammar["<number>"]; !exists {
 				grammar["<number>"] = []string{
 					"<digit>",
@@ -148,34 +333,40 @@ func (f *Form) GenerateGrammar() map[string][]string {
 			}
 
 		case "email":
-			grammar[fieldSymbol] = []string{
-				fmt.Sprintf("%s=<email>", name),
-			}
+			grammar[valueSymbol] = []string{"<email>"}
 			if _, exists := grammar["<email>"]; !exists {
 				grammar["<email>"] = []string{
 					"<string>@<string>.<string>",
 				}
 			}
 
-		case "checkbox":
-			grammar[fieldSymbol] = []string{
-				fmt.Sprintf("%s=<checkbox>", name),
-			}
-			if _, exists := grammar["<checkbox>"]; !exists {
-				grammar["<checkbox>"] = []string{"on", "off"}
-			}
-
 		default:
 			// Text fields and others
-			grammar[fieldSymbol] = []string{
-				fmt.Sprintf("%s=<text>", name),
+			grammar[valueSymbol] = []string{"<text>"}
+			if lengths := field.Bounds().InLength(); len(lengths) > 0 && lengths[len(lengths)-1] <= maxBoundedText {
+				// Shortest, middle and longest values allowed
+				grammar[valueSymbol] = nil
+				for _, length := range lengths {
+					grammar[valueSymbol] = append(grammar[valueSymbol], strings.Repeat("<char>", length))
+				}
+			}
+			// Datalist suggestions are values the application expects
+			for _, option := range field.Options {
+				grammar[valueSymbol] = append(grammar[valueSymbol], url.QueryEscape(option))
 			}
 			if pattern, exists := f.Patterns[name]; exists {
-				// Convert HTML5 pattern to grammar rules
-				grammar[fieldSymbol] = []string{
-					fmt.Sprintf("%s=<pattern-%s>", name, name),
+				// Derive values from the HTML5 pattern, both matching and
+				// just outside its boundaries; unparseable patterns keep <text>
+				patternSymbol := fmt.Sprintf("<pattern-%s>", name)
+				if rules, err := PatternGrammar(patternSymbol, pattern); err == nil {
+					for symbol, alternatives := range rules {
+						grammar[symbol] = alternatives
+					}
+					grammar[valueSymbol] = []string{patternSymbol}
+					if _, ok := rules[InvalidSymbol(patternSymbol)]; ok {
+						grammar[valueSymbol] = append(grammar[valueSymbol], InvalidSymbol(patternSymbol))
+					}
 				}
-				grammar[fmt.Sprintf("<pattern-%s>", name)] = convertPatternToGrammar(pattern)
 			}
 		}
 	}
@@ -208,20 +399,12 @@ func (f *Form) GenerateGrammar() map[string][]string {
 	return grammar
 }
 
-// convertPatternToGrammar converts an HTML5 pattern to grammar rules
-func convertPatternToGrammar(pattern string) []string {
-	// This is a simplified conversion - a full implementation would need
-	// to handle all regex patterns
-	rules := make([]string, 0)
-
-	// Handle basic character classes
-	pattern = strings.ReplaceAll(pattern, "[0-9]", "<digit>")
-	pattern = strings.ReplaceAll(pattern, "[a-z]", "<lower>")
-	pattern = strings.ReplaceAll(pattern, "[A-Z]", "<upper>")
-	pattern = strings.ReplaceAll(pattern, "[a-zA-Z]", "<letter>")
-
-	// Add the converted pattern as a rule
-	rules = append(rules, pattern)
-
-	return rules
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
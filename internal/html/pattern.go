@@ -0,0 +1,292 @@
+package html
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// maxClassSamples bounds how many characters of a character class become
+// grammar alternatives; larger classes are sampled at their boundaries
+const maxClassSamples = 16
+
+// PatternGrammar converts an HTML5 pattern attribute into grammar rules.
+// symbol (for example "<pattern-zip>") derives values matching the whole
+// pattern. When the pattern has boundaries that can be violated, the rules
+// also define InvalidSymbol(symbol), which derives values just outside them:
+// one repetition too few or too many, a character adjacent to a class range,
+// a truncated literal.
+func PatternGrammar(symbol, pattern string) (map[string][]string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+
+	c := &patternCompiler{
+		prefix: strings.TrimSuffix(symbol, ">"),
+		rules:  make(map[string][]string),
+	}
+	valid, invalid := c.compile(re)
+	c.rules[symbol] = []string{valid}
+
+	// Browsers anchor patterns to the whole value; drop invalid candidates
+	// that are plain text and still match
+	anchored, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	var kept []string
+	seen := make(map[string]bool)
+	for _, alt := range invalid {
+		if seen[alt] || (c.isLiteral(alt) && anchored.MatchString(alt)) {
+			continue
+		}
+		seen[alt] = true
+		kept = append(kept, alt)
+	}
+	if len(kept) > 0 {
+		c.rules[InvalidSymbol(symbol)] = kept
+	}
+
+	return c.rules, nil
+}
+
+// InvalidSymbol returns the symbol PatternGrammar uses for boundary-invalid
+// values of symbol
+func InvalidSymbol(symbol string) string {
+	return strings.TrimSuffix(symbol, ">") + "-invalid>"
+}
+
+// patternCompiler translates a parsed regular expression into grammar rules.
+// Every node yields an expansion for matching text and a list of expansions
+// for text that violates one of its boundaries.
+type patternCompiler struct {
+	prefix string // Symbol name without the closing '>', used for helper rules
+	rules  map[string][]string
+	next   int
+}
+
+// define adds a helper rule with the given alternatives and returns its symbol
+func (c *patternCompiler) define(alternatives []string) string {
+	if len(alternatives) == 1 {
+		return alternatives[0]
+	}
+	symbol := c.newSymbol()
+	c.rules[symbol] = alternatives
+	return symbol
+}
+
+// newSymbol returns a fresh helper symbol name
+func (c *patternCompiler) newSymbol() string {
+	c.next++
+	return fmt.Sprintf("%s-%d>", c.prefix, c.next)
+}
+
+// isLiteral reports whether an expansion references none of the helper rules
+func (c *patternCompiler) isLiteral(expansion string) bool {
+	if !strings.Contains(expansion, c.prefix) {
+		return true
+	}
+	for symbol := range c.rules {
+		if strings.Contains(expansion, symbol) {
+			return false
+		}
+	}
+	return true
+}
+
+// compile returns the valid expansion and boundary-invalid expansions of a node
+func (c *patternCompiler) compile(re *syntax.Regexp) (string, []string) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return c.literal(re.Rune)
+
+	case syntax.OpCharClass:
+		return c.charClass(re.Rune)
+
+	case syntax.OpAnyCharNotNL:
+		return c.define([]string{"a", "Z", "5", "-", " "}), []string{"\n"}
+
+	case syntax.OpAnyChar:
+		return c.define([]string{"a", "Z", "5", "-", " "}), nil
+
+	case syntax.OpCapture:
+		return c.compile(re.Sub[0])
+
+	case syntax.OpStar:
+		return c.repeat(re.Sub[0], 0, -1)
+
+	case syntax.OpPlus:
+		return c.repeat(re.Sub[0], 1, -1)
+
+	case syntax.OpQuest:
+		return c.repeat(re.Sub[0], 0, 1)
+
+	case syntax.OpRepeat:
+		return c.repeat(re.Sub[0], re.Min, re.Max)
+
+	case syntax.OpConcat:
+		valid := make([]string, len(re.Sub))
+		invalid := make([][]string, len(re.Sub))
+		for i, sub := range re.Sub {
+			valid[i], invalid[i] = c.compile(sub)
+		}
+
+		// Break one element at a time, keeping the others valid
+		var broken []string
+		for i := range re.Sub {
+			for _, bad := range invalid[i] {
+				prefix := strings.Join(valid[:i], "")
+				suffix := strings.Join(valid[i+1:], "")
+				broken = append(broken, prefix+bad+suffix)
+			}
+		}
+		return strings.Join(valid, ""), broken
+
+	case syntax.OpAlternate:
+		// An invalid value for one branch may still match another; literal
+		// candidates are checked against the whole pattern afterwards
+		var valid, invalid []string
+		for _, sub := range re.Sub {
+			v, inv := c.compile(sub)
+			valid = append(valid, v)
+			invalid = append(invalid, inv...)
+		}
+		return c.define(valid), invalid
+	}
+
+	// Anchors, word boundaries and empty matches consume no input
+	return "", nil
+}
+
+// literal compiles a run of literal characters. Invalid forms drop the last
+// character or replace the first one.
+func (c *patternCompiler) literal(runes []rune) (string, []string) {
+	text := string(runes)
+	if len(runes) == 0 {
+		return "", nil
+	}
+
+	replacement := "!"
+	if !unicode.IsLetter(runes[0]) && !unicode.IsDigit(runes[0]) {
+		replacement = "a"
+	}
+	return text, []string{
+		string(runes[:len(runes)-1]),
+		replacement + string(runes[1:]),
+	}
+}
+
+// charClass compiles a character class given as sorted [lo, hi] rune pairs.
+// Valid values are the class members, sampled at range boundaries for large
+// classes; invalid values are the printable characters adjacent to a range.
+func (c *patternCompiler) charClass(ranges []rune) (string, []string) {
+	in := func(r rune) bool {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if r >= ranges[i] && r <= ranges[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var valid []string
+	seen := make(map[rune]bool)
+	add := func(r rune) {
+		if !seen[r] && len(valid) < maxClassSamples {
+			seen[r] = true
+			valid = append(valid, string(r))
+		}
+	}
+
+	// Prefer printable ASCII members, which survive any transport
+	var ascii []rune
+	for r := rune(' '); r <= '~'; r++ {
+		if in(r) {
+			ascii = append(ascii, r)
+		}
+	}
+	if len(ascii) > 0 && len(ascii) <= maxClassSamples {
+		for _, r := range ascii {
+			add(r)
+		}
+	} else {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			lo, hi := ranges[i], ranges[i+1]
+			if len(ascii) > 0 {
+				// Clip to ASCII so negated classes do not sample U+10FFFF
+				lo, hi = max(lo, ' '), min(hi, '~')
+				if lo > hi {
+					continue
+				}
+			}
+			add(lo)
+			add(hi)
+			add(lo + (hi-lo)/2)
+		}
+	}
+
+	var invalid []string
+	outside := make(map[rune]bool)
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for _, r := range []rune{ranges[i] - 1, ranges[i+1] + 1} {
+			if r >= ' ' && r <= '~' && !in(r) && !outside[r] {
+				outside[r] = true
+				invalid = append(invalid, string(r))
+			}
+		}
+	}
+	if len(invalid) == 0 {
+		for _, r := range []rune{' ', '!', 'a', '0', 'é'} {
+			if !in(r) {
+				invalid = append(invalid, string(r))
+				break
+			}
+		}
+	}
+
+	if len(valid) == 0 {
+		return "", invalid
+	}
+	return c.define(valid), invalid
+}
+
+// repeat compiles sub repeated between min and max times, max -1 meaning
+// unbounded. Valid values use the boundary counts; invalid ones fall one
+// repetition short, go one over, or contain one invalid element.
+func (c *patternCompiler) repeat(sub *syntax.Regexp, min, max int) (string, []string) {
+	element, badElements := c.compile(sub)
+
+	valid := []string{strings.Repeat(element, min)}
+	switch {
+	case max == -1:
+		// <tail> ::= element | element <tail>
+		tail := c.newSymbol()
+		c.rules[tail] = []string{element, element + tail}
+		valid = append(valid, strings.Repeat(element, min)+tail)
+	case max > min:
+		valid = append(valid, strings.Repeat(element, max))
+		if max-min > 1 {
+			valid = append(valid, strings.Repeat(element, (min+max)/2))
+		}
+	}
+
+	var invalid []string
+	if min > 0 {
+		invalid = append(invalid, strings.Repeat(element, min-1))
+	}
+	if max >= 0 {
+		invalid = append(invalid, strings.Repeat(element, max+1))
+	}
+	count := min
+	if count == 0 {
+		count = 1
+	}
+	for _, bad := range badElements {
+		invalid = append(invalid, bad+strings.Repeat(element, count-1))
+	}
+
+	return c.define(valid), invalid
+}
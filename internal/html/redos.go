@@ -0,0 +1,266 @@
+package html
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// ReDoSAttack is an input shape that makes a backtracking regex engine
+// explore a number of paths growing with the pump count: Prefix reaches the
+// ambiguous part of the pattern, Pump is repeated, and Suffix makes the
+// whole match fail so every path gets tried.
+type ReDoSAttack struct {
+	Prefix      string
+	Pump        string
+	Suffix      string
+	Exponential bool   // Nested or overlapping repetition; otherwise polynomial
+	Reason      string // The ambiguous construct, for reports
+}
+
+// Value returns the attack with the pump repeated n times
+func (a ReDoSAttack) Value(n int) string {
+	return a.Prefix + strings.Repeat(a.Pump, n) + a.Suffix
+}
+
+// failSuffixes are tried in turn to end an attack on a character the
+// pattern rejects
+var failSuffixes = []string{"!", "#", "~", " ", "\n", "\x00"}
+
+// ReDoSAttacks finds the constructs of an HTML5 pattern attribute that
+// backtracking engines match in super-linear time, and returns an attack for
+// each: a repetition whose body holds another unbounded repetition, as in
+// (a+)+, or alternatives that match the same text, are exponential; two
+// adjacent unbounded repetitions of overlapping characters, as in \d+\d+,
+// are polynomial. Go's own engine is linear, so it is used to check that
+// every attack fails the anchored pattern.
+func ReDoSAttacks(pattern string) ([]ReDoSAttack, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	anchored, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+
+	var attacks []ReDoSAttack
+	seen := make(map[string]bool)
+	for _, attack := range findAmbiguity(re, "") {
+		// Some suffix must break the match, or the engine stops at the first
+		// path that succeeds
+		for _, suffix := range failSuffixes {
+			attack.Suffix = suffix
+			if !anchored.MatchString(attack.Value(8)) {
+				break
+			}
+			attack.Suffix = ""
+		}
+		key := attack.Prefix + "\x00" + attack.Pump
+		if attack.Suffix == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		attacks = append(attacks, attack)
+	}
+	return attacks, nil
+}
+
+// findAmbiguity walks the pattern and returns an attack, without its
+// suffix, for each ambiguous construct. prefix is the shortest text leading
+// up to the node.
+func findAmbiguity(re *syntax.Regexp, prefix string) []ReDoSAttack {
+	var attacks []ReDoSAttack
+	switch re.Op {
+	case syntax.OpCapture:
+		return findAmbiguity(re.Sub[0], prefix)
+
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		if !unbounded(re) {
+			break
+		}
+		body := re.Sub[0]
+		if inner := innerRepeat(body); inner != nil {
+			if pump := shortestNonEmpty(inner.Sub[0]); pump != "" {
+				attacks = append(attacks, ReDoSAttack{
+					Prefix: prefix, Pump: pump, Exponential: true,
+					Reason: fmt.Sprintf("nested repetition %s", re),
+				})
+			}
+		}
+		if pump := overlappingBranches(body); pump != "" {
+			attacks = append(attacks, ReDoSAttack{
+				Prefix: prefix, Pump: pump, Exponential: true,
+				Reason: fmt.Sprintf("overlapping alternatives in %s", re),
+			})
+		}
+		attacks = append(attacks, findAmbiguity(body, prefix)...)
+
+	case syntax.OpConcat:
+		for i, sub := range re.Sub {
+			attacks = append(attacks, findAmbiguity(sub, prefix)...)
+			if i+1 < len(re.Sub) && unbounded(sub) && unbounded(re.Sub[i+1]) {
+				pump := shortestNonEmpty(sub.Sub[0])
+				if pump != "" && matchesWhole(re.Sub[i+1].Sub[0], pump) {
+					attacks = append(attacks, ReDoSAttack{
+						Prefix: prefix, Pump: pump,
+						Reason: fmt.Sprintf("adjacent repetitions %s%s", sub, re.Sub[i+1]),
+					})
+				}
+			}
+			prefix += shortest(sub)
+		}
+
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			attacks = append(attacks, findAmbiguity(sub, prefix)...)
+		}
+	}
+	return attacks
+}
+
+// unbounded reports whether a node repeats without an upper limit
+func unbounded(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max == -1
+	}
+	return false
+}
+
+// innerRepeat returns an unbounded repetition inside a node, looking through
+// groups, sequences and alternatives
+func innerRepeat(re *syntax.Regexp) *syntax.Regexp {
+	if unbounded(re) {
+		return re
+	}
+	switch re.Op {
+	case syntax.OpCapture, syntax.OpConcat, syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if inner := innerRepeat(sub); inner != nil {
+				return inner
+			}
+		}
+	}
+	return nil
+}
+
+// overlappingBranches returns text two alternatives of a node both match
+// whole, or "" when the alternatives are disjoint on their shortest texts
+func overlappingBranches(re *syntax.Regexp) string {
+	for re.Op == syntax.OpCapture {
+		re = re.Sub[0]
+	}
+	if re.Op != syntax.OpAlternate {
+		return ""
+	}
+	for i, sub := range re.Sub {
+		text := shortestNonEmpty(sub)
+		if text == "" {
+			continue
+		}
+		for j, other := range re.Sub {
+			if i != j && matchesWhole(other, text) {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// matchesWhole reports whether a node matches all of text
+func matchesWhole(re *syntax.Regexp, text string) bool {
+	compiled, err := regexp.Compile("^(?:" + re.String() + ")$")
+	return err == nil && compiled.MatchString(text)
+}
+
+// shortestNonEmpty returns the shortest text a node matches, taking one
+// repetition of starred nodes so the text is never empty when it can be
+// avoided
+func shortestNonEmpty(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpQuest:
+		return shortestNonEmpty(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min == 0 {
+			return shortestNonEmpty(re.Sub[0])
+		}
+	case syntax.OpCapture:
+		return shortestNonEmpty(re.Sub[0])
+	case syntax.OpConcat:
+		var text string
+		for _, sub := range re.Sub {
+			text += shortest(sub)
+		}
+		if text != "" {
+			return text
+		}
+		for _, sub := range re.Sub {
+			if text := shortestNonEmpty(sub); text != "" {
+				return text
+			}
+		}
+		return ""
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if text := shortestNonEmpty(sub); text != "" {
+				return text
+			}
+		}
+		return ""
+	}
+	return shortest(re)
+}
+
+// shortest returns a shortest text a node matches
+func shortest(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return string(re.Rune)
+	case syntax.OpCharClass:
+		return classSample(re.Rune)
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return "a"
+	case syntax.OpCapture:
+		return shortest(re.Sub[0])
+	case syntax.OpPlus:
+		return shortest(re.Sub[0])
+	case syntax.OpRepeat:
+		return strings.Repeat(shortest(re.Sub[0]), re.Min)
+	case syntax.OpConcat:
+		var text string
+		for _, sub := range re.Sub {
+			text += shortest(sub)
+		}
+		return text
+	case syntax.OpAlternate:
+		best := shortest(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			if text := shortest(sub); len(text) < len(best) {
+				best = text
+			}
+		}
+		return best
+	}
+	// Stars, optional parts, anchors and empty matches need no input
+	return ""
+}
+
+// classSample returns a member of a character class given as sorted
+// [lo, hi] rune pairs, preferring a printable ASCII letter or digit
+func classSample(ranges []rune) string {
+	if len(ranges) < 2 {
+		return ""
+	}
+	for _, r := range "a0A_-. " {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if r >= ranges[i] && r <= ranges[i+1] {
+				return string(r)
+			}
+		}
+	}
+	return string(ranges[0])
+}
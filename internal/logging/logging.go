@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Options controls how log records are rendered
+type Options struct {
+	Level string // debug, info, warn or error
+	JSON  bool   // Emit JSON records instead of key=value text
+}
+
+// Setup installs the process-wide logger writing to w
+func Setup(w io.Writer, opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if opts.JSON {
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(w, handlerOpts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// ParseLevel converts a level name into a slog.Level
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level: %s", name)
+	}
+}
+
+// For returns a logger tagged with the given module name
+func For(module string) *slog.Logger {
+	return slog.Default().With("module", module)
+}
@@ -0,0 +1,61 @@
+// Package report exposes the types produced by a fuzzing run so that callers
+// can consume and render results.
+package report
+
+import (
+	"github.com/gregcmartin/gofuzz/internal/fuzzer"
+)
+
+// Result represents a fuzzing test result
+type Result = fuzzer.Result
+
+// Finding represents a single issue reported by a detector
+type Finding = fuzzer.Finding
+
+// FindingStore collects findings from all detectors, deduplicating by signature
+type FindingStore = fuzzer.FindingStore
+
+// Severity ranks how serious a finding is
+type Severity = fuzzer.Severity
+
+// Confidence describes how certain a detector is about a finding
+type Confidence = fuzzer.Confidence
+
+// Outage is a period the target was unstable and fuzzing was paused
+type Outage = fuzzer.Outage
+
+// Severity levels
+const (
+	SeverityInfo     = fuzzer.SeverityInfo
+	SeverityLow      = fuzzer.SeverityLow
+	SeverityMedium   = fuzzer.SeverityMedium
+	SeverityHigh     = fuzzer.SeverityHigh
+	SeverityCritical = fuzzer.SeverityCritical
+)
+
+// Confidence levels
+const (
+	ConfidenceTentative = fuzzer.ConfidenceTentative
+	ConfidenceFirm      = fuzzer.ConfidenceFirm
+	ConfidenceCertain   = fuzzer.ConfidenceCertain
+)
+
+// NewFindingStore creates an empty finding store
+func NewFindingStore() *FindingStore {
+	return fuzzer.NewFindingStore()
+}
+
+// LoadFindings reads findings saved as JSON lines by FindingStore.Save
+func LoadFindings(path string) ([]*Finding, error) {
+	return fuzzer.LoadFindings(path)
+}
+
+// LoadOutages reads the outages a run saved to outages.json
+func LoadOutages(path string) ([]Outage, error) {
+	return fuzzer.LoadOutages(path)
+}
+
+// ParseSeverity parses a severity name such as "medium"
+func ParseSeverity(name string) (Severity, error) {
+	return fuzzer.ParseSeverity(name)
+}